@@ -0,0 +1,109 @@
+// Package alerting posts alerts for operators to Slack and Telegram.
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// telegramAPI is the Telegram Bot API the bot token is appended to
+var telegramAPI = "https://api.telegram.org/bot"
+
+// Enabled reports whether an alert channel is configured
+func Enabled() bool {
+	cfg := config.AppConfig
+	return cfg.AlertSlackWebhookURL != "" || cfg.AlertTelegramBotToken != ""
+}
+
+// Raise posts message to every configured channel and records the alert,
+// unless an alert of the same kind about subject was delivered within the
+// cooldown. It reports whether the alert was delivered; channels that can't
+// be reached are logged and recorded on the alert.
+func Raise(kind, subject, message string) (bool, error) {
+	if !Enabled() {
+		return false, nil
+	}
+
+	cooldown := time.Now().Add(-time.Duration(config.AppConfig.AlertCooldownMinutes) * time.Minute)
+	var recent int64
+	if err := database.DB.Model(&database.Alert{}).
+		Where("kind = ? AND subject = ? AND delivered AND created_at > ?", kind, subject, cooldown).
+		Count(&recent).Error; err != nil {
+		return false, err
+	}
+	if recent > 0 {
+		return false, nil
+	}
+
+	alert := database.Alert{Kind: kind, Subject: subject, Message: message}
+	var failures []error
+	for _, send := range channels() {
+		if err := send(message); err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		alert.Delivered = true
+	}
+	if err := errors.Join(failures...); err != nil {
+		log.Printf("⚠️ Alert %s/%s not posted everywhere: %v", kind, subject, err)
+		alert.Error = err.Error()
+	}
+	if err := database.DB.Create(&alert).Error; err != nil {
+		return alert.Delivered, err
+	}
+	return alert.Delivered, nil
+}
+
+// channels returns a sender for each configured channel
+func channels() []func(text string) error {
+	cfg := config.AppConfig
+	var senders []func(string) error
+	if cfg.AlertSlackWebhookURL != "" {
+		senders = append(senders, func(text string) error {
+			return post("slack", cfg.AlertSlackWebhookURL, map[string]string{"text": text})
+		})
+	}
+	if cfg.AlertTelegramBotToken != "" {
+		senders = append(senders, func(text string) error {
+			return post("telegram", telegramAPI+url.PathEscape(cfg.AlertTelegramBotToken)+"/sendMessage",
+				map[string]string{"chat_id": cfg.AlertTelegramChatID, "text": text})
+		})
+	}
+	return senders
+}
+
+// post sends body as JSON to a channel. Errors name the channel rather than
+// the URL, which holds its secret.
+func post(channel, endpoint string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %v", channel, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: status %d: %s", channel, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Package apperror defines the errors handlers return to API clients. Every
+// error response has the same envelope: {"error": message, "code": code}
+// plus "details" when there is more to say, such as which fields failed
+// validation.
+package apperror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes clients can branch on
+const (
+	CodeBadRequest         = "bad_request"
+	CodeValidation         = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeUnprocessable      = "unprocessable"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+	CodeBadGateway         = "bad_gateway"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeTimeout            = "timeout"
+)
+
+// statusCodes is the code used for each status when a handler doesn't pick one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusBadGateway:            CodeBadGateway,
+	http.StatusServiceUnavailable:    CodeServiceUnavailable,
+	http.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// CodeForStatus returns the default error code for an HTTP status
+func CodeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Error is an error with the HTTP status, code and user-facing message to
+// respond with. Err is the underlying cause; it is logged, never shown.
+type Error struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
+	Err     error       `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails returns a copy of the error carrying details for the client
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// WithMessage returns a copy of the error with a different message
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// Wrap returns a copy of the error recording its cause
+func (e *Error) Wrap(err error) *Error {
+	copied := *e
+	copied.Err = err
+	return &copied
+}
+
+// New returns an error responded to with status and code
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest is a malformed request
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Validation is a request whose fields failed validation; details list them
+func Validation(details interface{}) *Error {
+	return New(http.StatusBadRequest, CodeValidation, "Invalid request data").WithDetails(details)
+}
+
+// Unauthorized is a request without valid credentials
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is a request the caller may not make
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is a request for something that doesn't exist
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict is a request the resource's current state doesn't allow
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Internal is an unexpected failure; the cause is logged and the client
+// gets a generic message
+func Internal(err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "Server error").Wrap(err)
+}
+
+// Timeout is a request that ran past its deadline
+func Timeout(err error) *Error {
+	return New(http.StatusGatewayTimeout, CodeTimeout, "The request took too long, please try again").Wrap(err)
+}
+
+// Respond writes err as an error response. Errors that aren't an *Error
+// are internal errors, or timeouts when the request's deadline passed; the
+// causes of server-side failures are logged and recorded on the context for
+// error reporting.
+func Respond(c *gin.Context, err error) {
+	var appErr *Error
+	if !errors.As(err, &appErr) {
+		appErr = Internal(err)
+	}
+	if appErr.Status == http.StatusInternalServerError && errors.Is(err, context.DeadlineExceeded) {
+		appErr = Timeout(err)
+	}
+	if appErr.Err != nil && appErr.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), appErr)
+		_ = c.Error(appErr)
+	}
+	c.AbortWithStatusJSON(appErr.Status, appErr)
+}
+
+// Abort records err for the central error handler to respond with and
+// stops the handler chain
+func Abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,137 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError says which request field failed which rule, with a message a
+// form can show next to the field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report fields by the JSON (or form) names clients send
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name := strings.Split(field.Tag.Get(tag), ",")[0]
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// Binding turns a ShouldBind error into a response: a validation error
+// listing each offending field, or a bad request for a body that isn't JSON
+func Binding(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, translate(fieldErr))
+		}
+		return Validation(fields).Wrap(err)
+	case errors.As(err, &typeErr):
+		return Validation([]FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be %s", typeErr.Field, article(typeErr.Type.Kind())),
+		}}).Wrap(err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return BadRequest("Request body must be valid JSON").Wrap(err)
+	}
+	return BadRequest("Invalid request data").Wrap(err)
+}
+
+// translate describes one failed validation rule
+func translate(fieldErr validator.FieldError) FieldError {
+	field := fieldErr.Namespace()
+	// Drop the request struct's name, keeping nested paths like items[0].quantity
+	if _, path, found := strings.Cut(field, "."); found {
+		field = path
+	}
+	param := fieldErr.Param()
+
+	var message string
+	switch fieldErr.Tag() {
+	case "required":
+		message = "is required"
+	case "email":
+		message = "must be a valid email address"
+	case "url":
+		message = "must be a valid URL"
+	case "numeric":
+		message = "must contain only digits"
+	case "oneof":
+		message = "must be one of: " + strings.Join(strings.Fields(param), ", ")
+	case "len":
+		message = "must be exactly " + sizeOf(fieldErr, param)
+	case "min":
+		message = "must be at least " + sizeOf(fieldErr, param)
+	case "max":
+		message = "must be at most " + sizeOf(fieldErr, param)
+	case "gt":
+		message = "must be greater than " + sizeOf(fieldErr, param)
+	case "gte":
+		message = "must be at least " + sizeOf(fieldErr, param)
+	case "lt":
+		message = "must be less than " + sizeOf(fieldErr, param)
+	case "lte":
+		message = "must be at most " + sizeOf(fieldErr, param)
+	default:
+		message = "is invalid"
+	}
+	return FieldError{Field: field, Rule: fieldErr.Tag(), Message: field + " " + message}
+}
+
+// sizeOf phrases a length or size limit for the field's kind: characters
+// for strings, items for lists, the number itself for numbers
+func sizeOf(fieldErr validator.FieldError, param string) string {
+	switch fieldErr.Kind() {
+	case reflect.String:
+		return param + " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return param + " items"
+	}
+	return param
+}
+
+// article names a JSON type for a type-mismatch message
+func article(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a valid value"
+}
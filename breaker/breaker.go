@@ -0,0 +1,103 @@
+// Package breaker stops calling a dependency that keeps failing, so requests
+// fail fast while it recovers instead of each waiting out a timeout.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned instead of making a call while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Breaker states
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// Breaker opens after MaxFailures calls in a row fail. Once open it rejects
+// calls for OpenFor, then lets a single trial call through: success closes it
+// again, failure keeps it open for another OpenFor.
+type Breaker struct {
+	Name        string
+	MaxFailures int
+	OpenFor     time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial call is in flight
+}
+
+// New returns a closed breaker
+func New(name string, maxFailures int, openFor time.Duration) *Breaker {
+	return &Breaker{Name: name, MaxFailures: maxFailures, OpenFor: openFor, state: StateClosed}
+}
+
+// State reports whether the breaker is closed, open or half-open
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.OpenFor {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Execute runs call unless the breaker is open, in which case it returns
+// ErrOpen. isFailure decides which errors count against the dependency;
+// errors it rejects, such as invalid requests, are returned without
+// affecting the breaker.
+func (b *Breaker) Execute(call func() error, isFailure func(error) bool) error {
+	if !b.allow() {
+		return ErrOpen
+	}
+	err := call()
+	b.record(err != nil && isFailure(err))
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		return true
+	case StateOpen:
+		if time.Since(b.openedAt) < b.OpenFor {
+			return false
+		}
+		b.state = StateHalfOpen
+	}
+	if b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.trial = false
+		if failed {
+			b.state, b.openedAt = StateOpen, time.Now()
+		} else {
+			b.state, b.failures = StateClosed, 0
+		}
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.MaxFailures {
+		b.state, b.openedAt = StateOpen, time.Now()
+	}
+}
@@ -0,0 +1,106 @@
+// Package cache provides a small key/value cache with TTLs, backed by Redis
+// when REDIS_URL is set and by process memory otherwise.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"aquahome/config"
+	"aquahome/tenant"
+)
+
+// Key prefixes shared by readers and the write-invalidation rules
+const (
+	PrefixDashboard = "dashboard:"
+	PrefixProducts  = "products:"
+	PrefixLocations = "locations:"
+)
+
+// Store is a cache backend
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// Default is the store used by the package helpers
+var Default Store = NewMemoryStore()
+
+// Init selects the backend from the configuration
+func Init() error {
+	if config.AppConfig.RedisURL == "" {
+		log.Println("ℹ️ Using in-memory cache (REDIS_URL not set)")
+		return nil
+	}
+
+	store, err := NewRedisStore(config.AppConfig.RedisURL)
+	if err != nil {
+		return err
+	}
+	Default = store
+	log.Println("✅ Redis cache connected")
+	return nil
+}
+
+// Close releases the backend's connections, if it holds any
+func Close() error {
+	if closer, ok := Default.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// tenantKey keeps the entries of each tenant apart. The tenant goes at the
+// end, so invalidating a prefix drops it for every tenant.
+func tenantKey(ctx context.Context, key string) string {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return key + "@tenant:" + strconv.FormatUint(uint64(id), 10)
+	}
+	return key
+}
+
+// GetJSON loads key into dest and reports whether it was found. Backend
+// errors are logged and treated as a miss.
+func GetJSON(ctx context.Context, key string, dest interface{}) bool {
+	key = tenantKey(ctx, key)
+	data, ok, err := Default.Get(ctx, key)
+	if err != nil {
+		log.Printf("Cache get %s failed: %v", key, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		log.Printf("Cache entry %s is corrupt: %v", key, err)
+		return false
+	}
+	return true
+}
+
+// SetJSON stores value under key for ttl
+func SetJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	key = tenantKey(ctx, key)
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Cache encode %s failed: %v", key, err)
+		return
+	}
+	if err := Default.Set(ctx, key, data, ttl); err != nil {
+		log.Printf("Cache set %s failed: %v", key, err)
+	}
+}
+
+// Invalidate drops every entry under the given prefixes
+func Invalidate(ctx context.Context, prefixes ...string) {
+	for _, prefix := range prefixes {
+		if err := Default.DeletePrefix(ctx, prefix); err != nil {
+			log.Printf("Cache invalidate %s failed: %v", prefix, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"gorm.io/gorm"
+)
+
+// InvalidateOnWrite drops cached entries whenever rows of a table are created,
+// updated or deleted through db. rules maps table names to key prefixes.
+func InvalidateOnWrite(db *gorm.DB, rules map[string][]string) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		if prefixes, ok := rules[tx.Statement.Table]; ok {
+			Invalidate(tx.Statement.Context, prefixes...)
+		}
+	}
+
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("cache:invalidate_create", invalidate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("cache:invalidate_update", invalidate); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("cache:invalidate_delete", invalidate)
+}
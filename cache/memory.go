@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryStore keeps entries in process memory; it is only coherent for a
+// single instance of the API
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+// Get returns the value of a live entry
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	entry, ok := s.entries[key]
+	s.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Set stores a value until ttl elapses
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// Sweep expired entries now and then so the map doesn't grow forever
+	if len(s.entries) > 10000 {
+		for k, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	s.entries[key] = memoryEntry{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// DeletePrefix removes all entries whose key starts with prefix
+func (s *MemoryStore) DeletePrefix(_ context.Context, prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
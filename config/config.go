@@ -1,55 +1,377 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds all application configuration
 type Config struct {
-	// Database config
-	DBDriver   string
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBPath     string // SQLite database file path
+	// Database config; DatabaseURL, when set, is used instead of the DB_* parts
+	DatabaseURL string
+	DBSSLMode   string
+	DBDriver    string
+	DBHost      string
+	DBPort      string
+	DBUser      string
+	DBPassword  string
+	DBName      string
+	DBPath      string // SQLite database file path
+
+	// Read replica DSNs; dashboards, reports and exports read from these
+	// when set, everything else uses the primary
+	DBReplicaDSNs []string
+
+	// Queries taking longer than this many milliseconds are logged as slow
+	DBSlowQueryMS int
 
 	// Auth config
-	JWTSecret      string
-	JWTExpiryHours int
+	JWTSecret            string
+	JWTExpiryHours       int
+	AccessTokenMinutes   int // lifetime of access tokens issued with a refresh token
+	ImpersonationMinutes int // lifetime of tokens admins get to act as a user
+	RefreshTokenDays     int
+	GoogleClientIDs      []string // OAuth client IDs accepted as ID token audience
+	APIKeyRateLimit      int      // default requests per minute for a partner API key
+
+	// CAPTCHA on public forms such as lead capture: the secret and the
+	// siteverify endpoint of reCAPTCHA, or a compatible one like hCaptcha
+	CaptchaSecret    string
+	CaptchaVerifyURL string
+
+	// Whether customers must confirm their email address before placing orders
+	RequireVerifiedEmail bool
 
 	// App config
-	Environment string
+	Environment string // profile: development, staging or production
+	Port        string
+	AppBaseURL  string // frontend URL used in emailed links
+	UploadDir   string // where uploaded files are stored, served under /uploads
+	AdminToken  string // lets admin accounts be registered through the API
+
+	// How long shutdown waits for in-flight requests and background jobs
+	ShutdownTimeoutSeconds int
+
+	// Load balancers and proxies in front of the app, as IPs or CIDRs. Only
+	// their X-Forwarded-For is believed when working out a client's IP, so
+	// with none set clients are known by the address they connect from.
+	TrustedProxies []string
+
+	// How long a request may run before its queries and outgoing calls are
+	// cancelled; uploads and exports get LongRequestTimeoutSeconds. 0 means
+	// no limit.
+	RequestTimeoutSeconds     int
+	LongRequestTimeoutSeconds int
+
+	// Directory where personal data export archives are written
+	DataExportDir string
+
+	// Payment config; PaymentProvider "mock" fakes Razorpay for development
+	// and end-to-end tests
+	PaymentProvider       string
+	RazorpayKey           string
+	RazorpaySecret        string
+	RazorpayWebhookSecret string
+
+	// Razorpay calls time out after RazorpayTimeoutSeconds, and failed calls
+	// that are safe to repeat are retried up to RazorpayMaxRetries times.
+	// After RazorpayBreakerFailures failures in a row, calls are refused for
+	// RazorpayBreakerOpenSeconds.
+	RazorpayTimeoutSeconds     int
+	RazorpayMaxRetries         int
+	RazorpayBreakerFailures    int
+	RazorpayBreakerOpenSeconds int
+
+	// RazorpayX payout config; franchise payouts are disabled without an account number
+	RazorpayXURL           string
+	RazorpayXAccountNumber string
+	PayoutMaxAttempts      int
+
+	// Background job config; QueueWorkers tasks from the job queue run at once
+	SchedulerEnabled           bool
+	MaintenanceIntervalMinutes int
+	QueueWorkers               int
+
+	// Retention config: notifications older than NotificationRetentionMonths,
+	// and service requests closed longer than ServiceRequestRetentionMonths,
+	// are moved to the archive; 0 keeps them
+	NotificationRetentionMonths   int
+	ServiceRequestRetentionMonths int
+
+	// Service level: hours within which a service request should be completed,
+	// overridable per request type (e.g. repair=24,maintenance=48). Requests
+	// still open past the target go to the franchise owner, and to admins
+	// SLAAdminEscalationHours later.
+	ServiceSLAHours         int
+	ServiceSLAHoursByType   map[string]int
+	SLAAdminEscalationHours int
+
+	// Operator alerts, posted to a Slack incoming webhook and/or a Telegram
+	// chat when either is set. Checks run every AlertIntervalMinutes, and an
+	// alert about the same thing isn't repeated within AlertCooldownMinutes.
+	AlertSlackWebhookURL             string
+	AlertTelegramBotToken            string
+	AlertTelegramChatID              string
+	AlertIntervalMinutes             int
+	AlertCooldownMinutes             int
+	AlertPaymentFailureThreshold     int // failed payment verifications within AlertPaymentFailureWindowMinutes
+	AlertPaymentFailureWindowMinutes int
+	AlertSLABreachThreshold          int // SLA breaches of one franchise within a day
+	AlertWebhookFailureThreshold     int // failed attempts of a delivery before its endpoint is alerted on
+
+	// How far from the customer's location an agent may check in, in metres
+	CheckInRadiusMeters int
+
+	// Geocoding config; without GeocodingAPIKey franchises are matched by pincode only
+	GeocodingURL    string
+	GeocodingAPIKey string
+
+	// Installation lead time quoted before a franchise has enough installs to estimate it
+	InstallationLeadDays int
+
+	// Default percent of net collections paid to a franchise in monthly settlements
+	FranchiseRevenueShare float64
+
+	// Tax config; GSTRate is the default percent, products may override it
+	GSTRate float64
+
+	// Locale of notifications for users who haven't picked one
+	DefaultLocale string
+
+	// Dunning config for overdue rent, in days past the billing date
+	DunningReminderDays []int
+	LateFeeAfterDays    int
+	LateFeeAmount       float64
+	SuspendAfterDays    int
+
+	// Email config; when SMTPHost is empty emails are written to the log
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUser     string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// SMS config; when SMSAPIURL is empty messages are written to the log
+	SMSAPIURL   string
+	SMSAPIKey   string
+	SMSSenderID string
+
+	// Push gateway config; when PushAPIURL is empty notifications are written to the log
+	PushAPIURL string
+	PushAPIKey string
 
-	// Payment config
-	RazorpayKey    string
-	RazorpaySecret string
+	// Response compression; bodies of CompressionContentTypes of at least
+	// CompressionMinBytes are gzipped (or deflated) at CompressionLevel
+	CompressionEnabled      bool
+	CompressionMinBytes     int
+	CompressionLevel        int
+	CompressionContentTypes []string
+
+	// Metrics config; when MetricsToken is set /metrics requires it as a bearer token
+	MetricsToken string
+
+	// Cache config; when RedisURL is empty an in-process cache is used
+	RedisURL string
+
+	// Direct upload config; presigned S3 uploads are disabled without S3Bucket.
+	// S3Endpoint points at an S3-compatible store instead of AWS, and
+	// S3PublicURL is where uploaded objects are served from.
+	S3Bucket          string
+	S3Region          string
+	S3Endpoint        string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PublicURL       string
+
+	// Tracing config; spans are exported only when OTLPEndpoint is set
+	OTLPEndpoint     string
+	ServiceName      string
+	TraceSampleRatio float64
+
+	// Error reporting config; panics and 5xx responses go to Sentry only
+	// when SentryDSN is set
+	SentryDSN        string
+	SentryRelease    string
+	SentrySampleRate float64
 }
 
 var AppConfig Config
 
-// InitConfig initializes the application configuration
-func InitConfig() {
+// Payment providers, picked with PAYMENT_PROVIDER
+const (
+	PaymentProviderRazorpay = "razorpay"
+	PaymentProviderMock     = "mock"
+)
+
+// Credentials the mock payment provider signs with when none are set
+const (
+	mockRazorpayKey    = "rzp_test_mock"
+	mockRazorpaySecret = "mock_secret"
+)
+
+// defaultCompressionContentTypes are the text formats the API and docs serve
+var defaultCompressionContentTypes = []string{
+	"application/json", "text/plain", "text/csv", "text/html", "text/css", "application/javascript",
+}
+
+// InitConfig loads the application configuration from the environment and
+// validates it. The error lists every missing or invalid setting.
+func InitConfig() error {
+	parseErrors = nil
+	environment := Profile()
+
+	// Development falls back to local test credentials; other profiles must set them
+	devDefault := func(value string) string {
+		if environment == ProfileDevelopment {
+			return value
+		}
+		return ""
+	}
+
 	// Set default database driver to PostgreSQL
 	dbDriver := getEnv("DB_DRIVER", "postgres")
 
 	AppConfig = Config{
-		DBDriver:       dbDriver,
-		DBHost:         getEnv("DB_HOST", "localhost"),
-		DBPort:         getEnv("DB_PORT", "5432"),
-		DBUser:         getEnv("DB_USER", "postgres"),
-		DBPassword:     getEnv("DB_PASSWORD", "postgres"),
-		DBName:         getEnv("DB_NAME", "aquahome"),
-		DBPath:         getEnv("DB_PATH", "./aquahome.db"), // Default SQLite database path
-		JWTSecret:      getEnv("JWT_SECRET", "aquahome_default_secret_key"),
-		JWTExpiryHours: getEnvAsInt("JWT_EXPIRY_HOURS", 24),
-		Environment:    getEnv("ENVIRONMENT", "development"),
-		RazorpayKey:    getEnv("RAZORPAY_KEY", "rzp_test_QfMQ0LRiTplCvR"),
-		RazorpaySecret: getEnv("RAZORPAY_SECRET", "169NdofVMND0u1o8yTWsgx47"),
+		DatabaseURL:     getEnv("DATABASE_URL", ""),
+		DBSSLMode:       getEnv("DB_SSLMODE", "require"),
+		DBDriver:        dbDriver,
+		DBHost:          getEnv("DB_HOST", "localhost"),
+		DBPort:          getEnv("DB_PORT", "5432"),
+		DBUser:          getEnv("DB_USER", "postgres"),
+		DBPassword:      getEnv("DB_PASSWORD", "postgres"),
+		DBName:          getEnv("DB_NAME", "aquahome"),
+		DBPath:          getEnv("DB_PATH", "./aquahome.db"), // Default SQLite database path
+		DBReplicaDSNs:   getEnvAsList("DB_REPLICA_DSNS"),
+		DBSlowQueryMS:   getEnvAsInt("DB_SLOW_QUERY_MS", 200),
+		JWTSecret:       getEnv("JWT_SECRET", devDefault(defaultJWTSecret)),
+		JWTExpiryHours:  getEnvAsInt("JWT_EXPIRY_HOURS", 24),
+		Environment:     environment,
+		Port:            getEnv("PORT", "5000"),
+		AppBaseURL:      getEnv("APP_BASE_URL", "http://localhost:3000"),
+		UploadDir:       getEnv("UPLOAD_DIR", "./uploads"),
+		AdminToken:      getEnv("ADMIN_TOKEN", ""),
+		DataExportDir:   getEnv("DATA_EXPORT_DIR", "./exports"),
+		PaymentProvider: strings.ToLower(getEnv("PAYMENT_PROVIDER", PaymentProviderRazorpay)),
+		RazorpayKey:     getEnv("RAZORPAY_KEY", devDefault("rzp_test_QfMQ0LRiTplCvR")),
+		RazorpaySecret:  getEnv("RAZORPAY_SECRET", devDefault("169NdofVMND0u1o8yTWsgx47")),
+
+		ShutdownTimeoutSeconds: getEnvAsInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
+		TrustedProxies:         getEnvAsList("TRUSTED_PROXIES"),
+
+		RequestTimeoutSeconds:     getEnvAsInt("REQUEST_TIMEOUT_SECONDS", 30),
+		LongRequestTimeoutSeconds: getEnvAsInt("LONG_REQUEST_TIMEOUT_SECONDS", 300),
+
+		RazorpayWebhookSecret: getEnv("RAZORPAY_WEBHOOK_SECRET", ""),
+
+		RazorpayTimeoutSeconds:     getEnvAsInt("RAZORPAY_TIMEOUT_SECONDS", 10),
+		RazorpayMaxRetries:         getEnvAsInt("RAZORPAY_MAX_RETRIES", 2),
+		RazorpayBreakerFailures:    getEnvAsInt("RAZORPAY_BREAKER_FAILURES", 5),
+		RazorpayBreakerOpenSeconds: getEnvAsInt("RAZORPAY_BREAKER_OPEN_SECONDS", 30),
+
+		RazorpayXURL:           getEnv("RAZORPAYX_API_URL", "https://api.razorpay.com/v1"),
+		RazorpayXAccountNumber: getEnv("RAZORPAYX_ACCOUNT_NUMBER", ""),
+		PayoutMaxAttempts:      getEnvAsInt("PAYOUT_MAX_ATTEMPTS", 3),
+
+		AccessTokenMinutes:   getEnvAsInt("ACCESS_TOKEN_MINUTES", 60),
+		ImpersonationMinutes: getEnvAsInt("IMPERSONATION_MINUTES", 15),
+		RefreshTokenDays:     getEnvAsInt("REFRESH_TOKEN_DAYS", 30),
+		GoogleClientIDs:      getEnvAsList("GOOGLE_CLIENT_IDS"),
+		APIKeyRateLimit:      getEnvAsInt("API_KEY_RATE_LIMIT", 60),
+
+		CaptchaSecret:    getEnv("CAPTCHA_SECRET", ""),
+		CaptchaVerifyURL: getEnv("CAPTCHA_VERIFY_URL", "https://www.google.com/recaptcha/api/siteverify"),
+
+		RequireVerifiedEmail: getEnvAsBool("REQUIRE_VERIFIED_EMAIL", false),
+
+		SchedulerEnabled:           getEnvAsBool("SCHEDULER_ENABLED", true),
+		MaintenanceIntervalMinutes: getEnvAsInt("MAINTENANCE_INTERVAL_MINUTES", 60),
+		QueueWorkers:               getEnvAsInt("QUEUE_WORKERS", 4),
+
+		NotificationRetentionMonths:   getEnvAsInt("NOTIFICATION_RETENTION_MONTHS", 6),
+		ServiceRequestRetentionMonths: getEnvAsInt("SERVICE_REQUEST_RETENTION_MONTHS", 12),
+
+		ServiceSLAHours:         getEnvAsInt("SERVICE_SLA_HOURS", 48),
+		ServiceSLAHoursByType:   getEnvAsIntMap("SERVICE_SLA_HOURS_BY_TYPE", map[string]int{"repair": 24, "maintenance": 48, "pickup": 72}),
+		SLAAdminEscalationHours: getEnvAsInt("SLA_ADMIN_ESCALATION_HOURS", 24),
+
+		AlertSlackWebhookURL:             getEnv("ALERT_SLACK_WEBHOOK_URL", ""),
+		AlertTelegramBotToken:            getEnv("ALERT_TELEGRAM_BOT_TOKEN", ""),
+		AlertTelegramChatID:              getEnv("ALERT_TELEGRAM_CHAT_ID", ""),
+		AlertIntervalMinutes:             getEnvAsInt("ALERT_INTERVAL_MINUTES", 5),
+		AlertCooldownMinutes:             getEnvAsInt("ALERT_COOLDOWN_MINUTES", 60),
+		AlertPaymentFailureThreshold:     getEnvAsInt("ALERT_PAYMENT_FAILURE_THRESHOLD", 10),
+		AlertPaymentFailureWindowMinutes: getEnvAsInt("ALERT_PAYMENT_FAILURE_WINDOW_MINUTES", 15),
+		AlertSLABreachThreshold:          getEnvAsInt("ALERT_SLA_BREACH_THRESHOLD", 5),
+		AlertWebhookFailureThreshold:     getEnvAsInt("ALERT_WEBHOOK_FAILURE_THRESHOLD", 3),
+
+		CheckInRadiusMeters: getEnvAsInt("CHECK_IN_RADIUS_METERS", 300),
+
+		GeocodingURL:    getEnv("GEOCODING_URL", "https://maps.googleapis.com/maps/api/geocode/json"),
+		GeocodingAPIKey: getEnv("GEOCODING_API_KEY", ""),
+
+		InstallationLeadDays: getEnvAsInt("INSTALLATION_LEAD_DAYS", 3),
+
+		FranchiseRevenueShare: getEnvAsFloat("FRANCHISE_REVENUE_SHARE", 70),
+
+		GSTRate: getEnvAsFloat("GST_RATE", 18),
+
+		DefaultLocale: getEnv("DEFAULT_LOCALE", "en"),
+
+		DunningReminderDays: getEnvAsIntList("DUNNING_REMINDER_DAYS", []int{3, 7, 14}),
+		LateFeeAfterDays:    getEnvAsInt("LATE_FEE_AFTER_DAYS", 7),
+		LateFeeAmount:       getEnvAsFloat("LATE_FEE_AMOUNT", 100),
+		SuspendAfterDays:    getEnvAsInt("SUSPEND_AFTER_DAYS", 21),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "AquaHome <no-reply@aquahome.com>"),
+
+		SMSAPIURL:   getEnv("SMS_API_URL", ""),
+		SMSAPIKey:   getEnv("SMS_API_KEY", ""),
+		SMSSenderID: getEnv("SMS_SENDER_ID", "AQUAHM"),
+
+		PushAPIURL: getEnv("PUSH_API_URL", ""),
+		PushAPIKey: getEnv("PUSH_API_KEY", ""),
+
+		CompressionEnabled:      getEnvAsBool("COMPRESSION_ENABLED", true),
+		CompressionMinBytes:     getEnvAsInt("COMPRESSION_MIN_BYTES", 1024),
+		CompressionLevel:        getEnvAsInt("COMPRESSION_LEVEL", 5),
+		CompressionContentTypes: getEnvAsListOr("COMPRESSION_CONTENT_TYPES", defaultCompressionContentTypes),
+
+		MetricsToken: getEnv("METRICS_TOKEN", ""),
+
+		RedisURL: getEnv("REDIS_URL", ""),
+
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3Region:          getEnv("S3_REGION", "ap-south-1"),
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PublicURL:       getEnv("S3_PUBLIC_URL", ""),
+
+		OTLPEndpoint:     getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		ServiceName:      getEnv("OTEL_SERVICE_NAME", "aquahome-api"),
+		TraceSampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
+
+		SentryDSN:        getEnv("SENTRY_DSN", ""),
+		SentryRelease:    getEnv("SENTRY_RELEASE", ""),
+		SentrySampleRate: getEnvAsFloat("SENTRY_SAMPLE_RATE", 1),
+	}
+	// The mock provider needs no real keys, only something to sign with
+	if AppConfig.PaymentProvider == PaymentProviderMock {
+		if AppConfig.RazorpayKey == "" {
+			AppConfig.RazorpayKey = mockRazorpayKey
+		}
+		if AppConfig.RazorpaySecret == "" {
+			AppConfig.RazorpaySecret = mockRazorpaySecret
+		}
 	}
+	return AppConfig.validate()
 }
 
 // Helper function to get environment variable with fallback
@@ -60,15 +382,116 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// parseErrors collects environment variables that are set but malformed,
+// reported by InitConfig instead of silently using the fallback
+var parseErrors []error
+
 // Helper function to get integer environment variable with fallback
 func getEnvAsInt(key string, fallback int) int {
 	strValue := getEnv(key, "")
-	if value, err := strconv.Atoi(strValue); err == nil {
-		return value
+	if strValue == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(strValue)
+	if err != nil {
+		parseErrors = append(parseErrors, fmt.Errorf("%s: %q is not a whole number", key, strValue))
+		return fallback
+	}
+	return value
+}
+
+// Helper function to get boolean environment variable with fallback
+func getEnvAsBool(key string, fallback bool) bool {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(strValue)
+	if err != nil {
+		parseErrors = append(parseErrors, fmt.Errorf("%s: %q is not true or false", key, strValue))
+		return fallback
+	}
+	return value
+}
+
+// Helper function to get float environment variable with fallback
+func getEnvAsFloat(key string, fallback float64) float64 {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(strValue, 64)
+	if err != nil {
+		parseErrors = append(parseErrors, fmt.Errorf("%s: %q is not a number", key, strValue))
+		return fallback
+	}
+	return value
+}
+
+// Helper function to get a comma-separated environment variable as a list
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Helper function to get a comma-separated environment variable as a list with fallback
+func getEnvAsListOr(key string, fallback []string) []string {
+	if values := getEnvAsList(key); len(values) > 0 {
+		return values
 	}
 	return fallback
 }
 
+// Helper function to get a comma-separated list of integers with fallback
+func getEnvAsIntList(key string, fallback []int) []int {
+	var values []int
+	for _, value := range getEnvAsList(key) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			parseErrors = append(parseErrors, fmt.Errorf("%s: %q is not a whole number", key, value))
+			return fallback
+		}
+		values = append(values, n)
+	}
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
+
+// Helper function to get a comma-separated list of key=integer pairs with fallback
+func getEnvAsIntMap(key string, fallback map[string]int) map[string]int {
+	values := map[string]int{}
+	for _, pair := range getEnvAsList(key) {
+		name, raw, found := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if !found || err != nil {
+			parseErrors = append(parseErrors, fmt.Errorf("%s: %q is not a name=hours pair", key, pair))
+			return fallback
+		}
+		values[strings.TrimSpace(name)] = n
+	}
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
+
+// DSN returns the PostgreSQL connection string: DATABASE_URL, or one built
+// from the DB_* settings
+func (c Config) DSN() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=UTC",
+		c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName, c.DBSSLMode)
+}
+
 // GetJWTExpiration returns JWT expiration time
 func GetJWTExpiration() time.Duration {
 	return time.Duration(AppConfig.JWTExpiryHours) * time.Hour
@@ -76,5 +499,5 @@ func GetJWTExpiration() time.Duration {
 
 // IsDevelopment returns true if the application is running in development mode
 func IsDevelopment() bool {
-	return AppConfig.Environment == "development"
+	return AppConfig.Environment == ProfileDevelopment
 }
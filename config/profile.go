@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Config profiles, picked with ENVIRONMENT
+const (
+	ProfileDevelopment = "development"
+	ProfileStaging     = "staging"
+	ProfileProduction  = "production"
+)
+
+// profileAliases are the short names accepted for each profile
+var profileAliases = map[string]string{
+	"dev":     ProfileDevelopment,
+	"stage":   ProfileStaging,
+	"prod":    ProfileProduction,
+	"":        ProfileDevelopment,
+	"develop": ProfileDevelopment,
+}
+
+// Profile returns the config profile named by ENVIRONMENT, with short names
+// such as "prod" expanded. Unknown names are returned as given and rejected
+// by InitConfig.
+func Profile() string {
+	profile := strings.ToLower(strings.TrimSpace(os.Getenv("ENVIRONMENT")))
+	if full, ok := profileAliases[profile]; ok {
+		return full
+	}
+	return profile
+}
+
+// LoadEnvFiles loads .env.<profile> and then .env into the environment.
+// Variables already set win over both, and the profile's file wins over .env.
+func LoadEnvFiles() {
+	for _, file := range []string{".env." + Profile(), ".env"} {
+		if _, err := os.Stat(file); err == nil {
+			_ = godotenv.Load(file)
+		}
+	}
+}
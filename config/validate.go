@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultJWTSecret is the development signing key; other profiles must set their own
+const defaultJWTSecret = "aquahome_default_secret_key"
+
+// minJWTSecretLength is the shortest JWT secret accepted outside development
+const minJWTSecretLength = 32
+
+// validate checks that every setting the server needs is present and sane
+// for the profile, returning one error that lists all problems
+func (c Config) validate() error {
+	problems := append([]error(nil), parseErrors...)
+	fail := func(key, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+	}
+	deployed := c.Environment != ProfileDevelopment
+
+	switch c.Environment {
+	case ProfileDevelopment, ProfileStaging, ProfileProduction:
+	default:
+		fail("ENVIRONMENT", "%q is not a profile; use development, staging or production", c.Environment)
+	}
+
+	// Database
+	if c.DBDriver != "postgres" {
+		fail("DB_DRIVER", "%q is not supported; use postgres", c.DBDriver)
+	}
+	if c.DatabaseURL == "" {
+		for _, setting := range []struct{ key, value string }{
+			{"DB_HOST", c.DBHost}, {"DB_NAME", c.DBName}, {"DB_USER", c.DBUser},
+		} {
+			if setting.value == "" {
+				fail(setting.key, "is required unless DATABASE_URL is set")
+			}
+		}
+	}
+
+	// Auth
+	switch {
+	case c.JWTSecret == "":
+		fail("JWT_SECRET", "is required")
+	case deployed && c.JWTSecret == defaultJWTSecret:
+		fail("JWT_SECRET", "must not be the development default in %s", c.Environment)
+	case deployed && len(c.JWTSecret) < minJWTSecretLength:
+		fail("JWT_SECRET", "must be at least %d characters in %s", minJWTSecretLength, c.Environment)
+	}
+	for _, setting := range []struct {
+		key   string
+		value int
+	}{
+		{"DB_SLOW_QUERY_MS", c.DBSlowQueryMS},
+		{"JWT_EXPIRY_HOURS", c.JWTExpiryHours},
+		{"ACCESS_TOKEN_MINUTES", c.AccessTokenMinutes},
+		{"IMPERSONATION_MINUTES", c.ImpersonationMinutes},
+		{"REFRESH_TOKEN_DAYS", c.RefreshTokenDays},
+		{"API_KEY_RATE_LIMIT", c.APIKeyRateLimit},
+		{"PAYOUT_MAX_ATTEMPTS", c.PayoutMaxAttempts},
+		{"RAZORPAY_TIMEOUT_SECONDS", c.RazorpayTimeoutSeconds},
+		{"RAZORPAY_BREAKER_FAILURES", c.RazorpayBreakerFailures},
+		{"RAZORPAY_BREAKER_OPEN_SECONDS", c.RazorpayBreakerOpenSeconds},
+		{"SHUTDOWN_TIMEOUT_SECONDS", c.ShutdownTimeoutSeconds},
+		{"ALERT_INTERVAL_MINUTES", c.AlertIntervalMinutes},
+		{"ALERT_PAYMENT_FAILURE_THRESHOLD", c.AlertPaymentFailureThreshold},
+		{"ALERT_PAYMENT_FAILURE_WINDOW_MINUTES", c.AlertPaymentFailureWindowMinutes},
+		{"ALERT_SLA_BREACH_THRESHOLD", c.AlertSLABreachThreshold},
+		{"ALERT_WEBHOOK_FAILURE_THRESHOLD", c.AlertWebhookFailureThreshold},
+	} {
+		if setting.value <= 0 {
+			fail(setting.key, "must be greater than zero")
+		}
+	}
+
+	// Timeouts, retries and retention
+	for _, setting := range []struct {
+		key   string
+		value int
+	}{
+		{"REQUEST_TIMEOUT_SECONDS", c.RequestTimeoutSeconds},
+		{"RAZORPAY_MAX_RETRIES", c.RazorpayMaxRetries},
+		{"LONG_REQUEST_TIMEOUT_SECONDS", c.LongRequestTimeoutSeconds},
+		{"NOTIFICATION_RETENTION_MONTHS", c.NotificationRetentionMonths},
+		{"SERVICE_REQUEST_RETENTION_MONTHS", c.ServiceRequestRetentionMonths},
+		{"ALERT_COOLDOWN_MINUTES", c.AlertCooldownMinutes},
+	} {
+		if setting.value < 0 {
+			fail(setting.key, "must not be negative")
+		}
+	}
+
+	// Compression
+	if c.CompressionMinBytes < 0 {
+		fail("COMPRESSION_MIN_BYTES", "must not be negative")
+	}
+	if c.CompressionLevel < 1 || c.CompressionLevel > 9 {
+		fail("COMPRESSION_LEVEL", "must be between 1 and 9")
+	}
+
+	// Payments
+	switch c.PaymentProvider {
+	case PaymentProviderRazorpay:
+	case PaymentProviderMock:
+		if c.Environment == ProfileProduction {
+			fail("PAYMENT_PROVIDER", "must not be mock in production")
+		}
+	default:
+		fail("PAYMENT_PROVIDER", "%q is not a provider; use razorpay or mock", c.PaymentProvider)
+	}
+	if c.RazorpayKey == "" {
+		fail("RAZORPAY_KEY", "is required")
+	}
+	if c.RazorpaySecret == "" {
+		fail("RAZORPAY_SECRET", "is required")
+	}
+	if c.Environment == ProfileProduction {
+		if c.RazorpayKey != "" && !strings.HasPrefix(c.RazorpayKey, "rzp_live_") {
+			fail("RAZORPAY_KEY", "must be a live key (rzp_live_...) in production")
+		}
+		if c.RazorpayWebhookSecret == "" {
+			fail("RAZORPAY_WEBHOOK_SECRET", "is required in production")
+		}
+	}
+
+	// Server and storage
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT", "%q is not a port number", c.Port)
+	}
+	if base, err := url.Parse(c.AppBaseURL); err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		fail("APP_BASE_URL", "%q is not an http(s) URL", c.AppBaseURL)
+	}
+	for _, setting := range []struct{ key, value string }{
+		{"UPLOAD_DIR", c.UploadDir}, {"DATA_EXPORT_DIR", c.DataExportDir},
+	} {
+		if err := writableDir(setting.value); err != nil {
+			fail(setting.key, "%v", err)
+		}
+	}
+	if c.S3Bucket != "" {
+		for _, setting := range []struct{ key, value string }{
+			{"S3_REGION", c.S3Region}, {"S3_ACCESS_KEY_ID", c.S3AccessKeyID}, {"S3_SECRET_ACCESS_KEY", c.S3SecretAccessKey},
+		} {
+			if setting.value == "" {
+				fail(setting.key, "is required when S3_BUCKET is set")
+			}
+		}
+	}
+	for _, setting := range []struct{ key, value string }{
+		{"S3_ENDPOINT", c.S3Endpoint}, {"S3_PUBLIC_URL", c.S3PublicURL},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		if u, err := url.Parse(setting.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(setting.key, "%q is not an http(s) URL", setting.value)
+		}
+	}
+
+	// Billing
+	for _, setting := range []struct {
+		key   string
+		value float64
+	}{
+		{"GST_RATE", c.GSTRate}, {"FRANCHISE_REVENUE_SHARE", c.FranchiseRevenueShare},
+	} {
+		if setting.value < 0 || setting.value > 100 {
+			fail(setting.key, "must be a percentage between 0 and 100")
+		}
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		fail("OTEL_TRACES_SAMPLE_RATIO", "must be between 0 and 1")
+	}
+	if c.SentrySampleRate <= 0 || c.SentrySampleRate > 1 {
+		fail("SENTRY_SAMPLE_RATE", "must be above 0 and at most 1; leave SENTRY_DSN unset to turn reporting off")
+	}
+
+	// Messaging
+	if (c.AlertTelegramBotToken == "") != (c.AlertTelegramChatID == "") {
+		fail("ALERT_TELEGRAM_CHAT_ID", "ALERT_TELEGRAM_BOT_TOKEN and ALERT_TELEGRAM_CHAT_ID must be set together")
+	}
+	if c.AlertSlackWebhookURL != "" {
+		if u, err := url.Parse(c.AlertSlackWebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			fail("ALERT_SLACK_WEBHOOK_URL", "is not an https URL")
+		}
+	}
+	if c.SMTPHost != "" && (c.SMTPPort < 1 || c.SMTPPort > 65535) {
+		fail("SMTP_PORT", "%d is not a port number", c.SMTPPort)
+	}
+
+	return errors.Join(problems...)
+}
+
+// writableDir creates dir if needed and checks files can be written to it
+func writableDir(dir string) error {
+	if dir == "" {
+		return errors.New("is required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// DeleteAccountRequest confirms an account deletion
+type DeleteAccountRequest struct {
+	Password string `json:"password"` // required for accounts that have a password
+	Reason   string `json:"reason"`
+}
+
+// errAccountInUse is returned when an account still has obligations
+type errAccountInUse struct {
+	reason string
+}
+
+func (e errAccountInUse) Error() string {
+	return e.reason
+}
+
+// DeleteMyAccount deletes the caller's account. Personal data is anonymized;
+// orders, subscriptions and payments are kept for accounting.
+// DELETE /api/users/me
+func DeleteMyAccount(c *gin.Context) {
+	var request DeleteAccountRequest
+	// The body is optional for accounts without a password
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			apperror.Respond(c, apperror.Binding(err))
+			return
+		}
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.PasswordHash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return
+		}
+	}
+
+	var exportFiles []string
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := checkAccountDeletable(tx, user); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&database.DataExport{}).Where("user_id = ? AND file_path <> ''", user.ID).
+			Pluck("file_path", &exportFiles).Error; err != nil {
+			return err
+		}
+
+		return anonymizeUser(tx, user, request.Reason, c.ClientIP())
+	})
+	if err != nil {
+		var inUse errAccountInUse
+		if errors.As(err, &inUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": inUse.reason})
+			return
+		}
+		log.Printf("Error deleting account %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	for _, path := range exportFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete data export file %s: %v", path, err)
+		}
+	}
+	if isAvatarUpload(user.ProfilePicture) {
+		removeUploadedFiles(user.ProfilePicture)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your account has been deleted"})
+}
+
+// checkAccountDeletable refuses deletion while the account has open obligations
+func checkAccountDeletable(tx *gorm.DB, user database.User) error {
+	switch user.Role {
+	case database.RoleAdmin:
+		return errAccountInUse{"Admin accounts can't be deleted this way"}
+	case database.RoleFranchiseOwner:
+		var franchises int64
+		if err := tx.Model(&database.Franchise{}).Where("owner_id = ?", user.ID).Count(&franchises).Error; err != nil {
+			return err
+		}
+		if franchises > 0 {
+			return errAccountInUse{"Your account still owns a franchise; contact support to close it first"}
+		}
+	}
+
+	var subscriptions int64
+	if err := tx.Model(&database.Subscription{}).
+		Where("customer_id = ? AND status IN ?", user.ID,
+			[]string{database.SubscriptionStatusActive, database.SubscriptionStatusPaused}).
+		Count(&subscriptions).Error; err != nil {
+		return err
+	}
+	if subscriptions > 0 {
+		return errAccountInUse{"You have active subscriptions; cancel them before deleting your account"}
+	}
+
+	var openRequests int64
+	if err := tx.Model(&database.ServiceRequest{}).
+		Where("(customer_id = ? OR service_agent_id = ?) AND status NOT IN ?", user.ID, user.ID,
+			[]string{database.ServiceStatusCompleted, database.ServiceStatusCancelled}).
+		Count(&openRequests).Error; err != nil {
+		return err
+	}
+	if openRequests > 0 {
+		return errAccountInUse{"You have open service requests; wait for them to complete or cancel them first"}
+	}
+
+	var pendingDeposits int64
+	if err := tx.Model(&database.DepositSettlement{}).
+		Where("customer_id = ? AND status IN ?", user.ID,
+			[]string{database.DepositStatusAwaitingPickup, database.DepositStatusPickedUp}).
+		Count(&pendingDeposits).Error; err != nil {
+		return err
+	}
+	if pendingDeposits > 0 {
+		return errAccountInUse{"Your security deposit refund is still being processed; wait for it to be settled first"}
+	}
+
+	return nil
+}
+
+// anonymizeUser strips PII from the user, removes data that only serves the
+// user, and soft deletes the account
+func anonymizeUser(tx *gorm.DB, user database.User, reason, ip string) error {
+	if err := tx.Model(&database.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"name":              "Deleted user",
+		"email":             fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+		"password":          "",
+		"password_hash":     "",
+		"phone":             "",
+		"address":           "",
+		"city":              "",
+		"state":             "",
+		"zip_code":          "",
+		"latitude":          0,
+		"longitude":         0,
+		"phone_verified_at": nil,
+		"email_verified_at": nil,
+		"profile_picture":   "",
+		"google_id":         "",
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&database.Notification{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("source = ? AND user_id = ?", database.ArchiveSourceNotifications, user.ID).
+		Delete(&database.ArchivedRecord{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&database.DataExport{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&database.PasswordResetToken{}).Error; err != nil {
+		return err
+	}
+	if user.Phone != "" {
+		if err := tx.Where("phone = ?", user.Phone).Delete(&database.PhoneOTP{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := revokeUserSessions(tx, user.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Create(&database.AccountDeletion{UserID: user.ID, Role: user.Role, Reason: reason, IP: ip}).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&database.User{}, user.ID).Error
+}
+
+// GetAccountDeletions lists deleted accounts for admins
+// GET /api/admin/account-deletions?page=&limit=
+func GetAccountDeletions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.AccountDeletion{})
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	query = dates.apply(query, "created_at")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account deletions"})
+		return
+	}
+
+	var deletions []database.AccountDeletion
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&deletions).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account deletions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deletions": deletions, "total": total, "page": page, "limit": limit})
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// AddressRequest contains the data for adding or editing an address book entry
+type AddressRequest struct {
+	Label             string `json:"label" binding:"max=50"`
+	ContactName       string `json:"contact_name" binding:"max=100"`
+	Phone             string `json:"phone" binding:"max=20"`
+	Line1             string `json:"line1" binding:"required,max=255"`
+	Line2             string `json:"line2" binding:"max=255"`
+	City              string `json:"city" binding:"required,max=100"`
+	State             string `json:"state" binding:"required,max=100"`
+	ZipCode           string `json:"zip_code" binding:"required"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+}
+
+// addressError is an address an order cannot use; its message is shown to the customer
+type addressError struct {
+	msg string
+}
+
+func (e *addressError) Error() string {
+	return e.msg
+}
+
+// orderAddresses are the shipping and billing addresses an order is placed
+// with, resolved from the address book or given as free text
+type orderAddresses struct {
+	Shipping   string
+	Billing    string
+	ShippingID *uint
+	BillingID  *uint
+	shipping   *database.Address
+}
+
+// resolveOrderAddresses picks an order's addresses: the address book entries
+// named by ID, else the free-text addresses older clients send, else the
+// customer's default shipping and billing addresses.
+func resolveOrderAddresses(db *gorm.DB, customerID uint, shippingID, billingID *uint, shippingText, billingText string) (orderAddresses, error) {
+	var result orderAddresses
+
+	load := func(id *uint, text, defaultColumn string) (*database.Address, string, error) {
+		var address database.Address
+		query := db.Where("user_id = ?", customerID)
+		switch {
+		case id != nil:
+			query = query.Where("id = ?", *id)
+		case text != "":
+			return nil, text, nil
+		default:
+			query = query.Where(defaultColumn+" = ?", true)
+		}
+		if err := query.First(&address).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, "", err
+			}
+			if id != nil {
+				return nil, "", &addressError{"Address not found in your address book"}
+			}
+			return nil, "", &addressError{"Choose an address from your address book"}
+		}
+		return &address, address.Formatted(), nil
+	}
+
+	shipping, text, err := load(shippingID, shippingText, "is_default_shipping")
+	if err != nil {
+		return result, err
+	}
+	result.Shipping, result.shipping = text, shipping
+	if shipping != nil {
+		result.ShippingID = &shipping.ID
+	}
+
+	billing, text, err := load(billingID, billingText, "is_default_billing")
+	var addrErr *addressError
+	if errors.As(err, &addrErr) && billingID == nil {
+		// Bill to the shipping address when there is no default billing address
+		billing, text, err = shipping, result.Shipping, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Billing = text
+	if billing != nil {
+		result.BillingID = &billing.ID
+	}
+	return result, nil
+}
+
+// franchise finds the franchise serving the shipping address
+func (a orderAddresses) franchise(db *gorm.DB, customerID uint) (database.Franchise, error) {
+	if a.shipping != nil {
+		return matchFranchise(db, a.shipping.Latitude, a.shipping.Longitude, a.shipping.ZipCode)
+	}
+	return assignFranchise(db, customerID, a.Shipping)
+}
+
+// geocodeAddress fills in an address's coordinates when geocoding is
+// configured. Failures are logged and leave the coordinates unchanged.
+func geocodeAddress(address *database.Address) {
+	lat, lng, err := utils.Geocode(address.Formatted())
+	if err != nil {
+		if !errors.Is(err, utils.ErrGeocodingDisabled) {
+			log.Printf("Geocoding failed for address %d: %v", address.ID, err)
+		}
+		return
+	}
+	address.Latitude, address.Longitude = lat, lng
+}
+
+// saveAddress stores an address, making it the only default of its kind when
+// flagged. A customer's first address becomes both defaults.
+func saveAddress(db *gorm.DB, address *database.Address) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var others int64
+		if err := tx.Model(&database.Address{}).
+			Where("user_id = ? AND id <> ?", address.UserID, address.ID).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		if others == 0 {
+			address.IsDefaultShipping, address.IsDefaultBilling = true, true
+		}
+
+		for column, isDefault := range map[string]bool{
+			"is_default_shipping": address.IsDefaultShipping,
+			"is_default_billing":  address.IsDefaultBilling,
+		} {
+			if !isDefault {
+				continue
+			}
+			if err := tx.Model(&database.Address{}).
+				Where("user_id = ? AND id <> ? AND "+column+" = ?", address.UserID, address.ID, true).
+				Update(column, false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(address).Error
+	})
+}
+
+// myAddress loads the current user's address named by :id
+func myAddress(c *gin.Context) (database.Address, bool) {
+	var address database.Address
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&address).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return address, false
+	}
+	return address, true
+}
+
+// bindAddress reads an AddressRequest into address
+func bindAddress(c *gin.Context, address *database.Address) bool {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return false
+	}
+	if pincodePattern.FindString(req.ZipCode) != req.ZipCode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pincode"})
+		return false
+	}
+
+	moved := address.Formatted() != (database.Address{
+		Line1: req.Line1, Line2: req.Line2, City: req.City, State: req.State, ZipCode: req.ZipCode,
+	}).Formatted()
+
+	address.Label = req.Label
+	address.ContactName = req.ContactName
+	address.Phone = req.Phone
+	address.Line1 = req.Line1
+	address.Line2 = req.Line2
+	address.City = req.City
+	address.State = req.State
+	address.ZipCode = req.ZipCode
+	address.IsDefaultShipping = req.IsDefaultShipping
+	address.IsDefaultBilling = req.IsDefaultBilling
+	if moved {
+		address.Latitude, address.Longitude = 0, 0
+		geocodeAddress(address)
+	}
+	return true
+}
+
+// GetMyAddresses lists the current user's address book, defaults first
+func GetMyAddresses(c *gin.Context) {
+	var addresses []database.Address
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", c.GetUint("user_id")).
+		Order("is_default_shipping DESC, is_default_billing DESC, id").
+		Find(&addresses).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+		return
+	}
+	c.JSON(http.StatusOK, addresses)
+}
+
+// CreateAddress adds an address to the current user's address book
+func CreateAddress(c *gin.Context) {
+	address := database.Address{UserID: c.GetUint("user_id")}
+	if !bindAddress(c, &address) {
+		return
+	}
+
+	if err := saveAddress(database.DB.WithContext(c.Request.Context()), &address); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+	c.JSON(http.StatusCreated, address)
+}
+
+// UpdateAddress edits an address in the current user's address book. Orders
+// already placed keep the address as it was.
+func UpdateAddress(c *gin.Context) {
+	address, ok := myAddress(c)
+	if !ok {
+		return
+	}
+	if !bindAddress(c, &address) {
+		return
+	}
+
+	if err := saveAddress(database.DB.WithContext(c.Request.Context()), &address); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+	c.JSON(http.StatusOK, address)
+}
+
+// DeleteAddress removes an address from the current user's address book
+func DeleteAddress(c *gin.Context) {
+	address, ok := myAddress(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&address).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
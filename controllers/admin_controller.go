@@ -2,44 +2,112 @@ package controllers
 
 import (
 	"net/http"
-	"strings"
+	"time"
 
+	"aquahome/cache"
 	"aquahome/database"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// AdminDashboard returns key statistics for the admin dashboard
+// AdminDashboard returns key statistics for the admin dashboard.
+// Customers, orders and revenue can be limited with ?from=&to= (YYYY-MM-DD);
+// the remaining counts describe the current state.
 func AdminDashboard(c *gin.Context) {
-	var totalCustomers int64
-	var totalOrders int64
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	cacheKey := cache.PrefixDashboard + "admin:" + dates.key()
+	if respondCached(c, cacheKey) {
+		return
+	}
+	etag := versionedETag(c, database.ReadDB().WithContext(c.Request.Context()), []versionSource{
+		{"users", database.DB.WithContext(c.Request.Context()).Model(&database.User{})},
+		{"orders", database.DB.WithContext(c.Request.Context()).Model(&database.Order{})},
+		{"payments", database.DB.WithContext(c.Request.Context()).Model(&database.Payment{})},
+		{"subscriptions", database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{})},
+		{"service_requests", database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{})},
+		{"franchises", database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{})},
+	}, "admin", dates.key(), dashboardWindow())
+
+	var totalCustomers, totalOrders, activeSubscriptions, pendingServiceRequests, franchiseApplications int64
 
 	// Count customers with role 'customer'
-	if err := database.DB.Model(&database.User{}).Where("role = ?", "customer").Count(&totalCustomers).Error; err != nil {
+	if err := dates.apply(database.ReadDB().WithContext(c.Request.Context()).Model(&database.User{}), "created_at").
+		Where("role = ?", database.RoleCustomer).Count(&totalCustomers).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count customers"})
 		return
 	}
 
 	// Count total orders
-	if err := database.DB.Model(&database.Order{}).Count(&totalOrders).Error; err != nil {
+	if err := dates.apply(database.ReadDB().WithContext(c.Request.Context()).Model(&database.Order{}), "created_at").Count(&totalOrders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count orders"})
 		return
 	}
 
-	// Return simplified dashboard data
-	c.JSON(http.StatusOK, gin.H{
+	// Revenue is the sum of successful payments; refunded ones are excluded
+	var revenue struct {
+		Total    float64
+		Payments int64
+	}
+	if err := dates.apply(database.ReadDB().WithContext(c.Request.Context()).Model(&database.Payment{}), "created_at").
+		Select("COALESCE(SUM(amount), 0) AS total, COUNT(*) AS payments").
+		Where("status IN ?", []string{database.PaymentStatusSuccess, database.PaymentStatusPaid}).
+		Scan(&revenue).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute revenue"})
+		return
+	}
+
+	if err := database.ReadDB().WithContext(c.Request.Context()).Model(&database.Subscription{}).
+		Where("status = ?", database.SubscriptionStatusActive).Count(&activeSubscriptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count subscriptions"})
+		return
+	}
+
+	if err := database.ReadDB().WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
+		Where("status = ?", database.ServiceStatusPending).Count(&pendingServiceRequests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count service requests"})
+		return
+	}
+
+	if err := database.ReadDB().WithContext(c.Request.Context()).Model(&database.Franchise{}).
+		Where("approval_state = ?", "pending").Count(&franchiseApplications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count franchise applications"})
+		return
+	}
+
+	// SLA compliance covers requests completed within the date range
+	serviceRequests := database.ReadDB().WithContext(c.Request.Context()).Model(&database.ServiceRequest{})
+	sla, err := slaOverview(serviceRequests, dates.apply(serviceRequests.Session(&gorm.Session{}), "service_requests.completion_time"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute SLA compliance"})
+		return
+	}
+
+	response := gin.H{
 		"stats": gin.H{
-			"totalCustomers":         totalCustomers,
-			"totalOrders":            totalOrders,
-			"totalRevenue":           0, // Optional: implement if needed
-			"activeSubscriptions":    0,
-			"pendingServiceRequests": 0,
-			"franchiseApplications":  0,
+			"totalCustomers":           totalCustomers,
+			"totalOrders":              totalOrders,
+			"totalRevenue":             revenue.Total,
+			"successfulPayments":       revenue.Payments,
+			"activeSubscriptions":      activeSubscriptions,
+			"pendingServiceRequests":   pendingServiceRequests,
+			"franchiseApplications":    franchiseApplications,
+			"overdueServiceRequests":   sla["overdue"],
+			"escalatedServiceRequests": sla["escalated"],
+			"slaCompliance":            sla["compliance"],
 		},
-	})
+		"from": c.Query("from"),
+		"to":   c.Query("to"),
+	}
+	cacheAndRespond(c, cacheKey, etag, response, dashboardCacheTTL)
 }
 
-// AdminGetOrders returns all orders with related data
+// AdminGetOrders returns all orders with related data. Passing ?cursor
+// (empty for the first page) switches to keyset pagination.
 func AdminGetOrders(c *gin.Context) {
 	role, exists := c.Get("role")
 	if !exists {
@@ -47,50 +115,34 @@ func AdminGetOrders(c *gin.Context) {
 		return
 	}
 
-	userID, exists := c.Get("user_id")
-	if !exists {
+	if _, exists := c.Get("user_id"); !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	user := userID.(uint)
-
-	// For franchise owners, get orders based on their service areas
-	if role == "franchise_owner" {
-		var franchise database.Franchise
-		if err := database.DB.Where("owner_id = ?", user).First(&franchise).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch franchise"})
-			return
-		}
+	var query *gorm.DB
 
-		// Get all ZIP codes served by this franchise
-		var zipCodesArray []string
-		if err := database.DB.Table("franchise_locations").
-			Joins("JOIN locations ON franchise_locations.location_id = locations.id").
-			Where("franchise_locations.franchise_id = ?", franchise.ID).
-			Pluck("locations.zip_codes", &zipCodesArray).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ZIP codes"})
+	// For franchise owners and staff, get orders based on their service areas
+	if role == database.RoleFranchiseOwner || role == database.RoleFranchiseStaff {
+		franchiseIDs, ok := ownerFranchiseIDs(c)
+		if !ok {
 			return
 		}
 
+		// Get all ZIP codes served by these franchises
 		var zipCodes []string
-		for _, zipArray := range zipCodesArray {
-			zipArray = strings.Trim(zipArray, "{}")
-			if zipArray == "" {
-				continue
-			}
-			individualZips := strings.Split(zipArray, ",")
-			for _, zip := range individualZips {
-				zip = strings.TrimSpace(zip)
-				if zip != "" {
-					zipCodes = append(zipCodes, zip)
-				}
+		for _, franchiseID := range franchiseIDs {
+			codes, err := franchiseZipCodes(database.ReadDB().WithContext(c.Request.Context()), franchiseID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ZIP codes"})
+				return
 			}
+			zipCodes = append(zipCodes, codes...)
 		}
 
 		// Get users in these zip codes
 		var users []database.User
-		if err := database.DB.Where("zip_code IN ?", zipCodes).
+		if err := database.ReadDB().WithContext(c.Request.Context()).Where("zip_code IN ?", zipCodes).
 			Where("role = ?", "customer").
 			Find(&users).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
@@ -104,31 +156,41 @@ func AdminGetOrders(c *gin.Context) {
 		}
 
 		// Get orders for these users with successful payments
-		var orders []database.Order
-		if err := database.DB.Preload("Customer").
+		query = database.ReadDB().WithContext(c.Request.Context()).Preload("Customer").
 			Preload("Product").
 			Preload("Franchise").
 			Joins("JOIN payments ON orders.id = payments.order_id").
 			Where("customer_id IN ? AND payments.status = ?", userIDs, "success").
-			Group("orders.id").
-			Find(&orders).Error; err != nil {
+			Group("orders.id")
+	} else {
+		// For admin, get all orders with successful payments
+		query = includeDeleted(c, database.ReadDB().WithContext(c.Request.Context())).Preload("Customer").
+			Preload("Franchise").
+			Preload("Product").
+			Joins("JOIN payments ON orders.id = payments.order_id").
+			Where("payments.status = ?", "success").
+			Group("orders.id")
+	}
+
+	var orders []database.Order
+
+	if cursorRequested(c) {
+		page, limit, ok := keysetPage(c, query, "orders")
+		if !ok {
+			return
+		}
+		if err := page.Find(&orders).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 			return
 		}
-
-		c.JSON(http.StatusOK, orders)
+		orders, next := nextCursor(orders, limit, func(o database.Order) (time.Time, uint) {
+			return o.CreatedAt, o.ID
+		})
+		c.JSON(http.StatusOK, gin.H{"orders": orders, "next_cursor": next})
 		return
 	}
 
-	// For admin, get all orders with successful payments
-	var orders []database.Order
-	if err := database.DB.Preload("Customer").
-		Preload("Franchise").
-		Preload("Product").
-		Joins("JOIN payments ON orders.id = payments.order_id").
-		Where("payments.status = ?", "success").
-		Group("orders.id").
-		Find(&orders).Error; err != nil {
+	if err := query.Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
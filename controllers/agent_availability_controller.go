@@ -0,0 +1,480 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// maxLeaveDays caps a single stretch of declared time off
+const maxLeaveDays = 90
+
+// AgentShiftsRequest replaces an agent's weekly working hours. An empty list
+// puts the agent back on their franchise's hours.
+type AgentShiftsRequest struct {
+	Shifts []struct {
+		Weekday   int    `json:"weekday" binding:"min=0,max=6"`
+		StartTime string `json:"start_time"`
+		EndTime   string `json:"end_time"`
+		IsOff     bool   `json:"is_off"`
+	} `json:"shifts" binding:"dive"`
+}
+
+// AgentLeaveRequest declares whole days an agent can't take jobs
+type AgentLeaveRequest struct {
+	Kind      string `json:"kind" binding:"required,oneof=day_off leave"`
+	StartDate string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`                      // YYYY-MM-DD, defaults to start_date
+	Reason    string `json:"reason" binding:"max=500"`
+}
+
+// AgentAvailability is whether an agent can take a visit at a given time
+type AgentAvailability struct {
+	AgentID      uint   `json:"agent_id"`
+	AgentName    string `json:"agent_name"`
+	AgentPicture string `json:"agent_profile_picture"`
+	Available    bool   `json:"available"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// agentSchedule is an agent's weekly shifts and time off, loaded for
+// availability checks
+type agentSchedule struct {
+	shifts map[int]database.AgentShift // nil when the agent works the franchise's hours
+	leaves []database.AgentLeave
+}
+
+// loadAgentSchedules loads the shifts of the agents and their time off
+// overlapping the days from through to
+func loadAgentSchedules(db *gorm.DB, agentIDs []uint, from, to time.Time) (map[uint]*agentSchedule, error) {
+	schedules := make(map[uint]*agentSchedule, len(agentIDs))
+	for _, id := range agentIDs {
+		schedules[id] = &agentSchedule{}
+	}
+	if len(agentIDs) == 0 {
+		return schedules, nil
+	}
+
+	var shifts []database.AgentShift
+	if err := db.Where("agent_id IN ?", agentIDs).Find(&shifts).Error; err != nil {
+		return nil, err
+	}
+	for _, shift := range shifts {
+		schedule := schedules[shift.AgentID]
+		if schedule.shifts == nil {
+			schedule.shifts = map[int]database.AgentShift{}
+		}
+		schedule.shifts[shift.Weekday] = shift
+	}
+
+	var leaves []database.AgentLeave
+	if err := db.Where("agent_id IN ? AND start_date <= ? AND end_date >= ?",
+		agentIDs, to.Format("2006-01-02"), from.Format("2006-01-02")).
+		Find(&leaves).Error; err != nil {
+		return nil, err
+	}
+	for _, leave := range leaves {
+		schedules[leave.AgentID].leaves = append(schedules[leave.AgentID].leaves, leave)
+	}
+	return schedules, nil
+}
+
+// unavailableReason explains why the agent can't take a visit from start to
+// end, or returns "" when they can. A zero end only checks the day.
+func (s *agentSchedule) unavailableReason(start, end time.Time) string {
+	day := start.In(time.Local)
+	date := day.Format("2006-01-02")
+	for _, leave := range s.leaves {
+		if leave.StartDate.Format("2006-01-02") <= date && date <= leave.EndDate.Format("2006-01-02") {
+			if leave.Kind == database.AgentLeaveDayOff {
+				return "has the day off on " + date
+			}
+			return "is on leave on " + date
+		}
+	}
+
+	if s.shifts == nil {
+		return ""
+	}
+	shift, ok := s.shifts[int(day.Weekday())]
+	if !ok || shift.IsOff {
+		return fmt.Sprintf("doesn't work on %ss", day.Weekday())
+	}
+	if end.IsZero() {
+		return ""
+	}
+	shiftStart, errStart := clockOn(day, shift.StartTime)
+	shiftEnd, errEnd := clockOn(day, shift.EndTime)
+	if errStart != nil || errEnd != nil || start.Before(shiftStart) || end.After(shiftEnd) {
+		return fmt.Sprintf("works %s-%s on %ss", shift.StartTime, shift.EndTime, day.Weekday())
+	}
+	return ""
+}
+
+// franchiseAgentSchedules loads the schedules of a franchise's agents for a
+// day. It returns nil when the franchise has no agents yet, so slots keep
+// their configured capacity.
+func franchiseAgentSchedules(db *gorm.DB, franchiseID uint, day time.Time) ([]*agentSchedule, error) {
+	var agentIDs []uint
+	if err := db.Model(&database.User{}).
+		Where("franchise_id = ? AND role = ?", franchiseID, database.RoleServiceAgent).
+		Pluck("id", &agentIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(agentIDs) == 0 {
+		return nil, nil
+	}
+	byAgent, err := loadAgentSchedules(db, agentIDs, day, day)
+	if err != nil {
+		return nil, err
+	}
+	schedules := make([]*agentSchedule, 0, len(byAgent))
+	for _, schedule := range byAgent {
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// serviceVisitWindow returns when a visit starting at start ends, using the
+// slot length of the franchise's working hours that day
+func serviceVisitWindow(db *gorm.DB, franchiseID uint, start time.Time) (time.Time, error) {
+	length := defaultSlotMinutes
+	if franchiseID != 0 {
+		hours, err := workingHoursFor(db, franchiseID, start.In(time.Local).Weekday())
+		if err != nil {
+			return time.Time{}, err
+		}
+		if hours.SlotMinutes > 0 {
+			length = hours.SlotMinutes
+		}
+	}
+	return start.Add(time.Duration(length) * time.Minute), nil
+}
+
+// checkAgentAvailable stops a job being assigned to an agent who is on leave
+// or off shift from start to end. A zero end only checks the day.
+func checkAgentAvailable(db *gorm.DB, agentID uint, start, end time.Time) error {
+	schedules, err := loadAgentSchedules(db, []uint{agentID}, start.In(time.Local), start.In(time.Local))
+	if err != nil {
+		return apperror.Internal(err)
+	}
+	if reason := schedules[agentID].unavailableReason(start, end); reason != "" {
+		return apperror.New(http.StatusConflict, "agent_unavailable", "The service agent "+reason)
+	}
+	return nil
+}
+
+// checkAgentAvailableForService checks the agent can take a service request's
+// visit. Requests without a scheduled time can be assigned to anyone.
+func checkAgentAvailableForService(db *gorm.DB, agentID, franchiseID uint, scheduled *time.Time) error {
+	if scheduled == nil {
+		return nil
+	}
+	end, err := serviceVisitWindow(db, franchiseID, *scheduled)
+	if err != nil {
+		return apperror.Internal(err)
+	}
+	return checkAgentAvailable(db, agentID, *scheduled, end)
+}
+
+// franchiseAgentForRequest loads the :id service agent from a franchise the
+// caller manages. It writes the error response and returns false on failure.
+func franchiseAgentForRequest(c *gin.Context) (database.User, bool) {
+	var agent database.User
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Where("id = ? AND role = ?", c.Param("id"), database.RoleServiceAgent), "franchise_id")
+	if !ok {
+		return agent, false
+	}
+	if err := query.Select("id, name, franchise_id").First(&agent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Service agent not found"))
+		} else {
+			apperror.Respond(c, apperror.Internal(err))
+		}
+		return agent, false
+	}
+	return agent, true
+}
+
+// respondAgentAvailability writes an agent's weekly shifts and their time off
+// from today on
+func respondAgentAvailability(c *gin.Context, agentID uint) {
+	var shifts []database.AgentShift
+	if err := database.DB.WithContext(c.Request.Context()).Where("agent_id = ?", agentID).Order("weekday").Find(&shifts).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	var leaves []database.AgentLeave
+	if err := database.DB.WithContext(c.Request.Context()).Where("agent_id = ? AND end_date >= ?", agentID, time.Now().Format("2006-01-02")).
+		Order("start_date").Find(&leaves).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"agent_id": agentID, "shifts": shifts, "leaves": leaves})
+}
+
+// replaceAgentShifts saves an agent's weekly working hours
+func replaceAgentShifts(c *gin.Context, agentID uint) {
+	var request AgentShiftsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	seen := map[int]bool{}
+	shifts := []database.AgentShift{}
+	for _, s := range request.Shifts {
+		if seen[s.Weekday] {
+			apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Weekday %d is listed more than once", s.Weekday)))
+			return
+		}
+		seen[s.Weekday] = true
+
+		shift := database.AgentShift{AgentID: agentID, Weekday: s.Weekday, IsOff: s.IsOff}
+		if !s.IsOff {
+			start, errStart := time.Parse("15:04", s.StartTime)
+			end, errEnd := time.Parse("15:04", s.EndTime)
+			if errStart != nil || errEnd != nil || !end.After(start) {
+				apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Invalid start/end time for weekday %d", s.Weekday)))
+				return
+			}
+			shift.StartTime = s.StartTime
+			shift.EndTime = s.EndTime
+		}
+		shifts = append(shifts, shift)
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("agent_id = ?", agentID).Delete(&database.AgentShift{}).Error; err != nil {
+			return err
+		}
+		if len(shifts) == 0 {
+			return nil
+		}
+		return tx.Create(&shifts).Error
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to save shifts"))
+		return
+	}
+	recordAudit(c, nil, "agent.shifts_update", "user", agentID, nil, shifts)
+
+	c.JSON(http.StatusOK, shifts)
+}
+
+// createAgentLeave records time off for an agent and lists the jobs already
+// assigned to them in that time, so they can be reassigned
+func createAgentLeave(c *gin.Context, agentID uint) {
+	var request AgentLeaveRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if request.EndDate == "" {
+		request.EndDate = request.StartDate
+	}
+	start, errStart := time.Parse("2006-01-02", request.StartDate)
+	end, errEnd := time.Parse("2006-01-02", request.EndDate)
+	if errStart != nil || errEnd != nil {
+		apperror.Respond(c, apperror.BadRequest("Invalid date, use YYYY-MM-DD"))
+		return
+	}
+	if end.Before(start) {
+		apperror.Respond(c, apperror.BadRequest("end_date can't be before start_date"))
+		return
+	}
+	if request.StartDate < time.Now().Format("2006-01-02") {
+		apperror.Respond(c, apperror.BadRequest("Time off can't start in the past"))
+		return
+	}
+	if end.Sub(start) >= maxLeaveDays*24*time.Hour {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Time off can be at most %d days at a time", maxLeaveDays)))
+		return
+	}
+
+	leave := database.AgentLeave{
+		AgentID:     agentID,
+		Kind:        request.Kind,
+		StartDate:   start,
+		EndDate:     end,
+		Reason:      request.Reason,
+		CreatedByID: c.GetUint("user_id"),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&leave).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to save time off"))
+		return
+	}
+	recordAudit(c, nil, "agent.leave_add", "agent_leave", leave.ID, nil, leave)
+
+	from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+	to := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	var serviceRequestIDs, orderIDs []uint
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
+		Where("service_agent_id = ? AND scheduled_time >= ? AND scheduled_time < ? AND status NOT IN ?",
+			agentID, from, to, []string{database.ServiceStatusCompleted, database.ServiceStatusCancelled}).
+		Order("scheduled_time").Pluck("id", &serviceRequestIDs).Error; err != nil {
+		log.Printf("Failed to look up jobs during leave %d: %v", leave.ID, err)
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.Order{}).
+		Where("service_agent_id = ? AND delivery_date >= ? AND delivery_date < ? AND status NOT IN ?",
+			agentID, from, to, []string{database.OrderStatusDelivered, database.OrderStatusInstalled, database.OrderStatusCompleted,
+				database.OrderStatusCancelled, database.OrderStatusRejected}).
+		Order("delivery_date").Pluck("id", &orderIDs).Error; err != nil {
+		log.Printf("Failed to look up orders during leave %d: %v", leave.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"leave":                        leave,
+		"assigned_service_request_ids": serviceRequestIDs,
+		"assigned_order_ids":           orderIDs,
+	})
+}
+
+// deleteAgentLeave cancels time off. Agents may only cancel time off they
+// declared themselves.
+func deleteAgentLeave(c *gin.Context, agentID uint) {
+	query := database.DB.WithContext(c.Request.Context()).Where("id = ? AND agent_id = ?", c.Param("leave_id"), agentID)
+	if c.GetString("role") == database.RoleServiceAgent {
+		query = query.Where("created_by_id = ?", agentID)
+	}
+	var leave database.AgentLeave
+	if err := query.First(&leave).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Time off not found"))
+		} else {
+			apperror.Respond(c, apperror.Internal(err))
+		}
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&leave).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to cancel time off"))
+		return
+	}
+	recordAudit(c, nil, "agent.leave_cancel", "agent_leave", leave.ID, leave, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time off cancelled"})
+}
+
+// GetMyAvailability returns the signed-in agent's shifts and upcoming time off
+// GET /api/agent/availability
+func GetMyAvailability(c *gin.Context) {
+	respondAgentAvailability(c, c.GetUint("user_id"))
+}
+
+// UpdateMyShifts replaces the signed-in agent's weekly working hours
+// PUT /api/agent/shifts
+func UpdateMyShifts(c *gin.Context) {
+	replaceAgentShifts(c, c.GetUint("user_id"))
+}
+
+// AddMyLeave declares days off or leave for the signed-in agent
+// POST /api/agent/leaves
+func AddMyLeave(c *gin.Context) {
+	createAgentLeave(c, c.GetUint("user_id"))
+}
+
+// CancelMyLeave cancels time off the signed-in agent declared
+// DELETE /api/agent/leaves/:leave_id
+func CancelMyLeave(c *gin.Context) {
+	deleteAgentLeave(c, c.GetUint("user_id"))
+}
+
+// GetAgentAvailability returns an agent's shifts and upcoming time off
+// GET /api/franchise/agents/:id/availability
+func GetAgentAvailability(c *gin.Context) {
+	agent, ok := franchiseAgentForRequest(c)
+	if !ok {
+		return
+	}
+	respondAgentAvailability(c, agent.ID)
+}
+
+// UpdateAgentShifts replaces an agent's weekly working hours
+// PUT /api/franchise/agents/:id/shifts
+func UpdateAgentShifts(c *gin.Context) {
+	agent, ok := franchiseAgentForRequest(c)
+	if !ok {
+		return
+	}
+	replaceAgentShifts(c, agent.ID)
+}
+
+// AddAgentLeave declares days off or leave for an agent
+// POST /api/franchise/agents/:id/leaves
+func AddAgentLeave(c *gin.Context) {
+	agent, ok := franchiseAgentForRequest(c)
+	if !ok {
+		return
+	}
+	createAgentLeave(c, agent.ID)
+}
+
+// CancelAgentLeave cancels an agent's time off
+// DELETE /api/franchise/agents/:id/leaves/:leave_id
+func CancelAgentLeave(c *gin.Context) {
+	agent, ok := franchiseAgentForRequest(c)
+	if !ok {
+		return
+	}
+	deleteAgentLeave(c, agent.ID)
+}
+
+// GetAvailableAgents lists the franchise's agents with whether each can take
+// a visit starting at ?time, for picking who to assign
+// GET /api/franchise/agents/available?time=2006-01-02T15:04:05Z07:00
+func GetAvailableAgents(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+	start, err := time.Parse(time.RFC3339, c.Query("time"))
+	if err != nil {
+		apperror.Respond(c, apperror.BadRequest("Valid time (RFC3339) is required"))
+		return
+	}
+	end, err := serviceVisitWindow(database.DB.WithContext(c.Request.Context()), franchise.ID, start)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+
+	var agents []database.User
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, name, profile_picture").
+		Where("franchise_id = ? AND role = ?", franchise.ID, database.RoleServiceAgent).
+		Order("name").Find(&agents).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	ids := make([]uint, len(agents))
+	for i, agent := range agents {
+		ids[i] = agent.ID
+	}
+	local := start.In(time.Local)
+	schedules, err := loadAgentSchedules(database.DB.WithContext(c.Request.Context()), ids, local, local)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+
+	result := make([]AgentAvailability, 0, len(agents))
+	for _, agent := range agents {
+		reason := schedules[agent.ID].unavailableReason(start, end)
+		result = append(result, AgentAvailability{
+			AgentID:      agent.ID,
+			AgentName:    agent.Name,
+			AgentPicture: agent.ProfilePicture,
+			Available:    reason == "",
+			Reason:       reason,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"franchise_id": franchise.ID, "start": start, "end": end, "agents": result})
+}
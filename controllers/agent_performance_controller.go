@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// AgentPerformance is one agent's record for a month, ranked on the leaderboard
+type AgentPerformance struct {
+	Rank               int      `json:"rank"`
+	AgentID            uint     `json:"agent_id"`
+	AgentName          string   `json:"agent_name"`
+	AgentPicture       string   `json:"agent_profile_picture"`
+	CompletedJobs      int64    `json:"completed_jobs"`
+	AverageRating      *float64 `json:"average_rating"` // null until a customer rates a job
+	Ratings            int64    `json:"ratings"`
+	AvgCompletionHours *float64 `json:"avg_completion_hours"` // from assignment to completion
+	SLABreaches        int64    `json:"sla_breaches"`         // jobs completed after their SLA deadline
+}
+
+// GetAgentPerformance ranks a franchise's agents for a month by completed
+// jobs, then average rating, then fewest SLA breaches. Owners see their own
+// franchise; admins pass ?franchise_id=.
+// GET /api/franchise/agents/performance?month=2006-01
+func GetAgentPerformance(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	if m := c.Query("month"); m != "" {
+		parsed, err := time.ParseInLocation("2006-01", m, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, use YYYY-MM"})
+			return
+		}
+		monthStart = parsed
+	}
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	var agents []database.User
+	if err := database.ReadDB().WithContext(c.Request.Context()).Select("id, name, profile_picture").
+		Where("franchise_id = ? AND role = ?", franchise.ID, database.RoleServiceAgent).
+		Find(&agents).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch agents"})
+		return
+	}
+
+	var rows []AgentPerformance
+	if err := database.ReadDB().WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
+		Select("service_requests.service_agent_id AS agent_id, COUNT(*) AS completed_jobs, "+
+			"AVG(service_requests.rating) AS average_rating, COUNT(service_requests.rating) AS ratings, "+
+			"AVG(EXTRACT(EPOCH FROM service_requests.completion_time - COALESCE(service_requests.assigned_at, service_requests.created_at)) / 3600) AS avg_completion_hours, "+
+			"COUNT(*) FILTER (WHERE NOT ("+slaMetCondition+")) AS sla_breaches", config.AppConfig.ServiceSLAHours).
+		Where("service_requests.franchise_id = ? AND service_requests.status = ? AND service_requests.service_agent_id IS NOT NULL",
+			franchise.ID, database.ServiceStatusCompleted).
+		Where("service_requests.completion_time >= ? AND service_requests.completion_time < ?", monthStart, monthEnd).
+		Group("service_requests.service_agent_id").
+		Scan(&rows).Error; err != nil {
+		log.Printf("Error computing agent performance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute agent performance"})
+		return
+	}
+
+	// Every current agent is listed, including those without completed jobs
+	byAgent := make(map[uint]*AgentPerformance, len(agents)+len(rows))
+	leaderboard := make([]*AgentPerformance, 0, len(agents)+len(rows))
+	for i := range rows {
+		byAgent[rows[i].AgentID] = &rows[i]
+		leaderboard = append(leaderboard, &rows[i])
+	}
+	for _, agent := range agents {
+		if row, ok := byAgent[agent.ID]; ok {
+			row.AgentName = agent.Name
+			row.AgentPicture = agent.ProfilePicture
+			continue
+		}
+		leaderboard = append(leaderboard, &AgentPerformance{AgentID: agent.ID, AgentName: agent.Name, AgentPicture: agent.ProfilePicture})
+	}
+
+	rating := func(p *AgentPerformance) float64 {
+		if p.AverageRating == nil {
+			return 0
+		}
+		return *p.AverageRating
+	}
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		a, b := leaderboard[i], leaderboard[j]
+		if a.CompletedJobs != b.CompletedJobs {
+			return a.CompletedJobs > b.CompletedJobs
+		}
+		if rating(a) != rating(b) {
+			return rating(a) > rating(b)
+		}
+		if a.SLABreaches != b.SLABreaches {
+			return a.SLABreaches < b.SLABreaches
+		}
+		return a.AgentID < b.AgentID
+	})
+	for i, p := range leaderboard {
+		p.Rank = i + 1
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"franchise": gin.H{"id": franchise.ID, "name": franchise.Name},
+		"month":     monthStart.Format("2006-01"),
+		"agents":    leaderboard,
+	})
+}
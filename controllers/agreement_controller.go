@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Agreement acceptance code settings
+const (
+	agreementOTPTTL         = 10 * time.Minute
+	agreementOTPResendAfter = time.Minute
+	agreementOTPMaxAttempts = 5
+)
+
+// AcceptAgreementRequest carries the code texted to the customer
+type AcceptAgreementRequest struct {
+	OTP string `json:"otp" binding:"required,len=6,numeric"`
+}
+
+// agreementData fills agreementTemplate
+type agreementData struct {
+	OrderID          uint
+	Date             string
+	CustomerName     string
+	CustomerPhone    string
+	Address          string
+	FranchiseName    string
+	FranchiseAddress string
+	ProductName      string
+	Terms            database.PlanTerms
+	TotalInitial     float64
+}
+
+// agreementTemplate is the rental agreement text. A line starting with "# "
+// is the title and "## " a section heading; other lines are paragraphs.
+var agreementTemplate = template.Must(template.New("agreement").Parse(`# Water Purifier Rental Agreement
+Agreement for order #{{.OrderID}}, dated {{.Date}}.
+## Parties
+This agreement is between AquaHome, through its franchise {{.FranchiseName}} ({{.FranchiseAddress}}), and {{.CustomerName}} ({{.CustomerPhone}}), the customer, for installation at: {{.Address}}.
+## Equipment and plan
+Product: {{.ProductName}}
+Plan: {{.Terms.Name}}
+Rental term: {{.Terms.DurationMonths}} months
+Monthly rent: ₹{{printf "%.2f" .Terms.MonthlyRent}}
+Refundable security deposit: ₹{{printf "%.2f" .Terms.SecurityDeposit}}
+Installation fee: ₹{{printf "%.2f" .Terms.InstallationFee}}
+{{if .Terms.ServicesPerYear}}Included maintenance visits: {{.Terms.ServicesPerYear}} per year
+{{end}}Amount paid upfront, including taxes: ₹{{printf "%.2f" .TotalInitial}}
+## Terms
+1. The purifier remains the property of AquaHome. The customer shall not sell, sublet, move or modify it without written consent.
+2. Rent is billed monthly in advance from the date of delivery. Rent unpaid for more than the grace period attracts a late fee and may lead to suspension of service.
+3. AquaHome maintains the purifier during the rental term, including filter changes at the scheduled visits. Damage from misuse, tampering or unsuitable water supply is charged to the customer.
+4. The security deposit is refunded when the purifier is returned in working condition, less any unpaid rent, late fees or charges for damage.
+5. Either party may end the agreement with 30 days' notice. Ending before the rental term may forfeit discounts given for the term.
+6. The customer shall give AquaHome technicians reasonable access for installation, maintenance and removal.
+## Acceptance
+The customer accepts this agreement electronically by entering the one-time code sent to their registered phone. The time, IP address and device of acceptance are recorded as consent.
+`))
+
+// renderAgreement lays the agreement text out as a PDF
+func renderAgreement(data agreementData) ([]byte, error) {
+	var text bytes.Buffer
+	if err := agreementTemplate.Execute(&text, data); err != nil {
+		return nil, err
+	}
+
+	doc := utils.NewTextDocument()
+	for _, line := range strings.Split(text.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# "):
+			doc.Title(strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "## "):
+			doc.Heading(strings.TrimPrefix(line, "## "))
+		case strings.TrimSpace(line) != "":
+			doc.Paragraph(line)
+		}
+	}
+	return doc.Bytes(), nil
+}
+
+// createRentalAgreement generates the agreement of an approved order and
+// tells the customer it is ready. It does nothing when one exists already.
+func createRentalAgreement(tx *gorm.DB, orderID uint) error {
+	var existing int64
+	if err := tx.Model(&database.RentalAgreement{}).Where("order_id = ?", orderID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	var order database.Order
+	if err := tx.Preload("Customer").Preload("Product").Preload("Franchise").First(&order, orderID).Error; err != nil {
+		return err
+	}
+
+	// Orders placed without a plan use the prices copied onto the order
+	terms := database.PlanTerms{
+		Name:            "Standard",
+		DurationMonths:  order.RentalDuration,
+		MonthlyRent:     order.MonthlyRent,
+		SecurityDeposit: order.SecurityDeposit,
+		InstallationFee: order.InstallationFee,
+	}
+	if order.PlanTerms != nil {
+		terms = *order.PlanTerms
+	}
+
+	address := order.ShippingAddress
+	if address == "" {
+		address = strings.Join([]string{order.Customer.Address, order.Customer.City, order.Customer.State, order.Customer.ZipCode}, ", ")
+	}
+	document, err := renderAgreement(agreementData{
+		OrderID:          order.ID,
+		Date:             time.Now().Format("2 January 2006"),
+		CustomerName:     order.Customer.Name,
+		CustomerPhone:    order.Customer.Phone,
+		Address:          address,
+		FranchiseName:    order.Franchise.Name,
+		FranchiseAddress: strings.Join([]string{order.Franchise.Address, order.Franchise.City}, ", "),
+		ProductName:      order.Product.Name,
+		Terms:            terms,
+		TotalInitial:     order.TotalInitialAmount,
+	})
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(document)
+	agreement := database.RentalAgreement{
+		OrderID:    order.ID,
+		CustomerID: order.CustomerID,
+		Document:   document,
+		SHA256:     hex.EncodeToString(sum[:]),
+	}
+	if err := tx.Create(&agreement).Error; err != nil {
+		return err
+	}
+
+	notification := database.Notification{
+		UserID:      order.CustomerID,
+		Type:        "order",
+		RelatedID:   &order.ID,
+		RelatedType: "order",
+	}.Rendered(tx, "order.agreement_ready", database.Vars{"id": order.ID})
+	return tx.Create(&notification).Error
+}
+
+// agreementForViewer loads the agreement of the order named by :id if the
+// caller may view the order
+func agreementForViewer(c *gin.Context) (database.Order, database.RentalAgreement, bool) {
+	var agreement database.RentalAgreement
+	order, ok := orderForViewer(c)
+	if !ok {
+		return order, agreement, false
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Where("order_id = ?", order.ID).First(&agreement).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The rental agreement is generated once the order is approved"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return order, agreement, false
+	}
+	return order, agreement, true
+}
+
+// GetRentalAgreement returns whether an order's agreement has been accepted
+// GET /api/orders/:id/agreement
+func GetRentalAgreement(c *gin.Context) {
+	_, agreement, ok := agreementForViewer(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, agreement)
+}
+
+// DownloadRentalAgreement sends an order's agreement PDF
+// GET /api/orders/:id/agreement/pdf
+func DownloadRentalAgreement(c *gin.Context) {
+	order, agreement, ok := agreementForViewer(c)
+	if !ok {
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="agreement-%d.pdf"`, order.ID))
+	c.Data(http.StatusOK, "application/pdf", agreement.Document)
+}
+
+// SendAgreementOTP texts the customer a code to accept their agreement with
+// POST /api/orders/:id/agreement/otp
+func SendAgreementOTP(c *gin.Context) {
+	order, agreement, ok := agreementForViewer(c)
+	if !ok {
+		return
+	}
+	if agreement.AcceptedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The agreement has already been accepted"})
+		return
+	}
+	if agreement.OTPExpiresAt != nil && time.Until(*agreement.OTPExpiresAt) > agreementOTPTTL-agreementOTPResendAfter {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait a minute before requesting another code"})
+		return
+	}
+
+	var customer database.User
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, phone").First(&customer, order.CustomerID).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	phone := utils.NormalizePhone(customer.Phone)
+	if phone == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Add a phone number to your profile to accept the agreement"})
+		return
+	}
+
+	code, err := utils.GenerateNumericOTP(6)
+	if err != nil {
+		log.Printf("Failed to generate agreement code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+	expiresAt := time.Now().Add(agreementOTPTTL)
+	if err := database.DB.WithContext(c.Request.Context()).Model(&agreement).Updates(map[string]interface{}{
+		"otp_hash":       utils.HashToken(code),
+		"otp_expires_at": expiresAt,
+		"otp_attempts":   0,
+	}).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	message := database.Notification{UserID: order.CustomerID}.Rendered(database.DB.WithContext(c.Request.Context()), "order.agreement_code", database.Vars{"code": code, "id": order.ID}).Message
+	if err := utils.SendSMS(phone, message); err != nil {
+		log.Printf("Failed to text agreement code for order %d: %v", order.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Code sent to your registered phone", "expires_at": expiresAt})
+}
+
+// AcceptRentalAgreement records the customer's acceptance of their
+// agreement once they enter the code texted to them, keeping the time, IP
+// and user agent as consent
+// POST /api/orders/:id/agreement/accept
+func AcceptRentalAgreement(c *gin.Context) {
+	var req AcceptAgreementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("The 6-digit code sent to your phone is required"))
+		return
+	}
+
+	order, agreement, ok := agreementForViewer(c)
+	if !ok {
+		return
+	}
+	if agreement.AcceptedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The agreement has already been accepted"})
+		return
+	}
+	if agreement.OTPHash == "" || agreement.OTPExpiresAt == nil || time.Now().After(*agreement.OTPExpiresAt) ||
+		agreement.OTPAttempts >= agreementOTPMaxAttempts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+	if !utils.TokensEqual(agreement.OTPHash, utils.HashToken(req.OTP)) {
+		database.DB.WithContext(c.Request.Context()).Model(&agreement).Update("otp_attempts", gorm.Expr("otp_attempts + 1"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	acceptedAt := time.Now()
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Accept only once, and spend the code
+		result := tx.Model(&database.RentalAgreement{}).
+			Where("id = ? AND accepted_at IS NULL", agreement.ID).
+			Updates(map[string]interface{}{
+				"accepted_at":         acceptedAt,
+				"accepted_ip":         c.ClientIP(),
+				"accepted_user_agent": userAgent,
+				"otp_hash":            "",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordOrderStatus(tx, order.ID, order.Status, order.Status, c.GetUint("user_id"), "Rental agreement accepted")
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The agreement has already been accepted"})
+			return
+		}
+		log.Printf("Failed to accept agreement of order %d: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept the agreement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Agreement accepted", "accepted_at": acceptedAt, "sha256": agreement.SHA256})
+}
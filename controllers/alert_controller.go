@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+)
+
+// GetAlerts lists the alerts posted for operators, newest first, filtered
+// by ?kind and ?subject (Admin only)
+// GET /api/admin/alerts
+func GetAlerts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Alert{})
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+	var alerts []database.Alert
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&alerts).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts, "total": total, "page": page, "limit": limit})
+}
@@ -0,0 +1,635 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/cache"
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// analyticsWindow is the period and bucket size of a time-series request
+type analyticsWindow struct {
+	Interval string // day, week or month
+	From     time.Time
+	To       time.Time // exclusive
+}
+
+// bucketRow is one GROUP BY bucket of an analytics query
+type bucketRow struct {
+	Bucket time.Time
+	Count  int64
+	Total  float64
+}
+
+// parseAnalyticsWindow reads ?interval=&from=&to=. By default it covers the
+// last twelve months, or the last 90 days for daily and weekly series. It writes the error response and returns false
+// on invalid input.
+func parseAnalyticsWindow(c *gin.Context) (analyticsWindow, bool) {
+	w := analyticsWindow{Interval: c.DefaultQuery("interval", "month")}
+	switch w.Interval {
+	case "day", "week", "month":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return w, false
+	}
+
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return w, false
+	}
+
+	now := time.Now().UTC()
+	w.To = now
+	if dates.To != nil {
+		w.To = dates.To.UTC()
+	}
+	if w.Interval == "month" {
+		w.From = truncateBucket(w.To, w.Interval).AddDate(0, -11, 0)
+	} else {
+		w.From = truncateBucket(w.To.AddDate(0, 0, -89), w.Interval)
+	}
+	if dates.From != nil {
+		w.From = dates.From.UTC()
+	}
+
+	// Keep series to a size a chart can render
+	if len(analyticsBuckets(w)) > 400 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date range is too large for the chosen interval"})
+		return w, false
+	}
+	return w, true
+}
+
+// cacheKey identifies the window in cache keys
+func (w analyticsWindow) cacheKey() string {
+	return fmt.Sprintf("%s:%s:%s", w.Interval, w.From.Format("2006-01-02"), w.To.Format("2006-01-02"))
+}
+
+// truncateBucket returns the start of the bucket containing t, matching
+// Postgres date_trunc (weeks start on Monday)
+func truncateBucket(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// analyticsBuckets lists the bucket start dates covering the window
+func analyticsBuckets(w analyticsWindow) []time.Time {
+	var buckets []time.Time
+	for b := truncateBucket(w.From, w.Interval); b.Before(w.To); {
+		buckets = append(buckets, b)
+		switch w.Interval {
+		case "day":
+			b = b.AddDate(0, 0, 1)
+		case "week":
+			b = b.AddDate(0, 0, 7)
+		default:
+			b = b.AddDate(0, 1, 0)
+		}
+	}
+	return buckets
+}
+
+func bucketKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// groupByBucket counts the rows of query per bucket of column and, when sum is
+// given, totals that expression
+func groupByBucket(query *gorm.DB, column, sum string, w analyticsWindow) (map[string]bucketRow, error) {
+	// Interval is validated against a fixed list, so it is safe to inline
+	selectSQL := fmt.Sprintf("date_trunc('%s', %s) AS bucket, COUNT(*) AS count", w.Interval, column)
+	if sum != "" {
+		selectSQL += fmt.Sprintf(", COALESCE(SUM(%s), 0) AS total", sum)
+	}
+
+	var rows []bucketRow
+	if err := query.Select(selectSQL).
+		Where(column+" >= ? AND "+column+" < ?", w.From, w.To).
+		Group("bucket").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byBucket := make(map[string]bucketRow, len(rows))
+	for _, row := range rows {
+		byBucket[bucketKey(row.Bucket)] = row
+	}
+	return byBucket, nil
+}
+
+// respondAnalytics sends a series and caches it under key
+func respondAnalytics(c *gin.Context, key string, w analyticsWindow, series []gin.H) {
+	response := gin.H{
+		"interval": w.Interval,
+		"from":     w.From.Format("2006-01-02"),
+		"to":       w.To.Format("2006-01-02"),
+		"series":   series,
+	}
+	cache.SetJSON(c.Request.Context(), key, response, dashboardCacheTTL)
+	c.JSON(http.StatusOK, response)
+}
+
+// serveCachedAnalytics writes a cached response and reports whether there was one
+func serveCachedAnalytics(c *gin.Context, key string) bool {
+	var cached gin.H
+	if !cache.GetJSON(c.Request.Context(), key, &cached) {
+		return false
+	}
+	c.JSON(http.StatusOK, cached)
+	return true
+}
+
+// revenueSeries computes revenue from successful payments per bucket. scope
+// narrows the payments, e.g. to one franchise.
+func revenueSeries(scope func(*gorm.DB) *gorm.DB, w analyticsWindow) ([]gin.H, error) {
+	query := scope(database.ReadDB().Model(&database.Payment{})).
+		Where("payments.status IN ?", []string{database.PaymentStatusSuccess, database.PaymentStatusPaid})
+	rows, err := groupByBucket(query, "payments.created_at", "payments.amount", w)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []gin.H{}
+	for _, b := range analyticsBuckets(w) {
+		row := rows[bucketKey(b)]
+		series = append(series, gin.H{"period": bucketKey(b), "revenue": row.Total, "payments": row.Count})
+	}
+	return series, nil
+}
+
+// subscriptionSeries computes new and churned subscriptions per bucket. A
+// subscription counts as churned in the bucket where it was last updated to
+// cancelled or expired.
+func subscriptionSeries(scope func(*gorm.DB) *gorm.DB, w analyticsWindow) ([]gin.H, error) {
+	started, err := groupByBucket(scope(database.ReadDB().Model(&database.Subscription{})), "subscriptions.created_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+	churned, err := groupByBucket(scope(database.ReadDB().Model(&database.Subscription{})).
+		Where("subscriptions.status IN ?", []string{database.SubscriptionStatusCancelled, database.SubscriptionStatusExpired}),
+		"subscriptions.updated_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []gin.H{}
+	for _, b := range analyticsBuckets(w) {
+		key := bucketKey(b)
+		series = append(series, gin.H{
+			"period":  key,
+			"new":     started[key].Count,
+			"churned": churned[key].Count,
+			"net":     started[key].Count - churned[key].Count,
+		})
+	}
+	return series, nil
+}
+
+// orderSeries computes placed and paid orders and the conversion rate per bucket
+func orderSeries(scope func(*gorm.DB) *gorm.DB, w analyticsWindow) ([]gin.H, error) {
+	placed, err := groupByBucket(scope(database.ReadDB().Model(&database.Order{})), "orders.created_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := groupByBucket(scope(database.ReadDB().Model(&database.Order{})).
+		Where("EXISTS (SELECT 1 FROM payments WHERE payments.order_id = orders.id AND payments.status IN ?)",
+			[]string{database.PaymentStatusSuccess, database.PaymentStatusPaid}),
+		"orders.created_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []gin.H{}
+	for _, b := range analyticsBuckets(w) {
+		key := bucketKey(b)
+		rate := 0.0
+		if placed[key].Count > 0 {
+			rate = float64(paid[key].Count) / float64(placed[key].Count)
+		}
+		series = append(series, gin.H{
+			"period":          key,
+			"placed":          placed[key].Count,
+			"paid":            paid[key].Count,
+			"conversion_rate": rate,
+		})
+	}
+	return series, nil
+}
+
+// leadSeries computes demo requests received and converted and the
+// conversion rate per bucket. Leads count in the bucket they came in, so a
+// period's rate rises as its leads are converted.
+func leadSeries(scope func(*gorm.DB) *gorm.DB, w analyticsWindow) ([]gin.H, error) {
+	received, err := groupByBucket(scope(database.ReadDB().Model(&database.Lead{})), "leads.created_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := groupByBucket(scope(database.ReadDB().Model(&database.Lead{})).
+		Where("leads.status = ?", database.LeadStatusConverted),
+		"leads.created_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []gin.H{}
+	for _, b := range analyticsBuckets(w) {
+		key := bucketKey(b)
+		rate := 0.0
+		if received[key].Count > 0 {
+			rate = float64(converted[key].Count) / float64(received[key].Count)
+		}
+		series = append(series, gin.H{
+			"period":          key,
+			"received":        received[key].Count,
+			"converted":       converted[key].Count,
+			"conversion_rate": rate,
+		})
+	}
+	return series, nil
+}
+
+// leadConversion is how a franchise's leads from a window turned out
+type leadConversion struct {
+	FranchiseID    *uint   `json:"franchise_id"` // nil for leads no franchise serves
+	Name           string  `json:"name"`
+	Received       int64   `json:"received"`
+	Converted      int64   `json:"converted"`
+	Lost           int64   `json:"lost"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// leadConversions counts the leads of query received in the window per
+// franchise, busiest first
+func leadConversions(query *gorm.DB, w analyticsWindow) ([]leadConversion, error) {
+	rows := []leadConversion{}
+	if err := query.
+		Select("leads.franchise_id, COALESCE(franchises.name, '') AS name, COUNT(*) AS received, "+
+			"COUNT(*) FILTER (WHERE leads.status = ?) AS converted, COUNT(*) FILTER (WHERE leads.status = ?) AS lost",
+			database.LeadStatusConverted, database.LeadStatusLost).
+		Joins("LEFT JOIN franchises ON franchises.id = leads.franchise_id").
+		Where("leads.created_at >= ? AND leads.created_at < ?", w.From, w.To).
+		Group("leads.franchise_id, franchises.name").
+		Order("received DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if rows[i].Received > 0 {
+			rows[i].ConversionRate = float64(rows[i].Converted) / float64(rows[i].Received)
+		}
+	}
+	return rows, nil
+}
+
+// serviceRequestSeries computes raised, completed and cancelled service requests per bucket
+func serviceRequestSeries(scope func(*gorm.DB) *gorm.DB, w analyticsWindow) ([]gin.H, error) {
+	raised, err := groupByBucket(scope(database.ReadDB().Model(&database.ServiceRequest{})), "service_requests.created_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := groupByBucket(scope(database.ReadDB().Model(&database.ServiceRequest{})).
+		Where("service_requests.status = ?", database.ServiceStatusCompleted),
+		"service_requests.completion_time", "", w)
+	if err != nil {
+		return nil, err
+	}
+	cancelled, err := groupByBucket(scope(database.ReadDB().Model(&database.ServiceRequest{})).
+		Where("service_requests.status = ?", database.ServiceStatusCancelled),
+		"service_requests.updated_at", "", w)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []gin.H{}
+	for _, b := range analyticsBuckets(w) {
+		key := bucketKey(b)
+		series = append(series, gin.H{
+			"period":    key,
+			"raised":    raised[key].Count,
+			"completed": completed[key].Count,
+			"cancelled": cancelled[key].Count,
+		})
+	}
+	return series, nil
+}
+
+// allRows leaves a query unscoped
+func allRows(query *gorm.DB) *gorm.DB {
+	return query
+}
+
+// withRequestContext makes the queries scope builds end with the request
+func withRequestContext(c *gin.Context, scope func(*gorm.DB) *gorm.DB) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		return scope(query.WithContext(c.Request.Context()))
+	}
+}
+
+// adminAnalytics serves one admin time series
+func adminAnalytics(c *gin.Context, name string, build func(func(*gorm.DB) *gorm.DB, analyticsWindow) ([]gin.H, error)) {
+	w, ok := parseAnalyticsWindow(c)
+	if !ok {
+		return
+	}
+
+	key := cache.PrefixDashboard + "analytics:admin:" + name + ":" + w.cacheKey()
+	if serveCachedAnalytics(c, key) {
+		return
+	}
+
+	series, err := build(withRequestContext(c, allRows), w)
+	if err != nil {
+		log.Printf("Error computing %s analytics: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+	respondAnalytics(c, key, w, series)
+}
+
+// GetRevenueAnalytics returns revenue per period
+// GET /api/admin/analytics/revenue?interval=month&from=&to=
+func GetRevenueAnalytics(c *gin.Context) {
+	adminAnalytics(c, "revenue", revenueSeries)
+}
+
+// GetSubscriptionAnalytics returns new vs churned subscriptions per period
+// GET /api/admin/analytics/subscriptions?interval=month&from=&to=
+func GetSubscriptionAnalytics(c *gin.Context) {
+	adminAnalytics(c, "subscriptions", subscriptionSeries)
+}
+
+// GetOrderAnalytics returns placed vs paid orders and the conversion rate per period
+// GET /api/admin/analytics/orders?interval=month&from=&to=
+func GetOrderAnalytics(c *gin.Context) {
+	adminAnalytics(c, "orders", orderSeries)
+}
+
+// GetServiceRequestAnalytics returns service request volumes per period
+// GET /api/admin/analytics/service-requests?interval=month&from=&to=
+func GetServiceRequestAnalytics(c *gin.Context) {
+	adminAnalytics(c, "service_requests", serviceRequestSeries)
+}
+
+// GetLeadAnalytics returns demo requests received and converted per period
+// and each franchise's conversion rate over the window
+// GET /api/admin/analytics/leads?interval=month&from=&to=
+func GetLeadAnalytics(c *gin.Context) {
+	w, ok := parseAnalyticsWindow(c)
+	if !ok {
+		return
+	}
+
+	key := cache.PrefixDashboard + "analytics:admin:leads:" + w.cacheKey()
+	if serveCachedAnalytics(c, key) {
+		return
+	}
+
+	series, err := leadSeries(withRequestContext(c, allRows), w)
+	if err != nil {
+		log.Printf("Error computing leads analytics: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+	franchises, err := leadConversions(database.ReadDB().WithContext(c.Request.Context()).Model(&database.Lead{}), w)
+	if err != nil {
+		log.Printf("Error computing lead conversion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+
+	response := gin.H{
+		"interval":   w.Interval,
+		"from":       w.From.Format("2006-01-02"),
+		"to":         w.To.Format("2006-01-02"),
+		"series":     series,
+		"franchises": franchises,
+	}
+	cache.SetJSON(c.Request.Context(), key, response, dashboardCacheTTL)
+	c.JSON(http.StatusOK, response)
+}
+
+// GetFranchiseAnalytics returns a franchise's collected rent, pending dues,
+// service SLA compliance, lead conversion and top customers. Owners see their own franchise;
+// admins pass ?franchise_id=.
+// GET /api/franchise/analytics?interval=month&from=&to=
+func GetFranchiseAnalytics(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	w, ok := parseAnalyticsWindow(c)
+	if !ok {
+		return
+	}
+
+	key := fmt.Sprintf("%sanalytics:franchise:%d:%s", cache.PrefixDashboard, franchise.ID, w.cacheKey())
+	if serveCachedAnalytics(c, key) {
+		return
+	}
+
+	paymentsOfFranchise := func(query *gorm.DB) *gorm.DB {
+		return query.Where("(payments.subscription_id IN (SELECT id FROM subscriptions WHERE franchise_id = ?) "+
+			"OR payments.order_id IN (SELECT id FROM orders WHERE franchise_id = ?))", franchise.ID, franchise.ID)
+	}
+
+	collected, err := revenueSeries(withRequestContext(c, paymentsOfFranchise), w)
+	if err != nil {
+		log.Printf("Error computing franchise revenue: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+
+	// Dues are active subscriptions whose billing date has passed
+	var dues struct {
+		Subscriptions int64
+		Amount        float64
+	}
+	if err := database.ReadDB().WithContext(c.Request.Context()).Model(&database.Subscription{}).
+		Select("COUNT(*) AS subscriptions, COALESCE(SUM(monthly_rent), 0) AS amount").
+		Where("franchise_id = ? AND status = ? AND next_billing_date <= ?",
+			franchise.ID, database.SubscriptionStatusActive, time.Now()).
+		Scan(&dues).Error; err != nil {
+		log.Printf("Error computing franchise dues: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+
+	sla, err := slaSeries(database.ReadDB().WithContext(c.Request.Context()), franchise.ID, w)
+	if err != nil {
+		log.Printf("Error computing franchise SLA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+	ofFranchise := database.ReadDB().WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Where("service_requests.franchise_id = ?", franchise.ID)
+	overview, err := slaOverview(ofFranchise, ofFranchise.Session(&gorm.Session{}).
+		Where("service_requests.completion_time >= ? AND service_requests.completion_time < ?", w.From, w.To))
+	if err != nil {
+		log.Printf("Error computing franchise SLA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+
+	ofFranchiseLeads := func(query *gorm.DB) *gorm.DB {
+		return query.Where("leads.franchise_id = ?", franchise.ID)
+	}
+	leads, err := leadSeries(withRequestContext(c, ofFranchiseLeads), w)
+	if err != nil {
+		log.Printf("Error computing franchise leads: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+	conversion, err := leadConversions(ofFranchiseLeads(database.ReadDB().WithContext(c.Request.Context()).Model(&database.Lead{})), w)
+	if err != nil {
+		log.Printf("Error computing franchise lead conversion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+	leadTotals := leadConversion{FranchiseID: &franchise.ID, Name: franchise.Name}
+	if len(conversion) > 0 {
+		leadTotals = conversion[0]
+	}
+
+	type topCustomer struct {
+		CustomerID uint    `json:"customer_id"`
+		Name       string  `json:"name"`
+		ZipCode    string  `json:"zip_code"`
+		TotalPaid  float64 `json:"total_paid"`
+		Payments   int64   `json:"payments"`
+	}
+	var topCustomers []topCustomer
+	if err := paymentsOfFranchise(database.ReadDB().WithContext(c.Request.Context()).Table("payments")).
+		Select("users.id AS customer_id, users.name, users.zip_code, SUM(payments.amount) AS total_paid, COUNT(*) AS payments").
+		Joins("JOIN users ON users.id = payments.customer_id").
+		Where("payments.status IN ? AND payments.deleted_at IS NULL",
+			[]string{database.PaymentStatusSuccess, database.PaymentStatusPaid}).
+		Where("payments.created_at >= ? AND payments.created_at < ?", w.From, w.To).
+		Group("users.id, users.name, users.zip_code").
+		Order("total_paid DESC").
+		Limit(10).
+		Scan(&topCustomers).Error; err != nil {
+		log.Printf("Error computing top customers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute analytics"})
+		return
+	}
+	if topCustomers == nil {
+		topCustomers = []topCustomer{}
+	}
+
+	response := gin.H{
+		"franchise":      gin.H{"id": franchise.ID, "name": franchise.Name},
+		"interval":       w.Interval,
+		"from":           w.From.Format("2006-01-02"),
+		"to":             w.To.Format("2006-01-02"),
+		"collected_rent": collected,
+		"pending_dues":   gin.H{"subscriptions": dues.Subscriptions, "amount": dues.Amount},
+		"sla": gin.H{
+			"target_hours": config.AppConfig.ServiceSLAHours,
+			"type_targets": config.AppConfig.ServiceSLAHoursByType,
+			"overdue":      overview["overdue"],
+			"escalated":    overview["escalated"],
+			"compliance":   overview["compliance"],
+			"series":       sla,
+		},
+		"leads": gin.H{
+			"received":        leadTotals.Received,
+			"converted":       leadTotals.Converted,
+			"lost":            leadTotals.Lost,
+			"conversion_rate": leadTotals.ConversionRate,
+			"series":          leads,
+		},
+		"top_customers": topCustomers,
+	}
+	cache.SetJSON(c.Request.Context(), key, response, dashboardCacheTTL)
+	c.JSON(http.StatusOK, response)
+}
+
+// slaMetCondition matches service requests completed by their SLA deadline.
+// Requests from before deadlines were tracked use the default target.
+const slaMetCondition = "service_requests.completion_time <= COALESCE(service_requests.sla_due_at, service_requests.created_at + make_interval(hours => ?))"
+
+// slaOverview counts open service requests past their SLA and how many of
+// the completed ones met it
+func slaOverview(open, completed *gorm.DB) (gin.H, error) {
+	var overdue, escalated, done, met int64
+	if err := open.Session(&gorm.Session{}).
+		Where("service_requests.status IN ? AND service_requests.sla_due_at <= ?", database.OpenServiceStatuses, time.Now()).
+		Count(&overdue).Error; err != nil {
+		return nil, err
+	}
+	if err := open.Session(&gorm.Session{}).
+		Where("service_requests.status IN ? AND service_requests.escalation_level = ?", database.OpenServiceStatuses, database.EscalationAdmin).
+		Count(&escalated).Error; err != nil {
+		return nil, err
+	}
+	completed = completed.Session(&gorm.Session{}).Where("service_requests.status = ?", database.ServiceStatusCompleted)
+	if err := completed.Session(&gorm.Session{}).Count(&done).Error; err != nil {
+		return nil, err
+	}
+	if err := completed.Session(&gorm.Session{}).Where(slaMetCondition, config.AppConfig.ServiceSLAHours).
+		Count(&met).Error; err != nil {
+		return nil, err
+	}
+
+	var compliance interface{} // null when nothing was completed
+	if done > 0 {
+		compliance = float64(met) / float64(done)
+	}
+	return gin.H{
+		"overdue":    overdue,
+		"escalated":  escalated,
+		"completed":  done,
+		"within_sla": met,
+		"compliance": compliance,
+	}, nil
+}
+
+// slaSeries computes, per bucket, how many completed service requests of a
+// franchise were finished within the SLA
+func slaSeries(db *gorm.DB, franchiseID uint, w analyticsWindow) ([]gin.H, error) {
+	completedQuery := func() *gorm.DB {
+		return db.Model(&database.ServiceRequest{}).
+			Where("service_requests.franchise_id = ? AND service_requests.status = ?", franchiseID, database.ServiceStatusCompleted)
+	}
+
+	completed, err := groupByBucket(completedQuery(), "service_requests.completion_time", "", w)
+	if err != nil {
+		return nil, err
+	}
+	withinSLA, err := groupByBucket(completedQuery().Where(slaMetCondition, config.AppConfig.ServiceSLAHours),
+		"service_requests.completion_time", "", w)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []gin.H{}
+	for _, b := range analyticsBuckets(w) {
+		key := bucketKey(b)
+		var compliance interface{} // null when nothing was completed
+		if completed[key].Count > 0 {
+			compliance = float64(withinSLA[key].Count) / float64(completed[key].Count)
+		}
+		series = append(series, gin.H{
+			"period":     key,
+			"completed":  completed[key].Count,
+			"within_sla": withinSLA[key].Count,
+			"compliance": compliance,
+		})
+	}
+	return series, nil
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/jobs"
+)
+
+// AnnouncementRequest is a broadcast to all customers, one franchise's
+// customers or all service agents
+type AnnouncementRequest struct {
+	Title       string `json:"title" binding:"required,max=255"`
+	Message     string `json:"message" binding:"required,max=2000"`
+	Audience    string `json:"audience" binding:"required,oneof=all_customers franchise_customers all_agents"`
+	FranchiseID *uint  `json:"franchise_id"`
+	SendEmail   bool   `json:"send_email"`
+	SendSMS     bool   `json:"send_sms"`
+}
+
+// CreateAnnouncement queues a broadcast and starts delivering it in the
+// background (Admin only)
+func CreateAnnouncement(c *gin.Context) {
+	var req AnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	if req.Audience == database.AudienceFranchiseCustomers {
+		if req.FranchiseID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "franchise_id is required for franchise_customers"})
+			return
+		}
+		if err := database.DB.WithContext(c.Request.Context()).Select("id").First(&database.Franchise{}, *req.FranchiseID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+				return
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+	} else {
+		req.FranchiseID = nil
+	}
+
+	announcement := database.Announcement{
+		Title:       req.Title,
+		Message:     req.Message,
+		Audience:    req.Audience,
+		FranchiseID: req.FranchiseID,
+		SendEmail:   req.SendEmail,
+		SendSMS:     req.SendSMS,
+		CreatedBy:   c.GetUint("user_id"),
+		Status:      database.AnnouncementStatusQueued,
+	}
+	if err := jobs.AnnouncementAudience(database.DB.WithContext(c.Request.Context()), announcement).Count(&announcement.Recipients).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&announcement).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create announcement"})
+		return
+	}
+
+	jobs.QueueAnnouncement(announcement.ID)
+
+	recordAudit(c, nil, "announcement.create", "announcement", announcement.ID, nil, announcement)
+	c.JSON(http.StatusAccepted, announcement)
+}
+
+// GetAnnouncements lists broadcasts with their delivery stats, newest first (Admin only)
+// GET /api/admin/announcements?page=&limit=
+func GetAnnouncements(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var total int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.Announcement{}).Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch announcements"})
+		return
+	}
+
+	var announcements []database.Announcement
+	if err := database.DB.WithContext(c.Request.Context()).Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).
+		Find(&announcements).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch announcements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"announcements": announcements, "total": total, "page": page, "limit": limit})
+}
+
+// GetAnnouncement returns a broadcast and its delivery stats (Admin only)
+func GetAnnouncement(c *gin.Context) {
+	var announcement database.Announcement
+	if err := database.DB.WithContext(c.Request.Context()).First(&announcement, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Announcement not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	c.JSON(http.StatusOK, announcement)
+}
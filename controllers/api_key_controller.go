@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// APIKeyRequest creates a partner API key
+type APIKeyRequest struct {
+	Name               string     `json:"name" binding:"required,max=100"`
+	Scopes             []string   `json:"scopes" binding:"required,min=1"`
+	FranchiseID        *uint      `json:"franchise_id"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute" binding:"min=0,max=10000"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+}
+
+// APIKeyCreatedResponse carries the full key, shown only once
+type APIKeyCreatedResponse struct {
+	database.APIKey
+	Key string `json:"key"`
+}
+
+// GetAPIKeyScopes lists the scopes an API key can be granted (Admin only)
+func GetAPIKeyScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, database.AllAPIKeyScopes)
+}
+
+// GetAPIKeys lists partner API keys (Admin only)
+func GetAPIKeys(c *gin.Context) {
+	var keys []database.APIKey
+	if err := database.DB.WithContext(c.Request.Context()).Order("id DESC").Find(&keys).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey issues a partner API key. The response holds the only copy
+// of the full key. (Admin only)
+func CreateAPIKey(c *gin.Context) {
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := database.AllAPIKeyScopes[scope]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	if req.FranchiseID != nil {
+		if err := database.DB.WithContext(c.Request.Context()).Select("id").First(&database.Franchise{}, *req.FranchiseID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+				return
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+	}
+
+	prefix, err := utils.GenerateSecureToken(6)
+	if err != nil {
+		log.Printf("API key generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("API key generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	key := database.APIKey{
+		Name:               req.Name,
+		Prefix:             prefix,
+		SecretHash:         utils.HashToken(secret),
+		Scopes:             req.Scopes,
+		FranchiseID:        req.FranchiseID,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+		CreatedBy:          c.GetUint("user_id"),
+		ExpiresAt:          req.ExpiresAt,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&key).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	recordAudit(c, nil, "api_key.create", "api_key", key.ID, nil, key)
+	c.JSON(http.StatusCreated, APIKeyCreatedResponse{APIKey: key, Key: database.APIKeyPrefix + prefix + "." + secret})
+}
+
+// RevokeAPIKey stops a partner API key from working (Admin only)
+func RevokeAPIKey(c *gin.Context) {
+	var key database.APIKey
+	if err := database.DB.WithContext(c.Request.Context()).First(&key, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if key.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "API key is already revoked"})
+		return
+	}
+
+	before := key
+	now := time.Now()
+	if err := database.DB.WithContext(c.Request.Context()).Model(&key).Update("revoked_at", now).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	key.RevokedAt = &now
+
+	recordAudit(c, nil, "api_key.revoke", "api_key", key.ID, before, key)
+	c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersion returns the response format version negotiated for the request
+// (see middleware.APIVersion). Handlers that change their response shape branch
+// on it so older apps keep receiving the format they understand.
+func apiVersion(c *gin.Context) int {
+	if v := c.GetInt("api_version"); v > 0 {
+		return v
+	}
+	return 1
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// RescheduleAppointmentRequest is a customer's ask to move a visit
+type RescheduleAppointmentRequest struct {
+	PreferredTime *time.Time `json:"preferred_time"`
+	Reason        string     `json:"reason" binding:"max=500"`
+}
+
+// appointmentForToken loads the reminder a link from an appointment reminder
+// names, as long as the visit is still at the time reminded of. It writes the
+// error response and returns false on failure.
+func appointmentForToken(c *gin.Context) (database.AppointmentReminder, bool) {
+	var reminder database.AppointmentReminder
+	id, ok := utils.VerifySignedID(database.AppointmentLinkPurpose, c.Param("token"))
+	if !ok {
+		apperror.Respond(c, apperror.NotFound("This link is not valid"))
+		return reminder, false
+	}
+	db := database.DB.WithContext(c.Request.Context())
+	if err := db.First(&reminder, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("This link is not valid"))
+			return reminder, false
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return reminder, false
+	}
+	current, err := reminder.Current(db)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return reminder, false
+	}
+	if !current {
+		apperror.Respond(c, apperror.New(http.StatusGone, "appointment_changed",
+			"This visit has been moved or is no longer scheduled"))
+		return reminder, false
+	}
+	return reminder, true
+}
+
+// GetAppointment shows the visit a reminder link is for (Public)
+// GET /api/public/appointments/:token
+func GetAppointment(c *gin.Context) {
+	reminder, ok := appointmentForToken(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, reminder)
+}
+
+// ConfirmAppointment records that the customer will be home for the visit,
+// withdrawing any reschedule request (Public)
+// POST /api/public/appointments/:token/confirm
+func ConfirmAppointment(c *gin.Context) {
+	reminder, ok := appointmentForToken(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	reminder.ConfirmedAt = &now
+	reminder.RescheduleRequestedAt = nil
+	reminder.PreferredTime = nil
+	reminder.RescheduleReason = ""
+	if err := database.DB.WithContext(c.Request.Context()).Model(&reminder).Updates(map[string]interface{}{
+		"confirmed_at":            now,
+		"reschedule_requested_at": nil,
+		"preferred_time":          nil,
+		"reschedule_reason":       "",
+	}).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm visit"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Thanks, your visit is confirmed", "appointment": reminder})
+}
+
+// RescheduleAppointment records that the customer can't make the visit and
+// tells the franchise, which agrees a new time with them. No further
+// reminders go out for the visit. (Public)
+// POST /api/public/appointments/:token/reschedule
+func RescheduleAppointment(c *gin.Context) {
+	reminder, ok := appointmentForToken(c)
+	if !ok {
+		return
+	}
+
+	var req RescheduleAppointmentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apperror.Respond(c, apperror.Binding(err))
+			return
+		}
+	}
+	if req.PreferredTime != nil && req.PreferredTime.Before(time.Now()) {
+		apperror.Respond(c, apperror.BadRequest("Preferred time must be in the future"))
+		return
+	}
+
+	now := time.Now()
+	reminder.ConfirmedAt = nil
+	reminder.RescheduleRequestedAt = &now
+	reminder.PreferredTime = req.PreferredTime
+	reminder.RescheduleReason = req.Reason
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&reminder).Updates(map[string]interface{}{
+			"confirmed_at":            nil,
+			"reschedule_requested_at": now,
+			"preferred_time":          req.PreferredTime,
+			"reschedule_reason":       req.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		return publishRescheduleRequested(tx, reminder)
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request a new time"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "We'll call you to agree a new time", "appointment": reminder})
+}
+
+// currentAppointment matches reminders whose visit is still at the time
+// reminded of
+const currentAppointment = "(appointment_reminders.kind = ? AND EXISTS (SELECT 1 FROM service_requests WHERE service_requests.id = appointment_reminders.entity_id " +
+	"AND service_requests.scheduled_time = appointment_reminders.scheduled_time AND service_requests.status IN ?)) " +
+	"OR (appointment_reminders.kind = ? AND EXISTS (SELECT 1 FROM orders WHERE orders.id = appointment_reminders.entity_id " +
+	"AND orders.delivery_date = appointment_reminders.scheduled_time AND orders.status IN ?))"
+
+// GetFranchiseAppointments lists the upcoming visits of the caller's
+// franchises that customers were reminded of, soonest first. ?status=
+// confirmed, reschedule_requested or unconfirmed narrows it to the
+// customers' answers.
+// GET /api/franchise/appointments
+func GetFranchiseAppointments(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Model(&database.AppointmentReminder{}).
+		Where("scheduled_time >= ?", time.Now()).
+		Where(currentAppointment, database.AppointmentServiceRequest, database.RemindedServiceStatuses,
+			database.AppointmentInstallation, database.RemindedOrderStatuses),
+		"appointment_reminders.franchise_id")
+	if !ok {
+		return
+	}
+	switch c.Query("status") {
+	case "":
+	case "confirmed":
+		query = query.Where("confirmed_at IS NOT NULL")
+	case "reschedule_requested":
+		query = query.Where("reschedule_requested_at IS NOT NULL")
+	case "unconfirmed":
+		query = query.Where("confirmed_at IS NULL AND reschedule_requested_at IS NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be confirmed, reschedule_requested or unconfirmed"})
+		return
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointments"})
+		return
+	}
+	var reminders []database.AppointmentReminder
+	if err := query.Order("scheduled_time, id").Offset((page - 1) * limit).Limit(limit).Find(&reminders).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch appointments"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"appointments": reminders, "total": total, "page": page, "limit": limit})
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+)
+
+// GetArchivedRecords lists rows the retention job moved out of the
+// notifications and service_requests tables, newest first, filtered by
+// ?source, ?user_id and ?record_id (Admin only)
+// GET /api/admin/archive
+func GetArchivedRecords(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.ArchivedRecord{})
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if recordID := c.Query("record_id"); recordID != "" {
+		query = query.Where("record_id = ?", recordID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch archived records"})
+		return
+	}
+	var records []database.ArchivedRecord
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&records).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch archived records"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "total": total, "page": page, "limit": limit})
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// TaskResponseRequest is an agent's answer to a service request assignment
+type TaskResponseRequest struct {
+	Response string `json:"response" binding:"required,oneof=accept decline"`
+	Reason   string `json:"reason" binding:"max=500"`
+}
+
+var errTaskAlreadyAnswered = errors.New("task already answered")
+
+// RespondToTask lets the assigned agent accept a job, or decline it with a
+// reason so it goes back to the franchise's queue for reassignment
+// POST /api/agent/tasks/:id/respond
+func RespondToTask(c *gin.Context) {
+	var req TaskResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Response == "decline" && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to decline a job"})
+		return
+	}
+
+	serviceRequest, ok := agentJobForRequest(c)
+	if !ok {
+		return
+	}
+	if serviceRequest.CheckInAt != nil ||
+		(serviceRequest.Status != database.ServiceStatusAssigned && serviceRequest.Status != database.ServiceStatusScheduled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This job can no longer be accepted or declined"})
+		return
+	}
+	if req.Response == "accept" && serviceRequest.AcceptedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already accepted this job"})
+		return
+	}
+
+	agentID := c.GetUint("user_id")
+	now := time.Now()
+	assignedAt := serviceRequest.UpdatedAt
+	if serviceRequest.AssignedAt != nil {
+		assignedAt = *serviceRequest.AssignedAt
+	}
+	response := database.ServiceAssignmentResponse{
+		ServiceRequestID: serviceRequest.ID,
+		AgentID:          agentID,
+		Reason:           req.Reason,
+		AssignedAt:       assignedAt,
+		RespondedAt:      now,
+		ResponseSeconds:  int64(now.Sub(assignedAt).Seconds()),
+	}
+
+	before := serviceRequest
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Guarded on the agent and check-in so a reassignment or check-in in
+		// the meantime wins
+		guard := tx.Model(&database.ServiceRequest{}).
+			Where("id = ? AND service_agent_id = ? AND check_in_at IS NULL", serviceRequest.ID, agentID)
+
+		var result *gorm.DB
+		if req.Response == "accept" {
+			response.Response = database.AssignmentAccepted
+			result = guard.Where("accepted_at IS NULL").Update("accepted_at", now)
+			serviceRequest.AcceptedAt = &now
+		} else {
+			response.Response = database.AssignmentDeclined
+			result = guard.Updates(map[string]interface{}{
+				"service_agent_id": nil,
+				"status":           database.ServiceStatusPending,
+				"assigned_at":      nil,
+				"accepted_at":      nil,
+			})
+			serviceRequest.ServiceAgentID = nil
+			serviceRequest.Status = database.ServiceStatusPending
+			serviceRequest.AssignedAt = nil
+			serviceRequest.AcceptedAt = nil
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTaskAlreadyAnswered
+		}
+		if err := tx.Create(&response).Error; err != nil {
+			return err
+		}
+
+		if response.Response != database.AssignmentDeclined || serviceRequest.FranchiseID == 0 {
+			return nil
+		}
+		var franchise database.Franchise
+		if err := tx.Select("id, owner_id").First(&franchise, serviceRequest.FranchiseID).Error; err != nil || franchise.OwnerID == 0 {
+			return err
+		}
+		var agentName string
+		if err := tx.Model(&database.User{}).Where("id = ?", agentID).Pluck("name", &agentName).Error; err != nil {
+			return err
+		}
+		notification := database.Notification{
+			UserID:      franchise.OwnerID,
+			Type:        "service_request",
+			RelatedID:   &serviceRequest.ID,
+			RelatedType: "service_request",
+		}.Rendered(tx, "service_request.declined", database.Vars{"agent": agentName, "id": serviceRequest.ID, "reason": req.Reason})
+		return tx.Create(&notification).Error
+	})
+	if errors.Is(err, errTaskAlreadyAnswered) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This job was already answered or reassigned"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record response to service request %d: %v", serviceRequest.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record your response"})
+		return
+	}
+
+	recordAudit(c, nil, "service_request."+response.Response, "service_request", serviceRequest.ID, before, serviceRequest)
+	c.JSON(http.StatusOK, gin.H{"response": response, "service_request": serviceRequest})
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Attachment limits: photos are re-encoded like other field photos, videos
+// are stored as uploaded
+const (
+	maxAttachmentsPerUpload  = 5
+	maxAttachmentsPerRequest = 20
+	maxVideoAttachmentBytes  = 50 << 20
+)
+
+// videoExtensions are the video types accepted as attachments, by sniffed
+// content type
+var videoExtensions = map[string]string{
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// saveUploadedFile stores an upload as is under ./uploads/<subdir>, e.g. a
+// video or a PDF
+func saveUploadedFile(subdir, extension string, data []byte) (string, error) {
+	dir := filepath.Join(uploadsDir(), filepath.FromSlash(subdir))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	token, err := utils.GenerateSecureToken(12)
+	if err != nil {
+		return "", err
+	}
+	name := token + extension
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return "", err
+	}
+	return path.Join(uploadsURLPrefix, subdir, name), nil
+}
+
+// readUpload reads an uploaded file of at most limit bytes
+func readUpload(header *multipart.FileHeader, limit int64) ([]byte, error) {
+	if header.Size > limit {
+		return nil, fmt.Errorf("%s is larger than %d MB", header.Filename, limit>>20)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s", header.Filename)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s", header.Filename)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d MB", header.Filename, limit>>20)
+	}
+	return data, nil
+}
+
+// saveAttachment validates and stores one uploaded file as a photo or video
+func saveAttachment(header *multipart.FileHeader, subdir string) (database.ServiceRequestAttachment, error) {
+	attachment := database.ServiceRequestAttachment{OriginalName: header.Filename}
+	data, err := readUpload(header, maxVideoAttachmentBytes)
+	if err != nil {
+		return attachment, err
+	}
+
+	contentType := http.DetectContentType(data)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		if len(data) > maxFieldPhotoBytes {
+			return attachment, fmt.Errorf("%s is larger than 10 MB", header.Filename)
+		}
+		photo, err := saveFieldPhoto(subdir, data)
+		if err != nil {
+			log.Printf("Attachment %s rejected: %v", header.Filename, err)
+			return attachment, errors.New(imageRejectedMessage(header.Filename, err))
+		}
+		attachment.Kind = database.AttachmentKindPhoto
+		attachment.URL = photo.URL
+		attachment.ContentType = "image/jpeg"
+		attachment.SizeBytes = photo.SizeBytes
+	case videoExtensions[contentType] != "":
+		if len(data) > maxVideoAttachmentBytes {
+			return attachment, fmt.Errorf("%s is larger than 50 MB", header.Filename)
+		}
+		url, err := saveUploadedFile(subdir, videoExtensions[contentType], data)
+		if err != nil {
+			return attachment, err
+		}
+		attachment.Kind = database.AttachmentKindVideo
+		attachment.URL = url
+		attachment.ContentType = contentType
+		attachment.SizeBytes = int64(len(data))
+	default:
+		return attachment, fmt.Errorf("%s is not a supported photo or video (JPEG, PNG, GIF, WebP, MP4 or WebM)", header.Filename)
+	}
+	return attachment, nil
+}
+
+// attachFiles stores the "files" of a multipart upload against a service
+// request and responds with the new attachments
+func attachFiles(c *gin.Context, serviceRequest database.ServiceRequest) {
+	form, ok := multipartForm(c, maxAttachmentsPerUpload*maxVideoAttachmentBytes+multipartOverhead)
+	if !ok {
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `At least one file is required in "files"`})
+		return
+	}
+	if len(files) > maxAttachmentsPerUpload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d files can be uploaded at once", maxAttachmentsPerUpload)})
+		return
+	}
+
+	var existing int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequestAttachment{}).
+		Where("service_request_id = ?", serviceRequest.ID).Count(&existing).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if int(existing)+len(files) > maxAttachmentsPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A service request can have at most %d attachments", maxAttachmentsPerRequest)})
+		return
+	}
+
+	subdir := fmt.Sprintf("service-requests/%d", serviceRequest.ID)
+	var attachments []database.ServiceRequestAttachment
+	removeSaved := func() {
+		for _, attachment := range attachments {
+			removeUploadedFiles(attachment.URL)
+		}
+	}
+	for _, header := range files {
+		attachment, err := saveAttachment(header, subdir)
+		if err != nil {
+			removeSaved()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		attachment.ServiceRequestID = serviceRequest.ID
+		attachment.UploadedBy = c.GetUint("user_id")
+		attachment.UploaderRole = c.GetString("role")
+		attachments = append(attachments, attachment)
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&attachments).Error; err != nil {
+		removeSaved()
+		log.Printf("Failed to save attachments for service request %d: %v", serviceRequest.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachments"})
+		return
+	}
+	for _, attachment := range attachments {
+		if attachment.Kind == database.AttachmentKindPhoto {
+			queueImageProcessing(database.UploadPurposeServiceAttachment, attachment.ID)
+		}
+	}
+	c.JSON(http.StatusCreated, attachments)
+}
+
+// AddServiceRequestAttachments lets a customer attach photos or videos of the
+// problem to their open service request (multipart field "files")
+// POST /api/services/:id/attachments
+func AddServiceRequestAttachments(c *gin.Context) {
+	serviceRequest, ok := serviceRequestForViewer(c)
+	if !ok {
+		return
+	}
+	if serviceRequest.Status == database.ServiceStatusCompleted || serviceRequest.Status == database.ServiceStatusCancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot add attachments to a %s service request", serviceRequest.Status)})
+		return
+	}
+	attachFiles(c, serviceRequest)
+}
+
+// AddAgentJobAttachments lets the assigned agent attach proof of the work to
+// a job they have started or completed (multipart field "files")
+// POST /api/agent/service-requests/:id/attachments
+func AddAgentJobAttachments(c *gin.Context) {
+	serviceRequest, ok := agentJobForRequest(c)
+	if !ok {
+		return
+	}
+	if serviceRequest.Status != database.ServiceStatusInProgress && serviceRequest.Status != database.ServiceStatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Proof can be attached once you have checked in to the job"})
+		return
+	}
+	attachFiles(c, serviceRequest)
+}
+
+// GetServiceRequestAttachments lists a service request's attachments
+// GET /api/services/:id/attachments
+func GetServiceRequestAttachments(c *gin.Context) {
+	serviceRequest, ok := serviceRequestForViewer(c)
+	if !ok {
+		return
+	}
+
+	var attachments []database.ServiceRequestAttachment
+	if err := database.DB.WithContext(c.Request.Context()).Where("service_request_id = ?", serviceRequest.ID).
+		Order("id").Find(&attachments).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+		return
+	}
+	c.JSON(http.StatusOK, attachments)
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// auditChange is the before/after value of a single field
+type auditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// recordAudit stores an audit entry for a privileged write. before and after are
+// snapshots of the entity (structs or maps, either may be nil); after may hold only
+// the fields that were changed. Only the top-level fields that differ are kept.
+// Failures are logged and never fail the request.
+func recordAudit(c *gin.Context, db *gorm.DB, action, entityType string, entityID uint, before, after interface{}) {
+	if err := writeAudit(c, db, action, entityType, entityID, before, after); err != nil {
+		log.Printf("Failed to write audit log for %s: %v", action, err)
+	}
+}
+
+// writeAudit is recordAudit for writes that must not happen unaudited: it
+// returns the failure, so writing the entry in the change's transaction
+// rolls the change back with it
+func writeAudit(c *gin.Context, db *gorm.DB, action, entityType string, entityID uint, before, after interface{}) error {
+	if db == nil {
+		db = database.DB.WithContext(c.Request.Context())
+	}
+
+	changes, err := json.Marshal(auditDiff(before, after))
+	if err != nil {
+		log.Printf("Audit diff error for %s: %v", action, err)
+		changes = []byte("{}")
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	entry := database.AuditLog{
+		UserID:     int64(c.GetUint("user_id")),
+		ActorRole:  c.GetString("role"),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   int64(entityID),
+		Changes:    string(changes),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		IP:         c.ClientIP(),
+		UserAgent:  userAgent,
+	}
+	if impersonatorID := c.GetUint("impersonator_id"); impersonatorID != 0 {
+		id := int64(impersonatorID)
+		entry.ImpersonatorID = &id
+	}
+	if apiKeyID := c.GetUint("api_key_id"); apiKeyID != 0 {
+		entry.ActorRole = "api_key"
+		entry.Description = "API key #" + strconv.FormatUint(uint64(apiKeyID), 10)
+	}
+	return db.Create(&entry).Error
+}
+
+// auditDiff compares the JSON representation of two snapshots field by field.
+// Nested objects and bookkeeping timestamps are ignored.
+func auditDiff(before, after interface{}) map[string]auditChange {
+	from := auditFields(before)
+	to := auditFields(after)
+
+	diff := map[string]auditChange{}
+	for key, value := range to {
+		if old, ok := from[key]; !ok || !reflect.DeepEqual(old, value) {
+			diff[key] = auditChange{From: from[key], To: value}
+		}
+	}
+	// A nil after snapshot means the entity was removed
+	if after == nil {
+		for key, old := range from {
+			diff[key] = auditChange{From: old}
+		}
+	}
+	return diff
+}
+
+// auditFields flattens a snapshot into its scalar top-level JSON fields
+func auditFields(snapshot interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if snapshot == nil {
+		return fields
+	}
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return fields
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return fields
+	}
+
+	for key, value := range decoded {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		switch key {
+		case "CreatedAt", "UpdatedAt", "DeletedAt", "created_at", "updated_at", "deleted_at":
+			continue
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// GetAuditLogs lists audit entries for admins
+// GET /api/admin/audit-logs?actor_id=&action=&entity_type=&entity_id=&from=&to=&page=&limit=
+func GetAuditLogs(c *gin.Context) {
+	query := database.ReadDB().WithContext(c.Request.Context()).Model(&database.AuditLog{})
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("user_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	query = dates.apply(query, "created_at")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	var logs []database.AuditLog
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&logs).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":  logs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
@@ -1,13 +1,14 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
 	"aquahome/database"
 	"aquahome/utils"
 )
@@ -30,9 +31,10 @@ type RegisterRequest struct {
 
 // LoginResponse is the structure returned after login
 type LoginResponse struct {
-	Token  string        `json:"token"`
-	User   database.User `json:"user"`
-	Expiry int64         `json:"expiry"`
+	Token        string        `json:"token"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
+	User         database.User `json:"user"`
+	Expiry       int64         `json:"expiry"`
 }
 
 // Login handles user authentication and returns a JWT token
@@ -40,13 +42,13 @@ func Login(c *gin.Context) {
 	var loginRequest LoginRequest
 
 	if err := c.ShouldBindJSON(&loginRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Find user by email
 	var user database.User
-	result := database.DB.Where("email = ?", loginRequest.Email).First(&user)
+	result := database.DB.WithContext(c.Request.Context()).Where("email = ?", loginRequest.Email).First(&user)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
@@ -66,23 +68,24 @@ func Login(c *gin.Context) {
 		}
 	}
 
-	// Generate JWT token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	token, err := utils.GenerateJWT(user.ID, user.Email, user.Role, expirationTime)
+	// Privileged accounts may still need a second factor
+	if challenged, err := twoFactorChallenge(c, user); err != nil {
+		log.Printf("Two-factor error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	} else if challenged {
+		return
+	}
+
+	// Start a session with an access token and a refresh token
+	response, err := issueSession(c, database.DB.WithContext(c.Request.Context()), user)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
 
-	// Remove sensitive information from response
-	user.PasswordHash = ""
-
-	c.JSON(http.StatusOK, LoginResponse{
-		Token:  token,
-		User:   user,
-		Expiry: expirationTime.Unix(),
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 // Register handles user registration
@@ -90,13 +93,13 @@ func Register(c *gin.Context) {
 	var registerRequest RegisterRequest
 
 	if err := c.ShouldBindJSON(&registerRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Check if email already exists
 	var count int64
-	database.DB.Model(&database.User{}).Where("email = ?", registerRequest.Email).Count(&count)
+	database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Where("email = ?", registerRequest.Email).Count(&count)
 
 	if count > 0 {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
@@ -121,7 +124,7 @@ func Register(c *gin.Context) {
 		Address:      registerRequest.Address,
 	}
 
-	result := database.DB.Create(&user)
+	result := database.DB.WithContext(c.Request.Context()).Create(&user)
 
 	if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
@@ -129,53 +132,43 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	token, err := utils.GenerateJWT(user.ID, registerRequest.Email, registerRequest.Role, expirationTime)
+	if err := sendEmailVerification(database.DB.WithContext(c.Request.Context()), user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Start a session with an access token and a refresh token
+	response, err := issueSession(c, database.DB.WithContext(c.Request.Context()), user)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, LoginResponse{
-		Token:  token,
-		User:   user,
-		Expiry: expirationTime.Unix(),
-	})
+	c.JSON(http.StatusCreated, response)
 }
 
-// RefreshToken refreshes the JWT token
+// RefreshToken exchanges a refresh token for a new access token. The refresh
+// token is rotated on every use.
 func RefreshToken(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	var request RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("refresh_token is required"))
 		return
 	}
 
-	email, exists := c.Get("email")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	role, exists := c.Get("role")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	// Generate new JWT token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	token, err := utils.GenerateJWT(userID.(uint), email.(string), role.(string), expirationTime)
+	response, err := rotateSession(c, request.RefreshToken)
 	if err != nil {
-		log.Printf("Error generating token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		switch {
+		case errors.Is(err, errRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token was already used, please log in again"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		default:
+			log.Printf("Error refreshing session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":  token,
-		"expiry": expirationTime.Unix(),
-	})
+	c.JSON(http.StatusOK, response)
 }
@@ -2,14 +2,16 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
+	"aquahome/config"
 	"aquahome/database"
 	"aquahome/utils"
 )
@@ -35,13 +37,13 @@ type RegisterRequestNew struct {
 func LoginNew(c *gin.Context) {
 	var loginRequest LoginRequest
 	if err := c.ShouldBindJSON(&loginRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Find user by email
 	var user database.User
-	err := database.DB.Where("email = ?", loginRequest.Email).First(&user).Error
+	err := database.DB.WithContext(c.Request.Context()).Where("email = ?", loginRequest.Email).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
@@ -58,10 +60,17 @@ func LoginNew(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	expiryTime := time.Now().Add(24 * time.Hour)
-	token, err := utils.GenerateJWT(user.ID, user.Email, strings.ToLower(user.Role), expiryTime)
+	// Privileged accounts may still need a second factor
+	if challenged, err := twoFactorChallenge(c, user); err != nil {
+		log.Printf("Two-factor error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	} else if challenged {
+		return
+	}
 
+	// Start a session with an access token and a refresh token
+	response, err := issueSession(c, database.DB.WithContext(c.Request.Context()), user)
 	if err != nil {
 		log.Printf("JWT error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -69,33 +78,25 @@ func LoginNew(c *gin.Context) {
 	}
 
 	// Update last login time
-	if err := database.DB.Model(&user).Update("last_login", time.Now()).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Update("last_login", time.Now()).Error; err != nil {
 		log.Printf("Warning: Failed to update last login time: %v", err)
 		// Continue despite this error
 	}
 
-	// Remove sensitive fields from response
-	user.Password = ""
-	user.PasswordHash = ""
-
-	c.JSON(http.StatusOK, LoginResponse{
-		Token:  token,
-		User:   user,
-		Expiry: expiryTime.Unix(),
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 // RegisterNew handles user registration using GORM
 func RegisterNew(c *gin.Context) {
 	var registerRequest RegisterRequestNew
 	if err := c.ShouldBindJSON(&registerRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Check if email already exists
 	var existingUser database.User
-	err := database.DB.Where("email = ?", registerRequest.Email).First(&existingUser).Error
+	err := database.DB.WithContext(c.Request.Context()).Where("email = ?", registerRequest.Email).First(&existingUser).Error
 	if err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email already in use"})
 		return
@@ -144,9 +145,10 @@ func RegisterNew(c *gin.Context) {
 		//CreatedAt:    time.Now(),
 		//UpdatedAt:    time.Now(),
 	}
+	geocodeUser(&user)
 
 	// Start transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -197,14 +199,12 @@ func RegisterNew(c *gin.Context) {
 
 	// Create a welcome notification
 	notification := database.Notification{
-		UserID:  user.ID,
-		Title:   "Welcome to AquaHome",
-		Message: "Thank you for registering with AquaHome! We're excited to have you with us.",
-		Type:    "welcome",
-		IsRead:  false,
+		UserID: user.ID,
+		Type:   "welcome",
+		IsRead: false,
 		//CreatedAt: time.Now(),
 		//UpdatedAt: time.Now(),
-	}
+	}.Rendered(tx, "user.welcome", nil)
 
 	if err := tx.Create(&notification).Error; err != nil {
 		tx.Rollback()
@@ -220,25 +220,19 @@ func RegisterNew(c *gin.Context) {
 		return
 	}
 
-	// Generate token for the new user
-	expiryTime := time.Now().Add(24 * time.Hour)
-	token, err := utils.GenerateJWT(user.ID, user.Email, strings.ToLower(user.Role), expiryTime)
+	if err := sendEmailVerification(database.DB.WithContext(c.Request.Context()), user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
 
+	// Start a session for the new user
+	response, err := issueSession(c, database.DB.WithContext(c.Request.Context()), user)
 	if err != nil {
 		log.Printf("JWT error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User created but failed to generate token"})
 		return
 	}
 
-	// Return the user with token
-	user.Password = ""
-	user.PasswordHash = ""
-
-	c.JSON(http.StatusCreated, LoginResponse{
-		Token:  token,
-		User:   user,
-		Expiry: expiryTime.Unix(),
-	})
+	c.JSON(http.StatusCreated, response)
 }
 
 // RefreshTokenNew generates a new token for a logged in user using GORM
@@ -257,9 +251,14 @@ func RefreshTokenNew(c *gin.Context) {
 		return
 	}
 
-	// Generate a new token
+	// Generate a new token, keeping it bound to the caller's session so that
+	// logging out still invalidates it
 	expiryTime := time.Now().Add(24 * time.Hour)
-	token, err := utils.GenerateJWT(userIDUint, email.(string), role.(string), expiryTime)
+	sessionID := c.GetUint("session_id")
+	if sessionID != 0 {
+		expiryTime = time.Now().Add(time.Duration(config.AppConfig.AccessTokenMinutes) * time.Minute)
+	}
+	token, err := utils.GenerateSessionJWT(userIDUint, email.(string), role.(string), sessionID, expiryTime)
 	if err != nil {
 		log.Printf("JWT error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -272,24 +271,34 @@ func RefreshTokenNew(c *gin.Context) {
 	})
 }
 
-// ForgotPasswordNew sends a password reset token to user's email using GORM
+// Password reset settings
+const (
+	passwordResetTTL         = 15 * time.Minute
+	passwordResetMaxPerUser  = 3 // reset emails per user within passwordResetTTL
+	passwordResetMaxAttempts = 5 // wrong OTP guesses before a reset request is burned
+)
+
+// passwordResetMessage is returned whether or not the email exists, to avoid enumeration
+const passwordResetMessage = "If your email is registered, you will receive a password reset code"
+
+// ForgotPasswordNew emails a single-use reset link and OTP to the user
 func ForgotPasswordNew(c *gin.Context) {
 	var request struct {
 		Email string `json:"email" binding:"required,email"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Find the user
 	var user database.User
-	err := database.DB.Where("email = ?", request.Email).First(&user).Error
+	err := database.DB.WithContext(c.Request.Context()).Where("email = ?", request.Email).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			// Don't reveal if the email exists or not for security
-			c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you will receive a password reset link"})
+			c.JSON(http.StatusOK, gin.H{"message": passwordResetMessage})
 		} else {
 			log.Printf("Database error: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -297,54 +306,135 @@ func ForgotPasswordNew(c *gin.Context) {
 		return
 	}
 
-	// Generate a reset token
-	resetToken := utils.GenerateResetToken()
-	expiryTime := time.Now().Add(30 * time.Minute)
+	// Limit reset emails per account; the response stays the same
+	var recent int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-passwordResetTTL)).
+		Count(&recent)
+	if recent >= passwordResetMaxPerUser {
+		log.Printf("Password reset limit reached for user %d", user.ID)
+		c.JSON(http.StatusOK, gin.H{"message": passwordResetMessage})
+		return
+	}
 
-	// Store the reset token in database
-	resetRequest := database.PasswordReset{
-		UserID:    user.ID,
-		Token:     resetToken,
-		ExpiresAt: expiryTime,
-		//CreatedAt: time.Now(),
+	// Generate the link token and OTP
+	resetToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("Reset token generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+		return
+	}
+	otp, err := utils.GenerateNumericOTP(6)
+	if err != nil {
+		log.Printf("OTP generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+		return
 	}
 
-	if err := database.DB.Create(&resetRequest).Error; err != nil {
+	resetRequest := database.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(resetToken),
+		OTPHash:   utils.HashToken(otp),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+		RequestIP: c.ClientIP(),
+	}
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Only the newest reset request stays valid
+		if err := tx.Model(&database.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&resetRequest).Error
+	})
+	if err != nil {
 		log.Printf("Reset token creation error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
 		return
 	}
 
-	// In a real application, send an email with the reset token/link
-	// For now, just return the token (would be security issue in production)
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Password reset link has been sent to your email",
-		"token":   resetToken, // In production, remove this and only send via email
-	})
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppConfig.AppBaseURL, resetToken)
+	body := fmt.Sprintf("Hi %s,\n\nUse the code %s or open the link below to reset your AquaHome password. "+
+		"Both expire in %d minutes and can be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.",
+		user.Name, otp, int(passwordResetTTL.Minutes()), link)
+	if err := utils.SendEmail(user.Email, "Reset your AquaHome password", body); err != nil {
+		log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": passwordResetMessage})
 }
 
-// ResetPasswordNew resets the user's password using a token with GORM
+// ResetPasswordNew resets the user's password using the emailed link token,
+// or the email address and OTP
 func ResetPasswordNew(c *gin.Context) {
 	var request struct {
-		Token       string `json:"token" binding:"required"`
+		Token       string `json:"token"`
+		Email       string `json:"email"`
+		OTP         string `json:"otp"`
 		NewPassword string `json:"new_password" binding:"required,min=6"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
-	// Find the reset token
-	var resetRequest database.PasswordReset
-	err := database.DB.Where("token = ? AND expires_at > ?", request.Token, time.Now()).First(&resetRequest).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
-		} else {
-			log.Printf("Database error: %v", err)
+	// Find the reset request
+	var resetRequest database.PasswordResetToken
+	switch {
+	case request.Token != "":
+		err := database.DB.WithContext(c.Request.Context()).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(request.Token), time.Now()).
+			First(&resetRequest).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			} else {
+				log.Printf("Database error: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			}
+			return
+		}
+	case request.Email != "" && request.OTP != "":
+		err := database.DB.WithContext(c.Request.Context()).Joins("JOIN users ON users.id = password_reset_tokens.user_id").
+			Where("users.email = ? AND password_reset_tokens.used_at IS NULL AND password_reset_tokens.expires_at > ?", request.Email, time.Now()).
+			Order("password_reset_tokens.created_at DESC").
+			First(&resetRequest).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+			} else {
+				log.Printf("Database error: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			}
+			return
+		}
+
+		// Take a guess off the request before comparing, so parallel guesses
+		// can't get past the limit
+		result := database.DB.WithContext(c.Request.Context()).Model(&database.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL AND attempts < ?", resetRequest.ID, passwordResetMaxAttempts).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		if result.Error != nil {
+			log.Printf("Database error: %v", result.Error)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+
+		if !utils.TokensEqual(resetRequest.OTPHash, utils.HashToken(request.OTP)) {
+			// The last wrong guess burns the request, emailed link included
+			database.DB.WithContext(c.Request.Context()).Model(&database.PasswordResetToken{}).
+				Where("id = ? AND used_at IS NULL AND attempts >= ?", resetRequest.ID, passwordResetMaxAttempts).
+				Update("used_at", time.Now())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+			return
 		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either token, or email and otp"})
 		return
 	}
 
@@ -356,34 +446,33 @@ func ResetPasswordNew(c *gin.Context) {
 		return
 	}
 
-	// Start transaction
-	tx := database.DB.Begin()
-	if tx.Error != nil {
-		log.Printf("Transaction error: %v", tx.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
-		return
-	}
-
-	// Update the user's password
-	if err := tx.Model(&database.User{}).Where("id = ?", resetRequest.UserID).Update("password_hash", hashedPassword).Error; err != nil {
-		tx.Rollback()
-		log.Printf("Password update error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
-		return
-	}
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Claim the reset request so it can't be used twice
+		result := tx.Model(&database.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetRequest.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
 
-	// Delete used reset token
-	if err := tx.Delete(&resetRequest).Error; err != nil {
-		tx.Rollback()
-		log.Printf("Token deletion error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete password reset"})
-		return
-	}
+		// Update the user's password
+		if err := tx.Model(&database.User{}).Where("id = ?", resetRequest.UserID).Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Transaction commit error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		// Sign out everywhere after a password change
+		return revokeUserSessions(tx, resetRequest.UserID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		log.Printf("Password reset error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Avatars are stored as one square JPEG
+const (
+	avatarSize     = 256
+	maxAvatarBytes = 5 << 20
+	avatarsSubdir  = "avatars"
+)
+
+// isAvatarUpload reports whether url is an avatar stored by UploadAvatar, as
+// opposed to a picture URL set on the profile
+func isAvatarUpload(url string) bool {
+	return strings.HasPrefix(url, uploadsURLPrefix+"/"+avatarsSubdir+"/")
+}
+
+// saveAvatar crops an uploaded image to a square and stores it as a JPEG
+func saveAvatar(data []byte) (string, error) {
+	decoded, _, err := utils.DecodeImage(data)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(uploadsDir(), avatarsSubdir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	token, err := utils.GenerateSecureToken(12)
+	if err != nil {
+		return "", err
+	}
+	name := token + ".jpg"
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	url := path.Join(uploadsURLPrefix, avatarsSubdir, name)
+	err = utils.EncodeJPEG(file, utils.CropSquare(decoded, avatarSize))
+	file.Close()
+	if err != nil {
+		removeUploadedFiles(url)
+		return "", err
+	}
+	return url, nil
+}
+
+// UploadAvatar sets the signed-in user's profile photo from the multipart
+// "avatar" field, replacing any earlier one
+// POST /api/users/me/avatar
+func UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarBytes+multipartOverhead)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		apperror.Respond(c, apperror.BadRequest(`A photo is required in "avatar"`))
+		return
+	}
+	data, err := readUpload(header, maxAvatarBytes)
+	if err != nil {
+		apperror.Respond(c, apperror.BadRequest(err.Error()))
+		return
+	}
+	url, err := saveAvatar(data)
+	if err != nil {
+		log.Printf("Avatar %s rejected: %v", header.Filename, err)
+		apperror.Respond(c, apperror.BadRequest(imageRejectedMessage(header.Filename, err)))
+		return
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, c.GetUint("user_id")).Error; err != nil {
+		removeUploadedFiles(url)
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	previous := user.ProfilePicture
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Update("profile_picture", url).Error; err != nil {
+		removeUploadedFiles(url)
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to update profile photo"))
+		return
+	}
+	if isAvatarUpload(previous) {
+		removeUploadedFiles(previous)
+	}
+
+	c.JSON(http.StatusOK, user)
+}
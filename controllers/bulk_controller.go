@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// BulkOrderStatusRequest moves many orders to the same status
+type BulkOrderStatusRequest struct {
+	OrderIDs []uint `json:"order_ids" binding:"required,min=1,max=200,dive,gt=0"`
+	Status   string `json:"status" binding:"required,oneof=pending confirmed approved rejected in_transit delivered installed cancelled completed"`
+	Notes    string `json:"notes"`
+}
+
+// BulkAssignRequest assigns many service requests to one agent
+type BulkAssignRequest struct {
+	ServiceRequestIDs []uint `json:"service_request_ids" binding:"required,min=1,max=200,dive,gt=0"`
+	ServiceAgentID    uint   `json:"service_agent_id" binding:"required"`
+}
+
+// BulkItemResult is the outcome of one item of a bulk request
+type BulkItemResult struct {
+	ID      uint   `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runBulk applies fn to each ID in one transaction. Each item runs in a
+// savepoint, so a failed item is rolled back and reported while the others
+// are kept.
+func runBulk(db *gorm.DB, ids []uint, fn func(tx *gorm.DB, id uint) error) ([]BulkItemResult, error) {
+	results := make([]BulkItemResult, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			result := BulkItemResult{ID: id, Success: true}
+			if err := tx.Transaction(func(itemTx *gorm.DB) error { return fn(itemTx, id) }); err != nil {
+				result.Success = false
+				result.Error = bulkItemError(err)
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// bulkItemError is the message reported for a failed item; internal errors
+// are logged and not shown
+func bulkItemError(err error) string {
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) && appErr.Status < http.StatusInternalServerError {
+		return appErr.Message
+	}
+	log.Printf("Bulk item failed: %v", err)
+	return "Server error"
+}
+
+// respondBulk writes the per-item results with success and failure counts
+func respondBulk(c *gin.Context, results []BulkItemResult) {
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   results,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
+
+// BulkUpdateOrderStatus moves up to 200 orders to one status in a single
+// transaction, reporting success or failure per order (Admin only)
+// POST /api/admin/orders/bulk-status
+func BulkUpdateOrderStatus(c *gin.Context) {
+	var req BulkOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	actorID := c.GetUint("user_id")
+	var inTransit []database.Order
+
+	results, err := runBulk(database.DB.WithContext(c.Request.Context()), req.OrderIDs, func(tx *gorm.DB, id uint) error {
+		var order database.Order
+		if err := tx.First(&order, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.NotFound("Order not found")
+			}
+			return err
+		}
+		if order.Status == req.Status {
+			return apperror.Conflict("Order is already " + req.Status)
+		}
+		if req.Status == database.OrderStatusInstalled {
+			filed, err := hasInstallationReport(tx, order.ID)
+			if err != nil {
+				return err
+			}
+			if !filed {
+				return apperror.Conflict("An installation report is required before the order can be marked installed")
+			}
+		}
+
+		before := order
+		if err := applyOrderStatus(tx, &order, req.Status, req.Notes, actorID); err != nil {
+			return err
+		}
+		recordAudit(c, tx, "order.bulk_status", "order", order.ID, before, order)
+
+		if req.Status == database.OrderStatusInTransit {
+			inTransit = append(inTransit, order)
+		}
+		return nil
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to update orders"))
+		return
+	}
+
+	// The customer gets the code to hand the agent once the device is on its way
+	for _, order := range inTransit {
+		if err := sendInstallationOTP(database.DB.WithContext(c.Request.Context()), order); err != nil {
+			log.Printf("Failed to send installation code for order %d: %v", order.ID, err)
+		}
+	}
+
+	respondBulk(c, results)
+}
+
+// BulkAssignServiceRequests assigns up to 200 open service requests to one
+// agent in a single transaction, reporting success or failure per request
+// (Admin only)
+// POST /api/admin/service-requests/bulk-assign
+func BulkAssignServiceRequests(c *gin.Context) {
+	var req BulkAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var agent database.User
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND role = ?", req.ServiceAgentID, database.RoleServiceAgent).First(&agent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.BadRequest("Service agent not found"))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+
+	results, err := runBulk(database.DB.WithContext(c.Request.Context()), req.ServiceRequestIDs, func(tx *gorm.DB, id uint) error {
+		var serviceRequest database.ServiceRequest
+		if err := tx.First(&serviceRequest, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.NotFound("Service request not found")
+			}
+			return err
+		}
+		if serviceRequest.Status == database.ServiceStatusCompleted || serviceRequest.Status == database.ServiceStatusCancelled {
+			return apperror.Conflict("Service request is already " + serviceRequest.Status)
+		}
+
+		before := serviceRequest
+		assignedAt := time.Now()
+		serviceRequest.ServiceAgentID = &agent.ID
+		serviceRequest.AssignedAt = &assignedAt
+		serviceRequest.AcceptedAt = nil
+		if err := tx.Save(&serviceRequest).Error; err != nil {
+			return err
+		}
+		recordAudit(c, tx, "service_request.bulk_assign_agent", "service_request", serviceRequest.ID, before, serviceRequest)
+		return nil
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to assign service requests"))
+		return
+	}
+
+	respondBulk(c, results)
+}
@@ -0,0 +1,12 @@
+package controllers
+
+import (
+	"time"
+)
+
+// How long cached responses are served before being recomputed. Writes to the
+// underlying tables invalidate them sooner (see database/cache_rules.go).
+const (
+	dashboardCacheTTL = 2 * time.Minute
+	catalogCacheTTL   = 10 * time.Minute
+)
@@ -0,0 +1,447 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// CashPaymentRequest is a month's rent an agent collected in cash
+type CashPaymentRequest struct {
+	SubscriptionID uint    `json:"subscription_id" binding:"required"`
+	Amount         float64 `json:"amount" binding:"required,gt=0"`
+	Notes          string  `json:"notes" binding:"max=500"`
+}
+
+// CashDepositRequest is cash an agent paid into the franchise's bank account
+type CashDepositRequest struct {
+	Amount      float64    `json:"amount" binding:"required,gt=0"`
+	Reference   string     `json:"reference" binding:"required,max=100"`
+	DepositedAt *time.Time `json:"deposited_at"`
+	Notes       string     `json:"notes" binding:"max=500"`
+}
+
+// RejectCashPaymentRequest says why a cash payment was not accepted
+type RejectCashPaymentRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// CashReconciliationRow is one agent's cash for the reporting period
+type CashReconciliationRow struct {
+	AgentID     uint    `json:"agent_id"`
+	AgentName   string  `json:"agent_name"`
+	Payments    int64   `json:"payments"`
+	Collected   float64 `json:"collected"` // pending and approved
+	Pending     float64 `json:"pending"`
+	Approved    float64 `json:"approved"`
+	Rejected    float64 `json:"rejected"`
+	Deposited   float64 `json:"deposited"`
+	Outstanding float64 `json:"outstanding"` // collected but not yet deposited
+}
+
+// RecordCashPayment records rent an agent collected in cash. The payment
+// waits in pending_reconciliation until the franchise approves it; only then
+// does the subscription's billing move on. The amount must match what is
+// due: rent plus any late fee, less credit notes, with GST.
+// POST /api/agent/payments/cash
+func RecordCashPayment(c *gin.Context) {
+	var req CashPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	agentID := c.GetUint("user_id")
+	var subscription database.Subscription
+	query := database.DB.WithContext(c.Request.Context()).Select("id, customer_id, order_id, product_id, franchise_id, monthly_rent, status, next_billing_date, outstanding_late_fee")
+	if c.GetString("role") == database.RoleServiceAgent {
+		// Agents collect only for their own franchise's customers
+		query = query.Where("franchise_id = (?)", database.DB.WithContext(c.Request.Context()).Model(&database.User{}).
+			Select("franchise_id").Where("id = ?", agentID))
+	}
+	if err := query.First(&subscription, req.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Subscription not found"))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if subscription.Status != database.SubscriptionStatusActive && subscription.Status != database.SubscriptionStatusSuspended {
+		apperror.Respond(c, apperror.BadRequest("Subscription is not active"))
+		return
+	}
+
+	var waiting int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.Payment{}).
+		Where("subscription_id = ? AND status = ?", subscription.ID, database.PaymentStatusPendingReconciliation).
+		Count(&waiting).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if waiting > 0 {
+		apperror.Respond(c, apperror.Conflict("Cash for this subscription is already awaiting reconciliation"))
+		return
+	}
+
+	gst, err := loadGSTContext(database.DB.WithContext(c.Request.Context()), subscription.ProductID, subscription.FranchiseID, subscription.CustomerID)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to calculate tax"))
+		return
+	}
+	due := subscription.MonthlyRent + subscription.OutstandingLateFee
+	credit, err := creditForBill(database.DB.WithContext(c.Request.Context()), subscription, due)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	tax := gst.onTaxable(due - credit)
+	if math.Abs(req.Amount-tax.Total()) >= 0.01 {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Amount collected must be %.2f", tax.Total())))
+		return
+	}
+
+	orderID := subscription.OrderID
+	payment := database.Payment{
+		CustomerID:     subscription.CustomerID,
+		OrderID:        &orderID,
+		SubscriptionID: &subscription.ID,
+		Amount:         tax.Total(),
+		PaymentType:    "monthly",
+		Status:         database.PaymentStatusPendingReconciliation,
+		InvoiceNumber:  generateMonthlyInvoiceNumber(subscription.ID),
+		PaymentMethod:  "cash",
+		Notes:          req.Notes,
+		TaxBreakdown:   tax,
+		CreditApplied:  credit,
+		CollectedByID:  &agentID,
+	}
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		// The customer's receipt, so cash can't go unrecorded
+		notification := database.Notification{
+			UserID:      subscription.CustomerID,
+			Type:        "payment",
+			RelatedID:   &payment.ID,
+			RelatedType: "payment",
+		}.Rendered(tx, "payment.cash_collected", database.Vars{
+			"amount":         fmt.Sprintf("%.2f", payment.Amount),
+			"invoice_number": payment.InvoiceNumber,
+		})
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to record cash payment"))
+		return
+	}
+
+	recordAudit(c, nil, "payment.cash_collected", "payment", payment.ID, nil, payment)
+	c.JSON(http.StatusCreated, payment)
+}
+
+// RecordCashDeposit records cash an agent paid into the bank
+// POST /api/agent/payments/cash/deposits
+func RecordCashDeposit(c *gin.Context) {
+	var req CashDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var agent database.User
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, franchise_id").First(&agent, c.GetUint("user_id")).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if agent.FranchiseID == nil {
+		apperror.Respond(c, apperror.BadRequest("You are not attached to a franchise"))
+		return
+	}
+
+	deposit := database.CashDeposit{
+		FranchiseID: *agent.FranchiseID,
+		AgentID:     agent.ID,
+		Amount:      roundPaise(req.Amount),
+		DepositedAt: time.Now(),
+		Reference:   strings.TrimSpace(req.Reference),
+		Notes:       req.Notes,
+	}
+	if req.DepositedAt != nil {
+		if req.DepositedAt.After(time.Now()) {
+			apperror.Respond(c, apperror.BadRequest("deposited_at cannot be in the future"))
+			return
+		}
+		deposit.DepositedAt = *req.DepositedAt
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&deposit).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to record deposit"))
+		return
+	}
+
+	recordAudit(c, nil, "cash_deposit.create", "cash_deposit", deposit.ID, nil, deposit)
+	c.JSON(http.StatusCreated, deposit)
+}
+
+// cashPayments is the cash payments on the caller's franchises
+func cashPayments(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	query := db.Model(&database.Payment{}).
+		Joins("JOIN subscriptions ON subscriptions.id = payments.subscription_id").
+		Where("payments.payment_method = ?", "cash")
+	return scopeFranchises(c, query, "subscriptions.franchise_id")
+}
+
+// GetCashPayments lists cash payments, by default those awaiting approval
+// GET /api/franchise/cash-payments?status=&agent_id=&from=&to=
+func GetCashPayments(c *gin.Context) {
+	query, ok := cashPayments(c, database.ReadDB().WithContext(c.Request.Context()))
+	if !ok {
+		return
+	}
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", database.PaymentStatusPendingReconciliation)
+	if status != "all" {
+		query = query.Where("payments.status = ?", status)
+	}
+	if agentID := c.Query("agent_id"); agentID != "" {
+		query = query.Where("payments.collected_by_id = ?", agentID)
+	}
+
+	var payments []database.Payment
+	if err := dates.apply(query, "payments.created_at").
+		Preload("Customer", func(db *gorm.DB) *gorm.DB { return db.Select("id, name, phone") }).
+		Order("payments.created_at DESC").
+		Find(&payments).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": payments})
+}
+
+// cashPaymentForReview loads a cash payment on the caller's franchises. It
+// writes the error response and returns false on failure.
+func cashPaymentForReview(c *gin.Context) (database.Payment, bool) {
+	var payment database.Payment
+	query, ok := cashPayments(c, database.DB.WithContext(c.Request.Context()))
+	if !ok {
+		return payment, false
+	}
+	if err := query.Select("payments.*").First(&payment, "payments.id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Cash payment not found"))
+		} else {
+			apperror.Respond(c, apperror.Internal(err))
+		}
+		return payment, false
+	}
+	if payment.Status != database.PaymentStatusPendingReconciliation {
+		apperror.Respond(c, apperror.Conflict("Cash payment has already been reconciled"))
+		return payment, false
+	}
+	return payment, true
+}
+
+// markReconciled moves a cash payment out of pending_reconciliation. The
+// update is conditional on the status so two reviewers can't both apply it.
+func markReconciled(tx *gorm.DB, payment database.Payment, status, note string, reviewerID uint) error {
+	updates := map[string]interface{}{
+		"status":           status,
+		"reconciled_by_id": reviewerID,
+		"reconciled_at":    time.Now(),
+	}
+	if note != "" {
+		updates["notes"] = strings.TrimSpace(payment.Notes + "\n" + note)
+	}
+	result := tx.Model(&database.Payment{}).
+		Where("id = ? AND status = ?", payment.ID, database.PaymentStatusPendingReconciliation).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.Conflict("Cash payment has already been reconciled")
+	}
+	return nil
+}
+
+// ApproveCashPayment confirms the franchise received an agent's cash and
+// credits it to the subscription
+// POST /api/franchise/cash-payments/:id/approve
+func ApproveCashPayment(c *gin.Context) {
+	payment, ok := cashPaymentForReview(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := markReconciled(tx, payment, database.PaymentStatusSuccess, "", c.GetUint("user_id")); err != nil {
+			return err
+		}
+
+		var subscription database.Subscription
+		if err := tx.Select("id, franchise_id, order_id, monthly_rent, status, next_billing_date, outstanding_late_fee").
+			First(&subscription, *payment.SubscriptionID).Error; err != nil {
+			return err
+		}
+		if err := applyMonthlyPayment(tx, subscription, payment); err != nil {
+			return err
+		}
+
+		payment.Status = database.PaymentStatusSuccess
+		return events.Publish(tx, events.Event{
+			Name:        events.PaymentReceived,
+			EntityType:  "order",
+			EntityID:    subscription.OrderID,
+			CustomerID:  payment.CustomerID,
+			FranchiseID: subscription.FranchiseID,
+			Vars:        database.Vars{"payment_type": "Monthly"},
+			Data:        database.WebhookPaymentData(payment),
+		})
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	recordAudit(c, nil, "payment.cash_approved", "payment", payment.ID,
+		gin.H{"status": database.PaymentStatusPendingReconciliation}, gin.H{"status": database.PaymentStatusSuccess})
+	c.JSON(http.StatusOK, gin.H{"message": "Cash payment approved", "payment_id": payment.ID})
+}
+
+// RejectCashPayment marks an agent's cash payment as not received; the rent
+// stays due
+// POST /api/franchise/cash-payments/:id/reject
+func RejectCashPayment(c *gin.Context) {
+	var req RejectCashPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	payment, ok := cashPaymentForReview(c)
+	if !ok {
+		return
+	}
+
+	if err := markReconciled(database.DB.WithContext(c.Request.Context()), payment, database.PaymentStatusFailed,
+		"Rejected: "+req.Reason, c.GetUint("user_id")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	recordAudit(c, nil, "payment.cash_rejected", "payment", payment.ID,
+		gin.H{"status": database.PaymentStatusPendingReconciliation},
+		gin.H{"status": database.PaymentStatusFailed, "reason": req.Reason})
+	c.JSON(http.StatusOK, gin.H{"message": "Cash payment rejected", "payment_id": payment.ID})
+}
+
+// GetCashReconciliation sets the cash each agent collected against what they
+// deposited, for the period given by from/to
+// GET /api/franchise/cash-reconciliation?from=&to=
+func GetCashReconciliation(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	payments, ok := cashPayments(c, database.ReadDB().WithContext(c.Request.Context()))
+	if !ok {
+		return
+	}
+	deposits, ok := scopeFranchises(c, database.ReadDB().WithContext(c.Request.Context()).Model(&database.CashDeposit{}), "cash_deposits.franchise_id")
+	if !ok {
+		return
+	}
+
+	var rows []CashReconciliationRow
+	if err := dates.apply(payments, "payments.created_at").
+		Select("payments.collected_by_id AS agent_id, COUNT(*) AS payments, "+
+			"COALESCE(SUM(payments.amount) FILTER (WHERE payments.status = ?), 0) AS pending, "+
+			"COALESCE(SUM(payments.amount) FILTER (WHERE payments.status = ?), 0) AS approved, "+
+			"COALESCE(SUM(payments.amount) FILTER (WHERE payments.status = ?), 0) AS rejected",
+			database.PaymentStatusPendingReconciliation, database.PaymentStatusSuccess, database.PaymentStatusFailed).
+		Where("payments.collected_by_id IS NOT NULL").
+		Group("payments.collected_by_id").
+		Scan(&rows).Error; err != nil {
+		log.Printf("Error computing cash collected: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute reconciliation"})
+		return
+	}
+
+	var deposited []struct {
+		AgentID uint
+		Amount  float64
+	}
+	if err := dates.apply(deposits, "cash_deposits.deposited_at").
+		Select("cash_deposits.agent_id, SUM(cash_deposits.amount) AS amount").
+		Group("cash_deposits.agent_id").
+		Scan(&deposited).Error; err != nil {
+		log.Printf("Error computing cash deposited: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute reconciliation"})
+		return
+	}
+
+	depositedBy := make(map[uint]float64, len(deposited))
+	for _, d := range deposited {
+		depositedBy[d.AgentID] = roundPaise(d.Amount)
+	}
+	for i := range rows {
+		rows[i].Deposited = depositedBy[rows[i].AgentID]
+		delete(depositedBy, rows[i].AgentID)
+	}
+	// Agents who only deposited in the period still owe an explanation
+	for agentID, amount := range depositedBy {
+		rows = append(rows, CashReconciliationRow{AgentID: agentID, Deposited: amount})
+	}
+
+	agentIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		agentIDs = append(agentIDs, row.AgentID)
+	}
+	names := map[uint]string{}
+	if len(agentIDs) > 0 {
+		var agents []database.User
+		database.ReadDB().WithContext(c.Request.Context()).Select("id, name").Where("id IN ?", agentIDs).Find(&agents)
+		for _, a := range agents {
+			names[a.ID] = a.Name
+		}
+	}
+
+	var totals CashReconciliationRow
+	for i := range rows {
+		row := &rows[i]
+		row.AgentName = names[row.AgentID]
+		row.Collected = roundPaise(row.Pending + row.Approved)
+		row.Outstanding = roundPaise(row.Collected - row.Deposited)
+		totals.Payments += row.Payments
+		totals.Collected += row.Collected
+		totals.Pending += row.Pending
+		totals.Approved += row.Approved
+		totals.Rejected += row.Rejected
+		totals.Deposited += row.Deposited
+	}
+	totals.Collected = roundPaise(totals.Collected)
+	totals.Deposited = roundPaise(totals.Deposited)
+	totals.Outstanding = roundPaise(totals.Collected - totals.Deposited)
+
+	c.JSON(http.StatusOK, gin.H{
+		"agents": rows,
+		"totals": totals,
+	})
+}
@@ -0,0 +1,408 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// ProductVariantRequest contains the data for variant creation or update
+type ProductVariantRequest struct {
+	Name           string `json:"name" binding:"required"`
+	SKU            string `json:"sku"`
+	Description    string `json:"description"`
+	Specifications string `json:"specifications"`
+	IsActive       bool   `json:"is_active"`
+}
+
+// RentalPlanRequest contains the data for rental plan creation or update
+type RentalPlanRequest struct {
+	Name              string  `json:"name" binding:"required"`
+	Description       string  `json:"description"`
+	VariantID         *uint   `json:"variant_id"`
+	MinDurationMonths int     `json:"min_duration_months" binding:"min=0"`
+	DurationMonths    int     `json:"duration_months" binding:"min=0"`
+	MonthlyRent       float64 `json:"monthly_rent" binding:"required,gt=0"`
+	SecurityDeposit   float64 `json:"security_deposit" binding:"min=0"`
+	InstallationFee   float64 `json:"installation_fee" binding:"min=0"`
+	ServicesPerYear   int     `json:"services_per_year" binding:"min=0,max=12"`
+	SortOrder         int     `json:"sort_order"`
+	IsActive          bool    `json:"is_active"`
+}
+
+// pricing is the resolved price of a product for an order
+type pricing struct {
+	VariantID       *uint
+	PlanID          *uint
+	Terms           *database.PlanTerms // snapshot of the chosen plan
+	MonthlyRent     float64
+	SecurityDeposit float64
+	InstallationFee float64
+}
+
+// initialAmount returns the amount payable upfront for the given rental duration
+func (p pricing) initialAmount(duration int) float64 {
+	return p.SecurityDeposit + p.InstallationFee + p.MonthlyRent*float64(duration)
+}
+
+var (
+	errInvalidVariant  = errors.New("variant is not available for this product")
+	errInvalidPlan     = errors.New("rental plan is not available for this product")
+	errPlanMinDuration = errors.New("rental duration is shorter than the plan minimum")
+	errPlanDuration    = errors.New("rental duration must match the plan term")
+)
+
+// resolvePricing prices an order for product from the chosen plan, falling
+// back to the product's own prices when no plan is given.
+func resolvePricing(db *gorm.DB, product database.Product, variantID, planID *uint, duration int) (pricing, error) {
+	price := pricing{
+		MonthlyRent:     product.MonthlyRent,
+		SecurityDeposit: product.SecurityDeposit,
+		InstallationFee: product.InstallationFee,
+	}
+
+	if variantID != nil {
+		var variant database.ProductVariant
+		if err := db.Where("id = ? AND product_id = ? AND is_active = ?", *variantID, product.ID, true).
+			First(&variant).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return price, errInvalidVariant
+			}
+			return price, err
+		}
+		price.VariantID = &variant.ID
+	}
+
+	if planID != nil {
+		var plan database.RentalPlan
+		if err := db.Where("id = ? AND product_id = ? AND is_active = ?", *planID, product.ID, true).
+			First(&plan).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return price, errInvalidPlan
+			}
+			return price, err
+		}
+		if plan.VariantID != nil && (variantID == nil || *plan.VariantID != *variantID) {
+			return price, errInvalidPlan
+		}
+		if duration < plan.MinDurationMonths {
+			return price, errPlanMinDuration
+		}
+		if plan.DurationMonths > 0 && duration != plan.DurationMonths {
+			return price, errPlanDuration
+		}
+		terms := plan.Terms(duration)
+		price.PlanID = &plan.ID
+		price.Terms = &terms
+		price.MonthlyRent = plan.MonthlyRent
+		price.SecurityDeposit = plan.SecurityDeposit
+		price.InstallationFee = plan.InstallationFee
+	}
+
+	return price, nil
+}
+
+// isPricingError reports whether err came from validating the customer's choice
+func isPricingError(err error) bool {
+	return errors.Is(err, errInvalidVariant) || errors.Is(err, errInvalidPlan) ||
+		errors.Is(err, errPlanMinDuration) || errors.Is(err, errPlanDuration)
+}
+
+// preloadActiveCatalog loads a product's active variants and plans and its image gallery
+func preloadActiveCatalog(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Images", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position, id")
+		}).
+		Preload("Variants", "is_active = ?", true).
+		Preload("Plans", func(db *gorm.DB) *gorm.DB {
+			return db.Where("is_active = ?", true).Order("sort_order, monthly_rent")
+		})
+}
+
+// catalogProduct loads the product named by the :id path parameter
+func catalogProduct(c *gin.Context) (database.Product, bool) {
+	var product database.Product
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return product, false
+	}
+	if err := database.DB.WithContext(c.Request.Context()).First(&product, uint(productID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return product, false
+	}
+	return product, true
+}
+
+// GetProductVariants lists all variants of a product, including inactive ones (Admin only)
+func GetProductVariants(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var variants []database.ProductVariant
+	if err := database.DB.WithContext(c.Request.Context()).Where("product_id = ?", product.ID).Order("id").Find(&variants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch variants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, variants)
+}
+
+// CreateProductVariant adds a variant to a product (Admin only)
+func CreateProductVariant(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var req ProductVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	variant := database.ProductVariant{
+		ProductID:      product.ID,
+		Name:           req.Name,
+		SKU:            req.SKU,
+		Description:    req.Description,
+		Specifications: req.Specifications,
+		IsActive:       req.IsActive,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&variant).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating variant"})
+		return
+	}
+
+	recordAudit(c, nil, "product_variant.create", "product_variant", variant.ID, nil, variant)
+	c.JSON(http.StatusCreated, variant)
+}
+
+// UpdateProductVariant updates a variant of a product (Admin only)
+func UpdateProductVariant(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var req ProductVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var variant database.ProductVariant
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND product_id = ?", c.Param("variant_id"), product.ID).First(&variant).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	before := variant
+	variant.Name = req.Name
+	variant.SKU = req.SKU
+	variant.Description = req.Description
+	variant.Specifications = req.Specifications
+	variant.IsActive = req.IsActive
+	if err := database.DB.WithContext(c.Request.Context()).Save(&variant).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating variant"})
+		return
+	}
+
+	recordAudit(c, nil, "product_variant.update", "product_variant", variant.ID, before, variant)
+	c.JSON(http.StatusOK, variant)
+}
+
+// DeleteProductVariant archives a variant so it can no longer be ordered (Admin only)
+func DeleteProductVariant(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var variant database.ProductVariant
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND product_id = ?", c.Param("variant_id"), product.ID).First(&variant).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Plans tied to this variant cannot be ordered without it
+		if err := tx.Where("variant_id = ?", variant.ID).Delete(&database.RentalPlan{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&variant).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting variant"})
+		return
+	}
+
+	recordAudit(c, nil, "product_variant.delete", "product_variant", variant.ID, gin.H{"deleted": false}, gin.H{"deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "Variant archived"})
+}
+
+// GetRentalPlans lists all rental plans of a product, including inactive ones (Admin only)
+func GetRentalPlans(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var plans []database.RentalPlan
+	if err := database.DB.WithContext(c.Request.Context()).Where("product_id = ?", product.ID).Order("sort_order, monthly_rent").Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rental plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plans)
+}
+
+// validPlanVariant checks that a plan's variant belongs to the product
+func validPlanVariant(db *gorm.DB, productID uint, variantID *uint) bool {
+	if variantID == nil {
+		return true
+	}
+	var count int64
+	db.Model(&database.ProductVariant{}).Where("id = ? AND product_id = ?", *variantID, productID).Count(&count)
+	return count > 0
+}
+
+// validPlanRequest checks a plan's variant and term, writing the error
+// response when they are invalid
+func validPlanRequest(c *gin.Context, productID uint, req RentalPlanRequest) bool {
+	if !validPlanVariant(database.DB.WithContext(c.Request.Context()), productID, req.VariantID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return false
+	}
+	if req.DurationMonths > 0 && req.DurationMonths < req.MinDurationMonths {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_months must not be shorter than min_duration_months"})
+		return false
+	}
+	return true
+}
+
+// CreateRentalPlan adds a pricing tier to a product (Admin only)
+func CreateRentalPlan(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var req RentalPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validPlanRequest(c, product.ID, req) {
+		return
+	}
+
+	plan := database.RentalPlan{
+		ProductID:         product.ID,
+		VariantID:         req.VariantID,
+		Name:              req.Name,
+		Description:       req.Description,
+		MinDurationMonths: req.MinDurationMonths,
+		DurationMonths:    req.DurationMonths,
+		MonthlyRent:       req.MonthlyRent,
+		SecurityDeposit:   req.SecurityDeposit,
+		InstallationFee:   req.InstallationFee,
+		ServicesPerYear:   req.ServicesPerYear,
+		SortOrder:         req.SortOrder,
+		IsActive:          req.IsActive,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&plan).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating rental plan"})
+		return
+	}
+
+	recordAudit(c, nil, "rental_plan.create", "rental_plan", plan.ID, nil, plan)
+	c.JSON(http.StatusCreated, plan)
+}
+
+// UpdateRentalPlan updates a pricing tier. Existing orders keep the terms
+// they were placed with in Order.PlanTerms. (Admin only)
+func UpdateRentalPlan(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var req RentalPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validPlanRequest(c, product.ID, req) {
+		return
+	}
+
+	var plan database.RentalPlan
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND product_id = ?", c.Param("plan_id"), product.ID).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rental plan not found"})
+		return
+	}
+
+	before := plan
+	plan.VariantID = req.VariantID
+	plan.Name = req.Name
+	plan.Description = req.Description
+	plan.MinDurationMonths = req.MinDurationMonths
+	plan.DurationMonths = req.DurationMonths
+	plan.MonthlyRent = req.MonthlyRent
+	plan.SecurityDeposit = req.SecurityDeposit
+	plan.InstallationFee = req.InstallationFee
+	plan.ServicesPerYear = req.ServicesPerYear
+	plan.SortOrder = req.SortOrder
+	plan.IsActive = req.IsActive
+	if err := database.DB.WithContext(c.Request.Context()).Save(&plan).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating rental plan"})
+		return
+	}
+
+	recordAudit(c, nil, "rental_plan.update", "rental_plan", plan.ID, before, plan)
+	c.JSON(http.StatusOK, plan)
+}
+
+// DeleteRentalPlan archives a pricing tier so it can no longer be ordered (Admin only)
+func DeleteRentalPlan(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var plan database.RentalPlan
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND product_id = ?", c.Param("plan_id"), product.ID).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rental plan not found"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&plan).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting rental plan"})
+		return
+	}
+
+	recordAudit(c, nil, "rental_plan.delete", "rental_plan", plan.ID, gin.H{"deleted": false}, gin.H{"deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "Rental plan archived"})
+}
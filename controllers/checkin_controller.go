@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// CheckInRequest carries the agent's position when arriving at or leaving a job
+type CheckInRequest struct {
+	Latitude  float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// AgentAttendance summarises one agent's on-site time for a day
+type AgentAttendance struct {
+	AgentID        uint       `json:"agent_id"`
+	AgentName      string     `json:"agent_name"`
+	AgentPicture   string     `json:"agent_profile_picture"`
+	JobsCheckedIn  int        `json:"jobs_checked_in"`
+	JobsCheckedOut int        `json:"jobs_checked_out"`
+	FirstCheckIn   *time.Time `json:"first_check_in"`
+	LastCheckOut   *time.Time `json:"last_check_out"`
+	OnSiteMinutes  int        `json:"on_site_minutes"`
+}
+
+// agentJobForRequest loads the service request named by :id if it is assigned
+// to the calling agent
+func agentJobForRequest(c *gin.Context) (database.ServiceRequest, bool) {
+	var serviceRequest database.ServiceRequest
+	err := database.DB.WithContext(c.Request.Context()).Preload("Customer").
+		Where("id = ? AND service_agent_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&serviceRequest).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found or not assigned to you"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return serviceRequest, false
+	}
+	return serviceRequest, true
+}
+
+// CheckInToJob records the agent's arrival at the customer's location and
+// starts the job
+// POST /api/agent/service-requests/:id/check-in
+func CheckInToJob(c *gin.Context) {
+	var req CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("latitude and longitude are required"))
+		return
+	}
+
+	serviceRequest, ok := agentJobForRequest(c)
+	if !ok {
+		return
+	}
+	if serviceRequest.CheckInAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already checked in to this job"})
+		return
+	}
+	if serviceRequest.Status != database.ServiceStatusAssigned && serviceRequest.Status != database.ServiceStatusScheduled {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot check in to a %s job", serviceRequest.Status)})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"check_in_at":        time.Now(),
+		"check_in_latitude":  req.Latitude,
+		"check_in_longitude": req.Longitude,
+		"status":             database.ServiceStatusInProgress,
+	}
+	customer := serviceRequest.Customer
+	var distance *float64
+	if utils.HasCoordinates(customer.Latitude, customer.Longitude) {
+		meters := math.Round(utils.HaversineKm(req.Latitude, req.Longitude, customer.Latitude, customer.Longitude) * 1000)
+		if radius := float64(config.AppConfig.CheckInRadiusMeters); meters > radius {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":      fmt.Sprintf("You are %.0f m from the customer; check in within %.0f m of their location", meters, radius),
+				"distance_m": meters,
+			})
+			return
+		}
+		distance = &meters
+		updates["check_in_distance_m"] = meters
+	}
+
+	result := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
+		Where("id = ? AND check_in_at IS NULL", serviceRequest.ID).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("Failed to check in to service request %d: %v", serviceRequest.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already checked in to this job"})
+		return
+	}
+
+	notification := database.Notification{
+		UserID:      serviceRequest.CustomerID,
+		Type:        "service_request",
+		RelatedID:   &serviceRequest.ID,
+		RelatedType: "service_request",
+	}.Rendered(database.DB.WithContext(c.Request.Context()), "service_request.agent_arrived", database.Vars{"id": serviceRequest.ID})
+	if err := database.DB.WithContext(c.Request.Context()).Create(&notification).Error; err != nil {
+		log.Printf("Failed to notify customer of check-in: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Checked in",
+		"distance_m": distance,
+	})
+}
+
+// CheckOutOfJob records the agent leaving the job site
+// POST /api/agent/service-requests/:id/check-out
+func CheckOutOfJob(c *gin.Context) {
+	var req CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("latitude and longitude are required"))
+		return
+	}
+
+	serviceRequest, ok := agentJobForRequest(c)
+	if !ok {
+		return
+	}
+	if serviceRequest.CheckInAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Check in to this job before checking out"})
+		return
+	}
+
+	now := time.Now()
+	result := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
+		Where("id = ? AND check_out_at IS NULL", serviceRequest.ID).
+		Updates(map[string]interface{}{
+			"check_out_at":        now,
+			"check_out_latitude":  req.Latitude,
+			"check_out_longitude": req.Longitude,
+		})
+	if result.Error != nil {
+		log.Printf("Failed to check out of service request %d: %v", serviceRequest.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check out"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Already checked out of this job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Checked out",
+		"on_site_minutes": int(now.Sub(*serviceRequest.CheckInAt).Minutes()),
+	})
+}
+
+// GetFranchiseAttendance summarises each agent's check-ins for a day
+// GET /api/franchise/attendance?date=2006-01-02
+func GetFranchiseAttendance(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", d, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, use YYYY-MM-DD"})
+			return
+		}
+		date = parsed
+	}
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var agents []database.User
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, name, profile_picture").
+		Where("franchise_id = ? AND role = ?", franchise.ID, database.RoleServiceAgent).
+		Order("name").Find(&agents).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch agents"})
+		return
+	}
+
+	var jobs []database.ServiceRequest
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, service_agent_id, check_in_at, check_out_at").
+		Where("franchise_id = ? AND check_in_at >= ? AND check_in_at < ?", franchise.ID, dayStart, dayEnd).
+		Find(&jobs).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-ins"})
+		return
+	}
+
+	summaries := make(map[uint]*AgentAttendance, len(agents))
+	attendance := make([]*AgentAttendance, 0, len(agents))
+	for _, agent := range agents {
+		summary := &AgentAttendance{AgentID: agent.ID, AgentName: agent.Name, AgentPicture: agent.ProfilePicture}
+		summaries[agent.ID] = summary
+		attendance = append(attendance, summary)
+	}
+	for _, job := range jobs {
+		if job.ServiceAgentID == nil {
+			continue
+		}
+		summary, ok := summaries[*job.ServiceAgentID]
+		if !ok {
+			// Agents who have since left the franchise still get their day listed
+			summary = &AgentAttendance{AgentID: *job.ServiceAgentID}
+			summaries[*job.ServiceAgentID] = summary
+			attendance = append(attendance, summary)
+		}
+		summary.JobsCheckedIn++
+		if summary.FirstCheckIn == nil || job.CheckInAt.Before(*summary.FirstCheckIn) {
+			summary.FirstCheckIn = job.CheckInAt
+		}
+		if job.CheckOutAt != nil {
+			summary.JobsCheckedOut++
+			summary.OnSiteMinutes += int(job.CheckOutAt.Sub(*job.CheckInAt).Minutes())
+			if summary.LastCheckOut == nil || job.CheckOutAt.After(*summary.LastCheckOut) {
+				summary.LastCheckOut = job.CheckOutAt
+			}
+		}
+	}
+	sort.SliceStable(attendance, func(i, j int) bool {
+		return attendance[i].JobsCheckedIn > attendance[j].JobsCheckedIn
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"franchise_id": franchise.ID,
+		"date":         dayStart.Format("2006-01-02"),
+		"agents":       attendance,
+	})
+}
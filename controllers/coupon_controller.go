@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// CouponRequest contains the data for coupon creation or update
+type CouponRequest struct {
+	Code           string     `json:"code" binding:"required,max=64"`
+	Description    string     `json:"description"`
+	DiscountType   string     `json:"discount_type" binding:"required,oneof=percent flat"`
+	DiscountValue  float64    `json:"discount_value" binding:"required,gt=0"`
+	MaxDiscount    float64    `json:"max_discount" binding:"min=0"`
+	MinOrderAmount float64    `json:"min_order_amount" binding:"min=0"`
+	UsageLimit     int        `json:"usage_limit" binding:"min=0"`
+	PerUserLimit   int        `json:"per_user_limit" binding:"min=0"`
+	StartsAt       *time.Time `json:"starts_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	ProductID      *uint      `json:"product_id"`
+	FranchiseID    *uint      `json:"franchise_id"`
+	IsActive       bool       `json:"is_active"`
+}
+
+// ValidateCouponRequest describes the order a customer wants to apply a coupon to
+type ValidateCouponRequest struct {
+	Code           string `json:"code" binding:"required"`
+	ProductID      uint   `json:"product_id" binding:"required"`
+	FranchiseID    uint   `json:"franchise_id" binding:"required"`
+	VariantID      *uint  `json:"variant_id"`
+	PlanID         *uint  `json:"plan_id"`
+	RentalDuration int    `json:"rental_duration" binding:"required,min=1"`
+}
+
+// couponError is a coupon that cannot be applied; its message is shown to the customer
+type couponError struct {
+	msg string
+}
+
+func (e *couponError) Error() string {
+	return e.msg
+}
+
+// couponHold is how long an unpaid order keeps its coupon redemption counted
+// towards usage limits; checkouts abandoned for longer give it back
+const couponHold = 30 * time.Minute
+
+// normalizeCouponCode makes coupon codes case-insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// applyCoupon checks that code may be used by the customer on this order and
+// returns the coupon with the discount it gives on amount. The coupon row is
+// locked, so checkouts in a transaction that goes on to record the redemption
+// are counted one after another and cannot overshoot the usage limits.
+func applyCoupon(db *gorm.DB, code string, customerID, productID, franchiseID uint, amount float64) (database.Coupon, float64, error) {
+	var coupon database.Coupon
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", normalizeCouponCode(code)).First(&coupon).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return coupon, 0, &couponError{"Invalid coupon code"}
+		}
+		return coupon, 0, err
+	}
+
+	now := time.Now()
+	switch {
+	case !coupon.IsActive:
+		return coupon, 0, &couponError{"This coupon is no longer available"}
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt):
+		return coupon, 0, &couponError{"This coupon is not active yet"}
+	case coupon.ExpiresAt != nil && now.After(*coupon.ExpiresAt):
+		return coupon, 0, &couponError{"This coupon has expired"}
+	case coupon.ProductID != nil && *coupon.ProductID != productID:
+		return coupon, 0, &couponError{"This coupon is not valid for this product"}
+	case coupon.FranchiseID != nil && *coupon.FranchiseID != franchiseID:
+		return coupon, 0, &couponError{"This coupon is not valid in your area"}
+	case amount < coupon.MinOrderAmount:
+		return coupon, 0, &couponError{"Order amount is below the minimum for this coupon"}
+	}
+
+	// Paid orders count, and unpaid ones only while their checkout is recent
+	redemptions := db.Model(&database.CouponRedemption{}).
+		Joins("JOIN orders ON orders.id = coupon_redemptions.order_id").
+		Where("coupon_redemptions.coupon_id = ? AND coupon_redemptions.status = ?", coupon.ID, database.RedemptionStatusApplied).
+		Where("orders.status <> ? OR coupon_redemptions.created_at > ?", database.OrderStatusPending, now.Add(-couponHold))
+	if coupon.UsageLimit > 0 {
+		var used int64
+		if err := redemptions.Session(&gorm.Session{}).Count(&used).Error; err != nil {
+			return coupon, 0, err
+		}
+		if used >= int64(coupon.UsageLimit) {
+			return coupon, 0, &couponError{"This coupon has reached its usage limit"}
+		}
+	}
+	if coupon.PerUserLimit > 0 {
+		var used int64
+		if err := redemptions.Session(&gorm.Session{}).Where("coupon_redemptions.customer_id = ?", customerID).Count(&used).Error; err != nil {
+			return coupon, 0, err
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return coupon, 0, &couponError{"You have already used this coupon"}
+		}
+	}
+
+	discount := coupon.DiscountValue
+	if coupon.DiscountType == database.CouponTypePercent {
+		discount = amount * coupon.DiscountValue / 100
+		if coupon.MaxDiscount > 0 && discount > coupon.MaxDiscount {
+			discount = coupon.MaxDiscount
+		}
+	}
+	discount = math.Min(math.Round(discount*100)/100, amount)
+	return coupon, discount, nil
+}
+
+// releaseCoupon frees the coupon redemption of a cancelled order
+func releaseCoupon(db *gorm.DB, orderID uint) error {
+	return db.Model(&database.CouponRedemption{}).
+		Where("order_id = ? AND status = ?", orderID, database.RedemptionStatusApplied).
+		Update("status", database.RedemptionStatusReleased).Error
+}
+
+// ValidateCoupon previews the discount a coupon gives on an order (Customer only)
+func ValidateCoupon(c *gin.Context) {
+	var req ValidateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var product database.Product
+	if err := database.DB.WithContext(c.Request.Context()).First(&product, req.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	price, err := resolvePricing(database.DB.WithContext(c.Request.Context()), product, req.VariantID, req.PlanID, req.RentalDuration)
+	if err != nil {
+		if isPricingError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	amount := price.initialAmount(req.RentalDuration)
+
+	coupon, discount, err := applyCoupon(database.DB.WithContext(c.Request.Context()), req.Code, c.GetUint("user_id"), product.ID, req.FranchiseID, amount)
+	var couponErr *couponError
+	if errors.As(err, &couponErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "error": couponErr.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":       true,
+		"code":        coupon.Code,
+		"description": coupon.Description,
+		"amount":      amount,
+		"discount":    discount,
+		"payable":     amount - discount,
+	})
+}
+
+// couponSummary is a coupon with its redemption totals
+type couponSummary struct {
+	database.Coupon
+	Redemptions   int64   `json:"redemptions"`
+	TotalDiscount float64 `json:"total_discount"`
+}
+
+// GetCoupons lists coupons with how often each has been redeemed (Admin only)
+func GetCoupons(c *gin.Context) {
+	query := database.DB.WithContext(c.Request.Context()).Order("id DESC")
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var coupons []database.Coupon
+	if err := query.Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+
+	var totals []struct {
+		CouponID uint
+		Count    int64
+		Total    float64
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.CouponRedemption{}).
+		Select("coupon_id, COUNT(*) AS count, COALESCE(SUM(discount_amount), 0) AS total").
+		Where("status = ?", database.RedemptionStatusApplied).
+		Group("coupon_id").Scan(&totals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon usage"})
+		return
+	}
+	byCoupon := make(map[uint]int, len(totals))
+	for i, t := range totals {
+		byCoupon[t.CouponID] = i
+	}
+
+	result := make([]couponSummary, len(coupons))
+	for i, coupon := range coupons {
+		result[i].Coupon = coupon
+		if j, ok := byCoupon[coupon.ID]; ok {
+			result[i].Redemptions = totals[j].Count
+			result[i].TotalDiscount = totals[j].Total
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// couponFromRequest copies the request fields onto coupon
+func couponFromRequest(coupon *database.Coupon, req CouponRequest) {
+	coupon.Code = normalizeCouponCode(req.Code)
+	coupon.Description = req.Description
+	coupon.DiscountType = req.DiscountType
+	coupon.DiscountValue = req.DiscountValue
+	coupon.MaxDiscount = req.MaxDiscount
+	coupon.MinOrderAmount = req.MinOrderAmount
+	coupon.UsageLimit = req.UsageLimit
+	coupon.PerUserLimit = req.PerUserLimit
+	coupon.StartsAt = req.StartsAt
+	coupon.ExpiresAt = req.ExpiresAt
+	coupon.ProductID = req.ProductID
+	coupon.FranchiseID = req.FranchiseID
+	coupon.IsActive = req.IsActive
+}
+
+// validCouponRequest writes a 400 response and returns false for inconsistent coupons
+func validCouponRequest(c *gin.Context, req CouponRequest, couponID uint) bool {
+	if req.DiscountType == database.CouponTypePercent && req.DiscountValue > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Percent discount cannot exceed 100"})
+		return false
+	}
+	if req.StartsAt != nil && req.ExpiresAt != nil && !req.ExpiresAt.After(*req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be after starts_at"})
+		return false
+	}
+
+	var count int64
+	database.DB.WithContext(c.Request.Context()).Unscoped().Model(&database.Coupon{}).
+		Where("code = ? AND id <> ?", normalizeCouponCode(req.Code), couponID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A coupon with this code already exists"})
+		return false
+	}
+	return true
+}
+
+// CreateCoupon creates a discount code (Admin only)
+func CreateCoupon(c *gin.Context) {
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validCouponRequest(c, req, 0) {
+		return
+	}
+
+	var coupon database.Coupon
+	couponFromRequest(&coupon, req)
+	if err := database.DB.WithContext(c.Request.Context()).Create(&coupon).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating coupon"})
+		return
+	}
+
+	recordAudit(c, nil, "coupon.create", "coupon", coupon.ID, nil, coupon)
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// UpdateCoupon updates a discount code. Orders already placed keep their discount. (Admin only)
+func UpdateCoupon(c *gin.Context) {
+	var coupon database.Coupon
+	if err := database.DB.WithContext(c.Request.Context()).First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validCouponRequest(c, req, coupon.ID) {
+		return
+	}
+
+	before := coupon
+	couponFromRequest(&coupon, req)
+	if err := database.DB.WithContext(c.Request.Context()).Save(&coupon).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating coupon"})
+		return
+	}
+
+	recordAudit(c, nil, "coupon.update", "coupon", coupon.ID, before, coupon)
+	c.JSON(http.StatusOK, coupon)
+}
+
+// DeleteCoupon deletes a discount code; its redemption history is kept (Admin only)
+func DeleteCoupon(c *gin.Context) {
+	var coupon database.Coupon
+	if err := database.DB.WithContext(c.Request.Context()).First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&coupon).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting coupon"})
+		return
+	}
+
+	recordAudit(c, nil, "coupon.delete", "coupon", coupon.ID, gin.H{"deleted": false}, gin.H{"deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted"})
+}
+
+// GetCouponRedemptions reports who redeemed a coupon and the discount given (Admin only)
+func GetCouponRedemptions(c *gin.Context) {
+	var coupon database.Coupon
+	if err := database.DB.WithContext(c.Request.Context()).Unscoped().First(&coupon, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	query := dates.apply(database.DB.WithContext(c.Request.Context()).Preload("Customer").Where("coupon_id = ?", coupon.ID), "created_at")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var redemptions []database.CouponRedemption
+	if err := query.Order("id DESC").Find(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch redemptions"})
+		return
+	}
+
+	var applied int
+	var totalDiscount float64
+	for _, r := range redemptions {
+		if r.Status == database.RedemptionStatusApplied {
+			applied++
+			totalDiscount += r.DiscountAmount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coupon":         coupon,
+		"redemptions":    redemptions,
+		"applied":        applied,
+		"total_discount": totalDiscount,
+	})
+}
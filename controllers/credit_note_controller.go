@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/ledger"
+)
+
+// CreditNoteRequest is a credit issued against an invoice. The amount is
+// before GST; the tax on the next bill falls with it.
+type CreditNoteRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Reason string  `json:"reason" binding:"required,oneof=service_downtime billing_error goodwill other"`
+	Notes  string  `json:"notes" binding:"max=500"`
+}
+
+// VoidCreditNoteRequest says why a credit note was withdrawn
+type VoidCreditNoteRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// openCreditNotes scopes credit notes to those a subscription's bills can
+// still use: its own, and those issued against its order before it started
+func openCreditNotes(db *gorm.DB, subscription database.Subscription, customerID uint) *gorm.DB {
+	return db.Model(&database.CreditNote{}).
+		Where("customer_id = ? AND status IN ?", customerID,
+			[]string{database.CreditNoteStatusOpen, database.CreditNoteStatusPartiallyApplied}).
+		Where("subscription_id = ? OR (subscription_id IS NULL AND order_id = ?)", subscription.ID, subscription.OrderID)
+}
+
+// creditForBill returns how much open credit comes off a bill of the given
+// taxable amount
+func creditForBill(db *gorm.DB, subscription database.Subscription, due float64) (float64, error) {
+	var available float64
+	if err := openCreditNotes(db, subscription, subscription.CustomerID).
+		Select("COALESCE(SUM(amount - applied_amount), 0)").
+		Scan(&available).Error; err != nil {
+		return 0, err
+	}
+	return roundPaise(math.Min(available, due)), nil
+}
+
+// useCreditNotes uses up, oldest first, the credit notes taken off a paid
+// bill. Credit voided since the bill was raised is simply not used.
+func useCreditNotes(tx *gorm.DB, subscription database.Subscription, payment database.Payment) error {
+	left := payment.CreditApplied
+	if left <= 0 {
+		return nil
+	}
+	var notes []database.CreditNote
+	if err := openCreditNotes(tx, subscription, payment.CustomerID).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Order("id").
+		Find(&notes).Error; err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if left < 0.005 {
+			break
+		}
+		use := roundPaise(math.Min(note.Amount-note.AppliedAmount, left))
+		status := database.CreditNoteStatusPartiallyApplied
+		if note.AppliedAmount+use >= note.Amount-0.005 {
+			status = database.CreditNoteStatusApplied
+		}
+		if err := tx.Model(&note).Updates(map[string]interface{}{
+			"applied_amount": roundPaise(note.AppliedAmount + use),
+			"status":         status,
+		}).Error; err != nil {
+			return err
+		}
+		left -= use
+	}
+	if left >= 0.005 {
+		log.Printf("Payment %d took %.2f of credit notes off that were no longer open", payment.ID, left)
+	}
+	return nil
+}
+
+// IssueCreditNote credits a customer against a paid invoice, e.g. for service
+// downtime or a billing error. The credit comes off the subscription's next
+// monthly bill (Admin only).
+// POST /api/admin/payments/:id/credit-notes
+func IssueCreditNote(c *gin.Context) {
+	var req CreditNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var payment database.Payment
+	if err := database.DB.WithContext(c.Request.Context()).First(&payment, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Payment not found"))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if payment.Status != database.PaymentStatusSuccess && payment.Status != database.PaymentStatusPaid {
+		apperror.Respond(c, apperror.BadRequest("Credit notes can only be issued against paid invoices"))
+		return
+	}
+
+	// A credit note for an initial payment waits for the subscription the
+	// order starts
+	var subscription database.Subscription
+	query := database.DB.WithContext(c.Request.Context()).Select("id, order_id, status")
+	if payment.SubscriptionID != nil {
+		query = query.Where("id = ?", *payment.SubscriptionID)
+	} else {
+		query = query.Where("order_id = ?", payment.OrderID)
+	}
+	if err := query.First(&subscription).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if subscription.ID != 0 && subscription.Status != database.SubscriptionStatusActive &&
+		subscription.Status != database.SubscriptionStatusSuspended {
+		apperror.Respond(c, apperror.BadRequest("Subscription has ended, so there is no bill to credit; refund the customer instead"))
+		return
+	}
+
+	orderID := subscription.OrderID
+	if payment.OrderID != nil {
+		orderID = *payment.OrderID
+	}
+	if err := checkNoOpenDispute(database.DB.WithContext(c.Request.Context()), subscription.ID, orderID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	invoiced := payment.TaxableAmount + payment.CreditApplied
+	if invoiced == 0 {
+		invoiced = payment.Amount
+	}
+	var credited float64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.CreditNote{}).
+		Where("payment_id = ? AND status <> ?", payment.ID, database.CreditNoteStatusVoid).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&credited).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if credited+req.Amount > invoiced+0.005 {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Credit notes on this invoice cannot exceed its taxable value; %.2f remains",
+			math.Max(roundPaise(invoiced-credited), 0))))
+		return
+	}
+
+	note := database.CreditNote{
+		CustomerID: payment.CustomerID,
+		PaymentID:  payment.ID,
+		OrderID:    payment.OrderID,
+		Reason:     req.Reason,
+		Notes:      req.Notes,
+		Amount:     roundPaise(req.Amount),
+		Status:     database.CreditNoteStatusOpen,
+		IssuedByID: c.GetUint("user_id"),
+	}
+	if subscription.ID != 0 {
+		note.SubscriptionID = &subscription.ID
+		note.OrderID = &subscription.OrderID
+	}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		note.Number = fmt.Sprintf("CN-%s-%d", note.CreatedAt.Format("20060102"), note.ID)
+		if err := tx.Model(&note).Update("number", note.Number).Error; err != nil {
+			return err
+		}
+		if err := ledger.PostCreditNote(tx, note); err != nil {
+			return err
+		}
+		notification := database.Notification{
+			UserID:      note.CustomerID,
+			Type:        "payment",
+			RelatedID:   &note.ID,
+			RelatedType: "credit_note",
+		}.Rendered(tx, "payment.credit_note", database.Vars{
+			"number":         note.Number,
+			"amount":         fmt.Sprintf("%.2f", note.Amount),
+			"invoice_number": payment.InvoiceNumber,
+		})
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to issue credit note"))
+		return
+	}
+
+	recordAudit(c, nil, "credit_note.issued", "credit_note", note.ID, nil, note)
+	c.JSON(http.StatusCreated, note)
+}
+
+// GetCreditNotes lists credit notes, newest first, filtered by ?customer_id,
+// ?payment_id and ?status (Admin only)
+// GET /api/admin/credit-notes
+func GetCreditNotes(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	query := database.ReadDB().WithContext(c.Request.Context()).Model(&database.CreditNote{})
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if paymentID := c.Query("payment_id"); paymentID != "" {
+		query = query.Where("payment_id = ?", paymentID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var notes []database.CreditNote
+	if err := dates.apply(query, "created_at").Order("created_at DESC").Find(&notes).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credit notes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credit_notes": notes})
+}
+
+// GetMyCreditNotes lists the signed-in customer's credit notes and the
+// credit still to come off their bills
+// GET /api/payments/credit-notes
+func GetMyCreditNotes(c *gin.Context) {
+	var notes []database.CreditNote
+	if err := database.ReadDB().WithContext(c.Request.Context()).Where("customer_id = ?", c.GetUint("user_id")).
+		Order("created_at DESC").Find(&notes).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credit notes"})
+		return
+	}
+
+	var available float64
+	for _, note := range notes {
+		if note.Status == database.CreditNoteStatusOpen || note.Status == database.CreditNoteStatusPartiallyApplied {
+			available += note.Amount - note.AppliedAmount
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"credit_notes": notes, "available_credit": roundPaise(available)})
+}
+
+// VoidCreditNote withdraws a credit note issued in error. Only a note none of
+// which has come off a paid bill can be voided (Admin only).
+// POST /api/admin/credit-notes/:id/void
+func VoidCreditNote(c *gin.Context) {
+	var req VoidCreditNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var note database.CreditNote
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&note, c.Param("id")).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.NotFound("Credit note not found")
+			}
+			return err
+		}
+		if note.Status != database.CreditNoteStatusOpen {
+			return apperror.Conflict(fmt.Sprintf("Credit note is %s and cannot be voided", note.Status))
+		}
+		var billed int64
+		if err := tx.Model(&database.Payment{}).
+			Where("customer_id = ? AND credit_applied > 0 AND status IN ?", note.CustomerID,
+				[]string{database.PaymentStatusPending, database.PaymentStatusPendingReconciliation}).
+			Count(&billed).Error; err != nil {
+			return err
+		}
+		if billed > 0 {
+			return apperror.Conflict("An unpaid bill already takes this credit off; void it once that bill is settled")
+		}
+		now := time.Now()
+		note.Status = database.CreditNoteStatusVoid
+		note.VoidedAt = &now
+		note.VoidReason = req.Reason
+		if err := tx.Model(&note).Updates(map[string]interface{}{
+			"status":      note.Status,
+			"voided_at":   now,
+			"void_reason": req.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		return ledger.PostCreditNoteVoided(tx, note)
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	recordAudit(c, nil, "credit_note.voided", "credit_note", note.ID,
+		gin.H{"status": database.CreditNoteStatusOpen}, gin.H{"status": note.Status, "reason": req.Reason})
+	c.JSON(http.StatusOK, note)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+)
+
+// pageCursor marks where a page of a newest-first list ended: the
+// (created_at, id) of its last row. Clients get it as an opaque token.
+type pageCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uint      `json:"i"`
+}
+
+// Page sizes of cursor-paginated lists
+const (
+	defaultCursorLimit = 20
+	maxCursorLimit     = 100
+)
+
+func encodeCursor(createdAt time.Time, id uint) string {
+	data, _ := json.Marshal(pageCursor{CreatedAt: createdAt, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// cursorRequested reports whether the client asked for cursor pagination
+// by passing ?cursor, which is empty for the first page
+func cursorRequested(c *gin.Context) bool {
+	_, ok := c.GetQuery("cursor")
+	return ok
+}
+
+// keysetPage limits a list query to the page after ?cursor, newest first by
+// (created_at, id) of table, with ?limit rows plus one to tell whether
+// another page follows. It writes the error response and returns false for
+// a bad cursor.
+func keysetPage(c *gin.Context, query *gorm.DB, table string) (*gorm.DB, int, bool) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultCursorLimit)))
+	if limit < 1 || limit > maxCursorLimit {
+		limit = defaultCursorLimit
+	}
+
+	if token := c.Query("cursor"); token != "" {
+		cursor, err := decodeCursor(token)
+		if err != nil {
+			apperror.Respond(c, apperror.BadRequest("Invalid cursor"))
+			return nil, 0, false
+		}
+		query = query.Where("("+table+".created_at, "+table+".id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	return query.Order(table + ".created_at DESC, " + table + ".id DESC").Limit(limit + 1), limit, true
+}
+
+// nextCursor drops the extra row keysetPage fetched and returns the page
+// with the cursor of its last row, or "" when it is the last page
+func nextCursor[T any](rows []T, limit int, key func(T) (time.Time, uint)) ([]T, string) {
+	if len(rows) <= limit {
+		return rows, ""
+	}
+	rows = rows[:limit]
+	createdAt, id := key(rows[limit-1])
+	return rows, encodeCursor(createdAt, id)
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/jobs"
+)
+
+// RequestDataExport starts generating an archive of the caller's personal data.
+// The user is notified when it is ready to download.
+// POST /api/users/me/export
+func RequestDataExport(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	// Only one export is generated at a time per user
+	var pending database.DataExport
+	err := database.DB.WithContext(c.Request.Context()).Where("user_id = ? AND status = ?", userID, database.DataExportStatusPending).First(&pending).Error
+	if err == nil {
+		c.JSON(http.StatusAccepted, pending)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	export := database.DataExport{UserID: userID, Status: database.DataExportStatusPending}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&export).Error; err != nil {
+		log.Printf("Error creating data export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start data export"})
+		return
+	}
+
+	jobs.QueueDataExport(export.ID)
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetDataExport returns the caller's most recent data export
+// GET /api/users/me/export
+func GetDataExport(c *gin.Context) {
+	var export database.DataExport
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC").First(&export).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No data export requested yet"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadDataExport sends a ready export archive to its owner
+// GET /api/users/me/export/:id/download
+func DownloadDataExport(c *gin.Context) {
+	exportID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	var export database.DataExport
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", exportID, c.GetUint("user_id")).First(&export).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data export not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if export.Status != database.DataExportStatusReady || (export.ExpiresAt != nil && export.ExpiresAt.Before(time.Now())) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Data export is not available for download", "status": export.Status})
+		return
+	}
+	if _, err := os.Stat(export.FilePath); err != nil {
+		log.Printf("Data export file missing for export %d: %v", export.ID, err)
+		c.JSON(http.StatusGone, gin.H{"error": "Data export file is no longer available, please request a new one"})
+		return
+	}
+
+	c.FileAttachment(export.FilePath, fmt.Sprintf("aquahome-data-%s.zip", export.CreatedAt.Format("2006-01-02")))
+}
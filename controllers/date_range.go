@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// dateRange is an optional [From, To) window taken from ?from=&to= (YYYY-MM-DD,
+// both inclusive days)
+type dateRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// parseDateRange reads the from/to query parameters. It writes the error
+// response and returns false when a date is malformed.
+func parseDateRange(c *gin.Context) (dateRange, bool) {
+	var r dateRange
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return r, false
+		}
+		r.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return r, false
+		}
+		end := t.AddDate(0, 0, 1)
+		r.To = &end
+	}
+	if r.From != nil && r.To != nil && !r.To.After(*r.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return r, false
+	}
+
+	return r, true
+}
+
+// apply restricts column to the range
+func (r dateRange) apply(query *gorm.DB, column string) *gorm.DB {
+	if r.From != nil {
+		query = query.Where(column+" >= ?", *r.From)
+	}
+	if r.To != nil {
+		query = query.Where(column+" < ?", *r.To)
+	}
+	return query
+}
+
+// key identifies the range in cache keys
+func (r dateRange) key() string {
+	key := "all"
+	if r.From != nil {
+		key = r.From.Format("2006-01-02")
+	}
+	key += "_"
+	if r.To != nil {
+		key += r.To.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	return key
+}
@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/ledger"
+)
+
+// ConfirmPickupRequest is the agent's report when collecting a device
+type ConfirmPickupRequest struct {
+	DeviceCondition string `json:"device_condition" binding:"required"`
+	Notes           string `json:"notes"`
+}
+
+// DepositDeductionRequest withholds part of a deposit
+type DepositDeductionRequest struct {
+	Reason string  `json:"reason" binding:"required"`
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// SettleDepositRequest chooses how the remaining deposit is returned
+type SettleDepositRequest struct {
+	Method string `json:"method" binding:"required,oneof=razorpay wallet"`
+	Notes  string `json:"notes"`
+}
+
+// walletBalance returns the sum of a user's wallet transactions
+func walletBalance(db *gorm.DB, userID uint) (float64, error) {
+	var balance float64
+	err := db.Model(&database.WalletTransaction{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&balance).Error
+	return balance, err
+}
+
+// depositSettlementForRequest loads the settlement named by :id if the caller
+// is an admin or works for its franchise
+func depositSettlementForRequest(c *gin.Context) (database.DepositSettlement, bool) {
+	var settlement database.DepositSettlement
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Preload("Deductions").Where("deposit_settlements.id = ?", c.Param("id")),
+		"deposit_settlements.franchise_id")
+	if !ok {
+		return settlement, false
+	}
+	if err := query.First(&settlement).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deposit settlement not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return settlement, false
+	}
+	return settlement, true
+}
+
+// GetMyDepositSettlements lists the deposit refunds of the current customer
+func GetMyDepositSettlements(c *gin.Context) {
+	var settlements []database.DepositSettlement
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Deductions").Where("customer_id = ?", c.GetUint("user_id")).
+		Order("id DESC").Find(&settlements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deposit refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settlements)
+}
+
+// GetMyWallet returns the current user's wallet balance and transactions
+func GetMyWallet(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	balance, err := walletBalance(database.DB.WithContext(c.Request.Context()), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet"})
+		return
+	}
+
+	var transactions []database.WalletTransaction
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ?", userID).Order("id DESC").Limit(100).Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wallet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balance": balance, "transactions": transactions})
+}
+
+// GetFranchiseDepositSettlements lists a franchise's deposit refunds, optionally by ?status
+func GetFranchiseDepositSettlements(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Preload("Deductions").Where("franchise_id = ?", franchise.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var settlements []database.DepositSettlement
+	if err := query.Order("id DESC").Find(&settlements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deposit settlements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settlements)
+}
+
+// ConfirmDevicePickup is called by the agent assigned to the pickup task once
+// the device has been collected (Service agent only)
+func ConfirmDevicePickup(c *gin.Context) {
+	var req ConfirmPickupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	agentID := c.GetUint("user_id")
+	var settlement database.DepositSettlement
+	err := database.DB.WithContext(c.Request.Context()).
+		Joins("JOIN service_requests ON service_requests.id = deposit_settlements.service_request_id").
+		Where("deposit_settlements.id = ? AND service_requests.service_agent_id = ?", c.Param("id"), agentID).
+		First(&settlement).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pickup not found or not assigned to you"})
+		return
+	}
+	if settlement.Status != database.DepositStatusAwaitingPickup {
+		c.JSON(http.StatusConflict, gin.H{"error": "Device pickup has already been confirmed"})
+		return
+	}
+
+	now := time.Now()
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&settlement).Updates(map[string]interface{}{
+			"status":           database.DepositStatusPickedUp,
+			"picked_up_at":     now,
+			"picked_up_by_id":  agentID,
+			"device_condition": req.DeviceCondition,
+			"notes":            req.Notes,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&database.ServiceRequest{}).Where("id = ?", *settlement.ServiceRequestID).
+			Updates(map[string]interface{}{
+				"status":          database.ServiceStatusCompleted,
+				"completion_time": now,
+				"notes":           req.DeviceCondition,
+			}).Error; err != nil {
+			return err
+		}
+		if err := publishServiceRequestCompleted(tx, *settlement.ServiceRequestID); err != nil {
+			return err
+		}
+		notification := database.Notification{
+			UserID:      settlement.CustomerID,
+			Type:        "deposit",
+			RelatedID:   &settlement.ID,
+			RelatedType: "deposit_settlement",
+		}.Rendered(tx, "deposit.collected", nil)
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm pickup"})
+		return
+	}
+
+	database.DB.WithContext(c.Request.Context()).Preload("Deductions").First(&settlement, settlement.ID)
+	c.JSON(http.StatusOK, settlement)
+}
+
+// AddDepositDeduction withholds an amount from a deposit before it is settled
+func AddDepositDeduction(c *gin.Context) {
+	settlement, ok := depositSettlementForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req DepositDeductionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if settlement.Status != database.DepositStatusAwaitingPickup && settlement.Status != database.DepositStatusPickedUp {
+		c.JSON(http.StatusConflict, gin.H{"error": "Deposit has already been settled"})
+		return
+	}
+	if settlement.DeductionAmount+req.Amount > settlement.DepositAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Deductions cannot exceed the deposit"})
+		return
+	}
+
+	deduction := database.DepositDeduction{
+		SettlementID: settlement.ID,
+		Reason:       req.Reason,
+		Amount:       req.Amount,
+		CreatedByID:  c.GetUint("user_id"),
+	}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&deduction).Error; err != nil {
+			return err
+		}
+		return tx.Model(&settlement).Update("deduction_amount", gorm.Expr("deduction_amount + ?", req.Amount)).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add deduction"})
+		return
+	}
+
+	recordAudit(c, nil, "deposit.deduction", "deposit_settlement", settlement.ID, nil, deduction)
+	database.DB.WithContext(c.Request.Context()).Preload("Deductions").First(&settlement, settlement.ID)
+	c.JSON(http.StatusCreated, settlement)
+}
+
+// SettleDeposit returns the deposit less deductions to the customer, either
+// as a Razorpay refund of the initial payment or as wallet credit
+func SettleDeposit(c *gin.Context) {
+	settlement, ok := depositSettlementForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req SettleDepositRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if settlement.Status != database.DepositStatusPickedUp {
+		c.JSON(http.StatusConflict, gin.H{"error": "Deposit can only be settled after the device is picked up"})
+		return
+	}
+	if err := checkNoOpenDispute(database.DB.WithContext(c.Request.Context()), settlement.SubscriptionID, settlement.OrderID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	refund := math.Max(settlement.DepositAmount-settlement.DeductionAmount, 0)
+	updates := map[string]interface{}{
+		"refund_amount": refund,
+		"refund_method": req.Method,
+		"settled_at":    time.Now(),
+	}
+	if req.Notes != "" {
+		updates["notes"] = req.Notes
+	}
+
+	switch {
+	case refund == 0:
+		updates["status"] = database.DepositStatusClosed
+		updates["refund_method"] = ""
+	case req.Method == database.RefundMethodRazorpay:
+		var payment database.Payment
+		if err := database.DB.WithContext(c.Request.Context()).Where("order_id = ? AND payment_type = ? AND payment_method = ? AND status IN ?",
+			settlement.OrderID, "initial", "razorpay",
+			[]string{database.PaymentStatusSuccess, database.PaymentStatusPaid}).
+			First(&payment).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No Razorpay payment to refund for this order, credit the wallet instead"})
+			return
+		}
+		gateway := paymentGatewayFor(c)
+		data := map[string]interface{}{
+			"notes": map[string]interface{}{
+				"deposit_settlement_id": settlement.ID,
+				"subscription_id":       settlement.SubscriptionID,
+			},
+		}
+		rzpRefund, err := callRazorpay(c, "refund_create", func() (map[string]interface{}, error) {
+			return gateway.Refund(payment.TransactionID, int(math.Round(refund*100)), fmt.Sprintf("deposit-%d", settlement.ID), data)
+		})
+		if err != nil {
+			log.Printf("Razorpay refund for deposit settlement %d failed: %v", settlement.ID, err)
+			respondRazorpayError(c, err, http.StatusBadGateway, "Refund could not be initiated, please try again")
+			return
+		}
+		updates["status"] = database.DepositStatusRefunded
+		updates["razorpay_refund_id"] = mapString(rzpRefund, "id")
+	default:
+		updates["status"] = database.DepositStatusCredited
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Guard against a concurrent settlement of the same deposit
+		result := tx.Model(&database.DepositSettlement{}).
+			Where("id = ? AND status = ?", settlement.ID, database.DepositStatusPickedUp).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("deposit settlement changed concurrently")
+		}
+		settled := settlement
+		settled.RefundAmount = refund
+		settled.RefundMethod, _ = updates["refund_method"].(string)
+		if err := ledger.PostDepositSettlement(tx, settled); err != nil {
+			return err
+		}
+
+		if updates["status"] == database.DepositStatusCredited {
+			if err := tx.Create(&database.WalletTransaction{
+				UserID:      settlement.CustomerID,
+				Amount:      refund,
+				Reason:      "Security deposit refund",
+				RelatedType: "deposit_settlement",
+				RelatedID:   &settlement.ID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		event := "deposit.refunded"
+		switch updates["status"] {
+		case database.DepositStatusCredited:
+			event = "deposit.credited"
+		case database.DepositStatusClosed:
+			event = "deposit.closed"
+		}
+		notification := database.Notification{
+			UserID:      settlement.CustomerID,
+			Type:        "deposit",
+			RelatedID:   &settlement.ID,
+			RelatedType: "deposit_settlement",
+		}.Rendered(tx, event, database.Vars{"amount": refund})
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		log.Printf("Failed to settle deposit %d (razorpay refund %v): %v", settlement.ID, updates["razorpay_refund_id"], err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle deposit"})
+		return
+	}
+
+	recordAudit(c, nil, "deposit.settle", "deposit_settlement", settlement.ID,
+		gin.H{"status": settlement.Status}, updates)
+	database.DB.WithContext(c.Request.Context()).Preload("Deductions").First(&settlement, settlement.ID)
+	c.JSON(http.StatusOK, settlement)
+}
@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/events"
+	"aquahome/ledger"
+	"aquahome/utils"
+)
+
+// maxEvidenceBytes is Razorpay's limit on a dispute document
+const maxEvidenceBytes = 10 << 20
+
+// evidenceExtensions are the document types accepted as dispute evidence, by
+// sniffed content type
+var evidenceExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// disputeEvidenceCategories are the evidence fields Razorpay's contest API
+// takes documents under
+var disputeEvidenceCategories = map[string]bool{
+	"shipping_proof":             true,
+	"billing_proof":              true,
+	"cancellation_proof":         true,
+	"customer_communication":     true,
+	"proof_of_service":           true,
+	"explanation_letter":         true,
+	"refund_confirmation":        true,
+	"access_activity_log":        true,
+	"refund_cancellation_policy": true,
+	"term_and_conditions":        true,
+	"others":                     true,
+}
+
+// ContestDisputeRequest submits a dispute's evidence to Razorpay. Amount is
+// how much of the disputed amount is contested, all of it by default.
+type ContestDisputeRequest struct {
+	Summary string  `json:"summary" binding:"required,max=1000"`
+	Amount  float64 `json:"amount" binding:"omitempty,gt=0"`
+}
+
+// checkNoOpenDispute returns a Conflict while a payment for the subscription
+// or order is disputed, so nothing refunds, credits or cancels what the bank
+// may yet claw back
+func checkNoOpenDispute(db *gorm.DB, subscriptionID, orderID uint) error {
+	var open int64
+	if err := db.Model(&database.Dispute{}).
+		Where("status IN ?", database.DisputeOpenStatuses).
+		Where("subscription_id = ? OR order_id = ?", subscriptionID, orderID).
+		Count(&open).Error; err != nil {
+		return apperror.Internal(err)
+	}
+	if open > 0 {
+		return apperror.Conflict("A payment for this subscription is disputed; it cannot be changed until the dispute is resolved")
+	}
+	return nil
+}
+
+// handleDisputeEvent keeps a dispute in step with Razorpay's payment.dispute
+// webhooks, books money Razorpay takes back or returns, and tells admins
+// when a dispute opens, needs a response or is resolved
+func handleDisputeEvent(event RazorpayWebhookEvent) error {
+	entity := event.entity("dispute")
+	disputeID := mapString(entity, "id")
+	if disputeID == "" {
+		return fmt.Errorf("%s webhook has no dispute", event.Event)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var dispute database.Dispute
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("razorpay_dispute_id = ?", disputeID).First(&dispute).Error
+		isNew := errors.Is(err, gorm.ErrRecordNotFound)
+		if err != nil && !isNew {
+			return err
+		}
+		previousStatus := dispute.Status
+
+		dispute.RazorpayDisputeID = disputeID
+		dispute.RazorpayPaymentID = mapString(entity, "payment_id")
+		dispute.Amount = mapFloat(entity, "amount") / 100
+		dispute.AmountDeducted = mapFloat(entity, "amount_deducted") / 100
+		dispute.Currency = mapString(entity, "currency")
+		dispute.Phase = mapString(entity, "phase")
+		dispute.ReasonCode = mapString(entity, "reason_code")
+		dispute.ReasonDescription = mapString(entity, "reason_description")
+		dispute.Status = mapString(entity, "status")
+		if respondBy := mapFloat(entity, "respond_by"); respondBy > 0 {
+			at := time.Unix(int64(respondBy), 0)
+			dispute.RespondBy = &at
+		}
+		resolved := dispute.Status == database.DisputeStatusWon || dispute.Status == database.DisputeStatusLost ||
+			dispute.Status == database.DisputeStatusClosed
+		if resolved && dispute.ResolvedAt == nil {
+			now := time.Now()
+			dispute.ResolvedAt = &now
+		}
+		if isNew {
+			if err := linkDisputedPayment(tx, &dispute); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&dispute).Error; err != nil {
+			return err
+		}
+
+		if dispute.AmountDeducted > 0 {
+			if err := ledger.PostDisputeDeducted(tx, dispute); err != nil {
+				return err
+			}
+		}
+		if dispute.Status == database.DisputeStatusWon {
+			if err := ledger.PostDisputeWon(tx, dispute); err != nil {
+				return err
+			}
+		}
+
+		var template string
+		switch {
+		case isNew:
+			template = "payment.dispute_opened"
+		case event.Event == "payment.dispute.action_required":
+			template = "payment.dispute_due"
+		case resolved && previousStatus != dispute.Status:
+			template = "payment.dispute_closed"
+		default:
+			return nil
+		}
+		respondBy := ""
+		if dispute.RespondBy != nil {
+			respondBy = dispute.RespondBy.Format("2 Jan 2006")
+		}
+		return events.Publish(tx, events.Event{
+			Name:       events.DisputeUpdated,
+			EntityType: "dispute",
+			EntityID:   dispute.ID,
+			Template:   template,
+			Vars: database.Vars{
+				"dispute":    dispute.RazorpayDisputeID,
+				"payment":    dispute.RazorpayPaymentID,
+				"amount":     fmt.Sprintf("%.2f", dispute.Amount),
+				"phase":      dispute.Phase,
+				"reason":     dispute.ReasonDescription,
+				"respond_by": respondBy,
+				"status":     dispute.Status,
+			},
+		})
+	})
+}
+
+// linkDisputedPayment finds the payment, order and subscription a new
+// dispute is about. A payment that isn't ours leaves the dispute unlinked.
+func linkDisputedPayment(tx *gorm.DB, dispute *database.Dispute) error {
+	var payment database.Payment
+	err := tx.Select("id, customer_id, order_id, subscription_id").
+		Where("transaction_id = ?", dispute.RazorpayPaymentID).First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Dispute %s is for unknown payment %s", dispute.RazorpayDisputeID, dispute.RazorpayPaymentID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dispute.PaymentID = &payment.ID
+	dispute.CustomerID = &payment.CustomerID
+	dispute.OrderID = payment.OrderID
+	dispute.SubscriptionID = payment.SubscriptionID
+
+	var subscription database.Subscription
+	query := tx.Select("id, order_id")
+	if payment.SubscriptionID != nil {
+		query = query.Where("id = ?", *payment.SubscriptionID)
+	} else {
+		query = query.Where("order_id = ?", payment.OrderID)
+	}
+	err = query.First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dispute.SubscriptionID = &subscription.ID
+	dispute.OrderID = &subscription.OrderID
+	return nil
+}
+
+// GetDisputes lists payment disputes, newest first. ?status=open lists those
+// not yet resolved (Admin only).
+// GET /api/admin/disputes
+func GetDisputes(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	query := database.ReadDB().WithContext(c.Request.Context()).Model(&database.Dispute{})
+	switch status := c.Query("status"); status {
+	case "":
+	case "open":
+		query = query.Where("status IN ?", database.DisputeOpenStatuses)
+	default:
+		query = query.Where("status = ?", status)
+	}
+	if paymentID := c.Query("payment_id"); paymentID != "" {
+		query = query.Where("payment_id = ?", paymentID)
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+
+	var disputes []database.Dispute
+	if err := dates.apply(query, "created_at").Order("created_at DESC").Find(&disputes).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disputes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"disputes": disputes})
+}
+
+// disputeForRequest loads the dispute named in the URL. It writes the error
+// response and returns false on failure.
+func disputeForRequest(c *gin.Context, db *gorm.DB) (database.Dispute, bool) {
+	var dispute database.Dispute
+	if err := db.Preload("Evidence").First(&dispute, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Dispute not found"))
+		} else {
+			apperror.Respond(c, apperror.Internal(err))
+		}
+		return dispute, false
+	}
+	return dispute, true
+}
+
+// GetDispute returns a dispute with its evidence (Admin only)
+// GET /api/admin/disputes/:id
+func GetDispute(c *gin.Context) {
+	if dispute, ok := disputeForRequest(c, database.ReadDB().WithContext(c.Request.Context())); ok {
+		c.JSON(http.StatusOK, dispute)
+	}
+}
+
+// UploadDisputeEvidence stores the "files" of a multipart upload as evidence
+// for an open dispute and uploads them to Razorpay. "category" names the
+// evidence field they are submitted under when the dispute is contested.
+// POST /api/admin/disputes/:id/evidence
+func UploadDisputeEvidence(c *gin.Context) {
+	dispute, ok := disputeForRequest(c, database.DB.WithContext(c.Request.Context()))
+	if !ok {
+		return
+	}
+	if dispute.Status != database.DisputeStatusOpen {
+		apperror.Respond(c, apperror.Conflict("Evidence can only be added while the dispute is open"))
+		return
+	}
+	form, ok := multipartForm(c, maxAttachmentsPerUpload*maxEvidenceBytes+multipartOverhead)
+	if !ok {
+		return
+	}
+	category := c.PostForm("category")
+	if !disputeEvidenceCategories[category] {
+		apperror.Respond(c, apperror.BadRequest("category must be one of Razorpay's dispute evidence fields, e.g. proof_of_service or billing_proof"))
+		return
+	}
+	files := form.File["files"]
+	if len(files) == 0 || len(files) > maxAttachmentsPerUpload {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf(`Upload between 1 and %d files in "files"`, maxAttachmentsPerUpload)))
+		return
+	}
+
+	gateway := paymentGatewayFor(c)
+	var evidence []database.DisputeEvidence
+	var saved []string
+	fail := func(err error) {
+		removeUploadedFiles(saved...)
+		apperror.Respond(c, err)
+	}
+	for _, header := range files {
+		item := database.DisputeEvidence{
+			DisputeID:    dispute.ID,
+			Category:     category,
+			OriginalName: header.Filename,
+			UploadedByID: c.GetUint("user_id"),
+		}
+		data, err := readUpload(header, maxEvidenceBytes)
+		if err != nil {
+			fail(apperror.BadRequest(err.Error()))
+			return
+		}
+		item.ContentType = http.DetectContentType(data)
+		extension := evidenceExtensions[item.ContentType]
+		if extension == "" {
+			fail(apperror.BadRequest(fmt.Sprintf("%s is not a PDF, JPEG or PNG", header.Filename)))
+			return
+		}
+		if strings.HasPrefix(item.ContentType, "image/") {
+			if _, err := utils.CheckImage(data); err != nil {
+				fail(apperror.BadRequest(imageRejectedMessage(header.Filename, err)))
+				return
+			}
+		}
+		item.SizeBytes = int64(len(data))
+		if item.URL, err = saveUploadedFile(fmt.Sprintf("disputes/%d", dispute.ID), extension, data); err != nil {
+			fail(apperror.Internal(err).WithMessage("Failed to store evidence"))
+			return
+		}
+		saved = append(saved, item.URL)
+
+		if item.RazorpayDocumentID, err = uploadDisputeDocument(c, gateway, item.URL); err != nil {
+			log.Printf("Razorpay document upload error: %v", err)
+			fail(apperror.New(http.StatusBadGateway, "razorpay_error", "Failed to upload evidence to Razorpay"))
+			return
+		}
+		evidence = append(evidence, item)
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&evidence).Error; err != nil {
+		fail(apperror.Internal(err).WithMessage("Failed to save evidence"))
+		return
+	}
+	recordAudit(c, nil, "dispute.evidence_uploaded", "dispute", dispute.ID, nil, evidence)
+	c.JSON(http.StatusCreated, gin.H{"evidence": evidence})
+}
+
+// uploadDisputeDocument uploads a stored file to Razorpay's documents API
+// and returns the document's ID
+func uploadDisputeDocument(c *gin.Context, gateway paymentGateway, url string) (string, error) {
+	file, err := os.Open(uploadedFilePath(url))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	document, err := callRazorpay(c, "document_create", func() (map[string]interface{}, error) {
+		return gateway.UploadDocument(file, "dispute_evidence")
+	})
+	if err != nil {
+		return "", err
+	}
+	return mapString(document, "id"), nil
+}
+
+// ContestDispute submits a dispute's evidence to Razorpay (Admin only)
+// POST /api/admin/disputes/:id/contest
+func ContestDispute(c *gin.Context) {
+	var req ContestDisputeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	dispute, ok := disputeForRequest(c, database.DB.WithContext(c.Request.Context()))
+	if !ok {
+		return
+	}
+	if dispute.Status != database.DisputeStatusOpen {
+		apperror.Respond(c, apperror.Conflict(fmt.Sprintf("Dispute is %s and cannot be contested", dispute.Status)))
+		return
+	}
+	if len(dispute.Evidence) == 0 {
+		apperror.Respond(c, apperror.BadRequest("Upload evidence before contesting the dispute"))
+		return
+	}
+	amount := dispute.Amount
+	if req.Amount > 0 {
+		amount = req.Amount
+	}
+	if amount > dispute.Amount {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("At most %.2f can be contested", dispute.Amount)))
+		return
+	}
+
+	data := map[string]interface{}{
+		"action":  "submit",
+		"summary": req.Summary,
+		"amount":  int64(math.Round(amount * 100)),
+	}
+	documents := map[string][]string{}
+	for _, item := range dispute.Evidence {
+		documents[item.Category] = append(documents[item.Category], item.RazorpayDocumentID)
+	}
+	for category, ids := range documents {
+		if category == "others" {
+			data[category] = []map[string]interface{}{{"type": "others", "document_ids": ids}}
+		} else {
+			data[category] = ids
+		}
+	}
+
+	gateway := paymentGatewayFor(c)
+	response, err := callRazorpay(c, "dispute_contest", func() (map[string]interface{}, error) {
+		return gateway.ContestDispute(dispute.RazorpayDisputeID, data)
+	})
+	if err != nil {
+		log.Printf("Razorpay dispute contest error: %v", err)
+		if errors.Is(err, errRazorpayUnavailable) {
+			respondGatewayUnavailable(c, err)
+			return
+		}
+		apperror.Respond(c, apperror.New(http.StatusBadGateway, "razorpay_error", "Failed to contest dispute"))
+		return
+	}
+
+	now := time.Now()
+	status := mapString(response, "status")
+	if status == "" {
+		status = database.DisputeStatusUnderReview
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&dispute).Updates(map[string]interface{}{"status": status, "contested_at": now}).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	dispute.Status = status
+	dispute.ContestedAt = &now
+	recordAudit(c, nil, "dispute.contested", "dispute", dispute.ID,
+		gin.H{"status": database.DisputeStatusOpen}, gin.H{"status": status, "amount": amount, "summary": req.Summary})
+	c.JSON(http.StatusOK, dispute)
+}
+
+// AcceptDispute concedes a dispute; Razorpay keeps the disputed amount
+// (Admin only)
+// POST /api/admin/disputes/:id/accept
+func AcceptDispute(c *gin.Context) {
+	dispute, ok := disputeForRequest(c, database.DB.WithContext(c.Request.Context()))
+	if !ok {
+		return
+	}
+	if dispute.Status != database.DisputeStatusOpen {
+		apperror.Respond(c, apperror.Conflict(fmt.Sprintf("Dispute is %s and cannot be accepted", dispute.Status)))
+		return
+	}
+
+	gateway := paymentGatewayFor(c)
+	response, err := callRazorpay(c, "dispute_accept", func() (map[string]interface{}, error) {
+		return gateway.AcceptDispute(dispute.RazorpayDisputeID)
+	})
+	if err != nil {
+		log.Printf("Razorpay dispute accept error: %v", err)
+		if errors.Is(err, errRazorpayUnavailable) {
+			respondGatewayUnavailable(c, err)
+			return
+		}
+		apperror.Respond(c, apperror.New(http.StatusBadGateway, "razorpay_error", "Failed to accept dispute"))
+		return
+	}
+
+	// The webhook that follows books the money Razorpay keeps
+	status := mapString(response, "status")
+	if status == "" {
+		status = database.DisputeStatusLost
+	}
+	now := time.Now()
+	if err := database.DB.WithContext(c.Request.Context()).Model(&dispute).Updates(map[string]interface{}{"status": status, "resolved_at": now}).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	dispute.Status = status
+	dispute.ResolvedAt = &now
+	recordAudit(c, nil, "dispute.accepted", "dispute", dispute.ID,
+		gin.H{"status": database.DisputeStatusOpen}, gin.H{"status": status})
+	c.JSON(http.StatusOK, dispute)
+}
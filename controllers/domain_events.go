@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// publishOrderPlaced announces a new order: the customer is notified and
+// emailed, and webhook endpoints get order.created
+func publishOrderPlaced(tx *gorm.DB, order database.Order, productName string) error {
+	return events.Publish(tx, events.Event{
+		Name:        events.OrderPlaced,
+		EntityType:  "order",
+		EntityID:    order.ID,
+		CustomerID:  order.CustomerID,
+		FranchiseID: order.FranchiseID,
+		Vars:        database.Vars{"product": productName},
+		Data:        database.WebhookOrderData(order),
+	})
+}
+
+// publishServiceRequestCreated announces a new service request to the
+// customer and the franchise owner
+func publishServiceRequestCreated(tx *gorm.DB, serviceRequest database.ServiceRequest, franchiseID uint) error {
+	return events.Publish(tx, events.Event{
+		Name:        events.ServiceRequestCreated,
+		EntityType:  "service_request",
+		EntityID:    serviceRequest.ID,
+		CustomerID:  serviceRequest.CustomerID,
+		FranchiseID: franchiseID,
+	})
+}
+
+// publishServiceRequestCompleted announces a service request completed
+// without a service report. Call it in the transaction that completes it.
+func publishServiceRequestCompleted(tx *gorm.DB, serviceRequestID uint) error {
+	var serviceRequest database.ServiceRequest
+	if err := tx.First(&serviceRequest, serviceRequestID).Error; err != nil {
+		return err
+	}
+	return events.Publish(tx, events.Event{
+		Name:        events.ServiceRequestCompleted,
+		EntityType:  "service_request",
+		EntityID:    serviceRequest.ID,
+		CustomerID:  serviceRequest.CustomerID,
+		FranchiseID: serviceRequest.FranchiseID,
+		Data:        database.WebhookServiceRequestData(serviceRequest),
+	})
+}
+
+// publishOrderStatusChanged tells the customer their order moved to status
+func publishOrderStatusChanged(tx *gorm.DB, orderID, customerID uint, status string) error {
+	template := "order.status_updated"
+	switch status {
+	case database.OrderStatusApproved, database.OrderStatusRejected, database.OrderStatusCancelled,
+		database.OrderStatusInTransit, database.OrderStatusDelivered, database.OrderStatusInstalled:
+		template = "order." + status
+	}
+	return events.Publish(tx, events.Event{
+		Name:       events.OrderStatusChanged,
+		EntityType: "order",
+		EntityID:   orderID,
+		CustomerID: customerID,
+		Template:   template,
+		Vars:       database.Vars{"id": orderID, "status": status},
+	})
+}
+
+// publishOrderCancelled tells the customer their order was cancelled, and
+// whether amount was refunded, and the franchise owner why
+func publishOrderCancelled(tx *gorm.DB, order database.Order, amount float64, refunded bool, reason string) error {
+	template := "order.cancelled"
+	if refunded {
+		template = "order.cancelled_refunded"
+	}
+	return events.Publish(tx, events.Event{
+		Name:        events.OrderCancelled,
+		EntityType:  "order",
+		EntityID:    order.ID,
+		CustomerID:  order.CustomerID,
+		FranchiseID: order.FranchiseID,
+		Template:    template,
+		Vars:        database.Vars{"id": order.ID, "amount": amount, "reason": reason},
+	})
+}
+
+// publishLeadReceived tells the franchise owner about a lead routed to them
+func publishLeadReceived(tx *gorm.DB, lead database.Lead) error {
+	slot := ""
+	if lead.PreferredSlot != nil {
+		slot = " on " + lead.PreferredSlot.Format("02 Jan 2006 15:04")
+	}
+	return events.Publish(tx, events.Event{
+		Name:        events.LeadReceived,
+		EntityType:  "lead",
+		EntityID:    lead.ID,
+		FranchiseID: *lead.FranchiseID,
+		Vars: database.Vars{
+			"name":    lead.Name,
+			"phone":   lead.Phone,
+			"pincode": lead.Pincode,
+			"slot":    slot,
+		},
+	})
+}
+
+// publishLeadConverted invites the customer a lead became to sign in and pay
+// for their draft order; webhook endpoints get order.created
+func publishLeadConverted(tx *gorm.DB, order database.Order, productName string) error {
+	return events.Publish(tx, events.Event{
+		Name:        events.LeadConverted,
+		EntityType:  "order",
+		EntityID:    order.ID,
+		CustomerID:  order.CustomerID,
+		FranchiseID: order.FranchiseID,
+		Vars: database.Vars{
+			"product": productName,
+			"order":   order.ID,
+			"amount":  fmt.Sprintf("%.2f", order.TotalInitialAmount),
+			"url":     config.AppConfig.AppBaseURL + "/login",
+		},
+		Data: database.WebhookOrderData(order),
+	})
+}
+
+// publishRescheduleRequested tells the franchise owner a customer can't make
+// a visit, with the time they would prefer
+func publishRescheduleRequested(tx *gorm.DB, reminder database.AppointmentReminder) error {
+	visit, entityType := "service request", "service_request"
+	if reminder.Kind == database.AppointmentInstallation {
+		visit, entityType = "installation of order", "order"
+	}
+	details := ""
+	if reminder.PreferredTime != nil {
+		details += " and would prefer " + reminder.PreferredTime.Format("Mon 02 Jan 15:04")
+	}
+	if reminder.RescheduleReason != "" {
+		details += ": " + reminder.RescheduleReason
+	}
+	return events.Publish(tx, events.Event{
+		Name:        events.RescheduleRequested,
+		EntityType:  entityType,
+		EntityID:    reminder.EntityID,
+		CustomerID:  reminder.CustomerID,
+		FranchiseID: reminder.FranchiseID,
+		Vars: database.Vars{
+			"visit":   visit,
+			"id":      reminder.EntityID,
+			"when":    reminder.ScheduledTime.Format("Mon 02 Jan 15:04"),
+			"details": details,
+		},
+	})
+}
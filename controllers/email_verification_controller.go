@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Email verification settings
+const (
+	emailVerificationTTL          = 48 * time.Hour
+	emailVerificationResendWindow = time.Hour
+	emailVerificationMaxPerUser   = 3 // verification emails per user within emailVerificationResendWindow
+)
+
+// sendEmailVerification emails the user a link to confirm their address.
+// Links sent earlier stop working.
+func sendEmailVerification(db *gorm.DB, user database.User) error {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+	verification := database.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&verification).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.AppConfig.AppBaseURL, token)
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address for AquaHome by opening the link below. "+
+		"It expires in %d hours.\n\n%s\n\nIf you didn't create an AquaHome account, you can ignore this email.",
+		user.Name, int(emailVerificationTTL.Hours()), link)
+	return utils.SendEmail(user.Email, "Confirm your AquaHome email address", body)
+}
+
+// requireVerifiedEmail stops a customer placing an order before confirming
+// their email address, when REQUIRE_VERIFIED_EMAIL is set. Accounts created
+// with a phone login code have no email address and are not held back.
+func requireVerifiedEmail(db *gorm.DB, customerID uint) error {
+	if !config.AppConfig.RequireVerifiedEmail {
+		return nil
+	}
+	var customer database.User
+	if err := db.Select("id, email, email_verified_at").First(&customer, customerID).Error; err != nil {
+		return apperror.Internal(err)
+	}
+	if customer.Email != "" && customer.EmailVerifiedAt == nil {
+		return apperror.New(http.StatusForbidden, "email_not_verified",
+			"Please confirm your email address before placing an order")
+	}
+	return nil
+}
+
+// VerifyEmail confirms the user's email address with the emailed token
+// GET /api/auth/verify-email?token=
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		apperror.Respond(c, apperror.BadRequest("token is required"))
+		return
+	}
+
+	var verification database.EmailVerificationToken
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+			First(&verification).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.BadRequest("Invalid or expired verification link")
+		} else if err != nil {
+			return apperror.Internal(err)
+		}
+
+		// Mark the token used first so the same link can't be spent twice
+		now := time.Now()
+		result := tx.Model(&database.EmailVerificationToken{}).
+			Where("id = ? AND used_at IS NULL", verification.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return apperror.Internal(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return apperror.BadRequest("Invalid or expired verification link")
+		}
+		if err := tx.Model(&database.User{}).
+			Where("id = ? AND email_verified_at IS NULL", verification.UserID).
+			Update("email_verified_at", now).Error; err != nil {
+			return apperror.Internal(err)
+		}
+		return nil
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ResendEmailVerification emails the signed-in user a new verification link
+// POST /api/auth/verify-email/resend
+func ResendEmailVerification(c *gin.Context) {
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, c.GetUint("user_id")).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if user.Email == "" {
+		apperror.Respond(c, apperror.BadRequest("Your account has no email address"))
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		apperror.Respond(c, apperror.Conflict("Your email address is already verified"))
+		return
+	}
+
+	var recent int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-emailVerificationResendWindow)).
+		Count(&recent).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if recent >= emailVerificationMaxPerUser {
+		apperror.Respond(c, apperror.New(http.StatusTooManyRequests, apperror.CodeRateLimited,
+			"Too many verification emails requested, please try again later"))
+		return
+	}
+
+	if err := sendEmailVerification(database.DB.WithContext(c.Request.Context()), user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to send verification email"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/cache"
+)
+
+// versionSource is a query whose rows a response is built from; table names
+// the gorm.Model table it selects from
+type versionSource struct {
+	table string
+	query *gorm.DB
+}
+
+// rowsVersion summarises when the rows of each source last changed: their
+// newest updated_at and deleted_at and how many there are, soft-deleted
+// ones included, so edits, deletes and inserts all change it. Compute it
+// before loading the rows, so a response is never paired with a version
+// newer than its data.
+func rowsVersion(db *gorm.DB, sources ...versionSource) (string, error) {
+	placeholders := make([]string, len(sources))
+	args := make([]interface{}, len(sources))
+	for i, source := range sources {
+		placeholders[i] = "(?)"
+		args[i] = source.query.Unscoped().Select(fmt.Sprintf(
+			"concat_ws('/', MAX(%[1]s.updated_at), MAX(%[1]s.deleted_at), COUNT(*))", source.table))
+	}
+	var version string
+	err := db.Raw("SELECT concat_ws(';', "+strings.Join(placeholders, ", ")+")", args...).Scan(&version).Error
+	return version, err
+}
+
+// weakETag derives a weak ETag from a response's row versions and whatever
+// else it varies by, such as the user and the query string
+func weakETag(parts ...interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(parts...)))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// versionedETag returns the ETag of a response built from sources, or ""
+// when the version can't be read, in which case the response goes without
+func versionedETag(c *gin.Context, db *gorm.DB, sources []versionSource, parts ...interface{}) string {
+	version, err := rowsVersion(db, sources...)
+	if err != nil {
+		log.Printf("Failed to compute ETag for %s: %v", c.FullPath(), err)
+		return ""
+	}
+	return weakETag(append(parts, version)...)
+}
+
+// dashboardWindow keeps dashboard ETags from outliving the cached dashboard,
+// as counts such as overdue requests change with time as well as with rows
+func dashboardWindow() int64 {
+	return time.Now().Truncate(dashboardCacheTTL).Unix()
+}
+
+// notModified sends etag and, when the client's If-None-Match already names
+// it, answers 304 Not Modified. It returns true when the response is done.
+func notModified(c *gin.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match compares weakly: W/"x" matches "x"
+		if candidate == "*" || (candidate != "" && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/")) {
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return true
+		}
+	}
+	return false
+}
+
+// cachedResponse is a response body kept in the cache with its ETag
+type cachedResponse struct {
+	ETag string          `json:"etag"`
+	Body json.RawMessage `json:"body"`
+}
+
+// respondCached answers from the cache when key holds a response, honouring
+// If-None-Match. It returns false on a cache miss.
+func respondCached(c *gin.Context, key string) bool {
+	var cached cachedResponse
+	if !cache.GetJSON(c.Request.Context(), key, &cached) {
+		return false
+	}
+	if !notModified(c, cached.ETag) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", cached.Body)
+	}
+	return true
+}
+
+// cacheAndRespond caches a response under key with its ETag and sends it,
+// or 304 Not Modified when the client already has it
+func cacheAndRespond(c *gin.Context, key, etag string, response interface{}, ttl time.Duration) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	cache.SetJSON(c.Request.Context(), key, cachedResponse{ETag: etag, Body: body}, ttl)
+	if !notModified(c, etag) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
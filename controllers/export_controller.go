@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+
+	"aquahome/database"
+)
+
+// exportColumn is one exported column: a SQL expression and its header
+type exportColumn struct {
+	expr   string
+	header string
+}
+
+// exportSpec describes an exportable resource
+type exportSpec struct {
+	name       string
+	table      string
+	joins      []string
+	columns    []exportColumn
+	dateColumn string
+	// franchiseFilter restricts rows to a list of franchise IDs (one ? placeholder)
+	franchiseFilter string
+}
+
+var orderExport = exportSpec{
+	name:  "orders",
+	table: "orders",
+	joins: []string{
+		"LEFT JOIN users AS customer ON customer.id = orders.customer_id",
+		"LEFT JOIN products ON products.id = orders.product_id",
+		"LEFT JOIN franchises ON franchises.id = orders.franchise_id",
+	},
+	columns: []exportColumn{
+		{"orders.id", "order_id"},
+		{"orders.created_at", "created_at"},
+		{"orders.status", "status"},
+		{"orders.order_type", "order_type"},
+		{"customer.name", "customer_name"},
+		{"customer.email", "customer_email"},
+		{"customer.phone", "customer_phone"},
+		{"products.name", "product"},
+		{"franchises.name", "franchise"},
+		{"orders.monthly_rent", "monthly_rent"},
+		{"orders.security_deposit", "security_deposit"},
+		{"orders.installation_fee", "installation_fee"},
+		{"orders.total_initial_amount", "total_initial_amount"},
+		{"orders.rental_duration", "rental_duration_months"},
+		{"orders.shipping_address", "shipping_address"},
+	},
+	dateColumn:      "orders.created_at",
+	franchiseFilter: "orders.franchise_id IN ?",
+}
+
+var paymentExport = exportSpec{
+	name:  "payments",
+	table: "payments",
+	joins: []string{
+		"LEFT JOIN users AS customer ON customer.id = payments.customer_id",
+		"LEFT JOIN subscriptions ON subscriptions.id = payments.subscription_id",
+		"LEFT JOIN orders ON orders.id = payments.order_id",
+	},
+	columns: []exportColumn{
+		{"payments.id", "payment_id"},
+		{"payments.created_at", "created_at"},
+		{"payments.status", "status"},
+		{"payments.payment_type", "payment_type"},
+		{"payments.amount", "amount"},
+		{"payments.taxable_amount", "taxable_amount"},
+		{"payments.cgst_amount", "cgst_amount"},
+		{"payments.sgst_amount", "sgst_amount"},
+		{"payments.igst_amount", "igst_amount"},
+		{"payments.payment_method", "payment_method"},
+		{"payments.transaction_id", "transaction_id"},
+		{"payments.invoice_number", "invoice_number"},
+		{"payments.order_id", "order_id"},
+		{"payments.subscription_id", "subscription_id"},
+		{"COALESCE(subscriptions.franchise_id, orders.franchise_id)", "franchise_id"},
+		{"customer.name", "customer_name"},
+		{"customer.email", "customer_email"},
+	},
+	dateColumn:      "payments.created_at",
+	franchiseFilter: "COALESCE(subscriptions.franchise_id, orders.franchise_id) IN ?",
+}
+
+var serviceRequestExport = exportSpec{
+	name:  "service-requests",
+	table: "service_requests",
+	joins: []string{
+		"LEFT JOIN users AS customer ON customer.id = service_requests.customer_id",
+		"LEFT JOIN users AS agent ON agent.id = service_requests.service_agent_id",
+		"LEFT JOIN franchises ON franchises.id = service_requests.franchise_id",
+	},
+	columns: []exportColumn{
+		{"service_requests.id", "service_request_id"},
+		{"service_requests.created_at", "created_at"},
+		{"service_requests.type", "type"},
+		{"service_requests.status", "status"},
+		{"service_requests.scheduled_time", "scheduled_time"},
+		{"service_requests.completion_time", "completion_time"},
+		{"customer.name", "customer_name"},
+		{"customer.phone", "customer_phone"},
+		{"agent.name", "service_agent"},
+		{"franchises.name", "franchise"},
+		{"service_requests.rating", "rating"},
+		{"service_requests.description", "description"},
+	},
+	dateColumn:      "service_requests.created_at",
+	franchiseFilter: "service_requests.franchise_id IN ?",
+}
+
+// ExportOrders streams orders as CSV or XLSX
+// GET /api/admin/export/orders?from=&to=&status=&format=csv|xlsx
+func ExportOrders(c *gin.Context) {
+	exportResource(c, orderExport)
+}
+
+// ExportPayments streams payments as CSV or XLSX
+// GET /api/admin/export/payments?from=&to=&status=&format=csv|xlsx
+func ExportPayments(c *gin.Context) {
+	exportResource(c, paymentExport)
+}
+
+// ExportServiceRequests streams service requests as CSV or XLSX
+// GET /api/admin/export/service-requests?from=&to=&status=&format=csv|xlsx
+func ExportServiceRequests(c *gin.Context) {
+	exportResource(c, serviceRequestExport)
+}
+
+// exportResource runs the export query and writes the rows in the requested
+// format. Franchise owners only get rows of their own franchises.
+func exportResource(c *gin.Context, spec exportSpec) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	selects := make([]string, len(spec.columns))
+	headers := make([]string, len(spec.columns))
+	for i, col := range spec.columns {
+		selects[i] = col.expr + " AS " + col.header
+		headers[i] = col.header
+	}
+
+	query := database.ReadDB().WithContext(c.Request.Context()).Table(spec.table).
+		Select(strings.Join(selects, ", ")).
+		Where(notDeleted(spec.table)).
+		Order(spec.table + ".id")
+	for _, join := range spec.joins {
+		query = query.Joins(join)
+	}
+	query = dates.apply(query, spec.dateColumn)
+	if status := c.Query("status"); status != "" {
+		query = query.Where(spec.table+".status = ?", status)
+	}
+
+	if c.GetString("role") != database.RoleAdmin {
+		franchiseIDs, ok := ownerFranchiseIDs(c)
+		if !ok {
+			return
+		}
+		query = query.Where(spec.franchiseFilter, franchiseIDs)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		log.Printf("Export %s query failed: %v", spec.name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + spec.name})
+		return
+	}
+	defer rows.Close()
+
+	filename := spec.name
+	if dates.From != nil || dates.To != nil {
+		filename += "_" + dates.key()
+	}
+	filename += "." + format
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "xlsx" {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		err = writeXLSX(c.Writer, headers, rows)
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		err = writeCSV(c.Writer, headers, rows)
+	}
+	if err != nil {
+		// Headers are already sent, so the client sees a truncated file
+		log.Printf("Export %s failed while streaming: %v", spec.name, err)
+	}
+}
+
+// scanRow reads the current row as strings; NULLs become empty cells
+func scanRow(rows *sql.Rows, width int) ([]string, error) {
+	values := make([]sql.NullString, width)
+	targets := make([]interface{}, width)
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	if err := rows.Scan(targets...); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, width)
+	for i, v := range values {
+		record[i] = v.String
+	}
+	return record, nil
+}
+
+func writeCSV(w io.Writer, headers []string, rows *sql.Rows) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(headers); err != nil {
+		return err
+	}
+
+	for n := 1; rows.Next(); n++ {
+		record, err := scanRow(rows, len(headers))
+		if err != nil {
+			return err
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+		// Push data to the client as we go instead of buffering the whole file
+		if n%500 == 0 {
+			out.Flush()
+			if err := out.Error(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func writeXLSX(w io.Writer, headers []string, rows *sql.Rows) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(headers))
+	for i, h := range headers {
+		header[i] = h
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	for n := 2; rows.Next(); n++ {
+		record, err := scanRow(rows, len(headers))
+		if err != nil {
+			return err
+		}
+		cells := make([]interface{}, len(record))
+		for i, v := range record {
+			cells[i] = v
+		}
+		cell, err := excelize.CoordinatesToCellName(1, n)
+		if err != nil {
+			return err
+		}
+		if err := stream.SetRow(cell, cells); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := stream.Flush(); err != nil {
+		return err
+	}
+	return file.Write(w)
+}
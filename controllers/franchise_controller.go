@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"aquahome/apperror"
+	"aquahome/cache"
 	"aquahome/database"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // FranchiseDashboardData structure to hold dashboard response
@@ -19,6 +22,24 @@ type FranchiseDashboardData struct {
 	RecentActivity         interface{} `json:"recentActivity"`
 }
 
+// franchiseDashboardCounts are the headline numbers of a franchise dashboard
+type franchiseDashboardCounts struct {
+	TotalCustomers      int64
+	TotalOrders         int64
+	ActiveSubscriptions int64
+	PendingServices     int64
+}
+
+// territoryCustomers selects the customers whose pincode one of the
+// franchise's locations covers
+func territoryCustomers(db *gorm.DB, franchiseID uint) *gorm.DB {
+	return db.Model(&database.User{}).
+		Where("users.role = ?", database.RoleCustomer).
+		Where(`EXISTS (SELECT 1 FROM franchise_locations
+			JOIN locations ON locations.id = franchise_locations.location_id AND locations.deleted_at IS NULL
+			WHERE franchise_locations.franchise_id = ? AND users.zip_code = ANY (locations.zip_codes))`, franchiseID)
+}
+
 // ✅ GET /franchise/dashboard?franchiseId=xx
 // ✅ GET /franchise/dashboard?franchiseId=xx
 func GetFranchiseDashboard(c *gin.Context) {
@@ -28,153 +49,62 @@ func GetFranchiseDashboard(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("userID") // ✅ safe and direct
-
-	franchiseIDParam := c.Query("franchiseId")
-	var franchiseID uint
-
-	log.Println("🔍 Dashboard Fetching: Role =", role, "UserID =", userID, "FranchiseParam =", franchiseIDParam)
-
-	if franchiseIDParam != "" {
-		id, err := strconv.ParseUint(franchiseIDParam, 10, 64)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid franchise ID"})
-			return
-		}
-		franchiseID = uint(id)
-	} else {
-		var user database.User
-		if err := database.DB.First(&user, userID).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
-			return
-		}
-
-		if user.FranchiseID == nil && user.Role == "franchise_owner" {
-			var f database.Franchise
-			if err := database.DB.Where("owner_id = ?", userID).First(&f).Error; err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "No franchise linked to your account"})
-				return
-			}
-
-			// ✅ Update user with the linked franchise_id
-			user.FranchiseID = &f.ID
-			if err := database.DB.Save(&user).Error; err != nil {
-				log.Println("Failed to update user franchise ID:", err)
-			}
-			franchiseID = f.ID
-		} else if user.FranchiseID != nil {
-			franchiseID = *user.FranchiseID
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not found for user"})
-			return
-		}
-
-	}
-
-	var f database.Franchise
-	if err := database.DB.First(&f, franchiseID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not found"})
-		return
-	}
-
-	// 🛡️ Access check for franchise_owner
-	if role == "franchise_owner" {
-		if f.OwnerID != userID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to view this dashboard"})
-			return
-		}
-
-		if !f.IsActive || f.ApprovalState != "approved" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Franchise not yet approved or activated"})
-			return
-		}
-	}
-
-	// 📊 Dashboard Stats
-	var totalCustomers int64
-	var totalOrders int64
-	var activeSubscriptions int64
-	var pendingServices int64
-
-	var zipCodesArray []string
-	if err := database.DB.Table("franchise_locations").
-		Joins("JOIN locations ON franchise_locations.location_id = locations.id").
-		Where("franchise_locations.franchise_id = ?", f.ID).
-		Pluck("locations.zip_codes", &zipCodesArray).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ZIP codes"})
-		return
-	}
-
-	var zipCodes []string
-	for _, zipArray := range zipCodesArray {
-		zipArray = strings.Trim(zipArray, "{}")
-		if zipArray == "" {
-			continue
-		}
-		individualZips := strings.Split(zipArray, ",")
-		for _, zip := range individualZips {
-			zip = strings.TrimSpace(zip)
-			if zip != "" {
-				zipCodes = append(zipCodes, zip)
-			}
-		}
-	}
+	log.Println("🔍 Dashboard Fetching: Role =", role, "FranchiseParam =", franchiseParam(c))
 
-	var users []database.User
-	if err := database.DB.Where("zip_code IN ?", zipCodes).
-		Where("role = ?", "customer").
-		Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+	// Owners with several franchises pick one with ?franchise_id
+	f, ok := franchiseForRequest(c)
+	if !ok {
 		return
 	}
-	totalCustomers = int64(len(users))
-
-	var userIDs []uint
-	for _, u := range users {
-		userIDs = append(userIDs, u.ID)
-	}
+	franchiseID := f.ID
 
-	var orders []database.Order
-	if err := database.DB.Preload("Customer").
-		Preload("Product").
-		Preload("Franchise").
-		Where("customer_id IN ?", userIDs).
-		Find(&orders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+	cacheKey := fmt.Sprintf("%sfranchise:%d", cache.PrefixDashboard, f.ID)
+	if respondCached(c, cacheKey) {
 		return
 	}
+	etag := versionedETag(c, database.ReadDB().WithContext(c.Request.Context()), []versionSource{
+		{"franchises", database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{}).Where("id = ?", franchiseID)},
+		{"users", territoryCustomers(database.DB.WithContext(c.Request.Context()), franchiseID)},
+		{"orders", database.DB.WithContext(c.Request.Context()).Model(&database.Order{}).
+			Where("franchise_id = ? OR customer_id IN (?)", franchiseID, territoryCustomers(database.DB.WithContext(c.Request.Context()), franchiseID).Select("users.id"))},
+		{"subscriptions", database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).Where("franchise_id = ?", franchiseID)},
+		{"service_requests", database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Where("franchise_id = ?", franchiseID)},
+	}, "franchise", franchiseID, dashboardWindow())
 
-	totalOrders = int64(len(orders))
-
-	// user userIds and get subscriptopsn
-
-	var subscriptions []database.Subscription
-	if err := database.DB.Where("customer_id IN ?", userIDs).
-		Where("franchise_id = ?", franchiseID).
-		Find(&subscriptions).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscriptions"})
+	// 📊 Dashboard Stats, counted in one query
+	var counts franchiseDashboardCounts
+	if err := database.ReadDB().WithContext(c.Request.Context()).Raw(
+		"SELECT (?) AS total_customers, (?) AS total_orders, (?) AS active_subscriptions, (?) AS pending_services",
+		territoryCustomers(database.DB.WithContext(c.Request.Context()), franchiseID).Select("COUNT(*)"),
+		database.DB.WithContext(c.Request.Context()).Model(&database.Order{}).Select("COUNT(*)").
+			Where("customer_id IN (?)", territoryCustomers(database.DB.WithContext(c.Request.Context()), franchiseID).Select("users.id")),
+		database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).Select("COUNT(*)").
+			Where("franchise_id = ? AND status = ?", franchiseID, database.SubscriptionStatusActive),
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Select("COUNT(*)").
+			Where("franchise_id = ? AND status = ?", franchiseID, database.ServiceStatusPending),
+	).Scan(&counts).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dashboard stats"})
 		return
 	}
-	activeSubscriptions = int64(len(subscriptions))
 
-	//get service requests
-	var serviceRequests []database.ServiceRequest
-	if err := database.DB.Where("franchise_id = ? AND status = ?", franchiseID, "pending").Find(&serviceRequests).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service requests"})
+	ofFranchise := database.ReadDB().WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Where("service_requests.franchise_id = ?", franchiseID)
+	sla, err := slaOverview(ofFranchise, ofFranchise.Session(&gorm.Session{}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute SLA compliance"})
 		return
 	}
-	pendingServices = int64(len(serviceRequests))
 
 	var pendingOrders []database.Order
-	database.DB.Where("franchise_id = ? AND status = ?", franchiseID, "pending").Order("created_at DESC").Limit(5).Find(&pendingOrders)
+	database.ReadDB().WithContext(c.Request.Context()).Where("franchise_id = ? AND status = ?", franchiseID, "pending").Order("created_at DESC").Limit(5).Find(&pendingOrders)
 
 	var pendingRequests []database.ServiceRequest
-	database.DB.Where("franchise_id = ? AND status = ?", franchiseID, "pending").Order("created_at DESC").Limit(5).Find(&pendingRequests)
+	database.ReadDB().WithContext(c.Request.Context()).Where("franchise_id = ? AND status = ?", franchiseID, "pending").Order("created_at DESC").Limit(5).Find(&pendingRequests)
 
 	var recentActivity []interface{} = []interface{}{} // optional
 
 	var franchise database.Franchise
-	if err := database.DB.First(&franchise, franchiseID).Error; err != nil {
+	if err := database.ReadDB().WithContext(c.Request.Context()).First(&franchise, franchiseID).Error; err != nil {
 		log.Printf("Franchise fetch error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch franchise info"})
 		return
@@ -182,18 +112,22 @@ func GetFranchiseDashboard(c *gin.Context) {
 
 	log.Println("✅ Dashboard returning for franchise:", franchiseID)
 
-	c.JSON(http.StatusOK, FranchiseDashboardData{
+	response := FranchiseDashboardData{
 		Franchise: franchise,
 		Stats: gin.H{
-			"totalCustomers":         totalCustomers,
-			"totalOrders":            totalOrders,
-			"activeSubscriptions":    activeSubscriptions,
-			"pendingServiceRequests": pendingServices,
+			"totalCustomers":           counts.TotalCustomers,
+			"totalOrders":              counts.TotalOrders,
+			"activeSubscriptions":      counts.ActiveSubscriptions,
+			"pendingServiceRequests":   counts.PendingServices,
+			"overdueServiceRequests":   sla["overdue"],
+			"escalatedServiceRequests": sla["escalated"],
+			"slaCompliance":            sla["compliance"],
 		},
 		PendingOrders:          pendingOrders,
 		PendingServiceRequests: pendingRequests,
 		RecentActivity:         recentActivity,
-	})
+	}
+	cacheAndRespond(c, cacheKey, etag, response, dashboardCacheTTL)
 }
 
 // ✅ GET /franchises - Admin Only
@@ -205,7 +139,7 @@ func GetAllFranchises(c *gin.Context) {
 	}
 
 	var franchises []database.Franchise
-	if err := database.DB.Order("created_at desc").Find(&franchises).Error; err != nil {
+	if err := includeDeleted(c, database.DB.WithContext(c.Request.Context())).Order("created_at desc").Find(&franchises).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch franchises"})
 		return
 	}
@@ -230,7 +164,7 @@ func AdminUpdateFranchise(c *gin.Context) {
 	}
 
 	var franchise database.Franchise
-	if err := database.DB.First(&franchise, id).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&franchise, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
 		return
 	}
@@ -243,14 +177,18 @@ func AdminUpdateFranchise(c *gin.Context) {
 		State   string `json:"state"`
 		ZipCode string `json:"zip_code"`
 		Address string `json:"address"`
+		GSTIN   string `json:"gstin" binding:"omitempty,len=15"`
+
+		RevenueShare *float64 `json:"revenue_share" binding:"omitempty,min=0,max=100"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Update fields
+	before := franchise
 	franchise.Name = request.Name
 	franchise.Phone = request.Phone
 	franchise.Email = request.Email
@@ -258,12 +196,17 @@ func AdminUpdateFranchise(c *gin.Context) {
 	franchise.State = request.State
 	franchise.ZipCode = request.ZipCode
 	franchise.Address = request.Address
+	franchise.GSTIN = request.GSTIN
+	if request.RevenueShare != nil {
+		franchise.RevenueShare = request.RevenueShare
+	}
 
-	if err := database.DB.Save(&franchise).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Save(&franchise).Error; err != nil {
 		log.Printf("❌ Franchise update error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordAudit(c, nil, "franchise.update", "franchise", franchise.ID, before, franchise)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Franchise updated successfully"})
 }
@@ -287,16 +230,17 @@ func ToggleFranchiseStatus(c *gin.Context) {
 		IsActive bool `json:"is_active"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
-	if err := database.DB.Model(&database.Franchise{}).
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{}).
 		Where("id = ?", id).
 		Update("is_active", input.IsActive).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update franchise status"})
 		return
 	}
+	recordAudit(c, nil, "franchise.toggle_status", "franchise", uint(id), nil, gin.H{"is_active": input.IsActive})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Franchise status updated"})
 }
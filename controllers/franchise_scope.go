@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/middleware"
+)
+
+// franchiseParam returns the franchise picked with the franchise switcher,
+// ?franchise_id. The dashboard's original ?franchiseId is still accepted.
+func franchiseParam(c *gin.Context) string {
+	if id := c.Query("franchise_id"); id != "" {
+		return id
+	}
+	return c.Query("franchiseId")
+}
+
+// ownerFranchiseIDs returns the franchises a franchise owner's request covers:
+// the one picked with the franchise switcher, which must be theirs, or else
+// all of their franchises. Staff get the franchises where they were granted
+// the route's feature. It writes the error response and returns false on failure.
+func ownerFranchiseIDs(c *gin.Context) ([]uint, bool) {
+	var ids []uint
+	if c.GetString("role") == database.RoleFranchiseStaff {
+		granted, exists := c.Get(middleware.StaffFranchiseIDsKey)
+		if !exists {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return nil, false
+		}
+		ids = granted.([]uint)
+	} else if err := database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{}).
+		Where("owner_id = ?", c.GetUint("user_id")).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return nil, false
+	}
+
+	if param := franchiseParam(c); param != "" {
+		picked, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid franchise_id"})
+			return nil, false
+		}
+		for _, id := range ids {
+			if id == uint(picked) {
+				return []uint{id}, true
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't own this franchise"})
+		return nil, false
+	}
+
+	if len(ids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No franchise linked to your account"})
+		return nil, false
+	}
+	return ids, true
+}
+
+// ownerFranchiseID resolves the one franchise an owner's request acts on: their
+// only franchise, or the one picked with ?franchise_id when they hold several
+func ownerFranchiseID(c *gin.Context) (uint, bool) {
+	ids, ok := ownerFranchiseIDs(c)
+	if !ok {
+		return 0, false
+	}
+	if len(ids) > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "franchise_id is required when you own several franchises"})
+		return 0, false
+	}
+	return ids[0], true
+}
+
+// scopeFranchises limits a list query to the caller's franchises by the given
+// franchise ID column. Owners see their franchises (or the one switched to);
+// admins see everything unless they pass ?franchise_id.
+func scopeFranchises(c *gin.Context, query *gorm.DB, column string) (*gorm.DB, bool) {
+	switch c.GetString("role") {
+	case database.RoleAdmin:
+		if param := franchiseParam(c); param != "" {
+			return query.Where(column+" = ?", param), true
+		}
+		return query, true
+	case database.RoleFranchiseOwner, database.RoleFranchiseStaff:
+		ids, ok := ownerFranchiseIDs(c)
+		if !ok {
+			return query, false
+		}
+		return query.Where(column+" IN ?", ids), true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+	return query, false
+}
+
+// franchiseForRequest resolves the single franchise the caller is working on:
+// for owners and staff their franchise, or the one picked with ?franchise_id
+// when they hold several; admins must always name it. It writes the error response and
+// returns false on failure.
+func franchiseForRequest(c *gin.Context) (database.Franchise, bool) {
+	var franchise database.Franchise
+	role := c.GetString("role")
+
+	query := database.DB.WithContext(c.Request.Context())
+	if role == database.RoleAdmin {
+		param := franchiseParam(c)
+		if param == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "franchise_id is required"})
+			return franchise, false
+		}
+		query = query.Where("id = ?", param)
+	} else {
+		id, ok := ownerFranchiseID(c)
+		if !ok {
+			return franchise, false
+		}
+		query = query.Where("id = ?", id)
+	}
+
+	if err := query.First(&franchise).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return franchise, false
+	}
+
+	if role != database.RoleAdmin && (!franchise.IsActive || franchise.ApprovalState != "approved") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Franchise not yet approved or activated"})
+		return franchise, false
+	}
+
+	return franchise, true
+}
+
+// GetMyFranchises lists the franchises the current owner holds, or a staff
+// member works for, for the franchise switcher
+func GetMyFranchises(c *gin.Context) {
+	var franchises []database.Franchise
+	query := database.DB.WithContext(c.Request.Context()).Where("owner_id = ?", c.GetUint("user_id"))
+	if c.GetString("role") == database.RoleFranchiseStaff {
+		query = database.DB.WithContext(c.Request.Context()).Where("id IN (?)", database.DB.WithContext(c.Request.Context()).Model(&database.FranchiseMember{}).
+			Select("franchise_id").Where("user_id = ? AND disabled_at IS NULL", c.GetUint("user_id")))
+	}
+	if err := query.Order("id").Find(&franchises).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch franchises"})
+		return
+	}
+	c.JSON(http.StatusOK, franchises)
+}
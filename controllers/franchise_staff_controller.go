@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// staffInviteTTL is how long a new staff member has to set their password
+const staffInviteTTL = 72 * time.Hour
+
+// StaffRequest adds a staff member to a franchise. An email that already
+// belongs to a staff account adds that account instead of creating one.
+type StaffRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Email     string   `json:"email" binding:"required,email"`
+	Phone     string   `json:"phone"`
+	StaffRole string   `json:"staff_role" binding:"required,oneof=dispatcher accountant"`
+	Features  []string `json:"features"` // defaults to the staff role's features
+}
+
+// UpdateStaffRequest changes a staff member's role or features, or disables
+// their access to the franchise
+type UpdateStaffRequest struct {
+	StaffRole string   `json:"staff_role" binding:"omitempty,oneof=dispatcher accountant"`
+	Features  []string `json:"features"`
+	Disabled  *bool    `json:"disabled"`
+}
+
+// staffFeatures checks the requested features, falling back to the staff
+// role's defaults
+func staffFeatures(staffRole string, features []string) ([]string, error) {
+	if len(features) == 0 {
+		return database.DefaultStaffFeatures[staffRole], nil
+	}
+	for _, feature := range features {
+		if _, ok := database.AllFranchiseFeatures[feature]; !ok {
+			return nil, apperror.BadRequest(fmt.Sprintf("Unknown feature %q", feature))
+		}
+	}
+	return features, nil
+}
+
+// staffMemberForRequest loads the membership named by :id on the caller's
+// franchise. It writes the error response and returns false on failure.
+func staffMemberForRequest(c *gin.Context, franchise database.Franchise) (database.FranchiseMember, bool) {
+	var member database.FranchiseMember
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND franchise_id = ?", c.Param("id"), franchise.ID).
+		First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Staff member not found"))
+		} else {
+			apperror.Respond(c, apperror.Internal(err))
+		}
+		return member, false
+	}
+	return member, true
+}
+
+// revokeIfNoFranchise signs a staff member out once they no longer work for
+// any franchise
+func revokeIfNoFranchise(tx *gorm.DB, userID uint) error {
+	var active int64
+	if err := tx.Model(&database.FranchiseMember{}).
+		Where("user_id = ? AND disabled_at IS NULL", userID).Count(&active).Error; err != nil {
+		return err
+	}
+	if active > 0 {
+		return nil
+	}
+	return revokeUserSessions(tx, userID)
+}
+
+// staffInvite creates a link for a new staff member to set their password
+// through the password reset flow, and returns the func that emails it once
+// the account is committed
+func staffInvite(tx *gorm.DB, user database.User, franchise database.Franchise) (func(), error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&database.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(staffInviteTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppConfig.AppBaseURL, token)
+	body := fmt.Sprintf("Hi %s,\n\nYou have been added to the %s team on AquaHome. Open the link below to set your password; "+
+		"it expires in %d hours.\n\n%s", user.Name, franchise.Name, int(staffInviteTTL.Hours()), link)
+	return func() {
+		if err := utils.SendEmail(user.Email, "You have been invited to AquaHome", body); err != nil {
+			log.Printf("Failed to send staff invite to user %d: %v", user.ID, err)
+		}
+	}, nil
+}
+
+// GetFranchiseStaff lists the staff of the caller's franchise
+// GET /api/franchise/staff
+func GetFranchiseStaff(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+	var members []database.FranchiseMember
+	if err := database.ReadDB().WithContext(c.Request.Context()).
+		Preload("User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, name, email, phone, profile_picture")
+		}).
+		Where("franchise_id = ?", franchise.ID).Order("id").Find(&members).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"staff": members, "features": database.AllFranchiseFeatures})
+}
+
+// AddFranchiseStaff creates a staff account for the caller's franchise and
+// emails it a link to set a password, or adds an existing staff account
+// POST /api/franchise/staff
+func AddFranchiseStaff(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+	var request StaffRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	features, err := staffFeatures(request.StaffRole, request.Features)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	var member database.FranchiseMember
+	var sendInvite func()
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var user database.User
+		err := tx.Where("LOWER(email) = ?", strings.ToLower(request.Email)).First(&user).Error
+		switch {
+		case err == nil:
+			if user.Role != database.RoleFranchiseStaff {
+				return apperror.Conflict("Email already in use by another account")
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = database.User{
+				Name:        request.Name,
+				Email:       request.Email,
+				Phone:       request.Phone,
+				Role:        database.RoleFranchiseStaff,
+				FranchiseID: &franchise.ID,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return apperror.Internal(err)
+			}
+			if sendInvite, err = staffInvite(tx, user, franchise); err != nil {
+				return apperror.Internal(err)
+			}
+		default:
+			return apperror.Internal(err)
+		}
+
+		var existing int64
+		if err := tx.Model(&database.FranchiseMember{}).
+			Where("franchise_id = ? AND user_id = ?", franchise.ID, user.ID).Count(&existing).Error; err != nil {
+			return apperror.Internal(err)
+		}
+		if existing > 0 {
+			return apperror.Conflict("This person is already on the franchise's staff")
+		}
+
+		member = database.FranchiseMember{
+			FranchiseID: franchise.ID,
+			UserID:      user.ID,
+			StaffRole:   request.StaffRole,
+			Features:    features,
+			AddedByID:   c.GetUint("user_id"),
+			User:        user,
+		}
+		if err := tx.Omit("User").Create(&member).Error; err != nil {
+			return apperror.Internal(err)
+		}
+		return writeAudit(c, tx, "franchise.staff_add", "franchise_member", member.ID, nil, member)
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if sendInvite != nil {
+		sendInvite()
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateFranchiseStaff changes a staff member's role or features, or
+// disables or re-enables their access to the caller's franchise
+// PUT /api/franchise/staff/:id
+func UpdateFranchiseStaff(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+	member, ok := staffMemberForRequest(c, franchise)
+	if !ok {
+		return
+	}
+	var request UpdateStaffRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	before := member
+	if request.StaffRole != "" && request.StaffRole != member.StaffRole {
+		member.StaffRole = request.StaffRole
+		if request.Features == nil {
+			member.Features = database.DefaultStaffFeatures[member.StaffRole]
+		}
+	}
+	if request.Features != nil {
+		features, err := staffFeatures(member.StaffRole, request.Features)
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		member.Features = features
+	}
+	if request.Disabled != nil {
+		switch {
+		case *request.Disabled && member.DisabledAt == nil:
+			now := time.Now()
+			member.DisabledAt = &now
+		case !*request.Disabled:
+			member.DisabledAt = nil
+		}
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&member).Select("staff_role", "features", "disabled_at").Updates(&member).Error; err != nil {
+			return err
+		}
+		if member.DisabledAt != nil {
+			if err := revokeIfNoFranchise(tx, member.UserID); err != nil {
+				return err
+			}
+		}
+		return writeAudit(c, tx, "franchise.staff_update", "franchise_member", member.ID, before, member)
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to update staff member"))
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveFranchiseStaff takes a staff member off the caller's franchise. The
+// account stays so it can be added back or keep working for other franchises.
+// DELETE /api/franchise/staff/:id
+func RemoveFranchiseStaff(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+	member, ok := staffMemberForRequest(c, franchise)
+	if !ok {
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&member).Error; err != nil {
+			return err
+		}
+		if err := revokeIfNoFranchise(tx, member.UserID); err != nil {
+			return err
+		}
+		return writeAudit(c, tx, "franchise.staff_remove", "franchise_member", member.ID, member, nil)
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to remove staff member"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff member removed"})
+}
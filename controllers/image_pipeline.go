@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/jobs"
+	"aquahome/queue"
+	"aquahome/utils"
+)
+
+// TaskImageProcess makes the WebP thumbnail of an uploaded product image or
+// photo attachment on the job queue, first removing the location a
+// customer's phone recorded in the photo
+const TaskImageProcess = "image.process"
+
+// maxProcessedImageBytes bounds the source images the job downloads
+const maxProcessedImageBytes = 25 << 20
+
+// imageProcessPayload names the image to process; Kind is one of the
+// database.UploadPurpose values
+type imageProcessPayload struct {
+	Kind string `json:"kind"`
+	ID   uint   `json:"id"`
+}
+
+func init() {
+	queue.Register(TaskImageProcess, func(_ context.Context, payload json.RawMessage) error {
+		var p imageProcessPayload
+		if err := queue.Decode(payload, &p); err != nil {
+			return err
+		}
+		return processImage(p.Kind, p.ID)
+	}, queue.Options{MaxRetry: 5, Timeout: 2 * time.Minute})
+}
+
+// queueImageProcessing schedules the thumbnail of a new image, processing it
+// in the background when the queue is unavailable
+func queueImageProcessing(kind string, id uint) {
+	payload := imageProcessPayload{Kind: kind, ID: id}
+	if _, err := queue.EnqueueUnique(TaskImageProcess, fmt.Sprintf("%s:%d", kind, id), payload); err != nil {
+		log.Printf("⚠️ Could not queue image processing for %s %d, running it here: %v", kind, id, err)
+		jobs.Go(func() {
+			if err := processImage(kind, id); err != nil {
+				log.Printf("Failed to process %s %d: %v", kind, id, err)
+			}
+		})
+	}
+}
+
+// processImage strips the location from a customer's photo and stores a
+// WebP thumbnail beside the image. Images that are gone or can't be decoded
+// are logged and skipped rather than retried.
+func processImage(kind string, id uint) error {
+	var (
+		record     interface{}
+		sourceURL  string
+		stripGPS   bool
+		thumbField string
+	)
+	switch kind {
+	case database.UploadPurposeProductImage:
+		var img database.ProductImage
+		if err := database.DB.First(&img, id).Error; err != nil {
+			return skipMissingImage(kind, id, err)
+		}
+		record, sourceURL, thumbField = &img, img.FullURL, "webp_thumbnail_url"
+	case database.UploadPurposeServiceAttachment:
+		var attachment database.ServiceRequestAttachment
+		if err := database.DB.First(&attachment, id).Error; err != nil {
+			return skipMissingImage(kind, id, err)
+		}
+		if attachment.Kind != database.AttachmentKindPhoto {
+			return nil
+		}
+		record, sourceURL, thumbField = &attachment, attachment.URL, "thumbnail_url"
+		stripGPS = attachment.UploaderRole == database.RoleCustomer
+	default:
+		log.Printf("Unknown image kind %q", kind)
+		return nil
+	}
+
+	data, err := readStoredImage(sourceURL)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, utils.ErrS3ObjectNotFound) {
+		log.Printf("Image %s of %s %d is gone, skipping it", sourceURL, kind, id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if stripGPS {
+		if stripped, changed := utils.StripJPEGLocation(data); changed {
+			if err := writeStoredImage(sourceURL, "image/jpeg", stripped); err != nil {
+				return err
+			}
+			data = stripped
+		}
+	}
+
+	decoded, _, err := utils.DecodeImage(data)
+	if err != nil {
+		log.Printf("Image %s of %s %d can't be decoded, skipping it: %v", sourceURL, kind, id, err)
+		return nil
+	}
+	var thumbnail bytes.Buffer
+	if err := utils.EncodeWebP(&thumbnail, utils.ResizeToWidth(decoded, utils.ThumbnailWidth)); err != nil {
+		return err
+	}
+	thumbURL := strings.TrimSuffix(sourceURL, path.Ext(sourceURL)) + "_thumb.webp"
+	if err := writeStoredImage(thumbURL, "image/webp", thumbnail.Bytes()); err != nil {
+		return err
+	}
+
+	result := database.DB.Model(record).Update(thumbField, thumbURL)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// The image was deleted while its thumbnail was being made
+		removeStoredImage(thumbURL)
+	}
+	return nil
+}
+
+// skipMissingImage drops the job for an image deleted before it was processed
+func skipMissingImage(kind string, id uint, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("%s %d no longer exists, skipping it", kind, id)
+		return nil
+	}
+	return err
+}
+
+// readStoredImage reads an image from the bucket or from ./uploads
+func readStoredImage(url string) ([]byte, error) {
+	if key, ok := utils.S3KeyFromURL(url); ok {
+		return utils.GetS3Object(key, maxProcessedImageBytes)
+	}
+	if !strings.HasPrefix(url, uploadsURLPrefix+"/") {
+		return nil, fmt.Errorf("%s is not a stored upload: %w", url, os.ErrNotExist)
+	}
+	return os.ReadFile(uploadedFilePath(url))
+}
+
+// writeStoredImage stores data at url in the bucket or under ./uploads
+func writeStoredImage(url, contentType string, data []byte) error {
+	if key, ok := utils.S3KeyFromURL(url); ok {
+		return utils.PutS3Object(key, contentType, data)
+	}
+	return os.WriteFile(uploadedFilePath(url), data, 0644)
+}
+
+// removeStoredImage deletes an image from the bucket or from ./uploads
+func removeStoredImage(url string) {
+	if key, ok := utils.S3KeyFromURL(url); ok {
+		if err := utils.DeleteS3Object(key); err != nil {
+			log.Printf("Failed to remove %s: %v", url, err)
+		}
+		return
+	}
+	removeUploadedFiles(url)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// ImpersonationRequest explains why support needs to act as the user
+type ImpersonationRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// ImpersonateUser issues a short-lived token that lets an admin act as a
+// user to reproduce their issue. Requests made with it are tagged in the audit
+// log, and credentials, payments and account deletion stay off limits.
+// (Admin only)
+// POST /api/admin/users/:id/impersonate
+func ImpersonateUser(c *gin.Context) {
+	var req ImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("A reason is required to impersonate a user"))
+		return
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if strings.ToLower(user.Role) == database.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot be impersonated"})
+		return
+	}
+
+	adminID := c.GetUint("user_id")
+	var admin database.User
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, name, email").First(&admin, adminID).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(config.AppConfig.ImpersonationMinutes) * time.Minute)
+	banner := fmt.Sprintf("%s (%s) is signed in as %s for support", admin.Name, admin.Email, user.Name)
+	token, err := utils.GenerateImpersonationJWT(user.ID, user.Email, strings.ToLower(user.Role), adminID, banner, expiresAt)
+	if err != nil {
+		log.Printf("JWT error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	recordAudit(c, nil, "user.impersonate", "user", user.ID, nil, gin.H{
+		"reason":     req.Reason,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+		"banner":     banner,
+		"user":       gin.H{"id": user.ID, "name": user.Name, "email": user.Email, "role": strings.ToLower(user.Role)},
+	})
+}
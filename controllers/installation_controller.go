@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/events"
+	"aquahome/utils"
+)
+
+// Installation OTP settings
+const (
+	installationOTPTTL         = 72 * time.Hour
+	installationOTPMaxPerOrder = 3 // codes per order within installationOTPWindow
+	installationOTPWindow      = 15 * time.Minute
+	installationOTPMaxAttempts = 5
+)
+
+// ConfirmInstallationRequest is the agent's proof that the customer was present
+type ConfirmInstallationRequest struct {
+	OTP   string `json:"otp" binding:"required,len=6,numeric"`
+	Notes string `json:"notes"`
+}
+
+// sendInstallationOTP issues a fresh installation code for the order and sends
+// it to the customer by SMS and in-app notification
+func sendInstallationOTP(db *gorm.DB, order database.Order) error {
+	code, err := utils.GenerateNumericOTP(6)
+	if err != nil {
+		return err
+	}
+
+	var customer database.User
+	if err := db.Select("id, phone").First(&customer, order.CustomerID).Error; err != nil {
+		return err
+	}
+
+	notification := database.Notification{
+		UserID:      order.CustomerID,
+		Type:        "order",
+		RelatedID:   &order.ID,
+		RelatedType: "order",
+	}.Rendered(db, "order.installation_code", database.Vars{"code": code, "id": order.ID})
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only the newest code stays valid
+		if err := tx.Model(&database.InstallationOTP{}).
+			Where("order_id = ? AND used_at IS NULL", order.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&database.InstallationOTP{
+			OrderID:   order.ID,
+			CodeHash:  utils.HashToken(code),
+			ExpiresAt: time.Now().Add(installationOTPTTL),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&notification).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := events.QueueNotificationDelivery(database.NotificationDelivery{
+		UserID:    customer.ID,
+		Channel:   database.NotificationChannelSMS,
+		Event:     "order.installation_code",
+		Recipient: utils.NormalizePhone(customer.Phone),
+		Message:   notification.Message,
+	}); err != nil {
+		log.Printf("Failed to text installation code for order %d: %v", order.ID, err)
+	}
+	return nil
+}
+
+// agentOrderForRequest loads the order named by :id if the caller is an admin
+// or the agent assigned to it
+func agentOrderForRequest(c *gin.Context) (database.Order, bool) {
+	var order database.Order
+	query := database.DB.WithContext(c.Request.Context()).Preload("Franchise").Where("id = ?", c.Param("id"))
+	if c.GetString("role") != database.RoleAdmin {
+		query = query.Where("service_agent_id = ?", c.GetUint("user_id"))
+	}
+	if err := query.First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or not assigned to you"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return order, false
+	}
+	return order, true
+}
+
+// ResendInstallationOTP sends the customer a new installation code
+// POST /api/agent/orders/:id/installation-otp
+func ResendInstallationOTP(c *gin.Context) {
+	order, ok := agentOrderForRequest(c)
+	if !ok {
+		return
+	}
+	if order.Status != database.OrderStatusInTransit && order.Status != database.OrderStatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order is not awaiting installation (current: %s)", order.Status)})
+		return
+	}
+
+	var recent int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.InstallationOTP{}).
+		Where("order_id = ? AND created_at > ?", order.ID, time.Now().Add(-installationOTPWindow)).
+		Count(&recent)
+	if recent >= installationOTPMaxPerOrder {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many codes requested, please try again later"})
+		return
+	}
+
+	if err := sendInstallationOTP(database.DB.WithContext(c.Request.Context()), order); err != nil {
+		log.Printf("Failed to send installation code for order %d: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Installation code sent to the customer"})
+}
+
+// ConfirmInstallation marks a delivered order installed once the agent enters
+// the code the customer received
+// POST /api/agent/orders/:id/confirm-installation
+func ConfirmInstallation(c *gin.Context) {
+	var req ConfirmInstallationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("The customer's 6-digit installation code is required"))
+		return
+	}
+
+	order, ok := agentOrderForRequest(c)
+	if !ok {
+		return
+	}
+	if order.Status != database.OrderStatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only delivered orders can be installed (current: %s)", order.Status)})
+		return
+	}
+	if filed, err := hasInstallationReport(database.DB.WithContext(c.Request.Context()), order.ID); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	} else if !filed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Submit the installation report before confirming the installation"})
+		return
+	}
+
+	var otp database.InstallationOTP
+	err := database.DB.WithContext(c.Request.Context()).Where("order_id = ? AND used_at IS NULL AND expires_at > ?", order.ID, time.Now()).
+		Order("created_at DESC").
+		First(&otp).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return
+	}
+
+	if !utils.TokensEqual(otp.CodeHash, utils.HashToken(req.OTP)) {
+		updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+		if otp.Attempts+1 >= installationOTPMaxAttempts {
+			updates["used_at"] = time.Now()
+		}
+		database.DB.WithContext(c.Request.Context()).Model(&otp).Updates(updates)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	note := "Installation confirmed with customer code"
+	if req.Notes != "" {
+		note += " | " + req.Notes
+	}
+
+	userID := c.GetUint("user_id")
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Claim the code so it can't be used twice
+		result := tx.Model(&database.InstallationOTP{}).
+			Where("id = ? AND used_at IS NULL", otp.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		result = tx.Model(&database.Order{}).
+			Where("id = ? AND status = ?", order.ID, database.OrderStatusDelivered).
+			Update("status", database.OrderStatusInstalled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := recordOrderStatus(tx, order.ID, order.Status, database.OrderStatusInstalled, userID, note); err != nil {
+			return err
+		}
+		if err := consumeInstalledUnit(tx, order, userID); err != nil {
+			return err
+		}
+
+		notifications := []database.Notification{database.Notification{
+			UserID:      order.CustomerID,
+			Type:        "order",
+			RelatedID:   &order.ID,
+			RelatedType: "order",
+		}.Rendered(tx, "order.installed", nil)}
+		if order.Franchise.OwnerID != 0 {
+			notifications = append(notifications, database.Notification{
+				UserID:      order.Franchise.OwnerID,
+				Type:        "order",
+				RelatedID:   &order.ID,
+				RelatedType: "order",
+			}.Rendered(tx, "order.installed_franchise", database.Vars{"id": order.ID}))
+		}
+		return tx.Create(&notifications).Error
+	})
+
+	var stockErr *stockError
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by someone else, please refresh"})
+		return
+	case errors.As(err, &stockErr):
+		c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error()})
+		return
+	default:
+		log.Printf("Failed to confirm installation of order %d: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm installation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Installation confirmed", "order_id": order.ID})
+}
+
+const maxInstallationPhotos = 5
+
+// InstallationReportRequest is the checklist part of an installation report,
+// sent as multipart form fields alongside the "photos" files
+type InstallationReportRequest struct {
+	WaterPressure string `form:"water_pressure" json:"water_pressure" binding:"required,oneof=low normal high"`
+	TDSReading    *int   `form:"tds_reading" json:"tds_reading" binding:"required,min=0,max=2000"`
+	DemoGiven     *bool  `form:"demo_given" json:"demo_given" binding:"required"`
+	Notes         string `form:"notes" json:"notes"`
+}
+
+// SubmitInstallationReport records the installation checklist and photos for
+// a delivered order, replacing any earlier report
+// POST /api/agent/orders/:id/installation-report
+func SubmitInstallationReport(c *gin.Context) {
+	var req InstallationReportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("water_pressure (low, normal or high), tds_reading and demo_given are required"))
+		return
+	}
+
+	order, ok := agentOrderForRequest(c)
+	if !ok {
+		return
+	}
+	if order.Status != database.OrderStatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Installation reports can only be filed for delivered orders (current: %s)", order.Status)})
+		return
+	}
+
+	uploads, ok := saveFieldPhotos(c, "photos", fmt.Sprintf("installations/%d", order.ID), 1, maxInstallationPhotos)
+	if !ok {
+		return
+	}
+	photos := make([]database.InstallationPhoto, 0, len(uploads))
+	for _, upload := range uploads {
+		photos = append(photos, database.InstallationPhoto{URL: upload.URL, OriginalName: upload.OriginalName, SizeBytes: upload.SizeBytes})
+	}
+
+	report := database.InstallationReport{
+		OrderID:       order.ID,
+		AgentID:       c.GetUint("user_id"),
+		WaterPressure: req.WaterPressure,
+		TDSReading:    *req.TDSReading,
+		DemoGiven:     *req.DemoGiven,
+		Notes:         req.Notes,
+	}
+	var replaced []database.InstallationPhoto
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var previous database.InstallationReport
+		err := tx.Preload("Photos").Where("order_id = ?", order.ID).First(&previous).Error
+		switch {
+		case err == nil:
+			replaced = previous.Photos
+			if err := tx.Unscoped().Where("report_id = ?", previous.ID).Delete(&database.InstallationPhoto{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&previous).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		report.Photos = photos
+		return tx.Create(&report).Error
+	})
+	if err != nil {
+		removeFieldPhotos(uploads)
+		log.Printf("Failed to save installation report for order %d: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save installation report"})
+		return
+	}
+	for _, photo := range replaced {
+		removeUploadedFiles(photo.URL)
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// GetInstallationReport returns the installation report of an order
+// GET /api/orders/:id/installation-report
+func GetInstallationReport(c *gin.Context) {
+	order, ok := orderForViewer(c)
+	if !ok {
+		return
+	}
+
+	var report database.InstallationReport
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Photos").Where("order_id = ?", order.ID).First(&report).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No installation report has been filed for this order"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// hasInstallationReport reports whether an agent has filed the installation
+// checklist for the order
+func hasInstallationReport(db *gorm.DB, orderID uint) (bool, error) {
+	var count int64
+	err := db.Model(&database.InstallationReport{}).Where("order_id = ?", orderID).Count(&count).Error
+	return count > 0, err
+}
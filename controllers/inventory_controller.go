@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// InventoryItemRequest contains the data for inventory item creation or update
+type InventoryItemRequest struct {
+	Name         string `json:"name" binding:"required"`
+	SKU          string `json:"sku" binding:"required"`
+	Category     string `json:"category" binding:"required,oneof=purifier filter spare_part"`
+	ProductID    *uint  `json:"product_id"`
+	Unit         string `json:"unit"`
+	ReorderLevel int    `json:"reorder_level" binding:"min=0"`
+}
+
+// CreateInventoryItemRequest adds the opening stock to an item definition
+type CreateInventoryItemRequest struct {
+	InventoryItemRequest
+	Quantity int `json:"quantity" binding:"min=0"`
+}
+
+// StockMovementRequest records stock received, returned or counted. Quantity
+// is signed; adjustments may be negative.
+type StockMovementRequest struct {
+	Quantity int    `json:"quantity" binding:"required"`
+	Reason   string `json:"reason" binding:"required,oneof=purchase adjustment return"`
+	Notes    string `json:"notes"`
+}
+
+// PartUsage is an inventory item consumed while completing a service request
+type PartUsage struct {
+	InventoryItemID uint `json:"inventory_item_id" binding:"required"`
+	Quantity        int  `json:"quantity" binding:"required,min=1"`
+}
+
+// stockError reports a stock movement that would take an item below zero
+type stockError struct {
+	Item string
+}
+
+func (e *stockError) Error() string {
+	return "Insufficient stock of " + e.Item
+}
+
+// moveStock changes an item's quantity by delta, records the movement and
+// raises or clears the low stock alert. It fails with *stockError rather than
+// letting the quantity go negative.
+func moveStock(tx *gorm.DB, item *database.InventoryItem, delta int, movement database.StockMovement) error {
+	result := tx.Model(&database.InventoryItem{}).
+		Where("id = ? AND quantity + ? >= 0", item.ID, delta).
+		Update("quantity", gorm.Expr("quantity + ?", delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &stockError{Item: item.Name}
+	}
+	if err := tx.First(item, item.ID).Error; err != nil {
+		return err
+	}
+
+	movement.InventoryItemID = item.ID
+	movement.FranchiseID = item.FranchiseID
+	movement.Quantity = delta
+	movement.BalanceAfter = item.Quantity
+	if err := tx.Create(&movement).Error; err != nil {
+		return err
+	}
+
+	return checkLowStock(tx, item)
+}
+
+// checkLowStock notifies the franchise owner once when an item falls to its
+// reorder level and re-arms the alert after the item is restocked.
+func checkLowStock(tx *gorm.DB, item *database.InventoryItem) error {
+	low := item.Quantity <= item.ReorderLevel
+	switch {
+	case low && item.LowStockAlertedAt == nil:
+		var franchise database.Franchise
+		if err := tx.Select("id, owner_id").First(&franchise, item.FranchiseID).Error; err != nil {
+			return err
+		}
+		notification := database.Notification{
+			UserID:      franchise.OwnerID,
+			Type:        "inventory",
+			RelatedID:   &item.ID,
+			RelatedType: "inventory_item",
+		}.Rendered(tx, "inventory.low_stock", database.Vars{"name": item.Name, "sku": item.SKU, "quantity": item.Quantity, "reorder_level": item.ReorderLevel})
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		item.LowStockAlertedAt = &now
+		return tx.Model(item).Update("low_stock_alerted_at", now).Error
+	case !low && item.LowStockAlertedAt != nil:
+		item.LowStockAlertedAt = nil
+		return tx.Model(item).Update("low_stock_alerted_at", nil).Error
+	}
+	return nil
+}
+
+// consumeInstalledUnit takes one purifier unit of the order's product out of
+// the franchise's stock. Franchises that do not track the product are skipped.
+func consumeInstalledUnit(tx *gorm.DB, order database.Order, userID uint) error {
+	var item database.InventoryItem
+	err := tx.Where("franchise_id = ? AND product_id = ? AND category = ?",
+		order.FranchiseID, order.ProductID, database.InventoryCategoryPurifier).
+		Order("id").First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return moveStock(tx, &item, -1, database.StockMovement{
+		Reason:      database.StockReasonInstallation,
+		RelatedType: "order",
+		RelatedID:   &order.ID,
+		CreatedByID: &userID,
+	})
+}
+
+// consumeServiceParts takes the parts used on a service visit out of the franchise's stock
+func consumeServiceParts(tx *gorm.DB, franchiseID, requestID uint, parts []PartUsage, userID uint) error {
+	for _, part := range parts {
+		var item database.InventoryItem
+		if err := tx.Where("id = ? AND franchise_id = ?", part.InventoryItemID, franchiseID).First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &stockError{Item: fmt.Sprintf("item #%d", part.InventoryItemID)}
+			}
+			return err
+		}
+		if err := moveStock(tx, &item, -part.Quantity, database.StockMovement{
+			Reason:      database.StockReasonService,
+			RelatedType: "service_request",
+			RelatedID:   &requestID,
+			CreatedByID: &userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inventoryItemForRequest loads the item named by :id if the caller may manage it
+func inventoryItemForRequest(c *gin.Context) (database.InventoryItem, bool) {
+	var item database.InventoryItem
+	itemID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inventory item ID"})
+		return item, false
+	}
+
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Model(&database.InventoryItem{}).Where("inventory_items.id = ?", itemID),
+		"inventory_items.franchise_id")
+	if !ok {
+		return item, false
+	}
+	if err := query.First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory item not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return item, false
+	}
+	return item, true
+}
+
+// validInventoryProduct checks that a purifier item points at an existing product
+func validInventoryProduct(db *gorm.DB, req InventoryItemRequest) bool {
+	if req.ProductID == nil {
+		return req.Category != database.InventoryCategoryPurifier
+	}
+	var count int64
+	db.Model(&database.Product{}).Where("id = ?", *req.ProductID).Count(&count)
+	return count > 0
+}
+
+// GetInventory lists a franchise's stock. ?low_stock=true returns only items
+// at or below their reorder level.
+func GetInventory(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Where("franchise_id = ?", franchise.ID)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if c.Query("low_stock") == "true" {
+		query = query.Where("quantity <= reorder_level")
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(sku) LIKE ?", like, like)
+	}
+
+	var items []database.InventoryItem
+	if err := query.Order("category, name").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// CreateInventoryItem adds a stock line to a franchise with its opening quantity
+func CreateInventoryItem(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req CreateInventoryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validInventoryProduct(database.DB.WithContext(c.Request.Context()), req.InventoryItemRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Purifier items require a valid product_id"})
+		return
+	}
+
+	var count int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.InventoryItem{}).Where("franchise_id = ? AND sku = ?", franchise.ID, req.SKU).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An item with this SKU already exists"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	item := database.InventoryItem{
+		FranchiseID:  franchise.ID,
+		ProductID:    req.ProductID,
+		Name:         req.Name,
+		SKU:          req.SKU,
+		Category:     req.Category,
+		Unit:         req.Unit,
+		ReorderLevel: req.ReorderLevel,
+	}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		if req.Quantity == 0 {
+			return checkLowStock(tx, &item)
+		}
+		return moveStock(tx, &item, req.Quantity, database.StockMovement{
+			Reason:      database.StockReasonPurchase,
+			Notes:       "Opening stock",
+			CreatedByID: &userID,
+		})
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating inventory item"})
+		return
+	}
+
+	recordAudit(c, nil, "inventory.create", "inventory_item", item.ID, nil, item)
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateInventoryItem updates an item's details. Quantities only change through stock movements.
+func UpdateInventoryItem(c *gin.Context) {
+	item, ok := inventoryItemForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req InventoryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validInventoryProduct(database.DB.WithContext(c.Request.Context()), req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Purifier items require a valid product_id"})
+		return
+	}
+
+	var count int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.InventoryItem{}).
+		Where("franchise_id = ? AND sku = ? AND id <> ?", item.FranchiseID, req.SKU, item.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An item with this SKU already exists"})
+		return
+	}
+
+	before := item
+	item.Name = req.Name
+	item.SKU = req.SKU
+	item.Category = req.Category
+	item.ProductID = req.ProductID
+	item.Unit = req.Unit
+	item.ReorderLevel = req.ReorderLevel
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+		return checkLowStock(tx, &item)
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating inventory item"})
+		return
+	}
+
+	recordAudit(c, nil, "inventory.update", "inventory_item", item.ID, before, item)
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteInventoryItem removes a stock line; its movement history is kept
+func DeleteInventoryItem(c *gin.Context) {
+	item, ok := inventoryItemForRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&item).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting inventory item"})
+		return
+	}
+
+	recordAudit(c, nil, "inventory.delete", "inventory_item", item.ID, gin.H{"deleted": false}, gin.H{"deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "Inventory item deleted"})
+}
+
+// RecordStockMovement records stock received, returned or corrected after a count
+func RecordStockMovement(c *gin.Context) {
+	item, ok := inventoryItemForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req StockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if req.Reason != database.StockReasonAdjustment && req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only adjustments can reduce stock"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		return moveStock(tx, &item, req.Quantity, database.StockMovement{
+			Reason:      req.Reason,
+			Notes:       req.Notes,
+			CreatedByID: &userID,
+		})
+	})
+	var stockErr *stockError
+	if errors.As(err, &stockErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording stock movement"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// GetStockMovements returns an item's movement history, newest first
+func GetStockMovements(c *gin.Context) {
+	item, ok := inventoryItemForRequest(c)
+	if !ok {
+		return
+	}
+
+	var movements []database.StockMovement
+	if err := database.DB.WithContext(c.Request.Context()).Where("inventory_item_id = ?", item.ID).Order("id DESC").Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, movements)
+}
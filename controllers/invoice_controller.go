@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// InvoiceParty is the seller or buyer named on an invoice
+type InvoiceParty struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	ZipCode string `json:"zip_code"`
+	GSTIN   string `json:"gstin,omitempty"`
+}
+
+// InvoiceLine is one charge on an invoice, before tax
+type InvoiceLine struct {
+	Description string  `json:"description"`
+	HSNCode     string  `json:"hsn_code"`
+	Amount      float64 `json:"amount"`
+}
+
+// Invoice is the tax invoice for a payment
+type Invoice struct {
+	InvoiceNumber string        `json:"invoice_number"`
+	InvoiceDate   time.Time     `json:"invoice_date"`
+	PaymentID     uint          `json:"payment_id"`
+	PaymentStatus string        `json:"payment_status"`
+	Seller        InvoiceParty  `json:"seller"`
+	Buyer         InvoiceParty  `json:"buyer"`
+	PlaceOfSupply string        `json:"place_of_supply"`
+	Lines         []InvoiceLine `json:"lines"`
+	Discount      float64       `json:"discount"`
+	CreditApplied float64       `json:"credit_applied"` // credit notes taken off this bill
+	database.TaxBreakdown
+	Total float64 `json:"total"`
+}
+
+// GetPaymentInvoice returns the GST invoice for a payment
+func GetPaymentInvoice(c *gin.Context) {
+	invoice, _, ok := paymentInvoiceForRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, invoice)
+}
+
+// paymentInvoiceForRequest builds the invoice of the :id payment if the
+// caller may see it. It writes the error response and returns false on failure.
+func paymentInvoiceForRequest(c *gin.Context) (Invoice, database.Payment, bool) {
+	invoice, payment, franchise, err := loadInvoice(database.DB.WithContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return invoice, payment, false
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return invoice, payment, false
+	}
+
+	userID := c.GetUint("user_id")
+	switch c.GetString("role") {
+	case database.RoleAdmin:
+	case database.RoleFranchiseOwner:
+		if franchise.OwnerID != userID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return invoice, payment, false
+		}
+	default:
+		if payment.CustomerID != userID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return invoice, payment, false
+		}
+	}
+	return invoice, payment, true
+}
+
+// loadInvoice loads a payment with what its invoice shows and builds the invoice
+func loadInvoice(db *gorm.DB, paymentID interface{}) (Invoice, database.Payment, database.Franchise, error) {
+	var payment database.Payment
+	var franchise database.Franchise
+	err := db.
+		Preload("Customer").
+		Preload("Order.Product").
+		Preload("Subscription.Product").
+		First(&payment, paymentID).Error
+	if err != nil {
+		return Invoice{}, payment, franchise, err
+	}
+
+	var franchiseID uint
+	var product database.Product
+	switch {
+	case payment.Subscription != nil:
+		franchiseID = payment.Subscription.FranchiseID
+		product = payment.Subscription.Product
+	case payment.Order != nil:
+		franchiseID = payment.Order.FranchiseID
+		product = payment.Order.Product
+	}
+	if franchiseID != 0 {
+		db.First(&franchise, franchiseID)
+	}
+
+	return buildInvoice(payment, franchise, product), payment, franchise, nil
+}
+
+// buildInvoice lays out a payment as invoice lines. Payments recorded before
+// GST was tracked show their full amount as the taxable value.
+func buildInvoice(payment database.Payment, franchise database.Franchise, product database.Product) Invoice {
+	tax := payment.TaxBreakdown
+	if tax.TaxableAmount == 0 && tax.TaxAmount == 0 {
+		tax.TaxableAmount = payment.Amount
+	}
+
+	invoice := Invoice{
+		InvoiceNumber: payment.InvoiceNumber,
+		InvoiceDate:   payment.CreatedAt,
+		PaymentID:     payment.ID,
+		PaymentStatus: payment.Status,
+		Seller: InvoiceParty{
+			Name:    franchise.Name,
+			Address: franchise.Address,
+			City:    franchise.City,
+			State:   franchise.State,
+			ZipCode: franchise.ZipCode,
+			GSTIN:   franchise.GSTIN,
+		},
+		Buyer: InvoiceParty{
+			Name:    payment.Customer.Name,
+			Address: payment.Customer.Address,
+			City:    payment.Customer.City,
+			State:   payment.Customer.State,
+			ZipCode: payment.Customer.ZipCode,
+		},
+		PlaceOfSupply: payment.Customer.State,
+		TaxBreakdown:  tax,
+		CreditApplied: payment.CreditApplied,
+		Total:         tax.Total(),
+	}
+	if strings.TrimSpace(invoice.PlaceOfSupply) == "" {
+		invoice.PlaceOfSupply = franchise.State
+	}
+
+	if payment.PaymentType == "initial" && payment.Order != nil {
+		order := payment.Order
+		invoice.Discount = order.DiscountAmount
+		rent := tax.TaxableAmount + order.DiscountAmount - order.SecurityDeposit - order.InstallationFee
+		invoice.Lines = []InvoiceLine{
+			{Description: "Security deposit", HSNCode: product.HSNCode, Amount: order.SecurityDeposit},
+			{Description: "Installation fee", HSNCode: product.HSNCode, Amount: order.InstallationFee},
+			{Description: fmt.Sprintf("%s - rent", product.Name), HSNCode: product.HSNCode, Amount: roundPaise(rent)},
+		}
+		return invoice
+	}
+
+	invoice.Lines = []InvoiceLine{
+		{Description: fmt.Sprintf("%s - monthly rent", product.Name), HSNCode: product.HSNCode, Amount: roundPaise(tax.TaxableAmount + payment.CreditApplied)},
+	}
+	return invoice
+}
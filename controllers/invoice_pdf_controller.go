@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/database"
+	"aquahome/queue"
+	"aquahome/utils"
+)
+
+// TaskInvoicePDF renders a payment's invoice PDF on the job queue
+const TaskInvoicePDF = "invoice.pdf"
+
+// invoicePDFRetryAfter is how long clients are told to wait for a PDF being
+// rendered, in seconds
+const invoicePDFRetryAfter = 5
+
+// invoicePDFPayload names the payment whose invoice is rendered
+type invoicePDFPayload struct {
+	PaymentID uint `json:"payment_id"`
+}
+
+func init() {
+	queue.Register(TaskInvoicePDF, func(_ context.Context, payload json.RawMessage) error {
+		var p invoicePDFPayload
+		if err := queue.Decode(payload, &p); err != nil {
+			return err
+		}
+		_, err := storeInvoicePDF(p.PaymentID)
+		return err
+	}, queue.Options{MaxRetry: 5, Timeout: time.Minute})
+}
+
+// storeInvoicePDF renders a payment's invoice and saves it, replacing one
+// rendered for an earlier status
+func storeInvoicePDF(paymentID uint) (database.InvoiceDocument, error) {
+	invoice, payment, _, err := loadInvoice(database.DB, paymentID)
+	if err != nil {
+		return database.InvoiceDocument{}, err
+	}
+	document := database.InvoiceDocument{
+		PaymentID:     payment.ID,
+		PaymentStatus: payment.Status,
+		Document:      renderInvoicePDF(invoice),
+	}
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "payment_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"payment_status", "document", "updated_at"}),
+	}).Create(&document).Error
+	return document, err
+}
+
+// renderInvoicePDF lays out an invoice as a PDF
+func renderInvoicePDF(invoice Invoice) []byte {
+	doc := utils.NewTextDocument()
+	doc.Title("Tax Invoice")
+	doc.Paragraph(fmt.Sprintf("Invoice number: %s", invoice.InvoiceNumber))
+	doc.Paragraph(fmt.Sprintf("Invoice date: %s", invoice.InvoiceDate.Format("02 Jan 2006")))
+	doc.Paragraph(fmt.Sprintf("Payment: #%d (%s)", invoice.PaymentID, invoice.PaymentStatus))
+	doc.Paragraph(fmt.Sprintf("Place of supply: %s", invoice.PlaceOfSupply))
+
+	for _, party := range []struct {
+		heading string
+		party   InvoiceParty
+	}{{"Seller", invoice.Seller}, {"Billed to", invoice.Buyer}} {
+		doc.Heading(party.heading)
+		doc.Paragraph(party.party.Name)
+		doc.Paragraph(party.party.Address)
+		doc.Paragraph(fmt.Sprintf("%s, %s %s", party.party.City, party.party.State, party.party.ZipCode))
+		if party.party.GSTIN != "" {
+			doc.Paragraph("GSTIN: " + party.party.GSTIN)
+		}
+	}
+
+	doc.Heading("Charges")
+	for _, line := range invoice.Lines {
+		doc.Paragraph(fmt.Sprintf("%s (HSN %s): Rs. %.2f", line.Description, line.HSNCode, line.Amount))
+	}
+	if invoice.Discount > 0 {
+		doc.Paragraph(fmt.Sprintf("Discount: -Rs. %.2f", invoice.Discount))
+	}
+	if invoice.CreditApplied > 0 {
+		doc.Paragraph(fmt.Sprintf("Credit applied: -Rs. %.2f", invoice.CreditApplied))
+	}
+
+	doc.Heading("Tax")
+	doc.Paragraph(fmt.Sprintf("Taxable value: Rs. %.2f", invoice.TaxableAmount))
+	if invoice.IGSTAmount > 0 {
+		doc.Paragraph(fmt.Sprintf("IGST @ %.2f%%: Rs. %.2f", invoice.TaxRate, invoice.IGSTAmount))
+	} else {
+		doc.Paragraph(fmt.Sprintf("CGST @ %.2f%%: Rs. %.2f", invoice.TaxRate/2, invoice.CGSTAmount))
+		doc.Paragraph(fmt.Sprintf("SGST @ %.2f%%: Rs. %.2f", invoice.TaxRate/2, invoice.SGSTAmount))
+	}
+	doc.Heading(fmt.Sprintf("Total: Rs. %.2f", invoice.Total))
+	return doc.Bytes()
+}
+
+// GetPaymentInvoicePDF sends the invoice of a payment as a PDF. The PDF is
+// rendered on the job queue; until it is ready the answer is 202 with a
+// Retry-After header.
+// GET /api/payments/:id/invoice/pdf
+func GetPaymentInvoicePDF(c *gin.Context) {
+	_, payment, ok := paymentInvoiceForRequest(c)
+	if !ok {
+		return
+	}
+
+	var document database.InvoiceDocument
+	err := database.DB.WithContext(c.Request.Context()).Where("payment_id = ?", payment.ID).First(&document).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if err != nil || document.PaymentStatus != payment.Status {
+		_, err := queue.EnqueueUnique(TaskInvoicePDF, strconv.FormatUint(uint64(payment.ID), 10), invoicePDFPayload{PaymentID: payment.ID})
+		if err == nil {
+			c.Header("Retry-After", strconv.Itoa(invoicePDFRetryAfter))
+			c.JSON(http.StatusAccepted, gin.H{"status": "rendering", "message": "The invoice PDF is being prepared, please try again shortly"})
+			return
+		}
+		// Without the queue the PDF is rendered in the request
+		log.Printf("⚠️ Could not queue invoice PDF for payment %d, rendering it here: %v", payment.ID, err)
+		if document, err = storeInvoicePDF(payment.ID); err != nil {
+			log.Printf("Failed to render invoice PDF for payment %d: %v", payment.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render invoice"})
+			return
+		}
+	}
+
+	name := payment.InvoiceNumber
+	if name == "" {
+		name = fmt.Sprintf("payment-%d", payment.ID)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%s.pdf"`, name))
+	c.Data(http.StatusOK, "application/pdf", document.Document)
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/queue"
+)
+
+// GetJobQueue shows the job queue's depth and the tasks waiting to be
+// retried or dead-lettered, up to ?limit of each (Admin only)
+// GET /api/admin/jobs
+func GetJobQueue(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	ctx := c.Request.Context()
+	stats, err := queue.Default.Stats(ctx)
+	if err != nil {
+		log.Printf("Job queue error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the job queue"})
+		return
+	}
+	retrying, err := queue.Default.List(ctx, queue.StateRetry, limit)
+	if err != nil {
+		log.Printf("Job queue error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the job queue"})
+		return
+	}
+	dead, err := queue.Default.List(ctx, queue.StateDead, limit)
+	if err != nil {
+		log.Printf("Job queue error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the job queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats, "retrying": retrying, "dead": dead})
+}
+
+// RetryDeadJob puts a dead-lettered task back on the queue with its attempts
+// reset (Admin only)
+// POST /api/admin/jobs/dead/:id/retry
+func RetryDeadJob(c *gin.Context) {
+	id := c.Param("id")
+	requeued, err := queue.Default.Requeue(c.Request.Context(), id)
+	if err != nil {
+		log.Printf("Job queue error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue the job"})
+		return
+	}
+	if !requeued {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead job not found"})
+		return
+	}
+
+	recordAudit(c, nil, "job.retry", "job", 0, nil, gin.H{"task_id": id})
+	c.JSON(http.StatusOK, gin.H{"message": "Job queued again", "id": id})
+}
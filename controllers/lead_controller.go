@@ -0,0 +1,500 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/risk"
+	"aquahome/utils"
+)
+
+// CreateLeadRequest is the public demo-booking form
+type CreateLeadRequest struct {
+	Name          string     `json:"name" binding:"required,max=100"`
+	Phone         string     `json:"phone" binding:"required"`
+	Pincode       string     `json:"pincode" binding:"required,len=6,numeric"`
+	PreferredSlot *time.Time `json:"preferred_slot"`
+	CaptchaToken  string     `json:"captcha_token"`
+}
+
+// UpdateLeadRequest records a franchise's follow-up on a lead. Admins can
+// also route a lead to a franchise. Leads become converted only through
+// conversion into a customer.
+type UpdateLeadRequest struct {
+	Status        *string    `json:"status" binding:"omitempty,oneof=new contacted demo_scheduled qualified lost"`
+	Notes         *string    `json:"notes" binding:"omitempty,max=2000"`
+	PreferredSlot *time.Time `json:"preferred_slot"`
+	FranchiseID   *uint      `json:"franchise_id"`
+}
+
+// ConvertLeadRequest turns a qualified lead into a customer with a draft
+// order: the pending order and initial payment checkout would create. The
+// lead's phone, name and pincode are used for the account and address.
+type ConvertLeadRequest struct {
+	Email          string `json:"email" binding:"omitempty,email"`
+	ProductID      uint   `json:"product_id" binding:"required"`
+	VariantID      *uint  `json:"variant_id"`
+	PlanID         *uint  `json:"plan_id"`
+	RentalDuration int    `json:"rental_duration" binding:"required,min=1"`
+	Line1          string `json:"line1" binding:"required,max=200"`
+	Line2          string `json:"line2" binding:"max=200"`
+	City           string `json:"city" binding:"required,max=100"`
+	State          string `json:"state" binding:"required,max=100"`
+	Notes          string `json:"notes" binding:"max=500"`
+	// Also send a Razorpay payment link for the initial payment
+	SendPaymentLink  bool `json:"send_payment_link"`
+	PaymentLinkHours int  `json:"payment_link_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// CreateLead takes a demo request from the website and routes it to the
+// franchise serving the pincode. A repeat request from the same phone adds a
+// new lead linked to the open one rather than changing it, as the form is
+// open to anyone. (Public)
+// POST /api/public/leads
+func CreateLead(c *gin.Context) {
+	var req CreateLeadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	phone := utils.NormalizePhone(req.Phone)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid mobile number is required"})
+		return
+	}
+	if req.PreferredSlot != nil && req.PreferredSlot.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Preferred slot must be in the future"})
+		return
+	}
+
+	human, err := utils.VerifyCaptcha(c.Request.Context(), req.CaptchaToken, c.ClientIP())
+	if err != nil {
+		log.Printf("Captcha verification failed: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Demo requests are unavailable right now, please try again later"})
+		return
+	}
+	if !human {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CAPTCHA verification failed"})
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	lead := database.Lead{
+		Name:          strings.TrimSpace(req.Name),
+		Phone:         phone,
+		Pincode:       req.Pincode,
+		PreferredSlot: req.PreferredSlot,
+		Status:        database.LeadStatusNew,
+		Source:        database.LeadSourceWebsite,
+	}
+	franchise, err := matchFranchise(db, 0, 0, req.Pincode)
+	switch {
+	case err == nil:
+		lead.FranchiseID = &franchise.ID
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var open database.Lead
+		err := tx.Where("phone = ? AND status NOT IN ?", phone,
+			[]string{database.LeadStatusConverted, database.LeadStatusLost}).
+			Order("id DESC").First(&open).Error
+		switch {
+		case err == nil:
+			lead.RepeatOfID = &open.ID
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if err := tx.Create(&lead).Error; err != nil {
+			return err
+		}
+		if lead.FranchiseID == nil {
+			return nil
+		}
+		return publishLeadReceived(tx, lead)
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save demo request"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Thanks! We'll call you to confirm your demo.",
+		"id":          lead.ID,
+		"serviceable": lead.FranchiseID != nil,
+	})
+}
+
+// leadForRequest loads the lead named in the URL if it belongs to one of the
+// caller's franchises. Admins reach every lead.
+func leadForRequest(c *gin.Context) (database.Lead, bool) {
+	var lead database.Lead
+	leadID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lead ID"})
+		return lead, false
+	}
+
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Model(&database.Lead{}).Where("leads.id = ?", leadID),
+		"leads.franchise_id")
+	if !ok {
+		return lead, false
+	}
+	if err := query.First(&lead).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Lead not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return lead, false
+	}
+	return lead, true
+}
+
+// GetLeads lists the leads of the caller's franchises, newest first, with
+// ?status and ?search on name or phone. Admins see every lead; ?unassigned=true
+// lists those no franchise serves.
+// GET /api/franchise/leads
+func GetLeads(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Model(&database.Lead{}), "leads.franchise_id")
+	if !ok {
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR phone LIKE ?", like, like)
+	}
+	if c.Query("unassigned") == "true" {
+		query = query.Where("franchise_id IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leads"})
+		return
+	}
+	var leads []database.Lead
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&leads).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leads"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"leads": leads, "total": total, "page": page, "limit": limit})
+}
+
+// UpdateLead records follow-up on a lead: its status, notes and demo slot
+// PUT /api/franchise/leads/:id
+func UpdateLead(c *gin.Context) {
+	lead, ok := leadForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateLeadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if lead.Status == database.LeadStatusConverted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Lead has already been converted"})
+		return
+	}
+
+	before := lead
+	if req.FranchiseID != nil {
+		if c.GetString("role") != database.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can route leads to another franchise"})
+			return
+		}
+		var count int64
+		database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{}).Where("id = ?", *req.FranchiseID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not found"})
+			return
+		}
+		lead.FranchiseID = req.FranchiseID
+	}
+	if req.Status != nil {
+		lead.Status = *req.Status
+		if lead.Status != database.LeadStatusNew && lead.ContactedAt == nil {
+			now := time.Now()
+			lead.ContactedAt = &now
+		}
+	}
+	if req.Notes != nil {
+		lead.Notes = *req.Notes
+	}
+	if req.PreferredSlot != nil {
+		lead.PreferredSlot = req.PreferredSlot
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&lead).Error; err != nil {
+			return err
+		}
+		if before.FranchiseID == nil && lead.FranchiseID != nil {
+			return publishLeadReceived(tx, lead)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating lead"})
+		return
+	}
+
+	recordAudit(c, nil, "lead.update", "lead", lead.ID, before, lead)
+	c.JSON(http.StatusOK, lead)
+}
+
+// ConvertLead turns a qualified lead into a customer account, reusing the
+// customer who already has its phone number, and drafts their order: a
+// pending order and initial payment, in one transaction with the lead. The
+// customer is sent an invite to sign in with their phone and, when asked, a
+// payment link. A payment link that can't be created doesn't undo the
+// conversion; it is reported and can be sent again from the payment.
+// POST /api/franchise/leads/:id/convert
+func ConvertLead(c *gin.Context) {
+	lead, ok := leadForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req ConvertLeadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if lead.Status != database.LeadStatusQualified {
+		apperror.Respond(c, apperror.Conflict("Only qualified leads can be converted"))
+		return
+	}
+	if lead.FranchiseID == nil {
+		apperror.Respond(c, apperror.BadRequest("Route the lead to a franchise first"))
+		return
+	}
+	if req.PaymentLinkHours == 0 {
+		req.PaymentLinkHours = defaultPaymentLinkHours
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	var product database.Product
+	if err := db.First(&product, req.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Product not found"))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if !product.IsActive {
+		apperror.Respond(c, apperror.BadRequest("Product is not available"))
+		return
+	}
+	var franchise database.Franchise
+	if err := db.First(&franchise, *lead.FranchiseID).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if !franchise.IsActive {
+		apperror.Respond(c, apperror.BadRequest("Franchise is not active"))
+		return
+	}
+	price, err := resolvePricing(db, product, req.VariantID, req.PlanID, req.RentalDuration)
+	if err != nil {
+		if isPricingError(err) {
+			apperror.Respond(c, apperror.BadRequest(err.Error()))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+
+	actorID := c.GetUint("user_id")
+	before := lead
+	var customer database.User
+	var order database.Order
+	var payment database.Payment
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Claim the lead so two conversions can't both go through
+		claimed := tx.Model(&database.Lead{}).
+			Where("id = ? AND status = ?", lead.ID, database.LeadStatusQualified).
+			Update("status", database.LeadStatusConverted)
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return apperror.Conflict("Lead has already been converted")
+		}
+
+		err := tx.Where("phone IN ?", []string{lead.Phone, "+91" + lead.Phone, "91" + lead.Phone, "0" + lead.Phone}).
+			Order("id").First(&customer).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if req.Email != "" {
+				var taken int64
+				if err := tx.Model(&database.User{}).Where("email = ?", req.Email).Count(&taken).Error; err != nil {
+					return err
+				}
+				if taken > 0 {
+					return apperror.Conflict("Email is already registered")
+				}
+			}
+			customer = database.User{
+				Name:    lead.Name,
+				Email:   req.Email,
+				Phone:   lead.Phone,
+				Role:    database.RoleCustomer,
+				Address: strings.TrimSpace(req.Line1 + " " + req.Line2),
+				City:    req.City,
+				State:   req.State,
+				ZipCode: lead.Pincode,
+			}
+			if err := tx.Create(&customer).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case customer.Role != database.RoleCustomer:
+			return apperror.Conflict("This phone number belongs to a staff account")
+		}
+
+		override, err := orderRiskCheck(tx, customer.ID)
+		if err != nil {
+			return err
+		}
+
+		var addresses int64
+		if err := tx.Model(&database.Address{}).Where("user_id = ?", customer.ID).Count(&addresses).Error; err != nil {
+			return err
+		}
+		address := database.Address{
+			UserID:            customer.ID,
+			Label:             "Home",
+			ContactName:       customer.Name,
+			Phone:             lead.Phone,
+			Line1:             req.Line1,
+			Line2:             req.Line2,
+			City:              req.City,
+			State:             req.State,
+			ZipCode:           lead.Pincode,
+			IsDefaultShipping: addresses == 0,
+			IsDefaultBilling:  addresses == 0,
+		}
+		if err := tx.Create(&address).Error; err != nil {
+			return err
+		}
+
+		gst, err := loadGSTContext(tx, product.ID, franchise.ID, customer.ID)
+		if err != nil {
+			return err
+		}
+		tax := gst.onTaxable(price.initialAmount(1))
+		order = database.Order{
+			CustomerID:         customer.ID,
+			ProductID:          product.ID,
+			FranchiseID:        franchise.ID,
+			OrderType:          "rental",
+			Status:             database.OrderStatusPending,
+			ShippingAddress:    address.Formatted(),
+			BillingAddress:     address.Formatted(),
+			ShippingAddressID:  &address.ID,
+			BillingAddressID:   &address.ID,
+			RentalStartDate:    time.Now(),
+			RentalDuration:     req.RentalDuration,
+			VariantID:          price.VariantID,
+			PlanID:             price.PlanID,
+			PlanTerms:          price.Terms,
+			MonthlyRent:        price.MonthlyRent,
+			SecurityDeposit:    price.SecurityDeposit,
+			InstallationFee:    price.InstallationFee,
+			TotalInitialAmount: tax.Total(),
+			TaxBreakdown:       tax,
+			Notes:              req.Notes,
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if err := recordOrderStatus(tx, order.ID, "", order.Status, actorID, fmt.Sprintf("Order drafted from lead #%d", lead.ID)); err != nil {
+			return err
+		}
+		if override != nil {
+			if err := risk.UseOverride(tx, override, order.ID); err != nil {
+				return apperror.Forbidden("Orders cannot be placed from this account. Please contact support.").Wrap(err)
+			}
+		}
+
+		payment = database.Payment{
+			CustomerID:    customer.ID,
+			OrderID:       &order.ID,
+			Amount:        order.TotalInitialAmount,
+			PaymentType:   "initial",
+			Status:        database.PaymentStatusPending,
+			InvoiceNumber: generateInvoiceNumber(int64(order.ID)),
+			Notes:         "Initial payment for order",
+			TaxBreakdown:  tax,
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		lead.Status = database.LeadStatusConverted
+		lead.CustomerID = &customer.ID
+		lead.OrderID = &order.ID
+		lead.ConvertedAt = &now
+		lead.ConvertedByID = &actorID
+		if err := tx.Save(&lead).Error; err != nil {
+			return err
+		}
+		return publishLeadConverted(tx, order, product.Name)
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	recordAudit(c, nil, "lead.convert", "lead", lead.ID, before, lead)
+
+	response := gin.H{"lead": lead, "customer": customer, "order": order, "payment": payment}
+	if req.SendPaymentLink {
+		payment.Customer = customer
+		link, err := sendPaymentLink(c, payment, fmt.Sprintf("order #%d", order.ID), req.PaymentLinkHours)
+		if err != nil {
+			log.Printf("Payment link for converted lead %d failed: %v", lead.ID, err)
+			response["payment_link_error"] = "The payment link could not be created; send it again from the payment"
+		} else {
+			recordAudit(c, nil, "payment.link_created", "payment", payment.ID, nil, link)
+			response["payment_link"] = link
+		}
+	}
+	c.JSON(http.StatusCreated, response)
+}
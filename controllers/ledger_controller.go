@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/ledger"
+)
+
+// respondLedgerStatement writes an owner's account balances and, newest
+// first, a page of the entries posted to those accounts
+func respondLedgerStatement(c *gin.Context, ownerType string, ownerID uint) {
+	balances, err := ledger.Balances(database.ReadDB().WithContext(c.Request.Context()), ledger.OwnedBy(ownerType, ownerID))
+	if err != nil {
+		log.Printf("Error computing ledger balances: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	query := database.ReadDB().WithContext(c.Request.Context()).Model(&database.LedgerEntry{}).
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = ledger_entries.account_id").
+		Scopes(ledger.OwnedBy(ownerType, ownerID))
+	page, limit, ok := keysetPage(c, dates.apply(query, "ledger_entries.created_at"), "ledger_entries")
+	if !ok {
+		return
+	}
+	var entries []database.LedgerEntry
+	if err := page.Preload("Account").Find(&entries).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+	entries, next := nextCursor(entries, limit, func(e database.LedgerEntry) (time.Time, uint) {
+		return e.CreatedAt, e.ID
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"owner_type":  ownerType,
+		"owner_id":    ownerID,
+		"accounts":    balances,
+		"entries":     entries,
+		"next_cursor": next,
+	})
+}
+
+func ownerIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetCustomerLedger shows a customer's balances and ledger entries (Admin only)
+// GET /api/admin/ledger/customers/:id
+func GetCustomerLedger(c *gin.Context) {
+	if id, ok := ownerIDParam(c); ok {
+		respondLedgerStatement(c, ledger.OwnerCustomer, id)
+	}
+}
+
+// GetFranchiseLedger shows a franchise's balances and ledger entries (Admin only)
+// GET /api/admin/ledger/franchises/:id
+func GetFranchiseLedger(c *gin.Context) {
+	if id, ok := ownerIDParam(c); ok {
+		respondLedgerStatement(c, ledger.OwnerFranchise, id)
+	}
+}
+
+// GetMyLedger shows the signed-in customer their balances and ledger entries
+// GET /api/payments/ledger
+func GetMyLedger(c *gin.Context) {
+	respondLedgerStatement(c, ledger.OwnerCustomer, c.GetUint("user_id"))
+}
+
+// GetMyFranchiseLedger shows a franchise owner the commission they are owed
+// and how it was accrued and paid
+// GET /api/franchise/ledger
+func GetMyFranchiseLedger(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+	respondLedgerStatement(c, ledger.OwnerFranchise, franchise.ID)
+}
+
+// GetTrialBalance lists ledger accounts with their balances, and checks that
+// debits equal credits across the whole ledger (Admin only). ?owner_type
+// narrows the list to platform, customer or franchise accounts.
+// GET /api/admin/ledger/accounts
+func GetTrialBalance(c *gin.Context) {
+	scope := ledger.AllAccounts
+	switch ownerType := c.Query("owner_type"); ownerType {
+	case "":
+	case "platform":
+		scope = func(db *gorm.DB) *gorm.DB { return db.Where("ledger_accounts.owner_type = ''") }
+	case ledger.OwnerCustomer, ledger.OwnerFranchise:
+		scope = func(db *gorm.DB) *gorm.DB { return db.Where("ledger_accounts.owner_type = ?", ownerType) }
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner_type must be platform, customer or franchise"})
+		return
+	}
+
+	balances, err := ledger.Balances(database.ReadDB().WithContext(c.Request.Context()), scope)
+	if err != nil {
+		log.Printf("Error computing ledger balances: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute trial balance"})
+		return
+	}
+
+	var totals struct {
+		Debits  float64 `json:"debits"`
+		Credits float64 `json:"credits"`
+	}
+	if err := database.ReadDB().WithContext(c.Request.Context()).Model(&database.LedgerEntry{}).
+		Select("COALESCE(SUM(debit), 0) AS debits, COALESCE(SUM(credit), 0) AS credits").
+		Scan(&totals).Error; err != nil {
+		log.Printf("Error computing ledger totals: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute trial balance"})
+		return
+	}
+	totals.Debits = roundPaise(totals.Debits)
+	totals.Credits = roundPaise(totals.Credits)
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts": balances,
+		"totals":   totals,
+		"balanced": math.Abs(totals.Debits-totals.Credits) < 0.005,
+	})
+}
+
+// BackfillLedger posts ledger journals for payments, refunds, late fees,
+// deposit settlements and franchise settlements recorded before the ledger
+// existed. It is safe to run again (Admin only).
+// POST /api/admin/ledger/backfill
+func BackfillLedger(c *gin.Context) {
+	result, err := ledger.Backfill(database.DB.WithContext(c.Request.Context()))
+	if err != nil {
+		log.Printf("Ledger backfill failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ledger backfill failed", "progress": result})
+		return
+	}
+	recordAudit(c, nil, "ledger.backfill", "ledger", 0, nil, result)
+	c.JSON(http.StatusOK, result)
+}
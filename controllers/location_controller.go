@@ -11,6 +11,8 @@ import (
 	"github.com/lib/pq"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
+	"aquahome/cache"
 	"aquahome/database"
 )
 
@@ -42,6 +44,7 @@ type FranchiseRequest struct {
 	ZipCode     string `json:"zip_code" binding:"required"`
 	Phone       string `json:"phone" binding:"required"`
 	Email       string `json:"email" binding:"required,email"`
+	GSTIN       string `json:"gstin" binding:"omitempty,len=15"`
 	LocationIDs []uint `json:"location_ids"` //
 }
 
@@ -70,14 +73,14 @@ func CreateFranchise(c *gin.Context) {
 	var franchiseRequest FranchiseRequest
 	if err := c.ShouldBindJSON(&franchiseRequest); err != nil {
 		log.Printf("Invalid request data: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	fmt.Printf(" Received Payload: %+v\n", franchiseRequest)
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -94,6 +97,7 @@ func CreateFranchise(c *gin.Context) {
 		ZipCode:       franchiseRequest.ZipCode,
 		Phone:         franchiseRequest.Phone,
 		Email:         franchiseRequest.Email,
+		GSTIN:         franchiseRequest.GSTIN,
 		IsActive:      false,     // Initially inactive until approved
 		ApprovalState: "pending", // Initial approval state
 	}
@@ -130,12 +134,10 @@ func CreateFranchise(c *gin.Context) {
 	// Create notification for franchise owner
 	ownerNotification := database.Notification{
 		UserID:      ownerID,
-		Title:       "Franchise Application Submitted",
-		Message:     "Your franchise application for " + franchiseRequest.Name + " has been submitted and is pending approval.",
 		Type:        "franchise",
 		RelatedID:   &franchise.ID,
 		RelatedType: "franchise",
-	}
+	}.Rendered(tx, "franchise.application_submitted", database.Vars{"name": franchiseRequest.Name})
 
 	result = tx.Create(&ownerNotification)
 	if result.Error != nil {
@@ -148,17 +150,15 @@ func CreateFranchise(c *gin.Context) {
 	// Create notification for admin
 	// First, find an admin user to notify
 	var adminUser database.User
-	adminResult := database.DB.Where("role = ?", database.RoleAdmin).First(&adminUser)
+	adminResult := database.DB.WithContext(c.Request.Context()).Where("role = ?", database.RoleAdmin).First(&adminUser)
 
 	if adminResult.Error == nil {
 		adminNotification := database.Notification{
 			UserID:      adminUser.ID,
-			Title:       "New Franchise Application",
-			Message:     "A new franchise application has been submitted by " + franchiseRequest.Name + " and requires your approval.",
 			Type:        "franchise",
 			RelatedID:   &franchise.ID,
 			RelatedType: "franchise",
-		}
+		}.Rendered(tx, "franchise.application_received", database.Vars{"name": franchiseRequest.Name})
 
 		if err := tx.Create(&adminNotification).Error; err != nil {
 			log.Printf("Error creating admin notification: %v", err)
@@ -175,7 +175,10 @@ func CreateFranchise(c *gin.Context) {
 		return
 	}
 
-	user.FranchiseID = &franchise.ID
+	// An owner's first franchise stays their primary one
+	if user.FranchiseID == nil {
+		user.FranchiseID = &franchise.ID
+	}
 	if err := tx.Save(&user).Error; err != nil {
 		tx.Rollback()
 		log.Printf("Database error: %v", err)
@@ -216,7 +219,7 @@ func GetFranchises(c *gin.Context) {
 
 	var franchises []FranchiseWithOwner
 
-	query := database.DB.Table("franchises").
+	query := database.DB.WithContext(c.Request.Context()).Table("franchises").
 		Select(`
 			franchises.id, 
 			franchises.name, 
@@ -237,6 +240,10 @@ func GetFranchises(c *gin.Context) {
 		Joins("JOIN users ON franchises.owner_id = users.id").
 		Order("franchises.created_at DESC")
 
+	if !wantsDeleted(c) {
+		query = query.Where(notDeleted("franchises"))
+	}
+
 	// Apply role-based filtering
 	switch role {
 	case "admin":
@@ -287,10 +294,11 @@ func PublicGetFranchiseByID(c *gin.Context) {
 	var franchise FranchiseDetail
 
 	// Create base query
-	query := database.DB.Table("franchises").
+	query := database.DB.WithContext(c.Request.Context()).Table("franchises").
 		Select("franchises.*, users.name as owner_name").
 		Joins("JOIN users ON franchises.owner_id = users.id").
-		Where("franchises.id = ?", franchiseID)
+		Where("franchises.id = ?", franchiseID).
+		Where(notDeleted("franchises"))
 
 	// Apply role-based conditions
 	switch role {
@@ -322,12 +330,12 @@ func PublicGetFranchiseByID(c *gin.Context) {
 		var pendingServices int64
 
 		// Get active subscriptions count
-		database.DB.Model(&database.Subscription{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).
 			Where("franchise_id = ? AND status = ?", franchiseID, database.SubscriptionStatusActive).
 			Count(&activeSubscriptions)
 
 		// Get pending service requests count
-		database.DB.Model(&database.ServiceRequest{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Where("franchise_id = ? AND status IN (?, ?)",
 				franchiseID, database.ServiceStatusPending, database.ServiceStatusScheduled).
 			Count(&pendingServices)
@@ -366,7 +374,7 @@ func UpdateFranchise(c *gin.Context) {
 
 	// Find franchise to check existence and ownership
 	var franchise database.Franchise
-	result := database.DB.First(&franchise, franchiseID)
+	result := database.DB.WithContext(c.Request.Context()).First(&franchise, franchiseID)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
@@ -382,10 +390,11 @@ func UpdateFranchise(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to update this franchise"})
 		return
 	}
+	before := franchise
 
 	var franchiseRequest FranchiseRequest
 	if err := c.ShouldBindJSON(&franchiseRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -397,15 +406,16 @@ func UpdateFranchise(c *gin.Context) {
 	franchise.ZipCode = franchiseRequest.ZipCode
 	franchise.Phone = franchiseRequest.Phone
 	franchise.Email = franchiseRequest.Email
+	franchise.GSTIN = franchiseRequest.GSTIN
 
 	//  Update linked locations if provided
 	if len(franchiseRequest.LocationIDs) > 0 {
 		var locations []database.Location
-		if err := database.DB.Where("id IN ?", franchiseRequest.LocationIDs).Find(&locations).Error; err != nil {
+		if err := database.DB.WithContext(c.Request.Context()).Where("id IN ?", franchiseRequest.LocationIDs).Find(&locations).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location IDs"})
 			return
 		}
-		if err := database.DB.Model(&franchise).Association("Locations").Replace(&locations); err != nil {
+		if err := database.DB.WithContext(c.Request.Context()).Model(&franchise).Association("Locations").Replace(&locations); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update linked locations"})
 			return
 		}
@@ -417,12 +427,13 @@ func UpdateFranchise(c *gin.Context) {
 	}
 
 	// Save changes
-	result = database.DB.Save(&franchise)
+	result = database.DB.WithContext(c.Request.Context()).Save(&franchise)
 	if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating franchise"})
 		return
 	}
+	recordAudit(c, nil, "franchise.update", "franchise", franchise.ID, before, franchise)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Franchise updated successfully"})
 }
@@ -444,7 +455,7 @@ func ApproveFranchise(c *gin.Context) {
 
 	// Find franchise to check existence and status
 	var franchise database.Franchise
-	result := database.DB.First(&franchise, franchiseID)
+	result := database.DB.WithContext(c.Request.Context()).First(&franchise, franchiseID)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
@@ -461,7 +472,7 @@ func ApproveFranchise(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -469,6 +480,7 @@ func ApproveFranchise(c *gin.Context) {
 	}
 
 	// Update franchise status
+	before := franchise
 	franchise.ApprovalState = "approved"
 	franchise.IsActive = true
 
@@ -478,16 +490,15 @@ func ApproveFranchise(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error approving franchise"})
 		return
 	}
+	recordAudit(c, tx, "franchise.approve", "franchise", franchise.ID, before, franchise)
 
 	// Create notification for franchise owner
 	notification := database.Notification{
 		UserID:      franchise.OwnerID,
-		Title:       "Franchise Application Approved",
-		Message:     "Your franchise application has been approved. You can now start serving customers.",
 		Type:        "franchise",
 		RelatedID:   &franchise.ID,
 		RelatedType: "franchise",
-	}
+	}.Rendered(tx, "franchise.approved", nil)
 
 	if err := tx.Create(&notification).Error; err != nil {
 		tx.Rollback()
@@ -527,13 +538,13 @@ func RejectFranchise(c *gin.Context) {
 
 	var rejectRequest RejectRequest
 	if err := c.ShouldBindJSON(&rejectRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason for rejection is required"})
+		apperror.Respond(c, apperror.Binding(err).WithMessage("Reason for rejection is required"))
 		return
 	}
 
 	// Find franchise to check existence and status
 	var franchise database.Franchise
-	result := database.DB.First(&franchise, franchiseID)
+	result := database.DB.WithContext(c.Request.Context()).First(&franchise, franchiseID)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
@@ -550,7 +561,7 @@ func RejectFranchise(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -558,6 +569,7 @@ func RejectFranchise(c *gin.Context) {
 	}
 
 	// Update franchise status
+	before := franchise
 	franchise.ApprovalState = "rejected"
 	franchise.IsActive = false
 
@@ -567,16 +579,19 @@ func RejectFranchise(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error rejecting franchise"})
 		return
 	}
+	recordAudit(c, tx, "franchise.reject", "franchise", franchise.ID, before, gin.H{
+		"approval_state": franchise.ApprovalState,
+		"is_active":      franchise.IsActive,
+		"reason":         rejectRequest.Reason,
+	})
 
 	// Create notification for franchise owner
 	notification := database.Notification{
 		UserID:      franchise.OwnerID,
-		Title:       "Franchise Application Rejected",
-		Message:     "Your franchise application has been rejected. Reason: " + rejectRequest.Reason,
 		Type:        "franchise",
 		RelatedID:   &franchise.ID,
 		RelatedType: "franchise",
-	}
+	}.Rendered(tx, "franchise.rejected", database.Vars{"reason": rejectRequest.Reason})
 
 	if err := tx.Create(&notification).Error; err != nil {
 		tx.Rollback()
@@ -618,7 +633,7 @@ func GetFranchiseServiceAgents(c *gin.Context) {
 	// If franchise owner, check if they own the franchise
 	if role == "franchise_owner" {
 		var franchise database.Franchise
-		result := database.DB.Select("owner_id").First(&franchise, franchiseID)
+		result := database.DB.WithContext(c.Request.Context()).Select("owner_id").First(&franchise, franchiseID)
 		if result.Error != nil {
 			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
@@ -647,7 +662,7 @@ func GetFranchiseServiceAgents(c *gin.Context) {
 	var serviceAgents []ServiceAgentInfo
 
 	// Get service agents for the franchise using GORM
-	result := database.DB.Model(&database.User{}).
+	result := database.DB.WithContext(c.Request.Context()).Model(&database.User{}).
 		Select("id, name, email, phone, profile_picture").
 		Where("franchise_id = ? AND role = ?", franchiseID, database.RoleServiceAgent).
 		Find(&serviceAgents)
@@ -682,10 +697,15 @@ func SearchFranchises(c *gin.Context) {
 		ZipCode string `json:"zip_code"`
 	}
 
+	cacheKey := cache.PrefixLocations + "franchises:zip:" + zipCode
 	var franchises []FranchiseLocation
+	if cache.GetJSON(c.Request.Context(), cacheKey, &franchises) {
+		c.JSON(http.StatusOK, franchises)
+		return
+	}
 
 	// Get franchises that serve this zip code using GORM
-	result := database.DB.Model(&database.Franchise{}).
+	result := database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{}).
 		Select("id, name, address, city, state, zip_code").
 		Where("is_active = ? AND approval_state = ? AND zip_code = ?", true, "approved", zipCode).
 		Find(&franchises)
@@ -696,6 +716,7 @@ func SearchFranchises(c *gin.Context) {
 		return
 	}
 
+	cache.SetJSON(c.Request.Context(), cacheKey, franchises, catalogCacheTTL)
 	c.JSON(http.StatusOK, franchises)
 }
 
@@ -707,13 +728,20 @@ func GetAllLocations(c *gin.Context) {
 		return
 	}
 
+	cacheKey := cache.PrefixLocations + "all"
 	var locations []database.Location
-	if err := database.DB.Find(&locations).Error; err != nil {
+	if cache.GetJSON(c.Request.Context(), cacheKey, &locations) {
+		c.JSON(http.StatusOK, locations)
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Find(&locations).Error; err != nil {
 
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
 		return
 	}
 
+	cache.SetJSON(c.Request.Context(), cacheKey, locations, catalogCacheTTL)
 	c.JSON(http.StatusOK, locations)
 }
 func GetMyLocations(c *gin.Context) {
@@ -723,34 +751,27 @@ func GetMyLocations(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("user_id")
-
-	var user database.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+	franchiseID, ok := ownerFranchiseID(c)
+	if !ok {
 		return
 	}
 
-	//  Auto-link franchise if not set
-	if user.FranchiseID == nil {
-		var franchise database.Franchise
-		if err := database.DB.Where("owner_id = ?", userID).First(&franchise).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not linked to your account"})
-			return
-		}
-		user.FranchiseID = &franchise.ID
-		_ = database.DB.Save(&user)
+	cacheKey := fmt.Sprintf("%sfranchise:%d", cache.PrefixLocations, franchiseID)
+	var locations []database.Location
+	if cache.GetJSON(c.Request.Context(), cacheKey, &locations) {
+		c.JSON(http.StatusOK, locations)
+		return
 	}
 
-	var locations []database.Location
-	if err := database.DB.
+	if err := database.DB.WithContext(c.Request.Context()).
 		Joins("JOIN franchise_locations fl ON fl.location_id = locations.id").
-		Where("fl.franchise_id = ?", *user.FranchiseID).
+		Where("fl.franchise_id = ?", franchiseID).
 		Find(&locations).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service areas"})
 		return
 	}
 
+	cache.SetJSON(c.Request.Context(), cacheKey, locations, catalogCacheTTL)
 	c.JSON(http.StatusOK, locations)
 }
 
@@ -761,25 +782,11 @@ func AddFranchiseLocations(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("user_id")
-
-	var user database.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+	franchiseID, ok := ownerFranchiseID(c)
+	if !ok {
 		return
 	}
 
-	//  Auto-link franchise if not set
-	if user.FranchiseID == nil {
-		var franchise database.Franchise
-		if err := database.DB.Where("owner_id = ?", userID).First(&franchise).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not linked to your account"})
-			return
-		}
-		user.FranchiseID = &franchise.ID
-		_ = database.DB.Save(&user)
-	}
-
 	var req struct {
 		Name     string   `json:"name"`
 		ZipCodes []string `json:"zipCodes"`
@@ -800,17 +807,17 @@ func AddFranchiseLocations(c *gin.Context) {
 			ZipCodes: pq.StringArray{zip},
 		}
 		// Use a map for the WHERE condition to properly handle the array comparison
-		if err := database.DB.Where("\"zip_codes\" @> ?", pq.StringArray{zip}).FirstOrCreate(&location).Error; err != nil {
+		if err := database.DB.WithContext(c.Request.Context()).Where("\"zip_codes\" @> ?", pq.StringArray{zip}).FirstOrCreate(&location).Error; err != nil {
 			fmt.Printf(" Error creating location: %v\n", err)
 			continue
 		}
 		fmt.Printf(" Created Location: %+v\n", location)
 
 		link := database.FranchiseLocation{
-			FranchiseID: *user.FranchiseID,
+			FranchiseID: franchiseID,
 			LocationID:  location.ID,
 		}
-		database.DB.FirstOrCreate(&link, link)
+		database.DB.WithContext(c.Request.Context()).FirstOrCreate(&link, link)
 		created = append(created, location)
 		fmt.Printf(" Created Location Link: %+v\n", link)
 	}
@@ -838,23 +845,21 @@ func UpdateFranchiseLocations(c *gin.Context) {
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		fmt.Printf("Error binding JSON: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	fmt.Println("userID franchise owner ", userID)
 
-	//need to get frnachise id from franchises table using franchise owner id
-	var franchise database.Franchise
-	if err := database.DB.Where("owner_id = ?", userID).First(&franchise).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not linked to your account"})
+	franchiseID, ok := ownerFranchiseID(c)
+	if !ok {
 		return
 	}
 
 	// Find the location owned by this franchise owner
 	var franchiseLocation database.FranchiseLocation
-	if err := database.DB.
-		Where("franchise_id = ?", franchise.ID).
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("franchise_id = ?", franchiseID).
 		Joins("JOIN locations ON franchise_locations.location_id = locations.id").
 		First(&franchiseLocation).Error; err != nil {
 
@@ -863,7 +868,7 @@ func UpdateFranchiseLocations(c *gin.Context) {
 	}
 
 	var location database.Location
-	if err := database.DB.First(&location, franchiseLocation.LocationID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&location, franchiseLocation.LocationID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve location"})
 		return
 	}
@@ -873,14 +878,14 @@ func UpdateFranchiseLocations(c *gin.Context) {
 	location.ZipCodes = req.ZipCodes
 	location.IsActive = req.IsActive
 
-	if err := database.DB.Save(&location).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Save(&location).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
 		return
 	}
 
 	//need to return updated ass like AddFranchiseLocations
 	var updatedLocation database.Location
-	if err := database.DB.First(&updatedLocation, franchiseLocation.LocationID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&updatedLocation, franchiseLocation.LocationID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve location"})
 		return
 	}
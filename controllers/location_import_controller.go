@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// maxLocationImportBytes caps the size of an uploaded location CSV
+const maxLocationImportBytes = 5 << 20
+
+// locationImportColumns maps accepted CSV headers to their field
+var locationImportColumns = map[string]string{
+	"name":         "name",
+	"city":         "city",
+	"state":        "state",
+	"pincodes":     "pincodes",
+	"pincode":      "pincodes",
+	"zip_codes":    "pincodes",
+	"zip_code":     "pincodes",
+	"franchise_id": "franchise_id",
+	"is_active":    "is_active",
+}
+
+// LocationImportRowError lists the problems of one CSV row, numbered as
+// lines of the file with the header on line 1
+type LocationImportRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// LocationImportResult summarises a location import
+type LocationImportResult struct {
+	Rows     int                      `json:"rows"`
+	Imported int                      `json:"imported"`
+	Created  int                      `json:"created"`
+	Updated  int                      `json:"updated"`
+	Linked   int                      `json:"linked"` // new franchise ↔ location links
+	DryRun   bool                     `json:"dry_run"`
+	Errors   []LocationImportRowError `json:"errors"`
+}
+
+// uniqueStrings drops repeated values, keeping the first of each
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// locationImportRow is a validated CSV row
+type locationImportRow struct {
+	line         int
+	name         string
+	city         string
+	state        string
+	zipCodes     []string
+	franchiseIDs []uint
+	isActive     bool
+}
+
+// key identifies the location a row upserts
+func (r locationImportRow) key() string {
+	return strings.ToLower(r.name) + "|" + strings.ToLower(r.state)
+}
+
+// ImportLocations upserts service locations from a CSV with the columns
+// city, state and pincodes, plus optional name (defaults to the city),
+// franchise_id to link the location to a franchise and is_active. Pincodes
+// within a cell are separated by spaces, semicolons or pipes. A location is
+// matched by name and state and its pincodes are replaced by the file's, so
+// re-importing an edited sheet updates coverage. Invalid rows are reported
+// and skipped; pincodes another franchise serves are errors unless
+// ?allow_overlap=true. ?dry_run=true only validates (Admin only).
+// POST /api/admin/locations/import (multipart field "file", or a text/csv body)
+func ImportLocations(c *gin.Context) {
+	reader, closeFile, err := locationImportFile(c)
+	if err != nil {
+		apperror.Respond(c, apperror.BadRequest(err.Error()))
+		return
+	}
+	defer closeFile()
+
+	result := LocationImportResult{DryRun: c.Query("dry_run") == "true", Errors: []LocationImportRowError{}}
+	rows, err := parseLocationImport(reader, &result)
+	if err != nil {
+		apperror.Respond(c, apperror.BadRequest(err.Error()))
+		return
+	}
+
+	rows = validateLocationFranchises(database.DB.WithContext(c.Request.Context()), rows, c.Query("allow_overlap") == "true", &result)
+	result.Imported = len(rows)
+
+	if !result.DryRun && len(rows) > 0 {
+		err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if err := upsertImportedLocation(tx, row, &result); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to import locations"))
+			return
+		}
+		recordAudit(c, nil, "location.import", "location", 0, nil, gin.H{
+			"imported": result.Imported, "created": result.Created, "updated": result.Updated, "linked": result.Linked,
+		})
+	}
+
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	c.JSON(http.StatusOK, result)
+}
+
+// locationImportFile opens the uploaded CSV
+func locationImportFile(c *gin.Context) (io.Reader, func(), error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxLocationImportBytes)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, nil, errors.New("Upload the CSV as multipart field \"file\"")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, func() { file.Close() }, nil
+	}
+	return c.Request.Body, func() {}, nil
+}
+
+// parseLocationImport reads and validates the CSV rows, recording invalid
+// rows in result.Errors. Rows for the same location are merged. It fails
+// only when the file itself is unusable.
+func parseLocationImport(r io.Reader, result *LocationImportResult) ([]locationImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("The CSV is empty or unreadable")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := locationImportColumns[name]; ok {
+			columns[field] = i
+		}
+	}
+	for _, required := range []string{"city", "state", "pincodes"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("The CSV needs a %s column", required)
+		}
+	}
+
+	var rows []locationImportRow
+	merged := map[string]int{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Errors = append(result.Errors, LocationImportRowError{Row: line, Errors: []string{parseErr.Err.Error()}})
+				continue
+			}
+			return nil, errors.New("The CSV could not be read")
+		}
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+		result.Rows++
+
+		row, problems := parseLocationImportRow(line, field)
+		if len(problems) > 0 {
+			result.Errors = append(result.Errors, LocationImportRowError{Row: line, Errors: problems})
+			continue
+		}
+		if i, ok := merged[row.key()]; ok {
+			rows[i].zipCodes = uniqueStrings(append(rows[i].zipCodes, row.zipCodes...))
+			rows[i].franchiseIDs = uniqueIDs(append(rows[i].franchiseIDs, row.franchiseIDs...))
+			continue
+		}
+		merged[row.key()] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseLocationImportRow validates one CSV row
+func parseLocationImportRow(line int, field func(string) string) (locationImportRow, []string) {
+	row := locationImportRow{line: line, city: field("city"), state: field("state"), isActive: true}
+	row.name = field("name")
+	if row.name == "" {
+		row.name = row.city
+	}
+
+	var problems []string
+	if row.city == "" {
+		problems = append(problems, "city is required")
+	}
+	if row.state == "" {
+		problems = append(problems, "state is required")
+	}
+
+	zipCodes := strings.FieldsFunc(field("pincodes"), func(r rune) bool {
+		return r == ' ' || r == ';' || r == '|' || r == ','
+	})
+	if len(zipCodes) == 0 {
+		problems = append(problems, "at least one pincode is required")
+	}
+	for _, zip := range zipCodes {
+		if pincodePattern.FindString(zip) != zip {
+			problems = append(problems, "invalid pincode "+strconv.Quote(zip))
+		}
+	}
+	row.zipCodes = uniqueStrings(zipCodes)
+
+	if value := field("franchise_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			problems = append(problems, "invalid franchise_id "+strconv.Quote(value))
+		}
+		row.franchiseIDs = []uint{uint(id)}
+	}
+	if value := field("is_active"); value != "" {
+		switch strings.ToLower(value) {
+		case "true", "yes", "1":
+			row.isActive = true
+		case "false", "no", "0":
+			row.isActive = false
+		default:
+			problems = append(problems, "is_active must be true or false")
+		}
+	}
+	return row, problems
+}
+
+// validateLocationFranchises drops rows naming a franchise that doesn't
+// exist or claiming pincodes another franchise serves, recording them in
+// result.Errors
+func validateLocationFranchises(db *gorm.DB, rows []locationImportRow, allowOverlap bool, result *LocationImportResult) []locationImportRow {
+	valid := make([]locationImportRow, 0, len(rows))
+	exists := map[uint]bool{}
+	for _, row := range rows {
+		var problems []string
+		for _, franchiseID := range row.franchiseIDs {
+			problems = append(problems, locationFranchiseProblems(db, row, franchiseID, allowOverlap, exists)...)
+		}
+		if len(problems) > 0 {
+			result.Errors = append(result.Errors, LocationImportRowError{Row: row.line, Errors: problems})
+			continue
+		}
+		valid = append(valid, row)
+	}
+	return valid
+}
+
+// locationFranchiseProblems checks that a row's franchise exists and, unless
+// overlap is allowed, that no other franchise serves its pincodes. exists
+// caches franchise lookups across rows.
+func locationFranchiseProblems(db *gorm.DB, row locationImportRow, franchiseID uint, allowOverlap bool, exists map[uint]bool) []string {
+	found, checked := exists[franchiseID]
+	if !checked {
+		var count int64
+		if err := db.Model(&database.Franchise{}).Where("id = ?", franchiseID).Count(&count).Error; err != nil {
+			return []string{"could not look up the franchise"}
+		}
+		found = count > 0
+		exists[franchiseID] = found
+	}
+	if !found {
+		return []string{fmt.Sprintf("franchise %d not found", franchiseID)}
+	}
+	if allowOverlap {
+		return nil
+	}
+
+	conflicts, err := territoryConflicts(db, franchiseID, row.zipCodes)
+	if err != nil {
+		return []string{"could not check pincode overlap"}
+	}
+	var problems []string
+	for _, conflict := range conflicts {
+		problems = append(problems, fmt.Sprintf("pincode %s is served by %s", conflict.ZipCode, conflict.FranchiseName))
+	}
+	return problems
+}
+
+// upsertImportedLocation creates or updates a row's location and links it
+// to the row's franchises
+func upsertImportedLocation(tx *gorm.DB, row locationImportRow, result *LocationImportResult) error {
+	var location database.Location
+	err := tx.Where("LOWER(name) = LOWER(?) AND (LOWER(state) = LOWER(?) OR state = '' OR state IS NULL)", row.name, row.state).
+		Order("id").
+		First(&location).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		location = database.Location{Name: row.name, City: row.city, State: row.state, ZipCodes: pq.StringArray(row.zipCodes), IsActive: row.isActive}
+		if err := tx.Create(&location).Error; err != nil {
+			return err
+		}
+		result.Created++
+	case err != nil:
+		return err
+	default:
+		location.City = row.city
+		location.State = row.state
+		location.ZipCodes = pq.StringArray(row.zipCodes)
+		location.IsActive = row.isActive
+		if err := tx.Save(&location).Error; err != nil {
+			return err
+		}
+		result.Updated++
+	}
+
+	for _, franchiseID := range row.franchiseIDs {
+		link := database.FranchiseLocation{FranchiseID: franchiseID, LocationID: location.ID}
+		created := tx.FirstOrCreate(&link, link)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected > 0 {
+			result.Linked++
+		}
+	}
+	return nil
+}
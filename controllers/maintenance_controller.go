@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/middleware"
+)
+
+// MaintenanceModeRequest turns maintenance mode on or off
+type MaintenanceModeRequest struct {
+	Enabled      *bool      `json:"enabled" binding:"required"`
+	Message      string     `json:"message" binding:"max=500"`
+	AllowedRoles []string   `json:"allowed_roles" binding:"omitempty,dive,oneof=franchise_owner service_agent franchise_staff customer"`
+	EndsAt       *time.Time `json:"ends_at"`
+}
+
+// GetMaintenanceMode returns the maintenance switch (Admin only)
+// GET /api/admin/maintenance
+func GetMaintenanceMode(c *gin.Context) {
+	mode, err := database.CurrentMaintenanceMode(database.DB.WithContext(c.Request.Context()))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch maintenance mode"})
+		return
+	}
+	c.JSON(http.StatusOK, mode)
+}
+
+// UpdateMaintenanceMode turns maintenance mode on or off. While it is on,
+// everyone but admins and the allowed roles gets 503 with the message;
+// logins and Razorpay webhooks still go through. (Admin only)
+// PUT /api/admin/maintenance
+func UpdateMaintenanceMode(c *gin.Context) {
+	var req MaintenanceModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(time.Now()) {
+		apperror.Respond(c, apperror.BadRequest("ends_at must be in the future"))
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	mode, err := database.CurrentMaintenanceMode(db)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	before := mode
+	mode.Enabled = *req.Enabled
+	mode.Message = req.Message
+	mode.AllowedRoles = req.AllowedRoles
+	mode.EndsAt = req.EndsAt
+	mode.UpdatedBy = c.GetUint("user_id")
+	if err := db.Save(&mode).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update maintenance mode"})
+		return
+	}
+	middleware.SetMaintenanceMode(mode)
+
+	action := "maintenance.disable"
+	if mode.Enabled {
+		action = "maintenance.enable"
+	}
+	recordAudit(c, nil, action, "maintenance_mode", mode.ID, before, mode)
+	c.JSON(http.StatusOK, mode)
+}
@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// MandateRequest contains data for setting up auto-debit on an order
+type MandateRequest struct {
+	OrderID uint `json:"order_id" binding:"required"`
+}
+
+// CreateMandate creates a Razorpay plan + subscription so the monthly rent
+// of an order is auto-debited via UPI Autopay / e-mandate (Customer only)
+func CreateMandate(c *gin.Context) {
+	role, exists := c.Get("role")
+	if !exists || role != "customer" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		return
+	}
+
+	customerID := c.GetUint("user_id")
+
+	var request MandateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var order database.Order
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Product").
+		Where("id = ? AND customer_id = ?", request.OrderID, customerID).
+		First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if order.Status == database.OrderStatusCancelled || order.Status == database.OrderStatusRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot set up auto-debit for a " + order.Status + " order"})
+		return
+	}
+
+	// Only one live mandate per order
+	var existing int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.Mandate{}).
+		Where("order_id = ? AND status NOT IN ?", order.ID, database.MandateEndedStatuses).
+		Count(&existing).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Auto-debit is already set up for this order"})
+		return
+	}
+
+	monthlyRent := order.MonthlyRent
+	if monthlyRent == 0 {
+		monthlyRent = order.Product.MonthlyRent
+	}
+	if monthlyRent <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order has no monthly rent to auto-debit"})
+		return
+	}
+
+	// Each auto-debit collects the month's rent plus GST
+	gst, err := loadGSTContext(database.DB.WithContext(c.Request.Context()), order.ProductID, order.FranchiseID, customerID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate tax"})
+		return
+	}
+	monthlyAmount := gst.onTaxable(monthlyRent).Total()
+
+	totalCount := order.RentalDuration
+	if totalCount < 1 {
+		totalCount = 1
+	}
+
+	gateway := paymentGatewayFor(c)
+
+	planData := map[string]interface{}{
+		"period":   "monthly",
+		"interval": 1,
+		"item": map[string]interface{}{
+			"name":     fmt.Sprintf("%s - monthly rent", order.Product.Name),
+			"amount":   int64(math.Round(monthlyAmount * 100)),
+			"currency": "INR",
+		},
+		"notes": map[string]interface{}{
+			"aquahome_order_id": order.ID,
+		},
+	}
+
+	plan, err := callRazorpay(c, "plan_create", func() (map[string]interface{}, error) {
+		return gateway.CreatePlan(planData)
+	})
+	if err != nil {
+		log.Printf("Error creating Razorpay plan: %v", err)
+		respondRazorpayError(c, err, http.StatusInternalServerError, "Failed to create payment plan")
+		return
+	}
+
+	// The first month is collected with the initial payment, so the first
+	// auto-debit happens one billing cycle later
+	subscriptionData := map[string]interface{}{
+		"plan_id":         plan["id"],
+		"total_count":     totalCount,
+		"quantity":        1,
+		"customer_notify": 1,
+		"start_at":        time.Now().AddDate(0, 1, 0).Unix(),
+		"notes": map[string]interface{}{
+			"aquahome_order_id": order.ID,
+			"customer_id":       customerID,
+			"payment_type":      "monthly",
+		},
+	}
+
+	rzpSubscription, err := callRazorpay(c, "subscription_create", func() (map[string]interface{}, error) {
+		return gateway.CreateSubscription(subscriptionData)
+	})
+	if err != nil {
+		log.Printf("Error creating Razorpay subscription: %v", err)
+		respondRazorpayError(c, err, http.StatusInternalServerError, "Failed to create auto-debit mandate")
+		return
+	}
+
+	mandate := database.Mandate{
+		CustomerID:             customerID,
+		OrderID:                order.ID,
+		RazorpayPlanID:         mapString(plan, "id"),
+		RazorpaySubscriptionID: mapString(rzpSubscription, "id"),
+		Status:                 database.MandateStatusCreated,
+		ShortURL:               mapString(rzpSubscription, "short_url"),
+		Amount:                 monthlyAmount,
+		TotalCount:             totalCount,
+	}
+
+	// Link to the rental subscription if the order has already been delivered
+	var subscription database.Subscription
+	if err := database.DB.WithContext(c.Request.Context()).Where("order_id = ?", order.ID).First(&subscription).Error; err == nil {
+		mandate.SubscriptionID = &subscription.ID
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&mandate).Error; err != nil {
+		log.Printf("Failed to create mandate record: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create mandate record"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"mandate":                  mandate,
+		"razorpay_subscription_id": mandate.RazorpaySubscriptionID,
+		"short_url":                mandate.ShortURL,
+		"key":                      config.AppConfig.RazorpayKey,
+	})
+}
+
+// GetMyMandates lists the auto-debit mandates of the authenticated customer
+func GetMyMandates(c *gin.Context) {
+	customerID := c.GetUint("user_id")
+
+	var mandates []database.Mandate
+	if err := database.DB.WithContext(c.Request.Context()).Where("customer_id = ?", customerID).
+		Order("created_at DESC").
+		Find(&mandates).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mandates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mandates)
+}
+
+// CancelMandate stops future auto-debits for a mandate (Customer only)
+func CancelMandate(c *gin.Context) {
+	mandateID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mandate ID"})
+		return
+	}
+
+	customerID := c.GetUint("user_id")
+
+	var mandate database.Mandate
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ?", mandateID, customerID).
+		First(&mandate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mandate not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if mandate.Status == database.MandateStatusCancelled || mandate.Status == database.MandateStatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mandate is already " + mandate.Status})
+		return
+	}
+
+	gateway := paymentGatewayFor(c)
+	_, err = callRazorpay(c, "subscription_cancel", func() (map[string]interface{}, error) {
+		return gateway.CancelSubscription(mandate.RazorpaySubscriptionID,
+			map[string]interface{}{"cancel_at_cycle_end": 0})
+	})
+	if err != nil {
+		log.Printf("Error cancelling Razorpay subscription %s: %v", mandate.RazorpaySubscriptionID, err)
+		respondRazorpayError(c, err, http.StatusInternalServerError, "Failed to cancel mandate")
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Model(&mandate).Update("status", database.MandateStatusCancelled).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mandate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Auto-debit cancelled successfully"})
+}
+
+// handleSubscriptionCharged records a successful auto-debit as a monthly payment
+// and moves the rental subscription's billing date forward
+func handleSubscriptionCharged(event RazorpayWebhookEvent) error {
+	rzpSubscription := event.entity("subscription")
+	rzpPayment := event.entity("payment")
+	rzpSubscriptionID := mapString(rzpSubscription, "id")
+	paymentID := mapString(rzpPayment, "id")
+
+	if rzpSubscriptionID == "" || paymentID == "" {
+		return fmt.Errorf("subscription.charged event missing subscription or payment id")
+	}
+
+	var mandate database.Mandate
+	if err := database.DB.Where("razorpay_subscription_id = ?", rzpSubscriptionID).First(&mandate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ignoring charge for unknown Razorpay subscription %s", rzpSubscriptionID)
+			return nil
+		}
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if mandate.SubscriptionID == nil {
+			var subscription database.Subscription
+			if err := tx.Where("order_id = ?", mandate.OrderID).First(&subscription).Error; err == nil {
+				mandate.SubscriptionID = &subscription.ID
+			}
+		}
+
+		amount := mapFloat(rzpPayment, "amount") / 100
+		if amount == 0 {
+			amount = mandate.Amount
+		}
+
+		invoiceNumber := generateInvoiceNumber(int64(mandate.OrderID))
+		if mandate.SubscriptionID != nil {
+			invoiceNumber = generateMonthlyInvoiceNumber(*mandate.SubscriptionID)
+		}
+
+		orderID := mandate.OrderID
+		var order database.Order
+		if err := tx.Select("id, product_id, franchise_id").First(&order, orderID).Error; err != nil {
+			return err
+		}
+		gst, err := loadGSTContext(tx, order.ProductID, order.FranchiseID, mandate.CustomerID)
+		if err != nil {
+			return err
+		}
+		tax := gst.fromGross(amount)
+
+		payment := database.Payment{
+			CustomerID:     mandate.CustomerID,
+			OrderID:        &orderID,
+			SubscriptionID: mandate.SubscriptionID,
+			Amount:         amount,
+			PaymentType:    "monthly",
+			Status:         database.PaymentStatusSuccess,
+			InvoiceNumber:  invoiceNumber,
+			PaymentMethod:  "razorpay_autopay",
+			TransactionID:  paymentID,
+			PaymentDetails: toJSONString(rzpPayment),
+			Notes:          "Auto-debited via mandate " + mandate.RazorpaySubscriptionID,
+			TaxBreakdown:   tax,
+		}
+		// Razorpay retries webhooks, concurrently at times, so a payment is
+		// only recorded by the delivery that inserts it
+		created := tx.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "transaction_id"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "transaction_id <> ''"}}},
+			DoNothing:   true,
+		}).Create(&payment)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			return nil
+		}
+
+		if mandate.SubscriptionID != nil {
+			var subscription database.Subscription
+			if err := tx.First(&subscription, *mandate.SubscriptionID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&subscription).
+				Update("next_billing_date", subscription.NextBillingDate.AddDate(0, 1, 0)).Error; err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{
+			"subscription_id": mandate.SubscriptionID,
+			"paid_count":      int(mapFloat(rzpSubscription, "paid_count")),
+			"last_charged_at": time.Now(),
+		}
+		if method := mapString(rzpPayment, "method"); method != "" {
+			updates["method"] = method
+		}
+		if err := tx.Model(&database.Mandate{}).Where("id = ?", mandate.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if _, err := applyMandateStatus(tx, rzpSubscriptionID, database.MandateStatusActive, event.occurredAt()); err != nil {
+			return err
+		}
+
+		return events.Publish(tx, events.Event{
+			Name:        events.PaymentAutoDebited,
+			EntityType:  "payment",
+			EntityID:    payment.ID,
+			CustomerID:  mandate.CustomerID,
+			FranchiseID: order.FranchiseID,
+			Vars:        database.Vars{"amount": amount},
+			Data:        database.WebhookPaymentData(payment),
+		})
+	})
+}
+
+// handleSubscriptionStatusChange keeps the mandate status in sync with Razorpay
+func handleSubscriptionStatusChange(event RazorpayWebhookEvent) error {
+	rzpSubscription := event.entity("subscription")
+	rzpSubscriptionID := mapString(rzpSubscription, "id")
+	status := mapString(rzpSubscription, "status")
+
+	if rzpSubscriptionID == "" || status == "" {
+		return fmt.Errorf("%s event missing subscription id or status", event.Event)
+	}
+
+	applied, err := applyMandateStatus(database.DB, rzpSubscriptionID, status, event.occurredAt())
+	if err != nil {
+		return err
+	}
+
+	if applied && status == database.MandateStatusHalted {
+		var mandate database.Mandate
+		if err := database.DB.Where("razorpay_subscription_id = ?", rzpSubscriptionID).First(&mandate).Error; err == nil {
+			notification := database.Notification{
+				UserID:      mandate.CustomerID,
+				Type:        "payment",
+				RelatedID:   &mandate.ID,
+				RelatedType: "mandate",
+			}.Rendered(database.DB, "payment.auto_debit_failed", nil)
+			if err := database.DB.Create(&notification).Error; err != nil {
+				log.Printf("Warning: Failed to create notification: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyMandateStatus moves a mandate to the status of a Razorpay event raised
+// at, unless the mandate has ended or already reflects a later event, as
+// Razorpay may deliver events late and out of order. It reports whether the
+// status was applied.
+func applyMandateStatus(tx *gorm.DB, rzpSubscriptionID, status string, at time.Time) (bool, error) {
+	result := tx.Model(&database.Mandate{}).
+		Where("razorpay_subscription_id = ? AND status NOT IN ? AND (status_event_at IS NULL OR status_event_at <= ?)",
+			rzpSubscriptionID, database.MandateEndedStatuses, at).
+		Updates(map[string]interface{}{"status": status, "status_event_at": at})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/tenant"
+)
+
+// ManualPaymentRequest is money a customer paid by bank transfer. It settles
+// either a pending payment, such as an order's initial payment, or the rent
+// due on a subscription.
+type ManualPaymentRequest struct {
+	PaymentID      uint       `json:"payment_id"`
+	SubscriptionID uint       `json:"subscription_id"`
+	Amount         float64    `json:"amount" binding:"required,gt=0"`
+	Reference      string     `json:"reference" binding:"required,max=100"` // UTR or NEFT/IMPS reference
+	Reason         string     `json:"reason" binding:"required,max=500"`
+	PaidAt         *time.Time `json:"paid_at"`
+}
+
+// manualPaymentFor returns the pending payment a manual entry settles: the
+// one named, or the subscription's rent. Rent not yet billed is a new,
+// unsaved payment for what is due.
+func manualPaymentFor(db *gorm.DB, req ManualPaymentRequest) (database.Payment, error) {
+	var payment database.Payment
+	if req.PaymentID != 0 {
+		if err := db.First(&payment, req.PaymentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return payment, apperror.NotFound("Payment not found")
+			}
+			return payment, apperror.Internal(err)
+		}
+		if payment.Status != database.PaymentStatusPending {
+			return payment, apperror.Conflict(fmt.Sprintf("Payment is already %s", payment.Status))
+		}
+		return payment, nil
+	}
+
+	var subscription database.Subscription
+	if err := db.Select("id, customer_id, order_id, product_id, franchise_id, monthly_rent, status, outstanding_late_fee").
+		First(&subscription, req.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return payment, apperror.NotFound("Subscription not found")
+		}
+		return payment, apperror.Internal(err)
+	}
+	if subscription.Status != database.SubscriptionStatusActive && subscription.Status != database.SubscriptionStatusSuspended {
+		return payment, apperror.BadRequest("Subscription is not active")
+	}
+
+	var waiting int64
+	if err := db.Model(&database.Payment{}).
+		Where("subscription_id = ? AND status = ?", subscription.ID, database.PaymentStatusPendingReconciliation).
+		Count(&waiting).Error; err != nil {
+		return payment, apperror.Internal(err)
+	}
+	if waiting > 0 {
+		return payment, apperror.Conflict("Cash for this subscription is awaiting reconciliation")
+	}
+
+	// Rent the customer already started paying online is settled as billed
+	err := db.Where("subscription_id = ? AND payment_type = ? AND status = ?",
+		subscription.ID, "monthly", database.PaymentStatusPending).First(&payment).Error
+	if err == nil {
+		return payment, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return payment, apperror.Internal(err)
+	}
+
+	gst, err := loadGSTContext(db, subscription.ProductID, subscription.FranchiseID, subscription.CustomerID)
+	if err != nil {
+		return payment, apperror.Internal(err).WithMessage("Failed to calculate tax")
+	}
+	due := subscription.MonthlyRent + subscription.OutstandingLateFee
+	credit, err := creditForBill(db, subscription, due)
+	if err != nil {
+		return payment, apperror.Internal(err)
+	}
+	tax := gst.onTaxable(due - credit)
+	orderID := subscription.OrderID
+	return database.Payment{
+		CustomerID:     subscription.CustomerID,
+		OrderID:        &orderID,
+		SubscriptionID: &subscription.ID,
+		Amount:         tax.Total(),
+		PaymentType:    "monthly",
+		Status:         database.PaymentStatusPending,
+		InvoiceNumber:  generateMonthlyInvoiceNumber(subscription.ID),
+		TaxBreakdown:   tax,
+		CreditApplied:  credit,
+	}, nil
+}
+
+// RecordManualPayment records a bank transfer, NEFT or other payment made
+// outside the app against a pending payment or a subscription's rent, and
+// applies it as checkout would. The reason and reference are kept in the
+// audit log, which is written with the payment or not at all (Admin only).
+// POST /api/admin/payments/manual
+func RecordManualPayment(c *gin.Context) {
+	var req ManualPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if (req.PaymentID == 0) == (req.SubscriptionID == 0) {
+		apperror.Respond(c, apperror.BadRequest("Give either payment_id or subscription_id"))
+		return
+	}
+	req.Reference = strings.TrimSpace(req.Reference)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reference == "" || req.Reason == "" {
+		apperror.Respond(c, apperror.BadRequest("A reference and a reason are required"))
+		return
+	}
+	paidAt := time.Now()
+	if req.PaidAt != nil {
+		if req.PaidAt.After(paidAt) {
+			apperror.Respond(c, apperror.BadRequest("paid_at cannot be in the future"))
+			return
+		}
+		paidAt = *req.PaidAt
+	}
+
+	// The reference is stored as the transaction ID, which is unique across
+	// every payment method, tenant and deleted payment
+	var duplicate int64
+	if err := database.DB.WithContext(tenant.Unscoped(c.Request.Context())).Unscoped().Model(&database.Payment{}).
+		Where("transaction_id = ?", req.Reference).
+		Count(&duplicate).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if duplicate > 0 {
+		apperror.Respond(c, apperror.Conflict("A payment with this reference has already been recorded"))
+		return
+	}
+
+	payment, err := manualPaymentFor(database.DB.WithContext(c.Request.Context()), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if math.Abs(req.Amount-payment.Amount) >= 0.01 {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Amount must be %.2f", payment.Amount)))
+		return
+	}
+	if payment.PaymentType == "initial" {
+		var order database.Order
+		if err := database.DB.WithContext(c.Request.Context()).Select("id, status").First(&order, *payment.OrderID).Error; err != nil {
+			apperror.Respond(c, apperror.Internal(err))
+			return
+		}
+		if order.Status != database.OrderStatusPending {
+			apperror.Respond(c, apperror.Conflict(fmt.Sprintf("Order is already %s", order.Status)))
+			return
+		}
+	}
+
+	before := gin.H{"status": payment.Status, "payment_method": payment.PaymentMethod, "transaction_id": payment.TransactionID}
+	payment.Status = database.PaymentStatusSuccess
+	payment.PaymentMethod = "manual"
+	payment.TransactionID = req.Reference
+	payment.PaymentDetails = toJSONString(map[string]interface{}{
+		"reference":   req.Reference,
+		"paid_at":     paidAt.Format(time.RFC3339),
+		"recorded_by": c.GetUint("user_id"),
+	})
+	payment.Notes = req.Reason
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if payment.ID == 0 {
+			if err := tx.Create(&payment).Error; err != nil {
+				return err
+			}
+		} else {
+			// Guarded by the status so a payment settled meanwhile isn't paid twice
+			result := tx.Model(&database.Payment{}).
+				Where("id = ? AND status = ?", payment.ID, database.PaymentStatusPending).
+				Updates(map[string]interface{}{
+					"status":          payment.Status,
+					"payment_method":  payment.PaymentMethod,
+					"transaction_id":  payment.TransactionID,
+					"payment_details": payment.PaymentDetails,
+					"notes":           payment.Notes,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return apperror.Conflict("Payment was settled meanwhile")
+			}
+		}
+		if err := fulfilPayment(tx, payment, "bank transfer"); err != nil {
+			return err
+		}
+		return writeAudit(c, tx, "payment.manual", "payment", payment.ID, before, gin.H{
+			"status":         payment.Status,
+			"payment_method": payment.PaymentMethod,
+			"transaction_id": payment.TransactionID,
+			"amount":         payment.Amount,
+			"paid_at":        paidAt,
+			"reason":         req.Reason,
+		})
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
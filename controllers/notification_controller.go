@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// GetNotifications lists the current user's notifications, newest first
+// GET /api/notifications?page=&limit=&type=&unread=true
+// Passing ?cursor (empty for the first page) switches to keyset pagination.
+// Answers 304 to an If-None-Match naming the current ETag.
+func GetNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	etag := versionedETag(c, database.DB.WithContext(c.Request.Context()), []versionSource{
+		{"notifications", database.DB.WithContext(c.Request.Context()).Model(&database.Notification{}).Where("user_id = ?", userID)},
+	}, userID, c.Request.URL.RawQuery)
+	if notModified(c, etag) {
+		return
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Notification{}).Where("user_id = ?", userID)
+	if notificationType := c.Query("type"); notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+	if c.Query("unread") == "true" {
+		query = query.Where("is_read = ?", false)
+	}
+
+	if cursorRequested(c) {
+		page, limit, ok := keysetPage(c, query, "notifications")
+		if !ok {
+			return
+		}
+		var notifications []database.Notification
+		if err := page.Find(&notifications).Error; err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+		notifications, next := nextCursor(notifications, limit, func(n database.Notification) (time.Time, uint) {
+			return n.CreatedAt, n.ID
+		})
+		c.JSON(http.StatusOK, gin.H{"notifications": notifications, "next_cursor": next, "limit": limit})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	var notifications []database.Notification
+	if err := query.Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&notifications).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "total": total, "page": page, "limit": limit})
+}
+
+// GetUnreadNotificationCount returns how many of the current user's
+// notifications are unread, for the notification badge
+func GetUnreadNotificationCount(c *gin.Context) {
+	var count int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.Notification{}).
+		Where("user_id = ? AND is_read = ?", c.GetUint("user_id"), false).
+		Count(&count).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// MarkNotificationRead marks one of the current user's notifications as read
+func MarkNotificationRead(c *gin.Context) {
+	var notification database.Notification
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&notification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if !notification.IsRead {
+		now := time.Now()
+		notification.IsRead = true
+		notification.ReadAt = &now
+		if err := database.DB.WithContext(c.Request.Context()).Model(&notification).
+			Updates(map[string]interface{}{"is_read": true, "read_at": now}).Error; err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, notification)
+}
+
+// MarkAllNotificationsRead marks all of the current user's notifications as
+// read, or only those of ?type=
+func MarkAllNotificationsRead(c *gin.Context) {
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Notification{}).
+		Where("user_id = ? AND is_read = ?", c.GetUint("user_id"), false)
+	if notificationType := c.Query("type"); notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+
+	result := query.Updates(map[string]interface{}{"is_read": true, "read_at": time.Now()})
+	if result.Error != nil {
+		log.Printf("Database error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": result.RowsAffected})
+}
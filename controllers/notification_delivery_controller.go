@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// GetNotificationDeliveries lists email, SMS and push deliveries, newest
+// first, filtered by ?status (pending, sent, failed), ?channel, ?user_id and
+// ?event. Failed deliveries are the dead letters. (Admin only)
+// GET /api/admin/notification-deliveries
+func GetNotificationDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.NotificationDelivery{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	var deliveries []database.NotificationDelivery
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&deliveries).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries, "total": total, "page": page, "limit": limit})
+}
+
+// RetryNotificationDelivery sends a dead-lettered delivery again right away,
+// with a fresh set of retries (Admin only)
+// POST /api/admin/notification-deliveries/:id/retry
+func RetryNotificationDelivery(c *gin.Context) {
+	var delivery database.NotificationDelivery
+	if err := database.DB.WithContext(c.Request.Context()).First(&delivery, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if delivery.Status != database.NotificationDeliveryFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed deliveries can be retried"})
+		return
+	}
+
+	if err := events.RetryNotificationDelivery(delivery.ID); err != nil {
+		log.Printf("Notification delivery %d failed: %v", delivery.ID, err)
+	}
+
+	database.DB.WithContext(c.Request.Context()).First(&delivery, delivery.ID)
+	recordAudit(c, nil, "notification_delivery.retry", "notification_delivery", delivery.ID, nil, nil)
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// NotificationTemplateRequest sets the copy of a notification event in a locale
+type NotificationTemplateRequest struct {
+	Event   string `json:"event" binding:"required"`
+	Locale  string `json:"locale" binding:"required"`
+	Title   string `json:"title" binding:"required,max=255"`
+	Message string `json:"message" binding:"required"`
+}
+
+// NotificationEvent describes a notification event for the template editor
+type NotificationEvent struct {
+	Event     string                          `json:"event"`
+	Variables []string                        `json:"variables"`
+	Default   database.NotificationCopy       `json:"default"`
+	Templates []database.NotificationTemplate `json:"templates"`
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+
+// GetNotificationTemplates lists every notification event with the variables
+// it offers, its built-in copy and the templates admins have added (Admin only)
+func GetNotificationTemplates(c *gin.Context) {
+	var templates []database.NotificationTemplate
+	if err := database.DB.WithContext(c.Request.Context()).Order("event, locale").Find(&templates).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification templates"})
+		return
+	}
+	byEvent := map[string][]database.NotificationTemplate{}
+	for _, t := range templates {
+		byEvent[t.Event] = append(byEvent[t.Event], t)
+	}
+
+	events := make([]NotificationEvent, 0, len(database.DefaultNotificationCopy))
+	for event, text := range database.DefaultNotificationCopy {
+		events = append(events, NotificationEvent{
+			Event:     event,
+			Variables: database.TemplateVariables(text.Title, text.Message),
+			Default:   text,
+			Templates: byEvent[event],
+		})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Event < events[j].Event })
+	c.JSON(http.StatusOK, events)
+}
+
+// SaveNotificationTemplate creates or replaces the copy of an event in a
+// locale. Only the event's own variables may be used (Admin only).
+func SaveNotificationTemplate(c *gin.Context) {
+	var req NotificationTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	defaults, ok := database.DefaultNotificationCopy[req.Event]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown notification event"})
+		return
+	}
+	if !localePattern.MatchString(req.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "locale must look like en or hi-IN"})
+		return
+	}
+	allowed := map[string]bool{}
+	for _, name := range database.TemplateVariables(defaults.Title, defaults.Message) {
+		allowed[name] = true
+	}
+	for _, name := range database.TemplateVariables(req.Title, req.Message) {
+		if !allowed[name] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown variable {{" + name + "}} for " + req.Event})
+			return
+		}
+	}
+
+	template := database.NotificationTemplate{
+		Event:   req.Event,
+		Locale:  req.Locale,
+		Title:   req.Title,
+		Message: req.Message,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "event"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "message", "updated_at"}),
+	}).Create(&template).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification template"})
+		return
+	}
+
+	recordAudit(c, nil, "notification_template.save", "notification_template", template.ID, nil, template)
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteNotificationTemplate removes a template; the event falls back to the
+// default locale or its built-in copy (Admin only)
+func DeleteNotificationTemplate(c *gin.Context) {
+	var template database.NotificationTemplate
+	if err := database.DB.WithContext(c.Request.Context()).First(&template, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification template not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// Removed for good so the event and locale can be added again
+	if err := database.DB.WithContext(c.Request.Context()).Unscoped().Delete(&template).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification template"})
+		return
+	}
+	recordAudit(c, nil, "notification_template.delete", "notification_template", template.ID, template, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Notification template deleted"})
+}
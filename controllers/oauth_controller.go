@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// GoogleSignInRequest carries the ID token from Google One Tap / Sign-In
+type GoogleSignInRequest struct {
+	IDToken string `json:"id_token" binding:"required"`
+}
+
+var errGoogleCustomersOnly = errors.New("google sign-in is for customers only")
+
+// GoogleSignIn verifies a Google ID token, then signs in the linked user, links an
+// existing account with the same verified email, or creates a new customer
+// POST /api/auth/google
+func GoogleSignIn(c *gin.Context) {
+	var request GoogleSignInRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("id_token is required"))
+		return
+	}
+
+	claims, err := utils.VerifyGoogleIDToken(request.IDToken)
+	if err != nil {
+		log.Printf("Google token verification failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google token"})
+		return
+	}
+	if !claims.EmailVerified {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Google account email is not verified"})
+		return
+	}
+
+	email := strings.ToLower(claims.Email)
+	var response LoginResponse
+	created := false
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var user database.User
+		err := tx.Where("google_id = ?", claims.Subject).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+			switch {
+			case err == nil:
+				if user.Role != database.RoleCustomer {
+					return errGoogleCustomersOnly
+				}
+				// Link the existing account to this Google identity; Google has
+				// confirmed the email address
+				updates := map[string]interface{}{"google_id": claims.Subject}
+				if user.EmailVerifiedAt == nil {
+					// Whoever registered the unverified account may not own the
+					// address, so their password and sessions don't carry over
+					updates["email_verified_at"] = time.Now()
+					updates["password_hash"] = ""
+					if err := revokeUserSessions(tx, user.ID); err != nil {
+						return err
+					}
+				}
+				if err := tx.Model(&user).Updates(updates).Error; err != nil {
+					return err
+				}
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				now := time.Now()
+				user = database.User{
+					Name:            claims.Name,
+					Email:           email,
+					Role:            database.RoleCustomer,
+					GoogleID:        claims.Subject,
+					EmailVerifiedAt: &now,
+				}
+				if err := tx.Create(&user).Error; err != nil {
+					return err
+				}
+				created = true
+			default:
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if user.Role != database.RoleCustomer {
+			return errGoogleCustomersOnly
+		}
+
+		response, err = issueSession(c, tx, user)
+		return err
+	})
+
+	if errors.Is(err, errGoogleCustomersOnly) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Google sign-in is only available for customers"})
+		return
+	}
+	if err != nil {
+		log.Printf("Google sign-in error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, response)
+}
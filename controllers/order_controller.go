@@ -1,26 +1,38 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
 	"aquahome/database"
+	"aquahome/ledger"
+	"aquahome/risk"
 )
 
 // OrderRequest contains the data for order creation
 type OrderRequest struct {
 	ProductID       int64  `json:"product_id" binding:"required"`
-	FranchiseID     int64  `json:"franchise_id" binding:"required"`
-	ShippingAddress string `json:"shipping_address" binding:"required"`
-	BillingAddress  string `json:"billing_address" binding:"required"`
+	FranchiseID     int64  `json:"franchise_id"` // assigned from the shipping address when omitted
+	// Address book entries; the customer's defaults are used when omitted
+	ShippingAddressID *uint `json:"shipping_address_id"`
+	BillingAddressID  *uint `json:"billing_address_id"`
+	// Deprecated: free-text addresses from older clients, used only without address IDs
+	ShippingAddress string `json:"shipping_address"`
+	BillingAddress  string `json:"billing_address"`
 	RentalDuration  int    `json:"rental_duration" binding:"required,min=1"`
+	VariantID       *uint  `json:"variant_id"`
+	PlanID          *uint  `json:"plan_id"`
 	Notes           string `json:"notes"`
 }
 
@@ -47,18 +59,55 @@ func CreateOrder(c *gin.Context) {
 
 	var orderRequest OrderRequest
 	if err := c.ShouldBindJSON(&orderRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 	fmt.Printf(" Received Payload: %+v\n", orderRequest)
 
+	if err := requireVerifiedEmail(database.DB.WithContext(c.Request.Context()), uint(customerID)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	override, err := orderRiskCheck(database.DB.WithContext(c.Request.Context()), uint(customerID))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
 	fmt.Println("Incoming Product ID:", orderRequest.ProductID)
 	fmt.Println("Incoming Franchise ID:", orderRequest.FranchiseID)
 
+	addresses, err := resolveOrderAddresses(database.DB.WithContext(c.Request.Context()), uint(customerID), orderRequest.ShippingAddressID, orderRequest.BillingAddressID,
+		orderRequest.ShippingAddress, orderRequest.BillingAddress)
+	if err != nil {
+		var addrErr *addressError
+		if errors.As(err, &addrErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": addrErr.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if orderRequest.FranchiseID == 0 {
+		assigned, err := addresses.franchise(database.DB.WithContext(c.Request.Context()), uint(customerID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "We don't service your area yet"})
+				return
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		orderRequest.FranchiseID = int64(assigned.ID)
+	}
+
 	// Get product details
 	var product database.Product
-	result := database.DB.First(&product, orderRequest.ProductID)
-	err := result.Error
+	result := database.DB.WithContext(c.Request.Context()).First(&product, orderRequest.ProductID)
+	err = result.Error
 
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -77,7 +126,7 @@ func CreateOrder(c *gin.Context) {
 
 	// Verify franchise exists and is active
 	var franchise database.Franchise
-	franchiseResult := database.DB.First(&franchise, orderRequest.FranchiseID)
+	franchiseResult := database.DB.WithContext(c.Request.Context()).First(&franchise, orderRequest.FranchiseID)
 	err = franchiseResult.Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -94,11 +143,30 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Calculate total initial amount
-	totalInitialAmount := product.SecurityDeposit + product.InstallationFee + product.MonthlyRent
+	price, err := resolvePricing(database.DB.WithContext(c.Request.Context()), product, orderRequest.VariantID, orderRequest.PlanID, orderRequest.RentalDuration)
+	if err != nil {
+		if isPricingError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	gst, err := loadGSTContext(database.DB.WithContext(c.Request.Context()), product.ID, franchise.ID, uint(customerID))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// Calculate total initial amount, with GST on top
+	tax := gst.onTaxable(price.initialAmount(1))
+	totalInitialAmount := tax.Total()
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -113,14 +181,20 @@ func CreateOrder(c *gin.Context) {
 		FranchiseID:        franchiseIDUint,
 		OrderType:          "rental",
 		Status:             database.OrderStatusPending,
-		ShippingAddress:    orderRequest.ShippingAddress,
-		BillingAddress:     orderRequest.BillingAddress,
+		ShippingAddress:    addresses.Shipping,
+		BillingAddress:     addresses.Billing,
+		ShippingAddressID:  addresses.ShippingID,
+		BillingAddressID:   addresses.BillingID,
 		RentalStartDate:    time.Now(), // rental_start_date will be confirmed after approval
 		RentalDuration:     orderRequest.RentalDuration,
-		MonthlyRent:        product.MonthlyRent,
-		SecurityDeposit:    product.SecurityDeposit,
-		InstallationFee:    product.InstallationFee,
+		VariantID:          price.VariantID,
+		PlanID:             price.PlanID,
+		PlanTerms:          price.Terms,
+		MonthlyRent:        price.MonthlyRent,
+		SecurityDeposit:    price.SecurityDeposit,
+		InstallationFee:    price.InstallationFee,
 		TotalInitialAmount: totalInitialAmount,
+		TaxBreakdown:       tax,
 		Notes:              orderRequest.Notes,
 	}
 
@@ -134,6 +208,26 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	if err := recordOrderStatus(tx, order.ID, "", order.Status, uint(customerID), "Order placed"); err != nil {
+		if err := tx.Rollback().Error; err != nil {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating order"})
+		return
+	}
+
+	if override != nil {
+		if err := risk.UseOverride(tx, override, order.ID); err != nil {
+			if err := tx.Rollback().Error; err != nil {
+				log.Printf("Failed to rollback transaction: %v", err)
+			}
+			log.Printf("Failed to use risk override %d: %v", override.ID, err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Orders cannot be placed from this account. Please contact support."})
+			return
+		}
+	}
+
 	orderID := int64(order.ID)
 
 	// Create pending payment
@@ -148,6 +242,7 @@ func CreateOrder(c *gin.Context) {
 		Status:        database.PaymentStatusPending,
 		InvoiceNumber: invoiceNumber,
 		Notes:         "Initial payment for order",
+		TaxBreakdown:  tax,
 	}
 
 	result = tx.Create(&payment)
@@ -160,23 +255,11 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Create notification for customer
-	relatedID := uint(orderID)
-	notification := database.Notification{
-		UserID:      uint(customerID),
-		Title:       "Order Placed Successfully",
-		Message:     "Your order for " + product.Name + " has been placed and is pending approval.",
-		Type:        "order",
-		RelatedID:   &relatedID,
-		RelatedType: "order",
-	}
-
-	result = tx.Create(&notification)
-	if result.Error != nil {
+	if err := publishOrderPlaced(tx, order, product.Name); err != nil {
 		if err := tx.Rollback().Error; err != nil {
 			log.Printf("Failed to rollback transaction: %v", err)
 		}
-		log.Printf("Database error: %v", result.Error)
+		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating notification"})
 		return
 	}
@@ -190,7 +273,7 @@ func CreateOrder(c *gin.Context) {
 
 	// Get the created order
 	var createdOrder database.Order
-	result = database.DB.First(&createdOrder, orderID)
+	result = database.DB.WithContext(c.Request.Context()).First(&createdOrder, orderID)
 	if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving order"})
@@ -204,30 +287,62 @@ func CreateOrder(c *gin.Context) {
 	})
 }
 
-func CancelOrder(c *gin.Context) {
-	fmt.Println(" CancelOrder hit!")
+// CancelOrderRequest captures why an order is being cancelled
+type CancelOrderRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
 
-	role, exists := c.Get("role")
-	fmt.Println("Role:", role)
-	if !exists {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
-		return
-	}
+// cancellableOrderStatuses are the states before the device reaches the
+// customer; from delivery on the subscription is running and must be
+// cancelled instead
+var cancellableOrderStatuses = map[string]bool{
+	database.OrderStatusPending:   true,
+	database.OrderStatusConfirmed: true,
+	database.OrderStatusApproved:  true,
+	database.OrderStatusInTransit: true,
+}
 
-	if role != "customer" && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
-		return
+// cancelOrderWriteTimeout bounds the writes that finish a cancellation once
+// the order is claimed; they run on past a cancelled or timed-out request
+const cancelOrderWriteTimeout = 30 * time.Second
+
+// errOrderCancelRace is a cancellation finished by another request first
+var errOrderCancelRace = errors.New("order changed concurrently")
+
+// statusBeforeCancelling is the status an order stuck in cancelling was
+// claimed from: the last one its timeline recorded
+func statusBeforeCancelling(db *gorm.DB, orderID uint) (string, error) {
+	var entry database.OrderStatusHistory
+	if err := db.Where("order_id = ?", orderID).Order("id DESC").First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return database.OrderStatusPending, nil
+		}
+		return "", err
 	}
+	return entry.ToStatus, nil
+}
 
-	orderIDStr := c.Param("id")
-	orderID, err := strconv.ParseInt(orderIDStr, 10, 64)
+// CancelOrder cancels an order before installation and refunds its initial
+// payment. Calling it again on an order left cancelling finishes that
+// cancellation, reusing the refund's receipt. (Customer or Admin)
+func CancelOrder(c *gin.Context) {
+	role := c.GetString("role")
+	userID := c.GetUint("user_id")
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
 	}
 
+	var req CancelOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("A cancellation reason is required"))
+		return
+	}
+
 	var order database.Order
-	if err := database.DB.First(&order, orderID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&order, orderID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 			return
@@ -237,36 +352,175 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 
-	// FIX: correct key and strict validation
-	userIDInterface, ok := c.Get("user_id")
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found"})
+	if role != database.RoleAdmin && order.CustomerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to cancel this order"})
 		return
 	}
-	userID, ok := userIDInterface.(uint)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+	resuming := order.Status == database.OrderStatusCancelling
+	if !cancellableOrderStatuses[order.Status] && !resuming {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order can no longer be cancelled (current: %s)", order.Status)})
 		return
 	}
-	fmt.Println("userID: ", userID)
+	if resuming {
+		from, err := statusBeforeCancelling(database.DB.WithContext(c.Request.Context()), order.ID)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		order.Status = from
+	}
 
-	// if order.CustomerID != userID && role != "admin" {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to cancel this order"})
-	// 	return
-	// }
+	if err := checkNoOpenDispute(database.DB.WithContext(c.Request.Context()), 0, order.ID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
 
-	order.Status = database.OrderStatusCancelled
+	var payment database.Payment
+	paymentErr := database.DB.WithContext(c.Request.Context()).Where("order_id = ? AND payment_type = ? AND status IN ?",
+		order.ID, "initial", []string{database.PaymentStatusSuccess, database.PaymentStatusPaid}).
+		First(&payment).Error
+	if paymentErr != nil && !errors.Is(paymentErr, gorm.ErrRecordNotFound) {
+		log.Printf("Database error: %v", paymentErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	paid := paymentErr == nil
+
+	// Claim the order before refunding, so of two concurrent cancellations
+	// only one reaches the gateway. A refund that fails puts the order back
+	// for a retry. An order already claimed stays cancelling until this
+	// finishes, as an earlier refund may have gone out.
+	if !resuming {
+		claim := database.DB.WithContext(c.Request.Context()).Model(&database.Order{}).
+			Where("id = ? AND status = ?", order.ID, order.Status).
+			Update("status", database.OrderStatusCancelling)
+		if claim.Error != nil {
+			log.Printf("Database error: %v", claim.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if claim.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order is already being cancelled or has changed, please refresh"})
+			return
+		}
+	}
 
-	if err := database.DB.Save(&order).Error; err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+	// From here the writes outlast the request, so a client that goes away
+	// or a request timeout can't leave the order cancelling
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), cancelOrderWriteTimeout)
+	defer cancel()
+	release := func() {
+		if resuming {
+			return
+		}
+		if err := database.DB.WithContext(writeCtx).Model(&database.Order{}).
+			Where("id = ? AND status = ?", order.ID, database.OrderStatusCancelling).
+			Update("status", order.Status).Error; err != nil {
+			log.Printf("Failed to release order %d from cancelling: %v", order.ID, err)
+		}
+	}
+
+	var refundID string
+	if paid && payment.PaymentMethod == "razorpay" {
+		gateway := paymentGatewayFor(c)
+		data := map[string]interface{}{
+			"notes": map[string]interface{}{
+				"order_id": order.ID,
+				"reason":   req.Reason,
+			},
+		}
+		rzpRefund, err := callRazorpay(c, "refund_create", func() (map[string]interface{}, error) {
+			return gateway.Refund(payment.TransactionID, int(math.Round(payment.Amount*100)), fmt.Sprintf("order-%d-cancel", order.ID), data)
+		})
+		if err != nil {
+			log.Printf("Razorpay refund for order %d failed: %v", order.ID, err)
+			release()
+			respondRazorpayError(c, err, http.StatusBadGateway, "Refund could not be initiated, please try again")
+			return
+		}
+		refundID = mapString(rzpRefund, "id")
+	}
+
+	before := order
+	now := time.Now()
+	err = database.DB.WithContext(writeCtx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Order{}).
+			Where("id = ? AND status = ?", order.ID, database.OrderStatusCancelling).
+			Updates(map[string]interface{}{
+				"status":              database.OrderStatusCancelled,
+				"cancellation_reason": req.Reason,
+				"cancelled_at":        now,
+				"cancelled_by":        userID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderCancelRace
+		}
+		if err := recordOrderStatus(tx, order.ID, order.Status, database.OrderStatusCancelled, userID, req.Reason); err != nil {
+			return err
+		}
+
+		if refundID != "" {
+			if err := tx.Model(&database.Payment{}).Where("id = ?", payment.ID).
+				Updates(map[string]interface{}{
+					"status":             database.PaymentStatusRefunded,
+					"razorpay_refund_id": refundID,
+					"refunded_at":        now,
+				}).Error; err != nil {
+				return err
+			}
+			if err := ledger.PostRefund(tx, payment); err != nil {
+				return err
+			}
+		}
+
+		if err := releaseCoupon(tx, order.ID); err != nil {
+			return err
+		}
+
+		return publishOrderCancelled(tx, order, payment.Amount, refundID != "", req.Reason)
+	})
+	if errors.Is(err, errOrderCancelRace) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is already being cancelled or has changed, please refresh"})
+		return
+	}
+	if err != nil {
+		// A refund that has gone out keeps the order cancelling rather than
+		// open to a second refund; cancelling it again finishes the job
+		log.Printf("Failed to cancel order %d (refund %q): %v", order.ID, refundID, err)
+		if refundID == "" {
+			release()
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order, please try again"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
+	order.Status = database.OrderStatusCancelled
+	order.CancellationReason = req.Reason
+	order.CancelledAt = &now
+	order.CancelledBy = &userID
+	recordAudit(c, nil, "order.cancel", "order", order.ID, before, order)
+
+	refundStatus := "not_applicable"
+	switch {
+	case refundID != "":
+		refundStatus = "initiated"
+	case paid:
+		refundStatus = "manual" // paid outside Razorpay; the franchise settles it
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Order cancelled successfully",
+		"refund_status": refundStatus,
+		"refund_id":     refundID,
+	})
 }
 
-// GetCustomerOrders gets orders for the authenticated customer
+// GetCustomerOrders gets orders for the authenticated customer. Passing
+// ?cursor (empty for the first page) switches to keyset pagination.
 func GetCustomerOrders(c *gin.Context) {
 	role, exists := c.Get("role")
 	if !exists || role != "customer" {
@@ -299,7 +553,7 @@ func GetCustomerOrders(c *gin.Context) {
 	var orders []OrderWithProduct
 
 	// Use GORM's joins to get orders with product info and successful payments
-	result := database.DB.Table("orders").
+	query := database.DB.WithContext(c.Request.Context()).Table("orders").
 		Select(`DISTINCT orders.id as id, 
           orders.status, 
           orders.created_at, 
@@ -310,17 +564,36 @@ func GetCustomerOrders(c *gin.Context) {
 		Joins("JOIN products ON orders.product_id = products.id").
 		Joins("JOIN payments ON orders.id = payments.order_id").
 		Where("orders.customer_id = ? AND payments.status = ?", customerID, "success").
-		Order("orders.created_at DESC").
-		Find(&orders)
+		Where(notDeleted("orders"))
 
-	if result.Error != nil {
-		log.Printf("Database error: %v", result.Error)
+	if cursorRequested(c) {
+		page, limit, ok := keysetPage(c, query, "orders")
+		if !ok {
+			return
+		}
+		if err := page.Find(&orders).Error; err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		orders, next := nextCursor(orders, limit, func(o OrderWithProduct) (time.Time, uint) {
+			return o.CreatedAt, o.ID
+		})
+		c.JSON(http.StatusOK, gin.H{"orders": orders, "next_cursor": next})
+		return
+	}
+
+	if err := query.Order("orders.created_at DESC").Find(&orders).Error; err != nil {
+		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
 		return
 	}
 
 	c.JSON(http.StatusOK, orders)
 }
+
+// GetAllOrders lists orders for admins and franchise owners. Passing
+// ?cursor (empty for the first page) switches to keyset pagination.
 func GetAllOrders(c *gin.Context) {
 	role, exists := c.Get("role")
 	if !exists || (role != "admin" && role != "franchise_owner") {
@@ -328,29 +601,34 @@ func GetAllOrders(c *gin.Context) {
 		return
 	}
 
-	userID := c.MustGet("user_id").(uint)
-
-	var orders []database.Order
-	var result *gorm.DB
-
-	if role == "admin" {
-		// Admin sees all orders
-		result = database.DB.Preload("Product").Order("created_at DESC").Find(&orders)
-	} else if role == "franchise_owner" {
-		// Franchise owner sees only their franchise's orders
-		var user database.User
-		if err := database.DB.First(&user, userID).Error; err != nil || user.FranchiseID == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Franchise not linked to your account"})
+	// Admin sees all orders
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Order{}).Preload("Product")
+	if role == "franchise_owner" {
+		// Franchise owner sees only their franchises' orders
+		franchiseIDs, ok := ownerFranchiseIDs(c)
+		if !ok {
 			return
 		}
-		result = database.DB.
-			Where("franchise_id = ?", *user.FranchiseID).
-			Preload("Product").
-			Order("created_at DESC").
-			Find(&orders)
+		query = query.Where("franchise_id IN ?", franchiseIDs)
 	}
 
-	if result.Error != nil {
+	var orders []database.Order
+	var next string
+	paginated := cursorRequested(c)
+
+	if paginated {
+		page, limit, ok := keysetPage(c, query, "orders")
+		if !ok {
+			return
+		}
+		if err := page.Find(&orders).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+			return
+		}
+		orders, next = nextCursor(orders, limit, func(o database.Order) (time.Time, uint) {
+			return o.CreatedAt, o.ID
+		})
+	} else if err := query.Order("created_at DESC").Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
 		return
 	}
@@ -381,6 +659,10 @@ func GetAllOrders(c *gin.Context) {
 		})
 	}
 
+	if paginated {
+		c.JSON(http.StatusOK, gin.H{"orders": response, "next_cursor": next})
+		return
+	}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -410,24 +692,27 @@ func GetOrderByID(c *gin.Context) {
 	// Define order detail struct with joined fields
 	type OrderDetail struct {
 		database.Order
-		ProductName       string `json:"product_name"`
-		ProductImage      string `json:"product_image"`
-		CustomerName      string `json:"customer_name"`
-		CustomerEmail     string `json:"customer_email"`
-		CustomerPhone     string `json:"customer_phone"`
-		ServiceAgentName  string `json:"service_agent_name"`
-		ServiceAgentPhone string `json:"service_agent_phone"`
+		ProductName         string `json:"product_name"`
+		ProductImage        string `json:"product_image"`
+		CustomerName        string `json:"customer_name"`
+		CustomerEmail       string `json:"customer_email"`
+		CustomerPhone       string `json:"customer_phone"`
+		CustomerPicture     string `json:"customer_profile_picture"`
+		ServiceAgentName    string `json:"service_agent_name"`
+		ServiceAgentPhone   string `json:"service_agent_phone"`
+		ServiceAgentPicture string `json:"service_agent_profile_picture"`
 	}
 
 	// Start building the query with GORM
 	var orderDetail OrderDetail
 
 	// Base query with joins
-	query := database.DB.Table("orders").
-		Select("orders.*, products.name as product_name, products.image_url as product_image, users.name as customer_name, users.email as customer_email, users.phone as customer_phone").
+	query := database.DB.WithContext(c.Request.Context()).Table("orders").
+		Select("orders.*, products.name as product_name, products.image_url as product_image, users.name as customer_name, users.email as customer_email, users.phone as customer_phone, users.profile_picture as customer_profile_picture").
 		Joins("JOIN products ON orders.product_id = products.id").
 		Joins("JOIN users ON orders.customer_id = users.id").
-		Where("orders.id = ?", orderID)
+		Where("orders.id = ?", orderID).
+		Where(notDeleted("orders"))
 
 	// Add role-specific conditions
 	switch role {
@@ -454,12 +739,13 @@ func GetOrderByID(c *gin.Context) {
 	// adding service agent details if orderid has serviceagentid
 	if orderDetail.ServiceAgentID != nil {
 		var serviceAgent database.User
-		if err := database.DB.First(&serviceAgent, *orderDetail.ServiceAgentID).Error; err != nil {
+		if err := database.DB.WithContext(c.Request.Context()).First(&serviceAgent, *orderDetail.ServiceAgentID).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service agent details"})
 			
 		}
 		orderDetail.ServiceAgentName = serviceAgent.Name
 		orderDetail.ServiceAgentPhone = serviceAgent.Phone
+		orderDetail.ServiceAgentPicture = serviceAgent.ProfilePicture
 	}
 
 	fmt.Println("Result:", result, "\nOrder Detail:", orderDetail)
@@ -504,7 +790,7 @@ func UpdateOrderStatus(c *gin.Context) {
 	fmt.Println("✅ Order ID parsed successfully")
 	var statusRequest UpdateOrderStatusRequest
 	if err := c.ShouldBindJSON(&statusRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -514,21 +800,35 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	// Installation is confirmed by the agent with the customer's OTP
+	if role != "admin" && statusRequest.Status == database.OrderStatusInstalled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Installation must be confirmed with the customer's code via /agent/orders/:id/confirm-installation"})
+		return
+	}
+	if statusRequest.Status == database.OrderStatusInstalled {
+		filed, err := hasInstallationReport(database.DB.WithContext(c.Request.Context()), uint(orderID))
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if !filed {
+			c.JSON(http.StatusConflict, gin.H{"error": "An installation report is required before the order can be marked installed"})
+			return
+		}
+	}
+
 	// Check if order exists and get current status
 	var currentStatus string
 	var franchiseID int64
-	var customerID int64
-	var productID int64
 
 	var order database.Order
-	err = database.DB.Where("id = ?", orderID).
-		Select("status, franchise_id, customer_id, product_id").
+	err = database.DB.WithContext(c.Request.Context()).Where("id = ?", orderID).
+		Select("status, franchise_id").
 		First(&order).Error
 	if err == nil {
 		currentStatus = order.Status
 		franchiseID = int64(order.FranchiseID)
-		customerID = int64(order.CustomerID)
-		productID = int64(order.ProductID)
 	}
 	fmt.Println("✅ Order details retrieved successfully ", orderID, franchiseID)
 
@@ -542,41 +842,17 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// If franchise owner, check if they own the franchise
+	// If franchise owner, check if they own the order's franchise
 	if role == "franchise_owner" {
 		userID, _ := c.Get("user_id")
 
-		var user struct {
-			FranchiseID uint
-		}
-		err := database.DB.Table("users").
-			Select("franchise_id").
-			Where("id = ? AND role = ?", userID, "franchise_owner").
-			Scan(&user).Error
-		if err != nil {
-			log.Printf("Database error fetching franchise_id: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
-			return
-		}
-	
-		// Step 2: Use franchise_id to get franchise details
 		var franchise database.Franchise
-		err = database.DB.Where("id = ?", user.FranchiseID).First(&franchise).Error
-		if err != nil {
+		err = database.DB.WithContext(c.Request.Context()).Select("id, owner_id").First(&franchise, franchiseID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Printf("Database error fetching franchise: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
 			return
 		}
-	
-		fmt.Println("✅ Franchise ID retrieved successfully", franchise.ID)
-
-
-	
-		if err != nil {
-			log.Printf("Database error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
-			return
-		}
 		ownerID := uint(franchise.OwnerID)
 		fmt.Println("✅ Owner ID retrieved successfully", ownerID)
 		if ownerID != userID.(uint) {
@@ -586,7 +862,7 @@ func UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -604,135 +880,132 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Update order status
-	order.Status = statusRequest.Status
-
 	// Only update serviceAgentID if provided
 	if statusRequest.ServiceAgentID != nil && *statusRequest.ServiceAgentID > 0 {
 		agentID := uint(*statusRequest.ServiceAgentID)
 		order.ServiceAgentID = &agentID
 	}
 
+	if err := applyOrderStatus(tx, &order, statusRequest.Status, statusRequest.Notes, c.GetUint("user_id")); err != nil {
+		if err := tx.Rollback().Error; err != nil {
+			log.Printf("Failed to rollback transaction: %v", err)
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// The customer gets the code to hand the agent once the device is on its way
+	if statusRequest.Status == database.OrderStatusInTransit && currentStatus != database.OrderStatusInTransit {
+		if err := sendInstallationOTP(database.DB.WithContext(c.Request.Context()), order); err != nil {
+			log.Printf("Failed to send installation code for order %d: %v", order.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+}
+
+// applyOrderStatus moves an order loaded in tx to status, appending notes,
+// and does what the new status entails: generating the rental agreement on
+// approval, taking the unit out of stock on installation, starting the
+// subscription on delivery and notifying the customer. Errors are *apperror.Error values ready to respond with.
+func applyOrderStatus(tx *gorm.DB, order *database.Order, status, notes string, actorID uint) error {
+	currentStatus := order.Status
+	if currentStatus == database.OrderStatusCancelling {
+		return apperror.Conflict("Order is being cancelled")
+	}
+	order.Status = status
+
 	// Append notes if provided
-	if statusRequest.Notes != "" {
+	if notes != "" {
 		if order.Notes != "" {
-			order.Notes = order.Notes + " | " + statusRequest.Notes
+			order.Notes = order.Notes + " | " + notes
 		} else {
-			order.Notes = statusRequest.Notes
+			order.Notes = notes
 		}
 	}
 
-	if err := tx.Save(&order).Error; err != nil {
-		if err := tx.Rollback().Error; err != nil {
-			log.Printf("Failed to rollback transaction: %v", err)
+	if err := tx.Save(order).Error; err != nil {
+		return apperror.Internal(err).WithMessage("Error updating order status")
+	}
+
+	if status != currentStatus || notes != "" {
+		if err := recordOrderStatus(tx, order.ID, currentStatus, status, actorID, notes); err != nil {
+			return apperror.Internal(err).WithMessage("Error updating order status")
 		}
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating order status"})
-		return
 	}
 
-	// If status changed to "approved", create subscription
-	if statusRequest.Status == database.OrderStatusDelivered && currentStatus != database.OrderStatusDelivered {
-		// We already have the order from earlier, but we need to reload to get all fields
-		if err := tx.First(&order, orderID).Error; err != nil {
-			if err := tx.Rollback().Error; err != nil {
-				log.Printf("Failed to rollback transaction: %v", err)
+	if status == database.OrderStatusApproved && currentStatus != database.OrderStatusApproved {
+		if err := createRentalAgreement(tx, order.ID); err != nil {
+			return apperror.Internal(err).WithMessage("Error generating rental agreement")
+		}
+	}
+
+	// Take the installed unit out of the franchise's stock
+	if status == database.OrderStatusInstalled && currentStatus != database.OrderStatusInstalled {
+		if err := consumeInstalledUnit(tx, *order, actorID); err != nil {
+			var stockErr *stockError
+			if errors.As(err, &stockErr) {
+				return apperror.Conflict(stockErr.Error())
 			}
-			log.Printf("Database error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving order details"})
-			return
+			return apperror.Internal(err).WithMessage("Error updating inventory")
 		}
+	}
 
-		// Calculate end date and next billing date
+	// Start the rental once the device is delivered
+	if status == database.OrderStatusDelivered && currentStatus != database.OrderStatusDelivered {
 		startDate := time.Now() // Use current time as actual start date
-		endDate := startDate.AddDate(0, order.RentalDuration, 0)
-		nextBillingDate := startDate.AddDate(0, 1, 0) // Next month
-
-		// Create subscription with GORM
+		firstMaintenance := startDate.AddDate(0, 3, 0) // 3 months after start
+		var servicesPerYear int
+		if order.PlanTerms != nil && order.PlanTerms.ServicesPerYear > 0 {
+			servicesPerYear = order.PlanTerms.ServicesPerYear
+			firstMaintenance = startDate.AddDate(0, 0, 365/servicesPerYear)
+		}
 		subscription := database.Subscription{
-			OrderID:          uint(orderID),
-			CustomerID:       uint(customerID),
-			ProductID:        uint(productID),
-			FranchiseID:      uint(franchiseID),
+			OrderID:          order.ID,
+			CustomerID:       order.CustomerID,
+			ProductID:        order.ProductID,
+			FranchiseID:      order.FranchiseID,
 			Status:           database.SubscriptionStatusActive,
 			StartDate:        startDate,
-			EndDate:          endDate,
-			NextBillingDate:  nextBillingDate,
+			EndDate:          startDate.AddDate(0, order.RentalDuration, 0),
+			NextBillingDate:  startDate.AddDate(0, 1, 0), // Next month
 			MonthlyRent:      order.MonthlyRent,
-			LastMaintenance:  time.Time{},                // Zero value
-			NextMaintenance:  startDate.AddDate(0, 3, 0), // 3 months after start
+			ServicesPerYear:  servicesPerYear,
+			LastMaintenance:  time.Time{}, // Zero value
+			NextMaintenance:  firstMaintenance,
 			MaintenanceNotes: "Initial setup complete",
-			Notes:            "Created from order #" + strconv.FormatInt(orderID, 10),
+			Notes:            "Created from order #" + strconv.FormatUint(uint64(order.ID), 10),
 		}
-
 		if err := tx.Create(&subscription).Error; err != nil {
-			if err := tx.Rollback().Error; err != nil {
-				log.Printf("Failed to rollback transaction: %v", err)
-			}
-			log.Printf("Database error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating subscription"})
-			return
+			return apperror.Internal(err).WithMessage("Error creating subscription")
 		}
 
-		// Update order's rental start date to actual start date
-		order.RentalStartDate = startDate
-		if err := tx.Save(&order).Error; err != nil {
-			if err := tx.Rollback().Error; err != nil {
-				log.Printf("Failed to rollback transaction: %v", err)
-			}
-			log.Printf("Database error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating order start date"})
-			return
+		// Link any auto-debit mandate set up at order time to the new subscription
+		if err := tx.Model(&database.Mandate{}).
+			Where("order_id = ? AND subscription_id IS NULL", order.ID).
+			Update("subscription_id", subscription.ID).Error; err != nil {
+			return apperror.Internal(err).WithMessage("Error linking mandate to subscription")
 		}
-	}
-
-	// Create notification for customer
-	var message string
-	switch statusRequest.Status {
-	case database.OrderStatusApproved:
-		message = "Your order has been approved. Your subscription is now active."
-	case database.OrderStatusRejected:
-		message = "Your order has been rejected. Please contact customer support for details."
-	case database.OrderStatusCancelled:
-		message = "Your order has been cancelled."
-	case database.OrderStatusInTransit:
-		message = "Your order is in transit and will be delivered soon."
-	case database.OrderStatusDelivered:
-		message = "Your order has been delivered. Installation will be scheduled soon."
-	case database.OrderStatusInstalled:
-		message = "Your water purifier has been successfully installed."
-	default:
-		message = "Your order status has been updated to " + statusRequest.Status
-	}
 
-	// Create notification using GORM
-	relatedIDUint := uint(orderID)
-	notification := database.Notification{
-		UserID:      uint(customerID),
-		Title:       "Order Status Updated",
-		Message:     message,
-		Type:        "order",
-		RelatedID:   &relatedIDUint,
-		RelatedType: "order",
-	}
-
-	if err := tx.Create(&notification).Error; err != nil {
-		if err := tx.Rollback().Error; err != nil {
-			log.Printf("Failed to rollback transaction: %v", err)
+		// Update order's rental start date to actual start date
+		order.RentalStartDate = startDate
+		if err := tx.Save(order).Error; err != nil {
+			return apperror.Internal(err).WithMessage("Error updating order start date")
 		}
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating notification"})
-		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		log.Printf("Transaction commit error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
-		return
+	// Notify the customer in the same transaction, so the message can't be lost
+	if err := publishOrderStatusChanged(tx, order.ID, order.CustomerID, status); err != nil {
+		return apperror.Internal(err).WithMessage("Error creating notification")
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+	return nil
 }
 
 // AssignOrderRequest represents the payload for assigning a franchise
@@ -757,22 +1030,24 @@ func AssignOrderToFranchise(c *gin.Context) {
 
 	var req AssignOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	var order database.Order
-	if err := database.DB.First(&order, orderID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&order, orderID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
+	before := order
 	order.FranchiseID = req.FranchiseID
 
-	if err := database.DB.Save(&order).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Save(&order).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign franchise"})
 		return
 	}
+	recordAudit(c, nil, "order.assign_franchise", "order", order.ID, before, order)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Franchise assigned", "order": order})
 }
@@ -788,7 +1063,7 @@ func AssignOrderToAgent(c *gin.Context) {
 	fmt.Println(" AssignOrderToAgent route hit!")
 
 	role, _ := c.Get("role")
-	if role != "admin" && role != "franchise_owner" {
+	if role != "admin" && role != "franchise_owner" && role != database.RoleFranchiseStaff {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
 		return
 	}
@@ -804,23 +1079,64 @@ func AssignOrderToAgent(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
+	var staffIDs []uint
+	if role == database.RoleFranchiseStaff {
+		ids, ok := ownerFranchiseIDs(c)
+		if !ok {
+			return
+		}
+		staffIDs = ids
+	}
+
 	// Update order with service agent ID
-	if err := database.DB.Model(&database.Order{}).
-		Where("id = ?", orderID).
-		Update("service_agent_id", req.ServiceAgentID).Error; err != nil {
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var current database.Order
+		if err := tx.Select("id, status, franchise_id, delivery_date").First(&current, orderID).Error; err != nil {
+			return err
+		}
+		// Staff only assign orders of the franchises they work for
+		if role == database.RoleFranchiseStaff && !slices.Contains(staffIDs, current.FranchiseID) {
+			return gorm.ErrRecordNotFound
+		}
+		// The agent must be working on the installation day
+		if !current.DeliveryDate.IsZero() {
+			if err := checkAgentAvailable(tx, req.ServiceAgentID, current.DeliveryDate, time.Time{}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&database.Order{}).
+			Where("id = ?", orderID).
+			Update("service_agent_id", req.ServiceAgentID).Error; err != nil {
+			return err
+		}
+		return recordOrderStatus(tx, current.ID, current.Status, current.Status, c.GetUint("user_id"),
+			fmt.Sprintf("Assigned to service agent #%d", req.ServiceAgentID))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to assign service agent to order %d: %v", orderID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign service agent"})
 		return
 	}
+	recordAudit(c, nil, "order.assign_agent", "order", uint(orderID), nil, gin.H{"service_agent_id": req.ServiceAgentID})
 
 	// Reload the full order with related data
 	var order database.Order
 	// Use orderID directly here instead of order.ID
 	// Use the incoming `orderID` directly, not `order.ID`
-	if err := database.DB.
+	if err := database.DB.WithContext(c.Request.Context()).
 		Preload("Customer").
 		Preload("Product").
 		Preload("Franchise.Owner").
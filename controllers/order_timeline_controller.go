@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// OrderTimelineEntry is one step in an order's timeline
+type OrderTimelineEntry struct {
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+	Note          string    `json:"note"`
+	ChangedBy     *uint     `json:"changed_by"`
+	ChangedByName string    `json:"changed_by_name"`
+	ChangedByRole string    `json:"changed_by_role"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+// recordOrderStatus appends a step to an order's history. changedBy is zero
+// for system changes.
+func recordOrderStatus(tx *gorm.DB, orderID uint, from, to string, changedBy uint, note string) error {
+	entry := database.OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Note:       note,
+	}
+	if changedBy != 0 {
+		entry.ChangedBy = &changedBy
+	}
+	return tx.Create(&entry).Error
+}
+
+// orderForViewer loads the order named by :id if the caller is its customer,
+// its franchise owner, the assigned agent or an admin
+func orderForViewer(c *gin.Context) (database.Order, bool) {
+	var order database.Order
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Franchise").First(&order, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return order, false
+	}
+
+	userID := c.GetUint("user_id")
+	allowed := false
+	switch c.GetString("role") {
+	case database.RoleAdmin:
+		allowed = true
+	case database.RoleFranchiseOwner:
+		allowed = order.Franchise.OwnerID == userID
+	case database.RoleServiceAgent:
+		allowed = order.ServiceAgentID != nil && *order.ServiceAgentID == userID
+	case database.RoleCustomer:
+		allowed = order.CustomerID == userID
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// GetOrderTimeline lists an order's status changes, oldest first
+func GetOrderTimeline(c *gin.Context) {
+	order, ok := orderForViewer(c)
+	if !ok {
+		return
+	}
+
+	var history []database.OrderStatusHistory
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Changer").Where("order_id = ?", order.ID).
+		Order("created_at ASC, id ASC").Find(&history).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order timeline"})
+		return
+	}
+
+	timeline := make([]OrderTimelineEntry, 0, len(history))
+	for _, h := range history {
+		entry := OrderTimelineEntry{
+			FromStatus: h.FromStatus,
+			ToStatus:   h.ToStatus,
+			Note:       h.Note,
+			ChangedBy:  h.ChangedBy,
+			ChangedAt:  h.CreatedAt,
+		}
+		if h.Changer != nil {
+			entry.ChangedByName = h.Changer.Name
+			entry.ChangedByRole = h.Changer.Role
+		}
+		timeline = append(timeline, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id": order.ID,
+		"status":   order.Status,
+		"timeline": timeline,
+	})
+}
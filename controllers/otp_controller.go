@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Phone OTP settings
+const (
+	phoneOTPTTL         = 5 * time.Minute
+	phoneOTPMaxPerPhone = 3 // codes per phone within phoneOTPWindow
+	phoneOTPWindow      = 15 * time.Minute
+	phoneOTPMaxAttempts = 5
+)
+
+// OTPRequest asks for a login code
+type OTPRequest struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// OTPVerifyRequest exchanges a login code for a session. Name is only needed
+// when the phone number has no account yet.
+type OTPVerifyRequest struct {
+	Phone string `json:"phone" binding:"required"`
+	OTP   string `json:"otp" binding:"required,len=6,numeric"`
+	Name  string `json:"name"`
+}
+
+// Errors returned from the OTP login transaction
+var (
+	errOTPSignupNeedsName = errors.New("otp signup needs a name")
+	errOTPCustomersOnly   = errors.New("otp login is for customers only")
+)
+
+// RequestPhoneOTP sends a login code to a customer's phone
+// POST /api/auth/otp/request
+func RequestPhoneOTP(c *gin.Context) {
+	var request OTPRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("Phone number is required"))
+		return
+	}
+
+	phone := utils.NormalizePhone(request.Phone)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a valid 10-digit mobile number"})
+		return
+	}
+
+	var recent int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.PhoneOTP{}).
+		Where("phone = ? AND created_at > ?", phone, time.Now().Add(-phoneOTPWindow)).
+		Count(&recent)
+	if recent >= phoneOTPMaxPerPhone {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many codes requested, please try again later"})
+		return
+	}
+
+	code, err := utils.GenerateNumericOTP(6)
+	if err != nil {
+		log.Printf("OTP generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	otp := database.PhoneOTP{
+		Phone:     phone,
+		CodeHash:  utils.HashToken(code),
+		ExpiresAt: time.Now().Add(phoneOTPTTL),
+		RequestIP: c.ClientIP(),
+	}
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Only the newest code stays valid
+		if err := tx.Model(&database.PhoneOTP{}).
+			Where("phone = ? AND used_at IS NULL", phone).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&otp).Error
+	})
+	if err != nil {
+		log.Printf("Error storing OTP: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	message := fmt.Sprintf("%s is your AquaHome login code. It expires in %d minutes. Do not share it with anyone.",
+		code, int(phoneOTPTTL.Minutes()))
+	if err := utils.SendSMS(phone, message); err != nil {
+		log.Printf("Failed to send OTP SMS: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send code, please try again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Code sent",
+		"expires_in": int(phoneOTPTTL.Seconds()),
+	})
+}
+
+// VerifyPhoneOTP checks a login code and signs the customer in, creating a
+// customer account for new numbers
+// POST /api/auth/otp/verify
+func VerifyPhoneOTP(c *gin.Context) {
+	var request OTPVerifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("Phone and 6-digit code are required"))
+		return
+	}
+
+	phone := utils.NormalizePhone(request.Phone)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enter a valid 10-digit mobile number"})
+		return
+	}
+
+	var otp database.PhoneOTP
+	err := database.DB.WithContext(c.Request.Context()).Where("phone = ? AND used_at IS NULL AND expires_at > ?", phone, time.Now()).
+		Order("created_at DESC").
+		First(&otp).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return
+	}
+
+	// Take a guess off the code before comparing, so parallel guesses can't
+	// get past the limit
+	guess := database.DB.WithContext(c.Request.Context()).Model(&database.PhoneOTP{}).
+		Where("id = ? AND used_at IS NULL AND attempts < ?", otp.ID, phoneOTPMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if guess.Error != nil {
+		log.Printf("Database error: %v", guess.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if guess.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	if !utils.TokensEqual(otp.CodeHash, utils.HashToken(request.OTP)) {
+		// The last wrong guess uses the code up
+		database.DB.WithContext(c.Request.Context()).Model(&database.PhoneOTP{}).
+			Where("id = ? AND used_at IS NULL AND attempts >= ?", otp.ID, phoneOTPMaxAttempts).
+			Update("used_at", time.Now())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	var user database.User
+	var response LoginResponse
+	created := false
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Claim the code so it can't be used twice
+		result := tx.Model(&database.PhoneOTP{}).
+			Where("id = ? AND used_at IS NULL", otp.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		err := tx.Where("phone IN ?", []string{phone, "+91" + phone, "91" + phone, "0" + phone}).
+			Order("id").
+			First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if strings.TrimSpace(request.Name) == "" {
+				return errOTPSignupNeedsName
+			}
+			user = database.User{
+				Name:  strings.TrimSpace(request.Name),
+				Phone: phone,
+				Role:  database.RoleCustomer,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			created = true
+		case err != nil:
+			return err
+		case user.Role != database.RoleCustomer:
+			return errOTPCustomersOnly
+		}
+
+		now := time.Now()
+		if err := tx.Model(&user).Update("phone_verified_at", now).Error; err != nil {
+			return err
+		}
+		user.PhoneVerifiedAt = &now
+
+		response, err = issueSession(c, tx, user)
+		return err
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+		return
+	case errors.Is(err, errOTPSignupNeedsName):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No account found for this number. Send your name to sign up.", "needs_name": true})
+		return
+	case errors.Is(err, errOTPCustomersOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": "OTP login is only available for customers"})
+		return
+	default:
+		log.Printf("OTP login error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// GetOutboxEvents lists outbox events, newest first, filtered by ?status
+// (pending, processed, failed) and ?name (Admin only)
+// GET /api/admin/outbox
+func GetOutboxEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.OutboxEvent{})
+	switch c.Query("status") {
+	case "":
+	case database.OutboxStatusPending:
+		query = query.Where("processed_at IS NULL AND failed_at IS NULL")
+	case database.OutboxStatusProcessed:
+		query = query.Where("processed_at IS NOT NULL")
+	case database.OutboxStatusFailed:
+		query = query.Where("failed_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, processed or failed"})
+		return
+	}
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outbox events"})
+		return
+	}
+	var outboxEvents []database.OutboxEvent
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&outboxEvents).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outbox events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": outboxEvents, "total": total, "page": page, "limit": limit})
+}
+
+// RetryOutboxEvent relays a failed outbox event again right away. Channels
+// that already succeeded are not sent twice. (Admin only)
+// POST /api/admin/outbox/:id/retry
+func RetryOutboxEvent(c *gin.Context) {
+	var outboxEvent database.OutboxEvent
+	if err := database.DB.WithContext(c.Request.Context()).First(&outboxEvent, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Outbox event not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if outboxEvent.Status() != database.OutboxStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed outbox events can be retried"})
+		return
+	}
+
+	if err := events.RetryOutboxEvent(outboxEvent.ID); err != nil {
+		log.Printf("Outbox event %d failed: %v", outboxEvent.ID, err)
+	}
+
+	database.DB.WithContext(c.Request.Context()).First(&outboxEvent, outboxEvent.ID)
+	recordAudit(c, nil, "outbox_event.retry", "outbox_event", outboxEvent.ID, nil, nil)
+	c.JSON(http.StatusOK, outboxEvent)
+}
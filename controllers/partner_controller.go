@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// PartnerServiceRequest raises a service request from a partner system, such
+// as an IoT monitor that detected a fault
+type PartnerServiceRequest struct {
+	SubscriptionID uint   `json:"subscription_id" binding:"required"`
+	Type           string `json:"type" binding:"required,oneof=repair maintenance"`
+	Description    string `json:"description" binding:"required,max=2000"`
+}
+
+// partnerKey returns the API key the request was authenticated with
+func partnerKey(c *gin.Context) database.APIKey {
+	key, _ := c.Get("api_key")
+	apiKey, _ := key.(database.APIKey)
+	return apiKey
+}
+
+// scopePartner limits a query to the key's franchise, when it has one
+func scopePartner(c *gin.Context, query *gorm.DB, column string) *gorm.DB {
+	if key := partnerKey(c); key.FranchiseID != nil {
+		return query.Where(column+" = ?", *key.FranchiseID)
+	}
+	return query
+}
+
+// partnerListQuery applies the filters partner list endpoints share,
+// ?status and ?updated_since (RFC3339), and returns the page and limit. It
+// writes the error response and returns false on failure.
+func partnerListQuery(c *gin.Context, query *gorm.DB) (*gorm.DB, int, int, bool) {
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if since := c.Query("updated_since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "updated_since must be an RFC3339 time"})
+			return query, 0, 0, false
+		}
+		query = query.Where("updated_at >= ?", t)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	return query, page, limit, true
+}
+
+// PartnerGetProducts lists the active product catalog
+// GET /api/partner/products
+func PartnerGetProducts(c *gin.Context) {
+	var products []database.Product
+	if err := database.DB.WithContext(c.Request.Context()).Where("is_active = ?", true).Order("id").Find(&products).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+// PartnerGetOrders lists orders, oldest update first so partners can sync
+// incrementally with ?updated_since
+// GET /api/partner/orders?status=&updated_since=&page=&limit=
+func PartnerGetOrders(c *gin.Context) {
+	query, page, limit, ok := partnerListQuery(c, scopePartner(c, database.DB.WithContext(c.Request.Context()).Model(&database.Order{}), "franchise_id"))
+	if !ok {
+		return
+	}
+
+	var total int64
+	var orders []database.Order
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	if err := query.Order("updated_at, id").Offset((page - 1) * limit).Limit(limit).Find(&orders).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orders": orders, "total": total, "page": page, "limit": limit})
+}
+
+// PartnerGetSubscription looks up a subscription
+// GET /api/partner/subscriptions/:id
+func PartnerGetSubscription(c *gin.Context) {
+	var subscription database.Subscription
+	if err := scopePartner(c, database.DB.WithContext(c.Request.Context()), "franchise_id").First(&subscription, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	c.JSON(http.StatusOK, subscription)
+}
+
+// PartnerGetServiceRequests lists service requests, oldest update first
+// GET /api/partner/service-requests?status=&updated_since=&page=&limit=
+func PartnerGetServiceRequests(c *gin.Context) {
+	query, page, limit, ok := partnerListQuery(c, scopePartner(c, database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}), "franchise_id"))
+	if !ok {
+		return
+	}
+
+	var total int64
+	var requests []database.ServiceRequest
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service requests"})
+		return
+	}
+	if err := query.Order("updated_at, id").Offset((page - 1) * limit).Limit(limit).Find(&requests).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service requests"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service_requests": requests, "total": total, "page": page, "limit": limit})
+}
+
+// PartnerCreateServiceRequest raises a service request for an active
+// subscription and notifies the customer and the franchise owner
+// POST /api/partner/service-requests
+func PartnerCreateServiceRequest(c *gin.Context) {
+	var req PartnerServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var subscription database.Subscription
+	if err := scopePartner(c, database.DB.WithContext(c.Request.Context()), "franchise_id").
+		First(&subscription, req.SubscriptionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if subscription.Status != SubscriptionStatusActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot create service request for inactive subscription"})
+		return
+	}
+
+	serviceRequest := database.ServiceRequest{
+		CustomerID:     subscription.CustomerID,
+		SubscriptionID: subscription.ID,
+		FranchiseID:    subscription.FranchiseID,
+		Type:           req.Type,
+		Status:         database.ServiceStatusPending,
+		Description:    req.Description,
+		SLADueAt:       database.ServiceSLADeadline(req.Type, time.Now()),
+	}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&serviceRequest).Error; err != nil {
+			return err
+		}
+		return publishServiceRequestCreated(tx, serviceRequest, subscription.FranchiseID)
+	})
+	if err != nil {
+		log.Printf("Error creating service request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service request"})
+		return
+	}
+
+	recordAudit(c, nil, "service_request.create", "service_request", serviceRequest.ID, nil, serviceRequest)
+	c.JSON(http.StatusCreated, serviceRequest)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -8,25 +9,42 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/razorpay/razorpay-go"
+	rzperrors "github.com/razorpay/razorpay-go/errors"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
+	"aquahome/breaker"
 	"aquahome/config"
 	"aquahome/database"
+	"aquahome/events"
+	"aquahome/metrics"
+	"aquahome/risk"
+	"aquahome/tracing"
+	"aquahome/utils"
 )
 
 // RazorpayOrderRequest contains data for creating a Razorpay order
 type RazorpayOrderRequest struct {
-	ProductID       uint   `json:"product_id" binding:"required"`
-	FranchiseID     uint   `json:"franchise_id" binding:"required"`
-	ShippingAddress string `json:"shipping_address" binding:"required"`
-	BillingAddress  string `json:"billing_address" binding:"required"`
+	ProductID   uint `json:"product_id" binding:"required"`
+	FranchiseID uint `json:"franchise_id"` // assigned from the shipping address when omitted
+	// Address book entries; the customer's defaults are used when omitted
+	ShippingAddressID *uint `json:"shipping_address_id"`
+	BillingAddressID  *uint `json:"billing_address_id"`
+	// Deprecated: free-text addresses from older clients, used only without address IDs
+	ShippingAddress string `json:"shipping_address"`
+	BillingAddress  string `json:"billing_address"`
 	RentalDuration  int    `json:"rental_duration" binding:"required,min=1"`
+	VariantID       *uint  `json:"variant_id"`
+	PlanID          *uint  `json:"plan_id"`
+	CouponCode      string `json:"coupon_code"`
 	Notes           string `json:"notes"`
 }
 
@@ -71,12 +89,49 @@ func GeneratePaymentOrder(c *gin.Context) {
 
 	var request RazorpayOrderRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data: " + err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
+	if err := requireVerifiedEmail(database.DB.WithContext(c.Request.Context()), customerID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	override, err := orderRiskCheck(database.DB.WithContext(c.Request.Context()), customerID)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	addresses, err := resolveOrderAddresses(database.DB.WithContext(c.Request.Context()), customerID, request.ShippingAddressID, request.BillingAddressID,
+		request.ShippingAddress, request.BillingAddress)
+	if err != nil {
+		var addrErr *addressError
+		if errors.As(err, &addrErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": addrErr.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+		return
+	}
+
+	if request.FranchiseID == 0 {
+		franchise, err := addresses.franchise(database.DB.WithContext(c.Request.Context()), customerID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "We don't service your area yet"})
+				return
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign franchise"})
+			return
+		}
+		request.FranchiseID = franchise.ID
+	}
+
 	// Start a transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -96,11 +151,54 @@ func GeneratePaymentOrder(c *gin.Context) {
 		return
 	}
 
+	// Price from the selected plan, or the product's base prices without one
+	price, err := resolvePricing(tx, product, request.VariantID, request.PlanID, request.RentalDuration)
+	if err != nil {
+		tx.Rollback()
+		if isPricingError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product details"})
+		return
+	}
+
 	// Calculate total amount
-	totalAmount := product.SecurityDeposit + product.InstallationFee
-	if request.RentalDuration > 0 {
-		totalAmount += product.MonthlyRent * float64(request.RentalDuration)
+	totalAmount := price.initialAmount(request.RentalDuration)
+
+	var coupon database.Coupon
+	var discount float64
+	if request.CouponCode != "" {
+		coupon, discount, err = applyCoupon(tx, request.CouponCode, customerID, product.ID, request.FranchiseID, totalAmount)
+		if err != nil {
+			tx.Rollback()
+			var couponErr *couponError
+			if errors.As(err, &couponErr) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": couponErr.Error()})
+				return
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+			return
+		}
+		totalAmount -= discount
+	}
+
+	// GST is charged on the amount after discount
+	gst, err := loadGSTContext(tx, product.ID, request.FranchiseID, customerID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate tax"})
+		return
 	}
+	tax := gst.onTaxable(totalAmount)
+	totalAmount = tax.Total()
 
 	// Create order
 	order := database.Order{
@@ -109,14 +207,25 @@ func GeneratePaymentOrder(c *gin.Context) {
 		FranchiseID:        request.FranchiseID,
 		OrderType:          "rental",
 		Status:             database.OrderStatusPending,
-		ShippingAddress:    request.ShippingAddress,
-		BillingAddress:     request.BillingAddress,
+		ShippingAddress:    addresses.Shipping,
+		BillingAddress:     addresses.Billing,
+		ShippingAddressID:  addresses.ShippingID,
+		BillingAddressID:   addresses.BillingID,
 		RentalDuration:     request.RentalDuration,
-		SecurityDeposit:    product.SecurityDeposit,
-		InstallationFee:    product.InstallationFee,
+		VariantID:          price.VariantID,
+		PlanID:             price.PlanID,
+		PlanTerms:          price.Terms,
+		MonthlyRent:        price.MonthlyRent,
+		SecurityDeposit:    price.SecurityDeposit,
+		InstallationFee:    price.InstallationFee,
+		DiscountAmount:     discount,
 		TotalInitialAmount: totalAmount,
+		TaxBreakdown:       tax,
 		Notes:              request.Notes,
 	}
+	if coupon.ID != 0 {
+		order.CouponID = &coupon.ID
+	}
 
 	if err := tx.Create(&order).Error; err != nil {
 		tx.Rollback()
@@ -125,8 +234,47 @@ func GeneratePaymentOrder(c *gin.Context) {
 		return
 	}
 
+	if err := recordOrderStatus(tx, order.ID, "", order.Status, customerID, "Order placed"); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to record order status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+
+	if override != nil {
+		if err := risk.UseOverride(tx, override, order.ID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to use risk override %d: %v", override.ID, err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Orders cannot be placed from this account. Please contact support."})
+			return
+		}
+	}
+
+	if err := publishOrderPlaced(tx, order, product.Name); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to publish order event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+
+	if coupon.ID != 0 {
+		redemption := database.CouponRedemption{
+			CouponID:       coupon.ID,
+			CustomerID:     customerID,
+			OrderID:        order.ID,
+			DiscountAmount: discount,
+			Status:         database.RedemptionStatusApplied,
+		}
+		if err := tx.Create(&redemption).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Failed to record coupon redemption: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+			return
+		}
+	}
+
 	// Initialize Razorpay client
-	client := razorpay.NewClient(config.AppConfig.RazorpayKey, config.AppConfig.RazorpaySecret)
+	gateway := paymentGatewayFor(c)
 
 	// Get payment amount in paise (Razorpay uses smallest currency unit)
 	amountInPaise := int64(order.TotalInitialAmount * 100)
@@ -144,11 +292,13 @@ func GeneratePaymentOrder(c *gin.Context) {
 		},
 	}
 
-	razorpayOrder, err := client.Order.Create(data, nil)
+	razorpayOrder, err := callRazorpay(c, "order_create", func() (map[string]interface{}, error) {
+		return gateway.CreateOrder(data)
+	})
 	if err != nil {
 		tx.Rollback()
 		log.Printf("Error creating Razorpay order: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment order"})
+		respondRazorpayError(c, err, http.StatusInternalServerError, "Failed to create payment order")
 		return
 	}
 
@@ -162,6 +312,7 @@ func GeneratePaymentOrder(c *gin.Context) {
 		PaymentMethod:  "razorpay",
 		TransactionID:  razorpayOrder["id"].(string),
 		PaymentDetails: toJSONString(razorpayOrder),
+		TaxBreakdown:   tax,
 	}
 
 	if err := tx.Create(&payment).Error; err != nil {
@@ -183,6 +334,8 @@ func GeneratePaymentOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"razorpay_order_id": razorpayOrder["id"],
 		"amount":            order.TotalInitialAmount,
+		"discount":          order.DiscountAmount,
+		"tax":               order.TaxBreakdown,
 		"currency":          "INR",
 		"key":               config.AppConfig.RazorpayKey,
 		"aquahome_order_id": order.ID,
@@ -218,7 +371,7 @@ func VerifyPayment(c *gin.Context) {
 	var request PaymentVerificationRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		log.Printf("Invalid request data: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data: " + err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -234,25 +387,30 @@ func VerifyPayment(c *gin.Context) {
 
 	// Verify payment signature with enhanced logging
 	data := request.OrderID + "|" + request.PaymentID
-	h := hmac.New(sha256.New, []byte(config.AppConfig.RazorpaySecret))
-	h.Write([]byte(data))
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
+	expectedSignature := paymentSignature(request.OrderID, request.PaymentID)
 
 	log.Printf("Signature verification - Expected: %s, Provided: %s, Data: %s",
 		expectedSignature, request.Signature, data)
 
 	if expectedSignature != request.Signature {
+		metrics.RazorpayCalls.Inc("payment_verify", "failure")
 		log.Printf("Payment signature verification failed for customer %d", customerID)
+		if err := database.DB.WithContext(c.Request.Context()).Create(&database.PaymentVerificationFailure{
+			CustomerID: customerID, OrderID: request.OrderID, PaymentID: request.PaymentID,
+		}).Error; err != nil {
+			log.Printf("Failed to record payment verification failure: %v", err)
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid payment signature",
 			"success": false,
 		})
 		return
 	}
+	metrics.RazorpayCalls.Inc("payment_verify", "success")
 
 	// Additional validation: Check if payment ID is already processed
 	var existingPayment database.Payment
-	if err := database.DB.Where("transaction_id = ? AND status = ?",
+	if err := database.DB.WithContext(c.Request.Context()).Where("transaction_id = ? AND status = ?",
 		request.PaymentID, database.PaymentStatusSuccess).First(&existingPayment).Error; err == nil {
 		log.Printf("Payment ID %s already processed", request.PaymentID)
 		c.JSON(http.StatusConflict, gin.H{
@@ -263,7 +421,7 @@ func VerifyPayment(c *gin.Context) {
 	}
 
 	// Begin transaction with timeout
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction begin error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -295,7 +453,7 @@ func VerifyPayment(c *gin.Context) {
 		var subscription database.Subscription
 		subscriptionResult := tx.Where("id = ? AND customer_id = ?",
 			*request.SubscriptionID, customerID).
-			Select("customer_id, order_id, monthly_rent, status").
+			Select("id, customer_id, order_id, monthly_rent, status, next_billing_date, outstanding_late_fee").
 			First(&subscription)
 
 		if subscriptionResult.Error != nil {
@@ -317,8 +475,8 @@ func VerifyPayment(c *gin.Context) {
 			return
 		}
 
-		// Check if subscription is active
-		if subscription.Status != "active" {
+		// Suspended subscriptions can pay their overdue rent to be restored
+		if subscription.Status != database.SubscriptionStatusActive && subscription.Status != database.SubscriptionStatusSuspended {
 			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Subscription is not active",
@@ -329,8 +487,57 @@ func VerifyPayment(c *gin.Context) {
 
 		orderID = int64(subscription.OrderID)
 
-		// Rest of subscription payment logic...
-		// (keeping existing logic but with enhanced error handling)
+		var pendingPayment database.Payment
+		paymentResult := tx.Where("subscription_id = ? AND payment_type = ? AND status = ? AND transaction_id = ?",
+			subscription.ID, "monthly", database.PaymentStatusPending, request.OrderID).First(&pendingPayment)
+
+		if paymentResult.Error != nil {
+			tx.Rollback()
+			if errors.Is(paymentResult.Error, gorm.ErrRecordNotFound) {
+				log.Printf("No pending monthly payment found for subscription %d", subscription.ID)
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":   "No pending payment found for this subscription",
+					"success": false,
+				})
+				return
+			}
+			log.Printf("Database error fetching pending payment: %v", paymentResult.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Server error",
+				"success": false,
+			})
+			return
+		}
+
+		paymentDetails := fmt.Sprintf(`{"razorpay_order_id": "%s", "razorpay_payment_id": "%s", "verified_at": "%s"}`,
+			request.OrderID, request.PaymentID, time.Now().Format(time.RFC3339))
+
+		if err := tx.Model(&database.Payment{}).
+			Where("id = ?", pendingPayment.ID).
+			Updates(map[string]interface{}{
+				"status":          database.PaymentStatusSuccess,
+				"transaction_id":  request.PaymentID,
+				"payment_method":  "razorpay",
+				"payment_details": paymentDetails,
+			}).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error updating payment record: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Error updating payment record",
+				"success": false,
+			})
+			return
+		}
+
+		if err := applyMonthlyPayment(tx, subscription, pendingPayment); err != nil {
+			tx.Rollback()
+			log.Printf("Error updating subscription %d after payment: %v", subscription.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Error updating subscription",
+				"success": false,
+			})
+			return
+		}
 
 	} else {
 		// Handle initial order payment with enhanced validation
@@ -465,30 +672,53 @@ func VerifyPayment(c *gin.Context) {
 			})
 			return
 		}
+
+		if err := recordOrderStatus(tx, uint(orderID), database.OrderStatusPending, database.OrderStatusApproved,
+			customerID, "Initial payment received"); err != nil {
+			tx.Rollback()
+			log.Printf("Error recording order status: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Error updating order status",
+				"success": false,
+			})
+			return
+		}
+
+		if err := createRentalAgreement(tx, uint(orderID)); err != nil {
+			tx.Rollback()
+			log.Printf("Error generating rental agreement: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Error generating rental agreement",
+				"success": false,
+			})
+			return
+		}
 	}
 
-	// Create notification (existing code)
-	notificationTitle := "Payment Successful"
 	paymentTypeDisplay := map[string]string{
 		"initial": "Initial",
 		"monthly": "Monthly",
 	}[paymentType]
-
-	notificationMessage := fmt.Sprintf("%s payment has been processed successfully.", paymentTypeDisplay)
-	relatedID := uint(orderID)
-
-	notification := database.Notification{
-		UserID:      uint(customerID),
-		Title:       notificationTitle,
-		Message:     notificationMessage,
-		Type:        "payment",
-		RelatedID:   &relatedID,
-		RelatedType: "order",
+	paymentEvent := events.Event{
+		Name:       events.PaymentReceived,
+		EntityType: "order",
+		EntityID:   uint(orderID),
+		CustomerID: uint(customerID),
+		Vars:       database.Vars{"payment_type": paymentTypeDisplay},
 	}
-
-	if result := tx.Create(&notification); result.Error != nil {
-		// Don't fail the entire transaction for notification error, just log it
-		log.Printf("Warning: Failed to create notification: %v", result.Error)
+	var paid database.Payment
+	if err := tx.Where("transaction_id = ? AND status = ?", request.PaymentID, database.PaymentStatusSuccess).
+		First(&paid).Error; err == nil {
+		paymentEvent.Data = database.WebhookPaymentData(paid)
+	}
+	if err := events.Publish(tx, paymentEvent); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to publish payment event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Server error",
+			"success": false,
+		})
+		return
 	}
 
 	// Commit transaction
@@ -538,14 +768,14 @@ func GenerateMonthlyPayment(c *gin.Context) {
 
 	var request MonthlyPaymentRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Check if the subscription exists and belongs to the customer
 	var subscription database.Subscription
-	result := database.DB.Where("id = ? AND customer_id = ?", request.SubscriptionID, customerID).
-		Select("id, customer_id, monthly_rent, status, next_billing_date").
+	result := database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ?", request.SubscriptionID, customerID).
+		Select("id, customer_id, order_id, product_id, franchise_id, monthly_rent, status, next_billing_date, outstanding_late_fee").
 		First(&subscription)
 	err := result.Error
 
@@ -559,16 +789,32 @@ func GenerateMonthlyPayment(c *gin.Context) {
 		return
 	}
 
-	if subscription.Status != database.SubscriptionStatusActive {
+	if subscription.Status != database.SubscriptionStatusActive && subscription.Status != database.SubscriptionStatusSuspended {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Subscription is not active"})
 		return
 	}
 
+	gst, err := loadGSTContext(database.DB.WithContext(c.Request.Context()), subscription.ProductID, subscription.FranchiseID, customerID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate tax"})
+		return
+	}
+	// Late fees from dunning are collected with the rent, less any credit notes
+	due := subscription.MonthlyRent + subscription.OutstandingLateFee
+	credit, err := creditForBill(database.DB.WithContext(c.Request.Context()), subscription, due)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	tax := gst.onTaxable(due - credit)
+
 	// Initialize Razorpay client
-	client := razorpay.NewClient(config.AppConfig.RazorpayKey, config.AppConfig.RazorpaySecret)
+	gateway := paymentGatewayFor(c)
 
 	// Get payment amount in paise (Razorpay uses smallest currency unit)
-	amountInPaise := int64(subscription.MonthlyRent * 100)
+	amountInPaise := int64(math.Round(tax.Total() * 100))
 
 	// Create Razorpay order
 	data := map[string]interface{}{
@@ -582,10 +828,12 @@ func GenerateMonthlyPayment(c *gin.Context) {
 		},
 	}
 
-	razorpayOrder, err := client.Order.Create(data, nil)
+	razorpayOrder, err := callRazorpay(c, "order_create", func() (map[string]interface{}, error) {
+		return gateway.CreateOrder(data)
+	})
 	if err != nil {
 		log.Printf("Razorpay order creation error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating payment order"})
+		respondRazorpayError(c, err, http.StatusInternalServerError, "Error creating payment order")
 		return
 	}
 
@@ -594,7 +842,7 @@ func GenerateMonthlyPayment(c *gin.Context) {
 	subscriptionIDUint := subscription.ID
 	customerIDUint := uint(customerID)
 
-	result = database.DB.Where("subscription_id = ? AND payment_type = ? AND status = ?",
+	result = database.DB.WithContext(c.Request.Context()).Where("subscription_id = ? AND payment_type = ? AND status = ?",
 		subscriptionIDUint, "monthly", database.PaymentStatusPending).
 		First(&payment)
 
@@ -612,15 +860,17 @@ func GenerateMonthlyPayment(c *gin.Context) {
 		newPayment := database.Payment{
 			CustomerID:     customerIDUint,
 			SubscriptionID: &subscriptionIDUint,
-			Amount:         subscription.MonthlyRent,
+			Amount:         tax.Total(),
 			PaymentType:    "monthly",
 			Status:         database.PaymentStatusPending,
 			TransactionID:  razorpayOrder["id"].(string),
 			PaymentDetails: paymentDetails,
 			InvoiceNumber:  invoiceNumber,
+			TaxBreakdown:   tax,
+			CreditApplied:  credit,
 		}
 
-		result = database.DB.Create(&newPayment)
+		result = database.DB.WithContext(c.Request.Context()).Create(&newPayment)
 
 		if result.Error != nil {
 			log.Printf("Database error: %v", result.Error)
@@ -632,8 +882,11 @@ func GenerateMonthlyPayment(c *gin.Context) {
 
 		payment.TransactionID = razorpayOrder["id"].(string)
 		payment.PaymentDetails = paymentDetails
+		payment.Amount = tax.Total()
+		payment.TaxBreakdown = tax
+		payment.CreditApplied = credit
 
-		result = database.DB.Save(&payment)
+		result = database.DB.WithContext(c.Request.Context()).Save(&payment)
 
 		if result.Error != nil {
 			log.Printf("Database error: %v", result.Error)
@@ -644,14 +897,18 @@ func GenerateMonthlyPayment(c *gin.Context) {
 	// Return necessary information for the frontend
 	c.JSON(http.StatusOK, gin.H{
 		"razorpay_order_id": razorpayOrder["id"],
-		"amount":            subscription.MonthlyRent,
+		"amount":            tax.Total(),
+		"tax":               tax,
+		"late_fee":          subscription.OutstandingLateFee,
+		"credit_applied":    credit,
 		"currency":          "INR",
 		"key":               config.AppConfig.RazorpayKey,
 		"subscription_id":   subscription.ID,
 	})
 }
 
-// GetPaymentHistory gets payment history for a user
+// GetPaymentHistory gets payment history for a user. Passing ?cursor
+// (empty for the first page) switches to keyset pagination.
 func GetPaymentHistory(c *gin.Context) {
 	role, exists := c.Get("role")
 	if !exists {
@@ -701,50 +958,61 @@ func GetPaymentHistory(c *gin.Context) {
 		TransactionID  string        `json:"transaction_id"`
 		PaymentMethod  string        `json:"payment_method"`
 		InvoiceNumber  string        `json:"invoice_number"`
+		CreditApplied  float64       `json:"credit_applied"`
 		CreatedAt      time.Time     `json:"created_at"`
 		User           database.User `json:"-" gorm:"foreignKey:CustomerID"`
+		database.TaxBreakdown
 	}
 
-	var payments []PaymentHistoryItem
-	var result *gorm.DB
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Payment{}).
+		Select("payments.*, users.name as customer_name").
+		Joins("JOIN users ON payments.customer_id = users.id")
+	legacyLimit := 100
 
 	switch roleStr {
 	case "admin":
-		result = database.DB.Model(&database.Payment{}).
-			Select("payments.*, users.name as customer_name").
-			Joins("JOIN users ON payments.customer_id = users.id").
-			Order("payments.created_at DESC").
-			Limit(100).
-			Scan(&payments)
+		// Admins see every payment
 
 	case "franchise_owner":
-		result = database.DB.Model(&database.Payment{}).
-			Select("payments.*, users.name as customer_name").
-			Joins("JOIN users ON payments.customer_id = users.id").
+		franchiseIDs, ok := ownerFranchiseIDs(c)
+		if !ok {
+			return
+		}
+		query = query.
 			Joins("LEFT JOIN orders ON payments.order_id = orders.id").
 			Joins("LEFT JOIN subscriptions ON payments.subscription_id = subscriptions.id").
-			Where("orders.franchise_id IN (SELECT id FROM franchises WHERE owner_id = ?) OR "+
-				"subscriptions.franchise_id IN (SELECT id FROM franchises WHERE owner_id = ?)",
-				userIDUint, userIDUint).
-			Order("payments.created_at DESC").
-			Limit(100).
-			Scan(&payments)
+			Where("orders.franchise_id IN ? OR subscriptions.franchise_id IN ?", franchiseIDs, franchiseIDs)
 
 	case "customer":
-		result = database.DB.Model(&database.Payment{}).
-			Select("payments.*, users.name as customer_name").
-			Joins("JOIN users ON payments.customer_id = users.id").
-			Where("payments.customer_id = ?", userIDUint).
-			Order("payments.created_at DESC").
-			Scan(&payments)
+		query = query.Where("payments.customer_id = ?", userIDUint)
+		legacyLimit = -1
 
 	default:
 		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
 		return
 	}
 
-	if result.Error != nil {
-		log.Printf("Database error: %v", result.Error)
+	var payments []PaymentHistoryItem
+
+	if cursorRequested(c) {
+		page, limit, ok := keysetPage(c, query, "payments")
+		if !ok {
+			return
+		}
+		if err := page.Scan(&payments).Error; err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		payments, next := nextCursor(payments, limit, func(p PaymentHistoryItem) (time.Time, uint) {
+			return p.CreatedAt, p.ID
+		})
+		c.JSON(http.StatusOK, gin.H{"payments": payments, "next_cursor": next})
+		return
+	}
+
+	if err := query.Order("payments.created_at DESC").Limit(legacyLimit).Scan(&payments).Error; err != nil {
+		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
 		return
 	}
@@ -803,6 +1071,7 @@ func GetPaymentByID(c *gin.Context) {
 		CreatedAt      time.Time     `json:"created_at"`
 		UpdatedAt      time.Time     `json:"updated_at"`
 		User           database.User `json:"-" gorm:"foreignKey:CustomerID"`
+		database.TaxBreakdown
 	}
 
 	var paymentDetail PaymentDetail
@@ -811,14 +1080,14 @@ func GetPaymentByID(c *gin.Context) {
 	switch role {
 	case "admin":
 		// Admin can see any payment
-		query = database.DB.Model(&database.Payment{}).
+		query = database.DB.WithContext(c.Request.Context()).Model(&database.Payment{}).
 			Select("payments.*, users.name as customer_name, users.email as customer_email").
 			Joins("JOIN users ON payments.customer_id = users.id").
 			Where("payments.id = ?", paymentIDUint)
 
 	case "franchise_owner":
 		// Franchise owner can only see payments for orders/subscriptions in their franchise
-		query = database.DB.Model(&database.Payment{}).
+		query = database.DB.WithContext(c.Request.Context()).Model(&database.Payment{}).
 			Select("payments.*, users.name as customer_name, users.email as customer_email").
 			Joins("JOIN users ON payments.customer_id = users.id").
 			Joins("LEFT JOIN orders ON payments.order_id = orders.id").
@@ -829,7 +1098,7 @@ func GetPaymentByID(c *gin.Context) {
 
 	case "customer":
 		// Customer can only see their own payments
-		query = database.DB.Model(&database.Payment{}).
+		query = database.DB.WithContext(c.Request.Context()).Model(&database.Payment{}).
 			Select("payments.*, users.name as customer_name, users.email as customer_email").
 			Joins("JOIN users ON payments.customer_id = users.id").
 			Where("payments.id = ? AND payments.customer_id = ?", paymentIDUint, userIDUint)
@@ -865,6 +1134,76 @@ func generateMonthlyInvoiceNumber(subscriptionID uint) string {
 	return "INV-M-" + timestamp + "-" + strconv.FormatUint(uint64(subscriptionID), 10)
 }
 
+// applyMonthlyPayment advances a subscription's billing date after a month's
+// rent is paid. The late fee collected is whatever was charged on top of the
+// rent; fees added after the payment was raised stay outstanding. Credit
+// notes taken off the bill are used up, and a suspended subscription is
+// restored.
+func applyMonthlyPayment(tx *gorm.DB, subscription database.Subscription, payment database.Payment) error {
+	if err := useCreditNotes(tx, subscription, payment); err != nil {
+		return err
+	}
+	lateFeePaid := math.Max(payment.TaxableAmount+payment.CreditApplied-subscription.MonthlyRent, 0)
+	updates := map[string]interface{}{
+		"next_billing_date":    subscription.NextBillingDate.AddDate(0, 1, 0),
+		"outstanding_late_fee": math.Max(roundPaise(subscription.OutstandingLateFee-lateFeePaid), 0),
+	}
+	if subscription.Status == database.SubscriptionStatusSuspended {
+		updates["status"] = database.SubscriptionStatusActive
+		updates["suspended_at"] = nil
+	}
+	return tx.Model(&database.Subscription{}).Where("id = ?", subscription.ID).Updates(updates).Error
+}
+
+// fulfilPayment applies a payment that has just succeeded the way checkout
+// does: rent moves the subscription's billing on, an initial payment
+// approves the order. how says how it was paid, for the order's history.
+func fulfilPayment(tx *gorm.DB, payment database.Payment, how string) error {
+	var orderID, franchiseID uint
+	paymentType := "Monthly"
+	switch payment.PaymentType {
+	case "monthly":
+		var subscription database.Subscription
+		if err := tx.Select("id, order_id, franchise_id, monthly_rent, status, next_billing_date, outstanding_late_fee").
+			First(&subscription, *payment.SubscriptionID).Error; err != nil {
+			return err
+		}
+		if err := applyMonthlyPayment(tx, subscription, payment); err != nil {
+			return err
+		}
+		orderID, franchiseID = subscription.OrderID, subscription.FranchiseID
+	case "initial":
+		paymentType = "Initial"
+		var order database.Order
+		if err := tx.Select("id, status, franchise_id").First(&order, *payment.OrderID).Error; err != nil {
+			return err
+		}
+		orderID, franchiseID = order.ID, order.FranchiseID
+		if order.Status == database.OrderStatusPending {
+			if err := tx.Model(&order).Update("status", database.OrderStatusApproved).Error; err != nil {
+				return err
+			}
+			if err := recordOrderStatus(tx, order.ID, database.OrderStatusPending, database.OrderStatusApproved,
+				payment.CustomerID, "Initial payment received by "+how); err != nil {
+				return err
+			}
+			if err := createRentalAgreement(tx, order.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return events.Publish(tx, events.Event{
+		Name:        events.PaymentReceived,
+		EntityType:  "order",
+		EntityID:    orderID,
+		CustomerID:  payment.CustomerID,
+		FranchiseID: franchiseID,
+		Vars:        database.Vars{"payment_type": paymentType},
+		Data:        database.WebhookPaymentData(payment),
+	})
+}
+
 // toJSONString converts an interface to a JSON string
 func toJSONString(v interface{}) string {
 	data, err := json.Marshal(v)
@@ -876,6 +1215,123 @@ func toJSONString(v interface{}) string {
 }
 
 // verifyRazorpaySignature verifies the signature from Razorpay
+// callRazorpay runs a Razorpay API call in a client span and counts its
+// outcome. Calls go through the Razorpay circuit breaker, and ones that fail
+// because of the gateway are retried with backoff when that is safe. Errors
+// of a degraded gateway wrap errRazorpayUnavailable.
+func callRazorpay(c *gin.Context, operation string, call func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	ctx := c.Request.Context()
+	_, span := tracing.StartClientSpan(ctx, "razorpay."+operation)
+	var result map[string]interface{}
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = razorpayCircuit().Execute(func() error {
+			var callErr error
+			result, callErr = call()
+			return callErr
+		}, razorpayFailed)
+		if err == nil || ctx.Err() != nil || attempt >= config.AppConfig.RazorpayMaxRetries || !retryRazorpay(operation, err) {
+			break
+		}
+		select {
+		case <-time.After(razorpayRetryBackoff << attempt):
+			continue
+		case <-ctx.Done():
+		}
+		break
+	}
+	tracing.EndSpan(span, err)
+	metrics.ObserveRazorpay(operation, err)
+	if errors.Is(err, breaker.ErrOpen) || (err != nil && razorpayFailed(err)) {
+		err = fmt.Errorf("%w: %w", errRazorpayUnavailable, err)
+	}
+	return result, err
+}
+
+// errRazorpayUnavailable marks Razorpay calls that failed because the gateway
+// is down, slow or refused by the breaker; clients should try again later
+var errRazorpayUnavailable = errors.New("razorpay is unavailable")
+
+// razorpayRetryBackoff is the wait before the first retry, doubling after it
+const razorpayRetryBackoff = 250 * time.Millisecond
+
+// razorpayRetrySafe are the operations that may reach Razorpay twice without
+// harm: a second order is simply never paid. Refunds, payouts and the like
+// are retried only when the failed attempt never reached Razorpay, as
+// sending them twice could move money twice.
+var razorpayRetrySafe = map[string]bool{
+	"order_create":            true,
+	"plan_create":             true,
+	"subscription_cancel":     true,
+	"payment_link_cancel":     true,
+	"fund_account_deactivate": true,
+}
+
+var (
+	razorpayBreakerOnce sync.Once
+	razorpayBreaker     *breaker.Breaker
+)
+
+// razorpayCircuit returns the breaker shared by all Razorpay calls
+func razorpayCircuit() *breaker.Breaker {
+	razorpayBreakerOnce.Do(func() {
+		razorpayBreaker = breaker.New("razorpay", config.AppConfig.RazorpayBreakerFailures,
+			time.Duration(config.AppConfig.RazorpayBreakerOpenSeconds)*time.Second)
+	})
+	return razorpayBreaker
+}
+
+// razorpayFailed reports whether err is Razorpay failing rather than it
+// rejecting the request, or the client giving up
+func razorpayFailed(err error) bool {
+	var badRequest *rzperrors.BadRequestError
+	var xErr *utils.RazorpayXError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, utils.ErrPayoutsDisabled):
+		return false
+	case errors.As(err, &badRequest):
+		// Responses without Razorpay's error body, such as a proxy's 502
+		// page, come back as bad requests without a description
+		return badRequest.Message == ""
+	case errors.As(err, &xErr):
+		return xErr.Status >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// retryRazorpay reports whether a failed call should be made again
+func retryRazorpay(operation string, err error) bool {
+	if errors.Is(err, breaker.ErrOpen) || !razorpayFailed(err) {
+		return false
+	}
+	if razorpayRetrySafe[operation] {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// respondRazorpayError answers a failed Razorpay call with status and
+// message, or with 503 when the gateway is degraded so clients retry later
+func respondRazorpayError(c *gin.Context, err error, status int, message string) {
+	if errors.Is(err, errRazorpayUnavailable) {
+		respondGatewayUnavailable(c, err)
+		return
+	}
+	if status >= http.StatusInternalServerError {
+		_ = c.Error(err)
+	}
+	c.JSON(status, gin.H{"error": message})
+}
+
+// respondGatewayUnavailable tells the client the payment gateway is degraded
+// and when to try again
+func respondGatewayUnavailable(c *gin.Context, err error) {
+	c.Header("Retry-After", strconv.Itoa(config.AppConfig.RazorpayBreakerOpenSeconds))
+	apperror.Respond(c, apperror.New(http.StatusServiceUnavailable, "payment_gateway_unavailable",
+		"The payment gateway is not responding, please try again shortly").Wrap(err))
+}
+
 func verifyRazorpaySignature(data, signature, secret string) bool {
 	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write([]byte(data))
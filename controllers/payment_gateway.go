@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/razorpay/razorpay-go"
+	"github.com/razorpay/razorpay-go/requests"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// paymentGateway is the part of Razorpay's API the handlers use. Results are
+// Razorpay's entities as maps, whichever gateway produced them.
+type paymentGateway interface {
+	CreateOrder(data map[string]interface{}) (map[string]interface{}, error)
+	Refund(paymentID string, amount int, receipt string, data map[string]interface{}) (map[string]interface{}, error)
+	CreatePlan(data map[string]interface{}) (map[string]interface{}, error)
+	CreateSubscription(data map[string]interface{}) (map[string]interface{}, error)
+	CancelSubscription(subscriptionID string, data map[string]interface{}) (map[string]interface{}, error)
+	CreatePaymentLink(data map[string]interface{}) (map[string]interface{}, error)
+	CancelPaymentLink(linkID string) (map[string]interface{}, error)
+	UploadDocument(file *os.File, purpose string) (map[string]interface{}, error)
+	ContestDispute(disputeID string, data map[string]interface{}) (map[string]interface{}, error)
+	AcceptDispute(disputeID string) (map[string]interface{}, error)
+}
+
+// paymentGatewayFor returns the gateway PAYMENT_PROVIDER selects, with calls
+// abandoned when the request is cancelled or times out
+func paymentGatewayFor(c *gin.Context) paymentGateway {
+	if config.AppConfig.PaymentProvider == config.PaymentProviderMock {
+		return mockGateway{}
+	}
+	return razorpayGateway{razorpayClient(c)}
+}
+
+// razorpayClient returns a Razorpay client whose API calls are abandoned
+// when the request is cancelled or times out
+func razorpayClient(c *gin.Context) *razorpay.Client {
+	client := razorpay.NewClient(config.AppConfig.RazorpayKey, config.AppConfig.RazorpaySecret)
+	// The client's resources all send through the one request setup
+	client.Order.Request.HTTPClient = &http.Client{
+		Timeout:   time.Duration(config.AppConfig.RazorpayTimeoutSeconds) * time.Second,
+		Transport: contextTransport{ctx: c.Request.Context()},
+	}
+	return client
+}
+
+// contextTransport binds requests to ctx, for clients that build their
+// requests without one
+type contextTransport struct {
+	ctx context.Context
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(req.WithContext(t.ctx))
+}
+
+// razorpayGateway calls Razorpay's API
+type razorpayGateway struct {
+	client *razorpay.Client
+}
+
+func (g razorpayGateway) CreateOrder(data map[string]interface{}) (map[string]interface{}, error) {
+	return g.client.Order.Create(data, nil)
+}
+
+// Refund sends receipt with the refund and as its idempotency key, so a
+// retried request can't refund twice
+func (g razorpayGateway) Refund(paymentID string, amount int, receipt string, data map[string]interface{}) (map[string]interface{}, error) {
+	data["receipt"] = receipt
+	return g.client.Payment.Refund(paymentID, amount, data, map[string]string{"X-Refund-Idempotency": receipt})
+}
+
+func (g razorpayGateway) CreatePlan(data map[string]interface{}) (map[string]interface{}, error) {
+	return g.client.Plan.Create(data, nil)
+}
+
+func (g razorpayGateway) CreateSubscription(data map[string]interface{}) (map[string]interface{}, error) {
+	return g.client.Subscription.Create(data, nil)
+}
+
+func (g razorpayGateway) CancelSubscription(subscriptionID string, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.client.Subscription.Cancel(subscriptionID, data, nil)
+}
+
+func (g razorpayGateway) CreatePaymentLink(data map[string]interface{}) (map[string]interface{}, error) {
+	return g.client.PaymentLink.Create(data, nil)
+}
+
+func (g razorpayGateway) CancelPaymentLink(linkID string) (map[string]interface{}, error) {
+	return g.client.PaymentLink.Cancel(linkID, nil, nil)
+}
+
+func (g razorpayGateway) UploadDocument(file *os.File, purpose string) (map[string]interface{}, error) {
+	return g.client.Document.Create(requests.FileUploadParams{
+		File:   file,
+		Fields: map[string]string{"purpose": purpose},
+	}, nil)
+}
+
+func (g razorpayGateway) ContestDispute(disputeID string, data map[string]interface{}) (map[string]interface{}, error) {
+	return g.client.Dispute.Contest(disputeID, data, nil)
+}
+
+func (g razorpayGateway) AcceptDispute(disputeID string) (map[string]interface{}, error) {
+	return g.client.Dispute.Accept(disputeID, nil, nil)
+}
+
+// mockGateway answers like Razorpay without calling it, for development and
+// end-to-end tests. Orders are paid through MockCheckout.
+type mockGateway struct{}
+
+// mockID returns a fake Razorpay ID such as order_mock_3f9a...
+func mockID(prefix string) string {
+	token, _ := utils.GenerateSecureToken(7)
+	return prefix + "_mock_" + token
+}
+
+func (mockGateway) CreateOrder(data map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"id":         mockID("order"),
+		"entity":     "order",
+		"amount":     data["amount"],
+		"currency":   data["currency"],
+		"receipt":    data["receipt"],
+		"notes":      data["notes"],
+		"status":     "created",
+		"created_at": time.Now().Unix(),
+	}, nil
+}
+
+func (mockGateway) Refund(paymentID string, amount int, receipt string, data map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"id":         mockID("rfnd"),
+		"entity":     "refund",
+		"payment_id": paymentID,
+		"amount":     amount,
+		"receipt":    receipt,
+		"notes":      data["notes"],
+		"status":     "processed",
+	}, nil
+}
+
+func (mockGateway) CreatePlan(data map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": mockID("plan"), "entity": "plan", "period": data["period"], "item": data["item"]}, nil
+}
+
+func (mockGateway) CreateSubscription(data map[string]interface{}) (map[string]interface{}, error) {
+	id := mockID("sub")
+	return map[string]interface{}{
+		"id":        id,
+		"entity":    "subscription",
+		"plan_id":   data["plan_id"],
+		"status":    "created",
+		"short_url": config.AppConfig.AppBaseURL + "/mock-checkout/" + id,
+	}, nil
+}
+
+func (mockGateway) CancelSubscription(subscriptionID string, _ map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": subscriptionID, "entity": "subscription", "status": "cancelled"}, nil
+}
+
+func (mockGateway) CreatePaymentLink(data map[string]interface{}) (map[string]interface{}, error) {
+	id := mockID("plink")
+	return map[string]interface{}{
+		"id":        id,
+		"amount":    data["amount"],
+		"status":    "created",
+		"short_url": config.AppConfig.AppBaseURL + "/mock-checkout/" + id,
+	}, nil
+}
+
+func (mockGateway) CancelPaymentLink(linkID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": linkID, "status": "cancelled"}, nil
+}
+
+func (mockGateway) UploadDocument(_ *os.File, purpose string) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": mockID("doc"), "entity": "document", "purpose": purpose}, nil
+}
+
+func (mockGateway) ContestDispute(disputeID string, _ map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": disputeID, "entity": "dispute", "status": "under_review"}, nil
+}
+
+func (mockGateway) AcceptDispute(disputeID string) (map[string]interface{}, error) {
+	return map[string]interface{}{"id": disputeID, "entity": "dispute", "status": "lost"}, nil
+}
+
+// paymentSignature is the signature Razorpay's checkout returns for a paid
+// order, which VerifyPayment checks
+func paymentSignature(orderID, paymentID string) string {
+	h := hmac.New(sha256.New, []byte(config.AppConfig.RazorpaySecret))
+	h.Write([]byte(orderID + "|" + paymentID))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MockCheckoutRequest names the gateway order to pay
+type MockCheckoutRequest struct {
+	OrderID string `json:"order_id" binding:"required"`
+}
+
+// MockCheckout stands in for Razorpay's checkout when PAYMENT_PROVIDER=mock:
+// it pays a gateway order and returns the fields to send to the verify
+// endpoint. It doesn't exist with a real gateway.
+// POST /api/payments/mock-checkout
+func MockCheckout(c *gin.Context) {
+	if config.AppConfig.PaymentProvider != config.PaymentProviderMock {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	var req MockCheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var payment database.Payment
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("transaction_id = ? AND customer_id = ?", req.OrderID, c.GetUint("user_id")).
+		First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment order not found"})
+		return
+	}
+
+	paymentID := mockID("pay")
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":   req.OrderID,
+		"payment_id": paymentID,
+		"signature":  paymentSignature(req.OrderID, paymentID),
+	})
+}
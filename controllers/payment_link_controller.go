@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// PaymentLinkRequest sets how long a payment link stays payable
+type PaymentLinkRequest struct {
+	ExpireInHours int `json:"expire_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+const defaultPaymentLinkHours = 72
+
+// CreatePaymentLink creates a Razorpay Payment Link for a pending payment,
+// an unpaid order or a month's rent, and sends it to the customer by SMS and
+// email. An earlier link for the payment that is still open is cancelled so
+// only one can be paid.
+// POST /api/admin/payments/:id/payment-link
+func CreatePaymentLink(c *gin.Context) {
+	var req PaymentLinkRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apperror.Respond(c, apperror.Binding(err))
+			return
+		}
+	}
+	if req.ExpireInHours == 0 {
+		req.ExpireInHours = defaultPaymentLinkHours
+	}
+
+	var payment database.Payment
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Customer").First(&payment, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Payment not found"))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if payment.Status != database.PaymentStatusPending {
+		apperror.Respond(c, apperror.Conflict("Only pending payments can be paid by link"))
+		return
+	}
+
+	purpose := "your monthly rent"
+	switch payment.PaymentType {
+	case "initial":
+		if payment.OrderID == nil {
+			apperror.Respond(c, apperror.BadRequest("Payment has no order"))
+			return
+		}
+		var order database.Order
+		if err := database.DB.WithContext(c.Request.Context()).Select("id, status").First(&order, *payment.OrderID).Error; err != nil {
+			apperror.Respond(c, apperror.Internal(err))
+			return
+		}
+		if order.Status != database.OrderStatusPending {
+			apperror.Respond(c, apperror.Conflict("Order is no longer awaiting payment"))
+			return
+		}
+		purpose = fmt.Sprintf("order #%d", order.ID)
+	case "monthly":
+		if payment.SubscriptionID == nil {
+			apperror.Respond(c, apperror.BadRequest("Payment has no subscription"))
+			return
+		}
+	default:
+		apperror.Respond(c, apperror.BadRequest("Payment links are only for order and rent payments"))
+		return
+	}
+
+	link, err := sendPaymentLink(c, payment, purpose, req.ExpireInHours)
+	if err != nil {
+		var appErr *apperror.Error
+		if errors.As(err, &appErr) {
+			apperror.Respond(c, err)
+			return
+		}
+		log.Printf("Razorpay payment link creation error: %v", err)
+		respondRazorpayError(c, err, http.StatusInternalServerError, "Error creating payment link")
+		return
+	}
+
+	recordAudit(c, nil, "payment.link_created", "payment", payment.ID, nil, link)
+	c.JSON(http.StatusCreated, link)
+}
+
+// sendPaymentLink creates a payment link for a pending payment, whose
+// Customer must be loaded, and sends it to the customer by SMS and email.
+// Open links for the payment are cancelled first. Failures to reach the
+// gateway are returned as they are; others are *apperror.Error.
+func sendPaymentLink(c *gin.Context, payment database.Payment, purpose string, expireInHours int) (database.PaymentLink, error) {
+	gateway := paymentGatewayFor(c)
+
+	var open []database.PaymentLink
+	if err := database.DB.WithContext(c.Request.Context()).Where("payment_id = ? AND status IN ?", payment.ID,
+		[]string{database.PaymentLinkStatusCreated, database.PaymentLinkStatusPartiallyPaid}).
+		Find(&open).Error; err != nil {
+		return database.PaymentLink{}, apperror.Internal(err)
+	}
+	for _, link := range open {
+		if _, err := callRazorpay(c, "payment_link_cancel", func() (map[string]interface{}, error) {
+			return gateway.CancelPaymentLink(link.RazorpayLinkID)
+		}); err != nil {
+			// It may have expired or been paid meanwhile; the webhook settles it
+			log.Printf("Error cancelling payment link %s: %v", link.RazorpayLinkID, err)
+			continue
+		}
+		database.DB.WithContext(c.Request.Context()).Model(&link).Update("status", database.PaymentLinkStatusCancelled)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(expireInHours) * time.Hour)
+	customer := map[string]interface{}{"name": payment.Customer.Name}
+	if payment.Customer.Email != "" {
+		customer["email"] = payment.Customer.Email
+	}
+	if payment.Customer.Phone != "" {
+		customer["contact"] = payment.Customer.Phone
+	}
+	data := map[string]interface{}{
+		"amount":          int64(math.Round(payment.Amount * 100)),
+		"currency":        "INR",
+		"accept_partial":  false,
+		"expire_by":       expiresAt.Unix(),
+		"reference_id":    fmt.Sprintf("payment_%d_%d", payment.ID, time.Now().Unix()),
+		"description":     "AquaHome payment for " + purpose,
+		"customer":        customer,
+		"notify":          map[string]interface{}{"sms": false, "email": false}, // we send it ourselves
+		"reminder_enable": true,
+		"notes": map[string]interface{}{
+			"payment_id":   payment.ID,
+			"customer_id":  payment.CustomerID,
+			"payment_type": payment.PaymentType,
+		},
+	}
+	rzpLink, err := callRazorpay(c, "payment_link_create", func() (map[string]interface{}, error) {
+		return gateway.CreatePaymentLink(data)
+	})
+	if err != nil {
+		return database.PaymentLink{}, err
+	}
+
+	link := database.PaymentLink{
+		PaymentID:      payment.ID,
+		CustomerID:     payment.CustomerID,
+		RazorpayLinkID: mapString(rzpLink, "id"),
+		ShortURL:       mapString(rzpLink, "short_url"),
+		Amount:         payment.Amount,
+		Status:         database.PaymentLinkStatusCreated,
+		ExpiresAt:      &expiresAt,
+		CreatedByID:    c.GetUint("user_id"),
+	}
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+		return events.Publish(tx, events.Event{
+			Name:       events.PaymentLinkSent,
+			EntityType: "payment",
+			EntityID:   payment.ID,
+			CustomerID: payment.CustomerID,
+			Vars: database.Vars{
+				"amount":  fmt.Sprintf("%.2f", payment.Amount),
+				"purpose": purpose,
+				"url":     link.ShortURL,
+				"expires": expiresAt.Format("02 Jan 2006 15:04"),
+			},
+		})
+	})
+	if err != nil {
+		return link, apperror.Internal(err).WithMessage("Failed to save payment link")
+	}
+	return link, nil
+}
+
+// GetPaymentLinks lists the links created for a payment, newest first
+// GET /api/admin/payments/:id/payment-links
+func GetPaymentLinks(c *gin.Context) {
+	var links []database.PaymentLink
+	if err := database.DB.WithContext(c.Request.Context()).Where("payment_id = ?", c.Param("id")).
+		Order("created_at DESC").Find(&links).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment links"})
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// handlePaymentLinkEvent tracks a link's status and, once it is paid,
+// completes the payment it was created for
+func handlePaymentLinkEvent(event RazorpayWebhookEvent) error {
+	rzpLink := event.entity("payment_link")
+	linkID := mapString(rzpLink, "id")
+	status := mapString(rzpLink, "status")
+	if linkID == "" || status == "" {
+		return fmt.Errorf("%s event missing payment link id or status", event.Event)
+	}
+
+	var link database.PaymentLink
+	if err := database.DB.Where("razorpay_link_id = ?", linkID).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ignoring event for unknown payment link %s", linkID)
+			return nil
+		}
+		return err
+	}
+	// Razorpay retries webhooks; a paid link is final
+	if link.Status == database.PaymentLinkStatusPaid {
+		return nil
+	}
+	if status != database.PaymentLinkStatusPaid {
+		return database.DB.Model(&link).Update("status", status).Error
+	}
+
+	rzpPayment := event.entity("payment")
+	rzpPaymentID := mapString(rzpPayment, "id")
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&link).Updates(map[string]interface{}{
+			"status":              database.PaymentLinkStatusPaid,
+			"razorpay_payment_id": rzpPaymentID,
+			"paid_at":             now,
+		}).Error; err != nil {
+			return err
+		}
+		return completeLinkPayment(tx, link, rzpPaymentID, rzpPayment)
+	})
+}
+
+// completeLinkPayment marks the link's payment successful and fulfils it
+func completeLinkPayment(tx *gorm.DB, link database.PaymentLink, rzpPaymentID string, rzpPayment map[string]interface{}) error {
+	var payment database.Payment
+	if err := tx.First(&payment, link.PaymentID).Error; err != nil {
+		return err
+	}
+	if payment.Status != database.PaymentStatusPending {
+		// Paid some other way meanwhile; the money is refunded by hand
+		log.Printf("Payment link %s paid for payment %d that is already %s", link.RazorpayLinkID, payment.ID, payment.Status)
+		return nil
+	}
+
+	paymentDetails := toJSONString(map[string]interface{}{
+		"razorpay_payment_link_id": link.RazorpayLinkID,
+		"razorpay_payment_id":      rzpPaymentID,
+		"method":                   mapString(rzpPayment, "method"),
+		"verified_at":              time.Now().Format(time.RFC3339),
+	})
+	if err := tx.Model(&payment).Updates(map[string]interface{}{
+		"status":          database.PaymentStatusSuccess,
+		"transaction_id":  rzpPaymentID,
+		"payment_method":  "razorpay_link",
+		"payment_details": paymentDetails,
+	}).Error; err != nil {
+		return err
+	}
+
+	return fulfilPayment(tx, payment, "payment link")
+}
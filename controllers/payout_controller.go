@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/jobs"
+	"aquahome/ledger"
+	"aquahome/utils"
+)
+
+// BankAccountRequest adds a payout destination: a bank account (number and
+// IFSC) or a UPI address
+type BankAccountRequest struct {
+	AccountType       string `json:"account_type" binding:"required,oneof=bank_account vpa"`
+	AccountHolderName string `json:"account_holder_name" binding:"required"`
+	AccountNumber     string `json:"account_number" binding:"omitempty,numeric,min=6,max=20"`
+	IFSC              string `json:"ifsc"`
+	VPA               string `json:"vpa"`
+}
+
+var (
+	ifscPattern = regexp.MustCompile(`^[A-Z]{4}0[A-Z0-9]{6}$`)
+	vpaPattern  = regexp.MustCompile(`^[a-zA-Z0-9.\-_]{2,256}@[a-zA-Z]{2,64}$`)
+)
+
+// respondRazorpayXError reports a failed RazorpayX call to the client
+func respondRazorpayXError(c *gin.Context, err error, message string) {
+	var apiErr *utils.RazorpayXError
+	switch {
+	case errors.Is(err, utils.ErrPayoutsDisabled):
+		apperror.Respond(c, apperror.New(http.StatusServiceUnavailable, "payouts_disabled", "Payouts are not configured"))
+	case errors.Is(err, errRazorpayUnavailable):
+		respondGatewayUnavailable(c, err)
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusBadRequest:
+		apperror.Respond(c, apperror.New(http.StatusUnprocessableEntity, "payout_rejected", apiErr.Description))
+	default:
+		apperror.Respond(c, apperror.New(http.StatusBadGateway, apperror.CodeBadGateway, message).Wrap(err))
+	}
+}
+
+// ensureRazorpayContact returns the franchise's RazorpayX contact, creating it
+// on first use
+func ensureRazorpayContact(c *gin.Context, franchise *database.Franchise) (string, error) {
+	if franchise.RazorpayContactID != "" {
+		return franchise.RazorpayContactID, nil
+	}
+
+	contact, err := callRazorpay(c, "contact_create", func() (map[string]interface{}, error) {
+		return utils.RazorpayX("POST", "/contacts", map[string]interface{}{
+			"name":         franchise.Name,
+			"email":        franchise.Email,
+			"contact":      franchise.Phone,
+			"type":         "vendor",
+			"reference_id": fmt.Sprintf("franchise_%d", franchise.ID),
+		}, "")
+	})
+	if err != nil {
+		return "", err
+	}
+
+	franchise.RazorpayContactID = mapString(contact, "id")
+	if err := database.DB.WithContext(c.Request.Context()).Model(franchise).Update("razorpay_contact_id", franchise.RazorpayContactID).Error; err != nil {
+		return "", err
+	}
+	return franchise.RazorpayContactID, nil
+}
+
+// GetBankAccounts lists a franchise's payout accounts
+func GetBankAccounts(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	var accounts []database.FranchiseBankAccount
+	if err := database.DB.WithContext(c.Request.Context()).Where("franchise_id = ?", franchise.ID).
+		Order("is_active DESC, id DESC").Find(&accounts).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bank accounts"})
+		return
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+// AddBankAccount registers a RazorpayX fund account for the franchise and
+// makes it the account future payouts go to
+func AddBankAccount(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req BankAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	account := database.FranchiseBankAccount{
+		FranchiseID:       franchise.ID,
+		AccountType:       req.AccountType,
+		AccountHolderName: req.AccountHolderName,
+		IsActive:          true,
+	}
+	fundAccount := map[string]interface{}{"account_type": req.AccountType}
+	switch req.AccountType {
+	case database.BankAccountTypeBank:
+		if req.AccountNumber == "" || !ifscPattern.MatchString(req.IFSC) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A bank account needs account_number and a valid IFSC"})
+			return
+		}
+		fundAccount["bank_account"] = map[string]string{
+			"name":           req.AccountHolderName,
+			"ifsc":           req.IFSC,
+			"account_number": req.AccountNumber,
+		}
+		account.AccountNumberLast4 = req.AccountNumber[len(req.AccountNumber)-4:]
+		account.IFSC = req.IFSC
+	case database.BankAccountTypeVPA:
+		if !vpaPattern.MatchString(req.VPA) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A valid UPI address is required"})
+			return
+		}
+		fundAccount["vpa"] = map[string]string{"address": req.VPA}
+		account.VPA = req.VPA
+	}
+
+	contactID, err := ensureRazorpayContact(c, &franchise)
+	if err != nil {
+		respondRazorpayXError(c, err, "Could not register the bank account, please try again")
+		return
+	}
+	fundAccount["contact_id"] = contactID
+
+	created, err := callRazorpay(c, "fund_account_create", func() (map[string]interface{}, error) {
+		return utils.RazorpayX("POST", "/fund_accounts", fundAccount, "")
+	})
+	if err != nil {
+		respondRazorpayXError(c, err, "Could not register the bank account, please try again")
+		return
+	}
+	account.RazorpayFundAccountID = mapString(created, "id")
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.FranchiseBankAccount{}).
+			Where("franchise_id = ? AND is_active = ?", franchise.ID, true).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&account).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save bank account"})
+		return
+	}
+
+	recordAudit(c, nil, "franchise.bank_account_add", "franchise", franchise.ID, nil, account)
+	c.JSON(http.StatusCreated, account)
+}
+
+// DeleteBankAccount deactivates a payout account in RazorpayX and removes it
+func DeleteBankAccount(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	var account database.FranchiseBankAccount
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND franchise_id = ?", c.Param("id"), franchise.ID).
+		First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bank account not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if _, err := callRazorpay(c, "fund_account_deactivate", func() (map[string]interface{}, error) {
+		return utils.RazorpayX("PATCH", "/fund_accounts/"+account.RazorpayFundAccountID, map[string]bool{"active": false}, "")
+	}); err != nil {
+		respondRazorpayXError(c, err, "Could not remove the bank account, please try again")
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&account).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bank account"})
+		return
+	}
+	recordAudit(c, nil, "franchise.bank_account_delete", "franchise", franchise.ID, account, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Bank account removed"})
+}
+
+// ApproveSettlement locks a pending statement so it can be paid out (Admin only)
+func ApproveSettlement(c *gin.Context) {
+	settlement, ok := settlementForRequest(c)
+	if !ok {
+		return
+	}
+
+	before := settlement
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Settlement{}).
+			Where("id = ? AND status = ?", settlement.ID, database.SettlementStatusPending).
+			Update("status", database.SettlementStatusApproved)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.Conflict("Only pending settlements can be approved")
+		}
+		settlement.Status = database.SettlementStatusApproved
+		return ledger.PostSettlementApproved(tx, settlement)
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	recordAudit(c, nil, "settlement.approve", "settlement", settlement.ID, before, settlement)
+	c.JSON(http.StatusOK, settlement)
+}
+
+// PayoutSettlement disburses an approved or failed settlement to the
+// franchise's bank account through RazorpayX (Admin only)
+func PayoutSettlement(c *gin.Context) {
+	settlement, ok := settlementForRequest(c)
+	if !ok {
+		return
+	}
+
+	before := settlement
+	updated, err := jobs.DisburseSettlement(settlement.ID)
+	switch {
+	case errors.Is(err, jobs.ErrSettlementNotPayable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, jobs.ErrNoBankAccount):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The franchise has not added a bank account for payouts"})
+		return
+	case err != nil:
+		recordAudit(c, nil, "settlement.payout", "settlement", settlement.ID, before, updated)
+		respondRazorpayXError(c, err, "Payout could not be initiated, it will be retried")
+		return
+	}
+
+	recordAudit(c, nil, "settlement.payout", "settlement", settlement.ID, before, updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+// handlePayoutEvent applies a RazorpayX payout webhook to its settlement
+func handlePayoutEvent(event RazorpayWebhookEvent) error {
+	return jobs.ApplyPayoutWebhook(event.entity("payout"))
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/utils"
+)
+
+// Photos agents take on visits are stored as one JPEG rendition
+const (
+	uploadsURLPrefix   = "/uploads"
+	fieldPhotoMaxWidth = 1600
+	maxFieldPhotoBytes = 10 << 20
+)
+
+// multipartOverhead allows for the form fields and part headers around the
+// files of a multipart upload
+const multipartOverhead = 1 << 20
+
+// uploadsDir is where uploads are stored, served by main.go under /uploads
+func uploadsDir() string {
+	return config.AppConfig.UploadDir
+}
+
+// fieldPhoto is an uploaded photo saved under ./uploads
+type fieldPhoto struct {
+	URL          string
+	OriginalName string
+	SizeBytes    int64
+}
+
+// uploadedFilePath is where the upload served at url is stored
+func uploadedFilePath(url string) string {
+	return filepath.Join(uploadsDir(), filepath.FromSlash(strings.TrimPrefix(url, uploadsURLPrefix+"/")))
+}
+
+// removeUploadedFiles deletes files saved under ./uploads, given their URLs
+func removeUploadedFiles(urls ...string) {
+	for _, url := range urls {
+		file := uploadedFilePath(url)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove upload %s: %v", url, err)
+		}
+	}
+}
+
+// removeFieldPhotos deletes saved photos from disk
+func removeFieldPhotos(photos []fieldPhoto) {
+	for _, photo := range photos {
+		removeUploadedFiles(photo.URL)
+	}
+}
+
+// multipartForm parses a multipart upload whose body may be at most maxBytes.
+// On a bad or oversized upload it writes the error response and returns false.
+func multipartForm(c *gin.Context, maxBytes int64) (*multipart.Form, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Respond(c, apperror.New(http.StatusRequestEntityTooLarge, apperror.CodePayloadTooLarge,
+				fmt.Sprintf("The upload is larger than %d MB", maxBytes>>20)))
+			return nil, false
+		}
+		apperror.Respond(c, apperror.BadRequest("Invalid multipart form"))
+		return nil, false
+	}
+	return form, true
+}
+
+// imageRejectedMessage explains why an uploaded image was refused
+func imageRejectedMessage(name string, err error) string {
+	if errors.Is(err, utils.ErrImageTooLarge) {
+		return fmt.Sprintf("%s is larger than %dx%d pixels", name, utils.MaxImageSide, utils.MaxImageSide)
+	}
+	return name + " is not a supported image (JPEG, PNG, GIF or WebP)"
+}
+
+// saveFieldPhoto decodes an upload and stores it as a JPEG in ./uploads/<subdir>
+func saveFieldPhoto(subdir string, data []byte) (fieldPhoto, error) {
+	photo := fieldPhoto{SizeBytes: int64(len(data))}
+
+	decoded, _, err := utils.DecodeImage(data)
+	if err != nil {
+		return photo, err
+	}
+
+	dir := filepath.Join(uploadsDir(), filepath.FromSlash(subdir))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return photo, err
+	}
+	token, err := utils.GenerateSecureToken(12)
+	if err != nil {
+		return photo, err
+	}
+
+	name := token + ".jpg"
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return photo, err
+	}
+	photo.URL = path.Join(uploadsURLPrefix, subdir, name)
+	err = utils.EncodeJPEG(file, utils.ResizeToWidth(decoded, fieldPhotoMaxWidth))
+	file.Close()
+	if err != nil {
+		removeUploadedFiles(photo.URL)
+		return photo, err
+	}
+	return photo, nil
+}
+
+// saveFieldPhotos stores the images in a multipart field under
+// ./uploads/<subdir>. On a bad upload it removes what was already saved,
+// writes the error response and returns false.
+func saveFieldPhotos(c *gin.Context, field, subdir string, minCount, maxCount int) ([]fieldPhoto, bool) {
+	form, ok := multipartForm(c, int64(maxCount)*maxFieldPhotoBytes+multipartOverhead)
+	if !ok {
+		return nil, false
+	}
+	files := form.File[field]
+	if len(files) < minCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At least %d photo(s) required in %q", minCount, field)})
+		return nil, false
+	}
+	if len(files) > maxCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d photos can be uploaded", maxCount)})
+		return nil, false
+	}
+
+	var photos []fieldPhoto
+	for _, header := range files {
+		if header.Size > maxFieldPhotoBytes {
+			removeFieldPhotos(photos)
+			c.JSON(http.StatusBadRequest, gin.H{"error": header.Filename + " is larger than 10 MB"})
+			return nil, false
+		}
+		file, err := header.Open()
+		if err != nil {
+			removeFieldPhotos(photos)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read " + header.Filename})
+			return nil, false
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxFieldPhotoBytes+1))
+		file.Close()
+		if err != nil {
+			removeFieldPhotos(photos)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read " + header.Filename})
+			return nil, false
+		}
+
+		photo, err := saveFieldPhoto(subdir, data)
+		if err != nil {
+			removeFieldPhotos(photos)
+			log.Printf("Photo %s rejected: %v", header.Filename, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": imageRejectedMessage(header.Filename, err)})
+			return nil, false
+		}
+		photo.OriginalName = header.Filename
+		photos = append(photos, photo)
+	}
+	return photos, true
+}
@@ -9,22 +9,26 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
+	"aquahome/cache"
 	"aquahome/database"
 )
 
 // ProductRequest contains the data for product creation or update
 type ProductRequest struct {
-	Name             string  `json:"name" binding:"required"`
-	Description      string  `json:"description" binding:"required"`
-	ImageURL         string  `json:"image_url"`
-	MonthlyRent      float64 `json:"monthly_rent" binding:"required"`
-	SecurityDeposit  float64 `json:"security_deposit" binding:"required"`
-	InstallationFee  float64 `json:"installation_fee" binding:"required"`
-	AvailableStock   int     `json:"available_stock" binding:"required"`
-	Specifications   string  `json:"specifications"`
-	MaintenanceCycle int     `json:"maintenance_cycle"`
-	IsActive         bool    `json:"is_active"`
-	FranchiseID      uint    `json:"franchise_id" binding:"required"` // ✅ Add this
+	Name             string   `json:"name" binding:"required"`
+	Description      string   `json:"description" binding:"required"`
+	ImageURL         string   `json:"image_url"`
+	MonthlyRent      float64  `json:"monthly_rent" binding:"required"`
+	SecurityDeposit  float64  `json:"security_deposit" binding:"required"`
+	InstallationFee  float64  `json:"installation_fee" binding:"required"`
+	AvailableStock   int      `json:"available_stock" binding:"required"`
+	Specifications   string   `json:"specifications"`
+	MaintenanceCycle int      `json:"maintenance_cycle"`
+	IsActive         bool     `json:"is_active"`
+	FranchiseID      uint     `json:"franchise_id" binding:"required"` // ✅ Add this
+	HSNCode          string   `json:"hsn_code"`
+	GSTRate          *float64 `json:"gst_rate" binding:"omitempty,min=0,max=28"`
 }
 
 // CreateProduct creates a new product (Admin only)
@@ -37,7 +41,7 @@ func CreateProduct(c *gin.Context) {
 
 	var productRequest ProductRequest
 	if err := c.ShouldBindJSON(&productRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -47,7 +51,7 @@ func CreateProduct(c *gin.Context) {
 
 	// Validate that the FranchiseID exists in the system
 	var franchise database.Franchise
-	if err := database.DB.First(&franchise, productRequest.FranchiseID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&franchise, productRequest.FranchiseID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Franchise ID"})
 		return
 	}
@@ -64,9 +68,11 @@ func CreateProduct(c *gin.Context) {
 		MaintenanceCycle: productRequest.MaintenanceCycle,
 		IsActive:         productRequest.IsActive,
 		FranchiseID:      productRequest.FranchiseID, // ✅ Important
+		HSNCode:          productRequest.HSNCode,
+		GSTRate:          productRequest.GSTRate,
 	}
 
-	result := database.DB.Create(&product)
+	result := database.DB.WithContext(c.Request.Context()).Create(&product)
 	if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating product"})
@@ -80,7 +86,7 @@ func CreateProduct(c *gin.Context) {
 func GetProducts(c *gin.Context) {
 	var products []database.Product
 
-	query := database.DB.Preload("Franchise") // 👈 preload franchise
+	query := includeDeleted(c, database.DB.WithContext(c.Request.Context()).Preload("Franchise")) // 👈 preload franchise
 
 	roleInterface, exists := c.Get("role")
 	if exists {
@@ -104,7 +110,7 @@ func GetProductByID(c *gin.Context) {
 	id := c.Param("id")
 	var product database.Product
 
-	if err := database.DB.Preload("Franchise").First(&product, id).Error; err != nil {
+	if err := preloadActiveCatalog(database.DB.WithContext(c.Request.Context()).Preload("Franchise")).First(&product, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		} else {
@@ -139,12 +145,12 @@ func UpdateProduct(c *gin.Context) {
 
 	var productRequest ProductRequest
 	if err := c.ShouldBindJSON(&productRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	var product database.Product
-	result := database.DB.First(&product, uint(productID))
+	result := database.DB.WithContext(c.Request.Context()).First(&product, uint(productID))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
@@ -166,8 +172,10 @@ func UpdateProduct(c *gin.Context) {
 	product.MaintenanceCycle = productRequest.MaintenanceCycle
 	product.IsActive = productRequest.IsActive
 	product.FranchiseID = productRequest.FranchiseID //  Also update
+	product.HSNCode = productRequest.HSNCode
+	product.GSTRate = productRequest.GSTRate
 
-	result = database.DB.Save(&product)
+	result = database.DB.WithContext(c.Request.Context()).Save(&product)
 	if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating product"})
@@ -193,7 +201,7 @@ func DeleteProduct(c *gin.Context) {
 	}
 
 	var product database.Product
-	result := database.DB.First(&product, uint(productID))
+	result := database.DB.WithContext(c.Request.Context()).First(&product, uint(productID))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
@@ -204,14 +212,16 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	result = database.DB.Delete(&product)
+	result = database.DB.WithContext(c.Request.Context()).Delete(&product)
 	if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting product"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted permanently"})
+	recordAudit(c, nil, "product.delete", "product", product.ID, gin.H{"deleted": false}, gin.H{"deleted": true})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product deleted. It can be restored by an admin."})
 }
 
 // ToggleProductStatus toggles the IsActive status of a product (Admin only)
@@ -219,7 +229,7 @@ func ToggleProductStatus(c *gin.Context) {
 	id := c.Param("id")
 	var product database.Product
 
-	if err := database.DB.First(&product, id).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&product, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
@@ -228,16 +238,18 @@ func ToggleProductStatus(c *gin.Context) {
 		IsActive bool `json:"isActive"` // ✅ MATCHES frontend key
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 	log.Println("Received toggle status:", body.IsActive)
+	before := product
 	product.IsActive = body.IsActive
-	if err := database.DB.Save(&product).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Save(&product).Error; err != nil {
 		log.Println("Save failed:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product status"})
 		return
 	}
+	recordAudit(c, nil, "product.toggle_status", "product", product.ID, before, product)
 	c.JSON(http.StatusOK, product)
 }
 func GetCustomerProducts(c *gin.Context) {
@@ -253,8 +265,14 @@ func GetCustomerProducts(c *gin.Context) {
 		return
 	}
 
+	cacheKey := cache.PrefixProducts + "zip:" + customer.ZipCode
+	if respondCached(c, cacheKey) {
+		return
+	}
+
+	etag := versionedETag(c, database.DB.WithContext(c.Request.Context()), zipCatalogSources(database.DB.WithContext(c.Request.Context()), customer.ZipCode), "products", customer.ZipCode)
 	var products []database.Product
-	err := database.DB.
+	err := preloadActiveCatalog(database.DB.WithContext(c.Request.Context())).
 		Preload("Franchise").
 		Joins("JOIN franchises ON franchises.id = products.franchise_id").
 		Where("products.is_active = ? AND franchises.is_active = ? AND franchises.zip_code = ?", true, true, customer.ZipCode).
@@ -265,5 +283,21 @@ func GetCustomerProducts(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	cacheAndRespond(c, cacheKey, etag, products, catalogCacheTTL)
+}
+
+// zipCatalogSources are the rows the catalog offered in a pincode is built from
+func zipCatalogSources(db *gorm.DB, zipCode string) []versionSource {
+	products := func() *gorm.DB {
+		return db.Model(&database.Product{}).
+			Joins("JOIN franchises ON franchises.id = products.franchise_id").
+			Where("franchises.zip_code = ?", zipCode)
+	}
+	return []versionSource{
+		{"products", products()},
+		{"franchises", db.Model(&database.Franchise{}).Where("zip_code = ?", zipCode)},
+		{"product_variants", db.Model(&database.ProductVariant{}).Where("product_id IN (?)", products().Select("products.id"))},
+		{"rental_plans", db.Model(&database.RentalPlan{}).Where("product_id IN (?)", products().Select("products.id"))},
+		{"product_images", db.Model(&database.ProductImage{}).Where("product_id IN (?)", products().Select("products.id"))},
+	}
 }
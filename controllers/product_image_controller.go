@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+const (
+	productImageURLPrefix = "/uploads/products"
+	maxProductImageBytes  = 10 << 20
+	maxImagesPerUpload    = 10
+)
+
+// ReorderProductImagesRequest lists every image of a product in gallery order
+type ReorderProductImagesRequest struct {
+	ImageIDs []uint `json:"image_ids" binding:"required,min=1"`
+}
+
+// productImagePath maps an image URL back to its file on disk
+func productImagePath(url string) string {
+	return filepath.Join(uploadsDir(), "products", filepath.FromSlash(strings.TrimPrefix(url, productImageURLPrefix+"/")))
+}
+
+// removeProductImageFiles deletes every rendition of an image from disk
+func removeProductImageFiles(img database.ProductImage) {
+	for _, url := range []string{img.ThumbnailURL, img.MediumURL, img.FullURL, img.WebPThumbnailURL} {
+		if url == "" {
+			continue
+		}
+		if err := os.Remove(productImagePath(url)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove product image %s: %v", url, err)
+		}
+	}
+}
+
+// saveProductImage decodes an upload and writes its resized renditions to disk
+func saveProductImage(productID uint, data []byte) (database.ProductImage, error) {
+	img := database.ProductImage{ProductID: productID, SizeBytes: int64(len(data))}
+
+	decoded, _, err := utils.DecodeImage(data)
+	if err != nil {
+		return img, err
+	}
+	img.Width = decoded.Bounds().Dx()
+	img.Height = decoded.Bounds().Dy()
+
+	dir := filepath.Join(uploadsDir(), "products", fmt.Sprint(productID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return img, err
+	}
+	token, err := utils.GenerateSecureToken(12)
+	if err != nil {
+		return img, err
+	}
+
+	for _, size := range utils.ProductImageSizes {
+		name := fmt.Sprintf("%s_%s.jpg", token, size.Name)
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			removeProductImageFiles(img)
+			return img, err
+		}
+		err = utils.EncodeJPEG(file, utils.ResizeToWidth(decoded, size.MaxWidth))
+		file.Close()
+
+		url := path.Join(productImageURLPrefix, fmt.Sprint(productID), name)
+		switch size.Name {
+		case "thumbnail":
+			img.ThumbnailURL = url
+		case "medium":
+			img.MediumURL = url
+		case "full":
+			img.FullURL = url
+		}
+		if err != nil {
+			removeProductImageFiles(img)
+			return img, err
+		}
+	}
+	return img, nil
+}
+
+// UploadProductImages adds images to a product's gallery from the multipart
+// field "images" (Admin only)
+func UploadProductImages(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	form, ok := multipartForm(c, maxImagesPerUpload*maxProductImageBytes+multipartOverhead)
+	if !ok {
+		return
+	}
+	files := form.File["images"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No images uploaded"})
+		return
+	}
+	if len(files) > maxImagesPerUpload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d images can be uploaded at once", maxImagesPerUpload)})
+		return
+	}
+
+	var lastPosition int
+	database.DB.WithContext(c.Request.Context()).Model(&database.ProductImage{}).Where("product_id = ?", product.ID).
+		Select("COALESCE(MAX(position), 0)").Scan(&lastPosition)
+
+	var images []database.ProductImage
+	discard := func() {
+		for _, img := range images {
+			removeProductImageFiles(img)
+		}
+	}
+	for _, header := range files {
+		if header.Size > maxProductImageBytes {
+			discard()
+			c.JSON(http.StatusBadRequest, gin.H{"error": header.Filename + " is larger than 10 MB"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			discard()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read " + header.Filename})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxProductImageBytes+1))
+		file.Close()
+		if err != nil {
+			discard()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read " + header.Filename})
+			return
+		}
+
+		img, err := saveProductImage(product.ID, data)
+		if err != nil {
+			discard()
+			log.Printf("Product image %s rejected: %v", header.Filename, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": imageRejectedMessage(header.Filename, err)})
+			return
+		}
+		lastPosition++
+		img.Position = lastPosition
+		img.OriginalName = header.Filename
+		img.AltText = product.Name
+		images = append(images, img)
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&images).Error; err != nil {
+			return err
+		}
+		// Keep image_url populated for clients that only read the single image
+		if product.ImageURL == "" {
+			return tx.Model(&product).Update("image_url", images[0].MediumURL).Error
+		}
+		return nil
+	})
+	if err != nil {
+		discard()
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving product images"})
+		return
+	}
+
+	for _, img := range images {
+		queueImageProcessing(database.UploadPurposeProductImage, img.ID)
+	}
+	recordAudit(c, nil, "product.images_upload", "product", product.ID, nil, gin.H{"images": len(images)})
+	c.JSON(http.StatusCreated, images)
+}
+
+// GetProductImages returns a product's gallery in display order
+func GetProductImages(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var images []database.ProductImage
+	if err := database.DB.WithContext(c.Request.Context()).Where("product_id = ?", product.ID).Order("position, id").Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product images"})
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// ReorderProductImages sets the gallery order of a product's images (Admin only)
+func ReorderProductImages(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var req ReorderProductImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	var existing []uint
+	database.DB.WithContext(c.Request.Context()).Model(&database.ProductImage{}).Where("product_id = ?", product.ID).Pluck("id", &existing)
+	known := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		known[id] = true
+	}
+	if len(req.ImageIDs) != len(existing) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image of the product exactly once"})
+		return
+	}
+	for _, id := range req.ImageIDs {
+		if !known[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image of the product exactly once"})
+			return
+		}
+		delete(known, id)
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.ImageIDs {
+			if err := tx.Model(&database.ProductImage{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reordering product images"})
+		return
+	}
+
+	recordAudit(c, nil, "product.images_reorder", "product", product.ID, gin.H{"image_ids": existing}, gin.H{"image_ids": req.ImageIDs})
+	GetProductImages(c)
+}
+
+// DeleteProductImage removes an image and its files from a product's gallery (Admin only)
+func DeleteProductImage(c *gin.Context) {
+	product, ok := catalogProduct(c)
+	if !ok {
+		return
+	}
+
+	var img database.ProductImage
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND product_id = ?", c.Param("image_id"), product.ID).First(&img).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&img).Error; err != nil {
+			return err
+		}
+		if product.ImageURL != img.MediumURL {
+			return nil
+		}
+		// The primary image was removed; promote the next one in the gallery
+		var next database.ProductImage
+		imageURL := ""
+		if err := tx.Where("product_id = ?", product.ID).Order("position, id").First(&next).Error; err == nil {
+			imageURL = next.MediumURL
+		}
+		return tx.Model(&product).Update("image_url", imageURL).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting product image"})
+		return
+	}
+	removeProductImageFiles(img)
+
+	recordAudit(c, nil, "product.image_delete", "product", product.ID, gin.H{"image_id": img.ID}, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted"})
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// PushDeviceRequest registers an app install for push notifications
+type PushDeviceRequest struct {
+	Token    string `json:"token" binding:"required,max=500"`
+	Platform string `json:"platform" binding:"required,oneof=android ios web"`
+}
+
+// RegisterPushDevice registers the caller's device for push notifications.
+// A token already registered moves to the caller, since the app was signed
+// in to another account.
+// POST /api/users/me/devices
+func RegisterPushDevice(c *gin.Context) {
+	var req PushDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	device := database.PushDevice{
+		UserID:     c.GetUint("user_id"),
+		Token:      req.Token,
+		Platform:   req.Platform,
+		LastSeenAt: time.Now(),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "last_seen_at", "updated_at", "deleted_at"}),
+	}).Create(&device).Error; err != nil {
+		log.Printf("Error registering push device: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+	database.DB.WithContext(c.Request.Context()).Where("token = ?", req.Token).First(&device)
+	c.JSON(http.StatusOK, device)
+}
+
+// DeletePushDevice stops push notifications to one of the caller's devices
+// DELETE /api/users/me/devices/:id
+func DeletePushDevice(c *gin.Context) {
+	result := database.DB.WithContext(c.Request.Context()).Unscoped().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		Delete(&database.PushDevice{})
+	if result.Error != nil {
+		log.Printf("Error deleting push device: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove device"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Device removed"})
+}
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/risk"
+)
+
+// BlacklistRequest blocks a phone number or email from placing orders
+type BlacklistRequest struct {
+	Kind   string `json:"kind" binding:"required,oneof=phone email"`
+	Value  string `json:"value" binding:"required,max=255"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// BlacklistCustomerRequest says why a customer's phone and email are blocked
+type BlacklistCustomerRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// RiskOverrideRequest lets a blacklisted customer place one order
+type RiskOverrideRequest struct {
+	Reason        string `json:"reason" binding:"required,max=500"`
+	ExpireInHours int    `json:"expire_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// FlaggedCustomer is a flagged customer's assessment with who they are
+type FlaggedCustomer struct {
+	risk.Assessment
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+	Email string `json:"email"`
+}
+
+// defaultRiskOverrideHours is how long an override lasts when no expiry is given
+const defaultRiskOverrideHours = 72
+
+// orderRiskCheck stops a blacklisted customer placing an order. It returns
+// the admin override that lets the order through, if one was needed; the
+// caller spends it with risk.UseOverride once the order exists.
+func orderRiskCheck(db *gorm.DB, customerID uint) (*database.RiskOverride, error) {
+	var customer database.User
+	if err := db.Select("id, phone, email").First(&customer, customerID).Error; err != nil {
+		return nil, apperror.Internal(err)
+	}
+	entries, err := risk.Blocked(db, customer)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	override, err := risk.ActiveOverride(db, customerID)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if override == nil {
+		log.Printf("Order blocked for blacklisted customer %d", customerID)
+		return nil, apperror.Forbidden("Orders cannot be placed from this account. Please contact support.")
+	}
+	return override, nil
+}
+
+// customerForRisk loads the customer named in the URL. It writes the error
+// response and returns false on failure.
+func customerForRisk(c *gin.Context) (database.User, bool) {
+	var customer database.User
+	id, ok := ownerIDParam(c)
+	if !ok {
+		return customer, false
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, name, phone, email, role").
+		Where("role = ?", database.RoleCustomer).First(&customer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Customer not found"))
+		} else {
+			apperror.Respond(c, apperror.Internal(err))
+		}
+		return customer, false
+	}
+	return customer, true
+}
+
+// GetCustomerRisk shows a customer's risk score, what it is made of, the
+// blacklist entries that match them and any override waiting to be used
+// (Admin only)
+// GET /api/admin/customers/:id/risk
+func GetCustomerRisk(c *gin.Context) {
+	customer, ok := customerForRisk(c)
+	if !ok {
+		return
+	}
+	assessment, err := risk.Assess(database.ReadDB().WithContext(c.Request.Context()), customer.ID)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to assess customer"))
+		return
+	}
+	override, err := risk.ActiveOverride(database.ReadDB().WithContext(c.Request.Context()), customer.ID)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"risk": assessment, "override": override})
+}
+
+// GetFlaggedCustomers lists customers flagged for payment failures,
+// chargebacks or device damage, riskiest first (Admin only)
+// GET /api/admin/risk/flagged
+func GetFlaggedCustomers(c *gin.Context) {
+	flagged, err := risk.Flagged(database.ReadDB().WithContext(c.Request.Context()))
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to assess customers"))
+		return
+	}
+
+	ids := make([]uint, len(flagged))
+	for i, a := range flagged {
+		ids[i] = a.CustomerID
+	}
+	var users []database.User
+	if err := database.ReadDB().WithContext(c.Request.Context()).Select("id, name, phone, email").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	byID := make(map[uint]database.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	customers := make([]FlaggedCustomer, len(flagged))
+	for i, a := range flagged {
+		u := byID[a.CustomerID]
+		customers[i] = FlaggedCustomer{Assessment: a, Name: u.Name, Phone: u.Phone, Email: u.Email}
+	}
+	c.JSON(http.StatusOK, gin.H{"customers": customers})
+}
+
+// GetBlacklist lists blacklisted phones and emails, filtered by ?kind
+// (Admin only)
+// GET /api/admin/blacklist
+func GetBlacklist(c *gin.Context) {
+	query := database.ReadDB().WithContext(c.Request.Context()).Order("created_at DESC")
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var entries []database.BlacklistEntry
+	if err := query.Find(&entries).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blacklist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// addToBlacklist blocks a value unless it is already blocked, reporting
+// whether it added an entry
+func addToBlacklist(c *gin.Context, entry *database.BlacklistEntry) (bool, error) {
+	var existing int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.BlacklistEntry{}).
+		Where("kind = ? AND value = ?", entry.Kind, entry.Value).Count(&existing).Error; err != nil {
+		return false, err
+	}
+	if existing > 0 {
+		return false, nil
+	}
+	entry.CreatedByID = c.GetUint("user_id")
+	if err := database.DB.WithContext(c.Request.Context()).Create(entry).Error; err != nil {
+		return false, err
+	}
+	recordAudit(c, nil, "blacklist.added", "blacklist_entry", entry.ID, nil, entry)
+	return true, nil
+}
+
+// AddBlacklistEntry blocks a phone number or email from placing orders
+// (Admin only)
+// POST /api/admin/blacklist
+func AddBlacklistEntry(c *gin.Context) {
+	var req BlacklistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	entry := database.BlacklistEntry{Kind: req.Kind, Value: risk.Normalize(req.Kind, req.Value), Reason: req.Reason}
+	if entry.Value == "" {
+		apperror.Respond(c, apperror.BadRequest("Invalid "+req.Kind))
+		return
+	}
+	added, err := addToBlacklist(c, &entry)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to update blacklist"))
+		return
+	}
+	if !added {
+		apperror.Respond(c, apperror.Conflict("This "+req.Kind+" is already blacklisted"))
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// BlacklistCustomer blocks a customer's phone and email from placing orders
+// (Admin only)
+// POST /api/admin/customers/:id/blacklist
+func BlacklistCustomer(c *gin.Context) {
+	var req BlacklistCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	customer, ok := customerForRisk(c)
+	if !ok {
+		return
+	}
+
+	entries := []database.BlacklistEntry{}
+	for kind, value := range map[string]string{
+		database.BlacklistKindPhone: customer.Phone,
+		database.BlacklistKindEmail: customer.Email,
+	} {
+		entry := database.BlacklistEntry{Kind: kind, Value: risk.Normalize(kind, value), Reason: req.Reason, CustomerID: &customer.ID}
+		if entry.Value == "" {
+			continue
+		}
+		added, err := addToBlacklist(c, &entry)
+		if err != nil {
+			apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to update blacklist"))
+			return
+		}
+		if added {
+			entries = append(entries, entry)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"added": entries})
+}
+
+// RemoveBlacklistEntry unblocks a phone number or email (Admin only)
+// DELETE /api/admin/blacklist/:id
+func RemoveBlacklistEntry(c *gin.Context) {
+	var entry database.BlacklistEntry
+	if err := database.DB.WithContext(c.Request.Context()).First(&entry, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Blacklist entry not found"))
+			return
+		}
+		apperror.Respond(c, apperror.Internal(err))
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&entry).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to update blacklist"))
+		return
+	}
+	recordAudit(c, nil, "blacklist.removed", "blacklist_entry", entry.ID, entry, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from blacklist"})
+}
+
+// GrantRiskOverride lets a blacklisted customer place one order before the
+// override expires (Admin only)
+// POST /api/admin/customers/:id/risk-override
+func GrantRiskOverride(c *gin.Context) {
+	var req RiskOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	customer, ok := customerForRisk(c)
+	if !ok {
+		return
+	}
+	hours := req.ExpireInHours
+	if hours == 0 {
+		hours = defaultRiskOverrideHours
+	}
+
+	override := database.RiskOverride{
+		CustomerID:  customer.ID,
+		Reason:      req.Reason,
+		GrantedByID: c.GetUint("user_id"),
+		ExpiresAt:   time.Now().Add(time.Duration(hours) * time.Hour),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&override).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to grant override"))
+		return
+	}
+	recordAudit(c, nil, "risk.override_granted", "user", customer.ID, nil, override)
+	c.JSON(http.StatusCreated, override)
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// RoleRequest contains data for creating or updating a role
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// GetPermissions lists every permission that can be granted to a role
+func GetPermissions(c *gin.Context) {
+	var permissions []database.Permission
+	if err := database.DB.WithContext(c.Request.Context()).Order("code").Find(&permissions).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// GetRoles lists all roles with their permissions
+func GetRoles(c *gin.Context) {
+	var roles []database.Role
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole creates a custom role such as "finance" or "ops"
+func CreateRole(c *gin.Context) {
+	var request RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(request.Name))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name is required"})
+		return
+	}
+
+	var existing int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.Role{}).Where("name = ?", name).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	permissions, ok := loadPermissions(c, request.Permissions)
+	if !ok {
+		return
+	}
+
+	role := database.Role{Name: name, Description: request.Description, Permissions: permissions}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&role).Error; err != nil {
+		log.Printf("Error creating role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	database.InvalidatePermissionCache()
+	recordAudit(c, nil, "role.create", "role", role.ID, nil, gin.H{"name": role.Name, "permissions": strings.Join(request.Permissions, ",")})
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole replaces the description and permission set of a role
+func UpdateRole(c *gin.Context) {
+	role, ok := loadRole(c)
+	if !ok {
+		return
+	}
+	if role.Name == database.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The admin role always has every permission"})
+		return
+	}
+
+	var request RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	permissions, ok := loadPermissions(c, request.Permissions)
+	if !ok {
+		return
+	}
+
+	before := gin.H{"description": role.Description, "permissions": permissionCodes(role.Permissions)}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if request.Description != "" {
+			if err := tx.Model(&role).Update("description", request.Description).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&role).Association("Permissions").Replace(permissions)
+	})
+	if err != nil {
+		log.Printf("Error updating role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	database.InvalidatePermissionCache()
+	recordAudit(c, nil, "role.update", "role", role.ID, before, gin.H{"description": role.Description, "permissions": permissionCodes(permissions)})
+
+	role.Permissions = permissions
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole removes a custom role that no user is assigned to
+func DeleteRole(c *gin.Context) {
+	role, ok := loadRole(c)
+	if !ok {
+		return
+	}
+	if role.IsSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles can't be deleted"})
+		return
+	}
+
+	var assigned int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Where("role = ?", role.Name).Count(&assigned)
+	if assigned > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users"})
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		log.Printf("Error deleting role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	database.InvalidatePermissionCache()
+	recordAudit(c, nil, "role.delete", "role", role.ID, gin.H{"name": role.Name}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// AssignUserRole changes the role of a user
+func AssignUserRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("Role is required"))
+		return
+	}
+
+	var role database.Role
+	if err := database.DB.WithContext(c.Request.Context()).Where("name = ?", request.Role).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't change your own role"})
+		return
+	}
+
+	before := user.Role
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Update("role", role.Name).Error; err != nil {
+		log.Printf("Error assigning role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	recordAudit(c, nil, "user.assign_role", "user", user.ID, gin.H{"role": before}, gin.H{"role": role.Name})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned successfully", "user": user})
+}
+
+// loadRole loads the :id role, writing the error response on failure
+func loadRole(c *gin.Context) (database.Role, bool) {
+	var role database.Role
+
+	roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return role, false
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Permissions").First(&role, roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return role, false
+	}
+
+	return role, true
+}
+
+// loadPermissions resolves permission codes, rejecting unknown ones
+func loadPermissions(c *gin.Context, codes []string) ([]database.Permission, bool) {
+	permissions := []database.Permission{}
+	if len(codes) == 0 {
+		return permissions, true
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Where("code IN ?", codes).Find(&permissions).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return nil, false
+	}
+
+	if len(permissions) != len(codes) {
+		known := map[string]bool{}
+		for _, p := range permissions {
+			known[p.Code] = true
+		}
+		for _, code := range codes {
+			if !known[code] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + code})
+				return nil, false
+			}
+		}
+	}
+
+	return permissions, true
+}
+
+// permissionCodes joins the codes of a permission set for audit entries
+func permissionCodes(permissions []database.Permission) string {
+	codes := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		codes = append(codes, p.Code)
+	}
+	return strings.Join(codes, ",")
+}
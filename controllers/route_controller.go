@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// RouteStop is one visit in an agent's daily route
+type RouteStop struct {
+	Sequence      int        `json:"sequence"`
+	TaskType      string     `json:"task_type"` // "service_request" or "order"
+	TaskID        uint       `json:"task_id"`
+	Status        string     `json:"status"`
+	Description   string     `json:"description"`
+	ScheduledTime *time.Time `json:"scheduled_time"`
+	CustomerID    uint       `json:"customer_id"`
+	CustomerName  string     `json:"customer_name"`
+	CustomerPhone string     `json:"customer_phone"`
+	Address       string     `json:"address"`
+	Latitude      float64    `json:"latitude"`
+	Longitude     float64    `json:"longitude"`
+	DistanceKm    float64    `json:"distance_km"` // from the previous stop
+	Located       bool       `json:"located"`
+}
+
+// GetAgentRoute returns the agent's tasks for a day in a visiting order that keeps
+// travel short, using a nearest-neighbour walk over the customers' coordinates
+// GET /api/agent/route?date=2006-01-02
+func GetAgentRoute(c *gin.Context) {
+	agentID := c.GetUint("user_id")
+
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", d, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, use YYYY-MM-DD"})
+			return
+		}
+		date = parsed
+	}
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var stops []RouteStop
+
+	var serviceRequests []database.ServiceRequest
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Customer").
+		Where("service_agent_id = ? AND scheduled_time >= ? AND scheduled_time < ? AND status NOT IN ?",
+			agentID, dayStart, dayEnd, []string{database.ServiceStatusCompleted, database.ServiceStatusCancelled}).
+		Find(&serviceRequests).Error; err != nil {
+		log.Printf("DB error fetching agent route tasks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+	for _, sr := range serviceRequests {
+		stops = append(stops, RouteStop{
+			TaskType:      "service_request",
+			TaskID:        sr.ID,
+			Status:        sr.Status,
+			Description:   sr.Description,
+			ScheduledTime: sr.ScheduledTime,
+			CustomerID:    sr.CustomerID,
+			CustomerName:  sr.Customer.Name,
+			CustomerPhone: sr.Customer.Phone,
+			Address:       sr.Customer.Address,
+			Latitude:      sr.Customer.Latitude,
+			Longitude:     sr.Customer.Longitude,
+		})
+	}
+
+	var orders []database.Order
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Customer").
+		Where("service_agent_id = ? AND delivery_date >= ? AND delivery_date < ? AND status NOT IN ?",
+			agentID, dayStart, dayEnd, []string{database.OrderStatusDelivered, database.OrderStatusInstalled, database.OrderStatusCompleted,
+				database.OrderStatusCancelled, database.OrderStatusRejected}).
+		Find(&orders).Error; err != nil {
+		log.Printf("DB error fetching agent route orders: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	for _, order := range orders {
+		deliveryDate := order.DeliveryDate
+		stops = append(stops, RouteStop{
+			TaskType:      "order",
+			TaskID:        order.ID,
+			Status:        order.Status,
+			Description:   "Installation / delivery",
+			ScheduledTime: &deliveryDate,
+			CustomerID:    order.CustomerID,
+			CustomerName:  order.Customer.Name,
+			CustomerPhone: order.Customer.Phone,
+			Address:       order.ShippingAddress,
+			Latitude:      order.Customer.Latitude,
+			Longitude:     order.Customer.Longitude,
+		})
+	}
+
+	// Start from the agent's saved location when available
+	var agent database.User
+	database.DB.WithContext(c.Request.Context()).Select("id", "latitude", "longitude").First(&agent, agentID)
+
+	route, total := planRoute(stops, agent.Latitude, agent.Longitude)
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":              dayStart.Format("2006-01-02"),
+		"stops":             route,
+		"total_distance_km": total,
+		"stop_count":        len(route),
+	})
+}
+
+// planRoute orders stops with a nearest-neighbour heuristic starting from (lat, lng)
+// or from the first located stop. Stops without coordinates are appended at the end.
+func planRoute(stops []RouteStop, lat, lng float64) ([]RouteStop, float64) {
+	var located, unlocated []RouteStop
+	for _, stop := range stops {
+		stop.Located = utils.HasCoordinates(stop.Latitude, stop.Longitude)
+		if stop.Located {
+			located = append(located, stop)
+		} else {
+			unlocated = append(unlocated, stop)
+		}
+	}
+
+	route := make([]RouteStop, 0, len(stops))
+	total := 0.0
+	hasStart := utils.HasCoordinates(lat, lng)
+
+	for len(located) > 0 {
+		next := 0
+		distance := 0.0
+		if hasStart {
+			distance = math.MaxFloat64
+			for i, stop := range located {
+				if d := utils.HaversineKm(lat, lng, stop.Latitude, stop.Longitude); d < distance {
+					next, distance = i, d
+				}
+			}
+		}
+
+		stop := located[next]
+		stop.DistanceKm = math.Round(distance*100) / 100
+		total += distance
+		route = append(route, stop)
+
+		lat, lng, hasStart = stop.Latitude, stop.Longitude, true
+		located = append(located[:next], located[next+1:]...)
+	}
+	route = append(route, unlocated...)
+
+	for i := range route {
+		route[i].Sequence = i + 1
+	}
+	return route, math.Round(total*100) / 100
+}
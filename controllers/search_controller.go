@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// Results per group of the admin search
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 20
+)
+
+// CustomerSearchHit is a customer matched by name, email or phone
+type CustomerSearchHit struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrderSearchHit is an order matched by ID
+type OrderSearchHit struct {
+	ID           uint      `json:"id"`
+	Status       string    `json:"status"`
+	CustomerID   uint      `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	TotalAmount  float64   `json:"total_amount"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SubscriptionSearchHit is a subscription matched by its ID or its order's
+type SubscriptionSearchHit struct {
+	ID              uint      `json:"id"`
+	OrderID         uint      `json:"order_id"`
+	Status          string    `json:"status"`
+	CustomerID      uint      `json:"customer_id"`
+	CustomerName    string    `json:"customer_name"`
+	ProductName     string    `json:"product_name"`
+	MonthlyRent     float64   `json:"monthly_rent"`
+	NextBillingDate time.Time `json:"next_billing_date"`
+}
+
+// PaymentSearchHit is a payment matched by ID, transaction ID or invoice number
+type PaymentSearchHit struct {
+	ID            uint      `json:"id"`
+	Status        string    `json:"status"`
+	Amount        float64   `json:"amount"`
+	TransactionID string    `json:"transaction_id"`
+	InvoiceNumber string    `json:"invoice_number"`
+	CustomerID    uint      `json:"customer_id"`
+	CustomerName  string    `json:"customer_name"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SearchResults groups the matches of an admin search by type
+type SearchResults struct {
+	Query         string                  `json:"query"`
+	Customers     []CustomerSearchHit     `json:"customers"`
+	Orders        []OrderSearchHit        `json:"orders"`
+	Subscriptions []SubscriptionSearchHit `json:"subscriptions"`
+	Payments      []PaymentSearchHit      `json:"payments"`
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern is the ILIKE pattern matching values that contain s
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// AdminSearch finds customers, orders, subscriptions and payments matching
+// ?q= in one call. Numeric queries (optionally prefixed with #) also match
+// record IDs; ?limit= caps each group.
+func AdminSearch(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < 2 {
+		apperror.Respond(c, apperror.BadRequest("q must be at least 2 characters"))
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if limit < 1 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	like := containsPattern(q)
+	id, idErr := strconv.ParseUint(strings.TrimPrefix(q, "#"), 10, 64)
+	isID := idErr == nil
+
+	db := database.ReadDB().WithContext(c.Request.Context())
+	results := SearchResults{
+		Query:         q,
+		Orders:        []OrderSearchHit{},
+		Subscriptions: []SubscriptionSearchHit{},
+	}
+
+	err := db.Table("users").
+		Select("id, name, email, phone, created_at").
+		Where("role = ?", database.RoleCustomer).
+		Where("name ILIKE ? OR email ILIKE ? OR phone ILIKE ?", like, like, like).
+		Where(notDeleted("users")).
+		Order("name").
+		Limit(limit).
+		Find(&results.Customers).Error
+
+	// Orders and subscriptions are only looked up by ID
+	if err == nil && isID {
+		err = db.Table("orders").
+			Select("orders.id, orders.status, orders.customer_id, users.name as customer_name, orders.total_initial_amount as total_amount, orders.created_at").
+			Joins("JOIN users ON orders.customer_id = users.id").
+			Where("orders.id = ?", id).
+			Where(notDeleted("orders")).
+			Find(&results.Orders).Error
+	}
+
+	if err == nil && isID {
+		err = db.Table("subscriptions").
+			Select("subscriptions.id, subscriptions.order_id, subscriptions.status, subscriptions.customer_id, users.name as customer_name, products.name as product_name, subscriptions.monthly_rent, subscriptions.next_billing_date").
+			Joins("JOIN users ON subscriptions.customer_id = users.id").
+			Joins("JOIN products ON subscriptions.product_id = products.id").
+			Where("subscriptions.id = ? OR subscriptions.order_id = ?", id, id).
+			Where(notDeleted("subscriptions")).
+			Order("subscriptions.id DESC").
+			Limit(limit).
+			Find(&results.Subscriptions).Error
+	}
+
+	if err == nil {
+		query := db.Table("payments").
+			Select("payments.id, payments.status, payments.amount, payments.transaction_id, payments.invoice_number, payments.customer_id, users.name as customer_name, payments.created_at").
+			Joins("JOIN users ON payments.customer_id = users.id").
+			Where(notDeleted("payments"))
+		if isID {
+			query = query.Where("payments.id = ? OR payments.transaction_id ILIKE ? OR payments.invoice_number ILIKE ?", id, like, like)
+		} else {
+			query = query.Where("payments.transaction_id ILIKE ? OR payments.invoice_number ILIKE ?", like, like)
+		}
+		err = query.Order("payments.created_at DESC").
+			Limit(limit).
+			Find(&results.Payments).Error
+	}
+
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Search failed"))
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
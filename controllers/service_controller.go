@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"aquahome/apperror"
 	"aquahome/database"
 )
 
@@ -19,7 +22,7 @@ type ServiceRequestCreateRequest struct {
 	SubscriptionID int64  `json:"subscription_id" binding:"required"`
 	RequestType    string `json:"request_type" binding:"required"`
 	Description    string `json:"description" binding:"required"`
-	ScheduledTime  string `json:"scheduled_time" binding:"required"`
+	ScheduledTime  string `json:"scheduled_time" binding:"required"` // RFC3339 start of a slot from GET /api/service-slots
 	// UserID         string `json:"user_id" binding:"required"`
 }
 
@@ -28,8 +31,9 @@ type ServiceRequestUpdateRequest struct {
 	Status         string `json:"status"`
 	AgentID        uint   `json:"agent_id"`
 	ScheduledDate  string `json:"scheduled_date"`
-	CompletionDate string `json:"completion_date"`
-	Notes          string `json:"notes"`
+	CompletionDate string      `json:"completion_date"`
+	Notes          string      `json:"notes"`
+	PartsUsed      []PartUsage `json:"parts_used" binding:"dive"` // taken out of stock on completion
 }
 
 // FeedbackRequest contains feedback data for a completed service
@@ -59,27 +63,29 @@ func GetServiceRequests(c *gin.Context) {
 	var err error // ✅ Declare err here to avoid undefined error in switch
 
 	type ServiceRequestWithDetails struct {
-		ID               uint       `json:"id"`
-		Type             string     `json:"type"`
-		Status           string     `json:"status"`
-		Description      string     `json:"description"`
-		ScheduledTime    *time.Time `json:"scheduled_time"`
-		CompletionTime   *time.Time `json:"completion_time"`
-		Rating           *int       `json:"rating"`
-		Feedback         string     `json:"feedback"`
-		CreatedAt        time.Time  `json:"created_at"`
-		UpdatedAt        time.Time  `json:"updated_at"`
-		CustomerID       uint       `json:"customer_id"`
-		CustomerName     string     `json:"customer_name"`
-		CustomerEmail    string     `json:"customer_email"`
-		CustomerPhone    string     `json:"customer_phone"`
-		ProductID        uint       `json:"product_id"`
-		ProductName      string     `json:"product_name"`
-		SubscriptionID   uint       `json:"subscription_id"`
-		FranchiseID      *uint      `json:"franchise_id"`
-		FranchiseName    string     `json:"franchise_name"`
-		ServiceAgentID   *uint      `json:"service_agent_id"`
-		ServiceAgentName string     `json:"service_agent_name"`
+		ID                  uint       `json:"id"`
+		Type                string     `json:"type"`
+		Status              string     `json:"status"`
+		Description         string     `json:"description"`
+		ScheduledTime       *time.Time `json:"scheduled_time"`
+		CompletionTime      *time.Time `json:"completion_time"`
+		Rating              *int       `json:"rating"`
+		Feedback            string     `json:"feedback"`
+		CreatedAt           time.Time  `json:"created_at"`
+		UpdatedAt           time.Time  `json:"updated_at"`
+		CustomerID          uint       `json:"customer_id"`
+		CustomerName        string     `json:"customer_name"`
+		CustomerEmail       string     `json:"customer_email"`
+		CustomerPhone       string     `json:"customer_phone"`
+		CustomerPicture     string     `json:"customer_profile_picture"`
+		ProductID           uint       `json:"product_id"`
+		ProductName         string     `json:"product_name"`
+		SubscriptionID      uint       `json:"subscription_id"`
+		FranchiseID         *uint      `json:"franchise_id"`
+		FranchiseName       string     `json:"franchise_name"`
+		ServiceAgentID      *uint      `json:"service_agent_id"`
+		ServiceAgentName    string     `json:"service_agent_name"`
+		ServiceAgentPicture string     `json:"service_agent_profile_picture"`
 	}
 
 	var results []ServiceRequestWithDetails
@@ -87,7 +93,7 @@ func GetServiceRequests(c *gin.Context) {
 	switch role {
 	case database.RoleAdmin:
 		// Admin can see all service requests
-		err = database.DB.Table("service_requests").
+		err = database.DB.WithContext(c.Request.Context()).Table("service_requests").
 			Select(`
                 service_requests.id,
                 service_requests.type,
@@ -103,13 +109,15 @@ func GetServiceRequests(c *gin.Context) {
                 customer.name as customer_name,
                 customer.email as customer_email,
                 customer.phone as customer_phone,
+                customer.profile_picture as customer_profile_picture,
                 subscriptions.product_id,
                 products.name as product_name,
                 service_requests.subscription_id,
                 franchises.id as franchise_id,
                 franchises.name as franchise_name,
                 service_requests.service_agent_id,
-                service_agent.name as service_agent_name
+                service_agent.name as service_agent_name,
+                service_agent.profile_picture as service_agent_profile_picture
             `).
 			Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 			Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
@@ -120,8 +128,12 @@ func GetServiceRequests(c *gin.Context) {
 			Find(&results).Error
 
 	case database.RoleFranchiseOwner:
-		// Franchise owner can see service requests assigned to their franchise
-		err = database.DB.Table("service_requests").
+		// Franchise owner can see service requests of their franchises
+		franchiseIDs, ok := ownerFranchiseIDs(c)
+		if !ok {
+			return
+		}
+		err = database.DB.WithContext(c.Request.Context()).Table("service_requests").
 			Select(`
                 service_requests.id,
                 service_requests.type,
@@ -137,26 +149,28 @@ func GetServiceRequests(c *gin.Context) {
                 customer.name as customer_name,
                 customer.email as customer_email,
                 customer.phone as customer_phone,
+                customer.profile_picture as customer_profile_picture,
                 subscriptions.product_id,
                 products.name as product_name,
                 service_requests.subscription_id,
                 franchises.id as franchise_id,
                 franchises.name as franchise_name,
                 service_requests.service_agent_id,
-                service_agent.name as service_agent_name
+                service_agent.name as service_agent_name,
+                service_agent.profile_picture as service_agent_profile_picture
             `).
 			Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 			Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
 			Joins("JOIN products ON subscriptions.product_id = products.id").
 			Joins("JOIN franchises ON subscriptions.franchise_id = franchises.id").
 			Joins("LEFT JOIN users as service_agent ON service_requests.service_agent_id = service_agent.id").
-			Where("franchises.owner_id = ?", userIDInt).
+			Where("subscriptions.franchise_id IN ?", franchiseIDs).
 			Order("service_requests.created_at DESC").
 			Find(&results).Error
 
 	case database.RoleServiceAgent:
 		// Service agent can see service requests assigned to them
-		err = database.DB.Table("service_requests").
+		err = database.DB.WithContext(c.Request.Context()).Table("service_requests").
 			Select(`
                 service_requests.id,
                 service_requests.type,
@@ -172,13 +186,15 @@ func GetServiceRequests(c *gin.Context) {
                 customer.name as customer_name,
                 customer.email as customer_email,
                 customer.phone as customer_phone,
+                customer.profile_picture as customer_profile_picture,
                 subscriptions.product_id,
                 products.name as product_name,
                 service_requests.subscription_id,
                 franchises.id as franchise_id,
                 franchises.name as franchise_name,
                 service_requests.service_agent_id,
-                service_agent.name as service_agent_name
+                service_agent.name as service_agent_name,
+                service_agent.profile_picture as service_agent_profile_picture
             `).
 			Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 			Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
@@ -191,7 +207,7 @@ func GetServiceRequests(c *gin.Context) {
 
 	case database.RoleCustomer:
 		// Customer can see their own service requests
-		err = database.DB.Table("service_requests").
+		err = database.DB.WithContext(c.Request.Context()).Table("service_requests").
 			Select(`
                 service_requests.id,
                 service_requests.type,
@@ -207,13 +223,15 @@ func GetServiceRequests(c *gin.Context) {
                 customer.name as customer_name,
                 customer.email as customer_email,
                 customer.phone as customer_phone,
+                customer.profile_picture as customer_profile_picture,
                 subscriptions.product_id,
                 products.name as product_name,
                 service_requests.subscription_id,
                 franchises.id as franchise_id,
                 franchises.name as franchise_name,
                 service_requests.service_agent_id,
-                service_agent.name as service_agent_name
+                service_agent.name as service_agent_name,
+                service_agent.profile_picture as service_agent_profile_picture
             `).
 			Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 			Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
@@ -263,22 +281,22 @@ func GetServiceRequestByID(c *gin.Context) {
 	case database.RoleAdmin:
 		// Admin can see any service request
 		// No additional check needed
-		database.DB.Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).Count(&count)
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).Count(&count)
 	case database.RoleFranchiseOwner:
 		// Check if the service request belongs to this franchise owner
-		database.DB.Model(&database.ServiceRequest{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
 			Joins("JOIN franchises ON subscriptions.franchise_id = franchises.id").
 			Where("service_requests.id = ? AND franchises.owner_id = ?", requestIDInt, userIDInt).
 			Count(&count)
 	case database.RoleServiceAgent:
 		// Check if the service request is assigned to this service agent
-		database.DB.Model(&database.ServiceRequest{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Where("id = ? AND service_agent_id = ?", requestIDInt, userIDInt).
 			Count(&count)
 	case database.RoleCustomer:
 		// Check if the service request belongs to this customer
-		database.DB.Model(&database.ServiceRequest{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Where("id = ? AND customer_id = ?", requestIDInt, userIDInt).
 			Count(&count)
 	default:
@@ -293,34 +311,36 @@ func GetServiceRequestByID(c *gin.Context) {
 
 	// Fetch the service request details
 	type ServiceRequestWithDetails struct {
-		ID               uint       `json:"id"`
-		Type             string     `json:"type"`
-		Status           string     `json:"status"`
-		Description      string     `json:"description"`
-		ScheduledTime    *time.Time `json:"scheduled_time"`
-		CompletionTime   *time.Time `json:"completion_time"`
-		Notes            string     `json:"notes"`
-		Rating           *int       `json:"rating"`
-		Feedback         string     `json:"feedback"`
-		CreatedAt        time.Time  `json:"created_at"`
-		UpdatedAt        time.Time  `json:"updated_at"`
-		CustomerID       uint       `json:"customer_id"`
-		CustomerName     string     `json:"customer_name"`
-		CustomerEmail    string     `json:"customer_email"`
-		CustomerPhone    string     `json:"customer_phone"`
-		CustomerAddress  string     `json:"customer_address"`
-		ProductID        uint       `json:"product_id"`
-		ProductName      string     `json:"product_name"`
-		SubscriptionID   uint       `json:"subscription_id"`
-		FranchiseID      *uint      `json:"franchise_id"`
-		FranchiseName    string     `json:"franchise_name"`
-		ServiceAgentID   *uint      `json:"service_agent_id"`
-		ServiceAgentName string     `json:"service_agent_name"`
+		ID                  uint       `json:"id"`
+		Type                string     `json:"type"`
+		Status              string     `json:"status"`
+		Description         string     `json:"description"`
+		ScheduledTime       *time.Time `json:"scheduled_time"`
+		CompletionTime      *time.Time `json:"completion_time"`
+		Notes               string     `json:"notes"`
+		Rating              *int       `json:"rating"`
+		Feedback            string     `json:"feedback"`
+		CreatedAt           time.Time  `json:"created_at"`
+		UpdatedAt           time.Time  `json:"updated_at"`
+		CustomerID          uint       `json:"customer_id"`
+		CustomerName        string     `json:"customer_name"`
+		CustomerEmail       string     `json:"customer_email"`
+		CustomerPhone       string     `json:"customer_phone"`
+		CustomerPicture     string     `json:"customer_profile_picture"`
+		CustomerAddress     string     `json:"customer_address"`
+		ProductID           uint       `json:"product_id"`
+		ProductName         string     `json:"product_name"`
+		SubscriptionID      uint       `json:"subscription_id"`
+		FranchiseID         *uint      `json:"franchise_id"`
+		FranchiseName       string     `json:"franchise_name"`
+		ServiceAgentID      *uint      `json:"service_agent_id"`
+		ServiceAgentName    string     `json:"service_agent_name"`
+		ServiceAgentPicture string     `json:"service_agent_profile_picture"`
 	}
 
 	var result ServiceRequestWithDetails
 
-	err = database.DB.Table("service_requests").
+	err = database.DB.WithContext(c.Request.Context()).Table("service_requests").
 		Select(`
                         service_requests.id,
                         service_requests.type,
@@ -337,6 +357,7 @@ func GetServiceRequestByID(c *gin.Context) {
                         customer.name as customer_name,
                         customer.email as customer_email,
                         customer.phone as customer_phone,
+                        customer.profile_picture as customer_profile_picture,
                         customer.address as customer_address,
                         subscriptions.product_id,
                         products.name as product_name,
@@ -344,7 +365,8 @@ func GetServiceRequestByID(c *gin.Context) {
                         franchises.id as franchise_id,
                         franchises.name as franchise_name,
                         service_requests.service_agent_id,
-                        service_agent.name as service_agent_name
+                        service_agent.name as service_agent_name,
+                        service_agent.profile_picture as service_agent_profile_picture
                 `).
 		Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 		Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
@@ -367,16 +389,14 @@ func GetServiceRequestByID(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// AssignServiceRequestToAgent assigns an agent to a service request. Access is
+// controlled by the service_request:assign permission on the route.
 func AssignServiceRequestToAgent(c *gin.Context) {
 	role, exists := c.Get("role")
 	if !exists {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
 		return
 	}
-	if role != "admin" && role != "franchise_owner" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
-		return
-	}
 	fmt.Println("🔥 Received Payload: ", role)
 
 	serviceRequestID := c.Param("id")
@@ -392,24 +412,47 @@ func AssignServiceRequestToAgent(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	fmt.Println("🔥 Received Payload: ", req)
 
 	var serviceRequest database.ServiceRequest
-	if err := database.DB.First(&serviceRequest, serviceRequestIDInt).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&serviceRequest, serviceRequestIDInt).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found"})
 		return
 	}
 
+	// Staff only assign requests of the franchises they work for
+	if role == database.RoleFranchiseStaff {
+		ids, ok := ownerFranchiseIDs(c)
+		if !ok {
+			return
+		}
+		if !slices.Contains(ids, serviceRequest.FranchiseID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found"})
+			return
+		}
+	}
+
+	// Only agents on shift and not on leave for the visit can take it
+	if err := checkAgentAvailableForService(database.DB.WithContext(c.Request.Context()), req.ServiceAgentID, serviceRequest.FranchiseID, serviceRequest.ScheduledTime); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	before := serviceRequest
 	serviceRequest.ServiceAgentID = &req.ServiceAgentID
+	assignedAt := time.Now()
+	serviceRequest.AssignedAt = &assignedAt
+	serviceRequest.AcceptedAt = nil
 
-	if err := database.DB.Save(&serviceRequest).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Save(&serviceRequest).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign service agent"})
 		return
 	}
+	recordAudit(c, nil, "service_request.assign_agent", "service_request", serviceRequest.ID, before, serviceRequest)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Service agent assigned", "service_request": serviceRequest})
 }
@@ -418,7 +461,7 @@ func AssignServiceRequestToAgent(c *gin.Context) {
 func CreateServiceRequest(c *gin.Context) {
 	var request ServiceRequestCreateRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 	fmt.Printf("🔥 Received Payload: %+v\n", request)
@@ -441,7 +484,7 @@ func CreateServiceRequest(c *gin.Context) {
 	fmt.Printf("🔥 Subscription ID: %d\n", request.SubscriptionID)
 	// Check if subscription exists and belongs to the user
 	var subscription database.Subscription
-	err := database.DB.
+	err := database.DB.WithContext(c.Request.Context()).
 		Preload("Franchise").
 		Where("id = ? AND customer_id = ?", request.SubscriptionID, userIDInt).
 		First(&subscription).Error
@@ -466,10 +509,28 @@ func CreateServiceRequest(c *gin.Context) {
 		return
 	}
 
+	// Older subscriptions may predate franchise assignment; route them by the
+	// customer's saved location
+	if subscription.FranchiseID == 0 {
+		franchise, err := assignFranchise(database.DB.WithContext(c.Request.Context()), userIDInt, "")
+		if err == nil {
+			subscription.FranchiseID = franchise.ID
+			subscription.Franchise = franchise
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error matching franchise: %v", err)
+		}
+	}
+
 	fmt.Printf("🔥 Subscription Status: %s\n", subscription.Status)
 
+	parsedTime, err := time.Parse(time.RFC3339, request.ScheduledTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled_time, use a slot start from /api/service-slots"})
+		return
+	}
+
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -478,19 +539,45 @@ func CreateServiceRequest(c *gin.Context) {
 
 	fmt.Printf("🔥 Transaction: %+v\n", tx)
 
-	parsedTime, err := time.Parse(time.RFC3339, request.ScheduledTime)
-	if err != nil {
-		// handle the error appropriately
-		return
+	// Validate the requested slot; locking the franchise row serializes bookings
+	// so two customers can't take the last seat of a slot at the same time
+	if subscription.FranchiseID != 0 {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&database.Franchise{}, subscription.FranchiseID).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error locking franchise: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+
+		slot, err := findServiceSlot(tx, subscription.FranchiseID, parsedTime)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error checking service slot: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if slot == nil || !slot.Start.After(time.Now()) {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Selected time is not an available service slot"})
+			return
+		}
+		if slot.Available <= 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "Selected service slot is fully booked"})
+			return
+		}
 	}
+
 	// Create service request
 	serviceRequest := database.ServiceRequest{
 		CustomerID:     uint(userIDInt),
 		SubscriptionID: uint(request.SubscriptionID),
+		FranchiseID:    subscription.FranchiseID,
 		Type:           request.RequestType,
 		Status:         database.ServiceStatusPending,
 		Description:    request.Description,
 		ScheduledTime:  &parsedTime,
+		SLADueAt:       database.ServiceSLADeadline(request.RequestType, time.Now()),
 	}
 
 	if err := tx.Create(&serviceRequest).Error; err != nil {
@@ -501,45 +588,12 @@ func CreateServiceRequest(c *gin.Context) {
 	}
 
 	fmt.Printf("🔥 Service Request: %+v\n", serviceRequest)
-	// Create notification for customer
-	customerNotification := database.Notification{
-		UserID:      uint(userIDInt),
-		Title:       "Service Request Created",
-		Message:     "Your service request has been created and is pending assignment.",
-		Type:        "service_request",
-		RelatedID:   &serviceRequest.ID,
-		RelatedType: "service_request",
-		IsRead:      false,
-	}
-
-	if err := tx.Create(&customerNotification).Error; err != nil {
+	if err := publishServiceRequestCreated(tx, serviceRequest, subscription.FranchiseID); err != nil {
 		tx.Rollback()
-		log.Printf("Error creating customer notification: %v", err)
+		log.Printf("Error creating service request notifications: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification"})
 		return
 	}
-	fmt.Printf("🔥 Customer Notification: %+v\n", customerNotification)
-
-	// If franchise exists, create notification for franchise owner
-	if subscription.FranchiseID != 0 && subscription.Franchise.OwnerID != 0 {
-		franchiseOwnerNotification := database.Notification{
-			UserID:      subscription.Franchise.OwnerID,
-			Title:       "New Service Request",
-			Message:     "A new service request has been created and needs your attention.",
-			Type:        "service_request",
-			RelatedID:   &serviceRequest.ID,
-			RelatedType: "service_request",
-			IsRead:      false,
-		}
-
-		if err := tx.Create(&franchiseOwnerNotification).Error; err != nil {
-			tx.Rollback()
-			log.Printf("Error creating franchise owner notification: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification"})
-			return
-		}
-		fmt.Printf("🔥 Franchise Owner Notification: %+v\n", franchiseOwnerNotification)
-	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
@@ -566,7 +620,7 @@ func UpdateServiceRequest(c *gin.Context) {
 
 	var updateRequest ServiceRequestUpdateRequest
 	if err := c.ShouldBindJSON(&updateRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -587,17 +641,17 @@ func UpdateServiceRequest(c *gin.Context) {
 	switch role {
 	case database.RoleAdmin:
 		// Admin can update any service request
-		database.DB.Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).Count(&count)
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).Count(&count)
 	case database.RoleFranchiseOwner:
 		// Check if the service request belongs to this franchise owner
-		database.DB.Model(&database.ServiceRequest{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
 			Joins("JOIN franchises ON subscriptions.franchise_id = franchises.id").
 			Where("service_requests.id = ? AND franchises.owner_id = ?", requestIDInt, userIDInt).
 			Count(&count)
 	case database.RoleServiceAgent:
 		// Check if the service request is assigned to this service agent
-		database.DB.Model(&database.ServiceRequest{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Where("id = ? AND service_agent_id = ?", requestIDInt, userIDInt).
 			Count(&count)
 	case database.RoleCustomer:
@@ -608,7 +662,7 @@ func UpdateServiceRequest(c *gin.Context) {
 			return
 		}
 
-		err = database.DB.Where("id = ? AND customer_id = ? AND status = ?",
+		err = database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ? AND status = ?",
 			requestIDInt, userIDInt, database.ServiceStatusPending).First(&serviceRequest).Error
 
 		if err != nil {
@@ -632,7 +686,7 @@ func UpdateServiceRequest(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -685,14 +739,14 @@ func UpdateServiceRequest(c *gin.Context) {
 		var agentCount int64
 		if role == database.RoleFranchiseOwner {
 			// Franchise owners can only assign agents from their franchise
-			err = database.DB.Model(&database.User{}).
+			err = database.DB.WithContext(c.Request.Context()).Model(&database.User{}).
 				Joins("JOIN franchises ON franchises.id = users.franchise_id").
 				Where("users.id = ? AND users.role = ? AND franchises.owner_id = ?",
 					updateRequest.AgentID, database.RoleServiceAgent, userIDInt).
 				Count(&agentCount).Error
 		} else {
 			// Admins can assign any service agent
-			err = database.DB.Model(&database.User{}).
+			err = database.DB.WithContext(c.Request.Context()).Model(&database.User{}).
 				Where("id = ? AND role = ?", updateRequest.AgentID, database.RoleServiceAgent).
 				Count(&agentCount).Error
 		}
@@ -711,10 +765,12 @@ func UpdateServiceRequest(c *gin.Context) {
 		}
 
 		updates["service_agent_id"] = updateRequest.AgentID
+		updates["assigned_at"] = time.Now()
+		updates["accepted_at"] = nil
 
 		// If status is not already assigned or later, set it to assigned
 		var currentStatus string
-		err = database.DB.Model(&database.ServiceRequest{}).
+		err = database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 			Select("status").
 			Where("id = ?", requestIDInt).
 			Pluck("status", &currentStatus).Error
@@ -737,6 +793,15 @@ func UpdateServiceRequest(c *gin.Context) {
 		return
 	}
 
+	var previousStatus string
+	if err := tx.Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).
+		Pluck("status", &previousStatus).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
 	// Perform the update
 	result := tx.Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).Updates(updates)
 	if result.Error != nil {
@@ -755,17 +820,24 @@ func UpdateServiceRequest(c *gin.Context) {
 		return
 	}
 
+	if updatedRequest.Status == database.ServiceStatusCompleted && previousStatus != database.ServiceStatusCompleted {
+		if err := publishServiceRequestCompleted(tx, updatedRequest.ID); err != nil {
+			tx.Rollback()
+			log.Printf("Error queueing service request webhook: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service request"})
+			return
+		}
+	}
+
 	// Create notifications based on changes
 	if updateRequest.Status != "" {
 		statusNotification := database.Notification{
 			UserID:      updatedRequest.CustomerID,
-			Title:       "Service Request Updated",
-			Message:     fmt.Sprintf("Your service request status has been updated to %s.", updateRequest.Status),
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.status_updated", database.Vars{"status": updateRequest.Status})
 
 		if err := tx.Create(&statusNotification).Error; err != nil {
 			tx.Rollback()
@@ -779,13 +851,11 @@ func UpdateServiceRequest(c *gin.Context) {
 		// Notify customer about agent assignment
 		agentNotification := database.Notification{
 			UserID:      updatedRequest.CustomerID,
-			Title:       "Service Agent Assigned",
-			Message:     "A service agent has been assigned to your service request.",
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.agent_assigned", nil)
 
 		if err := tx.Create(&agentNotification).Error; err != nil {
 			tx.Rollback()
@@ -797,13 +867,11 @@ func UpdateServiceRequest(c *gin.Context) {
 		// Notify agent about assignment
 		assignmentNotification := database.Notification{
 			UserID:      updateRequest.AgentID,
-			Title:       "New Service Assignment",
-			Message:     fmt.Sprintf("You have been assigned to service request #%d.", updatedRequest.ID),
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.assignment", database.Vars{"id": updatedRequest.ID})
 
 		if err := tx.Create(&assignmentNotification).Error; err != nil {
 			tx.Rollback()
@@ -817,13 +885,11 @@ func UpdateServiceRequest(c *gin.Context) {
 		// Notify customer about scheduled date
 		scheduleNotification := database.Notification{
 			UserID:      updatedRequest.CustomerID,
-			Title:       "Service Visit Scheduled",
-			Message:     fmt.Sprintf("Your service request has been scheduled for %s.", updateRequest.ScheduledDate),
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.scheduled", database.Vars{"date": updateRequest.ScheduledDate})
 
 		if err := tx.Create(&scheduleNotification).Error; err != nil {
 			tx.Rollback()
@@ -878,7 +944,7 @@ func CancelServiceRequest(c *gin.Context) {
 
 	// Check if service request exists and belongs to the user
 	var serviceRequest database.ServiceRequest
-	err = database.DB.Where("id = ? AND customer_id = ?", requestIDInt, userIDInt).First(&serviceRequest).Error
+	err = database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ?", requestIDInt, userIDInt).First(&serviceRequest).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -899,7 +965,7 @@ func CancelServiceRequest(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -917,13 +983,11 @@ func CancelServiceRequest(c *gin.Context) {
 	// Create notification for customer
 	customerNotification := database.Notification{
 		UserID:      uint(userIDInt),
-		Title:       "Service Request Cancelled",
-		Message:     "Your service request has been cancelled.",
 		Type:        "service_request",
 		RelatedID:   &serviceRequest.ID,
 		RelatedType: "service_request",
 		IsRead:      false,
-	}
+	}.Rendered(tx, "service_request.cancelled", nil)
 
 	if err := tx.Create(&customerNotification).Error; err != nil {
 		tx.Rollback()
@@ -936,13 +1000,11 @@ func CancelServiceRequest(c *gin.Context) {
 	if serviceRequest.ServiceAgentID != nil {
 		agentNotification := database.Notification{
 			UserID:      *serviceRequest.ServiceAgentID,
-			Title:       "Service Request Cancelled",
-			Message:     "A service request assigned to you has been cancelled by the customer.",
 			Type:        "service_request",
 			RelatedID:   &serviceRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.cancelled_agent", nil)
 
 		if err := tx.Create(&agentNotification).Error; err != nil {
 			tx.Rollback()
@@ -975,7 +1037,7 @@ func SubmitServiceFeedback(c *gin.Context) {
 
 	var feedbackRequest FeedbackRequest
 	if err := c.ShouldBindJSON(&feedbackRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -989,7 +1051,7 @@ func SubmitServiceFeedback(c *gin.Context) {
 
 	// Check if service request exists, belongs to the user, and is completed
 	var serviceRequest database.ServiceRequest
-	err = database.DB.Where("id = ? AND customer_id = ? AND status = ?",
+	err = database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ? AND status = ?",
 		requestIDInt, userIDInt, database.ServiceStatusCompleted).First(&serviceRequest).Error
 
 	if err != nil {
@@ -1003,7 +1065,7 @@ func SubmitServiceFeedback(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -1028,13 +1090,11 @@ func SubmitServiceFeedback(c *gin.Context) {
 	if serviceRequest.ServiceAgentID != nil {
 		agentNotification := database.Notification{
 			UserID:      *serviceRequest.ServiceAgentID,
-			Title:       "Service Feedback Received",
-			Message:     fmt.Sprintf("You received a %d-star rating for your service.", rating),
 			Type:        "service_feedback",
 			RelatedID:   &serviceRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.feedback", database.Vars{"rating": rating})
 
 		if err := tx.Create(&agentNotification).Error; err != nil {
 			tx.Rollback()
@@ -1056,7 +1116,8 @@ func SubmitServiceFeedback(c *gin.Context) {
 	})
 }
 
-// GetServiceAgentDashboard returns basic stats for a service agent
+// GetServiceAgentDashboard returns basic stats for a service agent,
+// answering 304 to an If-None-Match naming the current ETag
 func GetServiceAgentDashboard(c *gin.Context) {
 	agentIDVal, exists := c.Get("user_id")
 	if !exists {
@@ -1070,26 +1131,49 @@ func GetServiceAgentDashboard(c *gin.Context) {
 		return
 	}
 
+	etag := versionedETag(c, database.DB.WithContext(c.Request.Context()), []versionSource{
+		{"service_requests", database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).Where("service_agent_id = ?", agentID)},
+		{"service_assignment_responses", database.DB.WithContext(c.Request.Context()).Model(&database.ServiceAssignmentResponse{}).Where("agent_id = ?", agentID)},
+	}, "agent", agentID)
+	if notModified(c, etag) {
+		return
+	}
+
 	var totalTasks int64
 	var completedTasks int64
 	var pendingTasks int64
 
-	database.DB.Model(&database.ServiceRequest{}).
+	database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 		Where("service_agent_id = ?", agentID).
 		Count(&totalTasks)
 
-	database.DB.Model(&database.ServiceRequest{}).
+	database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 		Where("service_agent_id = ? AND status = ?", agentID, database.ServiceStatusCompleted).
 		Count(&completedTasks)
 
-	database.DB.Model(&database.ServiceRequest{}).
+	database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 		Where("service_agent_id = ? AND status = ?", agentID, database.ServiceStatusPending).
 		Count(&pendingTasks)
 
+	// How the agent has answered assignments and how quickly
+	var responses struct {
+		Accepted           int64
+		Declined           int64
+		AvgResponseSeconds float64
+	}
+	database.DB.WithContext(c.Request.Context()).Model(&database.ServiceAssignmentResponse{}).
+		Select("COUNT(*) FILTER (WHERE response = ?) AS accepted, COUNT(*) FILTER (WHERE response = ?) AS declined, "+
+			"COALESCE(AVG(response_seconds), 0) AS avg_response_seconds", database.AssignmentAccepted, database.AssignmentDeclined).
+		Where("agent_id = ?", agentID).
+		Scan(&responses)
+
 	c.JSON(http.StatusOK, gin.H{
-		"total_tasks":     totalTasks,
-		"completed_tasks": completedTasks,
-		"pending_tasks":   pendingTasks,
+		"total_tasks":          totalTasks,
+		"completed_tasks":      completedTasks,
+		"pending_tasks":        pendingTasks,
+		"accepted_tasks":       responses.Accepted,
+		"declined_tasks":       responses.Declined,
+		"avg_response_minutes": responses.AvgResponseSeconds / 60,
 	})
 }
 
@@ -1109,7 +1193,7 @@ func GetAgentTasks(c *gin.Context) {
 
 	var tasks []ServiceRequestWithDetails
 
-	err := database.DB.Table("service_requests").
+	err := database.DB.WithContext(c.Request.Context()).Table("service_requests").
 		Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 		Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
 		Joins("JOIN products ON subscriptions.product_id = products.id").
@@ -1131,13 +1215,17 @@ func GetAgentTasks(c *gin.Context) {
 			customer.name as customer_name,
 			customer.email as customer_email,
 			customer.phone as customer_phone,
+			customer.profile_picture as customer_profile_picture,
 			subscriptions.product_id,
 			products.name as product_name,
 			service_requests.subscription_id,
 			franchises.id as franchise_id,
 			franchises.name as franchise_name,
 			service_requests.service_agent_id,
-			service_agent.name as service_agent_name
+			service_agent.name as service_agent_name,
+			service_agent.profile_picture as service_agent_profile_picture,
+			service_requests.assigned_at,
+			service_requests.accepted_at
 		`).
 		Order("service_requests.created_at DESC").
 		Find(&tasks).Error
@@ -1178,16 +1266,18 @@ func GetAgentOrders(c *gin.Context) {
 		CustomerName    string     `json:"customer_name"`
 		CustomerEmail   string     `json:"customer_email"`
 		CustomerPhone   string     `json:"customer_phone"`
+		CustomerPicture string     `json:"customer_profile_picture"`
 		DeliveryAddress string     `json:"delivery_address"`
 	}
 
 	var orders []OrderWithProduct
 
 	//customeer details alos should be present
-	err := database.DB.Table("orders").
+	err := database.DB.WithContext(c.Request.Context()).Table("orders").
 		Joins("JOIN products ON orders.product_id = products.id").
 		Joins("JOIN users ON orders.customer_id = users.id").
 		Where("orders.service_agent_id = ?", agentID).
+		Where(notDeleted("orders")).
 		Select(`orders.id as id, 
           orders.status, 
           orders.created_at, 
@@ -1197,6 +1287,7 @@ func GetAgentOrders(c *gin.Context) {
           users.name as customer_name,
           users.email as customer_email,
           users.phone as customer_phone,
+          users.profile_picture as customer_profile_picture,
           products.name as product_name, 
           products.image_url as product_image`).
 		Order("orders.created_at DESC").
@@ -6,12 +6,12 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
 	"aquahome/database"
 )
 
@@ -20,30 +20,36 @@ import (
 
 // ServiceRequestWithDetails is a combined structure for fetching service requests with related data
 type ServiceRequestWithDetails struct {
-	ID               uint       `json:"id"`
-	Type             string     `json:"type"`
-	Status           string     `json:"status"`
-	Description      string     `json:"description"`
-	ScheduledTime    *time.Time `json:"scheduled_time"`
-	CompletionTime   *time.Time `json:"completion_time"`
-	Rating           *int       `json:"rating"`
-	Feedback         string     `json:"feedback"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
-	CustomerID       uint       `json:"customer_id"`
-	CustomerName     string     `json:"customer_name"`
-	CustomerEmail    string     `json:"customer_email"`
-	CustomerPhone    string     `json:"customer_phone"`
-	ProductID        uint       `json:"product_id"`
-	ProductName      string     `json:"product_name"`
-	SubscriptionID   uint       `json:"subscription_id"`
-	FranchiseID      *uint      `json:"franchise_id"`
-	FranchiseName    string     `json:"franchise_name"`
-	ServiceAgentID   *uint      `json:"service_agent_id"`
-	ServiceAgentName string     `json:"service_agent_name"`
+	ID                  uint       `json:"id"`
+	Type                string     `json:"type"`
+	Status              string     `json:"status"`
+	Description         string     `json:"description"`
+	ScheduledTime       *time.Time `json:"scheduled_time"`
+	CompletionTime      *time.Time `json:"completion_time"`
+	Rating              *int       `json:"rating"`
+	Feedback            string     `json:"feedback"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	CustomerID          uint       `json:"customer_id"`
+	CustomerName        string     `json:"customer_name"`
+	CustomerEmail       string     `json:"customer_email"`
+	CustomerPhone       string     `json:"customer_phone"`
+	CustomerPicture     string     `json:"customer_profile_picture"`
+	ProductID           uint       `json:"product_id"`
+	ProductName         string     `json:"product_name"`
+	SubscriptionID      uint       `json:"subscription_id"`
+	FranchiseID         *uint      `json:"franchise_id"`
+	FranchiseName       string     `json:"franchise_name"`
+	ServiceAgentID      *uint      `json:"service_agent_id"`
+	ServiceAgentName    string     `json:"service_agent_name"`
+	ServiceAgentPicture string     `json:"service_agent_profile_picture"`
+	AssignedAt          *time.Time `json:"assigned_at,omitempty"`
+	AcceptedAt          *time.Time `json:"accepted_at,omitempty"`
 }
 
-// GetServiceRequests returns service requests based on user role
+// GetServiceRequestsNew returns service requests based on user role,
+// filtered and sorted by the query parameters of filterServiceRequests and
+// sortServiceRequests
 func GetServiceRequestsNew(c *gin.Context) {
 	log.Println("🔍 CONTEXT KEYS:", c.Keys)
 
@@ -74,7 +80,7 @@ func GetServiceRequestsNew(c *gin.Context) {
 	}
 
 	// Define the query to fetch service requests based on role
-	query := database.DB.Model(&database.ServiceRequest{})
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{})
 
 	// Setup common joins
 	query = query.Joins("JOIN users as customer ON service_requests.customer_id = customer.id")
@@ -83,61 +89,17 @@ func GetServiceRequestsNew(c *gin.Context) {
 	query = query.Joins("LEFT JOIN franchises ON subscriptions.franchise_id = franchises.id")
 	query = query.Joins("LEFT JOIN users as service_agent ON service_requests.service_agent_id = service_agent.id")
 
-	var userIDs []uint
 	// Apply role-specific filters
 	switch role {
 	case database.RoleAdmin:
 		// Admin can see all service requests - no additional filters
-	case database.RoleFranchiseOwner:
-		// Franchise owner can see service requests assigned to their franchise
-		fmt.Println("userID is ", userID)
-		var franchise database.Franchise
-		if err := database.DB.Where("owner_id = ?", userID).First(&franchise).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch franchise"})
+	case database.RoleFranchiseOwner, database.RoleFranchiseStaff:
+		// Franchise owner and staff can see service requests of their franchises
+		ids, ok := ownerFranchiseIDs(c)
+		if !ok {
 			return
 		}
-
-		fmt.Println("franchise is ", franchise.ID)
-		var zipCodesArray []string
-		if err := database.DB.Table("franchise_locations").
-			Joins("JOIN locations ON franchise_locations.location_id = locations.id").
-			Where("franchise_locations.franchise_id = ?", franchise.ID).
-			Pluck("locations.zip_codes", &zipCodesArray).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ZIP codes"})
-			return
-		}
-		fmt.Println("zipCodesArray is ", zipCodesArray)
-		var zipCodes []string
-		for _, zipArray := range zipCodesArray {
-			zipArray = strings.Trim(zipArray, "{}")
-			if zipArray == "" {
-				continue
-			}
-			individualZips := strings.Split(zipArray, ",")
-			for _, zip := range individualZips {
-				zip = strings.TrimSpace(zip)
-				if zip != "" {
-					zipCodes = append(zipCodes, zip)
-				}
-			}
-		}
-		fmt.Println("zipCodes is ", zipCodes)
-		var users []database.User
-		if err := database.DB.Where("zip_code IN ?", zipCodes).
-			Where("role = ?", "customer").
-			Find(&users).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
-			return
-		}
-		fmt.Println("users is ", users)
-
-		// Extract user IDs
-
-		for _, u := range users {
-			userIDs = append(userIDs, u.ID)
-		}
-		fmt.Println("userIDs is ", userIDs)
-		// query = query.Where("service_requests.customer_id IN ?", userIDs)
+		query = query.Where("subscriptions.franchise_id IN ?", ids)
 
 	case database.RoleServiceAgent:
 		// Service agent can see service requests assigned to them
@@ -166,17 +128,25 @@ func GetServiceRequestsNew(c *gin.Context) {
                 customer.name as customer_name,
                 customer.email as customer_email,
                 customer.phone as customer_phone,
+                customer.profile_picture as customer_profile_picture,
                 subscriptions.product_id,
                 products.name as product_name,
                 service_requests.subscription_id,
                 franchises.id as franchise_id,
                 franchises.name as franchise_name,
                 service_requests.service_agent_id,
-                service_agent.name as service_agent_name
+                service_agent.name as service_agent_name,
+                service_agent.profile_picture as service_agent_profile_picture
         `)
 
-	// Order by creation date, descending
-	query = query.Order("service_requests.created_at DESC")
+	query, ok = filterServiceRequests(c, query)
+	if !ok {
+		return
+	}
+	query, ok = sortServiceRequests(c, query)
+	if !ok {
+		return
+	}
 
 	// Execute the query
 	var results []ServiceRequestWithDetails
@@ -186,18 +156,6 @@ func GetServiceRequestsNew(c *gin.Context) {
 		return
 	}
 
-	userIDSet := make(map[uint]struct{})
-	for _, id := range userIDs {
-		userIDSet[id] = struct{}{}
-	}
-
-	var filteredResults []ServiceRequestWithDetails
-	for _, item := range results {
-		if _, ok := userIDSet[item.CustomerID]; ok {
-			filteredResults = append(filteredResults, item)
-		}
-	}
-
 	c.JSON(http.StatusOK, results)
 }
 
@@ -238,7 +196,7 @@ func GetServiceRequestByIDNew(c *gin.Context) {
 
 	// Check if the user has permission to view this service request
 	var count int64
-	query := database.DB.Model(&database.ServiceRequest{})
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{})
 
 	switch role {
 	case database.RoleAdmin:
@@ -274,7 +232,7 @@ func GetServiceRequestByIDNew(c *gin.Context) {
 	// Fetch the service request details
 	var result ServiceRequestWithDetails
 
-	detailQuery := database.DB.Model(&database.ServiceRequest{}).
+	detailQuery := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{}).
 		Joins("JOIN users as customer ON service_requests.customer_id = customer.id").
 		Joins("JOIN subscriptions ON service_requests.subscription_id = subscriptions.id").
 		Joins("JOIN products ON subscriptions.product_id = products.id").
@@ -297,6 +255,7 @@ func GetServiceRequestByIDNew(c *gin.Context) {
                         customer.name as customer_name,
                         customer.email as customer_email,
                         customer.phone as customer_phone,
+                        customer.profile_picture as customer_profile_picture,
                         customer.address as customer_address,
                         subscriptions.product_id,
                         products.name as product_name,
@@ -304,7 +263,8 @@ func GetServiceRequestByIDNew(c *gin.Context) {
                         franchises.id as franchise_id,
                         franchises.name as franchise_name,
                         service_requests.service_agent_id,
-                        service_agent.name as service_agent_name
+                        service_agent.name as service_agent_name,
+                        service_agent.profile_picture as service_agent_profile_picture
                 `)
 
 	if err := detailQuery.First(&result).Error; err != nil {
@@ -320,7 +280,7 @@ func GetServiceRequestByIDNew(c *gin.Context) {
 func CreateServiceRequestNew(c *gin.Context) {
 	var request ServiceRequestCreateRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -340,7 +300,7 @@ func CreateServiceRequestNew(c *gin.Context) {
 
 	// Check if subscription exists and belongs to the user
 	var subscription database.Subscription
-	if err := database.DB.
+	if err := database.DB.WithContext(c.Request.Context()).
 		Preload("Franchise").
 		Where("id = ? AND customer_id = ?", request.SubscriptionID, userID).
 		First(&subscription).Error; err != nil {
@@ -360,7 +320,7 @@ func CreateServiceRequestNew(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -374,6 +334,7 @@ func CreateServiceRequestNew(c *gin.Context) {
 		Type:           request.RequestType,
 		Status:         database.ServiceStatusPending,
 		Description:    request.Description,
+		SLADueAt:       database.ServiceSLADeadline(request.RequestType, time.Now()),
 	}
 
 	if err := tx.Create(&serviceRequest).Error; err != nil {
@@ -383,44 +344,13 @@ func CreateServiceRequestNew(c *gin.Context) {
 		return
 	}
 
-	// Create notification for customer
-	customerNotification := database.Notification{
-		UserID:      userID,
-		Title:       "Service Request Created",
-		Message:     "Your service request has been created and is pending assignment.",
-		Type:        "service_request",
-		RelatedID:   &serviceRequest.ID,
-		RelatedType: "service_request",
-		IsRead:      false,
-	}
-
-	if err := tx.Create(&customerNotification).Error; err != nil {
+	if err := publishServiceRequestCreated(tx, serviceRequest, subscription.FranchiseID); err != nil {
 		tx.Rollback()
-		log.Printf("Error creating customer notification: %v", err)
+		log.Printf("Error creating service request notifications: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification"})
 		return
 	}
 
-	// If franchise exists, create notification for franchise owner
-	if subscription.FranchiseID != 0 && subscription.Franchise.OwnerID != 0 {
-		franchiseOwnerNotification := database.Notification{
-			UserID:      subscription.Franchise.OwnerID,
-			Title:       "New Service Request",
-			Message:     "A new service request has been created and needs your attention.",
-			Type:        "service_request",
-			RelatedID:   &serviceRequest.ID,
-			RelatedType: "service_request",
-			IsRead:      false,
-		}
-
-		if err := tx.Create(&franchiseOwnerNotification).Error; err != nil {
-			tx.Rollback()
-			log.Printf("Error creating franchise owner notification: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification"})
-			return
-		}
-	}
-
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		log.Printf("Error committing transaction: %v", err)
@@ -445,7 +375,7 @@ func UpdateServiceRequestNew(c *gin.Context) {
 
 	var updateRequest ServiceRequestUpdateRequest
 	if err := c.ShouldBindJSON(&updateRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -477,7 +407,7 @@ func UpdateServiceRequestNew(c *gin.Context) {
 
 	// Check if the user has permission to update this service request
 	var serviceRequest database.ServiceRequest
-	permissionQuery := database.DB.Model(&database.ServiceRequest{})
+	permissionQuery := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequest{})
 
 	fmt.Println("role is ", role)
 
@@ -507,7 +437,7 @@ func UpdateServiceRequestNew(c *gin.Context) {
 			return
 		}
 
-		if err := database.DB.Where("id = ? AND customer_id = ? AND status = ?",
+		if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ? AND status = ?",
 			requestIDInt, userID, database.ServiceStatusPending).First(&serviceRequest).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusForbidden, gin.H{"error": "You can only cancel pending service requests"})
@@ -539,7 +469,7 @@ func UpdateServiceRequestNew(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -549,6 +479,13 @@ func UpdateServiceRequestNew(c *gin.Context) {
 	// Update service request
 	updates := map[string]interface{}{}
 
+	// Agents complete a visit by submitting a service report
+	if role == database.RoleServiceAgent && updateRequest.Status == database.ServiceStatusCompleted {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Submit a service report via /agent/service-requests/:id/report to complete this request"})
+		return
+	}
+
 	if updateRequest.Status != "" && (role == database.RoleAdmin ||
 		role == database.RoleFranchiseOwner ||
 		role == database.RoleServiceAgent ||
@@ -590,7 +527,7 @@ func UpdateServiceRequestNew(c *gin.Context) {
 	if updateRequest.AgentID != 0 && (role == database.RoleAdmin || role == database.RoleFranchiseOwner) {
 		// Verify agent exists and is a service agent
 		var agentCount int64
-		agentQuery := database.DB.Model(&database.User{})
+		agentQuery := database.DB.WithContext(c.Request.Context()).Model(&database.User{})
 
 		if role == database.RoleFranchiseOwner {
 			// Franchise owners can only assign agents from their franchise
@@ -616,7 +553,27 @@ func UpdateServiceRequestNew(c *gin.Context) {
 			return
 		}
 
+		// The agent must be on shift and not on leave for the visit
+		var current database.ServiceRequest
+		if err := tx.Select("id, franchise_id, scheduled_time").First(&current, requestIDInt).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		scheduled := current.ScheduledTime
+		if rescheduled, ok := updates["scheduled_time"].(time.Time); ok {
+			scheduled = &rescheduled
+		}
+		if err := checkAgentAvailableForService(tx, updateRequest.AgentID, current.FranchiseID, scheduled); err != nil {
+			tx.Rollback()
+			apperror.Respond(c, err)
+			return
+		}
+
 		updates["service_agent_id"] = updateRequest.AgentID
+		updates["assigned_at"] = time.Now()
+		updates["accepted_at"] = nil
 
 		// If status is not already assigned or later, set it to assigned
 		var currentStatus string
@@ -641,6 +598,14 @@ func UpdateServiceRequestNew(c *gin.Context) {
 		return
 	}
 
+	var previous database.ServiceRequest
+	if err := tx.Select("id, status, franchise_id").First(&previous, requestIDInt).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
 	// Perform the update
 	if err := tx.Model(&database.ServiceRequest{}).Where("id = ?", requestIDInt).Updates(updates).Error; err != nil {
 		tx.Rollback()
@@ -649,6 +614,22 @@ func UpdateServiceRequestNew(c *gin.Context) {
 		return
 	}
 
+	// Parts used on the visit come out of the franchise's stock when it is completed
+	if updates["status"] == database.ServiceStatusCompleted && previous.Status != database.ServiceStatusCompleted &&
+		len(updateRequest.PartsUsed) > 0 {
+		if err := consumeServiceParts(tx, previous.FranchiseID, previous.ID, updateRequest.PartsUsed, userID); err != nil {
+			tx.Rollback()
+			var stockErr *stockError
+			if errors.As(err, &stockErr) {
+				c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error()})
+				return
+			}
+			log.Printf("Error updating inventory: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inventory"})
+			return
+		}
+	}
+
 	// Get the updated service request for notifications
 	var updatedRequest database.ServiceRequest
 	if err := tx.Preload("Customer").First(&updatedRequest, requestIDInt).Error; err != nil {
@@ -658,17 +639,24 @@ func UpdateServiceRequestNew(c *gin.Context) {
 		return
 	}
 
+	if updatedRequest.Status == database.ServiceStatusCompleted && previous.Status != database.ServiceStatusCompleted {
+		if err := publishServiceRequestCompleted(tx, updatedRequest.ID); err != nil {
+			tx.Rollback()
+			log.Printf("Error queueing service request webhook: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service request"})
+			return
+		}
+	}
+
 	// Create notifications based on changes
 	if updateRequest.Status != "" {
 		statusNotification := database.Notification{
 			UserID:      updatedRequest.CustomerID,
-			Title:       "Service Request Updated",
-			Message:     fmt.Sprintf("Your service request status has been updated to %s.", updateRequest.Status),
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.status_updated", database.Vars{"status": updateRequest.Status})
 
 		if err := tx.Create(&statusNotification).Error; err != nil {
 			tx.Rollback()
@@ -682,13 +670,11 @@ func UpdateServiceRequestNew(c *gin.Context) {
 		// Notify customer about agent assignment
 		agentNotification := database.Notification{
 			UserID:      updatedRequest.CustomerID,
-			Title:       "Service Agent Assigned",
-			Message:     "A service agent has been assigned to your service request.",
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.agent_assigned", nil)
 
 		if err := tx.Create(&agentNotification).Error; err != nil {
 			tx.Rollback()
@@ -700,13 +686,11 @@ func UpdateServiceRequestNew(c *gin.Context) {
 		// Notify agent about assignment
 		assignmentNotification := database.Notification{
 			UserID:      updateRequest.AgentID,
-			Title:       "New Service Assignment",
-			Message:     fmt.Sprintf("You have been assigned to service request #%d.", updatedRequest.ID),
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.assignment", database.Vars{"id": updatedRequest.ID})
 
 		if err := tx.Create(&assignmentNotification).Error; err != nil {
 			tx.Rollback()
@@ -720,13 +704,11 @@ func UpdateServiceRequestNew(c *gin.Context) {
 		// Notify customer about scheduled date
 		scheduleNotification := database.Notification{
 			UserID:      updatedRequest.CustomerID,
-			Title:       "Service Visit Scheduled",
-			Message:     fmt.Sprintf("Your service request has been scheduled for %s.", updateRequest.ScheduledDate),
 			Type:        "service_request",
 			RelatedID:   &updatedRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.scheduled", database.Vars{"date": updateRequest.ScheduledDate})
 
 		if err := tx.Create(&scheduleNotification).Error; err != nil {
 			tx.Rollback()
@@ -773,7 +755,7 @@ func CancelServiceRequestNew(c *gin.Context) {
 
 	// Check if service request exists and belongs to the user
 	var serviceRequest database.ServiceRequest
-	if err := database.DB.Where("id = ? AND customer_id = ?", requestIDInt, userID).First(&serviceRequest).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ?", requestIDInt, userID).First(&serviceRequest).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found or doesn't belong to you"})
 		} else {
@@ -792,7 +774,7 @@ func CancelServiceRequestNew(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -810,13 +792,11 @@ func CancelServiceRequestNew(c *gin.Context) {
 	// Create notification for customer
 	customerNotification := database.Notification{
 		UserID:      userID,
-		Title:       "Service Request Cancelled",
-		Message:     "Your service request has been cancelled.",
 		Type:        "service_request",
 		RelatedID:   &serviceRequest.ID,
 		RelatedType: "service_request",
 		IsRead:      false,
-	}
+	}.Rendered(tx, "service_request.cancelled", nil)
 
 	if err := tx.Create(&customerNotification).Error; err != nil {
 		tx.Rollback()
@@ -829,13 +809,11 @@ func CancelServiceRequestNew(c *gin.Context) {
 	if serviceRequest.ServiceAgentID != nil {
 		agentNotification := database.Notification{
 			UserID:      *serviceRequest.ServiceAgentID,
-			Title:       "Service Request Cancelled",
-			Message:     "A service request assigned to you has been cancelled by the customer.",
 			Type:        "service_request",
 			RelatedID:   &serviceRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.cancelled_agent", nil)
 
 		if err := tx.Create(&agentNotification).Error; err != nil {
 			tx.Rollback()
@@ -868,7 +846,7 @@ func SubmitServiceFeedbackNew(c *gin.Context) {
 
 	var feedbackRequest FeedbackRequest
 	if err := c.ShouldBindJSON(&feedbackRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -888,7 +866,7 @@ func SubmitServiceFeedbackNew(c *gin.Context) {
 
 	// Check if service request exists, belongs to the user, and is completed
 	var serviceRequest database.ServiceRequest
-	if err := database.DB.Where("id = ? AND customer_id = ? AND status = ?",
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ? AND status = ?",
 		requestIDInt, userID, database.ServiceStatusCompleted).First(&serviceRequest).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found, doesn't belong to you, or is not completed"})
@@ -900,7 +878,7 @@ func SubmitServiceFeedbackNew(c *gin.Context) {
 	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -925,13 +903,11 @@ func SubmitServiceFeedbackNew(c *gin.Context) {
 	if serviceRequest.ServiceAgentID != nil {
 		agentNotification := database.Notification{
 			UserID:      *serviceRequest.ServiceAgentID,
-			Title:       "Service Feedback Received",
-			Message:     fmt.Sprintf("You received a %d-star rating for your service.", rating),
 			Type:        "service_feedback",
 			RelatedID:   &serviceRequest.ID,
 			RelatedType: "service_request",
 			IsRead:      false,
-		}
+		}.Rendered(tx, "service_request.feedback", database.Vars{"rating": rating})
 
 		if err := tx.Create(&agentNotification).Error; err != nil {
 			tx.Rollback()
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/events"
+)
+
+const maxServiceReportPhotos = 5
+
+// ServiceReportRequest is the agent's completion report, sent as multipart
+// form fields alongside optional "photos" files. Parts is a JSON array of
+// {"inventory_item_id", "quantity"}.
+type ServiceReportRequest struct {
+	TDSBefore    *int   `form:"tds_before" json:"tds_before" binding:"required,min=0,max=5000"`
+	TDSAfter     *int   `form:"tds_after" json:"tds_after" binding:"required,min=0,max=5000"`
+	LaborMinutes int    `form:"labor_minutes" json:"labor_minutes" binding:"required,min=1,max=1440"`
+	Notes        string `form:"notes" json:"notes"`
+	Parts        string `form:"parts" json:"parts"`
+}
+
+// errServiceRequestChanged is returned when a request is completed concurrently
+var errServiceRequestChanged = errors.New("service request changed concurrently")
+
+// SubmitServiceReport completes a service request with the agent's report,
+// taking the replaced parts out of franchise stock
+// POST /api/agent/service-requests/:id/report
+func SubmitServiceReport(c *gin.Context) {
+	var req ServiceReportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("tds_before, tds_after and labor_minutes are required"))
+		return
+	}
+	var parts []PartUsage
+	if req.Parts != "" {
+		if err := json.Unmarshal([]byte(req.Parts), &parts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parts must be a JSON array of {inventory_item_id, quantity}"})
+			return
+		}
+		for _, part := range parts {
+			if part.InventoryItemID == 0 || part.Quantity < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Each part needs an inventory_item_id and a quantity of at least 1"})
+				return
+			}
+		}
+	}
+
+	var serviceRequest database.ServiceRequest
+	query := database.DB.WithContext(c.Request.Context()).Preload("Customer").Where("id = ?", c.Param("id"))
+	if c.GetString("role") != database.RoleAdmin {
+		query = query.Where("service_agent_id = ?", c.GetUint("user_id"))
+	}
+	if err := query.First(&serviceRequest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found or not assigned to you"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return
+	}
+	switch serviceRequest.Status {
+	case database.ServiceStatusAssigned, database.ServiceStatusScheduled, database.ServiceStatusInProgress:
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Service request cannot be completed (current: %s)", serviceRequest.Status)})
+		return
+	}
+
+	uploads, ok := saveFieldPhotos(c, "photos", fmt.Sprintf("service-reports/%d", serviceRequest.ID), 0, maxServiceReportPhotos)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	report := database.ServiceReport{
+		ServiceRequestID: serviceRequest.ID,
+		AgentID:          userID,
+		TDSBefore:        *req.TDSBefore,
+		TDSAfter:         *req.TDSAfter,
+		LaborMinutes:     req.LaborMinutes,
+		Notes:            req.Notes,
+	}
+	for _, upload := range uploads {
+		report.Photos = append(report.Photos, database.ServiceReportPhoto{
+			URL:          upload.URL,
+			OriginalName: upload.OriginalName,
+			SizeBytes:    upload.SizeBytes,
+		})
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&database.ServiceRequest{}).
+			Where("id = ? AND status = ?", serviceRequest.ID, serviceRequest.Status).
+			Updates(map[string]interface{}{
+				"status":          database.ServiceStatusCompleted,
+				"completion_time": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errServiceRequestChanged
+		}
+
+		if err := consumeServiceParts(tx, serviceRequest.FranchiseID, serviceRequest.ID, parts, userID); err != nil {
+			return err
+		}
+		for _, part := range parts {
+			var item database.InventoryItem
+			if err := tx.Select("id, name, sku").First(&item, part.InventoryItemID).Error; err != nil {
+				return err
+			}
+			report.Parts = append(report.Parts, database.ServiceReportPart{
+				InventoryItemID: item.ID,
+				Name:            item.Name,
+				SKU:             item.SKU,
+				Quantity:        part.Quantity,
+			})
+		}
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+
+		completed := serviceRequest
+		completed.Status = database.ServiceStatusCompleted
+		completed.CompletionTime = &now
+		return events.Publish(tx, events.Event{
+			Name:        events.ServiceReportSubmitted,
+			EntityType:  "service_request",
+			EntityID:    serviceRequest.ID,
+			CustomerID:  serviceRequest.CustomerID,
+			FranchiseID: serviceRequest.FranchiseID,
+			Vars:        database.Vars{"id": serviceRequest.ID, "tds": report.TDSAfter, "parts": len(report.Parts)},
+			Data:        database.WebhookServiceRequestData(completed),
+		})
+	})
+
+	var stockErr *stockError
+	switch {
+	case err == nil:
+	case errors.Is(err, errServiceRequestChanged):
+		removeFieldPhotos(uploads)
+		c.JSON(http.StatusConflict, gin.H{"error": "Service request was updated by someone else, please refresh"})
+		return
+	case errors.As(err, &stockErr):
+		removeFieldPhotos(uploads)
+		c.JSON(http.StatusConflict, gin.H{"error": stockErr.Error()})
+		return
+	default:
+		removeFieldPhotos(uploads)
+		log.Printf("Failed to save service report for request %d: %v", serviceRequest.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save service report"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// serviceRequestForViewer loads the service request named by :id if the
+// caller may see it: its customer, its agent, the franchise's owner or an admin.
+// It writes the error response and returns false otherwise.
+func serviceRequestForViewer(c *gin.Context) (database.ServiceRequest, bool) {
+	var serviceRequest database.ServiceRequest
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, customer_id, franchise_id, service_agent_id, status").
+		First(&serviceRequest, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found"})
+			return serviceRequest, false
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return serviceRequest, false
+	}
+
+	userID := c.GetUint("user_id")
+	allowed := false
+	switch c.GetString("role") {
+	case database.RoleAdmin:
+		allowed = true
+	case database.RoleFranchiseOwner:
+		var count int64
+		database.DB.WithContext(c.Request.Context()).Model(&database.Franchise{}).
+			Where("id = ? AND owner_id = ?", serviceRequest.FranchiseID, userID).Count(&count)
+		allowed = count > 0
+	case database.RoleServiceAgent:
+		allowed = serviceRequest.ServiceAgentID != nil && *serviceRequest.ServiceAgentID == userID
+	case database.RoleCustomer:
+		allowed = serviceRequest.CustomerID == userID
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service request not found"})
+		return serviceRequest, false
+	}
+	return serviceRequest, true
+}
+
+// GetServiceReport returns the completion report of a service request to its
+// customer, franchise owner, agent and admins
+// GET /api/services/:id/report
+func GetServiceReport(c *gin.Context) {
+	serviceRequest, ok := serviceRequestForViewer(c)
+	if !ok {
+		return
+	}
+
+	var report database.ServiceReport
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Parts").Preload("Photos").
+		Where("service_request_id = ?", serviceRequest.ID).First(&report).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No report has been submitted for this service request"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+)
+
+// serviceRequestSorts maps the ?sort= keys of service request lists to columns
+var serviceRequestSorts = map[string]string{
+	"created_at":     "service_requests.created_at",
+	"updated_at":     "service_requests.updated_at",
+	"scheduled_time": "service_requests.scheduled_time",
+	"completed_at":   "service_requests.completion_time",
+	"rating":         "service_requests.rating",
+	"status":         "service_requests.status",
+	"type":           "service_requests.type",
+}
+
+// filterServiceRequests narrows a service request list by the query
+// parameters status and type (comma separated), franchise_id, agent_id,
+// from/to on creation date, rating and min_rating/max_rating. It writes the
+// error response and returns false on a malformed parameter.
+func filterServiceRequests(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	if status := c.Query("status"); status != "" {
+		query = query.Where("service_requests.status IN ?", strings.Split(status, ","))
+	}
+	if requestType := c.Query("type"); requestType != "" {
+		query = query.Where("service_requests.type IN ?", strings.Split(requestType, ","))
+	}
+
+	idFilters := []struct{ param, column string }{
+		{"franchise_id", "subscriptions.franchise_id"},
+		{"agent_id", "service_requests.service_agent_id"},
+	}
+	for _, f := range idFilters {
+		value := c.Query(f.param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			apperror.Respond(c, apperror.BadRequest("Invalid "+f.param))
+			return nil, false
+		}
+		query = query.Where(f.column+" = ?", id)
+	}
+
+	ratingFilters := []struct{ param, op string }{
+		{"rating", "="},
+		{"min_rating", ">="},
+		{"max_rating", "<="},
+	}
+	for _, f := range ratingFilters {
+		value := c.Query(f.param)
+		if value == "" {
+			continue
+		}
+		rating, err := strconv.Atoi(value)
+		if err != nil || rating < 1 || rating > 5 {
+			apperror.Respond(c, apperror.BadRequest(f.param+" must be between 1 and 5"))
+			return nil, false
+		}
+		query = query.Where("service_requests.rating "+f.op+" ?", rating)
+	}
+
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return nil, false
+	}
+	return dates.apply(query, "service_requests.created_at"), true
+}
+
+// sortServiceRequests orders a service request list by ?sort=, a key of
+// serviceRequestSorts prefixed with - for descending, newest first by
+// default. Ties are broken by id so pages stay stable.
+func sortServiceRequests(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	sortKey := c.DefaultQuery("sort", "-created_at")
+	direction := "ASC"
+	if strings.HasPrefix(sortKey, "-") {
+		sortKey, direction = sortKey[1:], "DESC"
+	}
+
+	column, ok := serviceRequestSorts[sortKey]
+	if !ok {
+		apperror.Respond(c, apperror.BadRequest("Invalid sort "+strconv.Quote(sortKey)))
+		return nil, false
+	}
+	if direction == "DESC" {
+		column += " DESC NULLS LAST"
+	}
+	return query.Order(column).Order("service_requests.id " + direction), true
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// leadTimeSampleSize is the number of recent installations needed before a
+// franchise's own lead time replaces the configured default
+const leadTimeSampleSize = 5
+
+// ServiceabilityResponse tells the storefront whether a pincode can be served
+type ServiceabilityResponse struct {
+	Pincode              string             `json:"pincode"`
+	Serviceable          bool               `json:"serviceable"`
+	FranchiseName        string             `json:"franchise_name,omitempty"`
+	InstallationLeadDays int                `json:"installation_lead_days,omitempty"`
+	Products             []database.Product `json:"products"`
+}
+
+// installationLeadDays estimates how many days a franchise takes from order
+// to installation, from its installations over the last 90 days
+func installationLeadDays(db *gorm.DB, franchiseID uint) (int, error) {
+	var installs []struct {
+		OrderedAt   time.Time
+		InstalledAt time.Time
+	}
+	if err := db.Table("order_status_histories").
+		Select("orders.created_at AS ordered_at, order_status_histories.created_at AS installed_at").
+		Joins("JOIN orders ON orders.id = order_status_histories.order_id").
+		Where("orders.franchise_id = ? AND order_status_histories.to_status = ?", franchiseID, database.OrderStatusInstalled).
+		Where("order_status_histories.created_at >= ?", time.Now().AddDate(0, 0, -90)).
+		Scan(&installs).Error; err != nil {
+		return 0, err
+	}
+	if len(installs) < leadTimeSampleSize {
+		return config.AppConfig.InstallationLeadDays, nil
+	}
+
+	var total time.Duration
+	for _, install := range installs {
+		total += install.InstalledAt.Sub(install.OrderedAt)
+	}
+	days := int(math.Ceil(total.Hours() / 24 / float64(len(installs))))
+	if days < 1 {
+		days = 1
+	}
+	return days, nil
+}
+
+// CheckServiceability reports whether a pincode is served, the expected
+// installation lead time and the products available there (Public)
+func CheckServiceability(c *gin.Context) {
+	pincode := strings.TrimSpace(c.Query("pincode"))
+	if len(pincode) != 6 || !pincodePattern.MatchString(pincode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid 6-digit pincode is required"})
+		return
+	}
+
+	response := ServiceabilityResponse{Pincode: pincode, Products: []database.Product{}}
+	franchise, err := matchFranchise(database.DB.WithContext(c.Request.Context()), 0, 0, pincode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	leadDays, err := installationLeadDays(database.DB.WithContext(c.Request.Context()), franchise.ID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if err := preloadActiveCatalog(database.DB.WithContext(c.Request.Context())).
+		Where("franchise_id = ? AND is_active = ?", franchise.ID, true).
+		Order("monthly_rent").
+		Find(&response.Products).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+
+	response.Serviceable = true
+	response.FranchiseName = franchise.Name
+	response.InstallationLeadDays = leadDays
+	c.JSON(http.StatusOK, response)
+}
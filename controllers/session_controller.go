@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// RefreshRequest carries the refresh token issued at login
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// errRefreshTokenReused is returned when an already rotated refresh token is presented
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// issueSession creates a new session for the user and returns the access and
+// refresh tokens in the login response shape
+func issueSession(c *gin.Context, db *gorm.DB, user database.User) (LoginResponse, error) {
+	refreshToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	session := database.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		ExpiresAt:        time.Now().AddDate(0, 0, config.AppConfig.RefreshTokenDays),
+		LastUsedAt:       time.Now(),
+		IPAddress:        c.ClientIP(),
+		UserAgent:        c.Request.UserAgent(),
+		DeviceName:       deviceName(c),
+		SignedInAt:       time.Now(),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return LoginResponse{}, err
+	}
+
+	return sessionResponse(user, session, refreshToken)
+}
+
+// deviceName reads the device name apps send with X-Device-Name
+func deviceName(c *gin.Context) string {
+	name := strings.TrimSpace(c.GetHeader("X-Device-Name"))
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return name
+}
+
+// sessionResponse signs an access token for the session
+func sessionResponse(user database.User, session database.Session, refreshToken string) (LoginResponse, error) {
+	expiry := time.Now().Add(time.Duration(config.AppConfig.AccessTokenMinutes) * time.Minute)
+	token, err := utils.GenerateSessionJWT(user.ID, user.Email, strings.ToLower(user.Role), session.ID, expiry)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	user.Password = ""
+	user.PasswordHash = ""
+
+	return LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user,
+		Expiry:       expiry.Unix(),
+	}, nil
+}
+
+// rotateSession exchanges a refresh token for a new session. Presenting a token
+// that was already rotated revokes every session of the user, since it means the
+// token was copied.
+func rotateSession(c *gin.Context, refreshToken string) (LoginResponse, error) {
+	var response LoginResponse
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var session database.Session
+		if err := tx.Where("refresh_token_hash = ?", utils.HashToken(refreshToken)).First(&session).Error; err != nil {
+			return err
+		}
+
+		if session.RevokedAt != nil && session.ReplacedByID != nil {
+			return errRefreshTokenReused
+		}
+		if !session.IsActive() {
+			return gorm.ErrRecordNotFound
+		}
+
+		var user database.User
+		if err := tx.First(&user, session.UserID).Error; err != nil {
+			return err
+		}
+
+		newToken, err := utils.GenerateSecureToken(32)
+		if err != nil {
+			return err
+		}
+		next := database.Session{
+			UserID:           user.ID,
+			RefreshTokenHash: utils.HashToken(newToken),
+			ExpiresAt:        time.Now().AddDate(0, 0, config.AppConfig.RefreshTokenDays),
+			LastUsedAt:       time.Now(),
+			IPAddress:        c.ClientIP(),
+			UserAgent:        c.Request.UserAgent(),
+			DeviceName:       session.DeviceName,
+			SignedInAt:       session.SignedInAt,
+		}
+		if name := deviceName(c); name != "" {
+			next.DeviceName = name
+		}
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+
+		// Guard against two concurrent refreshes with the same token
+		now := time.Now()
+		result := tx.Model(&database.Session{}).
+			Where("id = ? AND revoked_at IS NULL", session.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by_id": next.ID, "last_used_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		response, err = sessionResponse(user, next, newToken)
+		return err
+	})
+
+	if errors.Is(err, errRefreshTokenReused) {
+		var session database.Session
+		if database.DB.WithContext(c.Request.Context()).Where("refresh_token_hash = ?", utils.HashToken(refreshToken)).First(&session).Error == nil {
+			revokeUserSessions(database.DB.WithContext(c.Request.Context()), session.UserID)
+			log.Printf("⚠️ Refresh token reuse for user %d, all sessions revoked", session.UserID)
+		}
+	}
+
+	return response, err
+}
+
+// revokeUserSessions revokes every active session of a user
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&database.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Logout revokes the current session and, if given, the session of a refresh token
+func Logout(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.ShouldBindJSON(&request)
+
+	userID := c.GetUint("user_id")
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+
+	sessionID := c.GetUint("session_id")
+	switch {
+	case sessionID != 0 && request.RefreshToken != "":
+		query = query.Where("id = ? OR refresh_token_hash = ?", sessionID, utils.HashToken(request.RefreshToken))
+	case sessionID != 0:
+		query = query.Where("id = ?", sessionID)
+	case request.RefreshToken != "":
+		query = query.Where("refresh_token_hash = ?", utils.HashToken(request.RefreshToken))
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+		return
+	}
+
+	if err := query.Update("revoked_at", time.Now()).Error; err != nil {
+		log.Printf("Error revoking session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// SessionInfo describes a signed-in device
+type SessionInfo struct {
+	ID         uint      `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	SignedInAt time.Time `json:"signed_in_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // the session making this request
+}
+
+// GetMySessions lists the devices signed in to the caller's account
+// GET /api/users/me/sessions
+func GetMySessions(c *gin.Context) {
+	var sessions []database.Session
+	if err := database.DB.WithContext(c.Request.Context()).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.GetUint("user_id"), time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	current := c.GetUint("session_id")
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		signedInAt := session.SignedInAt
+		if signedInAt.IsZero() {
+			signedInAt = session.CreatedAt
+		}
+		infos = append(infos, SessionInfo{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			SignedInAt: signedInAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, infos)
+}
+
+// RevokeMySession signs one of the caller's devices out. Its access token
+// stops working immediately.
+// DELETE /api/users/me/sessions/:id
+func RevokeMySession(c *gin.Context) {
+	result := database.DB.WithContext(c.Request.Context()).Model(&database.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), c.GetUint("user_id")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Error revoking session: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out the device"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Device signed out"})
+}
+
+// RevokeAllMySessions logs the caller out everywhere, or everywhere but this
+// device with ?keep_current=true
+// DELETE /api/users/me/sessions
+func RevokeAllMySessions(c *gin.Context) {
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", c.GetUint("user_id"))
+	if current := c.GetUint("session_id"); current != 0 && c.Query("keep_current") == "true" {
+		query = query.Where("id <> ?", current)
+	}
+
+	result := query.Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Error revoking sessions: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Signed out everywhere", "revoked": result.RowsAffected})
+}
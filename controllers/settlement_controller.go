@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/jobs"
+	"aquahome/ledger"
+)
+
+// GenerateSettlementsRequest recomputes the statements of a completed month
+type GenerateSettlementsRequest struct {
+	Month       string `json:"month" binding:"required"` // YYYY-MM
+	FranchiseID uint   `json:"franchise_id"`             // all approved franchises when omitted
+}
+
+// MarkSettlementPaidRequest records how a settlement was paid out
+type MarkSettlementPaidRequest struct {
+	PaymentReference string `json:"payment_reference" binding:"required"`
+	Notes            string `json:"notes"`
+}
+
+// SettlementDetail is a settlement with the payments it covers and its payout attempts
+type SettlementDetail struct {
+	database.Settlement
+	Payments []database.Payment          `json:"payments"`
+	Payouts  []database.SettlementPayout `json:"payouts"`
+}
+
+// settlementForRequest loads the settlement named by :id, limited to the
+// caller's franchises unless they are an admin
+func settlementForRequest(c *gin.Context) (database.Settlement, bool) {
+	var settlement database.Settlement
+	query, ok := scopeFranchises(c, database.DB.WithContext(c.Request.Context()).Preload("Franchise").Where("settlements.id = ?", c.Param("id")),
+		"settlements.franchise_id")
+	if !ok {
+		return settlement, false
+	}
+	if err := query.First(&settlement).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Settlement not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return settlement, false
+	}
+	return settlement, true
+}
+
+// GetSettlements lists settlement statements across franchises (Admin only)
+func GetSettlements(c *gin.Context) {
+	query := database.DB.WithContext(c.Request.Context()).Preload("Franchise")
+	if franchiseID := c.Query("franchise_id"); franchiseID != "" {
+		query = query.Where("franchise_id = ?", franchiseID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if month := c.Query("month"); month != "" {
+		periodStart, err := time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be YYYY-MM"})
+			return
+		}
+		query = query.Where("period_start = ?", periodStart)
+	}
+
+	var settlements []database.Settlement
+	if err := query.Order("period_start DESC, franchise_id").Find(&settlements).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settlements"})
+		return
+	}
+	c.JSON(http.StatusOK, settlements)
+}
+
+// GenerateSettlements computes or refreshes the pending statements of a
+// completed month, e.g. after refunds (Admin only)
+func GenerateSettlements(c *gin.Context) {
+	var req GenerateSettlementsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	periodStart, err := time.ParseInLocation("2006-01", req.Month, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "month must be YYYY-MM"})
+		return
+	}
+	if !periodStart.Before(jobs.MonthStart(time.Now())) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Settlements can only be generated for completed months"})
+		return
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Where("approval_state = ?", "approved")
+	if req.FranchiseID != 0 {
+		query = query.Where("id = ?", req.FranchiseID)
+	}
+	var franchises []database.Franchise
+	if err := query.Find(&franchises).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if req.FranchiseID != 0 && len(franchises) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		return
+	}
+
+	settlements := []database.Settlement{}
+	skipped := []uint{}
+	for _, franchise := range franchises {
+		var settlement database.Settlement
+		err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+			var err error
+			settlement, err = jobs.GenerateSettlement(tx, franchise, periodStart)
+			return err
+		})
+		if errors.Is(err, jobs.ErrSettlementLocked) {
+			skipped = append(skipped, settlement.ID)
+			continue
+		}
+		if err != nil {
+			log.Printf("Settlement failed for franchise %d: %v", franchise.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate settlements"})
+			return
+		}
+		settlements = append(settlements, settlement)
+	}
+
+	recordAudit(c, nil, "settlement.generate", "settlement", 0, nil, gin.H{"month": req.Month, "franchise_id": req.FranchiseID})
+	c.JSON(http.StatusOK, gin.H{"settlements": settlements, "skipped_locked": skipped})
+}
+
+// MarkSettlementPaid records a franchise's share paid outside RazorpayX (Admin only)
+func MarkSettlementPaid(c *gin.Context) {
+	settlement, ok := settlementForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req MarkSettlementPaidRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	before := settlement
+	now := time.Now()
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Settlement{}).
+			Where("id = ? AND status IN ?", settlement.ID, []string{
+				database.SettlementStatusPending, database.SettlementStatusApproved, database.SettlementStatusFailed,
+			}).
+			Updates(map[string]interface{}{
+				"status":            database.SettlementStatusPaid,
+				"paid_at":           now,
+				"payment_reference": req.PaymentReference,
+				"notes":             req.Notes,
+				"next_payout_at":    nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.Conflict("Settlement has already been paid or a payout is in progress")
+		}
+		settlement.Status = database.SettlementStatusPaid
+		settlement.PaidAt = &now
+		settlement.PaymentReference = req.PaymentReference
+		settlement.Notes = req.Notes
+		return ledger.PostSettlementPaid(tx, settlement)
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if settlement.Franchise.OwnerID != 0 {
+		notification := database.Notification{
+			UserID:      settlement.Franchise.OwnerID,
+			Type:        "settlement",
+			RelatedID:   &settlement.ID,
+			RelatedType: "settlement",
+		}.Rendered(database.DB.WithContext(c.Request.Context()), "settlement.paid", database.Vars{
+			"amount":    settlement.FranchiseShare,
+			"period":    settlement.PeriodStart.Format("January 2006"),
+			"reference": req.PaymentReference,
+		})
+		if err := database.DB.WithContext(c.Request.Context()).Create(&notification).Error; err != nil {
+			log.Printf("Error notifying franchise owner: %v", err)
+		}
+	}
+
+	recordAudit(c, nil, "settlement.mark_paid", "settlement", settlement.ID, before, settlement)
+	c.JSON(http.StatusOK, settlement)
+}
+
+// GetFranchiseSettlements lists a franchise's monthly statements
+func GetFranchiseSettlements(c *gin.Context) {
+	franchise, ok := franchiseForRequest(c)
+	if !ok {
+		return
+	}
+
+	var settlements []database.Settlement
+	if err := database.DB.WithContext(c.Request.Context()).Where("franchise_id = ?", franchise.ID).
+		Order("period_start DESC").Find(&settlements).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settlements"})
+		return
+	}
+	c.JSON(http.StatusOK, settlements)
+}
+
+// GetSettlement returns a statement with the payments it covers
+func GetSettlement(c *gin.Context) {
+	settlement, ok := settlementForRequest(c)
+	if !ok {
+		return
+	}
+
+	detail := SettlementDetail{Settlement: settlement, Payments: []database.Payment{}, Payouts: []database.SettlementPayout{}}
+	if err := jobs.FranchisePayments(database.DB.WithContext(c.Request.Context()).Model(&database.Payment{}), settlement.FranchiseID, settlement.PeriodStart, settlement.PeriodEnd).
+		Order("payments.created_at").
+		Find(&detail.Payments).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settlement payments"})
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Where("settlement_id = ?", settlement.ID).Order("id").Find(&detail.Payouts).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settlement payouts"})
+		return
+	}
+	c.JSON(http.StatusOK, detail)
+}
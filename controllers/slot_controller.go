@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// Defaults used for franchises that have not configured their working hours
+const (
+	defaultOpenTime    = "09:00"
+	defaultCloseTime   = "18:00"
+	defaultSlotMinutes = 120
+	defaultSlotCap     = 2
+)
+
+// ServiceSlot is a bookable window for a service visit
+type ServiceSlot struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Available int       `json:"available"`
+}
+
+// WorkingHoursRequest contains the weekly schedule of a franchise
+type WorkingHoursRequest struct {
+	Hours []struct {
+		Weekday     int    `json:"weekday" binding:"min=0,max=6"`
+		OpenTime    string `json:"open_time"`
+		CloseTime   string `json:"close_time"`
+		SlotMinutes int    `json:"slot_minutes"`
+		Capacity    int    `json:"capacity"`
+		IsClosed    bool   `json:"is_closed"`
+	} `json:"hours" binding:"required,dive"`
+}
+
+// GetServiceSlots returns the bookable service slots of a franchise for a date
+// GET /api/service-slots?date=2006-01-02&franchise_id=1
+func GetServiceSlots(c *gin.Context) {
+	franchiseID, err := strconv.ParseUint(c.Query("franchise_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid franchise_id is required"})
+		return
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", c.Query("date"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Valid date (YYYY-MM-DD) is required"})
+		return
+	}
+
+	slots, err := buildServiceSlots(database.DB.WithContext(c.Request.Context()), uint(franchiseID), date)
+	if err != nil {
+		log.Printf("Error building service slots: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load service slots"})
+		return
+	}
+
+	// Slots that already started can't be booked
+	now := time.Now()
+	upcoming := []ServiceSlot{}
+	for _, slot := range slots {
+		if slot.Start.After(now) {
+			upcoming = append(upcoming, slot)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"franchise_id": franchiseID,
+		"date":         date.Format("2006-01-02"),
+		"slots":        upcoming,
+	})
+}
+
+// GetFranchiseWorkingHours returns the weekly schedule of a franchise
+func GetFranchiseWorkingHours(c *gin.Context) {
+	franchise, ok := loadManagedFranchise(c)
+	if !ok {
+		return
+	}
+
+	var hours []database.FranchiseWorkingHours
+	if err := database.DB.WithContext(c.Request.Context()).Where("franchise_id = ?", franchise.ID).Order("weekday").Find(&hours).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch working hours"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hours)
+}
+
+// UpdateFranchiseWorkingHours replaces the weekly schedule of a franchise
+func UpdateFranchiseWorkingHours(c *gin.Context) {
+	franchise, ok := loadManagedFranchise(c)
+	if !ok {
+		return
+	}
+
+	var request WorkingHoursRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	seen := map[int]bool{}
+	var hours []database.FranchiseWorkingHours
+	for _, h := range request.Hours {
+		if seen[h.Weekday] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Weekday %d is listed more than once", h.Weekday)})
+			return
+		}
+		seen[h.Weekday] = true
+
+		entry := database.FranchiseWorkingHours{
+			FranchiseID: franchise.ID,
+			Weekday:     h.Weekday,
+			IsClosed:    h.IsClosed,
+		}
+
+		if !h.IsClosed {
+			open, errOpen := time.Parse("15:04", h.OpenTime)
+			closeAt, errClose := time.Parse("15:04", h.CloseTime)
+			if errOpen != nil || errClose != nil || !closeAt.After(open) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid open/close time for weekday %d", h.Weekday)})
+				return
+			}
+			if h.SlotMinutes < 15 || h.Capacity < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Slot length must be at least 15 minutes and capacity at least 1 for weekday %d", h.Weekday)})
+				return
+			}
+			entry.OpenTime = h.OpenTime
+			entry.CloseTime = h.CloseTime
+			entry.SlotMinutes = h.SlotMinutes
+			entry.Capacity = h.Capacity
+		}
+
+		hours = append(hours, entry)
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("franchise_id = ?", franchise.ID).
+			Delete(&database.FranchiseWorkingHours{}).Error; err != nil {
+			return err
+		}
+		if len(hours) == 0 {
+			return nil
+		}
+		return tx.Create(&hours).Error
+	})
+	if err != nil {
+		log.Printf("Error saving working hours: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save working hours"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hours)
+}
+
+// loadManagedFranchise loads the :id franchise and checks the caller may manage it.
+// It writes the error response and returns false on failure.
+func loadManagedFranchise(c *gin.Context) (database.Franchise, bool) {
+	var franchise database.Franchise
+
+	franchiseID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid franchise ID"})
+		return franchise, false
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).First(&franchise, franchiseID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return franchise, false
+	}
+
+	role := c.GetString("role")
+	if role != database.RoleAdmin && !(role == database.RoleFranchiseOwner && franchise.OwnerID == c.GetUint("user_id")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to manage this franchise"})
+		return franchise, false
+	}
+
+	return franchise, true
+}
+
+// buildServiceSlots computes all slots of a franchise on the given day with
+// their bookings. A slot takes no more visits than there are agents on shift
+// and not on leave for all of it.
+func buildServiceSlots(db *gorm.DB, franchiseID uint, date time.Time) ([]ServiceSlot, error) {
+	hours, err := workingHoursFor(db, franchiseID, date.Weekday())
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []ServiceSlot{}
+	if hours.IsClosed {
+		return slots, nil
+	}
+
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	open, err := clockOn(dayStart, hours.OpenTime)
+	if err != nil {
+		return nil, err
+	}
+	closeAt, err := clockOn(dayStart, hours.CloseTime)
+	if err != nil {
+		return nil, err
+	}
+
+	var booked []time.Time
+	if err := db.Model(&database.ServiceRequest{}).
+		Where("franchise_id = ? AND scheduled_time >= ? AND scheduled_time < ? AND status <> ?",
+			franchiseID, open, closeAt, database.ServiceStatusCancelled).
+		Pluck("scheduled_time", &booked).Error; err != nil {
+		return nil, err
+	}
+
+	agents, err := franchiseAgentSchedules(db, franchiseID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+
+	length := time.Duration(hours.SlotMinutes) * time.Minute
+	for start := open; !start.Add(length).After(closeAt); start = start.Add(length) {
+		slot := ServiceSlot{Start: start, End: start.Add(length), Capacity: hours.Capacity}
+		if agents != nil {
+			onShift := 0
+			for _, agent := range agents {
+				if agent.unavailableReason(slot.Start, slot.End) == "" {
+					onShift++
+				}
+			}
+			slot.Capacity = min(slot.Capacity, onShift)
+		}
+		for _, t := range booked {
+			if !t.Before(slot.Start) && t.Before(slot.End) {
+				slot.Booked++
+			}
+		}
+		slot.Available = slot.Capacity - slot.Booked
+		if slot.Available < 0 {
+			slot.Available = 0
+		}
+		slots = append(slots, slot)
+	}
+
+	return slots, nil
+}
+
+// findServiceSlot returns the slot that starts exactly at the given time, or nil
+func findServiceSlot(db *gorm.DB, franchiseID uint, start time.Time) (*ServiceSlot, error) {
+	local := start.In(time.Local)
+	slots, err := buildServiceSlots(db, franchiseID, local)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range slots {
+		if slots[i].Start.Equal(start) {
+			return &slots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// workingHoursFor returns the configured hours for a weekday, falling back to
+// Monday-Saturday business hours when the franchise has no schedule yet
+func workingHoursFor(db *gorm.DB, franchiseID uint, weekday time.Weekday) (database.FranchiseWorkingHours, error) {
+	var hours database.FranchiseWorkingHours
+
+	var configured int64
+	if err := db.Model(&database.FranchiseWorkingHours{}).Where("franchise_id = ?", franchiseID).Count(&configured).Error; err != nil {
+		return hours, err
+	}
+
+	if configured == 0 {
+		return database.FranchiseWorkingHours{
+			FranchiseID: franchiseID,
+			Weekday:     int(weekday),
+			OpenTime:    defaultOpenTime,
+			CloseTime:   defaultCloseTime,
+			SlotMinutes: defaultSlotMinutes,
+			Capacity:    defaultSlotCap,
+			IsClosed:    weekday == time.Sunday,
+		}, nil
+	}
+
+	err := db.Where("franchise_id = ? AND weekday = ?", franchiseID, int(weekday)).First(&hours).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Days missing from a configured schedule are days off
+		return database.FranchiseWorkingHours{FranchiseID: franchiseID, Weekday: int(weekday), IsClosed: true}, nil
+	}
+	return hours, err
+}
+
+// clockOn combines a "15:04" clock time with the given day
+func clockOn(day time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// includeDeleted returns the query unscoped when an admin passes ?include_deleted=true
+func includeDeleted(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if wantsDeleted(c) {
+		return query.Unscoped()
+	}
+	return query
+}
+
+// wantsDeleted reports whether an admin asked to see soft-deleted rows
+func wantsDeleted(c *gin.Context) bool {
+	return c.GetString("role") == database.RoleAdmin && c.Query("include_deleted") == "true"
+}
+
+// notDeleted is the soft-delete filter for Table() queries, which bypass GORM's model scopes
+func notDeleted(table string) string {
+	return table + ".deleted_at IS NULL"
+}
+
+// AdminDeleteUser soft deletes a user (Admin only)
+func AdminDeleteUser(c *gin.Context) {
+	if id, _ := strconv.ParseUint(c.Param("id"), 10, 64); uint(id) == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't delete your own account"})
+		return
+	}
+	softDeleteRecord(c, &database.User{}, "user")
+}
+
+// AdminDeleteFranchise soft deletes a franchise (Admin only)
+func AdminDeleteFranchise(c *gin.Context) {
+	softDeleteRecord(c, &database.Franchise{}, "franchise")
+}
+
+// AdminDeleteOrder soft deletes an order (Admin only)
+func AdminDeleteOrder(c *gin.Context) {
+	softDeleteRecord(c, &database.Order{}, "order")
+}
+
+// RestoreUser restores a soft-deleted user (Admin only)
+func RestoreUser(c *gin.Context) {
+	// Sign-up only checks live users, so the email or phone may have been
+	// taken since; two live accounts would leave login picking either
+	var deleted database.User
+	err := database.DB.WithContext(c.Request.Context()).Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).First(&deleted).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No deleted record found with this ID"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring user %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		return
+	}
+
+	var count int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.User{}).
+		Where("LOWER(email) = LOWER(?) OR (phone <> '' AND phone = ?)", deleted.Email, deleted.Phone).
+		Count(&count).Error; err != nil {
+		log.Printf("Error restoring user %d: %v", deleted.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another account now uses this user's email or phone"})
+		return
+	}
+
+	restoreRecord(c, &database.User{}, "user")
+}
+
+// RestoreProduct restores a soft-deleted product (Admin only)
+func RestoreProduct(c *gin.Context) {
+	restoreRecord(c, &database.Product{}, "product")
+}
+
+// RestoreFranchise restores a soft-deleted franchise (Admin only)
+func RestoreFranchise(c *gin.Context) {
+	restoreRecord(c, &database.Franchise{}, "franchise")
+}
+
+// RestoreOrder restores a soft-deleted order (Admin only)
+func RestoreOrder(c *gin.Context) {
+	restoreRecord(c, &database.Order{}, "order")
+}
+
+// softDeleteRecord sets deleted_at on the :id row of model
+func softDeleteRecord(c *gin.Context, model interface{}, entityType string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + entityType + " ID"})
+		return
+	}
+
+	result := database.DB.WithContext(c.Request.Context()).Delete(model, id)
+	if result.Error != nil {
+		log.Printf("Error deleting %s %d: %v", entityType, id, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete " + entityType})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	recordAudit(c, nil, entityType+".delete", entityType, uint(id), gin.H{"deleted": false}, gin.H{"deleted": true})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Deleted successfully", "id": id})
+}
+
+// restoreRecord clears deleted_at on the :id row of model
+func restoreRecord(c *gin.Context, model interface{}, entityType string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + entityType + " ID"})
+		return
+	}
+
+	result := database.DB.WithContext(c.Request.Context()).Unscoped().Model(model).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		log.Printf("Error restoring %s %d: %v", entityType, id, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore " + entityType})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No deleted record found with this ID"})
+		return
+	}
+	recordAudit(c, nil, entityType+".restore", entityType, uint(id), gin.H{"deleted": true}, gin.H{"deleted": false})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Restored successfully", "id": id})
+}
@@ -11,7 +11,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
 	"aquahome/database"
+	"aquahome/jobs"
 )
 
 // SubscriptionWithProduct represents a subscription with product details
@@ -114,7 +116,7 @@ func GetAllSubscriptions(c *gin.Context) {
 	var subscriptions []SubscriptionWithProduct
 
 	// Use GORM to fetch subscriptions with related product information
-	err := database.DB.Table("subscriptions").
+	err := database.DB.WithContext(c.Request.Context()).Table("subscriptions").
 		Select(`
                         subscriptions.id, 
                         subscriptions.order_id, 
@@ -190,7 +192,7 @@ func GetMySubscriptions(c *gin.Context) {
 	var subscriptions []SubscriptionWithProduct
 
 	// Use GORM to fetch subscriptions with related product information
-	err := database.DB.Table("subscriptions").
+	err := database.DB.WithContext(c.Request.Context()).Table("subscriptions").
 		Select(`
                         subscriptions.id, 
                         subscriptions.order_id, 
@@ -268,21 +270,21 @@ func GetSubscriptionDetails(c *gin.Context) {
 	switch role {
 	case database.RoleAdmin:
 		// Admin can view any subscription
-		database.DB.Model(&database.Subscription{}).Where("id = ?", subscriptionIDUint).Count(&count)
+		database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).Where("id = ?", subscriptionIDUint).Count(&count)
 	case database.RoleFranchiseOwner:
 		// Check if subscription belongs to this franchise owner
-		database.DB.Model(&database.Subscription{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).
 			Joins("JOIN franchises ON subscriptions.franchise_id = franchises.id").
 			Where("subscriptions.id = ? AND franchises.owner_id = ?", subscriptionIDUint, userIDUint).
 			Count(&count)
 	case database.RoleServiceAgent:
 		// Service agents can view subscriptions they're assigned to
-		database.DB.Model(&database.Subscription{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).
 			Where("id = ? AND service_agent_id = ?", subscriptionIDUint, userIDUint).
 			Count(&count)
 	case database.RoleCustomer:
 		// Customer can only view their own subscriptions
-		database.DB.Model(&database.Subscription{}).
+		database.DB.WithContext(c.Request.Context()).Model(&database.Subscription{}).
 			Where("id = ? AND customer_id = ?", subscriptionIDUint, userIDUint).
 			Count(&count)
 	default:
@@ -298,7 +300,7 @@ func GetSubscriptionDetails(c *gin.Context) {
 	// Fetch detailed subscription information
 	var subscriptionDetail SubscriptionDetail
 
-	err = database.DB.Table("subscriptions").
+	err = database.DB.WithContext(c.Request.Context()).Table("subscriptions").
 		Select(`
                         subscriptions.id, 
                         subscriptions.order_id, 
@@ -359,7 +361,7 @@ func GetSubscriptionDetails(c *gin.Context) {
 
 	// Fetch service history
 	var serviceHistory []ServiceHistory
-	err = database.DB.Table("service_requests").
+	err = database.DB.WithContext(c.Request.Context()).Table("service_requests").
 		Select(`
                         service_requests.id, 
                         service_requests.scheduled_time as date, 
@@ -382,7 +384,7 @@ func GetSubscriptionDetails(c *gin.Context) {
 
 	// Fetch payment history
 	var paymentHistory []PaymentHistory
-	err = database.DB.Table("payments").
+	err = database.DB.WithContext(c.Request.Context()).Table("payments").
 		Select(`
                         payments.id, 
                         payments.created_at as date, 
@@ -404,7 +406,7 @@ func GetSubscriptionDetails(c *gin.Context) {
 
 	// Calculate pending payment amount if any
 	var pendingPayment float64
-	err = database.DB.Table("payments").
+	err = database.DB.WithContext(c.Request.Context()).Table("payments").
 		Select("COALESCE(SUM(amount), 0)").
 		Where("subscription_id = ? AND status = ?", subscriptionIDUint, database.PaymentStatusPending).
 		Row().Scan(&pendingPayment)
@@ -417,7 +419,7 @@ func GetSubscriptionDetails(c *gin.Context) {
 
 	// Get last payment date
 	var lastPaymentDate time.Time
-	err = database.DB.Table("payments").
+	err = database.DB.WithContext(c.Request.Context()).Table("payments").
 		Select("created_at").
 		Where("subscription_id = ? AND status = ?", subscriptionIDUint, database.PaymentStatusSuccess).
 		Order("created_at DESC").
@@ -441,22 +443,8 @@ func GetFranchiseSubscriptions(c *gin.Context) {
 		return
 	}
 
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		log.Println("user_id not found in context")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID missing"})
-		return
-	}
-
-	userID, ok := userIDVal.(uint)
-	if !ok {
-		log.Println("user_id is not of type uint")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
-		return
-	}
-
 	var subscriptions []SubscriptionWithProduct
-	query := database.DB.Table("subscriptions").
+	query := database.DB.WithContext(c.Request.Context()).Table("subscriptions").
 		Select(`
                         subscriptions.id, 
                         subscriptions.order_id, 
@@ -480,11 +468,10 @@ func GetFranchiseSubscriptions(c *gin.Context) {
 		Joins("JOIN products ON subscriptions.product_id = products.id").
 		Joins("JOIN users ON subscriptions.customer_id = users.id")
 
-	if role == database.RoleFranchiseOwner {
-		// Franchise owner can only see subscriptions for their franchise
-		query = query.Joins("JOIN franchises ON subscriptions.franchise_id = franchises.id").
-			Where("franchises.owner_id = ?", userID)
-
+	// Franchise owners only see subscriptions of their franchises
+	query, ok := scopeFranchises(c, query, "subscriptions.franchise_id")
+	if !ok {
+		return
 	}
 
 	err := query.
@@ -530,7 +517,7 @@ func UpdateSubscription(c *gin.Context) {
 
 	var updateRequest SubscriptionUpdateRequest
 	if err := c.ShouldBindJSON(&updateRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -551,16 +538,16 @@ func UpdateSubscription(c *gin.Context) {
 	switch role {
 	case database.RoleAdmin:
 		// Admin can update any subscription
-		findErr = database.DB.First(&subscription, subscriptionIDUint).Error
+		findErr = database.DB.WithContext(c.Request.Context()).First(&subscription, subscriptionIDUint).Error
 	case database.RoleFranchiseOwner:
 		// Check if subscription belongs to this franchise owner
-		findErr = database.DB.
+		findErr = database.DB.WithContext(c.Request.Context()).
 			Joins("JOIN franchises ON subscriptions.franchise_id = franchises.id").
 			Where("subscriptions.id = ? AND franchises.owner_id = ?", subscriptionIDUint, userIDUint).
 			First(&subscription).Error
 	case database.RoleCustomer:
 		// Customer can only update their own subscription and only certain fields
-		findErr = database.DB.
+		findErr = database.DB.WithContext(c.Request.Context()).
 			Where("id = ? AND customer_id = ?", subscriptionIDUint, userIDUint).
 			First(&subscription).Error
 	default:
@@ -577,9 +564,13 @@ func UpdateSubscription(c *gin.Context) {
 		}
 		return
 	}
+	if err := checkNoOpenDispute(database.DB.WithContext(c.Request.Context()), subscription.ID, subscription.OrderID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -642,26 +633,22 @@ func UpdateSubscription(c *gin.Context) {
 
 	// Create notification for customer
 	if subscription.CustomerID != 0 {
-		var message string
-		if updateRequest.Status != "" {
-			message = "Your subscription status has been updated to " + updateRequest.Status
-		} else if updateRequest.AutoRenew != nil {
+		event := "subscription.status_updated"
+		if updateRequest.Status == "" && updateRequest.AutoRenew != nil {
 			if *updateRequest.AutoRenew {
-				message = "Auto-renewal has been enabled for your subscription"
+				event = "subscription.auto_renew_enabled"
 			} else {
-				message = "Auto-renewal has been disabled for your subscription"
+				event = "subscription.auto_renew_disabled"
 			}
 		}
 
 		notification := database.Notification{
 			UserID:      subscription.CustomerID,
-			Title:       "Subscription Updated",
-			Message:     message,
 			Type:        "subscription",
 			RelatedID:   &subscription.ID,
 			RelatedType: "subscription",
 			IsRead:      false,
-		}
+		}.Rendered(tx, event, database.Vars{"status": updateRequest.Status})
 
 		if err := tx.Create(&notification).Error; err != nil {
 			tx.Rollback()
@@ -692,17 +679,11 @@ func CancelSubscription(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetString("user_id")
-	userIDUint, err := strconv.ParseUint(userID, 10, 64)
-	if err != nil {
-		log.Printf("Invalid user ID: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
+	userIDUint := c.GetUint("user_id")
 
 	// Check if subscription exists and belongs to the user
 	var subscription database.Subscription
-	err = database.DB.Where("id = ? AND customer_id = ?", subscriptionIDUint, userIDUint).First(&subscription).Error
+	err = database.DB.WithContext(c.Request.Context()).Where("id = ? AND customer_id = ?", subscriptionIDUint, userIDUint).First(&subscription).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -713,9 +694,13 @@ func CancelSubscription(c *gin.Context) {
 		}
 		return
 	}
+	if err := checkNoOpenDispute(database.DB.WithContext(c.Request.Context()), subscription.ID, subscription.OrderID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
 
 	// Begin transaction
-	tx := database.DB.Begin()
+	tx := database.DB.WithContext(c.Request.Context()).Begin()
 	if tx.Error != nil {
 		log.Printf("Transaction error: %v", tx.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -730,16 +715,22 @@ func CancelSubscription(c *gin.Context) {
 		return
 	}
 
+	// Start the device pickup and deposit refund
+	if err := jobs.OpenDepositSettlement(tx, subscription); err != nil {
+		tx.Rollback()
+		log.Printf("Error opening deposit settlement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+		return
+	}
+
 	// Create notification for customer
 	customerNotification := database.Notification{
 		UserID:      uint(userIDUint),
-		Title:       "Subscription Cancelled",
-		Message:     "Your subscription has been cancelled.",
 		Type:        "subscription",
 		RelatedID:   &subscription.ID,
 		RelatedType: "subscription",
 		IsRead:      false,
-	}
+	}.Rendered(tx, "subscription.cancelled", nil)
 
 	if err := tx.Create(&customerNotification).Error; err != nil {
 		tx.Rollback()
@@ -755,13 +746,11 @@ func CancelSubscription(c *gin.Context) {
 		if err := tx.First(&franchise, subscription.FranchiseID).Error; err == nil && franchise.OwnerID != 0 {
 			franchiseNotification := database.Notification{
 				UserID:      franchise.OwnerID,
-				Title:       "Subscription Cancelled",
-				Message:     "A customer has cancelled their subscription.",
 				Type:        "subscription",
 				RelatedID:   &subscription.ID,
 				RelatedType: "subscription",
 				IsRead:      false,
-			}
+			}.Rendered(tx, "subscription.cancelled_franchise", nil)
 
 			if err := tx.Create(&franchiseNotification).Error; err != nil {
 				tx.Rollback()
@@ -794,12 +783,12 @@ func CreateSubscription(c *gin.Context) {
 
 	var subscription database.Subscription
 	if err := c.ShouldBindJSON(&subscription); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	subscription.CustomerID = userID.(uint)
-	if err := database.DB.Create(&subscription).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Create(&subscription).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
 		return
 	}
@@ -816,7 +805,7 @@ func DeleteSubscription(c *gin.Context) {
 	}
 
 	subscriptionID := c.Param("id")
-	if err := database.DB.Delete(&database.Subscription{}, subscriptionID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&database.Subscription{}, subscriptionID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subscription"})
 		return
 	}
@@ -838,7 +827,7 @@ func GetCustomerSubscriptionsByAdmin(c *gin.Context) {
 
 	var subscriptions []SubscriptionWithProduct
 
-	err = database.DB.Table("subscriptions").
+	err = database.DB.WithContext(c.Request.Context()).Table("subscriptions").
 		Select(`
 			subscriptions.id, 
 			subscriptions.order_id, 
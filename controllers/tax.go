@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// gstContext decides how GST applies to a sale: the product's rate and
+// whether the franchise supplies within its own state
+type gstContext struct {
+	Rate       float64
+	IntraState bool
+}
+
+// loadGSTContext looks up the rate and place of supply for a customer renting
+// a product from a franchise. A customer without a state on file is treated
+// as local to the franchise.
+func loadGSTContext(db *gorm.DB, productID, franchiseID, customerID uint) (gstContext, error) {
+	var product database.Product
+	if err := db.Select("id, gst_rate").First(&product, productID).Error; err != nil {
+		return gstContext{}, err
+	}
+	var franchise database.Franchise
+	if err := db.Select("id, state").First(&franchise, franchiseID).Error; err != nil {
+		return gstContext{}, err
+	}
+	var customer database.User
+	if err := db.Select("id, state").First(&customer, customerID).Error; err != nil {
+		return gstContext{}, err
+	}
+
+	rate := config.AppConfig.GSTRate
+	if product.GSTRate != nil {
+		rate = *product.GSTRate
+	}
+	customerState := strings.TrimSpace(customer.State)
+	return gstContext{
+		Rate:       rate,
+		IntraState: customerState == "" || strings.EqualFold(customerState, strings.TrimSpace(franchise.State)),
+	}, nil
+}
+
+// roundPaise rounds an amount to the nearest paisa
+func roundPaise(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// onTaxable computes the tax charged on top of a tax-exclusive amount
+func (g gstContext) onTaxable(taxable float64) database.TaxBreakdown {
+	tax := database.TaxBreakdown{TaxableAmount: roundPaise(taxable), TaxRate: g.Rate}
+	if g.IntraState {
+		half := roundPaise(tax.TaxableAmount * g.Rate / 200)
+		tax.CGSTAmount = half
+		tax.SGSTAmount = half
+		tax.TaxAmount = 2 * half
+	} else {
+		tax.IGSTAmount = roundPaise(tax.TaxableAmount * g.Rate / 100)
+		tax.TaxAmount = tax.IGSTAmount
+	}
+	return tax
+}
+
+// fromGross splits an amount that already includes tax, such as an auto-debit
+// collected by Razorpay, into its taxable value and tax
+func (g gstContext) fromGross(gross float64) database.TaxBreakdown {
+	tax := g.onTaxable(gross * 100 / (100 + g.Rate))
+	// Absorb rounding so the parts always add up to what was collected
+	tax.TaxableAmount = roundPaise(gross - tax.TaxAmount)
+	return tax
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/middleware"
+	"aquahome/tenant"
+	"aquahome/utils"
+)
+
+var tenantSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CreateTenantRequest adds a brand, optionally with its first admin
+type CreateTenantRequest struct {
+	Slug    string              `json:"slug" binding:"required,max=50"`
+	Name    string              `json:"name" binding:"required,max=100"`
+	Domains []string            `json:"domains" binding:"omitempty,dive,hostname"`
+	Admin   *TenantAdminRequest `json:"admin"`
+}
+
+// TenantAdminRequest is the first admin account of a new brand
+type TenantAdminRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// UpdateTenantRequest changes a brand; omitted fields are left as they are
+type UpdateTenantRequest struct {
+	Name     *string   `json:"name" binding:"omitempty,min=1,max=100"`
+	Domains  *[]string `json:"domains" binding:"omitempty,dive,hostname"`
+	Disabled *bool     `json:"disabled"`
+}
+
+// GetTenants lists the brands this deployment serves (platform admins only)
+// GET /api/admin/tenants
+func GetTenants(c *gin.Context) {
+	var tenants []database.Tenant
+	if err := database.DB.WithContext(c.Request.Context()).Order("id").Find(&tenants).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tenants"})
+		return
+	}
+	c.JSON(http.StatusOK, tenants)
+}
+
+// CreateTenant adds a brand, and its first admin when one is given, who can
+// then sign in through the brand's domain or X-Tenant header (platform
+// admins only)
+// POST /api/admin/tenants
+func CreateTenant(c *gin.Context) {
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	t := database.Tenant{
+		Slug:    strings.ToLower(strings.TrimSpace(req.Slug)),
+		Name:    strings.TrimSpace(req.Name),
+		Domains: normalizeDomains(req.Domains),
+	}
+	if !tenantSlug.MatchString(t.Slug) {
+		apperror.Respond(c, apperror.BadRequest("slug may only hold lowercase letters, digits and single dashes"))
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	if err := checkTenantUnique(db, t); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&t).Error; err != nil {
+			return err
+		}
+		if req.Admin == nil {
+			return nil
+		}
+		hash, err := utils.HashPassword(req.Admin.Password)
+		if err != nil {
+			return err
+		}
+		admin := database.User{
+			Name:         req.Admin.Name,
+			Email:        strings.ToLower(strings.TrimSpace(req.Admin.Email)),
+			PasswordHash: hash,
+			Role:         database.RoleAdmin,
+		}
+		// Created as the new tenant, so the admin is stamped with it
+		return tx.WithContext(tenant.WithID(c.Request.Context(), t.ID)).Create(&admin).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tenant"})
+		return
+	}
+	middleware.ReloadTenants()
+
+	recordAudit(c, nil, "tenant.create", "tenant", t.ID, nil, t)
+	c.JSON(http.StatusCreated, t)
+}
+
+// UpdateTenant renames a brand, changes its domains or stops serving it.
+// The default tenant can't be disabled. (platform admins only)
+// PUT /api/admin/tenants/:id
+func UpdateTenant(c *gin.Context) {
+	var req UpdateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	var t database.Tenant
+	if err := db.First(&t, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tenant"})
+		return
+	}
+	before := t
+
+	if req.Name != nil {
+		t.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Domains != nil {
+		t.Domains = normalizeDomains(*req.Domains)
+	}
+	if req.Disabled != nil {
+		if *req.Disabled && t.ID == database.DefaultTenantID {
+			apperror.Respond(c, apperror.BadRequest("The default tenant can't be disabled"))
+			return
+		}
+		t.Disabled = *req.Disabled
+	}
+	if err := checkTenantUnique(db, t); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if err := db.Save(&t).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tenant"})
+		return
+	}
+	middleware.ReloadTenants()
+
+	recordAudit(c, nil, "tenant.update", "tenant", t.ID, before, t)
+	c.JSON(http.StatusOK, t)
+}
+
+// normalizeDomains lowercases domains and drops blanks and repeats
+func normalizeDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	normalized := []string{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+// checkTenantUnique makes sure no other tenant has t's slug or one of its
+// domains, as requests are matched to tenants by them
+func checkTenantUnique(db *gorm.DB, t database.Tenant) error {
+	var others []database.Tenant
+	if err := db.Where("id <> ?", t.ID).Find(&others).Error; err != nil {
+		return apperror.Internal(err)
+	}
+	for _, other := range others {
+		if other.Slug == t.Slug {
+			return apperror.Conflict("A tenant with this slug already exists")
+		}
+		for _, domain := range other.Domains {
+			for _, mine := range t.Domains {
+				if domain == mine {
+					return apperror.Conflict(domain + " is already a domain of " + other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
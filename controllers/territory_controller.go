@@ -0,0 +1,505 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// TerritoryRequest defines a franchise territory. Radius territories need a
+// centre and radius_km; polygon territories need at least three vertices.
+type TerritoryRequest struct {
+	Name            string       `json:"name" binding:"required"`
+	Kind            string       `json:"kind" binding:"required,oneof=radius polygon"`
+	CenterLatitude  float64      `json:"center_latitude" binding:"min=-90,max=90"`
+	CenterLongitude float64      `json:"center_longitude" binding:"min=-180,max=180"`
+	RadiusKm        float64      `json:"radius_km" binding:"min=0,max=200"`
+	Polygon         [][2]float64 `json:"polygon"`
+	IsActive        *bool        `json:"is_active"`
+}
+
+// pincodePattern finds an Indian pincode in a free-text address
+var pincodePattern = regexp.MustCompile(`\b[1-9][0-9]{5}\b`)
+
+// territoryContains reports whether a point falls inside a territory
+func territoryContains(t database.FranchiseTerritory, lat, lng float64) bool {
+	switch t.Kind {
+	case database.TerritoryKindRadius:
+		return utils.HaversineKm(lat, lng, t.CenterLatitude, t.CenterLongitude) <= t.RadiusKm
+	case database.TerritoryKindPolygon:
+		return utils.PointInPolygon(lat, lng, t.Polygon)
+	}
+	return false
+}
+
+// franchiseZipCodes lists the pincodes of the locations a franchise serves
+func franchiseZipCodes(db *gorm.DB, franchiseID uint) ([]string, error) {
+	var locations []database.Location
+	if err := db.Joins("JOIN franchise_locations ON franchise_locations.location_id = locations.id").
+		Where("franchise_locations.franchise_id = ?", franchiseID).
+		Find(&locations).Error; err != nil {
+		return nil, err
+	}
+	var zipCodes []string
+	for _, location := range locations {
+		zipCodes = append(zipCodes, location.ZipCodes...)
+	}
+	return zipCodes, nil
+}
+
+// matchFranchise finds the active franchise serving a location: the nearest
+// territory containing the coordinates, or else a franchise whose locations
+// list the pincode. It returns gorm.ErrRecordNotFound when none serves it.
+func matchFranchise(db *gorm.DB, lat, lng float64, zip string) (database.Franchise, error) {
+	var franchise database.Franchise
+	const servable = "franchises.is_active = true AND franchises.approval_state = 'approved'"
+
+	if utils.HasCoordinates(lat, lng) {
+		var territories []database.FranchiseTerritory
+		if err := db.Joins("JOIN franchises ON franchises.id = franchise_territories.franchise_id").
+			Where("franchise_territories.is_active = ?", true).
+			Where(servable).
+			Where("franchises.deleted_at IS NULL").
+			Find(&territories).Error; err != nil {
+			return franchise, err
+		}
+
+		var best uint
+		bestDistance := math.Inf(1)
+		for _, t := range territories {
+			if !territoryContains(t, lat, lng) {
+				continue
+			}
+			if d := utils.HaversineKm(lat, lng, t.CenterLatitude, t.CenterLongitude); d < bestDistance {
+				best, bestDistance = t.FranchiseID, d
+			}
+		}
+		if best != 0 {
+			err := db.First(&franchise, best).Error
+			return franchise, err
+		}
+	}
+
+	if zip == "" {
+		return franchise, gorm.ErrRecordNotFound
+	}
+	err := db.Joins("JOIN franchise_locations ON franchise_locations.franchise_id = franchises.id").
+		Joins("JOIN locations ON locations.id = franchise_locations.location_id").
+		Where("? = ANY(locations.zip_codes) AND locations.is_active = ?", zip, true).
+		Where(servable).
+		Order("franchises.id").
+		First(&franchise).Error
+	return franchise, err
+}
+
+// locateAddress geocodes a delivery address, falling back to the customer's
+// saved coordinates, and picks out its pincode
+func locateAddress(customer database.User, address string) (lat, lng float64, zip string) {
+	lat, lng = customer.Latitude, customer.Longitude
+	if address != "" {
+		if gLat, gLng, err := utils.Geocode(address); err == nil {
+			lat, lng = gLat, gLng
+		} else if !errors.Is(err, utils.ErrGeocodingDisabled) {
+			log.Printf("Geocoding failed for customer %d: %v", customer.ID, err)
+		}
+	}
+
+	zip = customer.ZipCode
+	if found := pincodePattern.FindString(address); found != "" {
+		zip = found
+	}
+	return lat, lng, zip
+}
+
+// assignFranchise picks the franchise serving a customer's delivery address
+func assignFranchise(db *gorm.DB, customerID uint, address string) (database.Franchise, error) {
+	var customer database.User
+	if err := db.Select("id, zip_code, latitude, longitude").First(&customer, customerID).Error; err != nil {
+		return database.Franchise{}, err
+	}
+	lat, lng, zip := locateAddress(customer, address)
+	return matchFranchise(db, lat, lng, zip)
+}
+
+// geocodeUser fills in a user's coordinates from their address when geocoding
+// is configured. Failures are logged and leave the coordinates unchanged.
+func geocodeUser(user *database.User) {
+	address := user.Address
+	for _, part := range []string{user.City, user.State, user.ZipCode} {
+		if part != "" {
+			address += ", " + part
+		}
+	}
+	if address == "" {
+		return
+	}
+
+	lat, lng, err := utils.Geocode(address)
+	if err != nil {
+		if !errors.Is(err, utils.ErrGeocodingDisabled) {
+			log.Printf("Geocoding failed for user %d: %v", user.ID, err)
+		}
+		return
+	}
+	user.Latitude, user.Longitude = lat, lng
+}
+
+// adminFranchise loads the franchise named by :id for the territory endpoints
+func adminFranchise(c *gin.Context) (database.Franchise, bool) {
+	var franchise database.Franchise
+	if err := database.DB.WithContext(c.Request.Context()).First(&franchise, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return franchise, false
+	}
+	return franchise, true
+}
+
+// GetFranchiseTerritories lists a franchise's territories (Admin only)
+func GetFranchiseTerritories(c *gin.Context) {
+	franchise, ok := adminFranchise(c)
+	if !ok {
+		return
+	}
+
+	var territories []database.FranchiseTerritory
+	if err := database.DB.WithContext(c.Request.Context()).Where("franchise_id = ?", franchise.ID).Order("id").Find(&territories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch territories"})
+		return
+	}
+	c.JSON(http.StatusOK, territories)
+}
+
+// CreateFranchiseTerritory adds a radius or polygon territory to a franchise (Admin only)
+func CreateFranchiseTerritory(c *gin.Context) {
+	franchise, ok := adminFranchise(c)
+	if !ok {
+		return
+	}
+
+	var req TerritoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	territory := database.FranchiseTerritory{
+		FranchiseID: franchise.ID,
+		Name:        req.Name,
+		Kind:        req.Kind,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+	}
+	switch req.Kind {
+	case database.TerritoryKindRadius:
+		if req.RadiusKm <= 0 || !utils.HasCoordinates(req.CenterLatitude, req.CenterLongitude) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Radius territories need center_latitude, center_longitude and radius_km"})
+			return
+		}
+		territory.CenterLatitude = req.CenterLatitude
+		territory.CenterLongitude = req.CenterLongitude
+		territory.RadiusKm = req.RadiusKm
+	case database.TerritoryKindPolygon:
+		if len(req.Polygon) < 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Polygon territories need at least 3 [latitude, longitude] points"})
+			return
+		}
+		// The centroid of the vertices ranks overlapping territories by distance
+		for _, point := range req.Polygon {
+			if point[0] < -90 || point[0] > 90 || point[1] < -180 || point[1] > 180 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Polygon points must be valid [latitude, longitude] pairs"})
+				return
+			}
+			territory.CenterLatitude += point[0] / float64(len(req.Polygon))
+			territory.CenterLongitude += point[1] / float64(len(req.Polygon))
+		}
+		territory.Polygon = req.Polygon
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&territory).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create territory"})
+		return
+	}
+	recordAudit(c, nil, "franchise.territory_create", "franchise", franchise.ID, nil, territory)
+	c.JSON(http.StatusCreated, territory)
+}
+
+// DeleteFranchiseTerritory removes a territory from a franchise (Admin only)
+func DeleteFranchiseTerritory(c *gin.Context) {
+	franchise, ok := adminFranchise(c)
+	if !ok {
+		return
+	}
+
+	var territory database.FranchiseTerritory
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND franchise_id = ?", c.Param("territory_id"), franchise.ID).
+		First(&territory).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Territory not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&territory).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete territory"})
+		return
+	}
+	recordAudit(c, nil, "franchise.territory_delete", "franchise", franchise.ID, territory, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Territory deleted"})
+}
+
+// FranchiseLocationsRequest attaches or detaches existing locations and
+// individual pincodes. Attaching a pincode another franchise already serves
+// is refused unless allow_overlap is set.
+type FranchiseLocationsRequest struct {
+	LocationIDs  []uint   `json:"location_ids"`
+	ZipCodes     []string `json:"zip_codes"`
+	AllowOverlap bool     `json:"allow_overlap"`
+}
+
+// TerritoryConflict is a pincode already served by another franchise
+type TerritoryConflict struct {
+	ZipCode       string `json:"zip_code"`
+	FranchiseID   uint   `json:"franchise_id"`
+	FranchiseName string `json:"franchise_name"`
+}
+
+// bindFranchiseLocations reads and validates a FranchiseLocationsRequest
+func bindFranchiseLocations(c *gin.Context) (FranchiseLocationsRequest, bool) {
+	var req FranchiseLocationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return req, false
+	}
+	if len(req.LocationIDs) == 0 && len(req.ZipCodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "location_ids or zip_codes is required"})
+		return req, false
+	}
+	for i, zip := range req.ZipCodes {
+		zip = strings.TrimSpace(zip)
+		if pincodePattern.FindString(zip) != zip {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pincode: " + zip})
+			return req, false
+		}
+		req.ZipCodes[i] = zip
+	}
+	return req, true
+}
+
+// territoryConflicts finds which of the pincodes are served by franchises
+// other than franchiseID
+func territoryConflicts(db *gorm.DB, franchiseID uint, zipCodes []string) ([]TerritoryConflict, error) {
+	var rows []struct {
+		FranchiseID   uint
+		FranchiseName string
+		ZipCodes      pq.StringArray `gorm:"type:text[]"`
+	}
+	if err := db.Table("franchises").
+		Select("franchises.id AS franchise_id, franchises.name AS franchise_name, locations.zip_codes").
+		Joins("JOIN franchise_locations ON franchise_locations.franchise_id = franchises.id").
+		Joins("JOIN locations ON locations.id = franchise_locations.location_id").
+		Where("franchises.id <> ? AND franchises.deleted_at IS NULL AND locations.deleted_at IS NULL", franchiseID).
+		Where("locations.zip_codes && ?", pq.StringArray(zipCodes)).
+		Order("franchises.id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(zipCodes))
+	for _, zip := range zipCodes {
+		wanted[zip] = true
+	}
+	seen := map[TerritoryConflict]bool{}
+	var conflicts []TerritoryConflict
+	for _, row := range rows {
+		for _, zip := range row.ZipCodes {
+			conflict := TerritoryConflict{ZipCode: zip, FranchiseID: row.FranchiseID, FranchiseName: row.FranchiseName}
+			if wanted[zip] && !seen[conflict] {
+				seen[conflict] = true
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// respondFranchiseLocations returns the locations a franchise now serves
+func respondFranchiseLocations(c *gin.Context, franchiseID uint) {
+	var locations []database.Location
+	if err := database.DB.WithContext(c.Request.Context()).Joins("JOIN franchise_locations ON franchise_locations.location_id = locations.id").
+		Where("franchise_locations.franchise_id = ?", franchiseID).
+		Order("locations.id").
+		Find(&locations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+	c.JSON(http.StatusOK, locations)
+}
+
+// GetFranchiseServiceLocations lists the locations a franchise serves (Admin only)
+func GetFranchiseServiceLocations(c *gin.Context) {
+	franchise, ok := adminFranchise(c)
+	if !ok {
+		return
+	}
+	respondFranchiseLocations(c, franchise.ID)
+}
+
+// AttachFranchiseLocations links locations and pincodes to a franchise. A
+// pincode gets its own single-pincode location, created on first use.
+// Pincodes another franchise already serves are reported with 409 Conflict
+// unless the request sets allow_overlap (Admin only).
+func AttachFranchiseLocations(c *gin.Context) {
+	franchise, ok := adminFranchise(c)
+	if !ok {
+		return
+	}
+	req, ok := bindFranchiseLocations(c)
+	if !ok {
+		return
+	}
+
+	var locations []database.Location
+	if len(req.LocationIDs) > 0 {
+		if err := database.DB.WithContext(c.Request.Context()).Where("id IN ?", req.LocationIDs).Find(&locations).Error; err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if len(locations) != len(uniqueIDs(req.LocationIDs)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "One or more locations were not found"})
+			return
+		}
+	}
+
+	claimed := append([]string{}, req.ZipCodes...)
+	for _, location := range locations {
+		claimed = append(claimed, location.ZipCodes...)
+	}
+	if !req.AllowOverlap && len(claimed) > 0 {
+		conflicts, err := territoryConflicts(database.DB.WithContext(c.Request.Context()), franchise.ID, claimed)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if len(conflicts) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "Some pincodes are already served by another franchise; set allow_overlap to share them",
+				"conflicts": conflicts,
+			})
+			return
+		}
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		for _, zip := range req.ZipCodes {
+			location := database.Location{Name: zip, ZipCodes: pq.StringArray{zip}, IsActive: true}
+			if err := tx.Where("zip_codes = ?", pq.StringArray{zip}).FirstOrCreate(&location).Error; err != nil {
+				return err
+			}
+			locations = append(locations, location)
+		}
+		for _, location := range locations {
+			link := database.FranchiseLocation{FranchiseID: franchise.ID, LocationID: location.ID}
+			if err := tx.FirstOrCreate(&link, link).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach locations"})
+		return
+	}
+
+	recordAudit(c, nil, "franchise.locations_attach", "franchise", franchise.ID, nil, req)
+	respondFranchiseLocations(c, franchise.ID)
+}
+
+// DetachFranchiseLocations unlinks locations and pincodes from a franchise. A
+// pincode can only be detached on its own when it is not part of a larger
+// location; such locations must be detached whole (Admin only).
+func DetachFranchiseLocations(c *gin.Context) {
+	franchise, ok := adminFranchise(c)
+	if !ok {
+		return
+	}
+	req, ok := bindFranchiseLocations(c)
+	if !ok {
+		return
+	}
+
+	locationIDs := append([]uint{}, req.LocationIDs...)
+	for _, zip := range req.ZipCodes {
+		var linked []database.Location
+		if err := database.DB.WithContext(c.Request.Context()).Joins("JOIN franchise_locations ON franchise_locations.location_id = locations.id").
+			Where("franchise_locations.franchise_id = ? AND ? = ANY(locations.zip_codes)", franchise.ID, zip).
+			Find(&linked).Error; err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		for _, location := range linked {
+			if len(location.ZipCodes) > 1 {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":       "Pincode " + zip + " is part of a larger location; detach that location instead",
+					"location_id": location.ID,
+				})
+				return
+			}
+			locationIDs = append(locationIDs, location.ID)
+		}
+	}
+	if len(locationIDs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "None of these locations are linked to the franchise"})
+		return
+	}
+
+	result := database.DB.WithContext(c.Request.Context()).Where("franchise_id = ? AND location_id IN ?", franchise.ID, locationIDs).
+		Delete(&database.FranchiseLocation{})
+	if result.Error != nil {
+		log.Printf("Database error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detach locations"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "None of these locations are linked to the franchise"})
+		return
+	}
+
+	recordAudit(c, nil, "franchise.locations_detach", "franchise", franchise.ID, req, nil)
+	respondFranchiseLocations(c, franchise.ID)
+}
+
+// uniqueIDs drops repeated IDs
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	var unique []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/apperror"
+	"aquahome/database"
+)
+
+// ServiceRequestTextHit is a service request matched by keywords, with the
+// matching part of its description highlighted
+type ServiceRequestTextHit struct {
+	ID           uint      `json:"id"`
+	Type         string    `json:"type"`
+	Status       string    `json:"status"`
+	Description  string    `json:"description"`
+	Headline     string    `json:"headline"` // description excerpt with matches in <b></b>
+	CustomerID   uint      `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	FranchiseID  uint      `json:"franchise_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Rank         float64   `json:"rank"`
+}
+
+// textQuery reads ?q= plus page/limit of a full-text search. Words are
+// ANDed, "quoted phrases" and -excluded words work as in web search.
+func textQuery(c *gin.Context) (q string, page, limit int, ok bool) {
+	q = strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		apperror.Respond(c, apperror.BadRequest("q is required"))
+		return "", 0, 0, false
+	}
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return q, page, limit, true
+}
+
+// byRank orders full-text matches of column against tsQuery, best first
+func byRank(query *gorm.DB, column, tsQuery, q string) *gorm.DB {
+	return query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:  "ts_rank(" + column + ", " + tsQuery + ") DESC",
+		Vars: []interface{}{q},
+	}})
+}
+
+// SearchCustomersText finds customers by words of their name, email, phone
+// or address, best match first
+// GET /api/admin/search/customers?q=&page=&limit=
+func SearchCustomersText(c *gin.Context) {
+	q, page, limit, ok := textQuery(c)
+	if !ok {
+		return
+	}
+	const tsQuery = "websearch_to_tsquery('simple', ?)"
+
+	query := database.ReadDB().WithContext(c.Request.Context()).
+		Model(&database.User{}).
+		Where("role = ?", database.RoleCustomer).
+		Where("search_vector @@ "+tsQuery, q)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Search failed"))
+		return
+	}
+
+	var customers []CustomerSearchHit
+	if err := byRank(query, "search_vector", tsQuery, q).
+		Select("id, name, email, phone, created_at").
+		Order("id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&customers).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Search failed"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customers": customers, "total": total, "page": page, "limit": limit})
+}
+
+// SearchServiceRequestsText finds service requests by keywords of their
+// description, notes and feedback ("leaking tap kitchen"), best match first.
+// ?status= narrows the results.
+// GET /api/admin/search/service-requests?q=&status=&page=&limit=
+func SearchServiceRequestsText(c *gin.Context) {
+	q, page, limit, ok := textQuery(c)
+	if !ok {
+		return
+	}
+	const tsQuery = "websearch_to_tsquery('english', ?)"
+
+	query := database.ReadDB().WithContext(c.Request.Context()).
+		Table("service_requests").
+		Joins("JOIN users ON service_requests.customer_id = users.id").
+		Where("service_requests.search_vector @@ "+tsQuery, q).
+		Where(notDeleted("service_requests"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("service_requests.status IN ?", strings.Split(status, ","))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Search failed"))
+		return
+	}
+
+	var requests []ServiceRequestTextHit
+	if err := byRank(query, "service_requests.search_vector", tsQuery, q).
+		Select(`service_requests.id, service_requests.type, service_requests.status,
+			service_requests.description, service_requests.customer_id, users.name as customer_name,
+			service_requests.franchise_id, service_requests.created_at,
+			ts_headline('english', service_requests.description, `+tsQuery+`) as headline,
+			ts_rank(service_requests.search_vector, `+tsQuery+`) as rank`, q, q).
+		Order("service_requests.created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&requests).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Search failed"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_requests": requests, "total": total, "page": page, "limit": limit})
+}
@@ -0,0 +1,461 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Two-factor login settings
+const (
+	twoFactorIssuer       = "AquaHome"
+	twoFactorTokenMinutes = 5
+	twoFactorMaxAttempts  = 5 // codes tried against one login before it has to start over
+	backupCodeCount       = 10
+)
+
+// TwoFactorCodeRequest carries a code from the authenticator app or, where
+// allowed, a backup code
+type TwoFactorCodeRequest struct {
+	Code       string `json:"code"`
+	BackupCode string `json:"backup_code"`
+}
+
+// TwoFactorVerifyRequest completes a login that needs a second factor
+type TwoFactorVerifyRequest struct {
+	TwoFactorToken string `json:"two_factor_token" binding:"required"`
+	TwoFactorCodeRequest
+}
+
+// SecurityPolicyRequest updates the account security policy
+type SecurityPolicyRequest struct {
+	RequireTwoFactor *bool `json:"require_two_factor" binding:"required"`
+}
+
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// twoFactorChallenge answers a login whose password checked out but which
+// still needs a second factor: from users who set up an authenticator, and
+// from privileged users who must set one up under the security policy. It
+// returns false when the login can go ahead.
+func twoFactorChallenge(c *gin.Context, user database.User) (bool, error) {
+	if !user.UsesTwoFactor() {
+		return false, nil
+	}
+
+	purpose := utils.TokenPurposeTwoFactor
+	if user.TwoFactorEnabledAt == nil {
+		policy, err := database.CurrentSecurityPolicy(database.DB.WithContext(c.Request.Context()))
+		if err != nil {
+			return false, err
+		}
+		if !policy.RequireTwoFactor {
+			return false, nil
+		}
+		purpose = utils.TokenPurposeTwoFactorSetup
+	}
+
+	// A new challenge replaces any earlier one and starts the count of tries afresh
+	challengeID, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return false, err
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"two_factor_challenge_id": challengeID,
+		"two_factor_attempts":     0,
+	}).Error; err != nil {
+		return false, err
+	}
+
+	expiresAt := time.Now().Add(twoFactorTokenMinutes * time.Minute)
+	token, err := utils.GenerateTwoFactorJWT(user.ID, user.Email, strings.ToLower(user.Role), purpose, challengeID, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	response := gin.H{"two_factor_token": token, "expires_at": expiresAt}
+	if purpose == utils.TokenPurposeTwoFactorSetup {
+		response["two_factor_setup_required"] = true
+	} else {
+		response["two_factor_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+	return true, nil
+}
+
+// checkTwoFactorCode verifies an authenticator code, or a backup code when
+// allowBackup is set, and marks it used
+func checkTwoFactorCode(tx *gorm.DB, user *database.User, req TwoFactorCodeRequest, allowBackup bool) error {
+	if code := strings.TrimSpace(req.Code); code != "" {
+		step, ok := utils.ValidateTOTP(user.TwoFactorSecret, code, user.TwoFactorLastStep, time.Now())
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		// Guarded on the last step so the same code can't be used twice at once
+		result := tx.Model(&database.User{}).
+			Where("id = ? AND two_factor_last_step = ?", user.ID, user.TwoFactorLastStep).
+			Update("two_factor_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidTwoFactorCode
+		}
+		user.TwoFactorLastStep = step
+		return nil
+	}
+
+	backupCode := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(req.BackupCode), "-", ""))
+	if !allowBackup || backupCode == "" {
+		return errInvalidTwoFactorCode
+	}
+	result := tx.Model(&database.TwoFactorBackupCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(backupCode)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// replaceBackupCodes issues a fresh set of backup codes, invalidating the old ones
+func replaceBackupCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&database.TwoFactorBackupCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, backupCodeCount)
+	rows := make([]database.TwoFactorBackupCode, 0, backupCodeCount)
+	for i := 0; i < backupCodeCount; i++ {
+		code, err := utils.GenerateSecureToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		rows = append(rows, database.TwoFactorBackupCode{UserID: userID, CodeHash: utils.HashToken(code)})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// twoFactorUser loads the caller for a two-factor endpoint. It writes the
+// error response and returns false on failure.
+func twoFactorUser(c *gin.Context) (database.User, bool) {
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, c.GetUint("user_id")).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return user, false
+	}
+	if !user.UsesTwoFactor() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor login is available for admin and franchise accounts"})
+		return user, false
+	}
+	return user, true
+}
+
+// respondTwoFactorError reports a failed code check
+func respondTwoFactorError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or already used code"})
+		return
+	}
+	log.Printf("Two-factor error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+}
+
+// SetupTwoFactor starts authenticator enrollment. It returns the secret and
+// the otpauth:// URL to show as a QR code; login needs a code only once
+// EnableTwoFactor confirms it.
+// POST /api/auth/2fa/setup
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor login is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("TOTP secret error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Updates(map[string]interface{}{
+		"two_factor_secret":    secret,
+		"two_factor_last_step": 0,
+	}).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": utils.TOTPAuthURL(twoFactorIssuer, user.Email, secret),
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a first code from the app and
+// returns the backup codes, shown only this once. When enrolling during a
+// login it also completes the login.
+// POST /api/auth/2fa/enable
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor login is already enabled"})
+		return
+	}
+	if user.TwoFactorSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	var codes []string
+	var login LoginResponse
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := checkTwoFactorCode(tx, &user, TwoFactorCodeRequest{Code: req.Code}, false); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&user).Update("two_factor_enabled_at", now).Error; err != nil {
+			return err
+		}
+		user.TwoFactorEnabledAt = &now
+
+		var err error
+		if codes, err = replaceBackupCodes(tx, user.ID); err != nil {
+			return err
+		}
+		if c.GetBool("two_factor_setup") {
+			login, err = issueSession(c, tx, user)
+		}
+		return err
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	recordAudit(c, nil, "user.two_factor_enable", "user", user.ID, nil, gin.H{"two_factor_enabled_at": user.TwoFactorEnabledAt})
+	response := gin.H{"message": "Two-factor login enabled", "backup_codes": codes}
+	if login.Token != "" {
+		response["login"] = login
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyTwoFactor completes a login with a code from the authenticator app
+// or a backup code. Each try uses up one of the login's twoFactorMaxAttempts;
+// after that the user has to sign in with their password again.
+// POST /api/auth/2fa/verify
+func VerifyTwoFactor(c *gin.Context) {
+	var req TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("two_factor_token and a code are required"))
+		return
+	}
+
+	claims, err := utils.ValidateJWT(req.TwoFactorToken)
+	if err != nil || claims.Purpose != utils.TokenPurposeTwoFactor || claims.ID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, claims.UserID).Error; err != nil || user.TwoFactorEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	// Take a try off the challenge before checking the code, so parallel
+	// guesses can't get past the limit
+	result := database.DB.WithContext(c.Request.Context()).Model(&database.User{}).
+		Where("id = ? AND two_factor_challenge_id = ? AND two_factor_attempts < ?", user.ID, claims.ID, twoFactorMaxAttempts).
+		Update("two_factor_attempts", gorm.Expr("two_factor_attempts + 1"))
+	if result.Error != nil {
+		log.Printf("Database error: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many wrong codes or login expired, please sign in again"})
+		return
+	}
+
+	var response LoginResponse
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := checkTwoFactorCode(tx, &user, req.TwoFactorCodeRequest, true); err != nil {
+			return err
+		}
+		// The challenge is done with; its token can't start another session
+		if err := tx.Model(&database.User{}).Where("id = ?", user.ID).
+			Update("two_factor_challenge_id", "").Error; err != nil {
+			return err
+		}
+		var err error
+		response, err = issueSession(c, tx, user)
+		return err
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Update("last_login", time.Now()).Error; err != nil {
+		log.Printf("Warning: Failed to update last login time: %v", err)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RegenerateBackupCodes replaces the caller's backup codes after checking a
+// code from the authenticator app
+// POST /api/auth/2fa/backup-codes
+func RegenerateBackupCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor login is not enabled"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := checkTwoFactorCode(tx, &user, req, false); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceBackupCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"backup_codes": codes})
+}
+
+// DisableTwoFactor turns two-factor login off after checking a code, unless
+// the security policy requires it
+// POST /api/auth/2fa/disable
+func DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err).WithMessage("A code or backup code is required"))
+		return
+	}
+
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor login is not enabled"})
+		return
+	}
+	policy, err := database.CurrentSecurityPolicy(database.DB.WithContext(c.Request.Context()))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if policy.RequireTwoFactor {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor login is required for your account"})
+		return
+	}
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := checkTwoFactorCode(tx, &user, req, true); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_secret":     "",
+			"two_factor_enabled_at": nil,
+			"two_factor_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&database.TwoFactorBackupCode{}).Error
+	})
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	recordAudit(c, nil, "user.two_factor_disable", "user", user.ID, gin.H{"two_factor_enabled_at": user.TwoFactorEnabledAt}, gin.H{"two_factor_enabled_at": nil})
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor login disabled"})
+}
+
+// GetSecurityPolicy returns the account security policy (Admin only)
+func GetSecurityPolicy(c *gin.Context) {
+	policy, err := database.CurrentSecurityPolicy(database.DB.WithContext(c.Request.Context()))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security policy"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateSecurityPolicy changes the account security policy. Requiring
+// two-factor login makes admins and franchise owners without it set it up at
+// their next login. (Admin only)
+func UpdateSecurityPolicy(c *gin.Context) {
+	var req SecurityPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+
+	policy, err := database.CurrentSecurityPolicy(database.DB.WithContext(c.Request.Context()))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	before := policy
+	policy.RequireTwoFactor = *req.RequireTwoFactor
+	policy.UpdatedBy = c.GetUint("user_id")
+	if err := database.DB.WithContext(c.Request.Context()).Save(&policy).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security policy"})
+		return
+	}
+
+	recordAudit(c, nil, "security_policy.update", "security_policy", policy.ID, before, policy)
+	c.JSON(http.StatusOK, policy)
+}
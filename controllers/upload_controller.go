@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// directUploadTTL is how long a presigned upload URL stays valid
+const directUploadTTL = 15 * time.Minute
+
+// directUploadLimits are the content types each upload purpose accepts,
+// with the largest file allowed for each
+var directUploadLimits = map[string]map[string]int64{
+	database.UploadPurposeProductImage: {
+		"image/jpeg": 25 << 20,
+		"image/png":  25 << 20,
+		"image/webp": 25 << 20,
+	},
+	database.UploadPurposeServiceAttachment: {
+		"image/jpeg": 20 << 20,
+		"image/png":  20 << 20,
+		"image/webp": 20 << 20,
+		"video/mp4":  200 << 20,
+		"video/webm": 200 << 20,
+	},
+}
+
+// directUploadExtensions name stored objects by content type
+var directUploadExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// PresignUploadRequest describes a file a client is about to upload
+type PresignUploadRequest struct {
+	Purpose     string `json:"purpose" binding:"required,oneof=product_image service_attachment"`
+	TargetID    uint   `json:"target_id" binding:"required"` // product or service request ID
+	ContentType string `json:"content_type" binding:"required"`
+	SizeBytes   int64  `json:"size_bytes" binding:"required,min=1"`
+	FileName    string `json:"file_name" binding:"max=255"`
+}
+
+// PresignUploadResponse is where and how to send the file. The request must
+// carry Headers exactly, or S3 refuses it.
+type PresignUploadResponse struct {
+	Upload    database.DirectUpload `json:"upload"`
+	Method    string                `json:"method"`
+	URL       string                `json:"url"`
+	Headers   map[string]string     `json:"headers"`
+	ExpiresAt time.Time             `json:"expires_at"`
+}
+
+// checkUploadTarget reports whether the caller may add a file to the product
+// or service request, by the same rules as uploading through the API
+func checkUploadTarget(c *gin.Context, purpose string, targetID uint) error {
+	role := c.GetString("role")
+	userID := c.GetUint("user_id")
+
+	if purpose == database.UploadPurposeProductImage {
+		if role != database.RoleAdmin {
+			return apperror.Forbidden("Only admins can upload product images")
+		}
+		var product database.Product
+		if err := database.DB.WithContext(c.Request.Context()).Select("id").First(&product, targetID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.NotFound("Product not found")
+			}
+			return err
+		}
+		return nil
+	}
+
+	var serviceRequest database.ServiceRequest
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, customer_id, service_agent_id, status").
+		First(&serviceRequest, targetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("Service request not found")
+		}
+		return err
+	}
+	closed := serviceRequest.Status == database.ServiceStatusCompleted || serviceRequest.Status == database.ServiceStatusCancelled
+	switch role {
+	case database.RoleAdmin, database.RoleCustomer:
+		if role == database.RoleCustomer && serviceRequest.CustomerID != userID {
+			return apperror.NotFound("Service request not found")
+		}
+		if closed {
+			return apperror.Conflict(fmt.Sprintf("Cannot add attachments to a %s service request", serviceRequest.Status))
+		}
+	case database.RoleServiceAgent:
+		if serviceRequest.ServiceAgentID == nil || *serviceRequest.ServiceAgentID != userID {
+			return apperror.NotFound("Service request not found or not assigned to you")
+		}
+		if serviceRequest.Status != database.ServiceStatusInProgress && serviceRequest.Status != database.ServiceStatusCompleted {
+			return apperror.Conflict("Proof can be attached once you have checked in to the job")
+		}
+	default:
+		return apperror.Forbidden("You cannot attach files to service requests")
+	}
+
+	var existing int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.ServiceRequestAttachment{}).
+		Where("service_request_id = ?", serviceRequest.ID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing >= maxAttachmentsPerRequest {
+		return apperror.BadRequest(fmt.Sprintf("A service request can have at most %d attachments", maxAttachmentsPerRequest))
+	}
+	return nil
+}
+
+// PresignUpload hands out a short-lived URL to PUT a product image or
+// service request photo or video straight to S3. The URL only accepts the
+// declared content type and size; confirm the upload once it is done.
+// POST /api/uploads/presign
+func PresignUpload(c *gin.Context) {
+	if !utils.S3Enabled() {
+		apperror.Respond(c, apperror.New(http.StatusServiceUnavailable, "uploads_disabled", "Direct uploads are not configured"))
+		return
+	}
+
+	var req PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	limit, ok := directUploadLimits[req.Purpose][req.ContentType]
+	if !ok {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("%s is not accepted for %s uploads", req.ContentType, req.Purpose)))
+		return
+	}
+	if req.SizeBytes > limit {
+		apperror.Respond(c, apperror.BadRequest(fmt.Sprintf("Files of this type can be at most %d MB", limit>>20)))
+		return
+	}
+	if err := checkUploadTarget(c, req.Purpose, req.TargetID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	token, err := utils.GenerateSecureToken(12)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	folder := "service-requests"
+	if req.Purpose == database.UploadPurposeProductImage {
+		folder = "products"
+	}
+	upload := database.DirectUpload{
+		UserID:       c.GetUint("user_id"),
+		Purpose:      req.Purpose,
+		TargetID:     req.TargetID,
+		ObjectKey:    fmt.Sprintf("%s/%d/%s%s", folder, req.TargetID, token, directUploadExtensions[req.ContentType]),
+		ContentType:  req.ContentType,
+		SizeBytes:    req.SizeBytes,
+		OriginalName: req.FileName,
+		Status:       database.UploadStatusPending,
+		ExpiresAt:    time.Now().Add(directUploadTTL),
+	}
+
+	headers := map[string]string{
+		"Content-Type":   upload.ContentType,
+		"Content-Length": strconv.FormatInt(upload.SizeBytes, 10),
+	}
+	url, err := utils.PresignS3(http.MethodPut, upload.ObjectKey, headers, directUploadTTL)
+	if err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to prepare the upload"))
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&upload).Error; err != nil {
+		apperror.Respond(c, apperror.Internal(err).WithMessage("Failed to prepare the upload"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, PresignUploadResponse{
+		Upload:    upload,
+		Method:    http.MethodPut,
+		URL:       url,
+		Headers:   headers,
+		ExpiresAt: upload.ExpiresAt,
+	})
+}
+
+// ConfirmUpload checks that a presigned upload arrived in S3 as declared and
+// records it as a product image or service request attachment. Product
+// images uploaded this way are served as uploaded, with only a WebP
+// thumbnail made in the background.
+// POST /api/uploads/:id/confirm
+func ConfirmUpload(c *gin.Context) {
+	var upload database.DirectUpload
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apperror.Respond(c, apperror.NotFound("Upload not found"))
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+	if upload.Status != database.UploadStatusPending {
+		apperror.Respond(c, apperror.Conflict("Upload has already been confirmed"))
+		return
+	}
+	if err := checkUploadTarget(c, upload.Purpose, upload.TargetID); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	size, contentType, err := utils.HeadS3Object(upload.ObjectKey)
+	if errors.Is(err, utils.ErrS3ObjectNotFound) {
+		apperror.Respond(c, apperror.Conflict("The file has not been uploaded yet"))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to check upload %d in S3: %v", upload.ID, err)
+		apperror.Respond(c, apperror.New(http.StatusBadGateway, apperror.CodeBadGateway, "Could not check the uploaded file"))
+		return
+	}
+	if size != upload.SizeBytes || contentType != upload.ContentType {
+		if err := utils.DeleteS3Object(upload.ObjectKey); err != nil {
+			log.Printf("Failed to remove mismatched upload %d: %v", upload.ID, err)
+		}
+		apperror.Respond(c, apperror.BadRequest("The uploaded file does not match the declared type and size"))
+		return
+	}
+
+	var (
+		record   interface{}
+		recordID uint
+		isPhoto  bool
+	)
+	url := utils.S3ObjectURL(upload.ObjectKey)
+	now := time.Now()
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// Claim the upload so a repeated confirm can't record it twice
+		claim := tx.Model(&database.DirectUpload{}).
+			Where("id = ? AND status = ?", upload.ID, database.UploadStatusPending).
+			Updates(map[string]interface{}{"status": database.UploadStatusConfirmed, "confirmed_at": now})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return apperror.Conflict("Upload has already been confirmed")
+		}
+
+		if upload.Purpose == database.UploadPurposeProductImage {
+			var product database.Product
+			if err := tx.First(&product, upload.TargetID).Error; err != nil {
+				return err
+			}
+			var lastPosition int
+			if err := tx.Model(&database.ProductImage{}).Where("product_id = ?", product.ID).
+				Select("COALESCE(MAX(position), 0)").Scan(&lastPosition).Error; err != nil {
+				return err
+			}
+			image := database.ProductImage{
+				ProductID:    product.ID,
+				Position:     lastPosition + 1,
+				ThumbnailURL: url,
+				MediumURL:    url,
+				FullURL:      url,
+				OriginalName: upload.OriginalName,
+				SizeBytes:    upload.SizeBytes,
+				AltText:      product.Name,
+			}
+			if err := tx.Create(&image).Error; err != nil {
+				return err
+			}
+			if product.ImageURL == "" {
+				if err := tx.Model(&product).Update("image_url", url).Error; err != nil {
+					return err
+				}
+			}
+			recordID, record, isPhoto = image.ID, image, true
+		} else {
+			kind := database.AttachmentKindPhoto
+			if _, isVideo := videoExtensions[upload.ContentType]; isVideo {
+				kind = database.AttachmentKindVideo
+			}
+			attachment := database.ServiceRequestAttachment{
+				ServiceRequestID: upload.TargetID,
+				UploadedBy:       upload.UserID,
+				UploaderRole:     c.GetString("role"),
+				Kind:             kind,
+				URL:              url,
+				OriginalName:     upload.OriginalName,
+				ContentType:      upload.ContentType,
+				SizeBytes:        upload.SizeBytes,
+			}
+			if err := tx.Create(&attachment).Error; err != nil {
+				return err
+			}
+			recordID, record, isPhoto = attachment.ID, attachment, kind == database.AttachmentKindPhoto
+		}
+		return tx.Model(&database.DirectUpload{}).Where("id = ?", upload.ID).Update("record_id", recordID).Error
+	})
+	if err != nil {
+		var appErr *apperror.Error
+		if !errors.As(err, &appErr) {
+			err = apperror.Internal(err).WithMessage("Failed to record the upload")
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	if isPhoto {
+		queueImageProcessing(upload.Purpose, recordID)
+	}
+	if upload.Purpose == database.UploadPurposeProductImage {
+		recordAudit(c, nil, "product.images_upload", "product", upload.TargetID, nil, gin.H{"images": 1})
+	}
+	c.JSON(http.StatusCreated, record)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"aquahome/apperror"
 	"aquahome/database"
 	"aquahome/utils"
 )
@@ -21,7 +22,7 @@ func GetUserProfile(c *gin.Context) {
 	}
 
 	var user database.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
 		log.Printf("Error fetching user: %v", err)
 
 		if err == gorm.ErrRecordNotFound {
@@ -53,7 +54,7 @@ func UpdateUserProfile(c *gin.Context) {
 
 	var updateRequest UpdateProfileRequest
 	if err := c.ShouldBindJSON(&updateRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
@@ -76,14 +77,14 @@ func UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Model(&database.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
 		log.Printf("Failed to update profile: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
 	var updatedUser database.User
-	if err := database.DB.First(&updatedUser, userID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&updatedUser, userID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving updated profile"})
 		return
 	}
@@ -107,12 +108,12 @@ func ChangePassword(c *gin.Context) {
 
 	var changePassRequest ChangePasswordRequest
 	if err := c.ShouldBindJSON(&changePassRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	var user database.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
 		return
 	}
@@ -129,7 +130,7 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Model(&user).Update("password_hash", newPasswordHash).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Update("password_hash", newPasswordHash).Error; err != nil {
 		log.Printf("Failed to update password: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
 		return
@@ -154,7 +155,7 @@ func GetUserByID(c *gin.Context) {
 	}
 
 	var user database.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		} else {
@@ -182,7 +183,7 @@ func GetUsersByRole(c *gin.Context) {
 	}
 
 	var users []database.User
-	if err := database.DB.Where("role = ?", userRole).Find(&users).Error; err != nil {
+	if err := includeDeleted(c, database.DB.WithContext(c.Request.Context())).Where("role = ?", userRole).Find(&users).Error; err != nil {
 		log.Printf("DB error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
 		return
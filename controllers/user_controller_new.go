@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"aquahome/apperror"
 	"aquahome/database"
 	"aquahome/utils"
 	"errors"
@@ -32,7 +33,7 @@ func GetUserProfileNew(c *gin.Context) {
 	}
 
 	var user database.User
-	err := database.DB.Where("id = ?", userIDUint).First(&user).Error
+	err := database.DB.WithContext(c.Request.Context()).Where("id = ?", userIDUint).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -58,6 +59,7 @@ type UpdateProfileRequestNew struct {
 	City    string `json:"city"`
 	State   string `json:"state"`
 	ZipCode string `json:"zip_code"`
+	Locale  string `json:"locale"`
 }
 
 // UpdateUserProfileNew updates the profile of the authenticated user using GORM
@@ -81,13 +83,13 @@ func UpdateUserProfileNew(c *gin.Context) {
 
 	var updateRequest UpdateProfileRequestNew
 	if err := c.ShouldBindJSON(&updateRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Retrieve user first
 	var user database.User
-	err := database.DB.Where("id = ?", userIDUint).First(&user).Error
+	err := database.DB.WithContext(c.Request.Context()).Where("id = ?", userIDUint).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -118,11 +120,18 @@ func UpdateUserProfileNew(c *gin.Context) {
 	if updateRequest.ZipCode != "" {
 		updateMap["zip_code"] = updateRequest.ZipCode
 	}
+	if updateRequest.Locale != "" {
+		if !localePattern.MatchString(updateRequest.Locale) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "locale must look like en or hi-IN"})
+			return
+		}
+		updateMap["locale"] = updateRequest.Locale
+	}
 	updateMap["updated_at"] = time.Now()
 
 	// Update the user
 	if len(updateMap) > 0 {
-		err = database.DB.Model(&user).Updates(updateMap).Error
+		err = database.DB.WithContext(c.Request.Context()).Model(&user).Updates(updateMap).Error
 		if err != nil {
 			log.Printf("Database error: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile"})
@@ -131,17 +140,28 @@ func UpdateUserProfileNew(c *gin.Context) {
 	}
 
 	// Get updated user profile
-	err = database.DB.Where("id = ?", userIDUint).First(&user).Error
+	err = database.DB.WithContext(c.Request.Context()).Where("id = ?", userIDUint).First(&user).Error
 	if err != nil {
 		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving updated profile"})
 		return
 	}
 
+	// Re-geocode after an address change so franchise matching stays accurate
+	if updateRequest.Address != "" || updateRequest.City != "" || updateRequest.State != "" || updateRequest.ZipCode != "" {
+		geocodeUser(&user)
+		if err := database.DB.WithContext(c.Request.Context()).Model(&user).Updates(map[string]interface{}{
+			"latitude":  user.Latitude,
+			"longitude": user.Longitude,
+		}).Error; err != nil {
+			log.Printf("Error saving coordinates for user %d: %v", user.ID, err)
+		}
+	}
+
 	// 🔁 Auto-create franchise if role is franchise_owner and no franchise is linked
 	if user.Role == "franchise_owner" && user.FranchiseID == nil {
 		var existingFranchise database.Franchise
-		err := database.DB.Where("owner_id = ?", user.ID).First(&existingFranchise).Error
+		err := database.DB.WithContext(c.Request.Context()).Where("owner_id = ?", user.ID).First(&existingFranchise).Error
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			franchise := database.Franchise{
 				OwnerID:       user.ID,
@@ -156,11 +176,11 @@ func UpdateUserProfileNew(c *gin.Context) {
 				ApprovalState: "approved",
 			}
 
-			if err := database.DB.Create(&franchise).Error; err != nil {
+			if err := database.DB.WithContext(c.Request.Context()).Create(&franchise).Error; err != nil {
 				log.Printf("❌ Failed to create franchise for user ID %d: %v", user.ID, err)
 			} else {
 				user.FranchiseID = &franchise.ID
-				if err := database.DB.Save(&user).Error; err != nil {
+				if err := database.DB.WithContext(c.Request.Context()).Save(&user).Error; err != nil {
 					log.Printf("❌ Failed to update user with new franchise ID: %v", err)
 				} else {
 					log.Printf("✅ Franchise (ID %d) created and linked to user ID %d", franchise.ID, user.ID)
@@ -202,13 +222,13 @@ func ChangePasswordNew(c *gin.Context) {
 
 	var changePassRequest ChangePasswordRequestNew
 	if err := c.ShouldBindJSON(&changePassRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	// Get user with current password hash
 	var user database.User
-	err := database.DB.Select("id, password_hash").Where("id = ?", userIDUint).First(&user).Error
+	err := database.DB.WithContext(c.Request.Context()).Select("id, password_hash").Where("id = ?", userIDUint).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -234,7 +254,7 @@ func ChangePasswordNew(c *gin.Context) {
 	}
 
 	// Update password
-	err = database.DB.Model(&user).Updates(map[string]interface{}{
+	err = database.DB.WithContext(c.Request.Context()).Model(&user).Updates(map[string]interface{}{
 		"password_hash": newPasswordHash,
 		"updated_at":    time.Now(),
 	}).Error
@@ -263,7 +283,7 @@ func GetUserByIDNew(c *gin.Context) {
 	}
 
 	var user database.User
-	err = database.DB.Where("id = ?", uint(userID)).First(&user).Error
+	err = database.DB.WithContext(c.Request.Context()).Where("id = ?", uint(userID)).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -296,7 +316,7 @@ func GetUsersByRoleNew(c *gin.Context) {
 	}
 
 	var users []database.User
-	err := database.DB.Where("role = ?", userRole).Find(&users).Error
+	err := database.DB.WithContext(c.Request.Context()).Where("role = ?", userRole).Find(&users).Error
 	if err != nil {
 		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
@@ -324,12 +344,12 @@ func UpdateUserLocation(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		apperror.Respond(c, apperror.Binding(err))
 		return
 	}
 
 	var user database.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -337,7 +357,7 @@ func UpdateUserLocation(c *gin.Context) {
 	user.Latitude = req.Latitude
 	user.Longitude = req.Longitude
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
 		return
 	}
@@ -357,7 +377,7 @@ func GetServiceAgentsForFranchise(c *gin.Context) {
 	}
 
 	var agents []database.User
-	if err := database.DB.
+	if err := database.DB.WithContext(c.Request.Context()).
 		Where("role = ?", "service_agent").
 		Find(&agents).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service agents"})
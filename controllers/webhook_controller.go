@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/config"
+	"aquahome/metrics"
+)
+
+// RazorpayWebhookEvent is the envelope Razorpay posts to the webhook endpoint
+type RazorpayWebhookEvent struct {
+	Event     string                           `json:"event"`
+	Payload   map[string]razorpayWebhookEntity `json:"payload"`
+	CreatedAt int64                            `json:"created_at"` // Unix seconds
+}
+
+type razorpayWebhookEntity struct {
+	Entity map[string]interface{} `json:"entity"`
+}
+
+// entity returns the named payload entity (e.g. "payment", "subscription")
+func (e RazorpayWebhookEvent) entity(name string) map[string]interface{} {
+	if wrapper, ok := e.Payload[name]; ok && wrapper.Entity != nil {
+		return wrapper.Entity
+	}
+	return map[string]interface{}{}
+}
+
+// occurredAt is when Razorpay raised the event, or now when it doesn't say
+func (e RazorpayWebhookEvent) occurredAt() time.Time {
+	if e.CreatedAt == 0 {
+		return time.Now()
+	}
+	return time.Unix(e.CreatedAt, 0)
+}
+
+// RazorpayWebhook verifies and dispatches Razorpay webhook events
+func RazorpayWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	signature := c.GetHeader("X-Razorpay-Signature")
+	if config.AppConfig.RazorpayWebhookSecret == "" ||
+		!verifyRazorpaySignature(string(body), signature, config.AppConfig.RazorpayWebhookSecret) {
+		metrics.RazorpayCalls.Inc("webhook_verify", "failure")
+		log.Printf("Razorpay webhook signature verification failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+	metrics.RazorpayCalls.Inc("webhook_verify", "success")
+
+	var event RazorpayWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	}
+
+	log.Printf("Razorpay webhook received: %s", event.Event)
+
+	switch event.Event {
+	case "subscription.charged":
+		err = handleSubscriptionCharged(event)
+	case "subscription.authenticated", "subscription.activated", "subscription.pending",
+		"subscription.halted", "subscription.cancelled", "subscription.completed":
+		err = handleSubscriptionStatusChange(event)
+	case "payout.queued", "payout.pending", "payout.processing", "payout.processed",
+		"payout.reversed", "payout.failed", "payout.rejected", "payout.updated":
+		err = handlePayoutEvent(event)
+	case "payment_link.paid", "payment_link.partially_paid", "payment_link.expired", "payment_link.cancelled":
+		err = handlePaymentLinkEvent(event)
+	case "payment.dispute.created", "payment.dispute.won", "payment.dispute.lost", "payment.dispute.closed",
+		"payment.dispute.under_review", "payment.dispute.action_required":
+		err = handleDisputeEvent(event)
+	default:
+		// Events we don't subscribe to are acknowledged so Razorpay stops retrying
+	}
+
+	if err != nil {
+		// A non-2xx response makes Razorpay retry the delivery
+		log.Printf("Error handling Razorpay webhook %s: %v", event.Event, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// mapString reads a string field from a Razorpay response map
+func mapString(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// mapFloat reads a numeric field from a Razorpay response map
+func mapFloat(m map[string]interface{}, key string) float64 {
+	if v, ok := m[key].(float64); ok {
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/apperror"
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/jobs"
+	"aquahome/utils"
+)
+
+// WebhookEndpointRequest registers or updates an outbound webhook endpoint
+type WebhookEndpointRequest struct {
+	Name     string   `json:"name" binding:"required,max=100"`
+	URL      string   `json:"url" binding:"required,url,max=500"`
+	Events   []string `json:"events" binding:"required,min=1"`
+	IsActive *bool    `json:"is_active"`
+}
+
+// WebhookEndpointCreatedResponse carries the signing secret, shown only once
+type WebhookEndpointCreatedResponse struct {
+	database.WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// validateWebhookEndpoint checks the URL and events of an endpoint request.
+// It writes the error response and returns false when they are invalid.
+func validateWebhookEndpoint(c *gin.Context, req WebhookEndpointRequest) bool {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "https" && !(config.IsDevelopment() && target.Scheme == "http")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URLs must use https"})
+		return false
+	}
+	for _, event := range req.Events {
+		if _, ok := database.AllWebhookEvents[event]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event: " + event})
+			return false
+		}
+	}
+	return true
+}
+
+// webhookEndpointForRequest loads the endpoint named by :id. It writes the
+// error response and returns false on failure.
+func webhookEndpointForRequest(c *gin.Context) (database.WebhookEndpoint, bool) {
+	var endpoint database.WebhookEndpoint
+	if err := database.DB.WithContext(c.Request.Context()).First(&endpoint, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook endpoint not found"})
+		} else {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		}
+		return endpoint, false
+	}
+	return endpoint, true
+}
+
+// GetWebhookEvents lists the events endpoints can subscribe to (Admin only)
+func GetWebhookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, database.AllWebhookEvents)
+}
+
+// GetWebhookEndpoints lists outbound webhook endpoints (Admin only)
+func GetWebhookEndpoints(c *gin.Context) {
+	var endpoints []database.WebhookEndpoint
+	if err := database.DB.WithContext(c.Request.Context()).Order("id DESC").Find(&endpoints).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook endpoints"})
+		return
+	}
+	c.JSON(http.StatusOK, endpoints)
+}
+
+// CreateWebhookEndpoint registers an endpoint for the chosen events. The
+// response holds the only copy of its signing secret. (Admin only)
+func CreateWebhookEndpoint(c *gin.Context) {
+	var req WebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validateWebhookEndpoint(c, req) {
+		return
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Printf("Webhook secret error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	endpoint := database.WebhookEndpoint{
+		Name:      req.Name,
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    "whsec_" + secret,
+		IsActive:  req.IsActive == nil || *req.IsActive,
+		CreatedBy: c.GetUint("user_id"),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&endpoint).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook endpoint"})
+		return
+	}
+
+	recordAudit(c, nil, "webhook_endpoint.create", "webhook_endpoint", endpoint.ID, nil, endpoint)
+	c.JSON(http.StatusCreated, WebhookEndpointCreatedResponse{WebhookEndpoint: endpoint, Secret: endpoint.Secret})
+}
+
+// UpdateWebhookEndpoint changes an endpoint's URL, events or state (Admin only)
+func UpdateWebhookEndpoint(c *gin.Context) {
+	endpoint, ok := webhookEndpointForRequest(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.Binding(err))
+		return
+	}
+	if !validateWebhookEndpoint(c, req) {
+		return
+	}
+
+	before := endpoint
+	endpoint.Name = req.Name
+	endpoint.URL = req.URL
+	endpoint.Events = req.Events
+	if req.IsActive != nil {
+		endpoint.IsActive = *req.IsActive
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Save(&endpoint).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook endpoint"})
+		return
+	}
+
+	recordAudit(c, nil, "webhook_endpoint.update", "webhook_endpoint", endpoint.ID, before, endpoint)
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// DeleteWebhookEndpoint removes an endpoint; deliveries still queued for it
+// are given up (Admin only)
+func DeleteWebhookEndpoint(c *gin.Context) {
+	endpoint, ok := webhookEndpointForRequest(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.WebhookDelivery{}).
+			Where("endpoint_id = ? AND status = ?", endpoint.ID, database.WebhookDeliveryPending).
+			Updates(map[string]interface{}{
+				"status":          database.WebhookDeliveryFailed,
+				"next_attempt_at": nil,
+				"last_error":      "endpoint deleted",
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&endpoint).Error
+	})
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook endpoint"})
+		return
+	}
+
+	recordAudit(c, nil, "webhook_endpoint.delete", "webhook_endpoint", endpoint.ID, endpoint, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook endpoint deleted"})
+}
+
+// GetWebhookDeliveries is the delivery log of an endpoint, newest first (Admin only)
+// GET /api/admin/webhooks/:id/deliveries?status=&event=&page=&limit=
+func GetWebhookDeliveries(c *gin.Context) {
+	endpoint, ok := webhookEndpointForRequest(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&database.WebhookDelivery{}).Where("endpoint_id = ?", endpoint.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	var deliveries []database.WebhookDelivery
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&deliveries).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries, "total": total, "page": page, "limit": limit})
+}
+
+// RedeliverWebhook sends a delivery again right away, whatever its status.
+// The retry schedule starts over. (Admin only)
+// POST /api/admin/webhook-deliveries/:id/redeliver
+func RedeliverWebhook(c *gin.Context) {
+	var delivery database.WebhookDelivery
+	if err := database.DB.WithContext(c.Request.Context()).First(&delivery, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.WithContext(c.Request.Context()).Model(&delivery).Updates(map[string]interface{}{
+		"status":          database.WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+	}).Error; err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver"})
+		return
+	}
+	if err := jobs.DeliverWebhook(delivery.ID); err != nil {
+		log.Printf("Webhook delivery %d failed: %v", delivery.ID, err)
+	}
+
+	database.DB.WithContext(c.Request.Context()).First(&delivery, delivery.ID)
+	recordAudit(c, nil, "webhook_delivery.redeliver", "webhook_delivery", delivery.ID, nil, nil)
+	c.JSON(http.StatusOK, delivery)
+}
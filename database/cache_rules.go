@@ -0,0 +1,21 @@
+package database
+
+import (
+	"aquahome/cache"
+)
+
+// cacheInvalidation lists which cached responses go stale when a table changes
+var cacheInvalidation = map[string][]string{
+	"products":            {cache.PrefixProducts, cache.PrefixDashboard},
+	"product_variants":    {cache.PrefixProducts},
+	"rental_plans":        {cache.PrefixProducts},
+	"product_images":      {cache.PrefixProducts},
+	"franchises":          {cache.PrefixProducts, cache.PrefixLocations, cache.PrefixDashboard},
+	"locations":           {cache.PrefixLocations, cache.PrefixDashboard},
+	"franchise_locations": {cache.PrefixLocations, cache.PrefixDashboard},
+	"users":               {cache.PrefixDashboard},
+	"orders":              {cache.PrefixDashboard},
+	"subscriptions":       {cache.PrefixDashboard},
+	"service_requests":    {cache.PrefixDashboard},
+	"payments":            {cache.PrefixDashboard},
+}
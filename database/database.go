@@ -3,32 +3,57 @@ package database
 import (
 	"fmt"
 	"log"
+	"os"
+	"time"
 
+	"aquahome/cache"
 	"aquahome/config"
+	"aquahome/metrics"
 
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 var DB *gorm.DB
 
+// replicaResolver names the resolver that sends reads to the replicas. Only
+// queries made through ReadDB use it, so a request reads its own writes.
+const replicaResolver = "replicas"
+
+// hasReplicas is set when read replicas are configured
+var hasReplicas bool
+
+// ReadDB returns the connection for heavy reads that tolerate replication
+// lag, such as dashboards, reports and exports. Reads go to a replica when
+// any are configured, else to the primary; writes always go to the primary.
+func ReadDB() *gorm.DB {
+	if !hasReplicas {
+		return DB
+	}
+	return DB.Clauses(dbresolver.Use(replicaResolver))
+}
+
 // InitDB initializes the database connection using environment/config
 func InitDB() error {
-	// Setup logging mode for GORM
+	// Log every query in development; elsewhere only errors and queries
+	// slower than DB_SLOW_QUERY_MS
+	logLevel := logger.Warn
+	if config.AppConfig.Environment == config.ProfileDevelopment {
+		logLevel = logger.Info
+	}
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold: time.Duration(config.AppConfig.DBSlowQueryMS) * time.Millisecond,
+			LogLevel:      logLevel,
+			Colorful:      true,
+		}),
 	}
 
 	if config.AppConfig.DBDriver == "postgres" {
-		dsn := fmt.Sprintf(
-			"host=%s port=%s user=%s password=%s dbname=%s sslmode=require TimeZone=UTC",
-			config.AppConfig.DBHost,
-			config.AppConfig.DBPort,
-			config.AppConfig.DBUser,
-			config.AppConfig.DBPassword,
-			config.AppConfig.DBName,
-		)
+		dsn := config.AppConfig.DSN()
 
 		log.Printf("🔌 Connecting to PostgreSQL at host=%s port=%s db=%s...",
 			config.AppConfig.DBHost,
@@ -44,6 +69,40 @@ func InitDB() error {
 		}
 
 		log.Println("✅ PostgreSQL connection successful.")
+
+		if replicas := config.AppConfig.DBReplicaDSNs; len(replicas) > 0 {
+			dialectors := make([]gorm.Dialector, len(replicas))
+			for i, replicaDSN := range replicas {
+				dialectors[i] = postgres.Open(replicaDSN)
+			}
+			if err := DB.Use(dbresolver.Register(dbresolver.Config{
+				Replicas: dialectors,
+				Policy:   dbresolver.RandomPolicy{},
+			}, replicaResolver)); err != nil {
+				log.Printf("❌ Failed to connect to read replicas: %v", err)
+				return err
+			}
+			hasReplicas = true
+			log.Printf("✅ Reading reports from %d replica(s).", len(replicas))
+		}
+
+		if err := metrics.InstrumentGORM(DB); err != nil {
+			log.Printf("⚠️ Failed to register query metrics: %v", err)
+		}
+		if err := DB.Use(otelgorm.NewPlugin(
+			otelgorm.WithDBName(config.AppConfig.DBName),
+			otelgorm.WithoutQueryVariables(), // keep hashes and personal data out of spans
+			otelgorm.WithoutMetrics(),
+		)); err != nil {
+			log.Printf("⚠️ Failed to register query tracing: %v", err)
+		}
+		if err := cache.InvalidateOnWrite(DB, cacheInvalidation); err != nil {
+			log.Printf("⚠️ Failed to register cache invalidation: %v", err)
+		}
+		if err := RegisterTenantScope(DB); err != nil {
+			log.Printf("❌ Failed to register tenant scoping: %v", err)
+			return err
+		}
 		return nil
 	}
 
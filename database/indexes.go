@@ -0,0 +1,122 @@
+package database
+
+import (
+	"fmt"
+	"log"
+)
+
+// hotQueryIndexes back the filters and sort orders of the busiest lists.
+// Service request lists join through subscriptions to franchises, filter on
+// the customer, the agent or the owner's franchises and sort newest first;
+// the partial indexes skip soft-deleted rows as GORM's queries do.
+var hotQueryIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_service_requests_customer_created ON service_requests (customer_id, created_at DESC) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_service_requests_agent_created ON service_requests (service_agent_id, created_at DESC) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_service_requests_franchise_status ON service_requests (franchise_id, status) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_service_requests_status_created ON service_requests (status, created_at DESC) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_service_requests_subscription ON service_requests (subscription_id)",
+	"CREATE INDEX IF NOT EXISTS idx_subscriptions_franchise ON subscriptions (franchise_id)",
+	"CREATE INDEX IF NOT EXISTS idx_subscriptions_customer ON subscriptions (customer_id)",
+	"CREATE INDEX IF NOT EXISTS idx_franchises_owner ON franchises (owner_id)",
+	"CREATE INDEX IF NOT EXISTS idx_orders_customer_created ON orders (customer_id, created_at DESC) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_orders_franchise_created ON orders (franchise_id, created_at DESC) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_payments_customer_created ON payments (customer_id, created_at DESC) WHERE deleted_at IS NULL",
+	"CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at DESC) WHERE deleted_at IS NULL",
+}
+
+// uniqueIndexes keep webhook retries from recording a gateway payment twice;
+// inserts that may repeat one use ON CONFLICT against them, so they fail
+// without the index and startup stops when one can't be built
+var uniqueIndexes = []string{
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_transaction_id ON payments (transaction_id) WHERE transaction_id <> ''",
+}
+
+// dedupePaymentTransactions clears out payments recorded more than once under
+// one gateway transaction, which would stop idx_payments_transaction_id from
+// being built. The live row with the lowest ID is kept; the others are
+// soft-deleted and their transaction ID is suffixed with their own ID.
+const dedupePaymentTransactions = `WITH ranked AS (
+	SELECT id, ROW_NUMBER() OVER (PARTITION BY transaction_id ORDER BY deleted_at IS NOT NULL, id) AS n
+	FROM payments WHERE transaction_id <> ''
+)
+UPDATE payments SET deleted_at = COALESCE(payments.deleted_at, NOW()), transaction_id = payments.transaction_id || ':dup' || payments.id
+FROM ranked WHERE ranked.id = payments.id AND ranked.n > 1`
+
+// retiredIndexes were replaced by indexes that take the tenant into account:
+// coupon codes and blacklisted values are unique per tenant
+var retiredIndexes = []string{
+	"DROP INDEX IF EXISTS idx_coupons_code",
+	"DROP INDEX IF EXISTS idx_blacklist_value",
+}
+
+// foreignKey is a constraint GORM doesn't create, as the model has no
+// relation field for it
+type foreignKey struct {
+	name       string
+	table      string
+	column     string
+	references string
+	onDelete   string
+}
+
+// foreignKeys tie rows to the service requests and agents they belong to.
+// Service reports and assignment responses outlive archived service
+// requests, so only their agents are constrained.
+var foreignKeys = []foreignKey{
+	{"fk_service_request_attachments_service_request", "service_request_attachments", "service_request_id", "service_requests (id)", "CASCADE"},
+	{"fk_service_request_attachments_uploader", "service_request_attachments", "uploaded_by", "users (id)", "RESTRICT"},
+	{"fk_service_reports_agent", "service_reports", "agent_id", "users (id)", "RESTRICT"},
+	{"fk_service_assignment_responses_agent", "service_assignment_responses", "agent_id", "users (id)", "RESTRICT"},
+}
+
+// EnsureIndexes creates the indexes for hot queries and the foreign keys
+// AutoMigrate leaves out, and drops retired indexes. Foreign keys are added NOT VALID, so rows from
+// before the constraint don't stop startup while new rows are checked.
+// Failures there are logged rather than fatal: queries still work, only
+// slower or less guarded. A unique index that can't be built is returned as
+// an error, as the inserts relying on it would all fail.
+func EnsureIndexes() error {
+	var built int64
+	if err := DB.Raw("SELECT COUNT(*) FROM pg_indexes WHERE indexname = ?", "idx_payments_transaction_id").Scan(&built).Error; err != nil {
+		return fmt.Errorf("check payment transaction index: %w", err)
+	}
+	if built == 0 {
+		result := DB.Exec(dedupePaymentTransactions)
+		if result.Error != nil {
+			return fmt.Errorf("remove duplicate payment transactions: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("⚠️ Soft-deleted %d payments recorded twice under one transaction ID", result.RowsAffected)
+		}
+	}
+	for _, statement := range uniqueIndexes {
+		if err := DB.Exec(statement).Error; err != nil {
+			return fmt.Errorf("create unique index: %w", err)
+		}
+	}
+
+	for _, statements := range [][]string{hotQueryIndexes, retiredIndexes} {
+		for _, statement := range statements {
+			if err := DB.Exec(statement).Error; err != nil {
+				log.Printf("⚠️ Failed to create index: %v", err)
+			}
+		}
+	}
+
+	for _, fk := range foreignKeys {
+		var exists int64
+		if err := DB.Raw("SELECT COUNT(*) FROM pg_constraint WHERE conname = ?", fk.name).Scan(&exists).Error; err != nil {
+			log.Printf("⚠️ Failed to check foreign key %s: %v", fk.name, err)
+			continue
+		}
+		if exists > 0 {
+			continue
+		}
+		statement := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s ON DELETE %s NOT VALID",
+			fk.table, fk.name, fk.column, fk.references, fk.onDelete)
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("⚠️ Failed to add foreign key %s: %v", fk.name, err)
+		}
+	}
+	return nil
+}
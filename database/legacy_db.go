@@ -22,20 +22,10 @@ func InitLegacyDB() error {
 
 	switch config.AppConfig.DBDriver {
 	case "postgres":
-		dbURL := os.Getenv("DATABASE_URL")
-		var connStr string
-
-		if dbURL != "" {
-			connStr = dbURL
+		connStr := config.AppConfig.DSN()
+		if config.AppConfig.DatabaseURL != "" {
 			log.Println("Using DATABASE_URL for PostgreSQL legacy DB")
 		} else {
-			connStr = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=require",
-				config.AppConfig.DBHost,
-				config.AppConfig.DBPort,
-				config.AppConfig.DBUser,
-				config.AppConfig.DBPassword,
-				config.AppConfig.DBName,
-			)
 			log.Printf("Connecting to legacy DB: host=%s port=%s user=%s dbname=%s",
 				config.AppConfig.DBHost,
 				config.AppConfig.DBPort,
@@ -15,6 +15,7 @@ func RunMigrations() error {
 		&User{},
 		&Product{},
 		&Franchise{},
+		&Tenant{},
 		&Location{},          // ✅ Service ZIPs
 		&FranchiseLocation{}, // ✅ Join table for Franchise ↔ Location
 		&Order{},
@@ -22,13 +23,85 @@ func RunMigrations() error {
 		&ServiceRequest{},
 		&Payment{},
 		&Notification{},
-		&PasswordReset{},
+		&PasswordResetToken{},
+		&EmailVerificationToken{},
 		&Audit{},
 		&AuditLog{},
+		&Mandate{},
+		&FranchiseWorkingHours{},
+		&Role{},
+		&Permission{},
+		&Session{},
+		&PhoneOTP{},
+		&DataExport{},
+		&AccountDeletion{},
+		&ProductVariant{},
+		&RentalPlan{},
+		&ProductImage{},
+		&InventoryItem{},
+		&StockMovement{},
+		&Coupon{},
+		&CouponRedemption{},
+		&DepositSettlement{},
+		&DepositDeduction{},
+		&WalletTransaction{},
+		&DunningEvent{},
+		&OrderStatusHistory{},
+		&InstallationOTP{},
+		&InstallationReport{},
+		&InstallationPhoto{},
+		&ServiceReport{},
+		&ServiceReportPart{},
+		&ServiceReportPhoto{},
+		&FranchiseTerritory{},
+		&Settlement{},
+		&FranchiseBankAccount{},
+		&SettlementPayout{},
+		&Address{},
+		&NotificationTemplate{},
+		&Announcement{},
+		&ServiceAssignmentResponse{},
+		&ServiceRequestAttachment{},
+		&TwoFactorBackupCode{},
+		&SecurityPolicy{},
+		&MaintenanceMode{},
+		&Alert{},
+		&Lead{},
+		&AppointmentReminder{},
+		&PaymentVerificationFailure{},
+		&APIKey{},
+		&WebhookEndpoint{},
+		&WebhookDelivery{},
+		&OutboxEvent{},
+		&NotificationDelivery{},
+		&DirectUpload{},
+		&ArchivedRecord{},
+		&PushDevice{},
+		&RentalAgreement{},
+		&CashDeposit{},
+		&PaymentLink{},
+		&LedgerAccount{},
+		&LedgerEntry{},
+		&CreditNote{},
+		&Dispute{},
+		&DisputeEvidence{},
+		&BlacklistEntry{},
+		&RiskOverride{},
+		&FranchiseMember{},
+		&AgentShift{},
+		&AgentLeave{},
+		&InvoiceDocument{},
 	); err != nil {
 		log.Printf("Migration failed: %v", err)
 		return err
 	}
+	EnsureSearchIndexes()
+	if err := EnsureIndexes(); err != nil {
+		log.Printf("Migration failed: %v", err)
+		return err
+	}
+	EnsureDefaultTenant()
+	BackfillTenants()
 
 	log.Println("Database migrations completed successfully")
 	return nil
@@ -10,6 +10,7 @@ import (
 // User represents a user in the system
 type User struct {
 	gorm.Model
+	TenantID     uint   `gorm:"not null;default:1;index" json:"tenant_id"`
 	Name         string `json:"name"`
 	Email        string `json:"email"`
 	Password     string `json:"-"`
@@ -24,11 +25,29 @@ type User struct {
 	// models/user.go
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	ProfilePicture  string     `json:"profile_picture"` // avatar URL
+	GoogleID        string     `gorm:"index" json:"-"`
+	Locale          string     `json:"locale"` // notification language; empty uses the default locale
+
+	// Authenticator app for two-factor login; the secret is pending until
+	// the first code confirms it
+	TwoFactorSecret    string     `json:"-"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+	TwoFactorLastStep  int64      `json:"-"` // last TOTP step used, so codes can't be replayed
+
+	// The login waiting for a two-factor code and how many codes were tried
+	// against it; it is given up after a few wrong codes
+	TwoFactorChallengeID string `gorm:"size:64" json:"-"`
+	TwoFactorAttempts    int    `json:"-"`
 }
 
 // Product represents a water purifier product
 type Product struct {
 	gorm.Model
+	TenantID         uint      `gorm:"not null;default:1;index" json:"tenant_id"`
 	Name             string    `json:"name"`
 	Description      string    `json:"description"`
 	MonthlyRent      float64   `json:"monthly_rent"`
@@ -41,12 +60,19 @@ type Product struct {
 	MaintenanceCycle int       `json:"maintenance_cycle"`
 	IsActive         bool      `json:"is_active" gorm:"column:is_active"` // ED THIS
 	FranchiseID      uint      `json:"franchise_id"`                      // ✅ NEW
+	HSNCode          string    `json:"hsn_code"`
+	GSTRate          *float64  `json:"gst_rate"` // percent; nil uses the configured default
 	Franchise        Franchise `gorm:"foreignKey:FranchiseID" json:"franchise"`
+
+	Variants []ProductVariant `gorm:"foreignKey:ProductID" json:"variants,omitempty"`
+	Plans    []RentalPlan     `gorm:"foreignKey:ProductID" json:"plans,omitempty"`
+	Images   []ProductImage   `gorm:"foreignKey:ProductID" json:"images,omitempty"`
 }
 
 // Franchise repreents a franchise location
 type Franchise struct {
 	gorm.Model
+	TenantID       uint    `gorm:"not null;default:1;index" json:"tenant_id"`
 	OwnerID        uint    `json:"owner_id"`
 	Name           string  `json:"name"`
 	Address        string  `json:"address"`
@@ -59,6 +85,13 @@ type Franchise struct {
 	ServiceArea    string  `json:"service_area"`
 	CoverageRadius float64 `json:"coverage_radius"`
 	ApprovalState  string  `json:"approval_state"`
+	GSTIN          string  `json:"gstin"`
+
+	// Percent of net collections paid out to the franchise; nil uses the configured default
+	RevenueShare *float64 `json:"revenue_share"`
+
+	// RazorpayX contact that settlement payouts are made to
+	RazorpayContactID string `json:"-"`
 
 	Owner User `gorm:"foreignKey:OwnerID" json:"owner"`
 
@@ -70,6 +103,8 @@ type Franchise struct {
 type Location struct {
 	gorm.Model
 	Name       string         `json:"name"`
+	City       string         `json:"city"`
+	State      string         `json:"state"`
 	ZipCodes   pq.StringArray `gorm:"type:text[]" json:"zip_codes"` // comma-separated ZIPs
 	IsActive   bool           `json:"is_active"`
 	Franchises []Franchise    `gorm:"many2many:franchise_locations;" json:"franchises"`
@@ -85,32 +120,45 @@ type FranchiseLocation struct {
 // Order represents a customer order
 type Order struct {
 	gorm.Model
+	TenantID uint `gorm:"not null;default:1;index" json:"tenant_id"`
 	// ID                 uint      `json:"id"`
-	CustomerID         uint      `json:"customer_id"`
-	ProductID          uint      `json:"product_id"`
-	FranchiseID        uint      `json:"franchise_id"`
-	OrderType          string    `json:"order_type"`
-	ServiceAgentID     *uint     `json:"service_agent_id"`
-	Status             string    `json:"status"`
-	ShippingAddress    string    `json:"shipping_address"`
-	BillingAddress     string    `json:"billing_address"`
-	RentalStartDate    time.Time `json:"rental_start_date"`
-	RentalDuration     int       `json:"rental_duration"`
-	MonthlyRent        float64   `json:"monthly_rent"`
-	DeliveryDate       time.Time `json:"delivery_date"`
-	SecurityDeposit    float64   `json:"security_deposit"`
-	InstallationFee    float64   `json:"installation_fee"`
-	TotalInitialAmount float64   `json:"total_initial_amount"`
-	Notes              string    `json:"notes"`
-	Customer           User      `gorm:"foreignKey:CustomerID" json:"customer"`
-	Product            Product   `gorm:"foreignKey:ProductID" json:"product"`
-	Franchise          Franchise `gorm:"foreignKey:FranchiseID" json:"franchise"`
-	ServiceAgent       *User     `gorm:"foreignKey:ServiceAgentID" json:"service_agent"`
+	CustomerID         uint       `json:"customer_id"`
+	ProductID          uint       `json:"product_id"`
+	VariantID          *uint      `json:"variant_id"`
+	PlanID             *uint      `json:"plan_id"`
+	PlanTerms          *PlanTerms `gorm:"serializer:json;type:text" json:"plan_terms,omitempty"` // the plan as ordered
+	CouponID           *uint      `json:"coupon_id"`
+	DiscountAmount     float64    `json:"discount_amount"`
+	FranchiseID        uint       `json:"franchise_id"`
+	OrderType          string     `json:"order_type"`
+	ServiceAgentID     *uint      `json:"service_agent_id"`
+	Status             string     `json:"status"`
+	ShippingAddress    string     `json:"shipping_address"`
+	BillingAddress     string     `json:"billing_address"`
+	ShippingAddressID  *uint      `json:"shipping_address_id"`
+	BillingAddressID   *uint      `json:"billing_address_id"`
+	RentalStartDate    time.Time  `json:"rental_start_date"`
+	RentalDuration     int        `json:"rental_duration"`
+	MonthlyRent        float64    `json:"monthly_rent"`
+	DeliveryDate       time.Time  `json:"delivery_date"`
+	SecurityDeposit    float64    `json:"security_deposit"`
+	InstallationFee    float64    `json:"installation_fee"`
+	TotalInitialAmount float64    `json:"total_initial_amount"`
+	TaxBreakdown       `gorm:"embedded"`
+	Notes              string     `json:"notes"`
+	CancellationReason string     `json:"cancellation_reason,omitempty"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy        *uint      `json:"cancelled_by,omitempty"`
+	Customer           User       `gorm:"foreignKey:CustomerID" json:"customer"`
+	Product            Product    `gorm:"foreignKey:ProductID" json:"product"`
+	Franchise          Franchise  `gorm:"foreignKey:FranchiseID" json:"franchise"`
+	ServiceAgent       *User      `gorm:"foreignKey:ServiceAgentID" json:"service_agent"`
 }
 
 // Subscription represents an active rental subscription
 type Subscription struct {
 	gorm.Model
+	TenantID         uint      `gorm:"not null;default:1;index" json:"tenant_id"`
 	OrderID          uint      `json:"order_id"`
 	CustomerID       uint      `json:"customer_id"`
 	ProductID        uint      `json:"product_id"`
@@ -121,76 +169,127 @@ type Subscription struct {
 	EndDate          time.Time `json:"end_date"`
 	NextBillingDate  time.Time `json:"next_billing_date"`
 	MonthlyRent      float64   `json:"monthly_rent"`
+	ServicesPerYear  int       `json:"services_per_year"` // from the plan ordered; 0 uses the product's cycle
 	LastMaintenance  time.Time `json:"last_maintenance"`
 	NextMaintenance  time.Time `json:"next_maintenance"`
 	MaintenanceNotes string    `json:"maintenance_notes"`
 	Notes            string    `json:"notes"`
-	Order            Order     `gorm:"foreignKey:OrderID" json:"order"`
-	Customer         User      `gorm:"foreignKey:CustomerID" json:"customer"`
-	Product          Product   `gorm:"foreignKey:ProductID" json:"product"`
-	Franchise        Franchise `gorm:"foreignKey:FranchiseID" json:"franchise"`
-	ServiceAgent     *User     `gorm:"foreignKey:ServiceAgentID" json:"service_agent"`
+
+	OutstandingLateFee float64    `json:"outstanding_late_fee"` // collected with the next monthly payment
+	SuspendedAt        *time.Time `json:"suspended_at"`
+
+	Order        Order     `gorm:"foreignKey:OrderID" json:"order"`
+	Customer     User      `gorm:"foreignKey:CustomerID" json:"customer"`
+	Product      Product   `gorm:"foreignKey:ProductID" json:"product"`
+	Franchise    Franchise `gorm:"foreignKey:FranchiseID" json:"franchise"`
+	ServiceAgent *User     `gorm:"foreignKey:ServiceAgentID" json:"service_agent"`
 }
 
 // Payment represents a payment made in the system
 type Payment struct {
 	gorm.Model
-	CustomerID     uint          `json:"customer_id"`
-	OrderID        *uint         `json:"order_id"`
-	SubscriptionID *uint         `json:"subscription_id"`
-	Amount         float64       `json:"amount"`
-	PaymentType    string        `json:"payment_type"`
-	Status         string        `json:"status"`
-	InvoiceNumber  string        `json:"invoice_number"`
-	PaymentMethod  string        `json:"payment_method"`
-	TransactionID  string        `json:"transaction_id"`
-	PaymentDetails string        `json:"payment_details"`
-	Notes          string        `json:"notes"`
-	Customer       User          `gorm:"foreignKey:CustomerID" json:"customer"`
-	Order          *Order        `gorm:"foreignKey:OrderID" json:"order"`
-	Subscription   *Subscription `gorm:"foreignKey:SubscriptionID" json:"subscription"`
+	TenantID         uint    `gorm:"not null;default:1;index" json:"tenant_id"`
+	CustomerID       uint    `json:"customer_id"`
+	OrderID          *uint   `json:"order_id"`
+	SubscriptionID   *uint   `json:"subscription_id"`
+	Amount           float64 `json:"amount"`
+	PaymentType      string  `json:"payment_type"`
+	Status           string  `json:"status"`
+	InvoiceNumber    string  `json:"invoice_number"`
+	PaymentMethod    string  `json:"payment_method"`
+	TransactionID    string  `json:"transaction_id"`
+	PaymentDetails   string  `json:"payment_details"`
+	TaxBreakdown     `gorm:"embedded"`
+	Notes            string        `json:"notes"`
+	RazorpayRefundID string        `json:"razorpay_refund_id,omitempty"`
+	RefundedAt       *time.Time    `json:"refunded_at,omitempty"`
+	CollectedByID    *uint         `gorm:"index" json:"collected_by_id,omitempty"` // agent who took cash
+	ReconciledByID   *uint         `json:"reconciled_by_id,omitempty"`
+	ReconciledAt     *time.Time    `json:"reconciled_at,omitempty"`
+	CreditApplied    float64       `json:"credit_applied"` // taken off the taxable amount by credit notes
+	Customer         User          `gorm:"foreignKey:CustomerID" json:"customer"`
+	Order            *Order        `gorm:"foreignKey:OrderID" json:"order"`
+	Subscription     *Subscription `gorm:"foreignKey:SubscriptionID" json:"subscription"`
 }
 
 // ServiceRequest represents a maintenance/service request
 type ServiceRequest struct {
 	gorm.Model
-	CustomerID     uint         `json:"customer_id"`
-	SubscriptionID uint         `json:"subscription_id"`
-	FranchiseID    uint         `json:"franchise_id"` // ✅ ADD THIS LINE
-	ServiceAgentID *uint        `json:"service_agent_id"`
-	Type           string       `json:"type"`
-	Status         string       `json:"status"`
-	Description    string       `json:"description"`
-	ScheduledTime  *time.Time   `json:"scheduled_time"`
-	CompletionTime *time.Time   `json:"completion_time"`
-	Notes          string       `json:"notes"`
-	Rating         *int         `json:"rating"`
-	Feedback       string       `json:"feedback"`
-	Customer       User         `gorm:"foreignKey:CustomerID" json:"customer"`
-	Subscription   Subscription `gorm:"foreignKey:SubscriptionID" json:"subscription"`
-	ServiceAgent   *User        `gorm:"foreignKey:ServiceAgentID" json:"service_agent"`
+	TenantID       uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	CustomerID     uint       `json:"customer_id"`
+	SubscriptionID uint       `json:"subscription_id"`
+	FranchiseID    uint       `json:"franchise_id"` // ✅ ADD THIS LINE
+	ServiceAgentID *uint      `json:"service_agent_id"`
+	Type           string     `json:"type"`
+	Status         string     `json:"status"`
+	Description    string     `json:"description"`
+	ScheduledTime  *time.Time `json:"scheduled_time"`
+	CompletionTime *time.Time `json:"completion_time"`
+	Notes          string     `json:"notes"`
+	Rating         *int       `json:"rating"`
+	Feedback       string     `json:"feedback"`
+
+	// Where and when the agent checked in and out on site
+	CheckInAt         *time.Time `json:"check_in_at"`
+	CheckInLatitude   float64    `json:"check_in_latitude"`
+	CheckInLongitude  float64    `json:"check_in_longitude"`
+	CheckInDistanceM  *float64   `json:"check_in_distance_m"` // from the customer; nil when their location is unknown
+	CheckOutAt        *time.Time `json:"check_out_at"`
+	CheckOutLatitude  float64    `json:"check_out_latitude"`
+	CheckOutLongitude float64    `json:"check_out_longitude"`
+
+	// When the current agent was assigned and accepted the job
+	AssignedAt *time.Time `json:"assigned_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+
+	// Service level target and how far an overdue request has been escalated
+	SLADueAt        *time.Time `gorm:"index" json:"sla_due_at"`
+	SLABreachedAt   *time.Time `json:"sla_breached_at"`
+	EscalationLevel int        `gorm:"default:0" json:"escalation_level"`
+	EscalatedAt     *time.Time `json:"escalated_at"`
+
+	Customer     User         `gorm:"foreignKey:CustomerID" json:"customer"`
+	Subscription Subscription `gorm:"foreignKey:SubscriptionID" json:"subscription"`
+	ServiceAgent *User        `gorm:"foreignKey:ServiceAgentID" json:"service_agent"`
 }
 
 // Notification represents a system notification
 type Notification struct {
 	gorm.Model
-	UserID      uint   `json:"user_id"`
-	Title       string `json:"title"`
-	Message     string `json:"message"`
-	Type        string `json:"type"`
-	RelatedID   *uint  `json:"related_id"`
-	RelatedType string `json:"related_type"`
-	IsRead      bool   `json:"is_read"`
-	User        User   `gorm:"foreignKey:UserID" json:"user"`
+	UserID      uint       `gorm:"index:idx_notifications_user_read" json:"user_id"`
+	Title       string     `json:"title"`
+	Message     string     `json:"message"`
+	Type        string     `json:"type"`
+	Event       string     `json:"event"`
+	RelatedID   *uint      `json:"related_id"`
+	RelatedType string     `json:"related_type"`
+	IsRead      bool       `gorm:"index:idx_notifications_user_read" json:"is_read"`
+	ReadAt      *time.Time `json:"read_at"`
+	User        User       `gorm:"foreignKey:UserID" json:"user"`
+}
+
+// PasswordResetToken represents a password reset request. The emailed link token
+// and OTP are stored hashed and each request can be used once.
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint       `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	OTPHash   string     `gorm:"size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	Attempts  int        `json:"attempts"` // wrong OTP guesses
+	RequestIP string     `json:"request_ip"`
+	User      User       `gorm:"foreignKey:UserID" json:"user"`
 }
 
-// PasswordReset represents a password reset request
-type PasswordReset struct {
+// EmailVerificationToken is a single-use link emailed to confirm a user's
+// email address; only the hash of the token is stored
+type EmailVerificationToken struct {
 	gorm.Model
-	UserID    uint      `json:"user_id"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
 }
 
 // Audit represents a system audit log entry
@@ -209,20 +308,22 @@ type Audit struct {
 
 // Constants for status values
 const (
-	OrderStatusPending   = "pending"
-	OrderStatusConfirmed = "confirmed"
-	OrderStatusApproved  = "approved"
-	OrderStatusRejected  = "rejected"
-	OrderStatusInTransit = "in_transit"
-	OrderStatusDelivered = "delivered"
-	OrderStatusInstalled = "installed"
-	OrderStatusCancelled = "cancelled"
-	OrderStatusCompleted = "completed"
+	OrderStatusPending    = "pending"
+	OrderStatusConfirmed  = "confirmed"
+	OrderStatusApproved   = "approved"
+	OrderStatusRejected   = "rejected"
+	OrderStatusInTransit  = "in_transit"
+	OrderStatusDelivered  = "delivered"
+	OrderStatusInstalled  = "installed"
+	OrderStatusCancelling = "cancelling" // claimed by a cancellation whose refund is going out
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusCompleted  = "completed"
 
 	SubscriptionStatusActive    = "active"
 	SubscriptionStatusPaused    = "paused"
 	SubscriptionStatusCancelled = "cancelled"
 	SubscriptionStatusExpired   = "expired"
+	SubscriptionStatusSuspended = "suspended" // rent overdue past the grace period
 
 	ServiceStatusPending    = "pending"
 	ServiceStatusAssigned   = "assigned"
@@ -236,10 +337,13 @@ const (
 	PaymentStatusSuccess  = "success"
 	PaymentStatusFailed   = "failed"
 	PaymentStatusRefunded = "refunded"
+	// Cash collected by an agent, awaiting the franchise's approval
+	PaymentStatusPendingReconciliation = "pending_reconciliation"
 
 	// User roles
 	RoleAdmin          = "admin"
 	RoleFranchiseOwner = "franchise_owner"
 	RoleServiceAgent   = "service_agent"
 	RoleCustomer       = "customer"
+	RoleFranchiseStaff = "franchise_staff"
 )
@@ -0,0 +1,18 @@
+package database
+
+import (
+	"time"
+)
+
+// AccountDeletion records an account that was deleted and anonymized. The
+// user row is kept (soft deleted, without PII) so financial records still
+// point at it.
+type AccountDeletion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  uint      `gorm:"not null;default:1;index" json:"tenant_id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Role      string    `json:"role"`
+	Reason    string    `json:"reason"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Address is an entry in a customer's address book. Orders keep a copy of
+// the formatted address alongside its ID, so later edits don't rewrite
+// past orders.
+type Address struct {
+	gorm.Model
+	UserID            uint    `gorm:"index" json:"user_id"`
+	Label             string  `json:"label"`
+	ContactName       string  `json:"contact_name"`
+	Phone             string  `json:"phone"`
+	Line1             string  `json:"line1"`
+	Line2             string  `json:"line2"`
+	City              string  `json:"city"`
+	State             string  `json:"state"`
+	ZipCode           string  `json:"zip_code"`
+	Latitude          float64 `json:"latitude"`
+	Longitude         float64 `json:"longitude"`
+	IsDefaultShipping bool    `json:"is_default_shipping"`
+	IsDefaultBilling  bool    `json:"is_default_billing"`
+}
+
+// Formatted returns the address as a single line
+func (a Address) Formatted() string {
+	var parts []string
+	for _, part := range []string{a.Line1, a.Line2, a.City, a.State, a.ZipCode} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AgentShift is when a service agent works on a given weekday. An agent with
+// no shifts works whenever their franchise takes visits; once any shift is
+// set, weekdays without one are days off.
+type AgentShift struct {
+	gorm.Model
+	AgentID   uint   `gorm:"index" json:"agent_id"`
+	Weekday   int    `json:"weekday"`    // 0 = Sunday ... 6 = Saturday
+	StartTime string `json:"start_time"` // "09:00"
+	EndTime   string `json:"end_time"`   // "17:00"
+	IsOff     bool   `json:"is_off"`
+}
+
+// Kinds of agent time off
+const (
+	AgentLeaveDayOff = "day_off"
+	AgentLeaveLeave  = "leave"
+)
+
+// AgentLeave takes an agent off the schedule for whole days, from StartDate
+// through EndDate
+type AgentLeave struct {
+	gorm.Model
+	AgentID     uint      `gorm:"index" json:"agent_id"`
+	Kind        string    `gorm:"size:20" json:"kind"`
+	StartDate   time.Time `gorm:"type:date;index" json:"start_date"`
+	EndDate     time.Time `gorm:"type:date;index" json:"end_date"`
+	Reason      string    `json:"reason"`
+	CreatedByID uint      `json:"created_by_id"`
+}
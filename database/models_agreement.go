@@ -0,0 +1,27 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RentalAgreement is the agreement PDF generated for an order when it is
+// approved. The customer accepts it with a code sent to their phone; the
+// time, IP and user agent of the acceptance are kept as their consent, and
+// the SHA-256 of the document shows which text they accepted.
+type RentalAgreement struct {
+	gorm.Model
+	OrderID    uint   `gorm:"uniqueIndex" json:"order_id"`
+	CustomerID uint   `gorm:"index" json:"customer_id"`
+	Document   []byte `json:"-"`
+	SHA256     string `gorm:"size:64" json:"sha256"`
+
+	OTPHash      string     `gorm:"size:64" json:"-"`
+	OTPExpiresAt *time.Time `json:"-"`
+	OTPAttempts  int        `json:"-"`
+
+	AcceptedAt        *time.Time `json:"accepted_at"`
+	AcceptedIP        string     `json:"accepted_ip,omitempty"`
+	AcceptedUserAgent string     `json:"accepted_user_agent,omitempty"`
+}
@@ -0,0 +1,32 @@
+package database
+
+import "time"
+
+// Kinds of operator alert
+const (
+	AlertKindPaymentVerification = "payment_verification_failures"
+	AlertKindSLABreaches         = "sla_breaches"
+	AlertKindWebhookFailures     = "webhook_failures"
+)
+
+// Alert is a message posted for operators. An alert of the same kind about
+// the same subject isn't repeated within the cooldown once delivered.
+type Alert struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Kind      string    `gorm:"size:50;index:idx_alerts_kind_subject" json:"kind"`
+	Subject   string    `gorm:"size:100;index:idx_alerts_kind_subject" json:"subject"` // what it is about, e.g. franchise:12
+	Message   string    `gorm:"type:text" json:"message"`
+	Delivered bool      `json:"delivered"`                        // reached at least one channel
+	Error     string    `gorm:"type:text" json:"error,omitempty"` // why a channel couldn't be reached
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// PaymentVerificationFailure is a checkout whose payment signature didn't
+// verify; a spike of them raises an alert
+type PaymentVerificationFailure struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CustomerID uint      `gorm:"index" json:"customer_id"`
+	OrderID    string    `gorm:"size:64" json:"order_id"` // Razorpay's order ID
+	PaymentID  string    `gorm:"size:64" json:"payment_id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Announcement audiences
+const (
+	AudienceAllCustomers       = "all_customers"
+	AudienceFranchiseCustomers = "franchise_customers"
+	AudienceAllAgents          = "all_agents"
+)
+
+// Announcement statuses
+const (
+	AnnouncementStatusQueued    = "queued"
+	AnnouncementStatusSending   = "sending"
+	AnnouncementStatusCompleted = "completed"
+)
+
+// Announcement is an admin broadcast to an audience. It is delivered in
+// batches in the background; LastUserID records how far delivery got so it
+// can resume after a restart.
+type Announcement struct {
+	gorm.Model
+	TenantID    uint   `gorm:"not null;default:1;index" json:"tenant_id"`
+	Title       string `json:"title"`
+	Message     string `gorm:"type:text" json:"message"`
+	Audience    string `json:"audience"`
+	FranchiseID *uint  `json:"franchise_id"`
+	SendEmail   bool   `json:"send_email"`
+	SendSMS     bool   `json:"send_sms"`
+	CreatedBy   uint   `json:"created_by"`
+	Status      string `gorm:"index" json:"status"`
+
+	Recipients   int64      `json:"recipients"`
+	Notified     int64      `json:"notified"`
+	EmailsSent   int64      `json:"emails_sent"`
+	EmailsFailed int64      `json:"emails_failed"`
+	SMSSent      int64      `json:"sms_sent"`
+	SMSFailed    int64      `json:"sms_failed"`
+	LastUserID   uint       `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+	StartedAt    *time.Time `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
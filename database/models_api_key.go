@@ -0,0 +1,62 @@
+package database
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// APIKey lets a partner system such as a CRM or an IoT vendor call the
+// partner API without a user login. The key is shown once when created;
+// only the SHA-256 hash of its secret is stored.
+type APIKey struct {
+	gorm.Model
+	TenantID           uint           `gorm:"not null;default:1;index" json:"tenant_id"` // the brand whose data the key reads
+	Name               string         `gorm:"size:100" json:"name"`
+	Prefix             string         `gorm:"uniqueIndex;size:16" json:"prefix"` // public part of the key, identifies it in logs
+	SecretHash         string         `gorm:"size:64" json:"-"`
+	Scopes             pq.StringArray `gorm:"type:text[]" json:"scopes"`
+	FranchiseID        *uint          `gorm:"index" json:"franchise_id"` // limits the key to one franchise's data
+	RateLimitPerMinute int            `json:"rate_limit_per_minute"`
+	CreatedBy          uint           `json:"created_by"`
+	ExpiresAt          *time.Time     `json:"expires_at"`
+	LastUsedAt         *time.Time     `json:"last_used_at"`
+	RevokedAt          *time.Time     `json:"revoked_at"`
+}
+
+// APIKeyPrefix starts every API key: aqk_<prefix>.<secret>
+const APIKeyPrefix = "aqk_"
+
+// IsActive reports whether the key can still be used
+func (k APIKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key was granted the scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// API key scopes
+const (
+	ScopeProductsRead         = "products:read"
+	ScopeOrdersRead           = "orders:read"
+	ScopeSubscriptionsRead    = "subscriptions:read"
+	ScopeServiceRequestsRead  = "service_requests:read"
+	ScopeServiceRequestsWrite = "service_requests:write"
+)
+
+// AllAPIKeyScopes describes every scope an API key can be granted
+var AllAPIKeyScopes = map[string]string{
+	ScopeProductsRead:         "List the product catalog",
+	ScopeOrdersRead:           "List orders",
+	ScopeSubscriptionsRead:    "Look up subscriptions",
+	ScopeServiceRequestsRead:  "List service requests",
+	ScopeServiceRequestsWrite: "Raise service requests for a subscription",
+}
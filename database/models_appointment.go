@@ -0,0 +1,61 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Visits customers are reminded of
+const (
+	AppointmentServiceRequest = "service_request"
+	AppointmentInstallation   = "installation" // an order's delivery_date
+)
+
+// AppointmentLinkPurpose signs the confirm and reschedule links in reminders
+const AppointmentLinkPurpose = "appointment"
+
+// Visits are reminded of while in these statuses
+var (
+	RemindedServiceStatuses = []string{ServiceStatusPending, ServiceStatusAssigned, ServiceStatusScheduled}
+	RemindedOrderStatuses   = []string{OrderStatusConfirmed, OrderStatusApproved, OrderStatusInTransit}
+)
+
+// AppointmentReminder tracks the reminders for one scheduled visit and the
+// customer's answer to them. A visit moved to another time gets a new row,
+// so it is reminded of again and old links stop working.
+type AppointmentReminder struct {
+	gorm.Model
+	TenantID      uint      `gorm:"not null;default:1;index" json:"tenant_id"`
+	Kind          string    `gorm:"size:20;uniqueIndex:idx_appointment_reminder" json:"kind"`
+	EntityID      uint      `gorm:"uniqueIndex:idx_appointment_reminder" json:"entity_id"` // the service request or order
+	ScheduledTime time.Time `gorm:"uniqueIndex:idx_appointment_reminder" json:"scheduled_time"`
+	CustomerID    uint      `gorm:"index" json:"customer_id"`
+	FranchiseID   uint      `gorm:"index" json:"franchise_id"`
+
+	DayBeforeSentAt   *time.Time `json:"day_before_sent_at"`   // the 24-hour reminder
+	HoursBeforeSentAt *time.Time `json:"hours_before_sent_at"` // the 2-hour reminder
+
+	ConfirmedAt           *time.Time `json:"confirmed_at"`
+	RescheduleRequestedAt *time.Time `json:"reschedule_requested_at"`
+	PreferredTime         *time.Time `json:"preferred_time"` // when the customer would rather be visited
+	RescheduleReason      string     `gorm:"size:500" json:"reschedule_reason"`
+}
+
+// Current reports whether the visit is still scheduled for the reminder's
+// time, so its links still apply
+func (r AppointmentReminder) Current(db *gorm.DB) (bool, error) {
+	var count int64
+	var err error
+	switch r.Kind {
+	case AppointmentServiceRequest:
+		err = db.Model(&ServiceRequest{}).
+			Where("id = ? AND scheduled_time = ? AND status IN ?", r.EntityID, r.ScheduledTime, RemindedServiceStatuses).
+			Count(&count).Error
+	case AppointmentInstallation:
+		err = db.Model(&Order{}).
+			Where("id = ? AND delivery_date = ? AND status IN ?", r.EntityID, r.ScheduledTime, RemindedOrderStatuses).
+			Count(&count).Error
+	}
+	return count > 0, err
+}
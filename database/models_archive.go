@@ -0,0 +1,24 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tables the retention job archives rows from
+const (
+	ArchiveSourceNotifications   = "notifications"
+	ArchiveSourceServiceRequests = "service_requests"
+)
+
+// ArchivedRecord is a row the retention job moved out of a hot table. The
+// row is kept as JSON, so archived rows survive later schema changes.
+type ArchivedRecord struct {
+	ID         uint            `gorm:"primarykey" json:"id"`
+	Source     string          `gorm:"size:50;uniqueIndex:idx_archived_records_source_record" json:"source"`
+	RecordID   uint            `gorm:"uniqueIndex:idx_archived_records_source_record" json:"record_id"`
+	UserID     uint            `gorm:"index" json:"user_id"` // the notification's recipient or the request's customer
+	RecordedAt time.Time       `json:"recorded_at"`          // when the original row was created
+	Data       json.RawMessage `gorm:"serializer:json;type:text" json:"data"`
+	ArchivedAt time.Time       `gorm:"index" json:"archived_at"`
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Agent responses to a service request assignment
+const (
+	AssignmentAccepted = "accepted"
+	AssignmentDeclined = "declined"
+)
+
+// ServiceAssignmentResponse records how an agent answered a service request
+// assignment and how long they took, for agent performance metrics
+type ServiceAssignmentResponse struct {
+	gorm.Model
+	ServiceRequestID uint      `gorm:"index" json:"service_request_id"`
+	AgentID          uint      `gorm:"index" json:"agent_id"`
+	Response         string    `gorm:"size:20" json:"response"`
+	Reason           string    `json:"reason"`
+	AssignedAt       time.Time `json:"assigned_at"`
+	RespondedAt      time.Time `json:"responded_at"`
+	ResponseSeconds  int64     `json:"response_seconds"`
+}
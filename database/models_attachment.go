@@ -0,0 +1,24 @@
+package database
+
+import "gorm.io/gorm"
+
+// Kinds of service request attachment
+const (
+	AttachmentKindPhoto = "photo"
+	AttachmentKindVideo = "video"
+)
+
+// ServiceRequestAttachment is a photo or video attached to a service request:
+// the customer's picture of the problem or the agent's proof of the work
+type ServiceRequestAttachment struct {
+	gorm.Model
+	ServiceRequestID uint   `gorm:"index" json:"service_request_id"`
+	UploadedBy       uint   `json:"uploaded_by"`
+	UploaderRole     string `gorm:"size:30" json:"uploader_role"`
+	Kind             string `gorm:"size:10" json:"kind"`
+	URL              string `json:"url"`
+	ThumbnailURL     string `json:"thumbnail_url"` // WebP, for photos, filled in by a background job
+	OriginalName     string `json:"original_name"`
+	ContentType      string `gorm:"size:50" json:"content_type"`
+	SizeBytes        int64  `json:"size_bytes"`
+}
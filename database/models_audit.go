@@ -4,15 +4,23 @@ import (
 	"time"
 )
 
-// AuditLog represents system audit log entries (legacy format)
+// AuditLog represents system audit log entries. Privileged writes made by admins
+// and franchise owners are recorded here with a JSON diff of the changed fields.
 type AuditLog struct {
-	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID      int64     `gorm:"index" json:"user_id"`
-	Action      string    `gorm:"size:50;not null" json:"action"`
-	EntityType  string    `gorm:"size:50;not null" json:"entity_type"`
-	EntityID    int64     `gorm:"not null" json:"entity_id"`
-	Description string    `gorm:"type:text" json:"description"`
-	IP          string    `gorm:"size:50" json:"ip"`
-	UserAgent   string    `gorm:"size:255" json:"user_agent"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID       int64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID uint  `gorm:"not null;default:1;index" json:"tenant_id"`
+	UserID   int64 `gorm:"index" json:"user_id"`
+	// Admin acting as UserID through an impersonation token
+	ImpersonatorID *int64    `gorm:"index" json:"impersonator_id"`
+	ActorRole      string    `gorm:"size:50" json:"actor_role"`
+	Action         string    `gorm:"size:50;not null;index" json:"action"`
+	EntityType     string    `gorm:"size:50;not null;index" json:"entity_type"`
+	EntityID       int64     `gorm:"not null;index" json:"entity_id"`
+	Description    string    `gorm:"type:text" json:"description"`
+	Changes        string    `gorm:"type:text" json:"changes"` // {"field": {"from": x, "to": y}}
+	Method         string    `gorm:"size:10" json:"method"`
+	Path           string    `gorm:"size:255" json:"path"`
+	IP             string    `gorm:"size:50" json:"ip"`
+	UserAgent      string    `gorm:"size:255" json:"user_agent"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
 }
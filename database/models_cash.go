@@ -0,0 +1,21 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CashDeposit is an agent paying cash they collected into the franchise's
+// bank account. The reconciliation report sets these against the cash
+// payments the agent recorded.
+type CashDeposit struct {
+	gorm.Model
+	TenantID    uint      `gorm:"not null;default:1;index" json:"tenant_id"`
+	FranchiseID uint      `gorm:"index" json:"franchise_id"`
+	AgentID     uint      `gorm:"index" json:"agent_id"`
+	Amount      float64   `json:"amount"`
+	DepositedAt time.Time `json:"deposited_at"`
+	Reference   string    `gorm:"size:100" json:"reference"` // bank slip or UTR number
+	Notes       string    `json:"notes"`
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// ProductVariant is a configuration of a product, e.g. RO+UV vs RO only
+type ProductVariant struct {
+	gorm.Model
+	ProductID      uint   `gorm:"index" json:"product_id"`
+	Name           string `json:"name"`
+	SKU            string `gorm:"index" json:"sku"`
+	Description    string `json:"description"`
+	Specifications string `json:"specifications"`
+	IsActive       bool   `json:"is_active"`
+}
+
+// RentalPlan is a pricing tier of a product. A plan with a VariantID only
+// applies to that variant; otherwise it applies to every variant.
+type RentalPlan struct {
+	gorm.Model
+	ProductID         uint    `gorm:"index" json:"product_id"`
+	VariantID         *uint   `gorm:"index" json:"variant_id"`
+	Name              string  `json:"name"`
+	Description       string  `json:"description"`
+	MinDurationMonths int     `json:"min_duration_months"`
+	DurationMonths    int     `json:"duration_months"` // fixed term; 0 lets the customer choose from the minimum up
+	MonthlyRent       float64 `json:"monthly_rent"`
+	SecurityDeposit   float64 `json:"security_deposit"`
+	InstallationFee   float64 `json:"installation_fee"`
+	ServicesPerYear   int     `json:"services_per_year"` // included maintenance visits; 0 uses the product's cycle
+	SortOrder         int     `json:"sort_order"`
+	IsActive          bool    `json:"is_active"`
+}
+
+// PlanTerms are a rental plan's terms as they stood when an order was placed,
+// so editing the plan later doesn't change what the customer signed up for
+type PlanTerms struct {
+	PlanID          uint    `json:"plan_id"`
+	Name            string  `json:"name"`
+	DurationMonths  int     `json:"duration_months"`
+	MonthlyRent     float64 `json:"monthly_rent"`
+	SecurityDeposit float64 `json:"security_deposit"`
+	InstallationFee float64 `json:"installation_fee"`
+	ServicesPerYear int     `json:"services_per_year"`
+}
+
+// Terms snapshots the plan for an order of the given duration
+func (p RentalPlan) Terms(duration int) PlanTerms {
+	return PlanTerms{
+		PlanID:          p.ID,
+		Name:            p.Name,
+		DurationMonths:  duration,
+		MonthlyRent:     p.MonthlyRent,
+		SecurityDeposit: p.SecurityDeposit,
+		InstallationFee: p.InstallationFee,
+		ServicesPerYear: p.ServicesPerYear,
+	}
+}
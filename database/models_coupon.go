@@ -0,0 +1,49 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Coupon is a discount code applied to the initial payment of an order
+type Coupon struct {
+	gorm.Model
+	TenantID       uint       `gorm:"not null;default:1;uniqueIndex:idx_coupons_tenant_code" json:"tenant_id"`
+	Code           string     `gorm:"uniqueIndex:idx_coupons_tenant_code;size:64" json:"code"` // stored upper case
+	Description    string     `json:"description"`
+	DiscountType   string     `json:"discount_type"`
+	DiscountValue  float64    `json:"discount_value"`   // percent, or rupees for flat coupons
+	MaxDiscount    float64    `json:"max_discount"`     // cap for percent coupons, 0 for no cap
+	MinOrderAmount float64    `json:"min_order_amount"` // before discount
+	UsageLimit     int        `json:"usage_limit"`      // total redemptions, 0 for unlimited
+	PerUserLimit   int        `json:"per_user_limit"`   // redemptions per customer, 0 for unlimited
+	StartsAt       *time.Time `json:"starts_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	ProductID      *uint      `gorm:"index" json:"product_id"`   // restrict to a product
+	FranchiseID    *uint      `gorm:"index" json:"franchise_id"` // restrict to a franchise
+	IsActive       bool       `json:"is_active"`
+}
+
+// CouponRedemption records a coupon applied to an order. Redemptions of
+// cancelled orders are released, and those of orders left unpaid past the
+// checkout hold no longer count towards usage limits.
+type CouponRedemption struct {
+	gorm.Model
+	TenantID       uint    `gorm:"not null;default:1;index" json:"tenant_id"`
+	CouponID       uint    `gorm:"index" json:"coupon_id"`
+	CustomerID     uint    `gorm:"index" json:"customer_id"`
+	OrderID        uint    `gorm:"uniqueIndex" json:"order_id"`
+	DiscountAmount float64 `json:"discount_amount"`
+	Status         string  `json:"status"`
+	Customer       User    `gorm:"foreignKey:CustomerID" json:"customer"`
+}
+
+// Coupon discount types and redemption statuses
+const (
+	CouponTypePercent = "percent"
+	CouponTypeFlat    = "flat"
+
+	RedemptionStatusApplied  = "applied"
+	RedemptionStatusReleased = "released"
+)
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreditNote is an amount credited to a customer against an invoice, e.g.
+// compensation for service downtime or a billing error. It comes off the
+// taxable value of the subscription's next monthly bill, and is used up as
+// those bills are paid.
+type CreditNote struct {
+	gorm.Model
+	TenantID       uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	Number         string     `gorm:"size:32;index" json:"number"`
+	CustomerID     uint       `gorm:"index" json:"customer_id"`
+	PaymentID      uint       `gorm:"index" json:"payment_id"` // the invoice it is issued against
+	OrderID        *uint      `json:"order_id"`
+	SubscriptionID *uint      `gorm:"index" json:"subscription_id"`
+	Reason         string     `json:"reason"`
+	Notes          string     `json:"notes"`
+	Amount         float64    `json:"amount"` // before GST
+	AppliedAmount  float64    `json:"applied_amount"`
+	Status         string     `json:"status"`
+	IssuedByID     uint       `json:"issued_by_id"`
+	VoidedAt       *time.Time `json:"voided_at,omitempty"`
+	VoidReason     string     `json:"void_reason,omitempty"`
+}
+
+// Credit note statuses and reasons
+const (
+	CreditNoteStatusOpen             = "open"
+	CreditNoteStatusPartiallyApplied = "partially_applied"
+	CreditNoteStatusApplied          = "applied"
+	CreditNoteStatusVoid             = "void"
+
+	CreditNoteReasonDowntime     = "service_downtime"
+	CreditNoteReasonBillingError = "billing_error"
+	CreditNoteReasonGoodwill     = "goodwill"
+	CreditNoteReasonOther        = "other"
+)
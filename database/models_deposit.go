@@ -0,0 +1,64 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DepositSettlement tracks the return of a customer's security deposit after
+// their subscription ends: device pickup, damage deductions, then a refund.
+type DepositSettlement struct {
+	gorm.Model
+	TenantID         uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	SubscriptionID   uint       `gorm:"uniqueIndex" json:"subscription_id"`
+	OrderID          uint       `json:"order_id"`
+	CustomerID       uint       `gorm:"index" json:"customer_id"`
+	FranchiseID      uint       `gorm:"index" json:"franchise_id"`
+	ServiceRequestID *uint      `json:"service_request_id"` // device pickup task
+	Status           string     `json:"status"`
+	DepositAmount    float64    `json:"deposit_amount"`
+	DeductionAmount  float64    `json:"deduction_amount"`
+	RefundAmount     float64    `json:"refund_amount"`
+	RefundMethod     string     `json:"refund_method"`
+	RazorpayRefundID string     `json:"razorpay_refund_id,omitempty"`
+	PickedUpAt       *time.Time `json:"picked_up_at"`
+	PickedUpByID     *uint      `json:"picked_up_by_id"`
+	DeviceCondition  string     `json:"device_condition"`
+	SettledAt        *time.Time `json:"settled_at"`
+	Notes            string     `json:"notes"`
+
+	Deductions []DepositDeduction `gorm:"foreignKey:SettlementID" json:"deductions"`
+}
+
+// DepositDeduction is an amount withheld from a deposit, e.g. for damage
+type DepositDeduction struct {
+	gorm.Model
+	SettlementID uint    `gorm:"index" json:"settlement_id"`
+	Reason       string  `json:"reason"`
+	Amount       float64 `json:"amount"`
+	CreatedByID  uint    `json:"created_by_id"`
+}
+
+// WalletTransaction is a credit or debit on a customer's wallet. The balance
+// is the sum of a user's transactions.
+type WalletTransaction struct {
+	gorm.Model
+	UserID      uint    `gorm:"index" json:"user_id"`
+	Amount      float64 `json:"amount"` // positive for credits
+	Reason      string  `json:"reason"`
+	RelatedType string  `json:"related_type"`
+	RelatedID   *uint   `json:"related_id"`
+}
+
+// Deposit settlement statuses and refund methods
+const (
+	DepositStatusAwaitingPickup = "awaiting_pickup"
+	DepositStatusPickedUp       = "picked_up"
+	DepositStatusRefunded       = "refunded"
+	DepositStatusCredited       = "credited"
+	DepositStatusClosed         = "closed" // nothing left to refund after deductions
+
+	RefundMethodRazorpay = "razorpay"
+	RefundMethodWallet   = "wallet"
+)
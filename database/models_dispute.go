@@ -0,0 +1,59 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dispute is a chargeback or other dispute a customer's bank raised against
+// a Razorpay payment, kept in step with Razorpay's dispute webhooks. While it
+// is open, actions on the subscription that could move money are frozen.
+type Dispute struct {
+	gorm.Model
+	TenantID          uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	RazorpayDisputeID string     `gorm:"uniqueIndex" json:"razorpay_dispute_id"`
+	RazorpayPaymentID string     `gorm:"index" json:"razorpay_payment_id"`
+	PaymentID         *uint      `gorm:"index" json:"payment_id"` // nil when the payment isn't ours
+	CustomerID        *uint      `gorm:"index" json:"customer_id"`
+	OrderID           *uint      `gorm:"index" json:"order_id"`
+	SubscriptionID    *uint      `gorm:"index" json:"subscription_id"`
+	Amount            float64    `json:"amount"`
+	AmountDeducted    float64    `json:"amount_deducted"`
+	Currency          string     `json:"currency"`
+	Phase             string     `json:"phase"` // chargeback, pre_arbitration, arbitration, fraud or retrieval
+	ReasonCode        string     `json:"reason_code"`
+	ReasonDescription string     `json:"reason_description"`
+	Status            string     `gorm:"index" json:"status"`
+	RespondBy         *time.Time `json:"respond_by"`
+	ContestedAt       *time.Time `json:"contested_at,omitempty"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+
+	Evidence []DisputeEvidence `gorm:"foreignKey:DisputeID" json:"evidence,omitempty"`
+}
+
+// DisputeEvidence is a document uploaded to contest a dispute, stored under
+// ./uploads and with Razorpay
+type DisputeEvidence struct {
+	gorm.Model
+	DisputeID          uint   `gorm:"index" json:"dispute_id"`
+	Category           string `json:"category"` // the Razorpay evidence field it is submitted as
+	URL                string `json:"url"`
+	OriginalName       string `json:"original_name"`
+	ContentType        string `json:"content_type"`
+	SizeBytes          int64  `json:"size_bytes"`
+	RazorpayDocumentID string `json:"razorpay_document_id"`
+	UploadedByID       uint   `json:"uploaded_by_id"`
+}
+
+// Dispute statuses mirror Razorpay's
+const (
+	DisputeStatusOpen        = "open"
+	DisputeStatusUnderReview = "under_review"
+	DisputeStatusWon         = "won"
+	DisputeStatusLost        = "lost"
+	DisputeStatusClosed      = "closed"
+)
+
+// DisputeOpenStatuses are the statuses of disputes not yet resolved
+var DisputeOpenStatuses = []string{DisputeStatusOpen, DisputeStatusUnderReview}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DunningEvent records a step taken on an overdue rent payment. Each stage
+// happens at most once per subscription and billing date.
+type DunningEvent struct {
+	gorm.Model
+	SubscriptionID uint      `gorm:"uniqueIndex:idx_dunning_stage" json:"subscription_id"`
+	BillingDate    time.Time `gorm:"uniqueIndex:idx_dunning_stage" json:"billing_date"`
+	Stage          string    `gorm:"uniqueIndex:idx_dunning_stage;size:32" json:"stage"`
+	DaysOverdue    int       `json:"days_overdue"`
+	Amount         float64   `json:"amount"` // late fee charged, if any
+}
+
+// Dunning stages besides reminders, which are named "reminder_<days>"
+const (
+	DunningStageLateFee   = "late_fee"
+	DunningStageSuspended = "suspended"
+)
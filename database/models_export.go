@@ -0,0 +1,27 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Data export statuses
+const (
+	DataExportStatusPending = "pending"
+	DataExportStatusReady   = "ready"
+	DataExportStatusFailed  = "failed"
+	DataExportStatusExpired = "expired"
+)
+
+// DataExport is a user's request for an archive of their personal data
+type DataExport struct {
+	gorm.Model
+	UserID      uint       `gorm:"index" json:"user_id"`
+	Status      string     `gorm:"index" json:"status"`
+	FilePath    string     `json:"-"`
+	SizeBytes   int64      `json:"size_bytes"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// FranchiseMember gives a staff account (RoleFranchiseStaff) access to one
+// franchise, so dispatchers and accountants don't share the owner's login. A
+// staff member can belong to several of an owner's franchises, each with its
+// own features.
+type FranchiseMember struct {
+	gorm.Model
+	FranchiseID uint           `gorm:"uniqueIndex:idx_franchise_member" json:"franchise_id"`
+	UserID      uint           `gorm:"uniqueIndex:idx_franchise_member" json:"user_id"`
+	StaffRole   string         `gorm:"size:20" json:"staff_role"`
+	Features    pq.StringArray `gorm:"type:text[]" json:"features"`
+	AddedByID   uint           `json:"added_by_id"`
+	DisabledAt  *time.Time     `json:"disabled_at"`
+	User        User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// Staff roles; each starts with a default set of features
+const (
+	StaffRoleDispatcher = "dispatcher"
+	StaffRoleAccountant = "accountant"
+)
+
+// Franchise features staff can be granted
+const (
+	FranchiseFeatureOrders          = "orders"
+	FranchiseFeatureServiceRequests = "service_requests"
+	FranchiseFeatureAgents          = "agents"
+	FranchiseFeatureInventory       = "inventory"
+	FranchiseFeatureCash            = "cash"
+	FranchiseFeatureDeposits        = "deposits"
+	FranchiseFeatureFinance         = "finance"
+	FranchiseFeatureReports         = "reports"
+	FranchiseFeatureLeads           = "leads"
+)
+
+// AllFranchiseFeatures describes every feature a staff member can be granted
+var AllFranchiseFeatures = map[string]string{
+	FranchiseFeatureOrders:          "View orders and assign them to agents",
+	FranchiseFeatureServiceRequests: "View service requests and assign them to agents",
+	FranchiseFeatureAgents:          "View agents, their attendance and performance",
+	FranchiseFeatureInventory:       "Manage spare parts stock",
+	FranchiseFeatureCash:            "Approve cash collected by agents and reconcile deposits",
+	FranchiseFeatureDeposits:        "Settle security deposits on returned devices",
+	FranchiseFeatureFinance:         "View commission settlements and the franchise ledger",
+	FranchiseFeatureReports:         "View analytics and export data",
+	FranchiseFeatureLeads:           "Follow up on demo requests from the website",
+}
+
+// DefaultStaffFeatures are granted to a staff role when the owner doesn't
+// pick features
+var DefaultStaffFeatures = map[string][]string{
+	StaffRoleDispatcher: {FranchiseFeatureOrders, FranchiseFeatureServiceRequests, FranchiseFeatureAgents, FranchiseFeatureInventory, FranchiseFeatureLeads},
+	StaffRoleAccountant: {FranchiseFeatureCash, FranchiseFeatureDeposits, FranchiseFeatureFinance, FranchiseFeatureReports},
+}
+
+// StaffFranchiseIDs returns the franchises where the staff member's active
+// membership grants the feature
+func StaffFranchiseIDs(db *gorm.DB, userID uint, feature string) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&FranchiseMember{}).
+		Where("user_id = ? AND disabled_at IS NULL AND ? = ANY(features)", userID, feature).
+		Order("franchise_id").Pluck("franchise_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InstallationOTP is the code a customer gives the agent to confirm an
+// installation. The code is stored hashed and only the newest one per order
+// is valid.
+type InstallationOTP struct {
+	gorm.Model
+	OrderID   uint       `gorm:"index" json:"order_id"`
+	CodeHash  string     `gorm:"size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	Attempts  int        `json:"attempts"`
+}
+
+// InstallationReport is the agent's checklist for an installation, required
+// before the order can be marked installed
+type InstallationReport struct {
+	gorm.Model
+	OrderID       uint                `gorm:"uniqueIndex" json:"order_id"`
+	AgentID       uint                `json:"agent_id"`
+	WaterPressure string              `json:"water_pressure"` // low, normal or high
+	TDSReading    int                 `json:"tds_reading"`    // ppm of the purified water
+	DemoGiven     bool                `json:"demo_given"`
+	Notes         string              `json:"notes"`
+	Photos        []InstallationPhoto `gorm:"foreignKey:ReportID" json:"photos"`
+}
+
+// InstallationPhoto is a photo attached to an installation report
+type InstallationPhoto struct {
+	gorm.Model
+	ReportID     uint   `gorm:"index" json:"report_id"`
+	URL          string `json:"url"`
+	OriginalName string `json:"original_name"`
+	SizeBytes    int64  `json:"size_bytes"`
+}
+
+// Water pressure readings on an installation report
+const (
+	WaterPressureLow    = "low"
+	WaterPressureNormal = "normal"
+	WaterPressureHigh   = "high"
+)
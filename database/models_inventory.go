@@ -0,0 +1,54 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InventoryItem is a stock line held by a franchise: purifier units, filters or spare parts
+type InventoryItem struct {
+	gorm.Model
+	TenantID     uint   `gorm:"not null;default:1;index" json:"tenant_id"`
+	FranchiseID  uint   `gorm:"index;uniqueIndex:idx_inventory_franchise_sku" json:"franchise_id"`
+	ProductID    *uint  `gorm:"index" json:"product_id"` // set for purifier units of a catalog product
+	Name         string `json:"name"`
+	SKU          string `gorm:"uniqueIndex:idx_inventory_franchise_sku" json:"sku"`
+	Category     string `json:"category"`
+	Unit         string `json:"unit"`
+	Quantity     int    `json:"quantity"`
+	ReorderLevel int    `json:"reorder_level"`
+
+	// Set when the low stock alert was sent; cleared once stock is replenished
+	LowStockAlertedAt *time.Time `json:"low_stock_alerted_at"`
+
+	Franchise Franchise `gorm:"foreignKey:FranchiseID" json:"-"`
+}
+
+// StockMovement records every change to an inventory item's quantity
+type StockMovement struct {
+	gorm.Model
+	TenantID        uint   `gorm:"not null;default:1;index" json:"tenant_id"`
+	InventoryItemID uint   `gorm:"index" json:"inventory_item_id"`
+	FranchiseID     uint   `gorm:"index" json:"franchise_id"`
+	Quantity        int    `json:"quantity"` // positive for stock in, negative for stock out
+	BalanceAfter    int    `json:"balance_after"`
+	Reason          string `json:"reason"`
+	RelatedType     string `json:"related_type"`
+	RelatedID       *uint  `json:"related_id"`
+	Notes           string `json:"notes"`
+	CreatedByID     *uint  `json:"created_by_id"`
+}
+
+// Inventory categories and stock movement reasons
+const (
+	InventoryCategoryPurifier  = "purifier"
+	InventoryCategoryFilter    = "filter"
+	InventoryCategorySparePart = "spare_part"
+
+	StockReasonPurchase     = "purchase"
+	StockReasonAdjustment   = "adjustment"
+	StockReasonReturn       = "return"
+	StockReasonInstallation = "installation"
+	StockReasonService      = "service"
+)
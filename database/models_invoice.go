@@ -0,0 +1,14 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// InvoiceDocument is the rendered PDF of a payment's invoice. It is rendered
+// on the job queue and again when the payment's status has changed since.
+type InvoiceDocument struct {
+	gorm.Model
+	PaymentID     uint   `gorm:"uniqueIndex" json:"payment_id"`
+	PaymentStatus string `gorm:"size:30" json:"payment_status"` // status the document was rendered with
+	Document      []byte `json:"-"`
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lead statuses. A lead moves from new through contacted and a demo to
+// qualified, and ends converted into a customer or lost.
+const (
+	LeadStatusNew           = "new"
+	LeadStatusContacted     = "contacted"
+	LeadStatusDemoScheduled = "demo_scheduled"
+	LeadStatusQualified     = "qualified"
+	LeadStatusConverted     = "converted"
+	LeadStatusLost          = "lost"
+)
+
+// Where a lead came from
+const (
+	LeadSourceWebsite = "website"
+)
+
+// Lead is a prospect who asked for a demo through the public form, routed to
+// the franchise serving their pincode. Leads from pincodes no franchise
+// serves have no franchise and are left to admins.
+type Lead struct {
+	gorm.Model
+	TenantID      uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	Name          string     `gorm:"size:100" json:"name"`
+	Phone         string     `gorm:"size:15;index" json:"phone"` // 10 digits
+	Pincode       string     `gorm:"size:6" json:"pincode"`
+	PreferredSlot *time.Time `json:"preferred_slot"` // when they'd like the demo
+	FranchiseID   *uint      `gorm:"index" json:"franchise_id"`
+	Status        string     `gorm:"size:20;default:new;index" json:"status"`
+	Source        string     `gorm:"size:30" json:"source"`
+	Notes         string     `gorm:"type:text" json:"notes"`    // the franchise's follow-up notes
+	ContactedAt   *time.Time `json:"contacted_at"`              // first moved past new
+	RepeatOfID    *uint      `gorm:"index" json:"repeat_of_id"` // open lead from the same phone when this one came in
+
+	// Set when the lead is converted into a customer with a draft order
+	CustomerID    *uint      `gorm:"index" json:"customer_id"`
+	OrderID       *uint      `json:"order_id"`
+	ConvertedAt   *time.Time `json:"converted_at"`
+	ConvertedByID *uint      `json:"converted_by_id"`
+}
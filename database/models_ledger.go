@@ -0,0 +1,44 @@
+package database
+
+import (
+	"time"
+)
+
+// LedgerAccount is an account in the double-entry ledger. Platform accounts
+// (cash, revenue, tax) have no owner; customer and franchise accounts carry
+// the customer's or franchise's ID so their balances can be reported.
+type LedgerAccount struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"size:64;uniqueIndex" json:"code"` // e.g. "cash", "customer:12:deposit"
+	Name      string    `json:"name"`
+	Type      string    `gorm:"size:16" json:"type"`
+	OwnerType string    `gorm:"size:16;index:idx_ledger_owner" json:"owner_type,omitempty"`
+	OwnerID   *uint     `gorm:"index:idx_ledger_owner" json:"owner_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Ledger account types. Assets and expenses carry debit balances;
+// liabilities and revenue carry credit balances.
+const (
+	LedgerAccountAsset     = "asset"
+	LedgerAccountLiability = "liability"
+	LedgerAccountRevenue   = "revenue"
+	LedgerAccountExpense   = "expense"
+)
+
+// LedgerEntry is one line of a journal. The lines of a journal always
+// balance, and entries are never updated or deleted: a mistake is corrected
+// by posting a reversing journal.
+type LedgerEntry struct {
+	ID         uint          `gorm:"primaryKey" json:"id"`
+	Journal    string        `gorm:"size:100;uniqueIndex:idx_ledger_journal_line" json:"journal"` // e.g. "payment:12:received"
+	Line       int           `gorm:"uniqueIndex:idx_ledger_journal_line" json:"line"`
+	AccountID  uint          `gorm:"index" json:"account_id"`
+	Debit      float64       `json:"debit"`
+	Credit     float64       `json:"credit"`
+	Memo       string        `json:"memo"`
+	SourceType string        `gorm:"size:32;index:idx_ledger_source" json:"source_type"`
+	SourceID   uint          `gorm:"index:idx_ledger_source" json:"source_id"`
+	CreatedAt  time.Time     `gorm:"index" json:"created_at"`
+	Account    LedgerAccount `gorm:"foreignKey:AccountID" json:"account,omitempty"`
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaintenanceMode is the switch admins flip during migrations or payment
+// gateway incidents. There is a single row; without one the API is open.
+type MaintenanceMode struct {
+	gorm.Model
+	Enabled      bool       `json:"enabled"`
+	Message      string     `gorm:"size:500" json:"message"`                        // shown to clients turned away
+	AllowedRoles []string   `gorm:"serializer:json;type:text" json:"allowed_roles"` // let through besides admins
+	EndsAt       *time.Time `json:"ends_at"`                                        // expected end, sent as Retry-After
+	UpdatedBy    uint       `json:"updated_by"`
+}
+
+// CurrentMaintenanceMode returns the maintenance mode in force
+func CurrentMaintenanceMode(db *gorm.DB) (MaintenanceMode, error) {
+	var mode MaintenanceMode
+	err := db.Order("id").Limit(1).Find(&mode).Error
+	return mode, err
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Mandate represents a Razorpay recurring-payment mandate (UPI Autopay / e-mandate)
+// that auto-debits the monthly rent of a rental order
+type Mandate struct {
+	gorm.Model
+	TenantID               uint          `gorm:"not null;default:1;index" json:"tenant_id"`
+	CustomerID             uint          `json:"customer_id"`
+	OrderID                uint          `json:"order_id"`
+	SubscriptionID         *uint         `json:"subscription_id"`
+	RazorpayPlanID         string        `json:"razorpay_plan_id"`
+	RazorpaySubscriptionID string        `gorm:"uniqueIndex" json:"razorpay_subscription_id"`
+	Method                 string        `json:"method"`
+	Status                 string        `json:"status"`
+	StatusEventAt          *time.Time    `json:"-"` // when the Razorpay event behind Status was raised
+	ShortURL               string        `json:"short_url"`
+	Amount                 float64       `json:"amount"`
+	TotalCount             int           `json:"total_count"`
+	PaidCount              int           `json:"paid_count"`
+	LastChargedAt          *time.Time    `json:"last_charged_at"`
+	Customer               User          `gorm:"foreignKey:CustomerID" json:"-"`
+	Order                  Order         `gorm:"foreignKey:OrderID" json:"-"`
+	Subscription           *Subscription `gorm:"foreignKey:SubscriptionID" json:"-"`
+}
+
+// MandateEndedStatuses end a mandate; no later event revives it
+var MandateEndedStatuses = []string{MandateStatusCancelled, MandateStatusCompleted}
+
+// Mandate status values mirror the Razorpay subscription lifecycle
+const (
+	MandateStatusCreated       = "created"
+	MandateStatusAuthenticated = "authenticated"
+	MandateStatusActive        = "active"
+	MandateStatusPending       = "pending"
+	MandateStatusHalted        = "halted"
+	MandateStatusCancelled     = "cancelled"
+	MandateStatusCompleted     = "completed"
+)
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NotificationDelivery is one email, SMS or push message to a user, sent or
+// waiting to be sent. Failed sends are retried with backoff and set aside
+// as failed, for an admin to retry, once the retries run out.
+type NotificationDelivery struct {
+	gorm.Model
+	UserID        uint       `gorm:"index" json:"user_id"`
+	Channel       string     `gorm:"size:10;index" json:"channel"`
+	Event         string     `gorm:"size:100;index" json:"event"` // notification template the message was rendered from
+	Recipient     string     `gorm:"size:255" json:"recipient"`   // email or phone; push goes to the user's devices
+	Title         string     `json:"title"`
+	Message       string     `gorm:"type:text" json:"message"`
+	Data          string     `gorm:"type:text" json:"data,omitempty"` // push data as JSON
+	Status        string     `gorm:"size:20;index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error"`
+	SentAt        *time.Time `json:"sent_at"`
+	FailedAt      *time.Time `json:"failed_at"` // gave up after the last retry
+}
+
+// Notification delivery statuses
+const (
+	NotificationDeliveryPending = "pending"
+	NotificationDeliverySent    = "sent"
+	NotificationDeliveryFailed  = "failed" // dead-lettered
+)
+
+// Channels notifications are delivered on outside the app
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+	NotificationChannelPush  = "push"
+)
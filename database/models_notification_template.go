@@ -0,0 +1,205 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+)
+
+// NotificationTemplate is admin-edited copy for a notification event in one
+// locale. Events without a template use the built-in English copy.
+type NotificationTemplate struct {
+	gorm.Model
+	Event   string `gorm:"size:100;uniqueIndex:idx_notification_templates_event_locale" json:"event"`
+	Locale  string `gorm:"size:10;uniqueIndex:idx_notification_templates_event_locale" json:"locale"`
+	Title   string `json:"title"`
+	Message string `gorm:"type:text" json:"message"`
+}
+
+// NotificationCopy is the title and message of a notification, with
+// {{variable}} placeholders
+type NotificationCopy struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Vars are the values interpolated into a notification template
+type Vars map[string]interface{}
+
+// DefaultNotificationCopy is the built-in English copy of every notification
+// event, used until an admin adds a template
+var DefaultNotificationCopy = map[string]NotificationCopy{
+	"user.welcome": {"Welcome to AquaHome", "Thank you for registering with AquaHome! We're excited to have you with us."},
+
+	"order.placed":              {"Order Placed Successfully", "Your order for {{product}} has been placed and is pending approval."},
+	"order.approved":            {"Order Status Updated", "Your order has been approved. Your subscription is now active."},
+	"order.rejected":            {"Order Status Updated", "Your order has been rejected. Please contact customer support for details."},
+	"order.in_transit":          {"Order Status Updated", "Your order is in transit and will be delivered soon."},
+	"order.delivered":           {"Order Status Updated", "Your order has been delivered. Installation will be scheduled soon."},
+	"order.installed":           {"Order Status Updated", "Your water purifier has been successfully installed."},
+	"order.status_updated":      {"Order Status Updated", "Your order status has been updated to {{status}}"},
+	"order.cancelled":           {"Order cancelled", "Your order #{{id}} has been cancelled."},
+	"order.cancelled_refunded":  {"Order cancelled", "Your order #{{id}} has been cancelled and a refund of ₹{{amount}} has been initiated to your original payment method."},
+	"order.cancelled_franchise": {"Order cancelled", "Order #{{id}} was cancelled: {{reason}}"},
+	"order.installation_code":   {"Installation code", "{{code}} is the installation code for your AquaHome order #{{id}}. Share it with the technician only once your purifier is installed."},
+	"order.installed_franchise": {"Installation completed", "Order #{{id}} was installed and confirmed by the customer."},
+	"order.agreement_ready":     {"Rental agreement ready", "Your rental agreement for order #{{id}} is ready. Please review and accept it in the app."},
+	"order.agreement_code":      {"Agreement code", "{{code}} is your code to accept the AquaHome rental agreement for order #{{id}}. It expires in 10 minutes."},
+
+	"payment.success":           {"Payment Successful", "{{payment_type}} payment has been processed successfully."},
+	"payment.auto_debited":      {"Monthly Rent Auto-Debited", "₹{{amount}} has been auto-debited for your monthly rent."},
+	"payment.auto_debit_failed": {"Auto-Debit Failed", "We could not auto-debit your monthly rent. Please pay manually or update your mandate."},
+	"payment.overdue":           {"Rent overdue", "Your monthly rent of ₹{{amount}} was due on {{due_date}} and is {{days}} days overdue. Please pay to avoid late fees and suspension."},
+	"payment.link":              {"Payment link", "Pay ₹{{amount}} for {{purpose}} securely at {{url}} . The link expires on {{expires}}."},
+	"payment.cash_collected":    {"Cash Received", "Our agent collected ₹{{amount}} in cash for your rent. Receipt {{invoice_number}}; your account updates once the franchise confirms it."},
+	"payment.late_fee":          {"Late fee added", "A late fee of ₹{{amount}} has been added to your next rent payment."},
+	"payment.dispute_opened":    {"Payment disputed", "A {{phase}} of ₹{{amount}} was raised against payment {{payment}} ({{reason}}). Respond by {{respond_by}}."},
+	"payment.dispute_due":       {"Dispute needs a response", "Dispute {{dispute}} on payment {{payment}} needs evidence by {{respond_by}}."},
+	"payment.dispute_closed":    {"Dispute resolved", "Dispute {{dispute}} on payment {{payment}} was {{status}}."},
+	"payment.credit_note":       {"Credit note issued", "Credit note {{number}} for ₹{{amount}} has been issued against invoice {{invoice_number}}. It will be taken off your next rent payment."},
+
+	"subscription.status_updated":      {"Subscription Updated", "Your subscription status has been updated to {{status}}"},
+	"subscription.auto_renew_enabled":  {"Subscription Updated", "Auto-renewal has been enabled for your subscription"},
+	"subscription.auto_renew_disabled": {"Subscription Updated", "Auto-renewal has been disabled for your subscription"},
+	"subscription.cancelled":           {"Subscription Cancelled", "Your subscription has been cancelled."},
+	"subscription.cancelled_franchise": {"Subscription Cancelled", "A customer has cancelled their subscription."},
+	"subscription.suspended":           {"Subscription suspended", "Your rent is {{days}} days overdue, so your subscription has been suspended. Pay the outstanding rent to restore service."},
+	"subscription.suspended_franchise": {"Subscription suspended for non-payment", "Subscription #{{id}} was suspended after {{days}} days of unpaid rent."},
+
+	"service_request.created":           {"Service Request Created", "Your service request has been created and is pending assignment."},
+	"service_request.created_franchise": {"New Service Request", "A new service request has been created and needs your attention."},
+	"service_request.status_updated":    {"Service Request Updated", "Your service request status has been updated to {{status}}."},
+	"service_request.agent_assigned":    {"Service Agent Assigned", "A service agent has been assigned to your service request."},
+	"service_request.assignment":        {"New Service Assignment", "You have been assigned to service request #{{id}}."},
+	"service_request.scheduled":         {"Service Visit Scheduled", "Your service request has been scheduled for {{date}}."},
+	"service_request.cancelled":         {"Service Request Cancelled", "Your service request has been cancelled."},
+	"service_request.cancelled_agent":   {"Service Request Cancelled", "A service request assigned to you has been cancelled by the customer."},
+	"service_request.declined":          {"Service request declined", "{{agent}} declined service request #{{id}}: {{reason}}. It is back in your queue."},
+	"service_request.feedback":          {"Service Feedback Received", "You received a {{rating}}-star rating for your service."},
+	"service_request.agent_arrived":     {"Technician has arrived", "The technician for service request #{{id}} has checked in at your location."},
+	"service_request.completed":         {"Service completed", "Your service request #{{id}} has been completed. Water TDS is now {{tds}} ppm."},
+	"service_request.report_submitted":  {"Service report submitted", "Service request #{{id}} was completed with {{parts}} part(s) replaced."},
+	"service_request.sla_breached":      {"Service request overdue", "Service request #{{id}} ({{type}}) missed its {{hours}}-hour SLA and is still {{status}}."},
+	"service_request.sla_escalated":     {"Service request escalated", "Service request #{{id}} ({{type}}) of franchise #{{franchise_id}} is {{overdue}} hours past its SLA and still {{status}}."},
+	"appointment.reminder":              {"Upcoming visit", "Your {{visit}} is on {{when}}. Confirm: {{confirm_url}} Reschedule: {{reschedule_url}}"},
+	"appointment.reschedule_requested":  {"Visit reschedule requested", "The customer asked to move {{visit}} #{{id}} on {{when}}{{details}}."},
+	"maintenance.scheduled":             {"Maintenance Visit Scheduled", "Your {{product}} is due for preventive maintenance. Our team will contact you to confirm the visit."},
+	"maintenance.due_franchise":         {"Scheduled Maintenance Due", "Preventive maintenance request #{{id}} was created for subscription #{{subscription_id}} and needs an agent."},
+
+	"deposit.refund_started": {"Deposit refund started", "We'll collect your purifier and refund your ₹{{amount}} security deposit once it has been picked up."},
+	"deposit.pickup_needed":  {"Device pickup needed", "Subscription #{{subscription_id}} has ended. Pickup request #{{id}} needs an agent."},
+	"deposit.collected":      {"Purifier collected", "Your purifier has been collected. Your deposit refund will be processed shortly."},
+	"deposit.refunded":       {"Deposit settled", "₹{{amount}} of your security deposit has been refunded to your original payment method."},
+	"deposit.credited":       {"Deposit settled", "₹{{amount}} of your security deposit has been credited to your AquaHome wallet."},
+	"deposit.closed":         {"Deposit settled", "Your security deposit was fully used for deductions, so there is nothing to refund."},
+
+	"franchise.application_submitted": {"Franchise Application Submitted", "Your franchise application for {{name}} has been submitted and is pending approval."},
+	"franchise.application_received":  {"New Franchise Application", "A new franchise application has been submitted by {{name}} and requires your approval."},
+	"franchise.approved":              {"Franchise Application Approved", "Your franchise application has been approved. You can now start serving customers."},
+	"franchise.rejected":              {"Franchise Application Rejected", "Your franchise application has been rejected. Reason: {{reason}}"},
+	"lead.received":                   {"New demo request", "{{name}} ({{phone}}, pincode {{pincode}}) asked for a demo{{slot}}."},
+	"lead.converted":                  {"Welcome to AquaHome", "Your {{product}} order #{{order}} is ready. Sign in with your mobile number at {{url}} to review it and pay ₹{{amount}}."},
+	"inventory.low_stock":             {"Low stock", "{{name}} ({{sku}}) is down to {{quantity}} in stock. Reorder level is {{reorder_level}}."},
+
+	"settlement.ready":         {"Settlement statement ready", "Your {{period}} statement is ready: ₹{{amount}} due to you from {{payments}} payments."},
+	"settlement.paid":          {"Settlement paid", "₹{{amount}} for {{period}} has been paid (ref {{reference}})."},
+	"settlement.paid_out":      {"Settlement paid", "₹{{amount}} for {{period}} has been paid to your bank account (UTR {{utr}})."},
+	"settlement.payout_failed": {"Settlement payout failed", "We could not pay your {{period}} settlement: {{reason}}. Please check your bank account details."},
+
+	"data_export.ready": {"Your data export is ready", "Your data archive is ready to download until {{expires}}."},
+}
+
+var templateVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// TemplateVariables lists the {{variables}} used in a template's text
+func TemplateVariables(text ...string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, t := range text {
+		for _, match := range templateVariable.FindAllStringSubmatch(t, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatVar renders a template variable. Amounts are shown to two decimal places.
+func formatVar(value interface{}) string {
+	if amount, isFloat := value.(float64); isFloat {
+		return fmt.Sprintf("%.2f", amount)
+	}
+	return fmt.Sprint(value)
+}
+
+// Formatted returns the variables rendered as they appear in a message, so
+// they can be stored and interpolated later without losing their format
+func (v Vars) Formatted() Vars {
+	formatted := make(Vars, len(v))
+	for name, value := range v {
+		formatted[name] = formatVar(value)
+	}
+	return formatted
+}
+
+// interpolate fills {{variable}} placeholders from vars; unknown variables
+// are left empty
+func interpolate(text string, vars Vars) string {
+	return templateVariable.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, ok := vars[templateVariable.FindStringSubmatch(placeholder)[1]]
+		if !ok {
+			return ""
+		}
+		return formatVar(value)
+	})
+}
+
+// NotificationCopyFor returns the copy for an event in a locale: the admin's
+// template for that locale, else for the default locale, else the built-in copy
+func NotificationCopyFor(db *gorm.DB, event, locale string) NotificationCopy {
+	defaultLocale := config.AppConfig.DefaultLocale
+	if locale == "" {
+		locale = defaultLocale
+	}
+
+	var templates []NotificationTemplate
+	if err := db.Where("event = ? AND locale IN ?", event, []string{locale, defaultLocale}).
+		Find(&templates).Error; err != nil {
+		log.Printf("Failed to load notification template %s: %v", event, err)
+	}
+	var fallback *NotificationTemplate
+	for i, t := range templates {
+		if t.Locale == locale {
+			return NotificationCopy{Title: t.Title, Message: t.Message}
+		}
+		fallback = &templates[i]
+	}
+	if fallback != nil {
+		return NotificationCopy{Title: fallback.Title, Message: fallback.Message}
+	}
+	return DefaultNotificationCopy[event]
+}
+
+// Rendered returns the notification with its title and message rendered
+// from the event's template in the recipient's locale
+func (n Notification) Rendered(db *gorm.DB, event string, vars Vars) Notification {
+	db = db.Session(&gorm.Session{NewDB: true})
+
+	var locale string
+	if n.UserID != 0 {
+		db.Model(&User{}).Where("id = ?", n.UserID).Select("locale").Scan(&locale)
+	}
+	text := NotificationCopyFor(db, event, locale)
+	n.Event = event
+	n.Title = interpolate(text.Title, vars)
+	n.Message = interpolate(text.Message, vars)
+	return n
+}
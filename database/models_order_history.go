@@ -0,0 +1,15 @@
+package database
+
+import "gorm.io/gorm"
+
+// OrderStatusHistory records one change in an order's lifecycle. Agent
+// assignment is recorded too, with FromStatus equal to ToStatus.
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderID    uint   `gorm:"index" json:"order_id"`
+	FromStatus string `json:"from_status"` // empty when the order was created
+	ToStatus   string `json:"to_status"`
+	ChangedBy  *uint  `json:"changed_by"` // nil for system changes
+	Note       string `json:"note"`
+	Changer    *User  `gorm:"foreignKey:ChangedBy" json:"-"`
+}
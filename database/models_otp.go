@@ -0,0 +1,18 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PhoneOTP is a one-time login code sent by SMS. Only the hash of the code is stored.
+type PhoneOTP struct {
+	gorm.Model
+	Phone     string     `gorm:"index;size:20" json:"phone"`
+	CodeHash  string     `gorm:"size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	Attempts  int        `json:"attempts"`
+	RequestIP string     `json:"request_ip"`
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is a domain event written in the transaction that caused it.
+// The relayer queues its emails, SMS and push notifications after commit, so
+// they are never lost to a crash between the commit and queueing them.
+type OutboxEvent struct {
+	gorm.Model
+	Name          string         `gorm:"size:100;index" json:"name"`
+	Payload       string         `gorm:"type:text" json:"payload"`
+	DoneChannels  pq.StringArray `gorm:"type:text[]" json:"done_channels"` // channels already sent, skipped on retry
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt *time.Time     `gorm:"index" json:"next_attempt_at"`
+	LockedUntil   *time.Time     `json:"locked_until"`
+	LastError     string         `gorm:"type:text" json:"last_error"`
+	ProcessedAt   *time.Time     `gorm:"index" json:"processed_at"`
+	FailedAt      *time.Time     `json:"failed_at"` // gave up after the last retry
+}
+
+// Outbox event states, for filtering
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusProcessed = "processed"
+	OutboxStatusFailed    = "failed"
+)
+
+// Status reports where the event is in the relay
+func (e OutboxEvent) Status() string {
+	switch {
+	case e.ProcessedAt != nil:
+		return OutboxStatusProcessed
+	case e.FailedAt != nil:
+		return OutboxStatusFailed
+	}
+	return OutboxStatusPending
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentLink is a Razorpay Payment Link sent to a customer so they can pay a
+// pending payment outside the app, e.g. when checkout is assisted over the
+// phone. Its status follows Razorpay's payment_link webhooks.
+type PaymentLink struct {
+	gorm.Model
+	TenantID          uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	PaymentID         uint       `gorm:"index" json:"payment_id"`
+	CustomerID        uint       `gorm:"index" json:"customer_id"`
+	RazorpayLinkID    string     `gorm:"uniqueIndex" json:"razorpay_link_id"`
+	ShortURL          string     `json:"short_url"`
+	Amount            float64    `json:"amount"`
+	Status            string     `json:"status"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	CreatedByID       uint       `json:"created_by_id"`
+	RazorpayPaymentID string     `json:"razorpay_payment_id,omitempty"`
+	PaidAt            *time.Time `json:"paid_at,omitempty"`
+}
+
+// Payment link status values mirror Razorpay's
+const (
+	PaymentLinkStatusCreated       = "created"
+	PaymentLinkStatusPartiallyPaid = "partially_paid"
+	PaymentLinkStatusPaid          = "paid"
+	PaymentLinkStatusExpired       = "expired"
+	PaymentLinkStatusCancelled     = "cancelled"
+)
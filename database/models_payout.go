@@ -0,0 +1,51 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// FranchiseBankAccount is a RazorpayX fund account that settlements are paid
+// into. Only the last four digits of a bank account number are stored.
+type FranchiseBankAccount struct {
+	gorm.Model
+	FranchiseID           uint   `gorm:"index" json:"franchise_id"`
+	AccountType           string `json:"account_type"` // bank_account or vpa
+	AccountHolderName     string `json:"account_holder_name"`
+	AccountNumberLast4    string `json:"account_number_last4,omitempty"`
+	IFSC                  string `json:"ifsc,omitempty"`
+	VPA                   string `json:"vpa,omitempty"`
+	RazorpayFundAccountID string `json:"razorpay_fund_account_id"`
+	IsActive              bool   `json:"is_active"` // the account payouts go to
+}
+
+// SettlementPayout is one attempt to disburse a settlement through RazorpayX
+type SettlementPayout struct {
+	gorm.Model
+	SettlementID     uint    `gorm:"index" json:"settlement_id"`
+	BankAccountID    uint    `json:"bank_account_id"`
+	Attempt          int     `json:"attempt"`
+	Amount           float64 `json:"amount"`
+	RazorpayPayoutID string  `gorm:"index" json:"razorpay_payout_id"`
+	IdempotencyKey   string  `json:"-"`
+	Status           string  `json:"status"` // RazorpayX payout status, or failed/unconfirmed when it could not be created
+	UTR              string  `json:"utr"`
+	FailureReason    string  `json:"failure_reason"`
+}
+
+// Fund account types
+const (
+	BankAccountTypeBank = "bank_account"
+	BankAccountTypeVPA  = "vpa"
+)
+
+// RazorpayX payout statuses we act on
+const (
+	PayoutStatusProcessed = "processed"
+	PayoutStatusFailed    = "failed"
+	PayoutStatusReversed  = "reversed"
+	PayoutStatusRejected  = "rejected"
+	PayoutStatusCancelled = "cancelled"
+
+	// The payout request got no answer, so it may or may not have been created
+	PayoutStatusUnconfirmed = "unconfirmed"
+)
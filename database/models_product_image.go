@@ -0,0 +1,22 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// ProductImage is one image in a product's gallery. Each upload is stored as
+// a thumbnail, medium and full size JPEG.
+type ProductImage struct {
+	gorm.Model
+	ProductID        uint   `gorm:"index" json:"product_id"`
+	Position         int    `json:"position"`
+	ThumbnailURL     string `json:"thumbnail_url"`
+	MediumURL        string `json:"medium_url"`
+	FullURL          string `json:"full_url"`
+	WebPThumbnailURL string `json:"webp_thumbnail_url"` // filled in by a background job
+	Width            int    `json:"width"`              // of the original upload
+	Height           int    `json:"height"`             // of the original upload
+	OriginalName     string `json:"original_name"`
+	SizeBytes        int64  `json:"size_bytes"`
+	AltText          string `json:"alt_text"`
+}
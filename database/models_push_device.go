@@ -0,0 +1,16 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PushDevice is an app install that receives push notifications for a user
+type PushDevice struct {
+	gorm.Model
+	UserID     uint      `gorm:"index" json:"user_id"`
+	Token      string    `gorm:"uniqueIndex;size:500" json:"token"`
+	Platform   string    `gorm:"size:20" json:"platform"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Role is a named set of permissions. User.Role holds the role name, so custom
+// roles such as "finance" or "ops" can be created without code changes.
+type Role struct {
+	gorm.Model
+	Name        string       `gorm:"uniqueIndex;size:50" json:"name"`
+	Description string       `json:"description"`
+	IsSystem    bool         `json:"is_system"` // built-in roles can't be deleted
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+}
+
+// Permission is a single capability such as "service_request:assign"
+type Permission struct {
+	gorm.Model
+	Code        string `gorm:"uniqueIndex;size:100" json:"code"`
+	Description string `json:"description"`
+}
+
+// Permission codes
+const (
+	PermServiceRequestAssign  = "service_request:assign"
+	PermServiceRequestReadAll = "service_request:read_all"
+	PermOrderAssign           = "order:assign"
+	PermPaymentReadAll        = "payment:read_all"
+	PermPaymentRefund         = "payment:refund"
+	PermProductManage         = "product:manage"
+	PermFranchiseManage       = "franchise:manage"
+	PermUserManage            = "user:manage"
+	PermAuditRead             = "audit:read"
+	PermRoleManage            = "role:manage"
+)
+
+// AllPermissions describes every permission known to the application
+var AllPermissions = map[string]string{
+	PermServiceRequestAssign:  "Assign service requests to agents",
+	PermServiceRequestReadAll: "View all service requests",
+	PermOrderAssign:           "Assign orders to franchises and agents",
+	PermPaymentReadAll:        "View all payments",
+	PermPaymentRefund:         "Refund payments",
+	PermProductManage:         "Create, update and delete products",
+	PermFranchiseManage:       "Approve, update and deactivate franchises",
+	PermUserManage:            "Manage user accounts",
+	PermAuditRead:             "View audit logs",
+	PermRoleManage:            "Manage roles and permissions",
+}
+
+// defaultRolePermissions are granted to the built-in roles on first start.
+// Admins always pass permission checks regardless of this table.
+var defaultRolePermissions = map[string][]string{
+	RoleFranchiseOwner: {PermServiceRequestAssign, PermOrderAssign},
+	RoleFranchiseStaff: {PermServiceRequestAssign}, // narrowed by their franchise features
+	RoleServiceAgent:   {},
+	RoleCustomer:       {},
+}
+
+// permissionCacheTTL bounds how long a role's permissions are cached in memory
+const permissionCacheTTL = time.Minute
+
+var permissionCache = struct {
+	sync.RWMutex
+	loadedAt time.Time
+	roles    map[string]map[string]bool
+}{}
+
+// RoleHasPermission reports whether the named role grants the permission code
+func RoleHasPermission(role, code string) (bool, error) {
+	if role == RoleAdmin {
+		return true, nil
+	}
+
+	permissionCache.RLock()
+	fresh := permissionCache.roles != nil && time.Since(permissionCache.loadedAt) < permissionCacheTTL
+	if fresh {
+		granted := permissionCache.roles[role][code]
+		permissionCache.RUnlock()
+		return granted, nil
+	}
+	permissionCache.RUnlock()
+
+	var rows []struct {
+		RoleName string
+		Code     string
+	}
+	if err := DB.Table("role_permissions").
+		Select("roles.name as role_name, permissions.code as code").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.deleted_at IS NULL").
+		Scan(&rows).Error; err != nil {
+		return false, err
+	}
+
+	roles := map[string]map[string]bool{}
+	for _, row := range rows {
+		if roles[row.RoleName] == nil {
+			roles[row.RoleName] = map[string]bool{}
+		}
+		roles[row.RoleName][row.Code] = true
+	}
+
+	permissionCache.Lock()
+	permissionCache.roles = roles
+	permissionCache.loadedAt = time.Now()
+	permissionCache.Unlock()
+
+	return roles[role][code], nil
+}
+
+// InvalidatePermissionCache forces the next permission check to reload from the database
+func InvalidatePermissionCache() {
+	permissionCache.Lock()
+	permissionCache.roles = nil
+	permissionCache.Unlock()
+}
+
+// SeedRBAC makes sure every known permission and built-in role exists
+func SeedRBAC() {
+	for code, description := range AllPermissions {
+		permission := Permission{Code: code, Description: description}
+		if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&permission).Error; err != nil {
+			log.Printf("❌ Failed to seed permission %s: %v", code, err)
+			return
+		}
+	}
+
+	builtIn := []string{RoleAdmin, RoleFranchiseOwner, RoleServiceAgent, RoleCustomer, RoleFranchiseStaff}
+	for _, name := range builtIn {
+		var role Role
+		err := DB.Where("name = ?", name).First(&role).Error
+		if err == nil {
+			continue
+		}
+		if err != gorm.ErrRecordNotFound {
+			log.Printf("❌ Failed to check role %s: %v", name, err)
+			return
+		}
+
+		role = Role{Name: name, Description: "Built-in role", IsSystem: true}
+		if codes := defaultRolePermissions[name]; len(codes) > 0 {
+			if err := DB.Where("code IN ?", codes).Find(&role.Permissions).Error; err != nil {
+				log.Printf("❌ Failed to load permissions for role %s: %v", name, err)
+				return
+			}
+		}
+		if err := DB.Create(&role).Error; err != nil {
+			log.Printf("❌ Failed to seed role %s: %v", name, err)
+			return
+		}
+		log.Printf("✅ Seeded built-in role %s", name)
+	}
+
+	InvalidatePermissionCache()
+}
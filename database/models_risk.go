@@ -0,0 +1,40 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BlacklistEntry blocks a phone number or email address from placing
+// orders, e.g. after fraud or a device that was never returned. Values are
+// stored normalised so any spelling of the number matches.
+type BlacklistEntry struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TenantID    uint      `gorm:"not null;default:1;uniqueIndex:idx_blacklist_tenant_value" json:"tenant_id"`
+	Kind        string    `gorm:"size:16;uniqueIndex:idx_blacklist_tenant_value" json:"kind"`
+	Value       string    `gorm:"size:255;uniqueIndex:idx_blacklist_tenant_value" json:"value"`
+	Reason      string    `json:"reason"`
+	CustomerID  *uint     `gorm:"index" json:"customer_id,omitempty"` // the customer it was taken from, if any
+	CreatedByID uint      `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Blacklist entry kinds
+const (
+	BlacklistKindPhone = "phone"
+	BlacklistKindEmail = "email"
+)
+
+// RiskOverride lets a blacklisted customer place one order, on an admin's
+// say-so, until it expires
+type RiskOverride struct {
+	gorm.Model
+	TenantID    uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	CustomerID  uint       `gorm:"index" json:"customer_id"`
+	Reason      string     `json:"reason"`
+	GrantedByID uint       `json:"granted_by_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+	OrderID     *uint      `json:"order_id,omitempty"`
+}
@@ -0,0 +1,36 @@
+package database
+
+import "gorm.io/gorm"
+
+// ServiceReport is the agent's record of a completed service visit
+type ServiceReport struct {
+	gorm.Model
+	ServiceRequestID uint                 `gorm:"uniqueIndex" json:"service_request_id"`
+	AgentID          uint                 `json:"agent_id"`
+	TDSBefore        int                  `json:"tds_before"` // ppm
+	TDSAfter         int                  `json:"tds_after"`  // ppm
+	LaborMinutes     int                  `json:"labor_minutes"`
+	Notes            string               `json:"notes"`
+	Parts            []ServiceReportPart  `gorm:"foreignKey:ReportID" json:"parts"`
+	Photos           []ServiceReportPhoto `gorm:"foreignKey:ReportID" json:"photos"`
+}
+
+// ServiceReportPart is a part replaced on a visit, taken from franchise stock.
+// Name and SKU are copied so the report reads the same if the item changes.
+type ServiceReportPart struct {
+	gorm.Model
+	ReportID        uint   `gorm:"index" json:"report_id"`
+	InventoryItemID uint   `json:"inventory_item_id"`
+	Name            string `json:"name"`
+	SKU             string `json:"sku"`
+	Quantity        int    `json:"quantity"`
+}
+
+// ServiceReportPhoto is a photo attached to a service report
+type ServiceReportPhoto struct {
+	gorm.Model
+	ReportID     uint   `gorm:"index" json:"report_id"`
+	URL          string `json:"url"`
+	OriginalName string `json:"original_name"`
+	SizeBytes    int64  `json:"size_bytes"`
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a login session backed by a rotating refresh token. Only the
+// SHA-256 hash of the refresh token is stored.
+type Session struct {
+	gorm.Model
+	UserID           uint       `gorm:"index" json:"user_id"`
+	RefreshTokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	ReplacedByID     *uint      `json:"replaced_by_id"` // set when the token was rotated
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	IPAddress        string     `json:"ip_address"`
+	UserAgent        string     `json:"user_agent"`
+	DeviceName       string     `gorm:"size:100" json:"device_name"` // from the app's X-Device-Name header
+	SignedInAt       time.Time  `json:"signed_in_at"`                // login that started the chain of rotated sessions
+}
+
+// IsActive reports whether the session can still be used
+func (s Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
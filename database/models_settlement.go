@@ -0,0 +1,45 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Settlement is a franchise's monthly revenue-share statement. Amounts cover
+// the successful payments of the franchise's orders and subscriptions made in
+// the period; the share is taken on the amount net of GST.
+type Settlement struct {
+	gorm.Model
+	TenantID         uint       `gorm:"not null;default:1;index" json:"tenant_id"`
+	FranchiseID      uint       `gorm:"uniqueIndex:idx_settlement_franchise_period" json:"franchise_id"`
+	PeriodStart      time.Time  `gorm:"uniqueIndex:idx_settlement_franchise_period" json:"period_start"`
+	PeriodEnd        time.Time  `json:"period_end"` // exclusive
+	PaymentCount     int64      `json:"payment_count"`
+	GrossAmount      float64    `json:"gross_amount"` // collected, including GST
+	TaxAmount        float64    `json:"tax_amount"`
+	NetAmount        float64    `json:"net_amount"`
+	SharePercent     float64    `json:"share_percent"`
+	FranchiseShare   float64    `json:"franchise_share"`
+	PlatformShare    float64    `json:"platform_share"`
+	Status           string     `json:"status"`
+	PaidAt           *time.Time `json:"paid_at"`
+	PaymentReference string     `json:"payment_reference"`
+	Notes            string     `json:"notes"`
+
+	// RazorpayX payout tracking; NextPayoutAt is when a failed payout is retried
+	PayoutAttempts int        `json:"payout_attempts"`
+	NextPayoutAt   *time.Time `json:"next_payout_at"`
+
+	Franchise Franchise `gorm:"foreignKey:FranchiseID" json:"franchise,omitempty"`
+}
+
+// Settlement statuses. A pending statement is refreshed until an admin
+// approves it; approved and failed settlements can be paid out.
+const (
+	SettlementStatusPending    = "pending"
+	SettlementStatusApproved   = "approved"
+	SettlementStatusProcessing = "processing"
+	SettlementStatusPaid       = "paid"
+	SettlementStatusFailed     = "failed"
+)
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"time"
+
+	"aquahome/config"
+)
+
+// Escalation levels of a service request that missed its SLA
+const (
+	EscalationNone           = 0
+	EscalationFranchiseOwner = 1
+	EscalationAdmin          = 2
+)
+
+// OpenServiceStatuses are the statuses of a service request still being worked on
+var OpenServiceStatuses = []string{
+	ServiceStatusPending,
+	ServiceStatusAssigned,
+	ServiceStatusScheduled,
+	ServiceStatusInProgress,
+}
+
+// ServiceSLAHours returns the hours within which a request of the given type
+// should be completed
+func ServiceSLAHours(requestType string) int {
+	if hours, ok := config.AppConfig.ServiceSLAHoursByType[requestType]; ok && hours > 0 {
+		return hours
+	}
+	return config.AppConfig.ServiceSLAHours
+}
+
+// ServiceSLADeadline returns when a request of the given type created at
+// createdAt breaches its SLA
+func ServiceSLADeadline(requestType string, createdAt time.Time) *time.Time {
+	due := createdAt.Add(time.Duration(ServiceSLAHours(requestType)) * time.Hour)
+	return &due
+}
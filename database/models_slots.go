@@ -0,0 +1,18 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// FranchiseWorkingHours defines when a franchise takes service visits on a given
+// weekday and how many visits it can handle per slot
+type FranchiseWorkingHours struct {
+	gorm.Model
+	FranchiseID uint   `gorm:"index" json:"franchise_id"`
+	Weekday     int    `json:"weekday"`    // 0 = Sunday ... 6 = Saturday
+	OpenTime    string `json:"open_time"`  // "09:00"
+	CloseTime   string `json:"close_time"` // "18:00"
+	SlotMinutes int    `json:"slot_minutes"`
+	Capacity    int    `json:"capacity"`
+	IsClosed    bool   `json:"is_closed"`
+}
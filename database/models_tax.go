@@ -0,0 +1,17 @@
+package database
+
+// TaxBreakdown is the GST charged on an order or payment. Intra-state sales
+// are split equally between CGST and SGST; inter-state sales carry IGST.
+type TaxBreakdown struct {
+	TaxableAmount float64 `json:"taxable_amount"`
+	TaxRate       float64 `json:"tax_rate"` // percent
+	CGSTAmount    float64 `json:"cgst_amount"`
+	SGSTAmount    float64 `json:"sgst_amount"`
+	IGSTAmount    float64 `json:"igst_amount"`
+	TaxAmount     float64 `json:"tax_amount"`
+}
+
+// Total returns the taxable amount plus tax
+func (t TaxBreakdown) Total() float64 {
+	return t.TaxableAmount + t.TaxAmount
+}
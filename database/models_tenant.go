@@ -0,0 +1,40 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTenantID is the brand rows from before tenants belong to, and the
+// one requests are served for when nothing names another
+const DefaultTenantID = 1
+
+// Tenant is a water-purifier brand served by this deployment. Its users,
+// products, franchises and orders are kept apart from other brands'.
+type Tenant struct {
+	gorm.Model
+	Slug     string   `gorm:"size:50;uniqueIndex" json:"slug"` // sent by apps in the X-Tenant header
+	Name     string   `gorm:"size:100" json:"name"`
+	Domains  []string `gorm:"serializer:json;type:text" json:"domains"` // hosts the brand's apps are served from
+	Disabled bool     `json:"disabled"`
+}
+
+// EnsureDefaultTenant creates the default tenant when it is missing, so
+// rows from before tenants have a brand
+func EnsureDefaultTenant() {
+	result := DB.Where(Tenant{Model: gorm.Model{ID: DefaultTenantID}}).
+		Attrs(Tenant{Slug: "aquahome", Name: "AquaHome"}).
+		FirstOrCreate(&Tenant{})
+	if result.Error != nil {
+		log.Printf("⚠️ Failed to create the default tenant: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		// The row was inserted with its ID, so move the sequence past it
+		if err := DB.Exec("SELECT setval(pg_get_serial_sequence('tenants', 'id'), (SELECT MAX(id) FROM tenants))").Error; err != nil {
+			log.Printf("⚠️ Failed to advance the tenant ID sequence: %v", err)
+		}
+		log.Println("✅ Default tenant created.")
+	}
+}
@@ -0,0 +1,25 @@
+package database
+
+import "gorm.io/gorm"
+
+// FranchiseTerritory is an area a franchise serves, either a circle around a
+// centre point or a polygon of [latitude, longitude] vertices
+type FranchiseTerritory struct {
+	gorm.Model
+	FranchiseID     uint         `gorm:"index" json:"franchise_id"`
+	Name            string       `json:"name"`
+	Kind            string       `json:"kind"`
+	CenterLatitude  float64      `json:"center_latitude"`
+	CenterLongitude float64      `json:"center_longitude"`
+	RadiusKm        float64      `json:"radius_km"`
+	Polygon         [][2]float64 `gorm:"serializer:json;type:text" json:"polygon,omitempty"`
+	IsActive        bool         `json:"is_active"`
+
+	Franchise Franchise `gorm:"foreignKey:FranchiseID" json:"-"`
+}
+
+// Territory kinds
+const (
+	TerritoryKindRadius  = "radius"
+	TerritoryKindPolygon = "polygon"
+)
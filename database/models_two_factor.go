@@ -0,0 +1,46 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TwoFactorRoles are the roles that can, and by policy must, use two-factor login
+var TwoFactorRoles = []string{RoleAdmin, RoleFranchiseOwner}
+
+// TwoFactorBackupCode is a one-time code that stands in for the authenticator
+// app. Only its SHA-256 hash is stored.
+type TwoFactorBackupCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"index" json:"user_id"`
+	CodeHash string     `gorm:"size:64;index" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+// SecurityPolicy holds account security settings admins control. There is a
+// single row; without one every setting is off.
+type SecurityPolicy struct {
+	gorm.Model
+	RequireTwoFactor bool `json:"require_two_factor"` // for TwoFactorRoles
+	UpdatedBy        uint `json:"updated_by"`
+}
+
+// CurrentSecurityPolicy returns the security policy in force
+func CurrentSecurityPolicy(db *gorm.DB) (SecurityPolicy, error) {
+	var policy SecurityPolicy
+	err := db.Order("id").Limit(1).Find(&policy).Error
+	return policy, err
+}
+
+// UsesTwoFactor reports whether the user's role can use two-factor login
+func (u User) UsesTwoFactor() bool {
+	role := strings.ToLower(u.Role)
+	for _, r := range TwoFactorRoles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What a direct upload becomes once it is confirmed
+const (
+	UploadPurposeProductImage      = "product_image"
+	UploadPurposeServiceAttachment = "service_attachment"
+)
+
+// Direct upload statuses
+const (
+	UploadStatusPending   = "pending"   // URL handed out, file not confirmed yet
+	UploadStatusConfirmed = "confirmed" // file checked and recorded
+)
+
+// DirectUpload is a file a client sends straight to S3 with a presigned URL
+// instead of through the API. Once the client confirms it, the file is
+// checked and recorded as a product image or service request attachment.
+type DirectUpload struct {
+	gorm.Model
+	UserID       uint       `gorm:"index" json:"user_id"`
+	Purpose      string     `gorm:"size:30" json:"purpose"`
+	TargetID     uint       `json:"target_id"` // the product or service request
+	ObjectKey    string     `gorm:"size:500;uniqueIndex" json:"object_key"`
+	ContentType  string     `gorm:"size:100" json:"content_type"`
+	SizeBytes    int64      `json:"size_bytes"`
+	OriginalName string     `json:"original_name"`
+	Status       string     `gorm:"size:20;index" json:"status"`
+	ExpiresAt    time.Time  `json:"expires_at"` // of the upload URL
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	RecordID     uint       `json:"record_id,omitempty"` // the product image or attachment created
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// WebhookEndpoint is an integrator's URL that receives domain events. Every
+// delivery is signed with the endpoint's secret.
+type WebhookEndpoint struct {
+	gorm.Model
+	Name      string         `gorm:"size:100" json:"name"`
+	URL       string         `gorm:"size:500" json:"url"`
+	Events    pq.StringArray `gorm:"type:text[]" json:"events"`
+	Secret    string         `gorm:"size:100" json:"-"`
+	IsActive  bool           `gorm:"default:true" json:"is_active"`
+	CreatedBy uint           `json:"created_by"`
+}
+
+// WebhookDelivery is one event sent, or waiting to be sent, to an endpoint
+type WebhookDelivery struct {
+	gorm.Model
+	EndpointID     uint       `gorm:"index" json:"endpoint_id"`
+	Event          string     `gorm:"size:100;index" json:"event"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"size:20;index" json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `gorm:"type:text" json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // gave up after the last retry
+)
+
+// Webhook events
+const (
+	WebhookEventOrderCreated            = "order.created"
+	WebhookEventPaymentSucceeded        = "payment.succeeded"
+	WebhookEventServiceRequestCompleted = "service_request.completed"
+)
+
+// AllWebhookEvents describes every event an endpoint can subscribe to
+var AllWebhookEvents = map[string]string{
+	WebhookEventOrderCreated:            "A customer placed an order",
+	WebhookEventPaymentSucceeded:        "A payment was received",
+	WebhookEventServiceRequestCompleted: "A service request was completed",
+}
+
+// WebhookPayload is the JSON body of a delivery
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// QueueWebhookEvent queues a delivery of the event to every active endpoint
+// subscribed to it. Call it in the transaction that makes the change so the
+// event is only sent if the change is committed.
+func QueueWebhookEvent(db *gorm.DB, event string, data interface{}) error {
+	var endpoints []WebhookEndpoint
+	if err := db.Session(&gorm.Session{NewDB: true}).
+		Where("is_active = ?", true).Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(WebhookPayload{Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+	var deliveries []WebhookDelivery
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(event) {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return db.Session(&gorm.Session{NewDB: true}).Create(&deliveries).Error
+}
+
+// Subscribes reports whether the endpoint receives the event
+func (e WebhookEndpoint) Subscribes(event string) bool {
+	for _, subscribed := range e.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookOrderData is the order sent with order events
+func WebhookOrderData(o Order) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                   o.ID,
+		"customer_id":          o.CustomerID,
+		"product_id":           o.ProductID,
+		"franchise_id":         o.FranchiseID,
+		"status":               o.Status,
+		"rental_duration":      o.RentalDuration,
+		"monthly_rent":         o.MonthlyRent,
+		"security_deposit":     o.SecurityDeposit,
+		"total_initial_amount": o.TotalInitialAmount,
+		"created_at":           o.CreatedAt,
+	}
+}
+
+// WebhookPaymentData is the payment sent with payment events
+func WebhookPaymentData(p Payment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              p.ID,
+		"customer_id":     p.CustomerID,
+		"order_id":        p.OrderID,
+		"subscription_id": p.SubscriptionID,
+		"amount":          p.Amount,
+		"payment_type":    p.PaymentType,
+		"payment_method":  p.PaymentMethod,
+		"transaction_id":  p.TransactionID,
+		"invoice_number":  p.InvoiceNumber,
+		"status":          p.Status,
+	}
+}
+
+// WebhookServiceRequestData is the service request sent with service request events
+func WebhookServiceRequestData(s ServiceRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               s.ID,
+		"customer_id":      s.CustomerID,
+		"subscription_id":  s.SubscriptionID,
+		"franchise_id":     s.FranchiseID,
+		"service_agent_id": s.ServiceAgentID,
+		"type":             s.Type,
+		"status":           s.Status,
+		"completion_time":  s.CompletionTime,
+	}
+}
@@ -0,0 +1,51 @@
+package database
+
+import "log"
+
+// searchVectors add generated tsvector columns with GIN indexes for
+// full-text search. Customer fields use the simple configuration since
+// names and emails aren't English words; request text is stemmed so
+// "leaking" finds "leak".
+var searchVectors = []string{
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple',
+		coalesce(name, '') || ' ' || coalesce(email, '') || ' ' || coalesce(phone, '') || ' ' ||
+		coalesce(address, '') || ' ' || coalesce(city, '') || ' ' || coalesce(zip_code, ''))) STORED`,
+	"CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING gin (search_vector)",
+	`ALTER TABLE service_requests ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(description, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(notes, '') || ' ' || coalesce(feedback, '')), 'B')) STORED`,
+	"CREATE INDEX IF NOT EXISTS idx_service_requests_search_vector ON service_requests USING gin (search_vector)",
+}
+
+// searchIndexes are trigram indexes behind the substring matches of the
+// admin search, so ILIKE '%...%' doesn't scan whole tables
+var searchIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (name gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_users_phone_trgm ON users USING gin (phone gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_payments_transaction_id_trgm ON payments USING gin (transaction_id gin_trgm_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_payments_invoice_number_trgm ON payments USING gin (invoice_number gin_trgm_ops)",
+}
+
+// EnsureSearchIndexes creates the full-text columns, enables pg_trgm and
+// creates the trigram indexes. A trigram failure, such as a role that may
+// not create extensions, is logged rather than fatal: search still works,
+// only slower.
+func EnsureSearchIndexes() {
+	for _, statement := range searchVectors {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("⚠️ Failed to set up full-text search: %v", err)
+			break
+		}
+	}
+
+	if err := DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("⚠️ pg_trgm unavailable, search runs without trigram indexes: %v", err)
+		return
+	}
+	for _, statement := range searchIndexes {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("⚠️ Failed to create search index: %v", err)
+		}
+	}
+}
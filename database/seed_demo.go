@@ -0,0 +1,320 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// DemoPassword is the password of every account the demo profile creates
+const DemoPassword = "demo1234"
+
+// seedProfiles are the data sets `seed --profile` can load
+var seedProfiles = map[string]func(tx *gorm.DB) error{
+	"demo": seedDemo,
+}
+
+// SeedProfiles lists the profiles Seed accepts
+func SeedProfiles() []string {
+	names := make([]string, 0, len(seedProfiles))
+	for name := range seedProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Seed loads a profile of sample data in one transaction. A profile that
+// was already loaded is left alone, so seeding twice is harmless.
+func Seed(profile string) error {
+	seed, ok := seedProfiles[profile]
+	if !ok {
+		return fmt.Errorf("unknown seed profile %q (available: %s)", profile, strings.Join(SeedProfiles(), ", "))
+	}
+	return DB.Transaction(seed)
+}
+
+// demoFranchise describes a franchise the demo profile creates, with its
+// owner, agents and the ZIP codes it serves
+type demoFranchise struct {
+	Name, City, State string
+	ZipCodes          []string
+	Agents            []string
+	Customers         []string
+}
+
+var demoFranchises = []demoFranchise{
+	{
+		Name: "AquaHome Hyderabad Central", City: "Hyderabad", State: "Telangana",
+		ZipCodes:  []string{"500001", "500016", "500034", "500081"},
+		Agents:    []string{"Ravi Kumar", "Suresh Reddy"},
+		Customers: []string{"Ananya Rao", "Karthik Varma", "Lakshmi Devi", "Mohammed Irfan", "Priya Sharma", "Sandeep Goud", "Swathi Naidu", "Vikram Chowdary"},
+	},
+	{
+		Name: "AquaHome Bengaluru South", City: "Bengaluru", State: "Karnataka",
+		ZipCodes:  []string{"560004", "560011", "560041", "560076"},
+		Agents:    []string{"Manjunath Gowda", "Pradeep Shetty"},
+		Customers: []string{"Aditi Hegde", "Arjun Iyer", "Deepa Murthy", "Harish Kamath", "Kavya Bhat", "Nikhil Rao", "Rohan Pai", "Shreya Kulkarni"},
+	},
+}
+
+var demoProducts = []Product{
+	{Name: "AquaPure Basic RO", Description: "Compact RO purifier for small families", MonthlyRent: 399, SecurityDeposit: 1000, InstallationFee: 0,
+		Features: "RO + UV, 7 L tank, TDS controller", Specifications: "Up to 2000 ppm TDS, 15 L/hr", AvailableStock: 40, MaintenanceCycle: 90},
+	{Name: "AquaPure Plus RO+UV", Description: "RO and UV purification with mineral booster", MonthlyRent: 549, SecurityDeposit: 1500, InstallationFee: 299,
+		Features: "RO + UV + UF, mineral cartridge, 9 L tank", Specifications: "Up to 2000 ppm TDS, 20 L/hr", AvailableStock: 30, MaintenanceCycle: 90},
+	{Name: "AquaPure Alkaline", Description: "Alkaline purifier with copper infusion", MonthlyRent: 699, SecurityDeposit: 2000, InstallationFee: 499,
+		Features: "RO + UV + alkaline + copper, 10 L tank", Specifications: "Up to 2500 ppm TDS, 20 L/hr", AvailableStock: 20, MaintenanceCycle: 120},
+	{Name: "AquaPure Under-Sink", Description: "Under-counter purifier with a dedicated faucet", MonthlyRent: 799, SecurityDeposit: 2500, InstallationFee: 599,
+		Features: "RO + UV, under-sink install, smart filter alerts", Specifications: "Up to 2000 ppm TDS, 25 L/hr", AvailableStock: 10, MaintenanceCycle: 180},
+}
+
+// demoOrderStatuses are the states demo orders cycle through, so every
+// screen has something to show. Installed orders get a subscription.
+var demoOrderStatuses = []string{
+	OrderStatusInstalled, OrderStatusInstalled, OrderStatusInstalled, OrderStatusPending,
+	OrderStatusApproved, OrderStatusInTransit, OrderStatusDelivered, OrderStatusCancelled,
+}
+
+// demoSubscriptionStatuses are the states demo subscriptions cycle through
+var demoSubscriptionStatuses = []string{
+	SubscriptionStatusActive, SubscriptionStatusActive, SubscriptionStatusPaused,
+	SubscriptionStatusActive, SubscriptionStatusSuspended,
+}
+
+// demoEmail returns the demo account address for a person's name
+func demoEmail(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", ".")) + "@demo.aquahome.com"
+}
+
+// seedDemo creates franchises with owners and agents, products, customers,
+// orders in every state, subscriptions, payments and service requests
+func seedDemo(tx *gorm.DB) error {
+	var existing int64
+	if err := tx.Model(&User{}).Where("email LIKE ?", "%@demo.aquahome.com").Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		log.Println("ℹ️ Demo data already loaded.")
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(DemoPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	// A fixed seed keeps the demo data the same after every reset
+	random := rand.New(rand.NewSource(1))
+	now := time.Now()
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	products := make([]Product, len(demoProducts))
+	copy(products, demoProducts)
+	for i := range products {
+		products[i].IsActive = true
+	}
+	if err := tx.Create(&products).Error; err != nil {
+		return err
+	}
+
+	invoice := 0
+	nextInvoice := func() string {
+		invoice++
+		return fmt.Sprintf("DEMO-%05d", invoice)
+	}
+
+	for f, spec := range demoFranchises {
+		owner := User{
+			Name: spec.Name + " Owner", Email: demoEmail(strings.Fields(spec.City)[0] + " owner"), PasswordHash: string(hash),
+			Role: RoleFranchiseOwner, Phone: fmt.Sprintf("98000%05d", f), City: spec.City, State: spec.State, ZipCode: spec.ZipCodes[0],
+		}
+		if err := tx.Create(&owner).Error; err != nil {
+			return err
+		}
+
+		franchise := Franchise{
+			OwnerID: owner.ID, Name: spec.Name, Address: "1 Main Road", City: spec.City, State: spec.State,
+			ZipCode: spec.ZipCodes[0], Phone: owner.Phone, Email: owner.Email, IsActive: true,
+			ServiceArea: spec.City, CoverageRadius: 15, ApprovalState: "approved",
+		}
+		if err := tx.Create(&franchise).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&owner).Update("franchise_id", franchise.ID).Error; err != nil {
+			return err
+		}
+
+		location := Location{Name: spec.City, ZipCodes: spec.ZipCodes, IsActive: true}
+		if err := tx.Create(&location).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&FranchiseLocation{FranchiseID: franchise.ID, LocationID: location.ID}).Error; err != nil {
+			return err
+		}
+
+		var agents []User
+		for a, name := range spec.Agents {
+			agents = append(agents, User{
+				Name: name, Email: demoEmail(name), PasswordHash: string(hash), Role: RoleServiceAgent,
+				FranchiseID: &franchise.ID, Phone: fmt.Sprintf("97000%03d%02d", f, a), City: spec.City, State: spec.State,
+				ZipCode: spec.ZipCodes[0],
+			})
+		}
+		if err := tx.Create(&agents).Error; err != nil {
+			return err
+		}
+
+		for c, name := range spec.Customers {
+			zip := spec.ZipCodes[c%len(spec.ZipCodes)]
+			address := fmt.Sprintf("%d, %s Colony, %s %s", 10+c, strings.Fields(name)[1], spec.City, zip)
+			customer := User{
+				Name: name, Email: demoEmail(name), PasswordHash: string(hash), Role: RoleCustomer,
+				Phone: fmt.Sprintf("96000%03d%02d", f, c), Address: address, City: spec.City, State: spec.State, ZipCode: zip,
+			}
+			customer.CreatedAt = daysAgo(200 - c*10)
+			if err := tx.Create(&customer).Error; err != nil {
+				return err
+			}
+
+			status := demoOrderStatuses[c%len(demoOrderStatuses)]
+			if err := seedDemoOrder(tx, random, nextInvoice, customer, franchise, agents, products[(c+f)%len(products)],
+				status, daysAgo(180-c*15), c); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("✅ Demo data loaded. Every demo account's password is %q.", DemoPassword)
+	return nil
+}
+
+// seedDemoOrder creates an order in the given status placed at placedAt,
+// with its initial payment, and for installed orders a subscription with
+// monthly payments and service requests
+func seedDemoOrder(tx *gorm.DB, random *rand.Rand, nextInvoice func() string, customer User, franchise Franchise,
+	agents []User, product Product, status string, placedAt time.Time, n int) error {
+	agent := agents[n%len(agents)]
+	order := Order{
+		CustomerID: customer.ID, ProductID: product.ID, FranchiseID: franchise.ID, OrderType: "rental", Status: status,
+		ShippingAddress: customer.Address, BillingAddress: customer.Address, RentalStartDate: placedAt.AddDate(0, 0, 3),
+		RentalDuration: 12, MonthlyRent: product.MonthlyRent, DeliveryDate: placedAt.AddDate(0, 0, 2),
+		SecurityDeposit: product.SecurityDeposit, InstallationFee: product.InstallationFee,
+		TotalInitialAmount: product.MonthlyRent + product.SecurityDeposit + product.InstallationFee,
+	}
+	order.CreatedAt = placedAt
+	switch status {
+	case OrderStatusInTransit, OrderStatusDelivered, OrderStatusInstalled:
+		order.ServiceAgentID = &agent.ID
+	case OrderStatusCancelled:
+		cancelledAt := placedAt.AddDate(0, 0, 1)
+		order.CancellationReason = "Moving to a new city"
+		order.CancelledAt = &cancelledAt
+		order.CancelledBy = &customer.ID
+	}
+	if err := tx.Create(&order).Error; err != nil {
+		return err
+	}
+
+	initial := Payment{
+		CustomerID: customer.ID, OrderID: &order.ID, Amount: order.TotalInitialAmount, PaymentType: "initial",
+		Status: PaymentStatusSuccess, InvoiceNumber: nextInvoice(), PaymentMethod: "razorpay",
+		TransactionID: fmt.Sprintf("pay_demo%08d", order.ID),
+	}
+	initial.CreatedAt = placedAt
+	switch status {
+	case OrderStatusPending:
+		initial.Status = PaymentStatusPending
+		initial.TransactionID = ""
+	case OrderStatusCancelled:
+		refundedAt := placedAt.AddDate(0, 0, 1)
+		initial.Status = PaymentStatusRefunded
+		initial.RazorpayRefundID = fmt.Sprintf("rfnd_demo%08d", order.ID)
+		initial.RefundedAt = &refundedAt
+	}
+	if err := tx.Create(&initial).Error; err != nil {
+		return err
+	}
+
+	if status != OrderStatusInstalled {
+		return nil
+	}
+
+	start := order.RentalStartDate
+	subscription := Subscription{
+		OrderID: order.ID, CustomerID: customer.ID, ProductID: product.ID, FranchiseID: franchise.ID,
+		ServiceAgentID: &agent.ID, Status: demoSubscriptionStatuses[n%len(demoSubscriptionStatuses)],
+		StartDate: start, EndDate: start.AddDate(1, 0, 0), MonthlyRent: product.MonthlyRent,
+		LastMaintenance: start, NextMaintenance: start.AddDate(0, 0, product.MaintenanceCycle),
+	}
+	subscription.CreatedAt = start
+	if subscription.Status == SubscriptionStatusSuspended {
+		suspendedAt := time.Now().AddDate(0, 0, -3)
+		subscription.SuspendedAt = &suspendedAt
+	}
+
+	// Monthly rent was collected for every month so far, except that a
+	// suspended subscription missed its last payment
+	var monthly []Payment
+	billing := start.AddDate(0, 1, 0)
+	for ; billing.Before(time.Now()); billing = billing.AddDate(0, 1, 0) {
+		payment := Payment{
+			CustomerID: customer.ID, Amount: product.MonthlyRent, PaymentType: "monthly", Status: PaymentStatusSuccess,
+			InvoiceNumber: nextInvoice(), PaymentMethod: "razorpay_autopay",
+			TransactionID: fmt.Sprintf("pay_demo%04d%04d", order.ID, len(monthly)+1),
+		}
+		payment.CreatedAt = billing
+		monthly = append(monthly, payment)
+	}
+	if subscription.Status == SubscriptionStatusSuspended && len(monthly) > 0 {
+		last := &monthly[len(monthly)-1]
+		last.Status = PaymentStatusFailed
+		last.TransactionID = ""
+		billing = last.CreatedAt
+	}
+	subscription.NextBillingDate = billing
+	if err := tx.Create(&subscription).Error; err != nil {
+		return err
+	}
+	for i := range monthly {
+		monthly[i].SubscriptionID = &subscription.ID
+	}
+	if len(monthly) > 0 {
+		if err := tx.Create(&monthly).Error; err != nil {
+			return err
+		}
+	}
+
+	// One finished maintenance visit, and an open repair on every other subscription
+	completedAt := start.AddDate(0, 0, 30+random.Intn(30))
+	rating := 4 + random.Intn(2)
+	requests := []ServiceRequest{{
+		CustomerID: customer.ID, SubscriptionID: subscription.ID, FranchiseID: franchise.ID, ServiceAgentID: &agent.ID,
+		Type: "maintenance", Status: ServiceStatusCompleted, Description: "Scheduled filter check",
+		ScheduledTime: &completedAt, CompletionTime: &completedAt, AssignedAt: &completedAt, AcceptedAt: &completedAt,
+		Rating: &rating, Feedback: "Technician was on time and explained everything",
+	}}
+	requests[0].CreatedAt = completedAt.AddDate(0, 0, -2)
+	if n%2 == 0 {
+		openStatuses := []string{ServiceStatusPending, ServiceStatusAssigned, ServiceStatusScheduled}
+		repair := ServiceRequest{
+			CustomerID: customer.ID, SubscriptionID: subscription.ID, FranchiseID: franchise.ID,
+			Type: "repair", Status: openStatuses[random.Intn(len(openStatuses))], Description: "Water flow is slow and the tap drips",
+		}
+		if repair.Status != ServiceStatusPending {
+			assignedAt := time.Now().AddDate(0, 0, -1)
+			scheduled := time.Now().AddDate(0, 0, 1)
+			repair.ServiceAgentID = &agent.ID
+			repair.AssignedAt = &assignedAt
+			repair.ScheduledTime = &scheduled
+		}
+		repair.CreatedAt = time.Now().AddDate(0, 0, -2)
+		requests = append(requests, repair)
+	}
+	return tx.Create(&requests).Error
+}
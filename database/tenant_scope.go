@@ -0,0 +1,201 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"aquahome/tenant"
+)
+
+// tenantField is the field of models whose rows belong to a tenant
+const tenantField = "TenantID"
+
+// tenantParent is a field naming the row a new row takes its tenant from,
+// when it is created without a tenant on its context
+type tenantParent struct {
+	field string
+	table string
+}
+
+// tenantParents are tried in order; the customer or user a row belongs to
+// decides its tenant before the order or franchise it is about
+var tenantParents = []tenantParent{
+	{"CustomerID", "users"},
+	{"UserID", "users"},
+	{"OrderID", "orders"},
+	{"SubscriptionID", "subscriptions"},
+	{"PaymentID", "payments"},
+	{"FranchiseID", "franchises"},
+}
+
+// RegisterTenantScope confines queries made with a context naming a tenant
+// to that tenant's rows of models with a TenantID, and stamps the tenant on
+// rows they create. Queries without one, such as background jobs and
+// webhooks, see every tenant, and the rows they create take the tenant of
+// the customer, order or franchise they belong to. Raw SQL is left as
+// written.
+func RegisterTenantScope(db *gorm.DB) error {
+	scope := func(tx *gorm.DB) {
+		id, ok := tenant.FromContext(tx.Statement.Context)
+		if !ok || tx.Statement.SQL.Len() > 0 {
+			return
+		}
+		column := ""
+		if tx.Statement.Schema != nil {
+			if field := tx.Statement.Schema.LookUpField(tenantField); field != nil {
+				column = field.DBName
+			}
+		}
+		// Table("payments") scanned into a struct of its own is scoped by
+		// the table it reads
+		if column == "" && tenantTables[tx.Statement.Table] {
+			column = "tenant_id"
+		}
+		if column == "" {
+			return
+		}
+		// A query reused for a count and then a find is scoped once
+		if _, scoped := tx.Statement.Clauses["tenant_scope"]; scoped {
+			return
+		}
+		tx.Statement.Clauses["tenant_scope"] = clause.Clause{}
+		tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: id},
+		}})
+	}
+	stamp := func(tx *gorm.DB) {
+		if tx.Statement.Schema == nil {
+			return
+		}
+		field := tx.Statement.Schema.LookUpField(tenantField)
+		if field == nil {
+			return
+		}
+		if id, ok := tenant.FromContext(tx.Statement.Context); ok {
+			tx.Statement.SetColumn(tenantField, id, true)
+			return
+		}
+		inheritTenant(tx, field)
+	}
+
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:scope_query", scope); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:scope_row", scope); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:scope_update", scope); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:scope_delete", scope); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenant:stamp_create", stamp)
+}
+
+// inheritTenant sets the tenant of rows being created that have none from
+// the first of their tenantParents they name
+func inheritTenant(tx *gorm.DB, field *schema.Field) {
+	ctx := tx.Statement.Context
+	lookup := tx.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	known := map[string]uint{}
+	setFromParent := func(row reflect.Value) {
+		if _, zero := field.ValueOf(ctx, row); !zero {
+			return
+		}
+		for _, parent := range tenantParents {
+			parentField := tx.Statement.Schema.LookUpField(parent.field)
+			if parentField == nil {
+				continue
+			}
+			value, zero := parentField.ValueOf(ctx, row)
+			if zero {
+				continue
+			}
+			id := reflect.Indirect(reflect.ValueOf(value)).Interface()
+			key := fmt.Sprint(parent.table, ":", id)
+			tenantID, found := known[key]
+			if !found {
+				if err := lookup.Raw("SELECT tenant_id FROM "+parent.table+" WHERE id = ?", id).Scan(&tenantID).Error; err != nil {
+					log.Printf("Failed to read the tenant of %s %v: %v", parent.table, id, err)
+				}
+				known[key] = tenantID
+			}
+			if tenantID != 0 {
+				if err := field.Set(ctx, row, tenantID); err != nil {
+					log.Printf("Failed to set the tenant of a new %s: %v", tx.Statement.Schema.Table, err)
+				}
+				return
+			}
+		}
+	}
+
+	switch rv := tx.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			setFromParent(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		setFromParent(rv)
+	}
+}
+
+// tenantOwned are the tables whose rows belong to a customer or franchise,
+// with the column naming it and the table it is in
+var tenantOwned = []struct{ table, column, parent string }{
+	{"subscriptions", "customer_id", "users"},
+	{"payments", "customer_id", "users"},
+	{"service_requests", "customer_id", "users"},
+	{"mandates", "customer_id", "users"},
+	{"credit_notes", "customer_id", "users"},
+	{"disputes", "customer_id", "users"},
+	{"deposit_settlements", "customer_id", "users"},
+	{"coupon_redemptions", "customer_id", "users"},
+	{"payment_links", "customer_id", "users"},
+	{"blacklist_entries", "customer_id", "users"},
+	{"risk_overrides", "customer_id", "users"},
+	{"appointment_reminders", "customer_id", "users"},
+	{"account_deletions", "user_id", "users"},
+	{"audit_logs", "user_id", "users"},
+	{"settlements", "franchise_id", "franchises"},
+	{"cash_deposits", "franchise_id", "franchises"},
+	{"inventory_items", "franchise_id", "franchises"},
+	{"stock_movements", "franchise_id", "franchises"},
+	{"coupons", "franchise_id", "franchises"},
+	{"announcements", "franchise_id", "franchises"},
+	{"api_keys", "created_by", "users"},
+}
+
+// tenantTables are the tables with a tenant_id, for queries that name the
+// table rather than its model
+var tenantTables = func() map[string]bool {
+	tables := map[string]bool{"users": true, "products": true, "franchises": true, "orders": true, "leads": true}
+	for _, owned := range tenantOwned {
+		tables[owned.table] = true
+	}
+	return tables
+}()
+
+// BackfillTenants gives rows from before their table had a tenant the tenant
+// of the customer or franchise they belong to. It only has work to do once a
+// second tenant exists; failures are logged, as the rows stay readable by
+// the default tenant.
+func BackfillTenants() {
+	var tenants int64
+	if err := DB.Model(&Tenant{}).Count(&tenants).Error; err != nil || tenants < 2 {
+		return
+	}
+	for _, owned := range tenantOwned {
+		statement := "UPDATE " + owned.table + " AS t SET tenant_id = p.tenant_id FROM " + owned.parent +
+			" AS p WHERE p.id = t." + owned.column + " AND t.tenant_id <> p.tenant_id"
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("⚠️ Failed to backfill the tenants of %s: %v", owned.table, err)
+		}
+	}
+}
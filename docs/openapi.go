@@ -0,0 +1,163 @@
+// Package docs builds the OpenAPI 3 description of the API and serves it with Swagger UI.
+package docs
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+)
+
+// Operation documents one endpoint. Request and Response are zero values of the
+// Go types bound and returned by the handler.
+type Operation struct {
+	Summary  string
+	Tags     []string
+	Request  interface{}
+	Response interface{}
+	Query    []string // documented query parameters
+	Public   bool     // no bearer token needed
+}
+
+// basePath is the API prefix documented by the spec; legacy aliases are left out
+const basePath = "/api/v1"
+
+var pathParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// Spec serves the OpenAPI document for every route registered on r
+func Spec(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, Build(r.Routes()))
+	}
+}
+
+// Build assembles the OpenAPI document. Every /api/v1 route is listed; routes with
+// an entry in operations get summaries and request/response schemas.
+func Build(routes gin.RoutesInfo) map[string]interface{} {
+	builder := newSchemaBuilder()
+	paths := map[string]map[string]interface{}{}
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, basePath+"/") {
+			continue
+		}
+		relative := strings.TrimPrefix(route.Path, basePath)
+		if strings.HasPrefix(relative, "/docs") {
+			continue
+		}
+
+		op := operations[route.Method+" "+relative]
+		path := pathParam.ReplaceAllString(relative, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = buildOperation(builder, route, relative, op)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "AquaHome API",
+			"version":     "1.0.0",
+			"description": "Water purifier rental platform API. Unversioned /api paths are deprecated aliases of /api/v1.",
+		},
+		"servers": []map[string]string{{"url": basePath}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": builder.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKeyAuth": map[string]string{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+func buildOperation(builder *schemaBuilder, route gin.RouteInfo, relative string, op Operation) map[string]interface{} {
+	tags := op.Tags
+	if len(tags) == 0 {
+		tags = []string{defaultTag(relative)}
+	}
+	summary := op.Summary
+	if summary == "" {
+		summary = handlerName(route.Handler)
+	}
+
+	operation := map[string]interface{}{
+		"summary":     summary,
+		"operationId": route.Method + strings.NewReplacer("/", "_", ":", "").Replace(relative),
+		"tags":        tags,
+	}
+
+	var params []map[string]interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(relative, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+		})
+	}
+	for _, q := range op.Query {
+		params = append(params, map[string]interface{}{
+			"name": q, "in": "query", "required": false, "schema": map[string]string{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+
+	if schema := builder.schemaFor(op.Request); schema != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+		}
+	}
+
+	success := map[string]interface{}{"description": "Success"}
+	if schema := builder.schemaFor(op.Response); schema != nil {
+		success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+	}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{"application/json": map[string]interface{}{
+			"schema": builder.schemaFor(apperror.Error{}),
+		}},
+	}
+	operation["responses"] = map[string]interface{}{"200": success, "default": errorResponse}
+
+	switch {
+	case strings.HasPrefix(relative, "/partner/"):
+		operation["security"] = []map[string][]string{{"apiKeyAuth": {}}}
+	case !op.Public && !isPublicPath(relative):
+		operation["security"] = []map[string][]string{{"bearerAuth": {}}}
+	}
+	return operation
+}
+
+// defaultTag groups undocumented routes by their first path segment
+func defaultTag(relative string) string {
+	segment := strings.Split(strings.TrimPrefix(relative, "/"), "/")[0]
+	if segment == "" {
+		return "misc"
+	}
+	return segment
+}
+
+// handlerName turns "aquahome/controllers.GetAgentRoute" into "GetAgentRoute"
+func handlerName(handler string) string {
+	if i := strings.LastIndex(handler, "."); i >= 0 {
+		return handler[i+1:]
+	}
+	return handler
+}
+
+func isPublicPath(relative string) bool {
+	if strings.HasPrefix(relative, "/auth/2fa/") {
+		return relative == "/auth/2fa/verify"
+	}
+	return strings.HasPrefix(relative, "/auth/") && relative != "/auth/logout" && relative != "/auth/refresh/v2" ||
+		relative == "/payments/webhook" || relative == "/products"
+}
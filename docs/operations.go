@@ -0,0 +1,291 @@
+package docs
+
+import (
+	"aquahome/controllers"
+	"aquahome/database"
+	"aquahome/ledger"
+	"aquahome/risk"
+)
+
+// operations documents routes by "METHOD path" relative to /api/v1. Routes
+// without an entry are still listed in the spec, named after their handler.
+var operations = map[string]Operation{
+	// Auth
+	"POST /auth/login":       {Summary: "Log in with email and password", Tags: []string{"auth"}, Request: controllers.LoginRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/register":    {Summary: "Register a user", Tags: []string{"auth"}, Request: controllers.RegisterRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/login/v2":    {Summary: "Log in with email and password", Tags: []string{"auth"}, Request: controllers.LoginRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/register/v2": {Summary: "Register a user with address details", Tags: []string{"auth"}, Request: controllers.RegisterRequestNew{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/refresh":     {Summary: "Exchange a refresh token for new tokens (rotates the refresh token)", Tags: []string{"auth"}, Request: controllers.RefreshRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/logout":      {Summary: "Revoke the current session", Tags: []string{"auth"}, Request: controllers.RefreshRequest{}},
+	"POST /auth/forgot-password": {Summary: "Email a password reset code and link", Tags: []string{"auth"}, Request: struct {
+		Email string `json:"email" binding:"required"`
+	}{}, Public: true},
+	"POST /auth/reset-password": {Summary: "Reset the password with the emailed token, or email and OTP", Tags: []string{"auth"}, Request: struct {
+		Token       string `json:"token"`
+		Email       string `json:"email"`
+		OTP         string `json:"otp"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}{}, Public: true},
+	"POST /auth/otp/request":      {Summary: "Send a login code to a customer's phone", Tags: []string{"auth"}, Request: controllers.OTPRequest{}, Public: true},
+	"POST /auth/otp/verify":       {Summary: "Log in (or sign up) with a phone login code", Tags: []string{"auth"}, Request: controllers.OTPVerifyRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/google":           {Summary: "Sign in with a Google ID token", Tags: []string{"auth"}, Request: controllers.GoogleSignInRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/2fa/verify":       {Summary: "Finish a login with an authenticator or backup code", Tags: []string{"auth"}, Request: controllers.TwoFactorVerifyRequest{}, Response: controllers.LoginResponse{}, Public: true},
+	"POST /auth/2fa/setup":        {Summary: "Start authenticator setup; returns the secret and otpauth URL for a QR code (admins and franchise owners)", Tags: []string{"auth"}},
+	"POST /auth/2fa/enable":       {Summary: "Confirm authenticator setup with a first code; returns backup codes", Tags: []string{"auth"}, Request: controllers.TwoFactorCodeRequest{}},
+	"POST /auth/2fa/disable":      {Summary: "Turn off two-factor login, unless policy requires it", Tags: []string{"auth"}, Request: controllers.TwoFactorCodeRequest{}},
+	"POST /auth/2fa/backup-codes": {Summary: "Replace your backup codes", Tags: []string{"auth"}, Request: controllers.TwoFactorCodeRequest{}},
+
+	// Email verification
+	"GET /auth/verify-email":         {Summary: "Confirm your email address with the emailed token", Tags: []string{"auth"}, Query: []string{"token"}, Public: true},
+	"POST /auth/verify-email/resend": {Summary: "Email a new verification link (3 per hour)", Tags: []string{"auth"}},
+
+	// Profile
+	"GET /profile":                                  {Summary: "Current user's profile", Tags: []string{"profile"}, Response: database.User{}},
+	"PUT /profile":                                  {Summary: "Update the current user's profile", Tags: []string{"profile"}, Request: controllers.UpdateProfileRequest{}},
+	"POST /users/me/export":                         {Summary: "Start generating an archive of your personal data", Tags: []string{"profile"}, Response: database.DataExport{}},
+	"GET /users/me/export":                          {Summary: "Status of your latest data export", Tags: []string{"profile"}, Response: database.DataExport{}},
+	"GET /users/me/export/:id/download":             {Summary: "Download a ready data export (ZIP)", Tags: []string{"profile"}},
+	"DELETE /users/me":                              {Summary: "Delete and anonymize your account", Tags: []string{"profile"}, Request: controllers.DeleteAccountRequest{}},
+	"POST /users/me/avatar":                         {Summary: "Upload a profile photo (multipart \"avatar\", up to 5 MB); stored as a 256px square JPEG", Tags: []string{"profile"}, Response: database.User{}},
+	"GET /users/me/wallet":                          {Summary: "Wallet balance and transactions", Tags: []string{"profile"}},
+	"GET /users/me/addresses":                       {Summary: "Address book, default shipping and billing addresses first", Tags: []string{"profile"}, Response: []database.Address{}},
+	"POST /users/me/addresses":                      {Summary: "Add an address; flags make it the default shipping or billing address", Tags: []string{"profile"}, Request: controllers.AddressRequest{}, Response: database.Address{}},
+	"PUT /users/me/addresses/:id":                   {Summary: "Edit an address; orders already placed keep their copy", Tags: []string{"profile"}, Request: controllers.AddressRequest{}, Response: database.Address{}},
+	"DELETE /users/me/addresses/:id":                {Summary: "Remove an address from the address book", Tags: []string{"profile"}},
+	"GET /notifications":                            {Summary: "Your notifications, newest first; answers 304 to a matching If-None-Match", Tags: []string{"profile"}, Query: []string{"page", "limit", "cursor", "type", "unread"}},
+	"GET /notifications/unread-count":               {Summary: "Number of unread notifications", Tags: []string{"profile"}},
+	"PATCH /notifications/:id/read":                 {Summary: "Mark a notification as read", Tags: []string{"profile"}, Response: database.Notification{}},
+	"POST /notifications/read-all":                  {Summary: "Mark all notifications, or those of ?type=, as read", Tags: []string{"profile"}, Query: []string{"type"}},
+	"GET /users/me/deposit-settlements":             {Summary: "Status of your security deposit refunds", Tags: []string{"profile"}, Response: []database.DepositSettlement{}},
+	"GET /users/me/sessions":                        {Summary: "Devices signed in to your account", Tags: []string{"profile"}, Response: []controllers.SessionInfo{}},
+	"DELETE /users/me/sessions":                     {Summary: "Log out everywhere, or everywhere but this device with keep_current", Tags: []string{"profile"}, Query: []string{"keep_current"}},
+	"DELETE /users/me/sessions/:id":                 {Summary: "Sign a device out", Tags: []string{"profile"}},
+	"POST /users/me/devices":                        {Summary: "Register this device for push notifications", Tags: []string{"profile"}, Request: controllers.PushDeviceRequest{}, Response: database.PushDevice{}},
+	"DELETE /users/me/devices/:id":                  {Summary: "Stop push notifications to a device", Tags: []string{"profile"}},
+	"GET /admin/account-deletions":                  {Summary: "Log of deleted accounts", Tags: []string{"admin"}, Query: []string{"from", "to", "page", "limit"}, Response: []database.AccountDeletion{}},
+	"POST /admin/users/:id/impersonate":             {Summary: "Short-lived token to act as a non-admin user for support; every request made with it is audited", Tags: []string{"admin"}, Request: controllers.ImpersonationRequest{}},
+	"GET /admin/security-policy":                    {Summary: "Account security policy", Tags: []string{"admin"}, Response: database.SecurityPolicy{}},
+	"GET /admin/tenants":                            {Summary: "Brands served by this deployment (default tenant's admins only)", Tags: []string{"admin"}, Response: []database.Tenant{}},
+	"POST /admin/tenants":                           {Summary: "Add a brand, optionally with its first admin (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.CreateTenantRequest{}, Response: database.Tenant{}},
+	"PUT /admin/tenants/:id":                        {Summary: "Rename a brand, change its domains or stop serving it (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.UpdateTenantRequest{}, Response: database.Tenant{}},
+	"GET /admin/maintenance":                        {Summary: "Maintenance mode", Tags: []string{"admin"}, Response: database.MaintenanceMode{}},
+	"PUT /admin/maintenance":                        {Summary: "Turn maintenance mode on or off; everyone but admins and the allowed roles gets 503 (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.MaintenanceModeRequest{}, Response: database.MaintenanceMode{}},
+	"PUT /admin/security-policy":                    {Summary: "Require two-factor login for admins and franchise owners (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.SecurityPolicyRequest{}, Response: database.SecurityPolicy{}},
+	"GET /admin/api-keys":                           {Summary: "Partner API keys", Tags: []string{"admin"}, Response: []database.APIKey{}},
+	"GET /admin/api-keys/scopes":                    {Summary: "Scopes an API key can be granted", Tags: []string{"admin"}},
+	"POST /admin/api-keys":                          {Summary: "Issue a partner API key; the full key is only returned here", Tags: []string{"admin"}, Request: controllers.APIKeyRequest{}, Response: controllers.APIKeyCreatedResponse{}},
+	"DELETE /admin/api-keys/:id":                    {Summary: "Revoke a partner API key", Tags: []string{"admin"}, Response: database.APIKey{}},
+	"GET /admin/webhooks":                           {Summary: "Outbound webhook endpoints (default tenant's admins only)", Tags: []string{"admin"}, Response: []database.WebhookEndpoint{}},
+	"GET /admin/webhooks/events":                    {Summary: "Events a webhook endpoint can subscribe to (default tenant's admins only)", Tags: []string{"admin"}},
+	"POST /admin/webhooks":                          {Summary: "Register a webhook endpoint; the signing secret is only returned here (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.WebhookEndpointRequest{}, Response: controllers.WebhookEndpointCreatedResponse{}},
+	"PUT /admin/webhooks/:id":                       {Summary: "Update a webhook endpoint (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.WebhookEndpointRequest{}, Response: database.WebhookEndpoint{}},
+	"DELETE /admin/webhooks/:id":                    {Summary: "Delete a webhook endpoint (default tenant's admins only)", Tags: []string{"admin"}},
+	"GET /admin/webhooks/:id/deliveries":            {Summary: "Delivery log of a webhook endpoint (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"status", "event", "page", "limit"}},
+	"GET /admin/outbox":                             {Summary: "Outbox events and their relay state (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"status", "name", "page", "limit"}},
+	"POST /admin/outbox/:id/retry":                  {Summary: "Relay a failed outbox event again (default tenant's admins only)", Tags: []string{"admin"}, Response: database.OutboxEvent{}},
+	"GET /admin/notification-deliveries":            {Summary: "Email, SMS and push deliveries; status=failed is the dead-letter list (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"status", "channel", "user_id", "event", "page", "limit"}},
+	"POST /admin/notification-deliveries/:id/retry": {Summary: "Send a dead-lettered notification again now (default tenant's admins only)", Tags: []string{"admin"}, Response: database.NotificationDelivery{}},
+	"GET /admin/jobs":                               {Summary: "Job queue depth with retrying and dead-lettered tasks (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"limit"}},
+	"POST /admin/jobs/dead/:id/retry":               {Summary: "Put a dead-lettered job back on the queue (default tenant's admins only)", Tags: []string{"admin"}},
+	"GET /admin/alerts":                             {Summary: "Alerts posted to Slack or Telegram about payment verification spikes, SLA breaches and failing webhooks (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"kind", "subject", "page", "limit"}, Response: []database.Alert{}},
+	"GET /admin/archive":                            {Summary: "Notifications and closed service requests moved out by the retention job (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"source", "user_id", "record_id", "page", "limit"}, Response: []database.ArchivedRecord{}},
+	"POST /admin/webhook-deliveries/:id/redeliver":  {Summary: "Send a webhook delivery again now (default tenant's admins only)", Tags: []string{"admin"}, Response: database.WebhookDelivery{}},
+
+	// Partner API, authenticated with an X-API-Key header
+	"GET /partner/products":          {Summary: "Active product catalog", Tags: []string{"partner"}, Response: []database.Product{}},
+	"GET /partner/orders":            {Summary: "Orders, oldest update first", Tags: []string{"partner"}, Query: []string{"status", "updated_since", "page", "limit"}},
+	"GET /partner/subscriptions/:id": {Summary: "Look up a subscription", Tags: []string{"partner"}, Response: database.Subscription{}},
+	"GET /partner/service-requests":  {Summary: "Service requests, oldest update first", Tags: []string{"partner"}, Query: []string{"status", "updated_since", "page", "limit"}},
+	"POST /partner/service-requests": {Summary: "Raise a service request for an active subscription", Tags: []string{"partner"}, Request: controllers.PartnerServiceRequest{}, Response: database.ServiceRequest{}},
+	"POST /profile/change-password":  {Summary: "Change password", Tags: []string{"profile"}, Request: controllers.ChangePasswordRequest{}},
+
+	// Products
+	"GET /products":                                   {Summary: "Products available in the customer's area; answers 304 to a matching If-None-Match", Tags: []string{"products"}, Response: []database.Product{}},
+	"GET /public/serviceability":                      {Summary: "Whether a pincode is served, installation lead time and available products", Tags: []string{"products"}, Query: []string{"pincode"}, Response: controllers.ServiceabilityResponse{}, Public: true},
+	"POST /public/leads":                              {Summary: "Book a demo: leaves a lead for the franchise serving the pincode; needs a CAPTCHA token", Tags: []string{"leads"}, Request: controllers.CreateLeadRequest{}, Public: true},
+	"GET /public/appointments/:token":                 {Summary: "The visit an appointment reminder link is for; 410 once it has moved", Tags: []string{"appointments"}, Response: database.AppointmentReminder{}, Public: true},
+	"POST /public/appointments/:token/confirm":        {Summary: "Confirm the customer will be home for the visit", Tags: []string{"appointments"}, Public: true},
+	"POST /public/appointments/:token/reschedule":     {Summary: "Ask the franchise to move the visit, optionally to a preferred time", Tags: []string{"appointments"}, Request: controllers.RescheduleAppointmentRequest{}, Public: true},
+	"GET /products/:id":                               {Summary: "Product details", Tags: []string{"products"}, Response: database.Product{}},
+	"POST /admin/products":                            {Summary: "Create a product", Tags: []string{"admin"}, Request: controllers.ProductRequest{}, Response: database.Product{}},
+	"PUT /admin/products/:id":                         {Summary: "Update a product", Tags: []string{"admin"}, Request: controllers.ProductRequest{}, Response: database.Product{}},
+	"GET /admin/products/:id/variants":                {Summary: "List product variants", Tags: []string{"admin"}, Response: []database.ProductVariant{}},
+	"POST /admin/products/:id/variants":               {Summary: "Add a product variant", Tags: []string{"admin"}, Request: controllers.ProductVariantRequest{}, Response: database.ProductVariant{}},
+	"PUT /admin/products/:id/variants/:variant_id":    {Summary: "Update a product variant", Tags: []string{"admin"}, Request: controllers.ProductVariantRequest{}, Response: database.ProductVariant{}},
+	"DELETE /admin/products/:id/variants/:variant_id": {Summary: "Archive a product variant and its plans", Tags: []string{"admin"}},
+	"GET /admin/products/:id/plans":                   {Summary: "List rental plan tiers", Tags: []string{"admin"}, Response: []database.RentalPlan{}},
+	"POST /admin/products/:id/plans":                  {Summary: "Add a rental plan tier", Tags: []string{"admin"}, Request: controllers.RentalPlanRequest{}, Response: database.RentalPlan{}},
+	"PUT /admin/products/:id/plans/:plan_id":          {Summary: "Update a rental plan tier; placed orders keep the terms they were ordered with", Tags: []string{"admin"}, Request: controllers.RentalPlanRequest{}, Response: database.RentalPlan{}},
+	"DELETE /admin/products/:id/plans/:plan_id":       {Summary: "Archive a rental plan tier", Tags: []string{"admin"}},
+	"GET /products/:id/images":                        {Summary: "Product image gallery in display order", Tags: []string{"products"}, Response: []database.ProductImage{}},
+	"POST /admin/products/:id/images":                 {Summary: "Upload product images (multipart field \"images\"); thumbnail, medium and full sizes are generated, and a WebP thumbnail in the background", Tags: []string{"admin"}, Response: []database.ProductImage{}},
+	"PUT /admin/products/:id/images/order":            {Summary: "Reorder the product image gallery", Tags: []string{"admin"}, Request: controllers.ReorderProductImagesRequest{}, Response: []database.ProductImage{}},
+	"DELETE /admin/products/:id/images/:image_id":     {Summary: "Delete a product image", Tags: []string{"admin"}},
+
+	// Orders
+	"POST /orders":                             {Summary: "Place an order", Tags: []string{"orders"}, Request: controllers.OrderRequest{}, Response: database.Order{}},
+	"POST /orders/validate-coupon":             {Summary: "Preview the discount a coupon gives on an order", Tags: []string{"orders"}, Request: controllers.ValidateCouponRequest{}},
+	"POST /admin/announcements":                {Summary: "Broadcast a notification, and optionally email and SMS, to an audience; delivered in the background", Tags: []string{"admin"}, Request: controllers.AnnouncementRequest{}, Response: database.Announcement{}},
+	"GET /admin/announcements":                 {Summary: "Broadcasts with delivery stats, newest first", Tags: []string{"admin"}, Query: []string{"page", "limit"}},
+	"GET /admin/announcements/:id":             {Summary: "A broadcast and its delivery stats", Tags: []string{"admin"}, Response: database.Announcement{}},
+	"GET /admin/notification-templates":        {Summary: "Notification events with their variables, built-in copy and templates (default tenant's admins only)", Tags: []string{"admin"}, Response: []controllers.NotificationEvent{}},
+	"PUT /admin/notification-templates":        {Summary: "Create or replace the copy of a notification event in a locale (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.NotificationTemplateRequest{}, Response: database.NotificationTemplate{}},
+	"DELETE /admin/notification-templates/:id": {Summary: "Remove a notification template (default tenant's admins only)", Tags: []string{"admin"}},
+	"GET /admin/coupons":                       {Summary: "Coupons with redemption counts and total discount", Tags: []string{"admin"}, Query: []string{"active"}},
+	"POST /admin/coupons":                      {Summary: "Create a coupon", Tags: []string{"admin"}, Request: controllers.CouponRequest{}, Response: database.Coupon{}},
+	"PUT /admin/coupons/:id":                   {Summary: "Update a coupon", Tags: []string{"admin"}, Request: controllers.CouponRequest{}, Response: database.Coupon{}},
+	"DELETE /admin/coupons/:id":                {Summary: "Delete a coupon", Tags: []string{"admin"}},
+	"GET /admin/coupons/:id/redemptions":       {Summary: "Coupon redemption report", Tags: []string{"admin"}, Query: []string{"from", "to", "status"}},
+	"POST /orders/:id/cancel":                  {Summary: "Cancel an order before delivery and refund its payment", Tags: []string{"orders"}, Request: controllers.CancelOrderRequest{}},
+	"GET /orders/:id/timeline":                 {Summary: "List an order's status changes with who made them", Tags: []string{"orders"}, Response: controllers.OrderTimelineEntry{}},
+	"GET /orders/:id/agreement":                {Summary: "Rental agreement of an approved order and whether it was accepted", Tags: []string{"orders"}, Response: database.RentalAgreement{}},
+	"GET /orders/:id/agreement/pdf":            {Summary: "Download the rental agreement PDF", Tags: []string{"orders"}},
+	"POST /orders/:id/agreement/otp":           {Summary: "Text the customer a code to accept the rental agreement", Tags: []string{"orders"}},
+	"POST /orders/:id/agreement/accept":        {Summary: "Accept the rental agreement with the texted code, recording time and IP as consent", Tags: []string{"orders"}, Request: controllers.AcceptAgreementRequest{}},
+	"GET /orders/:id/installation-report":      {Summary: "Installation checklist and photos of an order", Tags: []string{"orders"}, Response: database.InstallationReport{}},
+	"PUT /orders/:id/status":                   {Summary: "Update order status", Tags: []string{"orders"}, Request: controllers.UpdateOrderStatusRequest{}},
+	"POST /admin/orders/bulk-status":           {Summary: "Move up to 200 orders to one status, with a result per order", Tags: []string{"admin"}, Request: controllers.BulkOrderStatusRequest{}, Response: []controllers.BulkItemResult{}},
+	"POST /admin/service-requests/bulk-assign": {Summary: "Assign up to 200 service requests to an agent, with a result per request", Tags: []string{"admin"}, Request: controllers.BulkAssignRequest{}, Response: []controllers.BulkItemResult{}},
+	"POST /admin/locations/import":             {Summary: "Upsert locations and franchise pincode coverage from a CSV (city, state, pincodes, franchise_id, is_active) (default tenant's admins only)", Tags: []string{"admin"}, Query: []string{"dry_run", "allow_overlap"}, Response: controllers.LocationImportResult{}},
+	"PATCH /admin/orders/:id/assign":           {Summary: "Assign an order to a franchise", Tags: []string{"admin"}, Request: controllers.AssignOrderRequest{}},
+
+	// Subscriptions
+	"PUT /subscriptions/:id": {Summary: "Update a subscription", Tags: []string{"subscriptions"}, Request: controllers.SubscriptionUpdateRequest{}},
+
+	// Service requests
+	"GET /services":                                      {Summary: "Service requests visible to you, filtered and sorted (sort=created_at, -rating, ...)", Tags: []string{"services"}, Query: []string{"status", "type", "franchise_id", "agent_id", "from", "to", "rating", "min_rating", "max_rating", "sort"}, Response: []controllers.ServiceRequestWithDetails{}},
+	"POST /services":                                     {Summary: "Book a service visit in an available slot", Tags: []string{"services"}, Request: controllers.ServiceRequestCreateRequest{}, Response: database.ServiceRequest{}},
+	"PUT /services/:id":                                  {Summary: "Update a service request", Tags: []string{"services"}, Request: controllers.ServiceRequestUpdateRequest{}},
+	"GET /services/:id/report":                           {Summary: "Completion report of a service visit with parts and photos", Tags: []string{"services"}, Response: database.ServiceReport{}},
+	"POST /services/:id/attachments":                     {Summary: "Attach photos or videos of the problem to an open service request (multipart field \"files\"); location data is removed from photos", Tags: []string{"services"}, Response: []database.ServiceRequestAttachment{}},
+	"GET /services/:id/attachments":                      {Summary: "Photos and videos attached to a service request", Tags: []string{"services"}, Response: []database.ServiceRequestAttachment{}},
+	"POST /services/:id/feedback":                        {Summary: "Rate a completed service", Tags: []string{"services"}, Request: controllers.FeedbackRequest{}},
+	"GET /service-slots":                                 {Summary: "Bookable service slots of a franchise", Tags: []string{"services"}, Query: []string{"date", "franchise_id"}, Response: []controllers.ServiceSlot{}},
+	"GET /franchise/attendance":                          {Summary: "Agents' check-ins and on-site time for a day", Tags: []string{"franchises"}, Query: []string{"franchise_id", "date"}, Response: []controllers.AgentAttendance{}},
+	"GET /franchise/ledger":                              {Summary: "Commission owed to the franchise, with the ledger entries that accrued and paid it", Tags: []string{"franchises", "ledger"}, Query: []string{"franchise_id", "cursor", "limit", "from", "to"}},
+	"GET /franchise/agents/performance":                  {Summary: "Monthly agent leaderboard: completed jobs, average rating, completion time and SLA breaches", Tags: []string{"franchises"}, Query: []string{"franchise_id", "month"}},
+	"GET /franchise/agents/available":                    {Summary: "The franchise's agents and whether each is on shift and not on leave for a visit at a time", Tags: []string{"franchises"}, Query: []string{"franchise_id", "time"}, Response: []controllers.AgentAvailability{}},
+	"GET /franchise/agents/:id/availability":             {Summary: "An agent's weekly shifts and upcoming time off", Tags: []string{"franchises"}},
+	"PUT /franchise/agents/:id/shifts":                   {Summary: "Replace an agent's weekly working hours; an empty list puts them on the franchise's hours", Tags: []string{"franchises"}, Request: controllers.AgentShiftsRequest{}, Response: []database.AgentShift{}},
+	"POST /franchise/agents/:id/leaves":                  {Summary: "Give an agent days off or leave, listing the jobs already assigned to them then", Tags: []string{"franchises"}, Request: controllers.AgentLeaveRequest{}},
+	"DELETE /franchise/agents/:id/leaves/:leave_id":      {Summary: "Cancel an agent's time off", Tags: []string{"franchises"}},
+	"GET /franchise/mine":                                {Summary: "Franchises the current owner holds or staff member works for, for the franchise switcher", Tags: []string{"franchises"}},
+	"GET /franchise/orders":                              {Summary: "Orders in the franchise's service area (owners and staff with the orders feature)", Tags: []string{"franchises", "orders"}, Query: []string{"franchise_id", "cursor", "limit"}},
+	"GET /franchise/analytics":                           {Summary: "Franchise earnings, dues, SLA compliance, lead conversion and top customers", Tags: []string{"franchises"}, Query: []string{"franchise_id", "interval", "from", "to"}},
+	"GET /franchise/inventory":                           {Summary: "Franchise stock of purifiers, filters and spare parts", Tags: []string{"inventory"}, Query: []string{"franchise_id", "category", "low_stock", "search"}, Response: []database.InventoryItem{}},
+	"POST /franchise/inventory":                          {Summary: "Add an inventory item with its opening stock", Tags: []string{"inventory"}, Query: []string{"franchise_id"}, Request: controllers.CreateInventoryItemRequest{}, Response: database.InventoryItem{}},
+	"PUT /franchise/inventory/:id":                       {Summary: "Update an inventory item", Tags: []string{"inventory"}, Request: controllers.InventoryItemRequest{}, Response: database.InventoryItem{}},
+	"DELETE /franchise/inventory/:id":                    {Summary: "Delete an inventory item", Tags: []string{"inventory"}},
+	"GET /franchise/inventory/:id/movements":             {Summary: "Stock movement history of an item", Tags: []string{"inventory"}, Response: []database.StockMovement{}},
+	"POST /franchise/inventory/:id/movements":            {Summary: "Record stock received, returned or adjusted", Tags: []string{"inventory"}, Request: controllers.StockMovementRequest{}, Response: database.InventoryItem{}},
+	"GET /franchise/appointments":                        {Summary: "Upcoming reminded visits and whether customers confirmed or asked to reschedule", Tags: []string{"appointments"}, Query: []string{"franchise_id", "status", "kind", "page", "limit"}, Response: []database.AppointmentReminder{}},
+	"GET /franchise/leads":                               {Summary: "Demo requests routed to the caller's franchises, newest first", Tags: []string{"leads"}, Query: []string{"franchise_id", "status", "search", "unassigned", "page", "limit"}, Response: []database.Lead{}},
+	"PUT /franchise/leads/:id":                           {Summary: "Record follow-up on a lead; admins can route it to a franchise", Tags: []string{"leads"}, Request: controllers.UpdateLeadRequest{}, Response: database.Lead{}},
+	"POST /franchise/leads/:id/convert":                  {Summary: "Convert a qualified lead into a customer with a draft order, inviting them to sign in and optionally sending a payment link", Tags: []string{"leads"}, Request: controllers.ConvertLeadRequest{}},
+	"POST /agent/tasks/:id/respond":                      {Summary: "Accept an assigned job, or decline it with a reason to return it to the franchise queue", Tags: []string{"agent"}, Request: controllers.TaskResponseRequest{}},
+	"GET /agent/route":                                   {Summary: "Agent's tasks for a day in visiting order", Tags: []string{"agent"}, Query: []string{"date"}, Response: []controllers.RouteStop{}},
+	"GET /agent/availability":                            {Summary: "Agent's weekly shifts and upcoming time off", Tags: []string{"agent"}},
+	"PUT /agent/shifts":                                  {Summary: "Replace the agent's weekly working hours; an empty list means the franchise's hours", Tags: []string{"agent"}, Request: controllers.AgentShiftsRequest{}, Response: []database.AgentShift{}},
+	"POST /agent/leaves":                                 {Summary: "Declare days off or leave, listing the jobs already assigned then", Tags: []string{"agent"}, Request: controllers.AgentLeaveRequest{}},
+	"DELETE /agent/leaves/:leave_id":                     {Summary: "Cancel time off the agent declared", Tags: []string{"agent"}},
+	"POST /agent/orders/:id/installation-otp":            {Summary: "Send the customer a new installation code", Tags: []string{"agent"}},
+	"POST /agent/orders/:id/installation-report":         {Summary: "File the installation checklist with photos (multipart field \"photos\")", Tags: []string{"agent"}, Request: controllers.InstallationReportRequest{}, Response: database.InstallationReport{}},
+	"POST /agent/orders/:id/confirm-installation":        {Summary: "Mark a delivered order installed using the customer's code", Tags: []string{"agent"}, Request: controllers.ConfirmInstallationRequest{}},
+	"POST /agent/service-requests/:id/check-in":          {Summary: "Check in at the customer's location, starting the job", Tags: []string{"agent"}, Request: controllers.CheckInRequest{}},
+	"POST /agent/service-requests/:id/check-out":         {Summary: "Check out of a job site", Tags: []string{"agent"}, Request: controllers.CheckInRequest{}},
+	"POST /agent/service-requests/:id/report":            {Summary: "Complete a service visit with a report and optional photos (multipart field \"photos\")", Tags: []string{"agent"}, Request: controllers.ServiceReportRequest{}, Response: database.ServiceReport{}},
+	"POST /agent/service-requests/:id/attachments":       {Summary: "Attach photos or videos proving the work (multipart field \"files\")", Tags: []string{"agent"}, Response: []database.ServiceRequestAttachment{}},
+	"POST /agent/payments/cash":                          {Summary: "Record a month's rent collected in cash, pending franchise approval", Tags: []string{"agent", "payments"}, Request: controllers.CashPaymentRequest{}, Response: database.Payment{}},
+	"POST /agent/payments/cash/deposits":                 {Summary: "Record collected cash paid into the franchise's bank account", Tags: []string{"agent", "payments"}, Request: controllers.CashDepositRequest{}, Response: database.CashDeposit{}},
+	"GET /franchise/cash-payments":                       {Summary: "Cash payments collected by agents, by default those awaiting approval", Tags: []string{"franchises", "payments"}, Query: []string{"franchise_id", "status", "agent_id", "from", "to"}, Response: []database.Payment{}},
+	"POST /franchise/cash-payments/:id/approve":          {Summary: "Confirm an agent's cash was received and credit the subscription", Tags: []string{"franchises", "payments"}},
+	"POST /franchise/cash-payments/:id/reject":           {Summary: "Reject an agent's cash payment; the rent stays due", Tags: []string{"franchises", "payments"}, Request: controllers.RejectCashPaymentRequest{}},
+	"GET /franchise/cash-reconciliation":                 {Summary: "Cash each agent collected against what they deposited", Tags: []string{"franchises", "payments"}, Query: []string{"franchise_id", "from", "to"}, Response: []controllers.CashReconciliationRow{}},
+	"POST /agent/deposit-settlements/:id/pickup":         {Summary: "Confirm device pickup for a deposit refund", Tags: []string{"agent"}, Request: controllers.ConfirmPickupRequest{}, Response: database.DepositSettlement{}},
+	"GET /franchise/deposit-settlements":                 {Summary: "Deposit refunds of a franchise", Tags: []string{"franchises"}, Query: []string{"franchise_id", "status"}, Response: []database.DepositSettlement{}},
+	"POST /franchise/deposit-settlements/:id/deductions": {Summary: "Withhold part of a deposit for damages", Tags: []string{"franchises"}, Request: controllers.DepositDeductionRequest{}, Response: database.DepositSettlement{}},
+	"POST /franchise/deposit-settlements/:id/settle":     {Summary: "Refund the deposit via Razorpay or wallet credit", Tags: []string{"franchises"}, Request: controllers.SettleDepositRequest{}, Response: database.DepositSettlement{}},
+	"GET /franchise/settlements":                         {Summary: "Monthly revenue-share statements of a franchise", Tags: []string{"franchises"}, Query: []string{"franchise_id"}, Response: []database.Settlement{}},
+	"GET /franchise/settlements/:id":                     {Summary: "A settlement statement with its payments and payout attempts", Tags: []string{"franchises"}, Response: controllers.SettlementDetail{}},
+	"GET /franchise/bank-accounts":                       {Summary: "Bank accounts and UPI addresses for settlement payouts", Tags: []string{"franchises"}, Query: []string{"franchise_id"}, Response: []database.FranchiseBankAccount{}},
+	"POST /franchise/bank-accounts":                      {Summary: "Add the account future payouts go to", Tags: []string{"franchises"}, Query: []string{"franchise_id"}, Request: controllers.BankAccountRequest{}, Response: database.FranchiseBankAccount{}},
+	"DELETE /franchise/bank-accounts/:id":                {Summary: "Remove a payout account", Tags: []string{"franchises"}, Query: []string{"franchise_id"}},
+	"GET /franchise/staff":                               {Summary: "Staff accounts of the franchise, with the features they can be granted", Tags: []string{"franchises"}, Query: []string{"franchise_id"}},
+	"POST /franchise/staff":                              {Summary: "Add a dispatcher or accountant; new accounts are emailed a link to set a password", Tags: []string{"franchises"}, Query: []string{"franchise_id"}, Request: controllers.StaffRequest{}, Response: database.FranchiseMember{}},
+	"PUT /franchise/staff/:id":                           {Summary: "Change a staff member's role or features, or disable their access", Tags: []string{"franchises"}, Query: []string{"franchise_id"}, Request: controllers.UpdateStaffRequest{}, Response: database.FranchiseMember{}},
+	"DELETE /franchise/staff/:id":                        {Summary: "Take a staff member off the franchise", Tags: []string{"franchises"}, Query: []string{"franchise_id"}},
+
+	// Franchises
+	"POST /franchises":                                       {Summary: "Apply for a franchise", Tags: []string{"franchises"}, Request: controllers.FranchiseRequest{}},
+	"PUT /franchises/:id":                                    {Summary: "Update a franchise", Tags: []string{"franchises"}, Request: controllers.FranchiseRequest{}},
+	"GET /franchises/:id/working-hours":                      {Summary: "Weekly working hours of a franchise", Tags: []string{"franchises"}, Response: []database.FranchiseWorkingHours{}},
+	"PUT /franchises/:id/working-hours":                      {Summary: "Replace the weekly working hours of a franchise", Tags: []string{"franchises"}, Request: controllers.WorkingHoursRequest{}, Response: []database.FranchiseWorkingHours{}},
+	"GET /admin/franchises/:id/territories":                  {Summary: "Service territories used to assign orders to a franchise", Tags: []string{"admin"}, Response: []database.FranchiseTerritory{}},
+	"POST /admin/franchises/:id/territories":                 {Summary: "Add a radius or polygon service territory", Tags: []string{"admin"}, Request: controllers.TerritoryRequest{}, Response: database.FranchiseTerritory{}},
+	"DELETE /admin/franchises/:id/territories/:territory_id": {Summary: "Remove a service territory", Tags: []string{"admin"}},
+	"GET /admin/franchises/:id/locations":                    {Summary: "Locations and pincodes a franchise serves", Tags: []string{"admin"}, Response: []database.Location{}},
+	"POST /admin/franchises/:id/locations":                   {Summary: "Attach locations and pincodes to a franchise; 409 lists pincodes another franchise already serves unless allow_overlap is set", Tags: []string{"admin"}, Request: controllers.FranchiseLocationsRequest{}, Response: []database.Location{}},
+	"DELETE /admin/franchises/:id/locations":                 {Summary: "Detach locations and single-pincode locations from a franchise", Tags: []string{"admin"}, Request: controllers.FranchiseLocationsRequest{}, Response: []database.Location{}},
+	"GET /admin/settlements":                                 {Summary: "Franchise settlement statements", Tags: []string{"admin"}, Query: []string{"franchise_id", "status", "month"}, Response: []database.Settlement{}},
+	"POST /admin/settlements/generate":                       {Summary: "Compute or refresh pending statements for a completed month", Tags: []string{"admin"}, Request: controllers.GenerateSettlementsRequest{}},
+	"POST /admin/settlements/:id/mark-paid":                  {Summary: "Record a settlement paid outside RazorpayX", Tags: []string{"admin"}, Request: controllers.MarkSettlementPaidRequest{}, Response: database.Settlement{}},
+	"POST /admin/settlements/:id/approve":                    {Summary: "Approve a pending statement for payout", Tags: []string{"admin"}, Response: database.Settlement{}},
+	"POST /admin/payments/manual":                            {Summary: "Record a bank transfer against a pending payment or a subscription's rent; the reason and reference go to the audit log", Tags: []string{"admin", "payments"}, Request: controllers.ManualPaymentRequest{}, Response: database.Payment{}},
+	"POST /admin/payments/:id/payment-link":                  {Summary: "Create a Razorpay payment link for a pending order or rent payment and send it by SMS and email", Tags: []string{"admin", "payments"}, Request: controllers.PaymentLinkRequest{}, Response: database.PaymentLink{}},
+	"GET /admin/payments/:id/payment-links":                  {Summary: "Payment links created for a payment, with their status", Tags: []string{"admin", "payments"}, Response: []database.PaymentLink{}},
+	"POST /admin/payments/:id/credit-notes":                  {Summary: "Issue a credit note against a paid invoice; it comes off the subscription's next monthly bill", Tags: []string{"admin", "payments"}, Request: controllers.CreditNoteRequest{}, Response: database.CreditNote{}},
+	"GET /admin/credit-notes":                                {Summary: "Credit notes, newest first", Tags: []string{"admin", "payments"}, Query: []string{"customer_id", "payment_id", "status", "from", "to"}, Response: []database.CreditNote{}},
+	"POST /admin/credit-notes/:id/void":                      {Summary: "Void a credit note none of which has been used", Tags: []string{"admin", "payments"}, Request: controllers.VoidCreditNoteRequest{}, Response: database.CreditNote{}},
+	"GET /admin/customers/:id/risk":                          {Summary: "A customer's risk score from payment failures, chargebacks and device damage, their blacklist matches and any unused override", Tags: []string{"admin", "risk"}, Response: risk.Assessment{}},
+	"POST /admin/customers/:id/blacklist":                    {Summary: "Blacklist a customer's phone and email so they cannot place orders", Tags: []string{"admin", "risk"}, Request: controllers.BlacklistCustomerRequest{}, Response: []database.BlacklistEntry{}},
+	"POST /admin/customers/:id/risk-override":                {Summary: "Let a blacklisted customer place one order before the override expires", Tags: []string{"admin", "risk"}, Request: controllers.RiskOverrideRequest{}, Response: database.RiskOverride{}},
+	"GET /admin/risk/flagged":                                {Summary: "Customers flagged for payment failures, chargebacks or device damage, riskiest first", Tags: []string{"admin", "risk"}, Response: []controllers.FlaggedCustomer{}},
+	"GET /admin/blacklist":                                   {Summary: "Blacklisted phones and emails", Tags: []string{"admin", "risk"}, Query: []string{"kind"}, Response: []database.BlacklistEntry{}},
+	"POST /admin/blacklist":                                  {Summary: "Blacklist a phone number or email from placing orders", Tags: []string{"admin", "risk"}, Request: controllers.BlacklistRequest{}, Response: database.BlacklistEntry{}},
+	"DELETE /admin/blacklist/:id":                            {Summary: "Remove a phone or email from the blacklist", Tags: []string{"admin", "risk"}},
+	"GET /admin/disputes":                                    {Summary: "Payment disputes and chargebacks, newest first; status=open lists unresolved ones", Tags: []string{"admin", "payments"}, Query: []string{"status", "payment_id", "customer_id", "from", "to"}, Response: []database.Dispute{}},
+	"GET /admin/disputes/:id":                                {Summary: "A dispute with its evidence", Tags: []string{"admin", "payments"}, Response: database.Dispute{}},
+	"POST /admin/disputes/:id/evidence":                      {Summary: "Upload PDF, JPEG or PNG evidence in multipart \"files\" under a Razorpay evidence \"category\"", Tags: []string{"admin", "payments"}, Response: []database.DisputeEvidence{}},
+	"POST /admin/disputes/:id/contest":                       {Summary: "Submit the dispute's evidence to Razorpay", Tags: []string{"admin", "payments"}, Request: controllers.ContestDisputeRequest{}, Response: database.Dispute{}},
+	"POST /admin/disputes/:id/accept":                        {Summary: "Concede a dispute; Razorpay keeps the disputed amount", Tags: []string{"admin", "payments"}, Response: database.Dispute{}},
+	"GET /admin/ledger/accounts":                             {Summary: "Trial balance: ledger accounts with their balances and whether debits equal credits (default tenant's admins only)", Tags: []string{"admin", "ledger"}, Query: []string{"owner_type"}, Response: []ledger.AccountBalance{}},
+	"GET /admin/ledger/customers/:id":                        {Summary: "A customer's ledger balances and entries, newest first (default tenant's admins only)", Tags: []string{"admin", "ledger"}, Query: []string{"cursor", "limit", "from", "to"}},
+	"GET /admin/ledger/franchises/:id":                       {Summary: "A franchise's ledger balances and entries, newest first (default tenant's admins only)", Tags: []string{"admin", "ledger"}, Query: []string{"cursor", "limit", "from", "to"}},
+	"POST /admin/ledger/backfill":                            {Summary: "Post ledger journals for money that moved before the ledger existed; safe to rerun (default tenant's admins only)", Tags: []string{"admin", "ledger"}, Response: ledger.BackfillResult{}},
+	"POST /admin/settlements/:id/payout":                     {Summary: "Pay a settlement to the franchise's bank account via RazorpayX", Tags: []string{"admin"}, Response: database.Settlement{}},
+
+	// Direct uploads to S3
+	"POST /uploads/presign":     {Summary: "Presigned S3 PUT URL for a product image or service request photo or video, limited to the declared type and size", Tags: []string{"uploads"}, Request: controllers.PresignUploadRequest{}, Response: controllers.PresignUploadResponse{}},
+	"POST /uploads/:id/confirm": {Summary: "Check a presigned upload arrived and record it as a product image or attachment", Tags: []string{"uploads"}},
+
+	// Payments
+	"POST /payments/generate-order":   {Summary: "Create an order and its Razorpay payment order", Tags: []string{"payments"}, Request: controllers.RazorpayOrderRequest{}},
+	"POST /payments/generate-monthly": {Summary: "Create a Razorpay order for a monthly rent payment", Tags: []string{"payments"}, Request: controllers.MonthlyPaymentRequest{}},
+	"POST /payments/verify":           {Summary: "Verify a Razorpay payment signature", Tags: []string{"payments"}, Request: controllers.PaymentVerificationRequest{}},
+	"POST /payments/mock-checkout":    {Summary: "Pay a gateway order and get the fields to verify it; only with PAYMENT_PROVIDER=mock", Tags: []string{"payments"}, Request: controllers.MockCheckoutRequest{}},
+	"POST /payments/mandates":         {Summary: "Set up an auto-debit mandate for monthly rent", Tags: []string{"payments"}, Request: controllers.MandateRequest{}, Response: database.Mandate{}},
+	"GET /payments/mandates":          {Summary: "Current customer's mandates", Tags: []string{"payments"}, Response: []database.Mandate{}},
+	"GET /payments/credit-notes":      {Summary: "Current customer's credit notes and the credit still to come off their bills", Tags: []string{"payments"}},
+	"GET /payments/ledger":            {Summary: "Current customer's ledger balances (late fees owed, deposit held, wallet, credit notes) and entries", Tags: []string{"payments", "ledger"}, Query: []string{"cursor", "limit", "from", "to"}},
+	"GET /payments/:id/invoice":       {Summary: "GST invoice for a payment with CGST/SGST/IGST breakdown", Tags: []string{"payments"}, Response: controllers.Invoice{}},
+	"GET /payments/:id/invoice/pdf":   {Summary: "Invoice PDF, rendered on the job queue (202 with Retry-After until ready)", Tags: []string{"payments"}},
+	"POST /payments/webhook":          {Summary: "Razorpay webhook (X-Razorpay-Signature)", Tags: []string{"payments"}, Public: true},
+
+	// Administration
+	"GET /admin/dashboard":                  {Summary: "Headline counts and revenue; answers 304 to a matching If-None-Match", Tags: []string{"admin"}, Query: []string{"from", "to"}},
+	"GET /admin/analytics/revenue":          {Summary: "Revenue per period", Tags: []string{"analytics"}, Query: []string{"interval", "from", "to"}},
+	"GET /admin/analytics/subscriptions":    {Summary: "New vs churned subscriptions per period", Tags: []string{"analytics"}, Query: []string{"interval", "from", "to"}},
+	"GET /admin/analytics/orders":           {Summary: "Placed vs paid orders per period", Tags: []string{"analytics"}, Query: []string{"interval", "from", "to"}},
+	"GET /admin/analytics/service-requests": {Summary: "Service request volumes per period", Tags: []string{"analytics"}, Query: []string{"interval", "from", "to"}},
+	"GET /admin/analytics/leads":            {Summary: "Leads received vs converted per period and conversion rate per franchise", Tags: []string{"analytics"}, Query: []string{"interval", "from", "to"}},
+	"GET /admin/export/orders":              {Summary: "Download orders as CSV or XLSX", Tags: []string{"exports"}, Query: []string{"from", "to", "status", "format"}},
+	"GET /admin/export/payments":            {Summary: "Download payments as CSV or XLSX", Tags: []string{"exports"}, Query: []string{"from", "to", "status", "format"}},
+	"GET /admin/export/service-requests":    {Summary: "Download service requests as CSV or XLSX", Tags: []string{"exports"}, Query: []string{"from", "to", "status", "format"}},
+	"GET /admin/search":                     {Summary: "Find customers, orders, subscriptions and payments in one call", Tags: []string{"admin"}, Query: []string{"q", "limit"}, Response: controllers.SearchResults{}},
+	"GET /admin/search/customers":           {Summary: "Full-text search of customers by name, email, phone or address", Tags: []string{"admin"}, Query: []string{"q", "page", "limit"}, Response: []controllers.CustomerSearchHit{}},
+	"GET /admin/search/service-requests":    {Summary: "Full-text search of service requests by description, notes and feedback", Tags: []string{"admin"}, Query: []string{"q", "status", "page", "limit"}, Response: []controllers.ServiceRequestTextHit{}},
+	"GET /admin/audit-logs":                 {Summary: "Audit log of privileged writes", Tags: []string{"admin"}, Query: []string{"actor_id", "action", "entity_type", "entity_id", "from", "to", "page", "limit"}},
+	"GET /admin/roles":                      {Summary: "Roles and their permissions", Tags: []string{"admin"}, Response: []database.Role{}},
+	"POST /admin/roles":                     {Summary: "Create a custom role (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.RoleRequest{}, Response: database.Role{}},
+	"PUT /admin/roles/:id":                  {Summary: "Update a role's permissions (default tenant's admins only)", Tags: []string{"admin"}, Request: controllers.RoleRequest{}, Response: database.Role{}},
+}
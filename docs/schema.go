@@ -0,0 +1,116 @@
+package docs
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder converts Go types into OpenAPI schemas, collecting named structs
+// under components/schemas
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{components: map[string]interface{}{}}
+}
+
+// schemaFor returns the schema of v's type, or nil for a nil value
+func (b *schemaBuilder) schemaFor(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType || t.Name() == "DeletedAt" {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := t.Name()
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = map[string]interface{}{} // placeholder stops recursion
+			b.components[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema describes a struct from its json and binding tags
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	b.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		jsonTag := field.Tag.Get("json")
+		name := strings.Split(jsonTag, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		// Embedded structs such as gorm.Model are flattened
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(embedded, properties, required)
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			if rule == "required" {
+				*required = append(*required, name)
+			}
+		}
+	}
+}
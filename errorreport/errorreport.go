@@ -0,0 +1,39 @@
+// Package errorreport sends panics and server errors to Sentry.
+package errorreport
+
+import (
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"aquahome/config"
+)
+
+// flushTimeout bounds how long shutdown waits for queued reports
+const flushTimeout = 2 * time.Second
+
+// Init sets up the Sentry client. Reports are only sent when a DSN is
+// configured; until then capturing is a no-op. The returned function sends
+// queued reports and should be called on shutdown.
+func Init() (func(), error) {
+	if config.AppConfig.SentryDSN == "" {
+		log.Println("ℹ️ Error reporting disabled (SENTRY_DSN not set)")
+		return func() {}, nil
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              config.AppConfig.SentryDSN,
+		Environment:      config.AppConfig.Environment,
+		Release:          config.AppConfig.SentryRelease,
+		ServerName:       config.AppConfig.ServiceName,
+		SampleRate:       config.AppConfig.SentrySampleRate,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("✅ Error reporting enabled")
+	return func() { sentry.Flush(flushTimeout) }, nil
+}
@@ -0,0 +1,103 @@
+// Package events is the in-process domain event bus. Code that changes
+// something publishes an event in its transaction; subscribers create the
+// in-app notifications, queue webhooks and send emails, so controllers no
+// longer build every side effect inline.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// Domain events
+const (
+	OrderPlaced             = "order.placed"
+	OrderStatusChanged      = "order.status_changed"
+	OrderCancelled          = "order.cancelled"
+	PaymentReceived         = "payment.received"     // a customer paid online
+	PaymentAutoDebited      = "payment.auto_debited" // rent was charged to a mandate
+	PaymentLinkSent         = "payment.link_sent"    // a payment link was created for a customer
+	DisputeUpdated          = "payment.disputed"     // a customer's bank opened or moved a dispute
+	ServiceRequestCreated   = "service_request.created"
+	ServiceReportSubmitted  = "service_request.report_submitted" // an agent completed a visit with a report
+	ServiceRequestCompleted = "service_request.completed"        // completed without a report, e.g. by an admin
+	LeadReceived            = "lead.received"                    // a prospect asked for a demo
+	LeadConverted           = "lead.converted"                   // a lead became a customer with a draft order
+	AppointmentReminder     = "appointment.reminder"             // a service visit or installation is coming up
+	RescheduleRequested     = "appointment.reschedule_requested" // a customer asked to move a visit
+)
+
+// Event is something that happened in the domain. EntityType and EntityID
+// name what notifications link to; Vars fill the notification templates;
+// Data is sent to webhook endpoints. Template picks the customer's
+// notification template for events whose text depends on the change, such
+// as the new status of an order.
+type Event struct {
+	Name        string        `json:"name"`
+	EntityType  string        `json:"entity_type"`
+	EntityID    uint          `json:"entity_id"`
+	CustomerID  uint          `json:"customer_id"`
+	FranchiseID uint          `json:"franchise_id"`
+	Template    string        `json:"template,omitempty"`
+	Vars        database.Vars `json:"vars"`
+	Data        interface{}   `json:"-"`
+}
+
+// Handler reacts to an event inside the transaction that published it; an
+// error rolls the change back
+type Handler func(tx *gorm.DB, e Event) error
+
+// AfterCommitHandler reacts to an event once its transaction has committed,
+// for side effects outside the database such as email
+type AfterCommitHandler func(e Event) error
+
+// channelHandler is an after-commit handler and the channel it sends on.
+// Channels that succeeded are not sent again when an event is retried.
+type channelHandler struct {
+	channel string
+	handle  AfterCommitHandler
+}
+
+// Subscriptions are made at startup, before anything is published
+var (
+	handlers            = map[string][]Handler{}
+	afterCommitHandlers = map[string][]channelHandler{}
+)
+
+// Subscribe runs h in the publishing transaction whenever the event is published
+func Subscribe(name string, h Handler) {
+	handlers[name] = append(handlers[name], h)
+}
+
+// SubscribeAfterCommit runs h after the publishing transaction commits,
+// through the outbox. channel names what h sends, e.g. "email".
+func SubscribeAfterCommit(name, channel string, h AfterCommitHandler) {
+	afterCommitHandlers[name] = append(afterCommitHandlers[name], channelHandler{channel, h})
+}
+
+// Publish runs the event's handlers in tx and writes it to the outbox for
+// its after-commit handlers. Call it in the transaction that made the change.
+func Publish(tx *gorm.DB, e Event) error {
+	for _, h := range handlers[e.Name] {
+		if err := h(tx, e); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	if len(afterCommitHandlers[e.Name]) == 0 {
+		return nil
+	}
+
+	// Variables are stored as they will be shown, since JSON loses their types
+	e.Vars = e.Vars.Formatted()
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return tx.Create(&database.OutboxEvent{Name: e.Name, Payload: string(payload), NextAttemptAt: &now}).Error
+}
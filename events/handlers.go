@@ -0,0 +1,247 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// Who a notification goes to
+const (
+	recipientCustomer       = "customer"
+	recipientFranchiseOwner = "franchise_owner"
+	recipientAdmins         = "admins" // every admin
+)
+
+// notificationRule is an in-app notification created for an event
+type notificationRule struct {
+	Recipient string
+	Template  string // notification template event
+	Type      string
+}
+
+// notificationRules are the in-app notifications each event creates. A
+// rule without a template uses the event's own Template.
+var notificationRules = map[string][]notificationRule{
+	OrderPlaced:        {{recipientCustomer, "order.placed", "order"}},
+	OrderStatusChanged: {{recipientCustomer, "", "order"}},
+	OrderCancelled: {
+		{recipientCustomer, "", "order"},
+		{recipientFranchiseOwner, "order.cancelled_franchise", "order"},
+	},
+	PaymentReceived:    {{recipientCustomer, "payment.success", "payment"}},
+	PaymentAutoDebited: {{recipientCustomer, "payment.auto_debited", "payment"}},
+	PaymentLinkSent:    {{recipientCustomer, "payment.link", "payment"}},
+	DisputeUpdated:     {{recipientAdmins, "", "dispute"}},
+	ServiceRequestCreated: {
+		{recipientCustomer, "service_request.created", "service_request"},
+		{recipientFranchiseOwner, "service_request.created_franchise", "service_request"},
+	},
+	ServiceReportSubmitted: {
+		{recipientCustomer, "service_request.completed", "service_request"},
+		{recipientFranchiseOwner, "service_request.report_submitted", "service_request"},
+	},
+	LeadReceived:        {{recipientFranchiseOwner, "lead.received", "lead"}},
+	LeadConverted:       {{recipientCustomer, "lead.converted", "order"}},
+	AppointmentReminder: {{recipientCustomer, "appointment.reminder", "appointment"}},
+	RescheduleRequested: {{recipientFranchiseOwner, "appointment.reschedule_requested", "appointment"}},
+}
+
+// webhookEvents maps domain events to the webhook events integrators subscribe to
+var webhookEvents = map[string]string{
+	OrderPlaced:             database.WebhookEventOrderCreated,
+	PaymentReceived:         database.WebhookEventPaymentSucceeded,
+	PaymentAutoDebited:      database.WebhookEventPaymentSucceeded,
+	ServiceReportSubmitted:  database.WebhookEventServiceRequestCompleted,
+	ServiceRequestCompleted: database.WebhookEventServiceRequestCompleted,
+	LeadConverted:           database.WebhookEventOrderCreated,
+}
+
+// Channels customers are messaged on outside the app
+const (
+	channelEmail = database.NotificationChannelEmail
+	channelSMS   = database.NotificationChannelSMS
+	channelPush  = database.NotificationChannelPush
+)
+
+// customerMessages are the events customers are also messaged about outside
+// the app: the notification template used for the text (empty for the
+// event's own Template) and the channels it goes out on
+var customerMessages = map[string]struct {
+	Template string
+	Channels []string
+}{
+	OrderPlaced:            {"order.placed", []string{channelEmail, channelSMS, channelPush}},
+	OrderStatusChanged:     {"", []string{channelEmail, channelSMS, channelPush}},
+	OrderCancelled:         {"", []string{channelEmail, channelSMS, channelPush}},
+	PaymentReceived:        {"payment.success", []string{channelEmail, channelSMS, channelPush}},
+	PaymentAutoDebited:     {"payment.auto_debited", []string{channelEmail, channelSMS, channelPush}},
+	PaymentLinkSent:        {"payment.link", []string{channelEmail, channelSMS}},
+	ServiceReportSubmitted: {"service_request.completed", []string{channelEmail, channelPush}},
+	LeadConverted:          {"lead.converted", []string{channelEmail, channelSMS}},
+	AppointmentReminder:    {"appointment.reminder", []string{channelEmail, channelSMS, channelPush}},
+}
+
+// customerDeliveries address a rendered message to a customer on one channel
+var customerDeliveries = map[string]func(customer database.User, message database.Notification, e Event) database.NotificationDelivery{
+	channelEmail: emailCustomer,
+	channelSMS:   smsCustomer,
+	channelPush:  pushCustomer,
+}
+
+func init() {
+	for name := range notificationRules {
+		Subscribe(name, createNotifications)
+	}
+	for name := range webhookEvents {
+		Subscribe(name, queueWebhooks)
+	}
+	for name, message := range customerMessages {
+		for _, channel := range message.Channels {
+			SubscribeAfterCommit(name, channel, messageCustomer(channel))
+		}
+	}
+}
+
+// template returns the notification template to use: the rule's, or the
+// event's own when the rule has none
+func (e Event) template(template string) string {
+	if template == "" {
+		return e.Template
+	}
+	return template
+}
+
+// createNotifications creates the event's in-app notifications
+func createNotifications(tx *gorm.DB, e Event) error {
+	var notifications []database.Notification
+	for _, rule := range notificationRules[e.Name] {
+		recipients, err := e.recipients(tx, rule.Recipient)
+		if err != nil {
+			return err
+		}
+		for _, userID := range recipients {
+			relatedID := e.EntityID
+			notifications = append(notifications, database.Notification{
+				UserID:      userID,
+				Type:        rule.Type,
+				RelatedID:   &relatedID,
+				RelatedType: e.EntityType,
+			}.Rendered(tx, e.template(rule.Template), e.Vars))
+		}
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return tx.Create(&notifications).Error
+}
+
+// recipients returns the users a rule's notification goes to
+func (e Event) recipients(tx *gorm.DB, recipient string) ([]uint, error) {
+	switch recipient {
+	case recipientFranchiseOwner:
+		ownerID, err := franchiseOwner(tx, e.FranchiseID)
+		if err != nil || ownerID == 0 {
+			return nil, err
+		}
+		return []uint{ownerID}, nil
+	case recipientAdmins:
+		var admins []uint
+		err := tx.Session(&gorm.Session{NewDB: true}).Model(&database.User{}).
+			Where("role = ?", database.RoleAdmin).Pluck("id", &admins).Error
+		return admins, err
+	default:
+		if e.CustomerID == 0 {
+			return nil, nil
+		}
+		return []uint{e.CustomerID}, nil
+	}
+}
+
+// franchiseOwner returns the owner of a franchise, or 0 when it has none
+func franchiseOwner(tx *gorm.DB, franchiseID uint) (uint, error) {
+	if franchiseID == 0 {
+		return 0, nil
+	}
+	var franchise database.Franchise
+	err := tx.Session(&gorm.Session{NewDB: true}).Select("id, owner_id").First(&franchise, franchiseID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return franchise.OwnerID, err
+}
+
+// queueWebhooks queues the event for the webhook endpoints subscribed to it
+func queueWebhooks(tx *gorm.DB, e Event) error {
+	if e.Data == nil {
+		return nil
+	}
+	return database.QueueWebhookEvent(tx, webhookEvents[e.Name], e.Data)
+}
+
+// messageCustomer returns the after-commit handler that queues the event's
+// notification text for the customer on channel. Sending it, and retrying a
+// failed send, is up to the notification delivery.
+func messageCustomer(channel string) AfterCommitHandler {
+	return func(e Event) error {
+		if e.CustomerID == 0 {
+			return nil
+		}
+		var customer database.User
+		if err := database.DB.Select("id, email, phone").First(&customer, e.CustomerID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		template := e.template(customerMessages[e.Name].Template)
+		message := database.Notification{UserID: customer.ID}.Rendered(database.DB, template, e.Vars)
+		delivery := customerDeliveries[channel](customer, message, e)
+		delivery.UserID = customer.ID
+		delivery.Event = template
+		if err := QueueNotificationDelivery(delivery); err != nil {
+			return fmt.Errorf("%s to user %d: %w", channel, customer.ID, err)
+		}
+		return nil
+	}
+}
+
+// emailCustomer emails the message to the customer
+func emailCustomer(customer database.User, message database.Notification, _ Event) database.NotificationDelivery {
+	return database.NotificationDelivery{
+		Channel:   channelEmail,
+		Recipient: customer.Email,
+		Title:     message.Title,
+		Message:   message.Message,
+	}
+}
+
+// smsCustomer texts the message to the customer's phone
+func smsCustomer(customer database.User, message database.Notification, _ Event) database.NotificationDelivery {
+	return database.NotificationDelivery{
+		Channel:   channelSMS,
+		Recipient: utils.NormalizePhone(customer.Phone),
+		Message:   "AquaHome: " + message.Message,
+	}
+}
+
+// pushCustomer pushes the message to the customer's registered devices
+func pushCustomer(customer database.User, message database.Notification, e Event) database.NotificationDelivery {
+	data, _ := json.Marshal(map[string]string{
+		"event":       e.Name,
+		"entity_type": e.EntityType,
+		"entity_id":   fmt.Sprint(e.EntityID),
+	})
+	return database.NotificationDelivery{
+		Channel: channelPush,
+		Title:   message.Title,
+		Message: message.Message,
+		Data:    string(data),
+	}
+}
@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"aquahome/database"
+	"aquahome/queue"
+	"aquahome/utils"
+)
+
+// TaskNotificationDelivery sends one notification delivery on the job queue
+const TaskNotificationDelivery = "notification.deliver"
+
+// notificationRetryDelays is how long to wait after each failed send; a
+// delivery is dead-lettered once they run out
+var notificationRetryDelays = []time.Duration{
+	30 * time.Second, 2 * time.Minute, 10 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour,
+}
+
+// notificationLease is how long a worker holds a delivery while sending it
+const notificationLease = 2 * time.Minute
+
+// notificationBatchSize is how many due deliveries one run sends
+const notificationBatchSize = 100
+
+// notificationDeliveryPayload names the delivery a task sends
+type notificationDeliveryPayload struct {
+	ID uint `json:"id"`
+}
+
+func init() {
+	// Failed sends are retried on the delivery's own schedule; the queue only
+	// retries errors reaching the database
+	queue.Register(TaskNotificationDelivery, func(_ context.Context, payload json.RawMessage) error {
+		var p notificationDeliveryPayload
+		if err := queue.Decode(payload, &p); err != nil {
+			return err
+		}
+		return DeliverNotification(p.ID)
+	}, queue.Options{MaxRetry: 3, Timeout: time.Minute})
+}
+
+// QueueNotificationDelivery records a message to send to a user and hands it
+// to the job queue. Email and SMS without an address, and push to a user
+// without devices, are skipped.
+func QueueNotificationDelivery(delivery database.NotificationDelivery) error {
+	switch delivery.Channel {
+	case database.NotificationChannelEmail, database.NotificationChannelSMS:
+		if delivery.Recipient == "" {
+			return nil
+		}
+	case database.NotificationChannelPush:
+		var devices int64
+		if err := database.DB.Model(&database.PushDevice{}).Where("user_id = ?", delivery.UserID).
+			Count(&devices).Error; err != nil {
+			return err
+		}
+		if devices == 0 {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown notification channel %q", delivery.Channel)
+	}
+
+	now := time.Now()
+	delivery.Status = database.NotificationDeliveryPending
+	delivery.NextAttemptAt = &now
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		return err
+	}
+	dispatchNotificationDelivery(delivery.ID)
+	return nil
+}
+
+// DeliverNotifications hands notification deliveries that are due, ones
+// never picked up and failed ones whose retry time has come, to the job queue
+func DeliverNotifications() error {
+	var ids []uint
+	if err := database.DB.Model(&database.NotificationDelivery{}).
+		Where("status = ? AND next_attempt_at <= ?", database.NotificationDeliveryPending, time.Now()).
+		Order("next_attempt_at").Limit(notificationBatchSize).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		dispatchNotificationDelivery(id)
+	}
+	return nil
+}
+
+// dispatchNotificationDelivery queues a delivery, sending it here when the
+// queue can't be reached
+func dispatchNotificationDelivery(id uint) {
+	_, err := queue.EnqueueUnique(TaskNotificationDelivery, strconv.FormatUint(uint64(id), 10), notificationDeliveryPayload{ID: id})
+	if err == nil {
+		return
+	}
+	if err := DeliverNotification(id); err != nil {
+		log.Printf("Notification delivery %d failed: %v", id, err)
+	}
+}
+
+// DeliverNotification makes one attempt at sending a pending delivery. A
+// delivery another worker is sending, or one not yet due, is left alone.
+func DeliverNotification(deliveryID uint) error {
+	now := time.Now()
+	claim := database.DB.Model(&database.NotificationDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", deliveryID, database.NotificationDeliveryPending, now).
+		Update("next_attempt_at", now.Add(notificationLease))
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+
+	var delivery database.NotificationDelivery
+	if err := database.DB.First(&delivery, deliveryID).Error; err != nil {
+		return err
+	}
+
+	sendErr := sendNotification(delivery)
+
+	delivery.Attempts++
+	delivery.LastError = ""
+	switch {
+	case sendErr == nil:
+		delivery.Status = database.NotificationDeliverySent
+		delivery.SentAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts > len(notificationRetryDelays):
+		log.Printf("❌ Gave up on %s notification %d to user %d: %v", delivery.Channel, delivery.ID, delivery.UserID, sendErr)
+		delivery.Status = database.NotificationDeliveryFailed
+		delivery.FailedAt = &now
+		delivery.LastError = sendErr.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		delivery.LastError = sendErr.Error()
+		next := now.Add(notificationRetryDelays[delivery.Attempts-1])
+		delivery.NextAttemptAt = &next
+	}
+	return database.DB.Save(&delivery).Error
+}
+
+// RetryNotificationDelivery sends a failed delivery again now, with a fresh
+// set of attempts
+func RetryNotificationDelivery(id uint) error {
+	if err := database.DB.Model(&database.NotificationDelivery{}).
+		Where("id = ? AND status = ?", id, database.NotificationDeliveryFailed).
+		Updates(map[string]interface{}{
+			"status":          database.NotificationDeliveryPending,
+			"attempts":        0,
+			"failed_at":       nil,
+			"next_attempt_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+	return DeliverNotification(id)
+}
+
+// sendNotification sends a delivery on its channel. Push goes to the
+// devices the user has registered by the time it is sent.
+func sendNotification(delivery database.NotificationDelivery) error {
+	switch delivery.Channel {
+	case database.NotificationChannelEmail:
+		return utils.SendEmail(delivery.Recipient, delivery.Title, delivery.Message)
+	case database.NotificationChannelSMS:
+		return utils.SendSMS(delivery.Recipient, delivery.Message)
+	case database.NotificationChannelPush:
+		var tokens []string
+		if err := database.DB.Model(&database.PushDevice{}).Where("user_id = ?", delivery.UserID).
+			Pluck("token", &tokens).Error; err != nil {
+			return err
+		}
+		var data map[string]string
+		if delivery.Data != "" {
+			if err := json.Unmarshal([]byte(delivery.Data), &data); err != nil {
+				return fmt.Errorf("invalid push data: %w", err)
+			}
+		}
+		return utils.SendPush(tokens, delivery.Title, delivery.Message, data)
+	}
+	return fmt.Errorf("unknown notification channel %q", delivery.Channel)
+}
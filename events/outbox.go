@@ -0,0 +1,113 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"aquahome/database"
+)
+
+// outboxMaxAttempts is how often a failing outbox event is tried before it
+// is set aside as failed
+const outboxMaxAttempts = 8
+
+// outboxBatchSize is how many outbox events one run relays
+const outboxBatchSize = 100
+
+// outboxLease is how long a relayer holds an event while sending it
+const outboxLease = 2 * time.Minute
+
+// RelayOutbox sends the after-commit side effects of outbox events that are
+// due: new events and failed ones whose retry time has come
+func RelayOutbox() error {
+	var ids []uint
+	if err := database.DB.Model(&database.OutboxEvent{}).
+		Where("processed_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", time.Now()).
+		Order("id").Limit(outboxBatchSize).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := relayOutboxEvent(id); err != nil {
+			log.Printf("Outbox event %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// relayOutboxEvent runs the after-commit handlers of one event, skipping
+// channels that already succeeded. An event another relayer holds is left alone.
+func relayOutboxEvent(id uint) error {
+	now := time.Now()
+	claim := database.DB.Model(&database.OutboxEvent{}).
+		Where("id = ? AND processed_at IS NULL AND failed_at IS NULL", id).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Update("locked_until", now.Add(outboxLease))
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+
+	var row database.OutboxEvent
+	if err := database.DB.First(&row, id).Error; err != nil {
+		return err
+	}
+
+	var e Event
+	relayErr := json.Unmarshal([]byte(row.Payload), &e)
+	if relayErr == nil {
+		done := map[string]bool{}
+		for _, channel := range row.DoneChannels {
+			done[channel] = true
+		}
+		for _, h := range afterCommitHandlers[row.Name] {
+			if done[h.channel] {
+				continue
+			}
+			if err := h.handle(e); err != nil {
+				relayErr = errors.Join(relayErr, fmt.Errorf("%s: %w", h.channel, err))
+				continue
+			}
+			row.DoneChannels = append(row.DoneChannels, h.channel)
+			done[h.channel] = true
+		}
+	}
+
+	row.Attempts++
+	row.LockedUntil = nil
+	switch {
+	case relayErr == nil:
+		row.ProcessedAt = &now
+		row.NextAttemptAt = nil
+		row.LastError = ""
+	case row.Attempts >= outboxMaxAttempts:
+		row.FailedAt = &now
+		row.NextAttemptAt = nil
+		row.LastError = relayErr.Error()
+	default:
+		// Back off 1, 4, 9, 16... minutes between attempts
+		next := now.Add(time.Duration(row.Attempts*row.Attempts) * time.Minute)
+		row.NextAttemptAt = &next
+		row.LastError = relayErr.Error()
+	}
+	if err := database.DB.Save(&row).Error; err != nil {
+		return err
+	}
+	return relayErr
+}
+
+// RetryOutboxEvent relays a failed event again now, with a fresh set of
+// attempts. Channels that already succeeded are not sent again.
+func RetryOutboxEvent(id uint) error {
+	if err := database.DB.Model(&database.OutboxEvent{}).Where("id = ? AND failed_at IS NOT NULL", id).
+		Updates(map[string]interface{}{
+			"failed_at":       nil,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"locked_until":    nil,
+		}).Error; err != nil {
+		return err
+	}
+	return relayOutboxEvent(id)
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"aquahome/alerting"
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// alertLookback is how far back SLA breaches and failing webhook deliveries
+// are counted
+const alertLookback = 24 * time.Hour
+
+// CheckAlerts raises alerts for operators when payment verifications fail
+// in a burst, a franchise keeps breaching its SLA or a webhook endpoint
+// keeps failing. Each check runs even when an earlier one fails.
+func CheckAlerts() error {
+	var failed error
+	for _, check := range []struct {
+		name string
+		run  func() error
+	}{
+		{"payment verification", checkPaymentVerificationFailures},
+		{"SLA breach", checkSLABreaches},
+		{"webhook failure", checkWebhookFailures},
+	} {
+		if err := check.run(); err != nil {
+			log.Printf("%s alert check failed: %v", check.name, err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// checkPaymentVerificationFailures alerts when more payment signatures than
+// the threshold failed to verify within the window, e.g. after a key
+// rotation or a broken checkout release
+func checkPaymentVerificationFailures() error {
+	cfg := config.AppConfig
+	window := time.Duration(cfg.AlertPaymentFailureWindowMinutes) * time.Minute
+	var count int64
+	if err := database.DB.Model(&database.PaymentVerificationFailure{}).
+		Where("created_at > ?", time.Now().Add(-window)).Count(&count).Error; err != nil {
+		return err
+	}
+	if count < int64(cfg.AlertPaymentFailureThreshold) {
+		return nil
+	}
+	_, err := alerting.Raise(database.AlertKindPaymentVerification, "all", fmt.Sprintf(
+		"🚨 %d payment verifications failed in the last %d minutes. Check the Razorpay keys and the checkout flow.",
+		count, cfg.AlertPaymentFailureWindowMinutes))
+	return err
+}
+
+// checkSLABreaches alerts about each franchise with at least the threshold
+// of service requests breaching their SLA in the last day
+func checkSLABreaches() error {
+	var franchises []struct {
+		FranchiseID uint
+		Name        string
+		Breaches    int64
+	}
+	if err := database.DB.Model(&database.ServiceRequest{}).
+		Select("service_requests.franchise_id, franchises.name, COUNT(*) AS breaches").
+		Joins("JOIN franchises ON franchises.id = service_requests.franchise_id").
+		Where("service_requests.sla_breached_at > ?", time.Now().Add(-alertLookback)).
+		Group("service_requests.franchise_id, franchises.name").
+		Having("COUNT(*) >= ?", config.AppConfig.AlertSLABreachThreshold).
+		Scan(&franchises).Error; err != nil {
+		return err
+	}
+	for _, franchise := range franchises {
+		if _, err := alerting.Raise(database.AlertKindSLABreaches, fmt.Sprintf("franchise:%d", franchise.FranchiseID), fmt.Sprintf(
+			"⏰ %s (franchise #%d) breached the SLA on %d service requests in the last 24 hours.",
+			franchise.Name, franchise.FranchiseID, franchise.Breaches)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWebhookFailures alerts about each webhook endpoint with deliveries
+// attempted in the last day that failed at least the threshold of times
+// without getting through
+func checkWebhookFailures() error {
+	var endpoints []struct {
+		EndpointID uint
+		URL        string
+		Failing    int64
+		LastError  string
+	}
+	if err := database.DB.Model(&database.WebhookDelivery{}).
+		Select("webhook_deliveries.endpoint_id, webhook_endpoints.url, COUNT(*) AS failing, (array_agg(webhook_deliveries.last_error ORDER BY webhook_deliveries.updated_at DESC))[1] AS last_error").
+		Joins("JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id AND webhook_endpoints.deleted_at IS NULL").
+		Where("webhook_deliveries.status <> ? AND webhook_deliveries.attempts >= ? AND webhook_deliveries.updated_at > ?",
+			database.WebhookDeliverySucceeded, config.AppConfig.AlertWebhookFailureThreshold, time.Now().Add(-alertLookback)).
+		Group("webhook_deliveries.endpoint_id, webhook_endpoints.url").
+		Scan(&endpoints).Error; err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		if _, err := alerting.Raise(database.AlertKindWebhookFailures, fmt.Sprintf("webhook_endpoint:%d", endpoint.EndpointID), fmt.Sprintf(
+			"📡 %d webhook deliveries to %s (endpoint #%d) have failed %d or more times. Last error: %s",
+			endpoint.Failing, endpoint.URL, endpoint.EndpointID, config.AppConfig.AlertWebhookFailureThreshold, endpoint.LastError)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
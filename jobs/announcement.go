@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// announcementBatchSize is how many recipients are notified per batch
+const announcementBatchSize = 500
+
+// announcementLease is how long a worker may hold an announcement without
+// finishing a batch before another worker resumes it
+const announcementLease = 5 * time.Minute
+
+// AnnouncementAudience limits a users query to an announcement's audience
+func AnnouncementAudience(db *gorm.DB, announcement database.Announcement) *gorm.DB {
+	query := db.Model(&database.User{}).Where("tenant_id = ?", announcement.TenantID)
+	switch announcement.Audience {
+	case database.AudienceAllAgents:
+		return query.Where("role = ?", database.RoleServiceAgent)
+	case database.AudienceFranchiseCustomers:
+		return query.Where("role = ?", database.RoleCustomer).
+			Where("id IN (?)", db.Model(&database.Order{}).Select("customer_id").
+				Where("franchise_id = ?", announcement.FranchiseID))
+	}
+	return query.Where("role = ?", database.RoleCustomer)
+}
+
+// DeliverAnnouncement sends an announcement to its audience in batches. It
+// is meant to run in its own goroutine; an announcement another worker is
+// already delivering is left alone.
+func DeliverAnnouncement(announcementID uint) {
+	now := time.Now()
+	claim := database.DB.Model(&database.Announcement{}).
+		Where("id = ? AND status <> ?", announcementID, database.AnnouncementStatusCompleted).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Update("locked_until", now.Add(announcementLease))
+	if claim.Error != nil {
+		log.Printf("❌ Announcement %d could not be claimed: %v", announcementID, claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+
+	if err := deliverAnnouncement(announcementID); err != nil {
+		// The lease runs out and the next ResumeAnnouncements run carries on
+		log.Printf("❌ Announcement %d delivery failed: %v", announcementID, err)
+	}
+}
+
+func deliverAnnouncement(announcementID uint) error {
+	var announcement database.Announcement
+	if err := database.DB.First(&announcement, announcementID).Error; err != nil {
+		return err
+	}
+
+	if announcement.Status == database.AnnouncementStatusQueued {
+		var recipients int64
+		if err := AnnouncementAudience(database.DB, announcement).Count(&recipients).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := database.DB.Model(&announcement).Updates(map[string]interface{}{
+			"status":     database.AnnouncementStatusSending,
+			"recipients": recipients,
+			"started_at": now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	for {
+		var users []database.User
+		if err := AnnouncementAudience(database.DB, announcement).
+			Select("id, email, phone").
+			Where("id > ?", announcement.LastUserID).
+			Order("id").Limit(announcementBatchSize).
+			Find(&users).Error; err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		notifications := make([]database.Notification, 0, len(users))
+		for _, user := range users {
+			notifications = append(notifications, database.Notification{
+				UserID:      user.ID,
+				Title:       announcement.Title,
+				Message:     announcement.Message,
+				Type:        "announcement",
+				Event:       "announcement",
+				RelatedID:   &announcement.ID,
+				RelatedType: "announcement",
+			})
+		}
+		lastUserID := users[len(users)-1].ID
+
+		// The notifications and the cursor move together, so a resumed
+		// delivery never notifies anyone twice
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&notifications).Error; err != nil {
+				return err
+			}
+			return tx.Model(&announcement).Updates(map[string]interface{}{
+				"last_user_id": lastUserID,
+				"notified":     gorm.Expr("notified + ?", len(notifications)),
+				"locked_until": time.Now().Add(announcementLease),
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+		announcement.LastUserID = lastUserID
+
+		if announcement.SendEmail || announcement.SendSMS {
+			sendAnnouncementMessages(announcement, users)
+		}
+	}
+
+	return database.DB.Model(&announcement).Updates(map[string]interface{}{
+		"status":       database.AnnouncementStatusCompleted,
+		"completed_at": time.Now(),
+		"locked_until": nil,
+	}).Error
+}
+
+// sendAnnouncementMessages emails and texts a batch of recipients and adds
+// the outcome to the announcement's delivery stats
+func sendAnnouncementMessages(announcement database.Announcement, users []database.User) {
+	var emailsSent, emailsFailed, smsSent, smsFailed int
+	for _, user := range users {
+		if announcement.SendEmail && user.Email != "" {
+			if err := utils.SendEmail(user.Email, announcement.Title, announcement.Message); err != nil {
+				log.Printf("Announcement %d email to user %d failed: %v", announcement.ID, user.ID, err)
+				emailsFailed++
+			} else {
+				emailsSent++
+			}
+		}
+		if phone := utils.NormalizePhone(user.Phone); announcement.SendSMS && phone != "" {
+			if err := utils.SendSMS(phone, announcement.Message); err != nil {
+				log.Printf("Announcement %d SMS to user %d failed: %v", announcement.ID, user.ID, err)
+				smsFailed++
+			} else {
+				smsSent++
+			}
+		}
+	}
+
+	if err := database.DB.Model(&announcement).Updates(map[string]interface{}{
+		"emails_sent":   gorm.Expr("emails_sent + ?", emailsSent),
+		"emails_failed": gorm.Expr("emails_failed + ?", emailsFailed),
+		"sms_sent":      gorm.Expr("sms_sent + ?", smsSent),
+		"sms_failed":    gorm.Expr("sms_failed + ?", smsFailed),
+	}).Error; err != nil {
+		log.Printf("Failed to record announcement %d delivery stats: %v", announcement.ID, err)
+	}
+}
+
+// ResumeAnnouncements carries on delivering announcements that are queued or
+// whose worker stopped, e.g. because the server restarted
+func ResumeAnnouncements() error {
+	var ids []uint
+	if err := database.DB.Model(&database.Announcement{}).
+		Where("status IN ?", []string{database.AnnouncementStatusQueued, database.AnnouncementStatusSending}).
+		Where("locked_until IS NULL OR locked_until < ?", time.Now()).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		DeliverAnnouncement(id)
+	}
+	return nil
+}
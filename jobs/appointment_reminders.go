@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/events"
+	"aquahome/utils"
+)
+
+// When reminders go out before a visit. A visit first seen inside the later
+// window only gets the later reminder.
+const (
+	dayBeforeReminder   = 24 * time.Hour
+	hoursBeforeReminder = 2 * time.Hour
+)
+
+// appointment is a scheduled visit to remind a customer of
+type appointment struct {
+	Kind        string
+	EntityType  string // what notifications link to
+	EntityID    uint
+	CustomerID  uint
+	FranchiseID uint
+	At          time.Time
+	Visit       string // how the reminder names it, e.g. "repair visit"
+}
+
+// SendAppointmentReminders reminds customers of service visits and
+// installations 24 hours and 2 hours before they are due, with links to
+// confirm or ask to reschedule, so agents aren't sent to empty homes
+func SendAppointmentReminders() error {
+	now := time.Now()
+	until := now.Add(dayBeforeReminder)
+
+	var requests []database.ServiceRequest
+	if err := database.DB.Select("id, customer_id, franchise_id, type, scheduled_time").
+		Where("status IN ? AND scheduled_time > ? AND scheduled_time <= ?", database.RemindedServiceStatuses, now, until).
+		Find(&requests).Error; err != nil {
+		return err
+	}
+	var orders []database.Order
+	if err := database.DB.Select("id, customer_id, franchise_id, delivery_date").
+		Where("status IN ? AND delivery_date > ? AND delivery_date <= ?", database.RemindedOrderStatuses, now, until).
+		Find(&orders).Error; err != nil {
+		return err
+	}
+
+	appointments := make([]appointment, 0, len(requests)+len(orders))
+	for _, request := range requests {
+		appointments = append(appointments, appointment{
+			Kind:        database.AppointmentServiceRequest,
+			EntityType:  "service_request",
+			EntityID:    request.ID,
+			CustomerID:  request.CustomerID,
+			FranchiseID: request.FranchiseID,
+			At:          *request.ScheduledTime,
+			Visit:       request.Type + " visit",
+		})
+	}
+	for _, order := range orders {
+		appointments = append(appointments, appointment{
+			Kind:        database.AppointmentInstallation,
+			EntityType:  "order",
+			EntityID:    order.ID,
+			CustomerID:  order.CustomerID,
+			FranchiseID: order.FranchiseID,
+			At:          order.DeliveryDate,
+			Visit:       "purifier installation",
+		})
+	}
+
+	for _, visit := range appointments {
+		if err := remindAppointment(visit, now); err != nil {
+			log.Printf("Appointment reminder failed for %s %d: %v", visit.Kind, visit.EntityID, err)
+		}
+	}
+	return nil
+}
+
+// remindAppointment sends the reminder due for a visit unless it was already
+// sent or the customer asked to reschedule
+func remindAppointment(visit appointment, now time.Time) error {
+	column := "day_before_sent_at"
+	if visit.At.Sub(now) <= hoursBeforeReminder {
+		column = "hours_before_sent_at"
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		reminder := database.AppointmentReminder{Kind: visit.Kind, EntityID: visit.EntityID, ScheduledTime: visit.At}
+		if err := tx.Where(&reminder).
+			Attrs(database.AppointmentReminder{CustomerID: visit.CustomerID, FranchiseID: visit.FranchiseID}).
+			FirstOrCreate(&reminder).Error; err != nil {
+			return err
+		}
+
+		// Claimed so instances running the job together send it once
+		claim := tx.Model(&reminder).Where(column+" IS NULL AND reschedule_requested_at IS NULL").Update(column, now)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			return claim.Error
+		}
+
+		token := utils.SignID(database.AppointmentLinkPurpose, reminder.ID)
+		link := fmt.Sprintf("%s/appointments/%s", config.AppConfig.AppBaseURL, token)
+		return events.Publish(tx, events.Event{
+			Name:        events.AppointmentReminder,
+			EntityType:  visit.EntityType,
+			EntityID:    visit.EntityID,
+			CustomerID:  visit.CustomerID,
+			FranchiseID: visit.FranchiseID,
+			Vars: database.Vars{
+				"visit":          visit.Visit,
+				"when":           visit.At.Format("Mon 02 Jan 15:04"),
+				"confirm_url":    link + "?action=confirm",
+				"reschedule_url": link + "?action=reschedule",
+			},
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/events"
+)
+
+// dataExportTTL is how long a finished archive stays downloadable
+const dataExportTTL = 7 * 24 * time.Hour
+
+// GenerateDataExport builds the ZIP archive for a pending export and notifies
+// the user. It is meant to run in its own goroutine.
+func GenerateDataExport(exportID uint) {
+	var export database.DataExport
+	if err := database.DB.First(&export, exportID).Error; err != nil {
+		log.Printf("❌ Data export %d not found: %v", exportID, err)
+		return
+	}
+
+	path, size, err := writeDataExport(export)
+	if err != nil {
+		log.Printf("❌ Data export %d failed: %v", exportID, err)
+		database.DB.Model(&export).Updates(map[string]interface{}{
+			"status": database.DataExportStatusFailed,
+			"error":  "Export could not be generated, please try again",
+		})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(dataExportTTL)
+	if err := database.DB.Model(&export).Updates(map[string]interface{}{
+		"status":       database.DataExportStatusReady,
+		"file_path":    path,
+		"size_bytes":   size,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		log.Printf("❌ Failed to save data export %d: %v", exportID, err)
+		os.Remove(path)
+		return
+	}
+
+	notification := database.Notification{
+		UserID:      export.UserID,
+		Type:        "data_export",
+		RelatedID:   &export.ID,
+		RelatedType: "data_export",
+	}.Rendered(database.DB, "data_export.ready", database.Vars{"expires": expiresAt.Format("02 Jan 2006")})
+	if err := database.DB.Create(&notification).Error; err != nil {
+		log.Printf("Failed to notify user %d about data export: %v", export.UserID, err)
+	}
+
+	var user database.User
+	if err := database.DB.First(&user, export.UserID).Error; err == nil {
+		body := fmt.Sprintf("Hi %s,\n\nThe export of your AquaHome data is ready. Download it from your profile before %s.\n",
+			user.Name, expiresAt.Format("02 Jan 2006"))
+		if err := events.QueueNotificationDelivery(database.NotificationDelivery{
+			UserID:    user.ID,
+			Channel:   database.NotificationChannelEmail,
+			Event:     "data_export.ready",
+			Recipient: user.Email,
+			Title:     "Your AquaHome data export is ready",
+			Message:   body,
+		}); err != nil {
+			log.Printf("Failed to email data export notice to user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// writeDataExport writes the user's data as JSON files into a ZIP archive
+func writeDataExport(export database.DataExport) (string, int64, error) {
+	var user database.User
+	if err := database.DB.First(&user, export.UserID).Error; err != nil {
+		return "", 0, err
+	}
+
+	var orders []database.Order
+	if err := database.DB.Preload("Product").Where("customer_id = ?", user.ID).Find(&orders).Error; err != nil {
+		return "", 0, err
+	}
+	var subscriptions []database.Subscription
+	if err := database.DB.Preload("Product").Where("customer_id = ?", user.ID).Find(&subscriptions).Error; err != nil {
+		return "", 0, err
+	}
+	var payments []database.Payment
+	if err := database.DB.Where("customer_id = ?", user.ID).Find(&payments).Error; err != nil {
+		return "", 0, err
+	}
+	var serviceRequests []database.ServiceRequest
+	if err := database.DB.Where("customer_id = ?", user.ID).Find(&serviceRequests).Error; err != nil {
+		return "", 0, err
+	}
+	var notifications []database.Notification
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&notifications).Error; err != nil {
+		return "", 0, err
+	}
+	var archived []database.ArchivedRecord
+	if err := database.DB.Where("user_id = ?", user.ID).Order("id").Find(&archived).Error; err != nil {
+		return "", 0, err
+	}
+
+	dir := config.AppConfig.DataExportDir
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("user-%d-export-%d.zip", user.ID, export.ID))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+
+	archive := zip.NewWriter(file)
+	entries := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"orders.json", orders},
+		{"subscriptions.json", subscriptions},
+		{"payments.json", payments},
+		{"service_requests.json", serviceRequests},
+		{"notifications.json", notifications},
+		{"archived.json", archived},
+	}
+	for _, entry := range entries {
+		if err = writeJSONEntry(archive, entry.name, entry.data); err != nil {
+			break
+		}
+	}
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, data interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// PurgeExpiredDataExports deletes archives past their expiry and fails exports
+// that were interrupted, e.g. by a restart
+func PurgeExpiredDataExports() error {
+	var expired []database.DataExport
+	if err := database.DB.Where("status = ? AND expires_at <= ?", database.DataExportStatusReady, time.Now()).
+		Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, export := range expired {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete data export file %s: %v", export.FilePath, err)
+			continue
+		}
+		database.DB.Model(&export).Updates(map[string]interface{}{"status": database.DataExportStatusExpired, "file_path": ""})
+	}
+
+	return database.DB.Model(&database.DataExport{}).
+		Where("status = ? AND created_at <= ?", database.DataExportStatusPending, time.Now().Add(-time.Hour)).
+		Updates(map[string]interface{}{
+			"status": database.DataExportStatusFailed,
+			"error":  "Export was interrupted, please try again",
+		}).Error
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// OpenDepositSettlement starts the deposit refund for an ended subscription by
+// creating the settlement and a device pickup task for the franchise. It does
+// nothing if the subscription already has a settlement.
+func OpenDepositSettlement(tx *gorm.DB, subscription database.Subscription) error {
+	var existing int64
+	if err := tx.Model(&database.DepositSettlement{}).
+		Where("subscription_id = ?", subscription.ID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	var order database.Order
+	if err := tx.Select("id, security_deposit").First(&order, subscription.OrderID).Error; err != nil {
+		return err
+	}
+
+	pickup := database.ServiceRequest{
+		CustomerID:     subscription.CustomerID,
+		SubscriptionID: subscription.ID,
+		FranchiseID:    subscription.FranchiseID,
+		Type:           "pickup",
+		Status:         database.ServiceStatusPending,
+		Description:    "Collect the purifier after the subscription ended",
+		SLADueAt:       database.ServiceSLADeadline("pickup", time.Now()),
+	}
+	if err := tx.Create(&pickup).Error; err != nil {
+		return err
+	}
+
+	settlement := database.DepositSettlement{
+		SubscriptionID:   subscription.ID,
+		OrderID:          order.ID,
+		CustomerID:       subscription.CustomerID,
+		FranchiseID:      subscription.FranchiseID,
+		ServiceRequestID: &pickup.ID,
+		Status:           database.DepositStatusAwaitingPickup,
+		DepositAmount:    order.SecurityDeposit,
+	}
+	if err := tx.Create(&settlement).Error; err != nil {
+		return err
+	}
+
+	notifications := []database.Notification{database.Notification{
+		UserID:      subscription.CustomerID,
+		Type:        "deposit",
+		RelatedID:   &settlement.ID,
+		RelatedType: "deposit_settlement",
+	}.Rendered(tx, "deposit.refund_started", database.Vars{"amount": order.SecurityDeposit})}
+	var franchise database.Franchise
+	if err := tx.Select("id, owner_id").First(&franchise, subscription.FranchiseID).Error; err == nil && franchise.OwnerID != 0 {
+		notifications = append(notifications, database.Notification{
+			UserID:      franchise.OwnerID,
+			Type:        "service_request",
+			RelatedID:   &pickup.ID,
+			RelatedType: "service_request",
+		}.Rendered(tx, "deposit.pickup_needed", database.Vars{"id": pickup.ID, "subscription_id": subscription.ID}))
+	}
+	return tx.Create(&notifications).Error
+}
+
+// SettleEndedSubscriptions expires subscriptions that reached their end date
+// and opens a deposit settlement for every ended subscription without one
+func SettleEndedSubscriptions() error {
+	now := time.Now()
+	if err := database.DB.Model(&database.Subscription{}).
+		Where("status = ? AND end_date > ? AND end_date <= ?", database.SubscriptionStatusActive, time.Time{}, now).
+		Update("status", database.SubscriptionStatusExpired).Error; err != nil {
+		return err
+	}
+
+	var subscriptions []database.Subscription
+	if err := database.DB.
+		Where("status IN ?", []string{database.SubscriptionStatusCancelled, database.SubscriptionStatusExpired}).
+		Where("NOT EXISTS (SELECT 1 FROM deposit_settlements WHERE deposit_settlements.subscription_id = subscriptions.id)").
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	opened := 0
+	for _, subscription := range subscriptions {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return OpenDepositSettlement(tx, subscription)
+		})
+		if err != nil {
+			log.Printf("Failed to open deposit settlement for subscription %d: %v", subscription.ID, err)
+			continue
+		}
+		opened++
+	}
+
+	if opened > 0 {
+		log.Printf("💰 Opened %d deposit settlement(s)", opened)
+	}
+	return nil
+}
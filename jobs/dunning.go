@@ -0,0 +1,188 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/events"
+	"aquahome/ledger"
+)
+
+// RunDunning chases overdue rent: it sends escalating reminders, adds a late
+// fee to the next monthly payment and suspends subscriptions that stay unpaid
+// past the grace period
+func RunDunning() error {
+	now := time.Now()
+
+	var subscriptions []database.Subscription
+	if err := database.DB.Preload("Customer").Preload("Franchise").
+		Where("status IN ? AND next_billing_date > ? AND next_billing_date < ?",
+			[]string{database.SubscriptionStatusActive, database.SubscriptionStatusSuspended},
+			time.Time{}, now.AddDate(0, 0, -1)).
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		daysOverdue := int(now.Sub(subscription.NextBillingDate).Hours() / 24)
+		if err := dunSubscription(subscription, daysOverdue); err != nil {
+			log.Printf("Dunning failed for subscription %d: %v", subscription.ID, err)
+		}
+	}
+	return nil
+}
+
+// dunSubscription takes every dunning step that is due and not yet taken
+func dunSubscription(subscription database.Subscription, daysOverdue int) error {
+	cfg := config.AppConfig
+
+	// Only the most severe reminder due is sent, so a catch-up run does not
+	// send several at once
+	reminderDay := 0
+	for _, day := range cfg.DunningReminderDays {
+		if daysOverdue >= day && day > reminderDay {
+			reminderDay = day
+		}
+	}
+	if reminderDay > 0 {
+		stage := fmt.Sprintf("reminder_%d", reminderDay)
+		sent, err := recordDunningStage(database.DB, subscription, stage, daysOverdue, 0)
+		if err != nil {
+			return err
+		}
+		if sent != nil {
+			sendRentReminder(subscription, daysOverdue)
+		}
+	}
+
+	if cfg.LateFeeAmount > 0 && daysOverdue >= cfg.LateFeeAfterDays {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			lateFee, err := recordDunningStage(tx, subscription, database.DunningStageLateFee, daysOverdue, cfg.LateFeeAmount)
+			if err != nil || lateFee == nil {
+				return err
+			}
+			if err := ledger.PostLateFee(tx, *lateFee, subscription.CustomerID); err != nil {
+				return err
+			}
+			if err := tx.Model(&database.Subscription{}).Where("id = ?", subscription.ID).
+				Update("outstanding_late_fee", gorm.Expr("outstanding_late_fee + ?", cfg.LateFeeAmount)).Error; err != nil {
+				return err
+			}
+			notification := database.Notification{
+				UserID:      subscription.CustomerID,
+				Type:        "payment",
+				RelatedID:   &subscription.ID,
+				RelatedType: "subscription",
+			}.Rendered(tx, "payment.late_fee", database.Vars{"amount": cfg.LateFeeAmount})
+			return tx.Create(&notification).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if subscription.Status == database.SubscriptionStatusActive && daysOverdue >= cfg.SuspendAfterDays {
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			suspended, err := recordDunningStage(tx, subscription, database.DunningStageSuspended, daysOverdue, 0)
+			if err != nil || suspended == nil {
+				return err
+			}
+			now := time.Now()
+			if err := tx.Model(&database.Subscription{}).Where("id = ? AND status = ?", subscription.ID, database.SubscriptionStatusActive).
+				Updates(map[string]interface{}{
+					"status":       database.SubscriptionStatusSuspended,
+					"suspended_at": now,
+				}).Error; err != nil {
+				return err
+			}
+
+			notifications := []database.Notification{database.Notification{
+				UserID:      subscription.CustomerID,
+				Type:        "subscription",
+				RelatedID:   &subscription.ID,
+				RelatedType: "subscription",
+			}.Rendered(tx, "subscription.suspended", database.Vars{"days": daysOverdue})}
+			if subscription.Franchise.OwnerID != 0 {
+				notifications = append(notifications, database.Notification{
+					UserID:      subscription.Franchise.OwnerID,
+					Type:        "subscription",
+					RelatedID:   &subscription.ID,
+					RelatedType: "subscription",
+				}.Rendered(tx, "subscription.suspended_franchise", database.Vars{"id": subscription.ID, "days": daysOverdue}))
+			}
+			return tx.Create(&notifications).Error
+		})
+	}
+	return nil
+}
+
+// recordDunningStage logs a stage for the subscription's current billing date.
+// It returns nil when the stage was already taken.
+func recordDunningStage(tx *gorm.DB, subscription database.Subscription, stage string, daysOverdue int, amount float64) (*database.DunningEvent, error) {
+	var existing int64
+	if err := tx.Model(&database.DunningEvent{}).
+		Where("subscription_id = ? AND billing_date = ? AND stage = ?", subscription.ID, subscription.NextBillingDate, stage).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	event := database.DunningEvent{
+		SubscriptionID: subscription.ID,
+		BillingDate:    subscription.NextBillingDate,
+		Stage:          stage,
+		DaysOverdue:    daysOverdue,
+		Amount:         amount,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// sendRentReminder notifies the customer in-app, by email and by SMS
+func sendRentReminder(subscription database.Subscription, daysOverdue int) {
+	notification := database.Notification{
+		UserID:      subscription.CustomerID,
+		Type:        "payment",
+		RelatedID:   &subscription.ID,
+		RelatedType: "subscription",
+	}.Rendered(database.DB, "payment.overdue", database.Vars{
+		"amount":   subscription.MonthlyRent,
+		"due_date": subscription.NextBillingDate.Format("02 Jan 2006"),
+		"days":     daysOverdue,
+	})
+	message := notification.Message
+
+	if err := database.DB.Create(&notification).Error; err != nil {
+		log.Printf("Failed to notify customer %d about overdue rent: %v", subscription.CustomerID, err)
+	}
+
+	customer := subscription.Customer
+	if err := events.QueueNotificationDelivery(database.NotificationDelivery{
+		UserID:    customer.ID,
+		Channel:   database.NotificationChannelEmail,
+		Event:     "payment.overdue",
+		Recipient: customer.Email,
+		Title:     "Your AquaHome rent is overdue",
+		Message:   fmt.Sprintf("Hi %s,\n\n%s\n", customer.Name, message),
+	}); err != nil {
+		log.Printf("Failed to email rent reminder to customer %d: %v", customer.ID, err)
+	}
+	if err := events.QueueNotificationDelivery(database.NotificationDelivery{
+		UserID:    customer.ID,
+		Channel:   database.NotificationChannelSMS,
+		Event:     "payment.overdue",
+		Recipient: customer.Phone,
+		Message:   "AquaHome: " + message,
+	}); err != nil {
+		log.Printf("Failed to text rent reminder to customer %d: %v", customer.ID, err)
+	}
+}
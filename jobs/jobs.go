@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"aquahome/alerting"
+	"aquahome/config"
+	"aquahome/events"
+	"aquahome/queue"
+)
+
+// stopping is closed by Stop to tell workers to finish; workers tracks the
+// scheduled workers and one-off jobs still running
+var (
+	stopping = make(chan struct{})
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+)
+
+// Start launches all background workers. It returns immediately.
+func Start() {
+	// Tasks queued in process memory can only be run by this instance
+	if !config.AppConfig.SchedulerEnabled && queue.Shared() {
+		log.Println("ℹ️ Background jobs disabled (SCHEDULER_ENABLED=false)")
+		return
+	}
+	startQueueWorkers(config.AppConfig.QueueWorkers)
+	if !config.AppConfig.SchedulerEnabled {
+		log.Println("ℹ️ Scheduled jobs disabled (SCHEDULER_ENABLED=false)")
+		return
+	}
+
+	schedule("maintenance scheduler", minutes(config.AppConfig.MaintenanceIntervalMinutes), CreateDueMaintenanceRequests)
+	schedule("data export cleanup", time.Hour, PurgeExpiredDataExports)
+	schedule("data retention", 24*time.Hour, ArchiveOldRecords)
+	schedule("deposit settlements", time.Hour, SettleEndedSubscriptions)
+	schedule("rent dunning", time.Hour, RunDunning)
+	schedule("franchise settlements", time.Hour, GenerateMonthlySettlements)
+	schedule("settlement payout retries", 15*time.Minute, RetryFailedPayouts)
+	schedule("announcement delivery", 5*time.Minute, ResumeAnnouncements)
+	schedule("service SLA escalation", 15*time.Minute, EscalateOverdueServiceRequests)
+	schedule("appointment reminders", 5*time.Minute, SendAppointmentReminders)
+	schedule("webhook delivery", time.Minute, DeliverWebhooks)
+	schedule("event outbox", 10*time.Second, events.RelayOutbox)
+	schedule("notification delivery", 30*time.Second, events.DeliverNotifications)
+	if alerting.Enabled() {
+		schedule("operator alerts", minutes(config.AppConfig.AlertIntervalMinutes), CheckAlerts)
+	} else {
+		log.Println("ℹ️ Operator alerts disabled (ALERT_SLACK_WEBHOOK_URL and ALERT_TELEGRAM_BOT_TOKEN not set)")
+	}
+}
+
+// schedule starts a worker that runs task every interval until Stop
+func schedule(name string, interval time.Duration, task func() error) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runEvery(name, interval, task)
+	}()
+}
+
+// startQueueWorkers starts n workers running tasks from the job queue until Stop
+func startQueueWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	log.Printf("⏱️ Starting %d job queue workers", n)
+	for i := 0; i < n; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			queue.Work(stopping)
+		}()
+	}
+}
+
+// runEvery runs task immediately and then once per interval, logging
+// failures. It returns once Stop is called and the current run is done.
+func runEvery(name string, interval time.Duration, task func() error) {
+	log.Printf("⏱️ Starting %s (every %s)", name, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := task(); err != nil {
+			log.Printf("❌ %s failed: %v", name, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopping:
+			log.Printf("⏹️ Stopped %s", name)
+			return
+		}
+	}
+}
+
+// Go runs a one-off job in the background, such as a data export a request
+// started. Stop waits for it to finish.
+func Go(job func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		job()
+	}()
+}
+
+// Stop tells the workers to stop and waits for running jobs to finish, or
+// for ctx to end
+func Stop(ctx context.Context) error {
+	stopOnce.Do(func() { close(stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// minutes converts a configured minute count into a duration, never below one minute
+func minutes(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	return time.Duration(n) * time.Minute
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// defaultMaintenanceCycleDays is used when a product has no maintenance cycle set
+const defaultMaintenanceCycleDays = 90
+
+// CreateDueMaintenanceRequests creates a preventive-maintenance service request for
+// every active subscription whose next maintenance date has arrived, and schedules
+// the following visit using the plan's included services or the product's
+// maintenance cycle
+func CreateDueMaintenanceRequests() error {
+	now := time.Now()
+
+	var subscriptions []database.Subscription
+	if err := database.DB.Preload("Product").Preload("Franchise").
+		Where("status = ? AND next_maintenance > ? AND next_maintenance <= ?",
+			database.SubscriptionStatusActive, time.Time{}, now).
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	created := 0
+	for _, subscription := range subscriptions {
+		ok, err := createMaintenanceRequest(subscription)
+		if err != nil {
+			log.Printf("Failed to create maintenance request for subscription %d: %v", subscription.ID, err)
+			continue
+		}
+		if ok {
+			created++
+		}
+	}
+
+	if created > 0 {
+		log.Printf("🛠️ Created %d scheduled maintenance request(s)", created)
+	}
+	return nil
+}
+
+// createMaintenanceRequest creates the request and notifications for one subscription.
+// It returns false when an open maintenance request already exists.
+func createMaintenanceRequest(subscription database.Subscription) (bool, error) {
+	cycleDays := subscription.Product.MaintenanceCycle
+	if subscription.ServicesPerYear > 0 {
+		// The plan ordered sets how many visits are included
+		cycleDays = 365 / subscription.ServicesPerYear
+	}
+	if cycleDays <= 0 {
+		cycleDays = defaultMaintenanceCycleDays
+	}
+
+	dueAt := subscription.NextMaintenance
+	nextMaintenance := dueAt.AddDate(0, 0, cycleDays)
+	// Catch up without creating a backlog of visits for long-overdue subscriptions
+	for !nextMaintenance.After(time.Now()) {
+		nextMaintenance = nextMaintenance.AddDate(0, 0, cycleDays)
+	}
+
+	created := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var open int64
+		if err := tx.Model(&database.ServiceRequest{}).
+			Where("subscription_id = ? AND type = ? AND status NOT IN ?", subscription.ID, "maintenance",
+				[]string{database.ServiceStatusCompleted, database.ServiceStatusCancelled}).
+			Count(&open).Error; err != nil {
+			return err
+		}
+
+		if open == 0 {
+			serviceRequest := database.ServiceRequest{
+				CustomerID:     subscription.CustomerID,
+				SubscriptionID: subscription.ID,
+				FranchiseID:    subscription.FranchiseID,
+				Type:           "maintenance",
+				Status:         database.ServiceStatusPending,
+				Description:    "Scheduled preventive maintenance (filter change and servicing)",
+				ScheduledTime:  &dueAt,
+				SLADueAt:       database.ServiceSLADeadline("maintenance", time.Now()),
+			}
+			if err := tx.Create(&serviceRequest).Error; err != nil {
+				return err
+			}
+
+			notifications := []database.Notification{database.Notification{
+				UserID:      subscription.CustomerID,
+				Type:        "service_request",
+				RelatedID:   &serviceRequest.ID,
+				RelatedType: "service_request",
+			}.Rendered(tx, "maintenance.scheduled", database.Vars{"product": subscription.Product.Name})}
+			if subscription.Franchise.OwnerID != 0 {
+				notifications = append(notifications, database.Notification{
+					UserID:      subscription.Franchise.OwnerID,
+					Type:        "service_request",
+					RelatedID:   &serviceRequest.ID,
+					RelatedType: "service_request",
+				}.Rendered(tx, "maintenance.due_franchise", database.Vars{"id": serviceRequest.ID, "subscription_id": subscription.ID}))
+			}
+			if err := tx.Create(&notifications).Error; err != nil {
+				return err
+			}
+			created = true
+		}
+
+		return tx.Model(&database.Subscription{}).
+			Where("id = ?", subscription.ID).
+			Update("next_maintenance", nextMaintenance).Error
+	})
+
+	return created, err
+}
@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/ledger"
+	"aquahome/metrics"
+	"aquahome/utils"
+)
+
+// Payout errors callers can report to the user
+var (
+	ErrSettlementNotPayable = errors.New("only approved or failed settlements can be paid out")
+	ErrNoBankAccount        = errors.New("franchise has no active bank account for payouts")
+)
+
+// DisburseSettlement pays a settlement's franchise share into the franchise's
+// active fund account through RazorpayX. The settlement is marked processing
+// until a payout webhook reports the result; errors creating the payout mark
+// it failed and schedule a retry.
+func DisburseSettlement(settlementID uint) (database.Settlement, error) {
+	if !utils.PayoutsEnabled() {
+		return database.Settlement{}, utils.ErrPayoutsDisabled
+	}
+
+	var settlement database.Settlement
+	var account database.FranchiseBankAccount
+	var payout database.SettlementPayout
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&settlement, settlementID).Error; err != nil {
+			return err
+		}
+		if settlement.Status != database.SettlementStatusApproved && settlement.Status != database.SettlementStatusFailed {
+			return ErrSettlementNotPayable
+		}
+
+		// Nothing is owed, so there is nothing to transfer
+		if settlement.FranchiseShare <= 0 {
+			now := time.Now()
+			settlement.Status = database.SettlementStatusPaid
+			settlement.PaidAt = &now
+			settlement.NextPayoutAt = nil
+			return tx.Save(&settlement).Error
+		}
+
+		if err := tx.Where("franchise_id = ? AND is_active = ?", settlement.FranchiseID, true).
+			Order("id DESC").First(&account).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNoBankAccount
+			}
+			return err
+		}
+
+		settlement.Status = database.SettlementStatusProcessing
+		settlement.PayoutAttempts++
+		settlement.NextPayoutAt = nil
+		if err := tx.Save(&settlement).Error; err != nil {
+			return err
+		}
+
+		// Resend an unanswered request with its idempotency key, so a payout
+		// RazorpayX did create is not made twice
+		key := fmt.Sprintf("settlement-%d-%d", settlement.ID, settlement.PayoutAttempts)
+		var last database.SettlementPayout
+		if err := tx.Where("settlement_id = ?", settlement.ID).Order("id DESC").First(&last).Error; err == nil &&
+			last.Status == database.PayoutStatusUnconfirmed && last.BankAccountID == account.ID {
+			key = last.IdempotencyKey
+		}
+
+		payout = database.SettlementPayout{
+			SettlementID:   settlement.ID,
+			BankAccountID:  account.ID,
+			Attempt:        settlement.PayoutAttempts,
+			Amount:         settlement.FranchiseShare,
+			IdempotencyKey: key,
+			Status:         "created",
+		}
+		return tx.Create(&payout).Error
+	})
+	if err != nil || settlement.Status == database.SettlementStatusPaid {
+		return settlement, err
+	}
+
+	mode := "IMPS"
+	if account.AccountType == database.BankAccountTypeVPA {
+		mode = "UPI"
+	}
+	result, err := utils.RazorpayX("POST", "/payouts", map[string]interface{}{
+		"account_number":       config.AppConfig.RazorpayXAccountNumber,
+		"fund_account_id":      account.RazorpayFundAccountID,
+		"amount":               int64(math.Round(settlement.FranchiseShare * 100)),
+		"currency":             "INR",
+		"mode":                 mode,
+		"purpose":              "payout",
+		"queue_if_low_balance": true,
+		"reference_id":         fmt.Sprintf("settlement_%d", settlement.ID),
+		"narration":            "AquaHome settlement",
+	}, payout.IdempotencyKey)
+	metrics.ObserveRazorpay("payout_create", err)
+	if err != nil {
+		log.Printf("Payout for settlement %d failed: %v", settlement.ID, err)
+		status := database.PayoutStatusFailed
+		var apiErr *utils.RazorpayXError
+		if !errors.As(err, &apiErr) {
+			status = database.PayoutStatusUnconfirmed
+		}
+		if applyErr := applyPayoutResult(database.DB, payout.ID, status, "", err.Error()); applyErr != nil {
+			return settlement, applyErr
+		}
+		database.DB.First(&settlement, settlement.ID)
+		return settlement, err
+	}
+
+	payoutID, _ := result["id"].(string)
+	status, _ := result["status"].(string)
+	if err := database.DB.Model(&payout).Update("razorpay_payout_id", payoutID).Error; err != nil {
+		return settlement, err
+	}
+	if err := applyPayoutResult(database.DB, payout.ID, status, stringField(result, "utr"), payoutFailureReason(result)); err != nil {
+		return settlement, err
+	}
+	err = database.DB.First(&settlement, settlement.ID).Error
+	return settlement, err
+}
+
+// ApplyPayoutWebhook records a RazorpayX payout status change reported by a
+// webhook. Unknown payouts are ignored.
+func ApplyPayoutWebhook(payout map[string]interface{}) error {
+	payoutID := stringField(payout, "id")
+	status := stringField(payout, "status")
+	if payoutID == "" || status == "" {
+		return errors.New("payout event missing id or status")
+	}
+
+	var attempt database.SettlementPayout
+	if err := database.DB.Where("razorpay_payout_id = ?", payoutID).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ignoring webhook for unknown payout %s", payoutID)
+			return nil
+		}
+		return err
+	}
+	return applyPayoutResult(database.DB, attempt.ID, status, stringField(payout, "utr"), payoutFailureReason(payout))
+}
+
+// applyPayoutResult updates a payout attempt and its settlement: processed
+// payouts mark the settlement paid, failed ones schedule a retry until
+// PayoutMaxAttempts is reached. Other statuses are in flight.
+func applyPayoutResult(db *gorm.DB, payoutAttemptID uint, status, utr, reason string) error {
+	var notify *database.Notification
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var payout database.SettlementPayout
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payout, payoutAttemptID).Error; err != nil {
+			return err
+		}
+		payout.Status = status
+		if utr != "" {
+			payout.UTR = utr
+		}
+		if reason != "" {
+			payout.FailureReason = reason
+		}
+		if err := tx.Save(&payout).Error; err != nil {
+			return err
+		}
+
+		var settlement database.Settlement
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Franchise").
+			First(&settlement, payout.SettlementID).Error; err != nil {
+			return err
+		}
+		// A late webhook for an earlier attempt must not override a newer one;
+		// only a reversal can reopen a paid settlement
+		if settlement.PayoutAttempts != payout.Attempt ||
+			(settlement.Status == database.SettlementStatusPaid && status != database.PayoutStatusReversed) {
+			return nil
+		}
+
+		switch status {
+		case database.PayoutStatusProcessed:
+			now := time.Now()
+			settlement.Status = database.SettlementStatusPaid
+			settlement.PaidAt = &now
+			settlement.PaymentReference = payout.UTR
+			if err := ledger.PostSettlementPaid(tx, settlement); err != nil {
+				return err
+			}
+			notify = &database.Notification{UserID: settlement.Franchise.OwnerID}
+			*notify = notify.Rendered(tx, "settlement.paid_out", database.Vars{
+				"amount": payout.Amount,
+				"period": settlement.PeriodStart.Format("January 2006"),
+				"utr":    payout.UTR,
+			})
+		case database.PayoutStatusFailed, database.PayoutStatusReversed, database.PayoutStatusRejected,
+			database.PayoutStatusCancelled, database.PayoutStatusUnconfirmed:
+			if settlement.Status == database.SettlementStatusPaid {
+				if err := ledger.PostSettlementPayoutReversed(tx, settlement); err != nil {
+					return err
+				}
+			}
+			settlement.Status = database.SettlementStatusFailed
+			settlement.PaidAt = nil
+			if settlement.PayoutAttempts < config.AppConfig.PayoutMaxAttempts {
+				next := time.Now().Add(time.Duration(settlement.PayoutAttempts) * time.Hour)
+				settlement.NextPayoutAt = &next
+			} else {
+				notify = &database.Notification{UserID: settlement.Franchise.OwnerID}
+				*notify = notify.Rendered(tx, "settlement.payout_failed", database.Vars{
+					"period": settlement.PeriodStart.Format("January 2006"),
+					"reason": payout.FailureReason,
+				})
+			}
+		default:
+			return nil
+		}
+		if err := tx.Omit(clause.Associations).Save(&settlement).Error; err != nil {
+			return err
+		}
+		if notify != nil && notify.UserID != 0 {
+			notify.Type = "settlement"
+			notify.RelatedID = &settlement.ID
+			notify.RelatedType = "settlement"
+			return tx.Create(notify).Error
+		}
+		return nil
+	})
+	return err
+}
+
+// RetryFailedPayouts retries failed settlement payouts whose retry time has come
+func RetryFailedPayouts() error {
+	if !utils.PayoutsEnabled() {
+		return nil
+	}
+
+	var ids []uint
+	if err := database.DB.Model(&database.Settlement{}).
+		Where("status = ? AND next_payout_at IS NOT NULL AND next_payout_at <= ?", database.SettlementStatusFailed, time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		_, err := DisburseSettlement(id)
+		if errors.Is(err, ErrNoBankAccount) {
+			// Wait for the owner to add an account and an admin to retry
+			database.DB.Model(&database.Settlement{}).Where("id = ?", id).Update("next_payout_at", nil)
+		}
+		if err != nil {
+			log.Printf("Payout retry for settlement %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// stringField reads a string field from a RazorpayX response map
+func stringField(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// payoutFailureReason reads why a payout failed from its status details
+func payoutFailureReason(payout map[string]interface{}) string {
+	if details, ok := payout["status_details"].(map[string]interface{}); ok {
+		if description := stringField(details, "description"); description != "" {
+			return description
+		}
+	}
+	return stringField(payout, "failure_reason")
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// archiveBatchSize is how many rows are moved per transaction, so archiving
+// never holds locks on a hot table for long
+const archiveBatchSize = 500
+
+// ArchiveOldRecords moves notifications and closed service requests past
+// their retention period into archived_records, keeping the tables lists are
+// served from small. Service requests take their attachments with them;
+// service reports and assignment history stay, as stock and agent metrics
+// are kept from them.
+func ArchiveOldRecords() error {
+	cfg := config.AppConfig
+
+	if months := cfg.NotificationRetentionMonths; months > 0 {
+		cutoff := time.Now().AddDate(0, -months, 0)
+		moved, err := archiveRows(database.ArchiveSourceNotifications, "user_id", func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&database.Notification{}).Where("created_at < ?", cutoff)
+		}, nil)
+		if moved > 0 {
+			log.Printf("🗄️ Archived %d notification(s)", moved)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if months := cfg.ServiceRequestRetentionMonths; months > 0 {
+		cutoff := time.Now().AddDate(0, -months, 0)
+		moved, err := archiveRows(database.ArchiveSourceServiceRequests, "customer_id", func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&database.ServiceRequest{}).
+				Where("status IN ? AND COALESCE(completion_time, updated_at) < ?",
+					[]string{database.ServiceStatusCompleted, database.ServiceStatusCancelled}, cutoff)
+		}, archiveServiceRequestAttachments)
+		if moved > 0 {
+			log.Printf("🗄️ Archived %d service request(s)", moved)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveRows moves the rows of source that query selects into
+// archived_records a batch at a time and returns how many were moved.
+// withChildren, when set, adds rows belonging to a batch to its rows and
+// removes them from their own table.
+func archiveRows(source, userColumn string, query func(tx *gorm.DB) *gorm.DB,
+	withChildren func(tx *gorm.DB, ids []uint, rows []map[string]interface{}) error) (int, error) {
+	moved := 0
+	for {
+		var rows []map[string]interface{}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := query(tx.Unscoped()).Order("id").Limit(archiveBatchSize).Find(&rows).Error; err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			ids := make([]uint, len(rows))
+			for i, row := range rows {
+				ids[i] = rowUint(row["id"])
+			}
+			if withChildren != nil {
+				if err := withChildren(tx, ids, rows); err != nil {
+					return err
+				}
+			}
+
+			now := time.Now()
+			records := make([]database.ArchivedRecord, len(rows))
+			for i, row := range rows {
+				data, err := json.Marshal(row)
+				if err != nil {
+					return err
+				}
+				recordedAt, _ := row["created_at"].(time.Time)
+				records[i] = database.ArchivedRecord{
+					Source:     source,
+					RecordID:   ids[i],
+					UserID:     rowUint(row[userColumn]),
+					RecordedAt: recordedAt,
+					Data:       data,
+					ArchivedAt: now,
+				}
+			}
+			if err := tx.Create(&records).Error; err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM "+source+" WHERE id IN ?", ids).Error
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved += len(rows)
+		if len(rows) < archiveBatchSize {
+			return moved, nil
+		}
+	}
+}
+
+// archiveServiceRequestAttachments moves the attachments of archived service
+// requests into their rows. The files themselves are kept.
+func archiveServiceRequestAttachments(tx *gorm.DB, ids []uint, rows []map[string]interface{}) error {
+	var attachments []map[string]interface{}
+	if err := tx.Unscoped().Model(&database.ServiceRequestAttachment{}).
+		Where("service_request_id IN ?", ids).Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+	byRequest := make(map[uint][]map[string]interface{})
+	for _, attachment := range attachments {
+		requestID := rowUint(attachment["service_request_id"])
+		byRequest[requestID] = append(byRequest[requestID], attachment)
+	}
+	for _, row := range rows {
+		if list := byRequest[rowUint(row["id"])]; len(list) > 0 {
+			row["attachments"] = list
+		}
+	}
+	return tx.Unscoped().Where("service_request_id IN ?", ids).Delete(&database.ServiceRequestAttachment{}).Error
+}
+
+// rowUint reads an ID column of a row scanned into a map
+func rowUint(value interface{}) uint {
+	switch v := value.(type) {
+	case int64:
+		return uint(v)
+	case int32:
+		return uint(v)
+	case int:
+		return uint(v)
+	case uint64:
+		return uint(v)
+	case uint:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// ErrSettlementLocked is returned when regenerating a settlement that has
+// been approved for payout
+var ErrSettlementLocked = errors.New("settlement is no longer pending")
+
+// MonthStart returns midnight on the first day of t's month
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// FranchisePayments limits a payments query to successful payments of a
+// franchise's orders and subscriptions made within [from, to)
+func FranchisePayments(query *gorm.DB, franchiseID uint, from, to time.Time) *gorm.DB {
+	return query.
+		Where("(payments.subscription_id IN (SELECT id FROM subscriptions WHERE franchise_id = ?) "+
+			"OR payments.order_id IN (SELECT id FROM orders WHERE franchise_id = ?))", franchiseID, franchiseID).
+		Where("payments.status IN ?", []string{database.PaymentStatusSuccess, database.PaymentStatusPaid}).
+		Where("payments.created_at >= ? AND payments.created_at < ?", from, to)
+}
+
+// GenerateSettlement computes a franchise's statement for the month starting
+// at periodStart, creating it or refreshing it while still pending
+func GenerateSettlement(tx *gorm.DB, franchise database.Franchise, periodStart time.Time) (database.Settlement, error) {
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	var settlement database.Settlement
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("franchise_id = ? AND period_start = ?", franchise.ID, periodStart).
+		First(&settlement).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return settlement, err
+	}
+	if settlement.ID != 0 && settlement.Status != database.SettlementStatusPending {
+		return settlement, ErrSettlementLocked
+	}
+
+	var totals struct {
+		Payments int64
+		Gross    float64
+		Tax      float64
+	}
+	if err := FranchisePayments(tx.Table("payments"), franchise.ID, periodStart, periodEnd).
+		Select("COUNT(*) AS payments, COALESCE(SUM(payments.amount), 0) AS gross, COALESCE(SUM(payments.tax_amount), 0) AS tax").
+		Where("payments.deleted_at IS NULL").
+		Scan(&totals).Error; err != nil {
+		return settlement, err
+	}
+
+	share := config.AppConfig.FranchiseRevenueShare
+	if franchise.RevenueShare != nil {
+		share = *franchise.RevenueShare
+	}
+	net := roundPaise(totals.Gross - totals.Tax)
+
+	settlement.FranchiseID = franchise.ID
+	settlement.PeriodStart = periodStart
+	settlement.PeriodEnd = periodEnd
+	settlement.PaymentCount = totals.Payments
+	settlement.GrossAmount = roundPaise(totals.Gross)
+	settlement.TaxAmount = roundPaise(totals.Tax)
+	settlement.NetAmount = net
+	settlement.SharePercent = share
+	settlement.FranchiseShare = roundPaise(net * share / 100)
+	settlement.PlatformShare = roundPaise(net - settlement.FranchiseShare)
+	settlement.Status = database.SettlementStatusPending
+
+	return settlement, tx.Save(&settlement).Error
+}
+
+// GenerateMonthlySettlements creates last month's statement for every
+// approved franchise that does not have one yet, and notifies the owner
+func GenerateMonthlySettlements() error {
+	periodStart := MonthStart(time.Now()).AddDate(0, -1, 0)
+
+	var franchises []database.Franchise
+	if err := database.DB.
+		Where("approval_state = ?", "approved").
+		Where("id NOT IN (?)", database.DB.Model(&database.Settlement{}).
+			Select("franchise_id").Where("period_start = ?", periodStart)).
+		Find(&franchises).Error; err != nil {
+		return err
+	}
+
+	for _, franchise := range franchises {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			settlement, err := GenerateSettlement(tx, franchise, periodStart)
+			if err != nil {
+				return err
+			}
+			if franchise.OwnerID == 0 {
+				return nil
+			}
+			notification := database.Notification{
+				UserID:      franchise.OwnerID,
+				Type:        "settlement",
+				RelatedID:   &settlement.ID,
+				RelatedType: "settlement",
+			}.Rendered(tx, "settlement.ready", database.Vars{
+				"period":   periodStart.Format("January 2006"),
+				"amount":   settlement.FranchiseShare,
+				"payments": settlement.PaymentCount,
+			})
+			return tx.Create(&notification).Error
+		})
+		if err != nil {
+			log.Printf("Settlement failed for franchise %d: %v", franchise.ID, err)
+		}
+	}
+	return nil
+}
+
+// roundPaise rounds an amount to whole paise
+func roundPaise(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+)
+
+// EscalateOverdueServiceRequests escalates open service requests past their
+// SLA to the franchise owner, and to admins when they stay open another
+// SLAAdminEscalationHours
+func EscalateOverdueServiceRequests() error {
+	if err := backfillSLADeadlines(); err != nil {
+		return err
+	}
+	now := time.Now()
+
+	var breached []database.ServiceRequest
+	if err := database.DB.Where("status IN ? AND escalation_level = ? AND sla_due_at <= ?",
+		database.OpenServiceStatuses, database.EscalationNone, now).
+		Find(&breached).Error; err != nil {
+		return err
+	}
+	for _, request := range breached {
+		if err := escalateServiceRequest(request, database.EscalationFranchiseOwner, now); err != nil {
+			log.Printf("SLA escalation failed for service request %d: %v", request.ID, err)
+		}
+	}
+
+	adminAfter := now.Add(-time.Duration(config.AppConfig.SLAAdminEscalationHours) * time.Hour)
+	var stale []database.ServiceRequest
+	if err := database.DB.Where("status IN ? AND escalation_level = ? AND escalated_at <= ?",
+		database.OpenServiceStatuses, database.EscalationFranchiseOwner, adminAfter).
+		Find(&stale).Error; err != nil {
+		return err
+	}
+	for _, request := range stale {
+		if err := escalateServiceRequest(request, database.EscalationAdmin, now); err != nil {
+			log.Printf("SLA escalation failed for service request %d: %v", request.ID, err)
+		}
+	}
+	return nil
+}
+
+// backfillSLADeadlines sets the SLA deadline of open requests created before
+// deadlines were tracked
+func backfillSLADeadlines() error {
+	missing := database.DB.Model(&database.ServiceRequest{}).
+		Where("sla_due_at IS NULL AND status IN ?", database.OpenServiceStatuses)
+
+	var types []string
+	for requestType := range config.AppConfig.ServiceSLAHoursByType {
+		if err := missing.Session(&gorm.Session{}).Where("type = ?", requestType).
+			Update("sla_due_at", gorm.Expr("created_at + make_interval(hours => ?)", database.ServiceSLAHours(requestType))).Error; err != nil {
+			return err
+		}
+		types = append(types, requestType)
+	}
+
+	rest := missing.Session(&gorm.Session{})
+	if len(types) > 0 {
+		rest = rest.Where("type NOT IN ?", types)
+	}
+	return rest.Update("sla_due_at", gorm.Expr("created_at + make_interval(hours => ?)", config.AppConfig.ServiceSLAHours)).Error
+}
+
+// escalateServiceRequest raises a request to the given escalation level and
+// notifies who it was escalated to. Requests of franchises without an owner go
+// straight to admins.
+func escalateServiceRequest(request database.ServiceRequest, level int, now time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var ownerID uint
+		if level == database.EscalationFranchiseOwner && request.FranchiseID != 0 {
+			if err := tx.Model(&database.Franchise{}).Where("id = ?", request.FranchiseID).
+				Pluck("owner_id", &ownerID).Error; err != nil {
+				return err
+			}
+		}
+		if level == database.EscalationFranchiseOwner && ownerID == 0 {
+			level = database.EscalationAdmin
+		}
+
+		updates := map[string]interface{}{"escalation_level": level, "escalated_at": now}
+		if request.SLABreachedAt == nil {
+			updates["sla_breached_at"] = now
+		}
+		// Guarded by the current level so overlapping runs escalate once
+		result := tx.Model(&database.ServiceRequest{}).
+			Where("id = ? AND escalation_level = ?", request.ID, request.EscalationLevel).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var recipients []uint
+		event := "service_request.sla_breached"
+		if level == database.EscalationAdmin {
+			event = "service_request.sla_escalated"
+			if err := tx.Model(&database.User{}).Where("role = ?", database.RoleAdmin).
+				Pluck("id", &recipients).Error; err != nil {
+				return err
+			}
+		} else {
+			recipients = []uint{ownerID}
+		}
+
+		vars := database.Vars{
+			"id":           request.ID,
+			"type":         request.Type,
+			"status":       request.Status,
+			"hours":        database.ServiceSLAHours(request.Type),
+			"franchise_id": request.FranchiseID,
+			"overdue":      int(now.Sub(*request.SLADueAt).Hours()),
+		}
+		var notifications []database.Notification
+		for _, userID := range recipients {
+			notifications = append(notifications, database.Notification{
+				UserID:      userID,
+				Type:        "service_request",
+				RelatedID:   &request.ID,
+				RelatedType: "service_request",
+			}.Rendered(tx, event, vars))
+		}
+		if len(notifications) == 0 {
+			return nil
+		}
+		return tx.Create(&notifications).Error
+	})
+}
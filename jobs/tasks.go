@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"aquahome/queue"
+)
+
+// Task types run by the job queue
+const (
+	TaskDataExport      = "data_export.generate"
+	TaskAnnouncement    = "announcement.deliver"
+	TaskWebhookDelivery = "webhook.deliver"
+)
+
+// idPayload names the record a task works on
+type idPayload struct {
+	ID uint `json:"id"`
+}
+
+func init() {
+	// Exports and announcements record their own failures and are resumed by
+	// their scheduled jobs, so the queue doesn't retry them
+	queue.Register(TaskDataExport, byID(func(id uint) error {
+		GenerateDataExport(id)
+		return nil
+	}), queue.Options{MaxRetry: 0, Timeout: 15 * time.Minute})
+	queue.Register(TaskAnnouncement, byID(func(id uint) error {
+		DeliverAnnouncement(id)
+		return nil
+	}), queue.Options{MaxRetry: 0, Timeout: 30 * time.Minute})
+	// Failed sends are retried on the delivery's own schedule; the queue only
+	// retries errors reaching the database
+	queue.Register(TaskWebhookDelivery, byID(DeliverWebhook), queue.Options{MaxRetry: 3, Timeout: time.Minute})
+}
+
+// byID adapts a function of a record ID to a task handler
+func byID(handle func(id uint) error) queue.Handler {
+	return func(_ context.Context, payload json.RawMessage) error {
+		var p idPayload
+		if err := queue.Decode(payload, &p); err != nil {
+			return err
+		}
+		return handle(p.ID)
+	}
+}
+
+// QueueDataExport queues generating a data export archive
+func QueueDataExport(exportID uint) {
+	enqueueOrRun(TaskDataExport, exportID, func() { GenerateDataExport(exportID) })
+}
+
+// QueueAnnouncement queues sending an announcement to its audience
+func QueueAnnouncement(announcementID uint) {
+	enqueueOrRun(TaskAnnouncement, announcementID, func() { DeliverAnnouncement(announcementID) })
+}
+
+// enqueueOrRun queues a task for the record unless one is already queued.
+// When the queue can't be reached the work runs in this process instead.
+func enqueueOrRun(taskType string, id uint, fallback func()) {
+	if _, err := queue.EnqueueUnique(taskType, strconv.FormatUint(uint64(id), 10), idPayload{ID: id}); err != nil {
+		log.Printf("⚠️ Could not queue %s %d, running it here: %v", taskType, id, err)
+		Go(fallback)
+	}
+}
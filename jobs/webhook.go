@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/queue"
+	"aquahome/utils"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookRetryDelays is how long to wait after each failed attempt; a
+// delivery is given up once they run out
+var webhookRetryDelays = []time.Duration{
+	time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+}
+
+// webhookLease is how long a worker holds a delivery while sending it
+const webhookLease = 2 * time.Minute
+
+// webhookBatchSize is how many due deliveries one run sends
+const webhookBatchSize = 100
+
+// DeliverWebhooks hands webhook deliveries that are due, new ones and
+// failed ones whose retry time has come, to the job queue so they are sent
+// in parallel. When the queue can't be reached they are sent here.
+func DeliverWebhooks() error {
+	var ids []uint
+	if err := database.DB.Model(&database.WebhookDelivery{}).
+		Where("status = ? AND next_attempt_at <= ?", database.WebhookDeliveryPending, time.Now()).
+		Order("next_attempt_at").Limit(webhookBatchSize).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		_, err := queue.EnqueueUnique(TaskWebhookDelivery, strconv.FormatUint(uint64(id), 10), idPayload{ID: id})
+		if err == nil {
+			continue
+		}
+		if err := DeliverWebhook(id); err != nil {
+			log.Printf("Webhook delivery %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// DeliverWebhook makes one attempt at sending a pending delivery. A delivery
+// another worker is sending is left alone.
+func DeliverWebhook(deliveryID uint) error {
+	now := time.Now()
+	claim := database.DB.Model(&database.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", deliveryID, database.WebhookDeliveryPending, now).
+		Update("next_attempt_at", now.Add(webhookLease))
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+
+	var delivery database.WebhookDelivery
+	if err := database.DB.First(&delivery, deliveryID).Error; err != nil {
+		return err
+	}
+	// A deleted endpoint is treated as disabled, so the delivery is given up
+	var endpoint database.WebhookEndpoint
+	if err := database.DB.First(&endpoint, delivery.EndpointID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	statusCode, sendErr := sendWebhook(endpoint, delivery)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	switch {
+	case sendErr == nil:
+		delivery.Status = database.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts > len(webhookRetryDelays) || !endpoint.IsActive:
+		delivery.Status = database.WebhookDeliveryFailed
+		delivery.LastError = sendErr.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		delivery.LastError = sendErr.Error()
+		next := now.Add(webhookRetryDelays[delivery.Attempts-1])
+		delivery.NextAttemptAt = &next
+	}
+	return database.DB.Save(&delivery).Error
+}
+
+// sendWebhook posts a delivery's payload to its endpoint, signed with the
+// endpoint's secret. Any 2xx answer counts as delivered.
+func sendWebhook(endpoint database.WebhookEndpoint, delivery database.WebhookDelivery) (int, error) {
+	if !endpoint.IsActive {
+		return 0, fmt.Errorf("endpoint %d is disabled or deleted", delivery.EndpointID)
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AquaHome-Webhooks/1.0")
+	req.Header.Set("X-AquaHome-Event", delivery.Event)
+	req.Header.Set("X-AquaHome-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-AquaHome-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-AquaHome-Signature", "sha256="+utils.SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,89 @@
+package ledger
+
+import (
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// BackfillResult counts the records Backfill went through, by kind
+type BackfillResult struct {
+	Payments           int `json:"payments"`
+	Refunds            int `json:"refunds"`
+	LateFees           int `json:"late_fees"`
+	DepositSettlements int `json:"deposit_settlements"`
+	Settlements        int `json:"settlements"`
+}
+
+// Backfill posts the journals for money that moved before the ledger
+// existed. Journals already posted are skipped, so it can be run again.
+func Backfill(db *gorm.DB) (BackfillResult, error) {
+	var result BackfillResult
+
+	var payments []database.Payment
+	err := db.Where("status IN ?", []string{database.PaymentStatusSuccess, database.PaymentStatusPaid, database.PaymentStatusRefunded}).
+		FindInBatches(&payments, 200, func(_ *gorm.DB, _ int) error {
+			for _, payment := range payments {
+				post := PostPayment
+				if payment.Status == database.PaymentStatusRefunded {
+					post = PostRefund
+					result.Refunds++
+				}
+				if err := db.Transaction(func(tx *gorm.DB) error { return post(tx, payment) }); err != nil {
+					return err
+				}
+				result.Payments++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return result, err
+	}
+
+	var lateFees []struct {
+		database.DunningEvent
+		CustomerID uint
+	}
+	if err := db.Model(&database.DunningEvent{}).
+		Select("dunning_events.*, subscriptions.customer_id").
+		Joins("JOIN subscriptions ON subscriptions.id = dunning_events.subscription_id").
+		Where("dunning_events.stage = ? AND dunning_events.amount > 0", database.DunningStageLateFee).
+		Scan(&lateFees).Error; err != nil {
+		return result, err
+	}
+	for _, fee := range lateFees {
+		if err := db.Transaction(func(tx *gorm.DB) error { return PostLateFee(tx, fee.DunningEvent, fee.CustomerID) }); err != nil {
+			return result, err
+		}
+		result.LateFees++
+	}
+
+	var deposits []database.DepositSettlement
+	if err := db.Where("status IN ?", []string{database.DepositStatusRefunded, database.DepositStatusCredited, database.DepositStatusClosed}).
+		Find(&deposits).Error; err != nil {
+		return result, err
+	}
+	for _, deposit := range deposits {
+		if err := db.Transaction(func(tx *gorm.DB) error { return PostDepositSettlement(tx, deposit) }); err != nil {
+			return result, err
+		}
+		result.DepositSettlements++
+	}
+
+	var settlements []database.Settlement
+	if err := db.Where("status <> ?", database.SettlementStatusPending).Find(&settlements).Error; err != nil {
+		return result, err
+	}
+	for _, settlement := range settlements {
+		post := PostSettlementApproved
+		if settlement.Status == database.SettlementStatusPaid {
+			post = PostSettlementPaid
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error { return post(tx, settlement) }); err != nil {
+			return result, err
+		}
+		result.Settlements++
+	}
+
+	return result, nil
+}
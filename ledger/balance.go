@@ -0,0 +1,53 @@
+package ledger
+
+import (
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// AccountBalance is an account with its totals. Balance is on the account's
+// normal side: debits less credits for assets and expenses, credits less
+// debits for liabilities and revenue.
+type AccountBalance struct {
+	database.LedgerAccount
+	Debits  float64 `json:"debits"`
+	Credits float64 `json:"credits"`
+	Balance float64 `json:"balance"`
+}
+
+// Balances returns the accounts matching the scope, e.g. one customer's,
+// with their totals
+func Balances(db *gorm.DB, scope func(*gorm.DB) *gorm.DB) ([]AccountBalance, error) {
+	var balances []AccountBalance
+	err := db.Model(&database.LedgerAccount{}).
+		Scopes(scope).
+		Select("ledger_accounts.*, COALESCE(SUM(ledger_entries.debit), 0) AS debits, COALESCE(SUM(ledger_entries.credit), 0) AS credits").
+		Joins("LEFT JOIN ledger_entries ON ledger_entries.account_id = ledger_accounts.id").
+		Group("ledger_accounts.id").
+		Order("ledger_accounts.code").
+		Scan(&balances).Error
+	for i := range balances {
+		b := &balances[i]
+		b.Debits = roundPaise(b.Debits)
+		b.Credits = roundPaise(b.Credits)
+		b.Balance = b.Debits - b.Credits
+		if b.Type == database.LedgerAccountLiability || b.Type == database.LedgerAccountRevenue {
+			b.Balance = -b.Balance
+		}
+		b.Balance = roundPaise(b.Balance)
+	}
+	return balances, err
+}
+
+// OwnedBy scopes accounts to a customer's or franchise's
+func OwnedBy(ownerType string, ownerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("ledger_accounts.owner_type = ? AND ledger_accounts.owner_id = ?", ownerType, ownerID)
+	}
+}
+
+// AllAccounts does not scope accounts, for the trial balance
+func AllAccounts(db *gorm.DB) *gorm.DB {
+	return db
+}
@@ -0,0 +1,224 @@
+// Package ledger keeps the double-entry books. Every movement of money
+// (payments, refunds, deposits, late fees and franchise commission) is
+// posted as a journal whose debits equal its credits, so customer and
+// franchise balances can be audited from the entries alone.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aquahome/database"
+)
+
+// ErrUnbalanced is returned when a journal's debits and credits differ
+var ErrUnbalanced = errors.New("journal does not balance")
+
+// Account identifies a ledger account; it is created the first time an
+// entry is posted to it
+type Account struct {
+	Code      string
+	Name      string
+	Type      string
+	OwnerType string
+	OwnerID   uint
+}
+
+// Platform accounts
+var (
+	Cash              = Account{Code: "cash", Name: "Cash and gateway receipts", Type: database.LedgerAccountAsset}
+	RentalRevenue     = Account{Code: "revenue:rental", Name: "Rent and installation income", Type: database.LedgerAccountRevenue}
+	LateFeeRevenue    = Account{Code: "revenue:late_fees", Name: "Late fees", Type: database.LedgerAccountRevenue}
+	DeductionRevenue  = Account{Code: "revenue:deposit_deductions", Name: "Deposit deductions", Type: database.LedgerAccountRevenue}
+	GSTPayable        = Account{Code: "liability:gst", Name: "GST payable", Type: database.LedgerAccountLiability}
+	CommissionExpense = Account{Code: "expense:franchise_commission", Name: "Franchise commission", Type: database.LedgerAccountExpense}
+	CreditNotesIssued = Account{Code: "expense:credit_notes", Name: "Credit notes issued", Type: database.LedgerAccountExpense}
+	Chargebacks       = Account{Code: "expense:chargebacks", Name: "Chargebacks", Type: database.LedgerAccountExpense}
+)
+
+// Owners of customer and franchise accounts
+const (
+	OwnerCustomer  = "customer"
+	OwnerFranchise = "franchise"
+)
+
+// CustomerReceivable is what a customer owes, such as unpaid late fees
+func CustomerReceivable(customerID uint) Account {
+	return Account{
+		Code: fmt.Sprintf("customer:%d", customerID), Name: fmt.Sprintf("Customer %d receivable", customerID),
+		Type: database.LedgerAccountAsset, OwnerType: OwnerCustomer, OwnerID: customerID,
+	}
+}
+
+// CustomerDeposit is the security deposit held for a customer
+func CustomerDeposit(customerID uint) Account {
+	return Account{
+		Code: fmt.Sprintf("customer:%d:deposit", customerID), Name: fmt.Sprintf("Customer %d security deposit", customerID),
+		Type: database.LedgerAccountLiability, OwnerType: OwnerCustomer, OwnerID: customerID,
+	}
+}
+
+// CustomerWallet is credit held in a customer's wallet
+func CustomerWallet(customerID uint) Account {
+	return Account{
+		Code: fmt.Sprintf("customer:%d:wallet", customerID), Name: fmt.Sprintf("Customer %d wallet", customerID),
+		Type: database.LedgerAccountLiability, OwnerType: OwnerCustomer, OwnerID: customerID,
+	}
+}
+
+// CustomerCredit is credit notes issued to a customer and not yet taken off
+// a bill
+func CustomerCredit(customerID uint) Account {
+	return Account{
+		Code: fmt.Sprintf("customer:%d:credit", customerID), Name: fmt.Sprintf("Customer %d credit notes", customerID),
+		Type: database.LedgerAccountLiability, OwnerType: OwnerCustomer, OwnerID: customerID,
+	}
+}
+
+// FranchisePayable is commission owed to a franchise
+func FranchisePayable(franchiseID uint) Account {
+	return Account{
+		Code: fmt.Sprintf("franchise:%d", franchiseID), Name: fmt.Sprintf("Franchise %d commission payable", franchiseID),
+		Type: database.LedgerAccountLiability, OwnerType: OwnerFranchise, OwnerID: franchiseID,
+	}
+}
+
+// Line is one side of a journal. A negative amount is posted to the
+// other side.
+type Line struct {
+	Account Account
+	Debit   float64
+	Credit  float64
+}
+
+// Debit is a debit line
+func Debit(account Account, amount float64) Line { return Line{Account: account, Debit: amount} }
+
+// Credit is a credit line
+func Credit(account Account, amount float64) Line { return Line{Account: account, Credit: amount} }
+
+// Journal is a set of lines that must balance. SourceType, SourceID and
+// Kind name it ("payment", 12, "received"); a journal is posted only once,
+// so posting again, e.g. on a webhook retry, does nothing.
+type Journal struct {
+	SourceType string
+	SourceID   uint
+	Kind       string
+	Memo       string
+	At         time.Time // defaults to now
+	Lines      []Line
+}
+
+func (j Journal) key() string {
+	return fmt.Sprintf("%s:%d:%s", j.SourceType, j.SourceID, j.Kind)
+}
+
+func roundPaise(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Post records the journal in tx. It returns ErrUnbalanced, and posts
+// nothing, when the debits and credits differ.
+func Post(tx *gorm.DB, j Journal) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	key := j.key()
+
+	var lines []Line
+	var debits, credits float64
+	for _, l := range j.Lines {
+		amount := roundPaise(l.Debit - l.Credit)
+		switch {
+		case amount > 0:
+			lines = append(lines, Line{Account: l.Account, Debit: amount})
+		case amount < 0:
+			lines = append(lines, Line{Account: l.Account, Credit: -amount})
+		default:
+			continue
+		}
+		debits += math.Max(amount, 0)
+		credits += math.Max(-amount, 0)
+	}
+	if math.Abs(debits-credits) >= 0.005 {
+		return fmt.Errorf("%w: %s debits %.2f, credits %.2f", ErrUnbalanced, key, debits, credits)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var posted int64
+	if err := db.Model(&database.LedgerEntry{}).Where("journal = ?", key).Count(&posted).Error; err != nil {
+		return err
+	}
+	if posted > 0 {
+		return nil
+	}
+
+	at := j.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	entries := make([]database.LedgerEntry, 0, len(lines))
+	for i, l := range lines {
+		account, err := ensureAccount(db, l.Account)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, database.LedgerEntry{
+			Journal:    key,
+			Line:       i + 1,
+			AccountID:  account.ID,
+			Debit:      l.Debit,
+			Credit:     l.Credit,
+			Memo:       j.Memo,
+			SourceType: j.SourceType,
+			SourceID:   j.SourceID,
+			CreatedAt:  at,
+		})
+	}
+	return db.Create(&entries).Error
+}
+
+// Reverse posts the opposite of an earlier journal of the same source, e.g.
+// a refund undoing a payment. It does nothing if that journal was never
+// posted.
+func Reverse(tx *gorm.DB, sourceType string, sourceID uint, kind, reversalKind, memo string) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	original := Journal{SourceType: sourceType, SourceID: sourceID, Kind: kind}
+
+	var entries []database.LedgerEntry
+	if err := db.Preload("Account").Where("journal = ?", original.key()).Order("line").Find(&entries).Error; err != nil {
+		return err
+	}
+	reversal := Journal{SourceType: sourceType, SourceID: sourceID, Kind: reversalKind, Memo: memo}
+	for _, e := range entries {
+		account := Account{Code: e.Account.Code, Name: e.Account.Name, Type: e.Account.Type, OwnerType: e.Account.OwnerType}
+		if e.Account.OwnerID != nil {
+			account.OwnerID = *e.Account.OwnerID
+		}
+		reversal.Lines = append(reversal.Lines, Line{Account: account, Debit: e.Credit, Credit: e.Debit})
+	}
+	return Post(tx, reversal)
+}
+
+// ensureAccount returns the account with the code, creating it if needed
+func ensureAccount(db *gorm.DB, a Account) (database.LedgerAccount, error) {
+	account := database.LedgerAccount{Code: a.Code, Name: a.Name, Type: a.Type, OwnerType: a.OwnerType}
+	if a.OwnerID != 0 {
+		ownerID := a.OwnerID
+		account.OwnerID = &ownerID
+	}
+	if err := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "code"}}, DoNothing: true}).
+		Create(&account).Error; err != nil {
+		return account, err
+	}
+	if account.ID != 0 {
+		return account, nil
+	}
+	err := db.Where("code = ?", a.Code).First(&account).Error
+	return account, err
+}
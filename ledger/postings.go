@@ -0,0 +1,207 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/events"
+)
+
+func init() {
+	// Every way a payment can succeed publishes one of these
+	events.Subscribe(events.PaymentReceived, postPaymentEvent)
+	events.Subscribe(events.PaymentAutoDebited, postPaymentEvent)
+}
+
+// postPaymentEvent books the payment an event was published for
+func postPaymentEvent(tx *gorm.DB, e events.Event) error {
+	data, _ := e.Data.(map[string]interface{})
+	paymentID, ok := data["id"].(uint)
+	if !ok {
+		return fmt.Errorf("%s event for %s %d carries no payment", e.Name, e.EntityType, e.EntityID)
+	}
+	var payment database.Payment
+	if err := tx.Session(&gorm.Session{NewDB: true}).First(&payment, paymentID).Error; err != nil {
+		return err
+	}
+	return PostPayment(tx, payment)
+}
+
+// PostPayment books money received from a customer. The tax is owed to the
+// government; the security deposit in an initial payment is held for the
+// customer; rent paid with a late fee settles the fee the customer was
+// charged; credit notes taken off the bill are used up. The rest is income.
+func PostPayment(tx *gorm.DB, payment database.Payment) error {
+	db := tx.Session(&gorm.Session{NewDB: true})
+	var lateFee, deposit float64
+	switch {
+	case payment.PaymentType == "initial" && payment.OrderID != nil:
+		var order database.Order
+		if err := db.Select("id, security_deposit").First(&order, *payment.OrderID).Error; err != nil {
+			return err
+		}
+		deposit = math.Min(order.SecurityDeposit, payment.TaxableAmount)
+	// Mandates charge the rent alone
+	case payment.PaymentType == "monthly" && payment.SubscriptionID != nil && payment.PaymentMethod != "razorpay_autopay":
+		var subscription database.Subscription
+		if err := db.Select("id, monthly_rent").First(&subscription, *payment.SubscriptionID).Error; err != nil {
+			return err
+		}
+		lateFee = math.Max(roundPaise(payment.TaxableAmount+payment.CreditApplied-subscription.MonthlyRent), 0)
+	}
+
+	return Post(tx, Journal{
+		SourceType: "payment",
+		SourceID:   payment.ID,
+		Kind:       "received",
+		Memo:       paymentMemo("Payment", payment),
+		At:         payment.UpdatedAt,
+		Lines: []Line{
+			Debit(Cash, payment.Amount),
+			Debit(CustomerCredit(payment.CustomerID), payment.CreditApplied),
+			Credit(GSTPayable, payment.TaxAmount),
+			Credit(RentalRevenue, payment.Amount+payment.CreditApplied-payment.TaxAmount-lateFee-deposit),
+			Credit(CustomerReceivable(payment.CustomerID), lateFee),
+			Credit(CustomerDeposit(payment.CustomerID), deposit),
+		},
+	})
+}
+
+// PostRefund books a payment returned in full, reversing its receipt
+func PostRefund(tx *gorm.DB, payment database.Payment) error {
+	if err := PostPayment(tx, payment); err != nil {
+		return err
+	}
+	return Reverse(tx, "payment", payment.ID, "received", "refunded", paymentMemo("Refund of payment", payment))
+}
+
+func paymentMemo(prefix string, payment database.Payment) string {
+	if payment.InvoiceNumber != "" {
+		return fmt.Sprintf("%s %d (%s)", prefix, payment.ID, payment.InvoiceNumber)
+	}
+	return fmt.Sprintf("%s %d", prefix, payment.ID)
+}
+
+// PostLateFee books a late fee charged on overdue rent; the customer owes it
+// until they pay it with their rent
+func PostLateFee(tx *gorm.DB, event database.DunningEvent, customerID uint) error {
+	return Post(tx, Journal{
+		SourceType: "dunning_event",
+		SourceID:   event.ID,
+		Kind:       "late_fee",
+		Memo:       fmt.Sprintf("Late fee on subscription %d rent due %s", event.SubscriptionID, event.BillingDate.Format("2006-01-02")),
+		At:         event.CreatedAt,
+		Lines: []Line{
+			Debit(CustomerReceivable(customerID), event.Amount),
+			Credit(LateFeeRevenue, event.Amount),
+		},
+	})
+}
+
+// PostCreditNote books a credit note issued to a customer; it is owed to
+// them until taken off a bill
+func PostCreditNote(tx *gorm.DB, note database.CreditNote) error {
+	return Post(tx, Journal{
+		SourceType: "credit_note",
+		SourceID:   note.ID,
+		Kind:       "issued",
+		Memo:       fmt.Sprintf("Credit note %s: %s", note.Number, note.Reason),
+		At:         note.CreatedAt,
+		Lines: []Line{
+			Debit(CreditNotesIssued, note.Amount),
+			Credit(CustomerCredit(note.CustomerID), note.Amount),
+		},
+	})
+}
+
+// PostCreditNoteVoided reverses a credit note withdrawn before it was used
+func PostCreditNoteVoided(tx *gorm.DB, note database.CreditNote) error {
+	if err := PostCreditNote(tx, note); err != nil {
+		return err
+	}
+	return Reverse(tx, "credit_note", note.ID, "issued", "voided", fmt.Sprintf("Credit note %s voided", note.Number))
+}
+
+// PostDisputeDeducted books money Razorpay took back for a disputed payment
+func PostDisputeDeducted(tx *gorm.DB, dispute database.Dispute) error {
+	return Post(tx, Journal{
+		SourceType: "dispute",
+		SourceID:   dispute.ID,
+		Kind:       "deducted",
+		Memo:       fmt.Sprintf("Dispute %s on %s", dispute.RazorpayDisputeID, dispute.RazorpayPaymentID),
+		Lines: []Line{
+			Debit(Chargebacks, dispute.AmountDeducted),
+			Credit(Cash, dispute.AmountDeducted),
+		},
+	})
+}
+
+// PostDisputeWon returns money taken for a dispute that was decided for us
+func PostDisputeWon(tx *gorm.DB, dispute database.Dispute) error {
+	return Reverse(tx, "dispute", dispute.ID, "deducted", "won", fmt.Sprintf("Dispute %s won", dispute.RazorpayDisputeID))
+}
+
+// PostDepositSettlement books a security deposit returned when a rental
+// ends: refunded to the customer's card, credited to their wallet, and the
+// rest withheld for damage
+func PostDepositSettlement(tx *gorm.DB, settlement database.DepositSettlement) error {
+	refundTo := Cash
+	if settlement.RefundMethod == database.RefundMethodWallet {
+		refundTo = CustomerWallet(settlement.CustomerID)
+	}
+	return Post(tx, Journal{
+		SourceType: "deposit_settlement",
+		SourceID:   settlement.ID,
+		Kind:       "settled",
+		Memo:       fmt.Sprintf("Deposit settlement %d for subscription %d", settlement.ID, settlement.SubscriptionID),
+		At:         settlement.UpdatedAt,
+		Lines: []Line{
+			Debit(CustomerDeposit(settlement.CustomerID), settlement.DepositAmount),
+			Credit(refundTo, settlement.RefundAmount),
+			Credit(DeductionRevenue, settlement.DepositAmount-settlement.RefundAmount),
+		},
+	})
+}
+
+// PostSettlementApproved books a franchise's commission for a period once
+// the statement is approved
+func PostSettlementApproved(tx *gorm.DB, settlement database.Settlement) error {
+	return Post(tx, Journal{
+		SourceType: "settlement",
+		SourceID:   settlement.ID,
+		Kind:       "accrued",
+		Memo:       fmt.Sprintf("Commission for %s", settlement.PeriodStart.Format("January 2006")),
+		Lines: []Line{
+			Debit(CommissionExpense, settlement.FranchiseShare),
+			Credit(FranchisePayable(settlement.FranchiseID), settlement.FranchiseShare),
+		},
+	})
+}
+
+// PostSettlementPaid books commission paid out to a franchise. Each payout
+// attempt is its own journal so a reversed payout can be paid again.
+func PostSettlementPaid(tx *gorm.DB, settlement database.Settlement) error {
+	// A statement can be marked paid straight from pending
+	if err := PostSettlementApproved(tx, settlement); err != nil {
+		return err
+	}
+	return Post(tx, Journal{
+		SourceType: "settlement",
+		SourceID:   settlement.ID,
+		Kind:       fmt.Sprintf("paid:%d", settlement.PayoutAttempts),
+		Memo:       fmt.Sprintf("Commission payout for %s %s", settlement.PeriodStart.Format("January 2006"), settlement.PaymentReference),
+		Lines: []Line{
+			Debit(FranchisePayable(settlement.FranchiseID), settlement.FranchiseShare),
+			Credit(Cash, settlement.FranchiseShare),
+		},
+	})
+}
+
+// PostSettlementPayoutReversed undoes a payout the bank sent back
+func PostSettlementPayoutReversed(tx *gorm.DB, settlement database.Settlement) error {
+	return Reverse(tx, "settlement", settlement.ID, fmt.Sprintf("paid:%d", settlement.PayoutAttempts),
+		fmt.Sprintf("reversed:%d", settlement.PayoutAttempts), "Commission payout reversed")
+}
@@ -1,22 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"net/http"
 	"os" // Import os for directory checks
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"aquahome/cache"
 	"aquahome/config"
-	"aquahome/controllers" // Add controllers to directly define a public route
 	"aquahome/database"
+	"aquahome/errorreport"
+	"aquahome/jobs"
+	"aquahome/middleware"
+	"aquahome/queue"
 	"aquahome/routes" // Keep this for existing route setup
+	"aquahome/tracing"
 )
 
 func main() {
-	_ = godotenv.Load()
-	config.InitConfig()
+	config.LoadEnvFiles()
+	if err := config.InitConfig(); err != nil {
+		log.Fatalf("❌ Invalid configuration (%s profile):\n%v", config.Profile(), err)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	flushErrorReports, err := errorreport.Init()
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize error reporting: %v", err)
+	}
+	defer flushErrorReports()
+
+	if err := cache.Init(); err != nil {
+		log.Fatalf("❌ Failed to connect to Redis: %v", err)
+	}
+	if err := queue.Init(); err != nil {
+		log.Fatalf("❌ Failed to connect to the Redis job queue: %v", err)
+	}
 
 	if err := database.InitDB(); err != nil {
 		log.Fatalf("❌ Failed to initialize GORM database: %v", err)
@@ -25,6 +60,7 @@ func main() {
 	if err := database.DB.AutoMigrate(
 		&database.User{},
 		&database.Franchise{},
+		&database.Tenant{},
 		&database.Order{},
 		&database.Subscription{},
 		&database.ServiceRequest{},
@@ -32,45 +68,151 @@ func main() {
 		&database.Notification{},
 		&database.Location{},
 		&database.FranchiseLocation{},
+		&database.Mandate{},
+		&database.FranchiseWorkingHours{},
+		&database.Role{},
+		&database.Permission{},
+		&database.Session{},
+		&database.PhoneOTP{},
+		&database.PasswordResetToken{},
+		&database.EmailVerificationToken{},
+		&database.AuditLog{},
+		&database.DataExport{},
+		&database.AccountDeletion{},
+		&database.ProductVariant{},
+		&database.RentalPlan{},
+		&database.ProductImage{},
+		&database.InventoryItem{},
+		&database.StockMovement{},
+		&database.Coupon{},
+		&database.CouponRedemption{},
+		&database.DepositSettlement{},
+		&database.DepositDeduction{},
+		&database.WalletTransaction{},
+		&database.DunningEvent{},
+		&database.OrderStatusHistory{},
+		&database.InstallationOTP{},
+		&database.InstallationReport{},
+		&database.InstallationPhoto{},
+		&database.ServiceReport{},
+		&database.ServiceReportPart{},
+		&database.ServiceReportPhoto{},
+		&database.FranchiseTerritory{},
+		&database.Settlement{},
+		&database.FranchiseBankAccount{},
+		&database.SettlementPayout{},
+		&database.Address{},
+		&database.NotificationTemplate{},
+		&database.Announcement{},
+		&database.ServiceAssignmentResponse{},
+		&database.ServiceRequestAttachment{},
+		&database.TwoFactorBackupCode{},
+		&database.SecurityPolicy{},
+		&database.MaintenanceMode{},
+		&database.Alert{},
+		&database.Lead{},
+		&database.AppointmentReminder{},
+		&database.PaymentVerificationFailure{},
+		&database.APIKey{},
+		&database.WebhookEndpoint{},
+		&database.WebhookDelivery{},
+		&database.OutboxEvent{},
+		&database.NotificationDelivery{},
+		&database.DirectUpload{},
+		&database.ArchivedRecord{},
+		&database.PushDevice{},
+		&database.RentalAgreement{},
+		&database.CashDeposit{},
+		&database.PaymentLink{},
+		&database.LedgerAccount{},
+		&database.LedgerEntry{},
+		&database.CreditNote{},
+		&database.Dispute{},
+		&database.DisputeEvidence{},
+		&database.BlacklistEntry{},
+		&database.RiskOverride{},
+		&database.FranchiseMember{},
+		&database.AgentShift{},
+		&database.AgentLeave{},
+		&database.InvoiceDocument{},
 	); err != nil {
 		log.Fatalf("❌ AutoMigrate failed: %v", err)
 	}
+	database.EnsureSearchIndexes()
+	if err := database.EnsureIndexes(); err != nil {
+		log.Fatalf("❌ Index migration failed: %v", err)
+	}
+	database.EnsureDefaultTenant()
+	database.BackfillTenants()
 
 	log.Println("✅ Database migration skipped (commented out in main.go)")
 	database.SeedDefaultAdmin()
+	database.SeedRBAC()
+
+	// `seed --profile=demo` loads sample data and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		seedCmd := flag.NewFlagSet("seed", flag.ExitOnError)
+		profile := seedCmd.String("profile", "demo", "data set to load: "+strings.Join(database.SeedProfiles(), ", "))
+		_ = seedCmd.Parse(os.Args[2:])
+		if err := database.Seed(*profile); err != nil {
+			log.Fatalf("❌ Seeding failed: %v", err)
+		}
+		return
+	}
+
+	// Start background workers
+	jobs.Start()
 
 	r := gin.Default()
+	// Without trusted proxies a client could pick its own IP with
+	// X-Forwarded-For and slip past the per-IP rate limits
+	if err := r.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.RequestIDHeader, middleware.TenantHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 	}))
+	r.Use(middleware.RequestID())
+	r.Use(otelgin.Middleware(config.AppConfig.ServiceName))
+	r.Use(middleware.Metrics())
+	r.Use(middleware.ErrorReporting())
+	if config.AppConfig.CompressionEnabled {
+		r.Use(middleware.Compress(middleware.CompressionConfig{
+			MinBytes:     config.AppConfig.CompressionMinBytes,
+			Level:        config.AppConfig.CompressionLevel,
+			ContentTypes: config.AppConfig.CompressionContentTypes,
+		}))
+	}
+	r.Use(middleware.ErrorHandler())
+	r.Use(middleware.RequestTimeout(
+		time.Duration(config.AppConfig.RequestTimeoutSeconds)*time.Second,
+		time.Duration(config.AppConfig.LongRequestTimeoutSeconds)*time.Second,
+		"/admin/export/", "/users/me/export/",
+	))
 
 	// 🆕 START: ADD THESE LINES FOR STATIC FILE SERVING
-	// This makes files in ./uploads accessible via /uploads/*
-	r.Static("/uploads", "./uploads")
-	log.Println("Serving static files from /uploads to ./uploads directory")
+	// This makes files in the upload directory accessible via /uploads/*
+	uploadDir := config.AppConfig.UploadDir
+	r.Static("/uploads", uploadDir)
+	log.Printf("Serving static files from /uploads to %s directory", uploadDir)
 
 	// Ensure the 'uploads/products' directory exists
 	// This will prevent errors if the directory is missing when saving files.
-	if _, err := os.Stat("./uploads/products"); os.IsNotExist(err) {
-		err := os.MkdirAll("./uploads/products", 0755) // 0755 permissions
+	productDir := filepath.Join(uploadDir, "products")
+	if _, err := os.Stat(productDir); os.IsNotExist(err) {
+		err := os.MkdirAll(productDir, 0755) // 0755 permissions
 		if err != nil {
-			log.Fatalf("Failed to create uploads/products directory: %v", err)
+			log.Fatalf("Failed to create %s directory: %v", productDir, err)
 		}
-		log.Println("Created ./uploads/products directory")
+		log.Printf("Created %s directory", productDir)
 	}
 	// 🆕 END: ADD THESE LINES FOR STATIC FILE SERVING
 
-	// 🆕 START: Public routes that do NOT require authentication
-	// Move GetCustomerProducts here if it should be accessible without logging in
-	// If it *requires* a logged-in customer, keep it within an authenticated group (not admin-specific)
-	r.GET("/api/products", controllers.GetCustomerProducts) //
-	// 🆕 END: Public routes
-
 	// Setup all other API routes using your existing routes.SetupRoutes function
 	routes.SetupRoutes(r) //
 
@@ -78,13 +220,51 @@ func main() {
 		log.Printf("🔗 %s %s", route.Method, route.Path)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5000"
+	port := config.AppConfig.Port
+	srv := &http.Server{
+		Addr:              "0.0.0.0:" + port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
-	log.Printf("🚀 Server running at http://0.0.0.0:%s", port)
 
-	if err := r.Run("0.0.0.0:" + port); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("🚀 Server running at http://0.0.0.0:%s", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then let in-flight requests and jobs finish so
+	// a payment isn't cut off halfway through
+	stop, cancelSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancelSignals()
+	select {
+	case err := <-serverErr:
 		log.Fatalf("❌ Server failed: %v", err)
+	case <-stop.Done():
+	}
+	cancelSignals()
+
+	timeout := time.Duration(config.AppConfig.ShutdownTimeoutSeconds) * time.Second
+	log.Printf("🛑 Shutting down, waiting up to %s for in-flight requests...", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Requests still running at shutdown were cut off: %v", err)
+	}
+	if err := jobs.Stop(ctx); err != nil {
+		log.Printf("⚠️ Background jobs still running at shutdown were cut off: %v", err)
+	}
+	if err := database.CloseDB(); err != nil {
+		log.Printf("⚠️ Failed to close the database: %v", err)
+	}
+	if err := cache.Close(); err != nil {
+		log.Printf("⚠️ Failed to close the cache: %v", err)
+	}
+	if err := queue.Close(); err != nil {
+		log.Printf("⚠️ Failed to close the job queue: %v", err)
 	}
+	log.Println("👋 Server stopped")
 }
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startedAtKey = "metrics:started_at"
+
+// InstrumentGORM times every query run through db
+func InstrumentGORM(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, hook := range hooks {
+		operation := hook.operation
+		if err := hook.before("metrics:before_"+operation, startTimer); err != nil {
+			return err
+		}
+		if err := hook.after("metrics:after_"+operation, func(db *gorm.DB) {
+			observeQuery(db, operation)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(startedAtKey, time.Now())
+}
+
+func observeQuery(db *gorm.DB, operation string) {
+	value, ok := db.InstanceGet(startedAtKey)
+	if !ok {
+		return
+	}
+	start, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+
+	table := db.Statement.Table
+	if table == "" {
+		table = "unknown"
+	}
+	DBQueryDuration.ObserveSince(start, operation, table)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		DBQueryErrors.Inc(operation, table)
+	}
+}
@@ -0,0 +1,254 @@
+// Package metrics keeps in-process counters and histograms and exposes them in
+// the Prometheus text format.
+package metrics
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/breaker"
+	"aquahome/config"
+)
+
+// DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Application metrics
+var (
+	HTTPRequests = NewCounterVec("http_requests_total",
+		"HTTP requests handled, by method, route and status code.", "method", "route", "status")
+	HTTPDuration = NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency, by method and route.", DefaultBuckets, "method", "route")
+	DBQueryDuration = NewHistogramVec("db_query_duration_seconds",
+		"Database query latency, by operation and table.", DefaultBuckets, "operation", "table")
+	DBQueryErrors = NewCounterVec("db_query_errors_total",
+		"Database queries that failed, by operation and table.", "operation", "table")
+	RazorpayCalls = NewCounterVec("razorpay_calls_total",
+		"Razorpay API calls and signature checks, by operation and result.", "operation", "result")
+)
+
+// collector is a metric family that can write itself out
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter for the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter for the given label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := labelKey(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braces(key), formatFloat(c.values[key]))
+	}
+}
+
+// histogram holds the observations of one label set
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+// NewHistogramVec creates and registers a histogram with the given upper bounds
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogram{}}
+	register(h)
+	return h
+}
+
+// Observe records a value for the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+			break
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+// ObserveSince records the time elapsed since start in seconds
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, braces(joinLabels(key, `le="`+formatFloat(upper)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, braces(joinLabels(key, `le="+Inf"`)), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braces(key), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braces(key), hist.count)
+	}
+}
+
+// ObserveRazorpay counts a Razorpay call as a success or failure
+func ObserveRazorpay(operation string, err error) {
+	result := "success"
+	if errors.Is(err, breaker.ErrOpen) {
+		result = "rejected"
+	} else if err != nil {
+		result = "failure"
+	}
+	RazorpayCalls.Inc(operation, result)
+}
+
+// Handler serves all registered metrics in the Prometheus text format
+func Handler(c *gin.Context) {
+	if token := config.AppConfig.MetricsToken; token != "" &&
+		subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	WriteTo(c.Writer)
+}
+
+// WriteTo writes all registered metrics to w
+func WriteTo(w io.Writer) {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// labelKey renders label pairs as `a="x",b="y"`, which doubles as the map key
+func labelKey(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + escapeLabel(value) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func joinLabels(key, extra string) string {
+	if key == "" {
+		return extra
+	}
+	return key + "," + extra
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
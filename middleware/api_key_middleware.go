@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"aquahome/config"
+	"aquahome/database"
+	"aquahome/tenant"
+	"aquahome/utils"
+)
+
+// apiKeyLimiter counts each key's requests per minute
+var apiKeyLimiter = NewRateLimiter(0, time.Minute)
+
+// APIKeyAuthMiddleware authenticates partner systems by the X-API-Key header
+// and allows the request only when the key was granted every listed scope.
+// Each key is held to its own per-minute rate limit.
+func APIKeyAuthMiddleware(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prefix, secret, ok := strings.Cut(strings.TrimPrefix(c.GetHeader("X-API-Key"), database.APIKeyPrefix), ".")
+		if !ok || prefix == "" || secret == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "A valid X-API-Key header is required"})
+			c.Abort()
+			return
+		}
+
+		// Keys are looked up across tenants, as the key decides the tenant
+		var key database.APIKey
+		if err := database.DB.WithContext(tenant.Unscoped(c.Request.Context())).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("API key lookup failed: %v", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+		if !utils.TokensEqual(utils.HashToken(secret), key.SecretHash) || !key.IsActive() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+
+		// A key reads the data of the brand it was created for, whatever host
+		// it is sent to; an X-Tenant header naming another brand is refused
+		keyTenant, found := tenantByID(key.TenantID)
+		if !found || keyTenant.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This brand is no longer served"})
+			c.Abort()
+			return
+		}
+		if slug := strings.ToLower(strings.TrimSpace(c.GetHeader(TenantHeader))); slug != "" && slug != keyTenant.Slug {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key belongs to another tenant"})
+			c.Abort()
+			return
+		}
+		c.Set("tenant_id", key.TenantID)
+		c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), key.TenantID))
+
+		for _, scope := range scopes {
+			if !key.HasScope(scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the required scope", "missing_scope": scope})
+				c.Abort()
+				return
+			}
+		}
+
+		limit := key.RateLimitPerMinute
+		if limit <= 0 {
+			limit = config.AppConfig.APIKeyRateLimit
+		}
+		allowed, retryAfter := apiKeyLimiter.AllowUpTo(key.Prefix, limit)
+		if !allowed {
+			c.Header("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded for this API key"})
+			c.Abort()
+			return
+		}
+
+		touchAPIKey(key)
+		c.Set("api_key_id", key.ID)
+		c.Set("api_key", key)
+		c.Next()
+	}
+}
+
+// touchAPIKey records that a key was just used, at most once per
+// sessionTouchInterval
+func touchAPIKey(key database.APIKey) {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < sessionTouchInterval {
+		return
+	}
+	if err := database.DB.Model(&database.APIKey{}).Where("id = ?", key.ID).
+		Update("last_used_at", now).Error; err != nil {
+		log.Printf("Failed to update API key %d: %v", key.ID, err)
+	}
+}
@@ -28,15 +28,31 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		token := parts[1]
 		claims, err := utils.ValidateJWT(token)
-		if err != nil {
+		if err != nil || claims.Purpose != "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Tokens bound to a session stop working once the session is revoked
+		if claims.SessionID != 0 {
+			var session database.Session
+			if err := database.DB.WithContext(c.Request.Context()).First(&session, claims.SessionID).Error; err != nil || !session.IsActive() || session.UserID != claims.UserID {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"})
+				c.Abort()
+				return
+			}
+			touchSession(session)
+		}
+
+		// Impersonation tokens act as the user on behalf of an admin
+		if claims.ImpersonatorID != 0 && !authorizeImpersonation(c, claims) {
+			return
+		}
+
 		// Fetch full user object from DB
 		var user database.User
-		if err := database.DB.First(&user, claims.UserID).Error; err != nil {
+		if err := database.DB.WithContext(c.Request.Context()).First(&user, claims.UserID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
@@ -48,8 +64,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("email", user.Email)
 		c.Set("role", user.Role)
 		c.Set("user", user) // ✅ THIS LINE IS THE KEY FIX
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
+
+		if claims.ImpersonatorID != 0 {
+			recordImpersonatedRequest(c, claims)
+		}
 	}
 }
 
@@ -96,6 +117,10 @@ func AdminOrFranchiseAuthMiddleware() gin.HandlerFunc {
 	return RoleAuthMiddleware("admin", "franchise_owner","service_agent")
 }
 
+func FranchiseTeamAuthMiddleware() gin.HandlerFunc {
+	return RoleAuthMiddleware("admin", "franchise_owner", "franchise_staff")
+}
+
 func AdminOrServiceAgentAuthMiddleware() gin.HandlerFunc {
 	return RoleAuthMiddleware("admin", "service_agent")
 }
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompressionConfig sets which responses Compress compresses
+type CompressionConfig struct {
+	MinBytes     int      // smaller bodies are sent as they are
+	Level        int      // 1 (fastest) to 9 (smallest)
+	ContentTypes []string // media types worth compressing, e.g. application/json
+}
+
+// Compress gzips, or deflates, response bodies of the configured content
+// types once they reach MinBytes, for clients that send Accept-Encoding.
+// Bodies are held back until they reach MinBytes or the handler returns, so
+// small responses go out uncompressed with their Content-Length.
+func Compress(cfg CompressionConfig) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(cfg.ContentTypes))
+	for _, contentType := range cfg.ContentTypes {
+		allowed[strings.ToLower(strings.TrimSpace(contentType))] = true
+	}
+	gzipWriters := sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, cfg.Level)
+		return w
+	}}
+
+	return func(c *gin.Context) {
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &compressWriter{
+			ResponseWriter: original,
+			encoding:       encoding,
+			minBytes:       cfg.MinBytes,
+			allowed:        allowed,
+			newEncoder: func(w io.Writer) io.WriteCloser {
+				if encoding == "deflate" {
+					z, _ := zlib.NewWriterLevel(w, cfg.Level)
+					return z
+				}
+				gz := gzipWriters.Get().(*gzip.Writer)
+				gz.Reset(w)
+				return pooledGzip{gz, &gzipWriters}
+			},
+		}
+		c.Writer = writer
+		// Deferred so a panicking handler still has what it wrote sent, and
+		// Recovery writes its response past the compressor
+		defer func() {
+			writer.finish()
+			c.Writer = original
+		}()
+
+		c.Next()
+	}
+}
+
+// acceptedEncoding picks gzip, else deflate, from an Accept-Encoding header,
+// skipping codings the client refuses with q=0
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted["gzip"] || accepted["*"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// pooledGzip returns its writer to the pool once closed
+type pooledGzip struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w pooledGzip) Close() error {
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	return err
+}
+
+// compressWriter buffers the start of a body until it knows whether to
+// compress it, then either streams it through an encoder or passes it on
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding   string
+	minBytes   int
+	allowed    map[string]bool
+	newEncoder func(io.Writer) io.WriteCloser
+
+	buffered []byte
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+// compressible reports whether the response as headed so far may be compressed
+func (w *compressWriter) compressible() bool {
+	switch status := w.Status(); {
+	case status < http.StatusOK, status == http.StatusNoContent,
+		status == http.StatusPartialContent, status == http.StatusNotModified:
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && w.allowed[mediaType]
+}
+
+// decide starts compressing, or passing the body on, and writes out what was
+// buffered
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		w.encoder = w.newEncoder(w.ResponseWriter)
+	}
+	buffered := w.buffered
+	w.buffered = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	_, err := w.write(buffered)
+	return err
+}
+
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.write(data)
+	}
+	if !w.compressible() {
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+		return w.write(data)
+	}
+	w.buffered = append(w.buffered, data...)
+	if len(w.buffered) >= w.minBytes {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow sends the headers, so whether to compress is settled first
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		_ = w.decide(w.compressible())
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush sends what has been written so far, compressing it if the response
+// qualifies, for handlers that stream
+func (w *compressWriter) Flush() {
+	w.WriteHeaderNow()
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Hijack hands the connection over as it is; nothing is compressed after it
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+// finish sends a body that stayed under MinBytes as it is and closes the
+// encoder
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if len(w.buffered) == 0 {
+			return
+		}
+		_ = w.decide(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.encoder = nil
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+)
+
+// errorBodyWriter holds back the body of error responses so ErrorHandler
+// can put it in the standard envelope
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *errorBodyWriter) holding() bool {
+	return w.Status() >= 400 && !w.ResponseWriter.Written()
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.holding() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	if w.holding() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ErrorHandler responds to errors handlers record with apperror.Abort or
+// c.Error, and gives every JSON error response the standard envelope: the
+// "error" message, a machine-readable "code" and optional "details".
+// Responses written as {"error": "..."} get the code for their status.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		writer := &errorBodyWriter{ResponseWriter: original}
+		c.Writer = writer
+
+		c.Next()
+
+		if len(c.Errors) > 0 && !writer.Written() && writer.body.Len() == 0 {
+			apperror.Respond(c, c.Errors.Last().Err)
+		}
+		c.Writer = original
+		if writer.body.Len() > 0 {
+			_, _ = original.Write(withErrorCode(writer.body.Bytes(), writer.Status()))
+		}
+	}
+}
+
+// withErrorCode adds the code for status to a {"error": "..."} body. Other
+// bodies, including ones that already have a code, are left as they are.
+func withErrorCode(body []byte, status int) []byte {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	if _, isMessage := fields["error"].(string); !isMessage {
+		return body
+	}
+	if _, hasCode := fields["code"]; hasCode {
+		return body
+	}
+	fields["code"] = apperror.CodeForStatus(status)
+	enveloped, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return enveloped
+}
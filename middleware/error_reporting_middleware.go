@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"syscall"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+
+	"aquahome/apperror"
+)
+
+// ErrorReporting recovers from panics in later handlers, answering 500, and
+// reports them and 5xx responses to Sentry, tagged with the route, the
+// request ID and the signed-in user and role. Causes recorded with c.Error
+// or apperror are reported as the error; a 503 without one is a deliberate
+// refusal, such as maintenance mode, and isn't reported.
+func ErrorReporting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetRequest(c.Request)
+		c.Request = c.Request.WithContext(sentry.SetHubOnContext(c.Request.Context(), hub))
+		original := c.Writer
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			if clientGone(recovered) {
+				log.Printf("%s %s: client went away: %v", c.Request.Method, c.FullPath(), recovered)
+				c.Abort()
+				return
+			}
+
+			log.Printf("panic serving %s %s: %v\n%s", c.Request.Method, c.FullPath(), recovered, debug.Stack())
+			hub.WithScope(func(scope *sentry.Scope) {
+				tagRequest(c, scope)
+				hub.RecoverWithContext(c.Request.Context(), recovered)
+			})
+			// Middleware that wrapped the writer didn't get to unwrap it
+			c.Writer = original
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, apperror.Internal(fmt.Errorf("panic: %v", recovered)))
+		}()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < http.StatusInternalServerError {
+			return
+		}
+		cause := c.Errors.Last()
+		if cause == nil && status == http.StatusServiceUnavailable {
+			return
+		}
+		hub.WithScope(func(scope *sentry.Scope) {
+			tagRequest(c, scope)
+			scope.SetTag("status", strconv.Itoa(status))
+			scope.SetFingerprint([]string{"{{ default }}", c.Request.Method, c.FullPath()})
+			if cause != nil {
+				hub.CaptureException(cause.Err)
+				return
+			}
+			hub.CaptureMessage(fmt.Sprintf("%d %s from %s %s", status, http.StatusText(status), c.Request.Method, c.FullPath()))
+		})
+	}
+}
+
+// tagRequest adds what identifies the request and its user to a report
+func tagRequest(c *gin.Context, scope *sentry.Scope) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	scope.SetTag("route", route)
+	scope.SetTag("method", c.Request.Method)
+	if requestID := c.GetString("request_id"); requestID != "" {
+		scope.SetTag("request_id", requestID)
+	}
+	if userID := c.GetUint("user_id"); userID != 0 {
+		id := strconv.FormatUint(uint64(userID), 10)
+		scope.SetUser(sentry.User{ID: id})
+		scope.SetTag("user_id", id)
+	}
+	if role := c.GetString("role"); role != "" {
+		scope.SetTag("role", role)
+	}
+}
+
+// clientGone reports whether a panic came from writing to a client that had
+// already disconnected, which is no bug of ours
+func clientGone(recovered interface{}) bool {
+	err, ok := recovered.(error)
+	return ok && (errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET))
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+)
+
+// StaffFranchiseIDsKey holds, for franchise staff, the franchises where
+// their membership grants the feature the route needs
+const StaffFranchiseIDsKey = "staff_franchise_ids"
+
+// FranchiseFeature allows admins, franchise owners, and franchise staff
+// granted the feature on at least one franchise
+func FranchiseFeature(feature string) gin.HandlerFunc {
+	staff := StaffFeature(feature)
+	return func(c *gin.Context) {
+		switch c.GetString("role") {
+		case database.RoleAdmin, database.RoleFranchiseOwner:
+			c.Next()
+		case database.RoleFranchiseStaff:
+			staff(c)
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			c.Abort()
+		}
+	}
+}
+
+// StaffFeature stops franchise staff who weren't granted the feature and
+// lets every other role through, for routes that check roles themselves
+func StaffFeature(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != database.RoleFranchiseStaff {
+			c.Next()
+			return
+		}
+
+		ids, err := database.StaffFranchiseIDs(database.DB.WithContext(c.Request.Context()), c.GetUint("user_id"), feature)
+		if err != nil {
+			log.Printf("Franchise membership lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			c.Abort()
+			return
+		}
+		if len(ids) == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied", "missing_permission": feature})
+			c.Abort()
+			return
+		}
+
+		c.Set(StaffFranchiseIDsKey, ids)
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// authorizeImpersonation checks that the admin behind an impersonation token
+// is still an admin and marks the request as impersonated. It writes the
+// error response and returns false otherwise.
+func authorizeImpersonation(c *gin.Context, claims *utils.JWTClaims) bool {
+	var admin database.User
+	if err := database.DB.WithContext(c.Request.Context()).Select("id, role").First(&admin, claims.ImpersonatorID).Error; err != nil || admin.Role != database.RoleAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation is no longer allowed, please start a new session"})
+		c.Abort()
+		return false
+	}
+	c.Set("impersonator_id", claims.ImpersonatorID)
+	c.Header("X-Impersonated-By", fmt.Sprint(claims.ImpersonatorID))
+	return true
+}
+
+// recordImpersonatedRequest adds every request made with an impersonation
+// token to the audit log
+func recordImpersonatedRequest(c *gin.Context, claims *utils.JWTClaims) {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	impersonatorID := int64(claims.ImpersonatorID)
+	entry := database.AuditLog{
+		UserID:         int64(claims.UserID),
+		ImpersonatorID: &impersonatorID,
+		ActorRole:      claims.Role,
+		Action:         "impersonation.request",
+		EntityType:     "user",
+		EntityID:       int64(claims.UserID),
+		Description:    fmt.Sprintf("%s %s answered %d", c.Request.Method, c.FullPath(), c.Writer.Status()),
+		Changes:        "{}",
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		IP:             c.ClientIP(),
+		UserAgent:      userAgent,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&entry).Error; err != nil {
+		log.Printf("Failed to audit impersonated request %s: %v", c.Request.URL.Path, err)
+	}
+}
+
+// DenyImpersonation blocks a route for impersonation tokens: credentials,
+// payments and the account itself stay with the real user
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("impersonator_id") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not available while impersonating a user"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// DefaultMaintenanceMessage is shown when an admin turns maintenance on
+// without a message of their own
+const DefaultMaintenanceMessage = "AquaHome is down for scheduled maintenance. Please try again in a little while."
+
+// maintenanceRefresh is how long an instance trusts its copy of the
+// maintenance switch, so other instances follow a change within it
+const maintenanceRefresh = 5 * time.Second
+
+// maintenanceRetryAfter is the Retry-After sent when no end time is set
+const maintenanceRetryAfter = 5 * time.Minute
+
+// maintenanceOpenRoutes stay reachable during maintenance: signing in,
+// including the second factor, so admins can get in, and Razorpay's webhooks,
+// so payment events aren't lost. Routes are matched without their /api or
+// /api/v1 mount.
+var maintenanceOpenRoutes = map[string]bool{
+	"/auth/login":       true,
+	"/auth/login/v2":    true,
+	"/auth/refresh":     true,
+	"/auth/refresh/v2":  true,
+	"/auth/logout":      true,
+	"/auth/2fa/verify":  true,
+	"/auth/2fa/setup":   true,
+	"/auth/2fa/enable":  true,
+	"/payments/webhook": true,
+}
+
+var maintenance struct {
+	sync.Mutex
+	mode     database.MaintenanceMode
+	loadedAt time.Time
+}
+
+// SetMaintenanceMode makes this instance use mode straight away, rather than
+// after its next refresh
+func SetMaintenanceMode(mode database.MaintenanceMode) {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	maintenance.mode = mode
+	maintenance.loadedAt = time.Now()
+}
+
+// currentMaintenance returns the maintenance switch, reading it again once
+// the copy held is older than maintenanceRefresh. When it can't be read the
+// last copy is kept.
+func currentMaintenance() database.MaintenanceMode {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	if time.Since(maintenance.loadedAt) < maintenanceRefresh {
+		return maintenance.mode
+	}
+	mode, err := database.CurrentMaintenanceMode(database.DB)
+	if err != nil {
+		log.Printf("Failed to read maintenance mode: %v", err)
+	} else {
+		maintenance.mode = mode
+	}
+	maintenance.loadedAt = time.Now()
+	return maintenance.mode
+}
+
+// Maintenance answers 503 while maintenance mode is on. Admins, and the roles
+// the admin allowed, are let through by the role in their access token; the
+// token is fully checked by the auth middleware further on.
+func Maintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := currentMaintenance()
+		if !mode.Enabled || maintenanceOpen(c.FullPath()) || maintenanceAllows(c, mode) {
+			c.Next()
+			return
+		}
+
+		message := mode.Message
+		if message == "" {
+			message = DefaultMaintenanceMessage
+		}
+		retryAfter := maintenanceRetryAfter
+		if mode.EndsAt != nil && time.Until(*mode.EndsAt) > 0 {
+			retryAfter = time.Until(*mode.EndsAt)
+		}
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":   message,
+			"code":    "maintenance",
+			"details": gin.H{"ends_at": mode.EndsAt},
+		})
+	}
+}
+
+// maintenanceOpen reports whether the route template route stays open
+func maintenanceOpen(route string) bool {
+	return maintenanceOpenRoutes[apiMount.ReplaceAllString(route, "/")]
+}
+
+// maintenanceAllows reports whether the request's access token is for an
+// admin or an allowed role. Impersonation tokens carry the customer's role,
+// so admins acting as customers are turned away like them.
+func maintenanceAllows(c *gin.Context, mode database.MaintenanceMode) bool {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	claims, err := utils.ValidateJWT(token)
+	if err != nil || claims.Purpose != "" {
+		return false
+	}
+	role := strings.ToLower(claims.Role)
+	if role == database.RoleAdmin {
+		return true
+	}
+	for _, allowed := range mode.AllowedRoles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
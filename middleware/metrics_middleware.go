@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/metrics"
+)
+
+// Metrics records request counts and latency per route template
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Use the route template so /orders/1 and /orders/2 share a series
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequests.Inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+		metrics.HTTPDuration.ObserveSince(start, c.Request.Method, route)
+	}
+}
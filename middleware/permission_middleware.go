@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+)
+
+// RequirePermission allows the request only when the user's role grants every
+// listed permission. Admins always pass.
+func RequirePermission(codes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		for _, code := range codes {
+			granted, err := database.RoleHasPermission(role.(string), code)
+			if err != nil {
+				log.Printf("Permission lookup failed: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+				c.Abort()
+				return
+			}
+			if !granted {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied", "missing_permission": code})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow counts hits for one key inside a fixed window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimiter is an in-memory fixed-window limiter
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*rateWindow
+}
+
+// NewRateLimiter allows limit hits per key in each window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, windows: map[string]*rateWindow{}}
+}
+
+// Allow records a hit for key and reports whether it is within the limit,
+// along with the time until the window resets
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowUpTo(key, l.limit)
+}
+
+// AllowUpTo is Allow with a limit of its own for this key
+func (l *RateLimiter) AllowUpTo(key string, limit int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		// Drop stale keys now and then so the map doesn't grow forever
+		if len(l.windows) > 10000 {
+			for k, old := range l.windows {
+				if now.Sub(old.start) >= l.window {
+					delete(l.windows, k)
+				}
+			}
+		}
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	w.count++
+	return w.count <= limit, w.start.Add(l.window).Sub(now)
+}
+
+// apiMount matches the prefix a route is mounted under: /api/v1 or its
+// unversioned /api alias
+var apiMount = regexp.MustCompile(`^/api(/v\d+)?/`)
+
+// RateLimit limits requests per client IP on a route; the IP comes from
+// X-Forwarded-For only behind a trusted proxy. Hits are counted by
+// the route without its /api or /api/v1 mount, so a limiter shared by both
+// mounts gives a client one budget however it addresses the route.
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	limiter := NewRateLimiter(limit, window)
+	return func(c *gin.Context) {
+		route := apiMount.ReplaceAllString(c.FullPath(), "/")
+		allowed, retryAfter := limiter.Allow(route + "|" + c.ClientIP())
+		if !allowed {
+			c.Header("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/utils"
+)
+
+// RequestIDHeader carries the ID of a request in and out
+const RequestIDHeader = "X-Request-ID"
+
+// usableRequestID is what an ID from the caller must look like to be kept
+var usableRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives each request an ID, stored under "request_id" and echoed
+// in the X-Request-ID response header, so a client's report can be matched
+// with logs and error reports. A usable ID sent by the caller, such as a
+// load balancer, is kept.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !usableRequestID.MatchString(id) {
+			id, _ = utils.GenerateSecureToken(16)
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
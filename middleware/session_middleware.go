@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"log"
+	"time"
+
+	"aquahome/database"
+)
+
+// sessionTouchInterval limits how often a session's last use is written
+const sessionTouchInterval = 5 * time.Minute
+
+// touchSession records that a session was just used, at most once per
+// sessionTouchInterval so busy clients don't write on every request
+func touchSession(session database.Session) {
+	now := time.Now()
+	if now.Sub(session.LastUsedAt) < sessionTouchInterval {
+		return
+	}
+	if err := database.DB.Model(&database.Session{}).Where("id = ?", session.ID).
+		Update("last_used_at", now).Error; err != nil {
+		log.Printf("Failed to update session %d: %v", session.ID, err)
+	}
+}
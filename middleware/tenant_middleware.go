@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+	"aquahome/tenant"
+)
+
+// TenantHeader names the brand a request is for by its slug, for apps that
+// share the API host
+const TenantHeader = "X-Tenant"
+
+// tenantRefresh is how long an instance trusts its copy of the tenants
+const tenantRefresh = time.Minute
+
+// tenantFreePaths are served for every tenant: Razorpay's webhooks name
+// payments and orders of any brand, and reminder links visits of any brand
+var tenantFreePaths = []string{"/payments/webhook", "/public/appointments/"}
+
+var tenants struct {
+	sync.Mutex
+	byID     map[uint]database.Tenant
+	bySlug   map[string]database.Tenant
+	byDomain map[string]database.Tenant
+	loadedAt time.Time
+}
+
+// ReloadTenants makes this instance read the tenants again on its next
+// request, after one was added or changed
+func ReloadTenants() {
+	tenants.Lock()
+	defer tenants.Unlock()
+	tenants.loadedAt = time.Time{}
+}
+
+// refreshTenants reads the tenants again once the copy held is older than
+// tenantRefresh. When they can't be read the last copy is kept. The caller
+// holds the lock.
+func refreshTenants() {
+	if time.Since(tenants.loadedAt) < tenantRefresh {
+		return
+	}
+	var all []database.Tenant
+	if err := database.DB.Find(&all).Error; err != nil {
+		log.Printf("Failed to read tenants: %v", err)
+	} else {
+		tenants.byID = make(map[uint]database.Tenant, len(all))
+		tenants.bySlug = make(map[string]database.Tenant, len(all))
+		tenants.byDomain = make(map[string]database.Tenant)
+		for _, t := range all {
+			tenants.byID[t.ID] = t
+			tenants.bySlug[t.Slug] = t
+			for _, d := range t.Domains {
+				tenants.byDomain[d] = t
+			}
+		}
+	}
+	tenants.loadedAt = time.Now()
+}
+
+// findTenant looks a tenant up by slug, or else by domain
+func findTenant(slug, domain string) (database.Tenant, bool) {
+	tenants.Lock()
+	defer tenants.Unlock()
+	refreshTenants()
+	if slug != "" {
+		t, ok := tenants.bySlug[slug]
+		return t, ok
+	}
+	t, ok := tenants.byDomain[domain]
+	return t, ok
+}
+
+// Tenant resolves the brand a request is for, from the X-Tenant header or
+// else the host it was sent to, falling back to the default tenant. The
+// tenant is stored under "tenant_id" and put on the request context, so
+// queries made with it only see that tenant's rows.
+func Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, free := range tenantFreePaths {
+			if strings.Contains(c.Request.URL.Path, free) {
+				c.Next()
+				return
+			}
+		}
+
+		slug := strings.ToLower(strings.TrimSpace(c.GetHeader(TenantHeader)))
+		t, found := findTenant(slug, requestDomain(c.Request.Host))
+		switch {
+		case !found && slug != "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown tenant"})
+			c.Abort()
+			return
+		case !found:
+			t.ID = database.DefaultTenantID
+		case t.Disabled:
+			c.JSON(http.StatusForbidden, gin.H{"error": "This brand is no longer served"})
+			c.Abort()
+			return
+		}
+
+		c.Set("tenant_id", t.ID)
+		c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), t.ID))
+		c.Next()
+	}
+}
+
+// tenantByID looks a tenant up by its ID
+func tenantByID(id uint) (database.Tenant, bool) {
+	tenants.Lock()
+	defer tenants.Unlock()
+	refreshTenants()
+	t, ok := tenants.byID[id]
+	return t, ok
+}
+
+// requestDomain is the host a request was sent to, without its port
+func requestDomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// DefaultTenantOnly lets through only users of the default tenant, the
+// operator of the deployment, e.g. for managing the other tenants
+func DefaultTenantOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("tenant_id") != database.DefaultTenantID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the platform operator can do this"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeout puts a deadline on each request's context, so database
+// queries and outgoing calls made with it are cancelled once the deadline
+// passes or the client goes away. Multipart uploads, which take a while on
+// slow networks, and routes whose template contains one of longRoutes, such
+// as exports, get long instead. A zero timeout leaves requests without one.
+func RequestTimeout(timeout, long time.Duration, longRoutes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := timeout
+		if strings.HasPrefix(c.ContentType(), "multipart/") || isLongRoute(c.FullPath(), longRoutes) {
+			limit = long
+		}
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), limit)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("⏱️ %s %s ran past its %s deadline", c.Request.Method, c.FullPath(), limit)
+		}
+	}
+}
+
+func isLongRoute(route string, longRoutes []string) bool {
+	for _, long := range longRoutes {
+		if strings.Contains(route, long) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// TwoFactorSetupAuthMiddleware authenticates two-factor enrollment. It accepts
+// a normal access token, or the setup token a login returns when policy
+// requires two-factor login and the user has not set it up yet. The user is
+// loaded as AuthMiddleware does, so a setup token stops working once its user
+// is deleted or given another role.
+func TwoFactorSetupAuthMiddleware() gin.HandlerFunc {
+	authenticate := AuthMiddleware()
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		claims, err := utils.ValidateJWT(token)
+		if err != nil || claims.Purpose != utils.TokenPurposeTwoFactorSetup {
+			authenticate(c)
+			return
+		}
+
+		var user database.User
+		if err := database.DB.WithContext(c.Request.Context()).First(&user, claims.UserID).Error; err != nil ||
+			!strings.EqualFold(user.Role, claims.Role) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", user.ID)
+		c.Set("email", user.Email)
+		c.Set("role", user.Role)
+		c.Set("user", user)
+		c.Set("two_factor_setup", true)
+		c.Next()
+	}
+}
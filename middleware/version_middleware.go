@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LatestAPIVersion is the newest response format the server can produce. Bump it
+// when a breaking response-shape change ships, and branch on the version in the
+// affected handlers.
+const LatestAPIVersion = 1
+
+var vendorMediaType = regexp.MustCompile(`application/vnd\.aquahome\.v(\d+)\+json`)
+
+// APIVersion records the API version of the request under "api_version".
+// The version from the path is the default; a client can opt into another
+// supported version with an X-API-Version header or an
+// Accept: application/vnd.aquahome.v2+json media type.
+func APIVersion(pathVersion int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := pathVersion
+
+		requested := strings.TrimPrefix(strings.ToLower(c.GetHeader("X-API-Version")), "v")
+		if requested == "" {
+			if m := vendorMediaType.FindStringSubmatch(c.GetHeader("Accept")); m != nil {
+				requested = m[1]
+			}
+		}
+
+		if requested != "" {
+			v, err := strconv.Atoi(requested)
+			if err != nil || v < 1 || v > LatestAPIVersion {
+				c.JSON(http.StatusNotAcceptable, gin.H{
+					"error":              "Unsupported API version",
+					"supported_versions": supportedVersions(),
+				})
+				c.Abort()
+				return
+			}
+			version = v
+		}
+
+		c.Set("api_version", version)
+		c.Header("X-API-Version", strconv.Itoa(version))
+		c.Next()
+	}
+}
+
+// DeprecatedAPIPath marks legacy unversioned paths as deprecated and points
+// clients at the versioned equivalent
+func DeprecatedAPIPath(legacyPrefix, successorPrefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := successorPrefix + strings.TrimPrefix(c.Request.URL.Path, legacyPrefix)
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
+
+// supportedVersions lists the API versions that can be requested
+func supportedVersions() []int {
+	versions := make([]int, 0, LatestAPIVersion)
+	for v := 1; v <= LatestAPIVersion; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps tasks in process memory; they are only run by this
+// instance and are lost on restart
+type MemoryBackend struct {
+	mu        sync.Mutex
+	pending   []Task
+	active    map[string]memoryLease
+	retry     map[string]Task
+	dead      []Task
+	unique    map[string]time.Time // unique key -> when it is released anyway
+	processed int64
+	failed    int64
+}
+
+type memoryLease struct {
+	task  Task
+	until time.Time
+}
+
+// NewMemoryBackend creates an empty in-memory queue
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		active: map[string]memoryLease{},
+		retry:  map[string]Task{},
+		unique: map[string]time.Time{},
+	}
+}
+
+// Enqueue adds a task unless its unique key is taken
+func (b *MemoryBackend) Enqueue(_ context.Context, task Task) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if task.UniqueKey != "" {
+		if until, taken := b.unique[task.UniqueKey]; taken && time.Now().Before(until) {
+			return false, nil
+		}
+		b.unique[task.UniqueKey] = time.Now().Add(uniqueTTL)
+	}
+	b.pending = append(b.pending, task)
+	return true, nil
+}
+
+// Dequeue hands out the oldest ready task, first making due retries and
+// expired leases ready again
+func (b *MemoryBackend) Dequeue(_ context.Context, lease time.Duration) (*Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for id, task := range b.retry {
+		if task.RetryAt == nil || !task.RetryAt.After(now) {
+			delete(b.retry, id)
+			b.pending = append(b.pending, task)
+		}
+	}
+	for id, held := range b.active {
+		if now.After(held.until) {
+			delete(b.active, id)
+			b.pending = append([]Task{held.task}, b.pending...)
+		}
+	}
+	if len(b.pending) == 0 {
+		return nil, nil
+	}
+
+	task := b.pending[0]
+	b.pending = b.pending[1:]
+	b.active[task.ID] = memoryLease{task: task, until: now.Add(lease)}
+	return &task, nil
+}
+
+// Complete drops a finished task
+func (b *MemoryBackend) Complete(_ context.Context, task Task) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.active, task.ID)
+	b.release(task)
+	b.processed++
+	return nil
+}
+
+// Retry schedules a failed task to run again at the given time
+func (b *MemoryBackend) Retry(_ context.Context, task Task, at time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.active, task.ID)
+	task.RetryAt = &at
+	b.retry[task.ID] = task
+	b.failed++
+	return nil
+}
+
+// Kill moves a task to the dead letters
+func (b *MemoryBackend) Kill(_ context.Context, task Task) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.active, task.ID)
+	b.release(task)
+	b.dead = append(b.dead, task)
+	if len(b.dead) > maxDeadTasks {
+		b.dead = b.dead[len(b.dead)-maxDeadTasks:]
+	}
+	b.failed++
+	return nil
+}
+
+// Stats counts the tasks in each state
+func (b *MemoryBackend) Stats(_ context.Context) (Stats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return Stats{
+		Backend:   "memory",
+		Pending:   int64(len(b.pending)),
+		Active:    int64(len(b.active)),
+		Retry:     int64(len(b.retry)),
+		Dead:      int64(len(b.dead)),
+		Processed: b.processed,
+		Failed:    b.failed,
+	}, nil
+}
+
+// List returns retrying tasks by when they run next, or dead tasks newest first
+func (b *MemoryBackend) List(_ context.Context, state string, limit int) ([]Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tasks := []Task{}
+	switch state {
+	case StateRetry:
+		for _, task := range b.retry {
+			tasks = append(tasks, task)
+		}
+		sort.Slice(tasks, func(i, j int) bool { return tasks[i].RetryAt.Before(*tasks[j].RetryAt) })
+	case StateDead:
+		for i := len(b.dead) - 1; i >= 0; i-- {
+			tasks = append(tasks, b.dead[i])
+		}
+	}
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+// Requeue moves a dead task back to pending
+func (b *MemoryBackend) Requeue(_ context.Context, id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, task := range b.dead {
+		if task.ID != id {
+			continue
+		}
+		b.dead = append(b.dead[:i], b.dead[i+1:]...)
+		task.Attempts, task.LastError, task.FailedAt, task.RetryAt = 0, "", nil, nil
+		if task.UniqueKey != "" {
+			b.unique[task.UniqueKey] = time.Now().Add(uniqueTTL)
+		}
+		b.pending = append(b.pending, task)
+		return true, nil
+	}
+	return false, nil
+}
+
+// release frees a task's unique key; callers hold the lock
+func (b *MemoryBackend) release(task Task) {
+	if task.UniqueKey != "" {
+		delete(b.unique, task.UniqueKey)
+	}
+}
@@ -0,0 +1,284 @@
+// Package queue runs heavy or slow work, such as PDF rendering, exports,
+// broadcasts and webhook delivery, on a pool of workers instead of in the
+// request. Tasks are kept in Redis when REDIS_URL is set, so any instance can
+// run them and they survive restarts, and in process memory otherwise.
+// Failed tasks are retried with backoff and dead-lettered once their retries
+// run out.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"aquahome/config"
+)
+
+// Task is a unit of queued work
+type Task struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	UniqueKey  string          `json:"unique_key,omitempty"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error,omitempty"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+	RetryAt    *time.Time      `json:"retry_at,omitempty"`
+	FailedAt   *time.Time      `json:"failed_at,omitempty"` // when it was dead-lettered
+}
+
+// Task states listed by the admin endpoint
+const (
+	StateRetry = "retry"
+	StateDead  = "dead"
+)
+
+// Stats is a snapshot of the queue
+type Stats struct {
+	Backend   string `json:"backend"`
+	Pending   int64  `json:"pending"` // ready to run
+	Active    int64  `json:"active"`  // held by a worker
+	Retry     int64  `json:"retry"`   // waiting to be tried again
+	Dead      int64  `json:"dead"`    // out of retries
+	Processed int64  `json:"processed"`
+	Failed    int64  `json:"failed"` // failed attempts, retried or not
+}
+
+// Backend stores tasks
+type Backend interface {
+	// Enqueue adds a task ready to run. It reports false without adding it
+	// when a task with the same unique key is still queued.
+	Enqueue(ctx context.Context, task Task) (bool, error)
+	// Dequeue hands out the next ready task for lease, or nil when none is
+	// ready. A task not completed, retried or killed within its lease is
+	// handed out again.
+	Dequeue(ctx context.Context, lease time.Duration) (*Task, error)
+	Complete(ctx context.Context, task Task) error
+	Retry(ctx context.Context, task Task, at time.Time) error
+	Kill(ctx context.Context, task Task) error
+	Stats(ctx context.Context) (Stats, error)
+	// List returns the newest tasks in the retry or dead state
+	List(ctx context.Context, state string, limit int) ([]Task, error)
+	// Requeue moves a dead task back to pending with its attempts reset
+	Requeue(ctx context.Context, id string) (bool, error)
+}
+
+// Handler runs a task; returning an error retries it
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Options tune how a task type is run
+type Options struct {
+	MaxRetry int           // retries after the first attempt before dead-lettering
+	Timeout  time.Duration // how long one attempt may run
+}
+
+// DefaultOptions are used for task types registered without options
+var DefaultOptions = Options{MaxRetry: 5, Timeout: 5 * time.Minute}
+
+// Dead tasks beyond this many are dropped, oldest first
+const maxDeadTasks = 1000
+
+// uniqueTTL releases a unique key even if its task is lost
+const uniqueTTL = 24 * time.Hour
+
+// pollInterval is how long an idle worker waits before looking again
+const pollInterval = time.Second
+
+type registration struct {
+	handle  Handler
+	options Options
+}
+
+var (
+	handlers   = map[string]registration{}
+	handlersMu sync.RWMutex
+)
+
+// Default is the backend tasks are queued on
+var Default Backend = NewMemoryBackend()
+
+// Init selects the backend from the configuration
+func Init() error {
+	if config.AppConfig.RedisURL == "" {
+		log.Println("ℹ️ Using in-memory job queue (REDIS_URL not set)")
+		return nil
+	}
+
+	backend, err := NewRedisBackend(config.AppConfig.RedisURL)
+	if err != nil {
+		return err
+	}
+	Default = backend
+	log.Println("✅ Redis job queue connected")
+	return nil
+}
+
+// Shared reports whether queued tasks are visible to other instances
+func Shared() bool {
+	_, ok := Default.(*MemoryBackend)
+	return !ok
+}
+
+// Close releases the backend's connections, if it holds any
+func Close() error {
+	if closer, ok := Default.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Register sets the handler for a task type. Call it from init.
+func Register(taskType string, handle Handler, options ...Options) {
+	opts := DefaultOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[taskType] = registration{handle: handle, options: opts}
+}
+
+// Enqueue queues a task with a JSON payload
+func Enqueue(taskType string, payload interface{}) error {
+	_, err := enqueue(taskType, "", payload)
+	return err
+}
+
+// EnqueueUnique queues a task unless one with the same key is still queued,
+// so work that is triggered repeatedly only runs once at a time. It reports
+// whether the task was queued.
+func EnqueueUnique(taskType, key string, payload interface{}) (bool, error) {
+	return enqueue(taskType, taskType+":"+key, payload)
+}
+
+func enqueue(taskType, uniqueKey string, payload interface{}) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+	task := Task{
+		ID:         newTaskID(),
+		Type:       taskType,
+		Payload:    data,
+		UniqueKey:  uniqueKey,
+		EnqueuedAt: time.Now(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return Default.Enqueue(ctx, task)
+}
+
+// Work runs queued tasks until stop is closed, finishing the current task
+// before it returns
+func Work(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		worked, err := runNext()
+		if err != nil {
+			log.Printf("❌ Job queue: %v", err)
+		}
+		if worked && err == nil {
+			continue
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// runNext runs one ready task and reports whether there was one
+func runNext() (bool, error) {
+	ctx := context.Background()
+	task, err := Default.Dequeue(ctx, maxTimeout()+time.Minute)
+	if err != nil || task == nil {
+		return false, err
+	}
+
+	handlersMu.RLock()
+	reg, ok := handlers[task.Type]
+	handlersMu.RUnlock()
+	if !ok {
+		now := time.Now()
+		task.LastError = "no handler registered for " + task.Type
+		task.FailedAt = &now
+		return true, Default.Kill(ctx, *task)
+	}
+
+	runErr := run(reg, *task)
+	if runErr == nil {
+		return true, Default.Complete(ctx, *task)
+	}
+
+	task.Attempts++
+	task.LastError = runErr.Error()
+	if task.Attempts > reg.options.MaxRetry {
+		log.Printf("❌ Job %s %s failed for good after %d attempts: %v", task.Type, task.ID, task.Attempts, runErr)
+		now := time.Now()
+		task.FailedAt = &now
+		task.RetryAt = nil
+		return true, Default.Kill(ctx, *task)
+	}
+	at := time.Now().Add(backoff(task.Attempts))
+	task.RetryAt = &at
+	log.Printf("⚠️ Job %s %s failed (attempt %d), retrying at %s: %v", task.Type, task.ID, task.Attempts, at.Format(time.RFC3339), runErr)
+	return true, Default.Retry(ctx, *task, at)
+}
+
+// run calls the handler with the task type's timeout, turning a panic into
+// an error so one bad task can't take down the worker
+func run(reg registration, task Task) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reg.options.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return reg.handle(ctx, task.Payload)
+}
+
+// maxTimeout is the longest timeout of any task type, used as the lease
+func maxTimeout() time.Duration {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	longest := DefaultOptions.Timeout
+	for _, reg := range handlers {
+		if reg.options.Timeout > longest {
+			longest = reg.options.Timeout
+		}
+	}
+	return longest
+}
+
+// backoff is the wait before retry n: 10s, 40s, 90s, ... capped at an hour,
+// with jitter so failed tasks don't all come back at once
+func backoff(attempt int) time.Duration {
+	wait := time.Duration(attempt*attempt) * 10 * time.Second
+	if wait > time.Hour {
+		wait = time.Hour
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait/10)+1))
+}
+
+// Decode unmarshals a task payload
+func Decode(payload json.RawMessage, dest interface{}) error {
+	if err := json.Unmarshal(payload, dest); err != nil {
+		return fmt.Errorf("invalid task payload: %w", err)
+	}
+	return nil
+}
+
+func newTaskID() string {
+	return fmt.Sprintf("%x-%x", time.Now().UnixNano(), rand.Uint32())
+}
@@ -0,0 +1,70 @@
+package risk
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+	"aquahome/utils"
+)
+
+// ErrOverrideUsed is returned when an override was used by another order
+// meanwhile
+var ErrOverrideUsed = errors.New("risk override has already been used")
+
+// Normalize puts a phone number or email address in the form the blacklist
+// stores, or returns "" when there is nothing to match on
+func Normalize(kind, value string) string {
+	switch kind {
+	case database.BlacklistKindPhone:
+		return utils.NormalizePhone(value)
+	case database.BlacklistKindEmail:
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	return ""
+}
+
+// Blocked returns the blacklist entries matching a customer's phone or email
+func Blocked(db *gorm.DB, customer database.User) ([]database.BlacklistEntry, error) {
+	entries := []database.BlacklistEntry{}
+	phone := Normalize(database.BlacklistKindPhone, customer.Phone)
+	email := Normalize(database.BlacklistKindEmail, customer.Email)
+	if phone == "" && email == "" {
+		return entries, nil
+	}
+	err := db.Where("(kind = ? AND value = ?) OR (kind = ? AND value = ?)",
+		database.BlacklistKindPhone, phone, database.BlacklistKindEmail, email).
+		Find(&entries).Error
+	return entries, err
+}
+
+// ActiveOverride returns the customer's unused, unexpired override, or nil
+func ActiveOverride(db *gorm.DB, customerID uint) (*database.RiskOverride, error) {
+	var override database.RiskOverride
+	err := db.Where("customer_id = ? AND used_at IS NULL AND expires_at > ?", customerID, time.Now()).
+		Order("expires_at DESC").First(&override).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// UseOverride spends an override on the order it let through
+func UseOverride(tx *gorm.DB, override *database.RiskOverride, orderID uint) error {
+	result := tx.Model(&database.RiskOverride{}).
+		Where("id = ? AND used_at IS NULL", override.ID).
+		Updates(map[string]interface{}{"used_at": time.Now(), "order_id": orderID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOverrideUsed
+	}
+	return nil
+}
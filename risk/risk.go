@@ -0,0 +1,208 @@
+// Package risk scores customers on how they have paid and treated their
+// devices, and keeps the blacklist of phones and emails that may not order.
+package risk
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aquahome/database"
+)
+
+// Counts at which a signal flags a customer, and how much each occurrence
+// adds to the score
+const (
+	FailedPaymentsFlag = 3
+	ChargebacksFlag    = 1
+	DamageClaimsFlag   = 2
+
+	failedPaymentPoints = 10
+	chargebackPoints    = 30
+	damageClaimPoints   = 15
+)
+
+// paymentLookback is how far back payment failures count; chargebacks and
+// damage are never forgotten
+const paymentLookback = 180 * 24 * time.Hour
+
+// Risk levels
+const (
+	LevelLow    = "low"
+	LevelMedium = "medium"
+	LevelHigh   = "high"
+)
+
+// Flags raised on an assessment
+const (
+	FlagFailedPayments = "repeated_payment_failures"
+	FlagChargebacks    = "chargebacks"
+	FlagDamageClaims   = "device_damage"
+	FlagBlacklisted    = "blacklisted"
+)
+
+// Assessment is a customer's risk. FailedPayments counts failed payments and
+// rent left unpaid long enough to be charged a late fee.
+type Assessment struct {
+	CustomerID     uint                      `json:"customer_id"`
+	FailedPayments int64                     `json:"failed_payments"`
+	Chargebacks    int64                     `json:"chargebacks"`
+	DamageClaims   int64                     `json:"damage_claims"`
+	Score          int                       `json:"score"` // 0 to 100
+	Level          string                    `json:"level"`
+	Flags          []string                  `json:"flags"`
+	Blacklisted    []database.BlacklistEntry `json:"blacklisted,omitempty"`
+}
+
+// score fills in the score, level and flags from the counts
+func (a *Assessment) score() {
+	a.Flags = []string{}
+	if a.FailedPayments >= FailedPaymentsFlag {
+		a.Flags = append(a.Flags, FlagFailedPayments)
+	}
+	if a.Chargebacks >= ChargebacksFlag {
+		a.Flags = append(a.Flags, FlagChargebacks)
+	}
+	if a.DamageClaims >= DamageClaimsFlag {
+		a.Flags = append(a.Flags, FlagDamageClaims)
+	}
+	if len(a.Blacklisted) > 0 {
+		a.Flags = append(a.Flags, FlagBlacklisted)
+	}
+
+	a.Score = int(a.FailedPayments*failedPaymentPoints + a.Chargebacks*chargebackPoints + a.DamageClaims*damageClaimPoints)
+	if a.Score > 100 || len(a.Blacklisted) > 0 {
+		a.Score = 100
+	}
+	switch {
+	case a.Score >= 60:
+		a.Level = LevelHigh
+	case a.Score >= 30:
+		a.Level = LevelMedium
+	default:
+		a.Level = LevelLow
+	}
+}
+
+// Flagged reports whether anything about the customer needs a second look
+func (a Assessment) Flagged() bool {
+	return len(a.Flags) > 0
+}
+
+// counts is one signal counted per customer
+type counts map[uint]int64
+
+// countBy runs a query selecting customer_id and n, grouped by customer
+func countBy(query *gorm.DB) (counts, error) {
+	var rows []struct {
+		CustomerID uint
+		N          int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := counts{}
+	for _, row := range rows {
+		result[row.CustomerID] = row.N
+	}
+	return result, nil
+}
+
+// signals counts each signal for the customers the scope selects, by
+// customer
+func signals(db *gorm.DB, scope func(db *gorm.DB, column string) *gorm.DB) (failed, unpaid, chargebacks, damage counts, err error) {
+	since := time.Now().Add(-paymentLookback)
+	if failed, err = countBy(scope(db.Model(&database.Payment{}), "payments.customer_id").
+		Select("payments.customer_id, COUNT(*) AS n").
+		Where("payments.status = ? AND payments.created_at >= ?", database.PaymentStatusFailed, since).
+		Group("payments.customer_id")); err != nil {
+		return
+	}
+	if unpaid, err = countBy(scope(db.Model(&database.DunningEvent{}), "subscriptions.customer_id").
+		Select("subscriptions.customer_id, COUNT(*) AS n").
+		Joins("JOIN subscriptions ON subscriptions.id = dunning_events.subscription_id").
+		Where("dunning_events.stage = ? AND dunning_events.created_at >= ?", database.DunningStageLateFee, since).
+		Group("subscriptions.customer_id")); err != nil {
+		return
+	}
+	if chargebacks, err = countBy(scope(db.Model(&database.Dispute{}), "disputes.customer_id").
+		Select("disputes.customer_id, COUNT(*) AS n").
+		Where("disputes.customer_id IS NOT NULL").
+		Group("disputes.customer_id")); err != nil {
+		return
+	}
+	damage, err = countBy(scope(db.Model(&database.DepositDeduction{}), "deposit_settlements.customer_id").
+		Select("deposit_settlements.customer_id, COUNT(*) AS n").
+		Joins("JOIN deposit_settlements ON deposit_settlements.id = deposit_deductions.settlement_id").
+		Group("deposit_settlements.customer_id"))
+	return
+}
+
+// Assess scores one customer
+func Assess(db *gorm.DB, customerID uint) (Assessment, error) {
+	assessment := Assessment{CustomerID: customerID}
+	failed, unpaid, chargebacks, damage, err := signals(db, func(q *gorm.DB, column string) *gorm.DB {
+		return q.Where(column+" = ?", customerID)
+	})
+	if err != nil {
+		return assessment, err
+	}
+	assessment.FailedPayments = failed[customerID] + unpaid[customerID]
+	assessment.Chargebacks = chargebacks[customerID]
+	assessment.DamageClaims = damage[customerID]
+
+	var customer database.User
+	if err := db.Select("id, phone, email").First(&customer, customerID).Error; err != nil {
+		return assessment, err
+	}
+	if assessment.Blacklisted, err = Blocked(db, customer); err != nil {
+		return assessment, err
+	}
+	assessment.score()
+	return assessment, nil
+}
+
+// Flagged scores every customer with a signal against them and returns
+// those flagged, riskiest first
+func Flagged(db *gorm.DB) ([]Assessment, error) {
+	failed, unpaid, chargebacks, damage, err := signals(db, func(q *gorm.DB, _ string) *gorm.DB { return q })
+	if err != nil {
+		return nil, err
+	}
+
+	byCustomer := map[uint]*Assessment{}
+	get := func(id uint) *Assessment {
+		if byCustomer[id] == nil {
+			byCustomer[id] = &Assessment{CustomerID: id}
+		}
+		return byCustomer[id]
+	}
+	for id, n := range failed {
+		get(id).FailedPayments += n
+	}
+	for id, n := range unpaid {
+		get(id).FailedPayments += n
+	}
+	for id, n := range chargebacks {
+		get(id).Chargebacks = n
+	}
+	for id, n := range damage {
+		get(id).DamageClaims = n
+	}
+
+	flagged := []Assessment{}
+	for _, a := range byCustomer {
+		a.score()
+		if a.Flagged() {
+			flagged = append(flagged, *a)
+		}
+	}
+	sort.Slice(flagged, func(i, j int) bool {
+		if flagged[i].Score != flagged[j].Score {
+			return flagged[i].Score > flagged[j].Score
+		}
+		return flagged[i].CustomerID < flagged[j].CustomerID
+	})
+	return flagged, nil
+}
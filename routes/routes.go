@@ -2,10 +2,14 @@ package routes
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"aquahome/controllers"
+	"aquahome/database"
+	"aquahome/docs"
+	"aquahome/metrics"
 	"aquahome/middleware"
 )
 
@@ -13,8 +17,62 @@ import (
 func SetupRoutes(r *gin.Engine) {
 	fmt.Println("✅ SetupRoutes called")
 
+	// Versioned API. The unversioned /api paths stay as aliases of v1 so existing
+	// apps keep working; they are marked deprecated in the response headers.
+	// Both mounts share one set of rate limiters.
+	limits := newRateLimits()
+	registerAPIRoutes(r.Group("/api/v1", middleware.APIVersion(1), middleware.Tenant(), middleware.Maintenance()), limits)
+	registerAPIRoutes(r.Group("/api", middleware.APIVersion(1), middleware.DeprecatedAPIPath("/api", "/api/v1"), middleware.Tenant(), middleware.Maintenance()), limits)
+
+	// Prometheus scrape endpoint
+	r.GET("/metrics", metrics.Handler)
+
+	// OpenAPI spec and Swagger UI
+	r.GET("/api/docs", docs.UI)
+	r.GET("/api/docs/openapi.json", docs.Spec(r))
+}
+
+// rateLimits are the per-IP limits of public and abuse-prone routes. They are
+// built once and shared by the API mounts, as each limiter keeps its own
+// counts.
+type rateLimits struct {
+	forgotPassword     gin.HandlerFunc
+	resetPassword      gin.HandlerFunc
+	otpRequest         gin.HandlerFunc
+	otpVerify          gin.HandlerFunc
+	googleSignIn       gin.HandlerFunc
+	verifyEmail        gin.HandlerFunc
+	resendVerification gin.HandlerFunc
+	twoFactorVerify    gin.HandlerFunc
+	twoFactorEnable    gin.HandlerFunc
+	serviceability     gin.HandlerFunc
+	leads              gin.HandlerFunc
+	appointments       gin.HandlerFunc
+	avatar             gin.HandlerFunc
+}
+
+func newRateLimits() rateLimits {
+	return rateLimits{
+		forgotPassword:     middleware.RateLimit(5, 15*time.Minute),
+		resetPassword:      middleware.RateLimit(10, 15*time.Minute),
+		otpRequest:         middleware.RateLimit(5, 15*time.Minute),
+		otpVerify:          middleware.RateLimit(10, 15*time.Minute),
+		googleSignIn:       middleware.RateLimit(20, 15*time.Minute),
+		verifyEmail:        middleware.RateLimit(20, 15*time.Minute),
+		resendVerification: middleware.RateLimit(5, 15*time.Minute),
+		twoFactorVerify:    middleware.RateLimit(10, 15*time.Minute),
+		twoFactorEnable:    middleware.RateLimit(10, 15*time.Minute),
+		serviceability:     middleware.RateLimit(60, time.Minute),
+		leads:              middleware.RateLimit(5, 15*time.Minute),
+		appointments:       middleware.RateLimit(30, time.Minute),
+		avatar:             middleware.RateLimit(10, time.Minute),
+	}
+}
+
+// registerAPIRoutes mounts every API route on the given base group
+func registerAPIRoutes(api *gin.RouterGroup, limits rateLimits) {
 	// Public routes (no authentication required)
-	public := r.Group("/api")
+	public := api.Group("")
 	{
 		// Authentication routes
 		auth := public.Group("/auth")
@@ -23,44 +81,155 @@ func SetupRoutes(r *gin.Engine) {
 			auth.POST("/register", controllers.Register)
 			auth.POST("/login/v2", controllers.LoginNew)
 			auth.POST("/register/v2", controllers.RegisterNew)
+			auth.POST("/refresh", controllers.RefreshToken)
+			auth.POST("/forgot-password", limits.forgotPassword, controllers.ForgotPasswordNew)
+			auth.POST("/reset-password", limits.resetPassword, controllers.ResetPasswordNew)
+			auth.POST("/otp/request", limits.otpRequest, controllers.RequestPhoneOTP)
+			auth.POST("/otp/verify", limits.otpVerify, controllers.VerifyPhoneOTP)
+			auth.POST("/google", limits.googleSignIn, controllers.GoogleSignIn)
+			auth.GET("/verify-email", limits.verifyEmail, controllers.VerifyEmail)
+			auth.POST("/verify-email/resend", limits.resendVerification, middleware.AuthMiddleware(), middleware.DenyImpersonation(), controllers.ResendEmailVerification)
+
+			// Two-factor login; setup also accepts the token a login returns when
+			// policy requires it
+			auth.POST("/2fa/verify", limits.twoFactorVerify, controllers.VerifyTwoFactor)
+			auth.POST("/2fa/setup", middleware.TwoFactorSetupAuthMiddleware(), middleware.DenyImpersonation(), controllers.SetupTwoFactor)
+			auth.POST("/2fa/enable", limits.twoFactorEnable, middleware.TwoFactorSetupAuthMiddleware(), middleware.DenyImpersonation(), controllers.EnableTwoFactor)
 		}
 
+		// Razorpay webhooks (authenticated by signature, not JWT)
+		public.POST("/payments/webhook", controllers.RazorpayWebhook)
+
 		// Products (public view for non-authenticated users)
+		public.GET("/products", controllers.GetCustomerProducts)
+
+		// Storefront check of whether a pincode is served, before signup
+		public.GET("/public/serviceability", limits.serviceability, controllers.CheckServiceability)
 
+		// Demo bookings from the website, routed to the franchise serving the pincode
+		public.POST("/public/leads", limits.leads, controllers.CreateLead)
+
+		// Confirm and reschedule links in appointment reminders (authenticated by signed token)
+		appointments := public.Group("/public/appointments/:token", limits.appointments)
+		{
+			appointments.GET("", controllers.GetAppointment)
+			appointments.POST("/confirm", controllers.ConfirmAppointment)
+			appointments.POST("/reschedule", controllers.RescheduleAppointment)
+		}
+	}
+
+	// Partner API for third-party integrations (authenticated by API key, not JWT)
+	partner := api.Group("/partner")
+	{
+		partner.GET("/products", middleware.APIKeyAuthMiddleware(database.ScopeProductsRead), controllers.PartnerGetProducts)
+		partner.GET("/orders", middleware.APIKeyAuthMiddleware(database.ScopeOrdersRead), controllers.PartnerGetOrders)
+		partner.GET("/subscriptions/:id", middleware.APIKeyAuthMiddleware(database.ScopeSubscriptionsRead), controllers.PartnerGetSubscription)
+		partner.GET("/service-requests", middleware.APIKeyAuthMiddleware(database.ScopeServiceRequestsRead), controllers.PartnerGetServiceRequests)
+		partner.POST("/service-requests", middleware.APIKeyAuthMiddleware(database.ScopeServiceRequestsWrite), controllers.PartnerCreateServiceRequest)
 	}
 
 	// Protected routes (authentication required)
-	protected := r.Group("/api")
+	protected := api.Group("")
 	protected.Use(middleware.AuthMiddleware())
 	{
 
-		protected.POST("/auth/refresh", controllers.RefreshToken)
-		protected.POST("/auth/refresh/v2", controllers.RefreshTokenNew)
+		protected.POST("/auth/logout", middleware.DenyImpersonation(), controllers.Logout)
+		protected.POST("/auth/refresh/v2", middleware.DenyImpersonation(), controllers.RefreshTokenNew)
 
 		protected.GET("/profile", controllers.GetUserProfile)
 		protected.PUT("/profile", controllers.UpdateUserProfile)
-		protected.POST("/profile/change-password", controllers.ChangePassword)
+		protected.POST("/profile/change-password", middleware.DenyImpersonation(), controllers.ChangePassword)
 		protected.GET("/profile/v2", controllers.GetUserProfileNew)
 		protected.GET("/products/:id", controllers.GetProductByID)
+		protected.GET("/products/:id/images", controllers.GetProductImages)
 		protected.GET("/customer/products", controllers.GetCustomerProducts)
 		protected.PUT("/profile/v2", controllers.UpdateUserProfileNew)
 		protected.POST("/profile/location", controllers.UpdateUserLocation)
-		protected.POST("/profile/change-password/v2", controllers.ChangePasswordNew)
-		protected.PATCH("/servicerequests/:id/assign-agent", middleware.AdminOrFranchiseAuthMiddleware(), controllers.AssignServiceRequestToAgent)
+		protected.POST("/profile/change-password/v2", middleware.DenyImpersonation(), controllers.ChangePasswordNew)
+
+		// Personal data export
+		protected.POST("/users/me/export", middleware.DenyImpersonation(), controllers.RequestDataExport)
+		protected.GET("/users/me/export", controllers.GetDataExport)
+		protected.GET("/users/me/export/:id/download", controllers.DownloadDataExport)
+		protected.DELETE("/users/me", middleware.DenyImpersonation(), controllers.DeleteMyAccount)
+		protected.POST("/users/me/avatar", limits.avatar, controllers.UploadAvatar)
+		protected.GET("/users/me/sessions", controllers.GetMySessions)
+		protected.DELETE("/users/me/sessions", middleware.DenyImpersonation(), controllers.RevokeAllMySessions)
+		protected.DELETE("/users/me/sessions/:id", middleware.DenyImpersonation(), controllers.RevokeMySession)
+		protected.POST("/users/me/devices", controllers.RegisterPushDevice)
+		protected.DELETE("/users/me/devices/:id", controllers.DeletePushDevice)
+		protected.POST("/auth/2fa/disable", middleware.DenyImpersonation(), controllers.DisableTwoFactor)
+		protected.POST("/auth/2fa/backup-codes", middleware.DenyImpersonation(), controllers.RegenerateBackupCodes)
+		protected.GET("/users/me/wallet", controllers.GetMyWallet)
+		protected.GET("/users/me/addresses", controllers.GetMyAddresses)
+		protected.POST("/users/me/addresses", controllers.CreateAddress)
+		protected.PUT("/users/me/addresses/:id", controllers.UpdateAddress)
+		protected.DELETE("/users/me/addresses/:id", controllers.DeleteAddress)
+
+		protected.GET("/notifications", controllers.GetNotifications)
+		protected.GET("/notifications/unread-count", controllers.GetUnreadNotificationCount)
+		protected.PATCH("/notifications/:id/read", controllers.MarkNotificationRead)
+		protected.POST("/notifications/read-all", controllers.MarkAllNotificationsRead)
+		protected.GET("/users/me/deposit-settlements", middleware.CustomerAuthMiddleware(), controllers.GetMyDepositSettlements)
+		protected.PATCH("/servicerequests/:id/assign-agent", middleware.RequirePermission(database.PermServiceRequestAssign),
+			middleware.StaffFeature(database.FranchiseFeatureServiceRequests), controllers.AssignServiceRequestToAgent)
+		protected.GET("/service-slots", controllers.GetServiceSlots)
 
 		// protected.POST("/customer/service-requests",controllers.CreateServiceRequest)
 
+		// Permission-based admin routes; custom roles reach these through their permissions
+		rbac := protected.Group("/admin")
+		{
+			rbac.GET("/audit-logs", middleware.RequirePermission(database.PermAuditRead), controllers.GetAuditLogs)
+			rbac.GET("/permissions", middleware.RequirePermission(database.PermRoleManage), controllers.GetPermissions)
+			rbac.GET("/roles", middleware.RequirePermission(database.PermRoleManage), controllers.GetRoles)
+			// Roles are shared by every tenant, so only the platform operator edits them
+			rbac.POST("/roles", middleware.DefaultTenantOnly(), middleware.RequirePermission(database.PermRoleManage), controllers.CreateRole)
+			rbac.PUT("/roles/:id", middleware.DefaultTenantOnly(), middleware.RequirePermission(database.PermRoleManage), controllers.UpdateRole)
+			rbac.DELETE("/roles/:id", middleware.DefaultTenantOnly(), middleware.RequirePermission(database.PermRoleManage), controllers.DeleteRole)
+			rbac.GET("/account-deletions", middleware.RequirePermission(database.PermUserManage), controllers.GetAccountDeletions)
+			rbac.PATCH("/users/:id/role", middleware.RequirePermission(database.PermRoleManage, database.PermUserManage), controllers.AssignUserRole)
+		}
+
 		// Admin routes
 		// Admin routes
+		// Exports are open to franchise owners and staff, scoped to their franchises
+		export := protected.Group("/admin/export")
+		export.Use(middleware.FranchiseFeature(database.FranchiseFeatureReports))
+		{
+			export.GET("/orders", controllers.ExportOrders)
+			export.GET("/payments", controllers.ExportPayments)
+			export.GET("/service-requests", controllers.ExportServiceRequests)
+		}
+
 		admin := protected.Group("/admin")
 		admin.Use(middleware.AdminAuthMiddleware())
 		{
 			admin.GET("/users/:id", controllers.GetUserByID)
+			admin.POST("/users/:id/impersonate", controllers.ImpersonateUser)
+			admin.GET("/security-policy", controllers.GetSecurityPolicy)
+			admin.GET("/api-keys", controllers.GetAPIKeys)
+			admin.GET("/api-keys/scopes", controllers.GetAPIKeyScopes)
+			admin.POST("/api-keys", controllers.CreateAPIKey)
+			admin.DELETE("/api-keys/:id", controllers.RevokeAPIKey)
+			admin.GET("/maintenance", controllers.GetMaintenanceMode)
 			admin.GET("/users/role/:role", controllers.GetUsersByRole)
 			admin.GET("/orders", controllers.AdminGetOrders)
+			admin.POST("/orders/bulk-status", controllers.BulkUpdateOrderStatus)
+			admin.POST("/service-requests/bulk-assign", controllers.BulkAssignServiceRequests)
+			admin.GET("/search", controllers.AdminSearch)
+			admin.GET("/search/customers", controllers.SearchCustomersText)
+			admin.GET("/search/service-requests", controllers.SearchServiceRequestsText)
 			admin.GET("/users/:id/v2", controllers.GetUserByIDNew)
 			admin.GET("/users/role/:role/v2", controllers.GetUsersByRoleNew)
+			admin.DELETE("/users/:id", controllers.AdminDeleteUser)
+			admin.POST("/users/:id/restore", controllers.RestoreUser)
 			admin.GET("/dashboard", controllers.AdminDashboard)
+			admin.GET("/analytics/revenue", controllers.GetRevenueAnalytics)
+			admin.GET("/analytics/subscriptions", controllers.GetSubscriptionAnalytics)
+			admin.GET("/analytics/orders", controllers.GetOrderAnalytics)
+			admin.GET("/analytics/service-requests", controllers.GetServiceRequestAnalytics)
+			admin.GET("/analytics/leads", controllers.GetLeadAnalytics)
 
 			//  Products Management
 			admin.POST("/products", controllers.CreateProduct)
@@ -69,19 +238,128 @@ func SetupRoutes(r *gin.Engine) {
 			admin.PUT("/products/:id", controllers.UpdateProduct)
 			admin.DELETE("/products/:id", controllers.DeleteProduct)
 			admin.PATCH("/products/:id/toggle-status", controllers.ToggleProductStatus)
+			admin.POST("/products/:id/restore", controllers.RestoreProduct)
+			admin.GET("/products/:id/variants", controllers.GetProductVariants)
+			admin.POST("/products/:id/variants", controllers.CreateProductVariant)
+			admin.PUT("/products/:id/variants/:variant_id", controllers.UpdateProductVariant)
+			admin.DELETE("/products/:id/variants/:variant_id", controllers.DeleteProductVariant)
+			admin.GET("/products/:id/plans", controllers.GetRentalPlans)
+			admin.POST("/products/:id/plans", controllers.CreateRentalPlan)
+			admin.PUT("/products/:id/plans/:plan_id", controllers.UpdateRentalPlan)
+			admin.DELETE("/products/:id/plans/:plan_id", controllers.DeleteRentalPlan)
+			admin.POST("/products/:id/images", controllers.UploadProductImages)
+			admin.PUT("/products/:id/images/order", controllers.ReorderProductImages)
+			admin.DELETE("/products/:id/images/:image_id", controllers.DeleteProductImage)
+
+			// Broadcast announcements
+			admin.POST("/announcements", controllers.CreateAnnouncement)
+			admin.GET("/announcements", controllers.GetAnnouncements)
+			admin.GET("/announcements/:id", controllers.GetAnnouncement)
+
+			// Coupons
+			admin.GET("/coupons", controllers.GetCoupons)
+			admin.POST("/coupons", controllers.CreateCoupon)
+			admin.PUT("/coupons/:id", controllers.UpdateCoupon)
+			admin.DELETE("/coupons/:id", controllers.DeleteCoupon)
+			admin.GET("/coupons/:id/redemptions", controllers.GetCouponRedemptions)
 
 			//  Franchise Management
 			admin.PATCH("/franchises/:id", controllers.AdminUpdateFranchise)
 			admin.POST("/franchises", controllers.CreateFranchise)
 			admin.GET("/franchises", controllers.GetAllFranchises)
 			admin.PATCH("/franchises/:id/toggle-status", controllers.ToggleFranchiseStatus)
+			admin.DELETE("/franchises/:id", controllers.AdminDeleteFranchise)
+			admin.POST("/franchises/:id/restore", controllers.RestoreFranchise)
+			admin.GET("/franchises/:id/territories", controllers.GetFranchiseTerritories)
+			admin.POST("/franchises/:id/territories", controllers.CreateFranchiseTerritory)
+			admin.DELETE("/franchises/:id/territories/:territory_id", controllers.DeleteFranchiseTerritory)
+			admin.GET("/franchises/:id/locations", controllers.GetFranchiseServiceLocations)
+			admin.POST("/franchises/:id/locations", controllers.AttachFranchiseLocations)
+			admin.DELETE("/franchises/:id/locations", controllers.DetachFranchiseLocations)
+
+			//  Franchise revenue-share settlements
+			admin.GET("/settlements", controllers.GetSettlements)
+			admin.POST("/settlements/generate", controllers.GenerateSettlements)
+			admin.POST("/settlements/:id/mark-paid", controllers.MarkSettlementPaid)
+			admin.POST("/settlements/:id/approve", controllers.ApproveSettlement)
+			admin.POST("/settlements/:id/payout", controllers.PayoutSettlement)
+
+			// Bank transfers and other payments made outside the app
+			admin.POST("/payments/manual", controllers.RecordManualPayment)
+
+			// Payment links for assisted checkout and overdue rent
+			admin.POST("/payments/:id/payment-link", controllers.CreatePaymentLink)
+			admin.GET("/payments/:id/payment-links", controllers.GetPaymentLinks)
+
+			// Credit notes against invoices, taken off the next bill
+			admin.POST("/payments/:id/credit-notes", controllers.IssueCreditNote)
+			admin.GET("/credit-notes", controllers.GetCreditNotes)
+			admin.POST("/credit-notes/:id/void", controllers.VoidCreditNote)
+
+			// Chargebacks and other payment disputes
+			admin.GET("/disputes", controllers.GetDisputes)
+			admin.GET("/disputes/:id", controllers.GetDispute)
+			admin.POST("/disputes/:id/evidence", controllers.UploadDisputeEvidence)
+			admin.POST("/disputes/:id/contest", controllers.ContestDispute)
+			admin.POST("/disputes/:id/accept", controllers.AcceptDispute)
 
 			//  Orders
 			admin.PATCH("/orders/:id/assign", controllers.AssignOrderToFranchise)
+			admin.DELETE("/orders/:id", controllers.AdminDeleteOrder)
+			admin.POST("/orders/:id/restore", controllers.RestoreOrder)
 			admin.GET("/customers/:id/subscriptions", controllers.GetCustomerSubscriptionsByAdmin)
 
+			// Customer risk and the order blacklist
+			admin.GET("/customers/:id/risk", controllers.GetCustomerRisk)
+			admin.POST("/customers/:id/blacklist", controllers.BlacklistCustomer)
+			admin.POST("/customers/:id/risk-override", controllers.GrantRiskOverride)
+			admin.GET("/risk/flagged", controllers.GetFlaggedCustomers)
+			admin.GET("/blacklist", controllers.GetBlacklist)
+			admin.POST("/blacklist", controllers.AddBlacklistEntry)
+			admin.DELETE("/blacklist/:id", controllers.RemoveBlacklistEntry)
+
 			// NEW: Locations
 			admin.GET("/locations", controllers.GetAllLocations)
+
+			// Deployment-wide settings, operations and books, shared by every
+			// tenant: only admins of the default tenant, the platform operator,
+			// reach these
+			platform := admin.Group("")
+			platform.Use(middleware.DefaultTenantOnly())
+			{
+				platform.GET("/tenants", controllers.GetTenants)
+				platform.POST("/tenants", controllers.CreateTenant)
+				platform.PUT("/tenants/:id", controllers.UpdateTenant)
+				platform.PUT("/security-policy", controllers.UpdateSecurityPolicy)
+				platform.PUT("/maintenance", controllers.UpdateMaintenanceMode)
+				platform.GET("/webhooks", controllers.GetWebhookEndpoints)
+				platform.GET("/webhooks/events", controllers.GetWebhookEvents)
+				platform.POST("/webhooks", controllers.CreateWebhookEndpoint)
+				platform.PUT("/webhooks/:id", controllers.UpdateWebhookEndpoint)
+				platform.DELETE("/webhooks/:id", controllers.DeleteWebhookEndpoint)
+				platform.GET("/webhooks/:id/deliveries", controllers.GetWebhookDeliveries)
+				platform.POST("/webhook-deliveries/:id/redeliver", controllers.RedeliverWebhook)
+				platform.GET("/outbox", controllers.GetOutboxEvents)
+				platform.POST("/outbox/:id/retry", controllers.RetryOutboxEvent)
+				platform.GET("/notification-deliveries", controllers.GetNotificationDeliveries)
+				platform.POST("/notification-deliveries/:id/retry", controllers.RetryNotificationDelivery)
+				platform.GET("/jobs", controllers.GetJobQueue)
+				platform.POST("/jobs/dead/:id/retry", controllers.RetryDeadJob)
+				platform.GET("/archive", controllers.GetArchivedRecords)
+				platform.GET("/alerts", controllers.GetAlerts)
+				platform.POST("/locations/import", controllers.ImportLocations)
+
+				// Notification copy
+				platform.GET("/notification-templates", controllers.GetNotificationTemplates)
+				platform.PUT("/notification-templates", controllers.SaveNotificationTemplate)
+				platform.DELETE("/notification-templates/:id", controllers.DeleteNotificationTemplate)
+
+				// Double-entry ledger
+				platform.GET("/ledger/accounts", controllers.GetTrialBalance)
+				platform.GET("/ledger/customers/:id", controllers.GetCustomerLedger)
+				platform.GET("/ledger/franchises/:id", controllers.GetFranchiseLedger)
+				platform.POST("/ledger/backfill", controllers.BackfillLedger)
+			}
 		}
 
 		// 🧑‍🔧 Service Agent Routes
@@ -89,8 +367,24 @@ func SetupRoutes(r *gin.Engine) {
 		agent.Use(middleware.ServiceAgentAuthMiddleware())
 		{
 			agent.GET("/tasks", controllers.GetAgentTasks)
+			agent.POST("/tasks/:id/respond", controllers.RespondToTask)
 			agent.GET("/dashboard", controllers.GetServiceAgentDashboard)
 			agent.GET("/orders", controllers.GetAgentOrders)
+			agent.GET("/route", controllers.GetAgentRoute)
+			agent.GET("/availability", controllers.GetMyAvailability)
+			agent.PUT("/shifts", controllers.UpdateMyShifts)
+			agent.POST("/leaves", controllers.AddMyLeave)
+			agent.DELETE("/leaves/:leave_id", controllers.CancelMyLeave)
+			agent.POST("/deposit-settlements/:id/pickup", controllers.ConfirmDevicePickup)
+			agent.POST("/orders/:id/installation-otp", controllers.ResendInstallationOTP)
+			agent.POST("/orders/:id/installation-report", controllers.SubmitInstallationReport)
+			agent.POST("/orders/:id/confirm-installation", controllers.ConfirmInstallation)
+			agent.POST("/service-requests/:id/check-in", controllers.CheckInToJob)
+			agent.POST("/service-requests/:id/check-out", controllers.CheckOutOfJob)
+			agent.POST("/service-requests/:id/report", controllers.SubmitServiceReport)
+			agent.POST("/service-requests/:id/attachments", controllers.AddAgentJobAttachments)
+			agent.POST("/payments/cash", controllers.RecordCashPayment)
+			agent.POST("/payments/cash/deposits", controllers.RecordCashDeposit)
 		}
 
 		// Orders
@@ -99,12 +393,19 @@ func SetupRoutes(r *gin.Engine) {
 			fmt.Println("✅ Orders route group initializing")
 
 			orders.POST("", middleware.CustomerAuthMiddleware(), controllers.CreateOrder)
+			orders.POST("/validate-coupon", middleware.CustomerAuthMiddleware(), controllers.ValidateCoupon)
 			orders.POST("/:id/cancel", middleware.CustomerAuthMiddleware(), controllers.CancelOrder)
 			orders.GET("/customer", middleware.CustomerAuthMiddleware(), controllers.GetCustomerOrders)
 			orders.PUT("/:id/status", middleware.AdminOrFranchiseAuthMiddleware(), controllers.UpdateOrderStatus)
 			orders.GET("/:id", controllers.GetOrderByID)
+			orders.GET("/:id/timeline", controllers.GetOrderTimeline)
+			orders.GET("/:id/agreement", controllers.GetRentalAgreement)
+			orders.GET("/:id/agreement/pdf", controllers.DownloadRentalAgreement)
+			orders.POST("/:id/agreement/otp", middleware.CustomerAuthMiddleware(), controllers.SendAgreementOTP)
+			orders.POST("/:id/agreement/accept", middleware.CustomerAuthMiddleware(), controllers.AcceptRentalAgreement)
+			orders.GET("/:id/installation-report", controllers.GetInstallationReport)
 
-			orders.PATCH("/:id/assign-agent", middleware.FranchiseOwnerAuthMiddleware(), controllers.AssignOrderToAgent)
+			orders.PATCH("/:id/assign-agent", middleware.FranchiseFeature(database.FranchiseFeatureOrders), controllers.AssignOrderToAgent)
 
 		}
 
@@ -126,8 +427,11 @@ func SetupRoutes(r *gin.Engine) {
 			services.POST("", middleware.CustomerAuthMiddleware(), controllers.CreateServiceRequest)
 			services.POST("/:id/feedback", middleware.CustomerAuthMiddleware(), controllers.SubmitServiceFeedback)
 			services.POST("/:id/cancel", middleware.CustomerAuthMiddleware(), controllers.CancelServiceRequest)
-			services.GET("", controllers.GetServiceRequestsNew)
+			services.GET("", middleware.StaffFeature(database.FranchiseFeatureServiceRequests), controllers.GetServiceRequestsNew)
 			services.GET("/:id", controllers.GetServiceRequestByIDNew)
+			services.GET("/:id/report", controllers.GetServiceReport)
+			services.POST("/:id/attachments", middleware.CustomerAuthMiddleware(), controllers.AddServiceRequestAttachments)
+			services.GET("/:id/attachments", controllers.GetServiceRequestAttachments)
 			services.PUT("/:id", controllers.UpdateServiceRequestNew)
 
 		}
@@ -156,19 +460,119 @@ func SetupRoutes(r *gin.Engine) {
 			franchises.PATCH("/orders/:id/assign-agent", controllers.AssignOrderToAgent)
 			franchises.GET("/service-agents", controllers.GetServiceAgentsForFranchise)
 
+			// Working hours drive the bookable service slots
+			franchises.GET("/:id/working-hours", controllers.GetFranchiseWorkingHours)
+			franchises.PUT("/:id/working-hours", controllers.UpdateFranchiseWorkingHours)
+
+		}
+
+		// Direct uploads: clients PUT files straight to S3 and confirm them here
+		uploads := protected.Group("/uploads")
+		{
+			uploads.POST("/presign", controllers.PresignUpload)
+			uploads.POST("/:id/confirm", controllers.ConfirmUpload)
 		}
 
 		// Payments
 		payments := protected.Group("/payments")
 		{
-			payments.POST("/generate-order", middleware.CustomerAuthMiddleware(), controllers.GeneratePaymentOrder)
-			payments.POST("/generate-monthly", middleware.CustomerAuthMiddleware(), controllers.GenerateMonthlyPayment)
-			payments.POST("/verify", middleware.CustomerAuthMiddleware(), controllers.VerifyPayment)
+			payments.POST("/generate-order", middleware.CustomerAuthMiddleware(), middleware.DenyImpersonation(), controllers.GeneratePaymentOrder)
+			payments.POST("/generate-monthly", middleware.CustomerAuthMiddleware(), middleware.DenyImpersonation(), controllers.GenerateMonthlyPayment)
+			payments.POST("/verify", middleware.CustomerAuthMiddleware(), middleware.DenyImpersonation(), controllers.VerifyPayment)
+			payments.POST("/mock-checkout", middleware.CustomerAuthMiddleware(), controllers.MockCheckout)
+			payments.POST("/mandates", middleware.CustomerAuthMiddleware(), middleware.DenyImpersonation(), controllers.CreateMandate)
+			payments.GET("/mandates", middleware.CustomerAuthMiddleware(), controllers.GetMyMandates)
+			payments.POST("/mandates/:id/cancel", middleware.CustomerAuthMiddleware(), middleware.DenyImpersonation(), controllers.CancelMandate)
 			payments.GET("", controllers.GetPaymentHistory)
+			payments.GET("/ledger", middleware.CustomerAuthMiddleware(), controllers.GetMyLedger)
+			payments.GET("/credit-notes", middleware.CustomerAuthMiddleware(), controllers.GetMyCreditNotes)
 			payments.GET("/:id", controllers.GetPaymentByID)
+			payments.GET("/:id/invoice", controllers.GetPaymentInvoice)
+			payments.GET("/:id/invoice/pdf", controllers.GetPaymentInvoicePDF)
 		}
 
 		// Add this route for franchise dashboard
 		protected.GET("/franchise/dashboard", controllers.GetFranchiseDashboard)
+		protected.GET("/franchise/mine", middleware.FranchiseTeamAuthMiddleware(), controllers.GetMyFranchises)
+		protected.GET("/franchise/orders", middleware.FranchiseFeature(database.FranchiseFeatureOrders), controllers.AdminGetOrders)
+		protected.GET("/franchise/analytics", middleware.FranchiseFeature(database.FranchiseFeatureReports), controllers.GetFranchiseAnalytics)
+		protected.GET("/franchise/attendance", middleware.FranchiseFeature(database.FranchiseFeatureAgents), controllers.GetFranchiseAttendance)
+		protected.GET("/franchise/agents/performance", middleware.FranchiseFeature(database.FranchiseFeatureAgents), controllers.GetAgentPerformance)
+		protected.GET("/franchise/ledger", middleware.FranchiseFeature(database.FranchiseFeatureFinance), controllers.GetMyFranchiseLedger)
+
+		// Agent shifts and time off; unavailable agents get no slots or jobs
+		agentSchedules := protected.Group("/franchise/agents")
+		agentSchedules.Use(middleware.FranchiseFeature(database.FranchiseFeatureAgents))
+		{
+			agentSchedules.GET("/available", controllers.GetAvailableAgents)
+			agentSchedules.GET("/:id/availability", controllers.GetAgentAvailability)
+			agentSchedules.PUT("/:id/shifts", controllers.UpdateAgentShifts)
+			agentSchedules.POST("/:id/leaves", controllers.AddAgentLeave)
+			agentSchedules.DELETE("/:id/leaves/:leave_id", controllers.CancelAgentLeave)
+		}
+
+		// Staff accounts the owner creates instead of sharing their login
+		staff := protected.Group("/franchise/staff")
+		staff.Use(middleware.FranchiseOwnerAuthMiddleware(), middleware.DenyImpersonation())
+		{
+			staff.GET("", controllers.GetFranchiseStaff)
+			staff.POST("", controllers.AddFranchiseStaff)
+			staff.PUT("/:id", controllers.UpdateFranchiseStaff)
+			staff.DELETE("/:id", controllers.RemoveFranchiseStaff)
+		}
+
+		// Cash collected by agents is approved by the franchise before it counts
+		cash := protected.Group("/franchise")
+		cash.Use(middleware.FranchiseFeature(database.FranchiseFeatureCash))
+		{
+			cash.GET("/cash-payments", controllers.GetCashPayments)
+			cash.POST("/cash-payments/:id/approve", controllers.ApproveCashPayment)
+			cash.POST("/cash-payments/:id/reject", controllers.RejectCashPayment)
+			cash.GET("/cash-reconciliation", controllers.GetCashReconciliation)
+		}
+
+		inventory := protected.Group("/franchise/inventory")
+		inventory.Use(middleware.FranchiseFeature(database.FranchiseFeatureInventory))
+		{
+			inventory.GET("", controllers.GetInventory)
+			inventory.POST("", controllers.CreateInventoryItem)
+			inventory.PUT("/:id", controllers.UpdateInventoryItem)
+			inventory.DELETE("/:id", controllers.DeleteInventoryItem)
+			inventory.GET("/:id/movements", controllers.GetStockMovements)
+			inventory.POST("/:id/movements", controllers.RecordStockMovement)
+		}
+
+		deposits := protected.Group("/franchise/deposit-settlements")
+		deposits.Use(middleware.FranchiseFeature(database.FranchiseFeatureDeposits))
+		{
+			deposits.GET("", controllers.GetFranchiseDepositSettlements)
+			deposits.POST("/:id/deductions", controllers.AddDepositDeduction)
+			deposits.POST("/:id/settle", controllers.SettleDeposit)
+		}
+
+		settlements := protected.Group("/franchise/settlements")
+		settlements.Use(middleware.FranchiseFeature(database.FranchiseFeatureFinance))
+		{
+			settlements.GET("", controllers.GetFranchiseSettlements)
+			settlements.GET("/:id", controllers.GetSettlement)
+		}
+
+		protected.GET("/franchise/appointments", middleware.FranchiseFeature(database.FranchiseFeatureServiceRequests), controllers.GetFranchiseAppointments)
+
+		leads := protected.Group("/franchise/leads")
+		leads.Use(middleware.FranchiseFeature(database.FranchiseFeatureLeads))
+		{
+			leads.GET("", controllers.GetLeads)
+			leads.PUT("/:id", controllers.UpdateLead)
+			leads.POST("/:id/convert", controllers.ConvertLead)
+		}
+
+		bankAccounts := protected.Group("/franchise/bank-accounts")
+		bankAccounts.Use(middleware.FranchiseOwnerAuthMiddleware(), middleware.DenyImpersonation())
+		{
+			bankAccounts.GET("", controllers.GetBankAccounts)
+			bankAccounts.POST("", controllers.AddBankAccount)
+			bankAccounts.DELETE("/:id", controllers.DeleteBankAccount)
+		}
 	}
 }
@@ -0,0 +1,28 @@
+// Package tenant carries the brand a request is served for through its
+// context. Queries made with a context naming a tenant only see and write
+// that tenant's rows; see database.RegisterTenantScope.
+package tenant
+
+import "context"
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx that serves tenant id
+func WithID(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// Unscoped returns a copy of ctx that serves no tenant, for lookups that
+// decide which tenant a request is for
+func Unscoped(ctx context.Context) context.Context {
+	return WithID(ctx, 0)
+}
+
+// FromContext returns the tenant ctx serves, if it names one
+func FromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(contextKey{}).(uint)
+	return id, ok && id != 0
+}
@@ -0,0 +1,78 @@
+// Package tracing sets up OpenTelemetry tracing with an OTLP/HTTP exporter.
+package tracing
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"aquahome/config"
+)
+
+const instrumentationName = "aquahome"
+
+// Init installs the global tracer provider and propagators. Spans are only
+// exported when an OTLP endpoint is configured; the exporter also honours the
+// standard OTEL_EXPORTER_OTLP_* variables. The returned function flushes
+// pending spans and should be called on shutdown.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	// Propagate incoming trace context even when exporting is off so upstream
+	// traces are not broken by this service
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	if config.AppConfig.OTLPEndpoint == "" {
+		log.Println("ℹ️ Tracing disabled (OTEL_EXPORTER_OTLP_ENDPOINT not set)")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(config.AppConfig.OTLPEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(config.AppConfig.ServiceName),
+			semconv.DeploymentEnvironment(config.AppConfig.Environment),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.AppConfig.TraceSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Printf("✅ Tracing enabled, exporting to %s", config.AppConfig.OTLPEndpoint)
+	return provider.Shutdown, nil
+}
+
+// StartClientSpan starts a span for a call to an external service
+func StartClientSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+// EndSpan records err on the span, if any, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
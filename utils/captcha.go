@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"aquahome/config"
+)
+
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrCaptchaNotConfigured is returned outside development when no
+// CAPTCHA_SECRET is set, so public forms stay closed rather than unguarded
+var ErrCaptchaNotConfigured = errors.New("captcha is not configured")
+
+// VerifyCaptcha checks a CAPTCHA response token with the siteverify endpoint.
+// Without CAPTCHA_SECRET every token passes in development.
+func VerifyCaptcha(ctx context.Context, token, remoteIP string) (bool, error) {
+	cfg := config.AppConfig
+	if cfg.CaptchaSecret == "" {
+		if config.IsDevelopment() {
+			log.Printf("🤖 [captcha disabled] accepting token from %s", remoteIP)
+			return true, nil
+		}
+		return false, ErrCaptchaNotConfigured
+	}
+	if token == "" {
+		return false, nil
+	}
+
+	form := url.Values{"secret": {cfg.CaptchaSecret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.CaptchaVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := captchaClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("captcha verification returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
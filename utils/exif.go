@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// exifGPSTag is the IFD0 entry pointing at the GPS IFD
+const exifGPSTag = 0x8825
+
+// exifTypeSizes is the size in bytes of each TIFF field type
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// StripJPEGLocation removes where a JPEG photo was taken: the GPS fields of
+// its EXIF data are blanked in place and XMP metadata, which can repeat
+// them, is dropped. Other metadata, such as the orientation, is kept. It
+// reports whether anything was removed; data that isn't a JPEG is returned
+// as is.
+func StripJPEGLocation(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return data, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	changed := false
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xff {
+		marker := data[i+1]
+		// Image data follows the start of scan; copy the rest unchanged
+		if marker == 0xda {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[i:end]
+		payload := segment[4:]
+
+		if marker == 0xe1 && bytes.HasPrefix(payload, []byte("http://ns.adobe.com/xap/1.0/\x00")) {
+			changed = true
+			i = end
+			continue
+		}
+		if marker == 0xe1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			segment = append([]byte(nil), segment...)
+			if blankEXIFGPS(segment[10:]) {
+				changed = true
+			}
+		}
+		out = append(out, segment...)
+		i = end
+	}
+	if !changed {
+		return data, false
+	}
+	return append(out, data[i:]...), true
+}
+
+// blankEXIFGPS zeroes the GPS IFD of a TIFF-structured EXIF block, values
+// included, leaving it an empty directory so offsets elsewhere stay valid
+func blankEXIFGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd0 := order.Uint32(tiff[4:])
+	gps, ok := exifIFDPointer(tiff, order, ifd0, exifGPSTag)
+	if !ok || uint64(gps)+2 > uint64(len(tiff)) {
+		return false
+	}
+
+	count := uint32(order.Uint16(tiff[gps:]))
+	entries := gps + 2
+	if uint64(entries)+uint64(count)*12 > uint64(len(tiff)) {
+		return false
+	}
+	for n := uint32(0); n < count; n++ {
+		entry := tiff[entries+n*12 : entries+n*12+12]
+		size := exifTypeSizes[order.Uint16(entry[2:])] * order.Uint32(entry[4:])
+		if size > 4 {
+			offset := order.Uint32(entry[8:])
+			if uint64(offset)+uint64(size) <= uint64(len(tiff)) {
+				clear(tiff[offset : offset+size])
+			}
+		}
+		clear(entry)
+	}
+	order.PutUint16(tiff[gps:], 0)
+	return count > 0
+}
+
+// exifIFDPointer finds the value of a LONG entry pointing at a sub-IFD
+func exifIFDPointer(tiff []byte, order binary.ByteOrder, ifd uint32, tag uint16) (uint32, bool) {
+	if uint64(ifd)+2 > uint64(len(tiff)) {
+		return 0, false
+	}
+	count := uint32(order.Uint16(tiff[ifd:]))
+	for n := uint32(0); n < count; n++ {
+		entry := ifd + 2 + n*12
+		if uint64(entry)+12 > uint64(len(tiff)) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) == tag {
+			return order.Uint32(tiff[entry+8:]), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,39 @@
+package utils
+
+import "math"
+
+// earthRadiusKm is the mean radius of the earth used for distance estimates
+const earthRadiusKm = 6371.0
+
+// HaversineKm returns the great-circle distance in kilometres between two coordinates
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// HasCoordinates reports whether a latitude/longitude pair has been set
+func HasCoordinates(lat, lng float64) bool {
+	return lat != 0 || lng != 0
+}
+
+// PointInPolygon reports whether a point lies inside a polygon given as
+// [latitude, longitude] vertices, using ray casting. Fine for the city-sized
+// areas franchises cover, where the earth's curvature doesn't matter.
+func PointInPolygon(lat, lng float64, polygon [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		latI, lngI := polygon[i][0], polygon[i][1]
+		latJ, lngJ := polygon[j][0], polygon[j][1]
+		if (lngI > lng) != (lngJ > lng) &&
+			lat < (latJ-latI)*(lng-lngI)/(lngJ-lngI)+latI {
+			inside = !inside
+		}
+	}
+	return inside
+}
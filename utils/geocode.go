@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"aquahome/config"
+)
+
+var geocodeClient = &http.Client{Timeout: 10 * time.Second}
+
+// Geocoding errors callers can fall back from
+var (
+	ErrGeocodingDisabled = errors.New("geocoding is not configured")
+	ErrAddressNotFound   = errors.New("address could not be geocoded")
+)
+
+// Geocode looks up the coordinates of an address with the Google Geocoding
+// API, biased to India. Without GEOCODING_API_KEY it returns ErrGeocodingDisabled.
+func Geocode(address string) (lat, lng float64, err error) {
+	cfg := config.AppConfig
+	if cfg.GeocodingAPIKey == "" {
+		return 0, 0, ErrGeocodingDisabled
+	}
+
+	query := url.Values{}
+	query.Set("address", address)
+	query.Set("region", "in")
+	query.Set("key", cfg.GeocodingAPIKey)
+
+	resp, err := geocodeClient.Get(cfg.GeocodingURL + "?" + query.Encode())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return 0, 0, fmt.Errorf("geocoding service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Status  string `json:"status"`
+		Results []struct {
+			Geometry struct {
+				Location struct {
+					Lat float64 `json:"lat"`
+					Lng float64 `json:"lng"`
+				} `json:"location"`
+			} `json:"geometry"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, 0, err
+	}
+	switch body.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return 0, 0, ErrAddressNotFound
+	default:
+		return 0, 0, fmt.Errorf("geocoding service returned status %s", body.Status)
+	}
+	if len(body.Results) == 0 {
+		return 0, 0, ErrAddressNotFound
+	}
+
+	location := body.Results[0].Geometry.Location
+	return location.Lat, location.Lng, nil
+}
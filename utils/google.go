@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"aquahome/config"
+)
+
+const googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// GoogleClaims are the fields of a Google ID token used for sign-in
+type GoogleClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+var googleKeys = struct {
+	sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	expires time.Time
+}{}
+
+var googleHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// VerifyGoogleIDToken checks the signature, issuer, audience and expiry of a
+// Google ID token and returns its claims
+func VerifyGoogleIDToken(idToken string) (*GoogleClaims, error) {
+	if len(config.AppConfig.GoogleClientIDs) == 0 {
+		return nil, errors.New("google sign-in is not configured")
+	}
+
+	claims := &GoogleClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		return googlePublicKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != "accounts.google.com" && claims.Issuer != "https://accounts.google.com" {
+		return nil, errors.New("invalid token issuer")
+	}
+
+	audienceOK := false
+	for _, clientID := range config.AppConfig.GoogleClientIDs {
+		if claims.VerifyAudience(clientID, true) {
+			audienceOK = true
+			break
+		}
+	}
+	if !audienceOK {
+		return nil, errors.New("token was not issued for this app")
+	}
+
+	if claims.Subject == "" || claims.Email == "" {
+		return nil, errors.New("token is missing subject or email")
+	}
+	return claims, nil
+}
+
+// googlePublicKey returns Google's signing key with the given id, refreshing the
+// key set when it has expired or the id is unknown
+func googlePublicKey(kid string) (*rsa.PublicKey, error) {
+	googleKeys.Lock()
+	defer googleKeys.Unlock()
+
+	if key, ok := googleKeys.keys[kid]; ok && time.Now().Before(googleKeys.expires) {
+		return key, nil
+	}
+
+	resp, err := googleHTTPClient.Get(googleCertsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching google certs: %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	googleKeys.keys = keys
+	googleKeys.expires = time.Now().Add(cacheMaxAge(resp.Header.Get("Cache-Control"), time.Hour))
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	return key, nil
+}
+
+// cacheMaxAge reads max-age from a Cache-Control header
+func cacheMaxAge(header string, fallback time.Duration) time.Duration {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(part, "max-age=")); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
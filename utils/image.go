@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageSize is a named rendition of an uploaded image, bounded by MaxWidth
+type ImageSize struct {
+	Name     string
+	MaxWidth int
+}
+
+// ProductImageSizes are the renditions generated for every product image
+var ProductImageSizes = []ImageSize{
+	{Name: "thumbnail", MaxWidth: 200},
+	{Name: "medium", MaxWidth: 600},
+	{Name: "full", MaxWidth: 1600},
+}
+
+// Uploaded images may be at most MaxImageSide pixels a side and
+// MaxImagePixels in all, which keeps decoding them within memory
+const (
+	MaxImageSide   = 8000
+	MaxImagePixels = 40_000_000
+)
+
+// ThumbnailWidth is the width of the WebP thumbnails made of uploaded photos
+const ThumbnailWidth = 320
+
+// imageTypes are the sniffed content types accepted as images
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	// ErrUnsupportedImage is returned for data that isn't a JPEG, PNG, GIF or WebP image
+	ErrUnsupportedImage = errors.New("not a JPEG, PNG, GIF or WebP image")
+	// ErrImageTooLarge is returned for images beyond the dimension limits
+	ErrImageTooLarge = fmt.Errorf("image is larger than %dx%d pixels", MaxImageSide, MaxImageSide)
+)
+
+// CheckImage sniffs the content type of data and checks it is an image
+// within the dimension limits, reading only its header. It returns the
+// content type.
+func CheckImage(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !imageTypes[contentType] {
+		return "", ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedImage
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width > MaxImageSide || config.Height > MaxImageSide ||
+		config.Width*config.Height > MaxImagePixels {
+		return "", ErrImageTooLarge
+	}
+	return contentType, nil
+}
+
+// DecodeImage checks and decodes a JPEG, PNG, GIF or WebP image and returns
+// it with its format name
+func DecodeImage(data []byte) (image.Image, string, error) {
+	if _, err := CheckImage(data); err != nil {
+		return nil, "", err
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// ResizeToWidth scales img down to maxWidth keeping its aspect ratio.
+// Images that are already small enough are returned unchanged.
+func ResizeToWidth(img image.Image, maxWidth int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxWidth {
+		return img
+	}
+	height := bounds.Dy() * maxWidth / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// CropSquare cuts the largest centred square out of img and scales it down
+// to size pixels a side, e.g. for avatars
+func CropSquare(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+	size = min(size, side)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Over, nil)
+	return dst
+}
+
+// EncodeJPEG writes img as a JPEG suitable for serving on the storefront
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -12,19 +11,32 @@ import (
 
 // JWTClaims represents the claims in the JWT token
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid,omitempty"`     // set for tokens issued through a refresh-token session
+	Purpose   string `json:"purpose,omitempty"` // set on tokens that are not access tokens, e.g. two-factor login
+
+	// Set on tokens an admin uses to act as the user; apps show the banner
+	// for as long as the token is in use
+	ImpersonatorID      uint   `json:"impersonator_id,omitempty"`
+	ImpersonationBanner string `json:"impersonation_banner,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateJWT generates a new JWT token
 func GenerateJWT(userID uint, email, role string, expTime time.Time) (string, error) {
+	return GenerateSessionJWT(userID, email, role, 0, expTime)
+}
+
+// GenerateSessionJWT generates a new JWT token bound to a login session
+func GenerateSessionJWT(userID uint, email, role string, sessionID uint, expTime time.Time) (string, error) {
 	// Create claims
 	claims := JWTClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -32,6 +44,56 @@ func GenerateJWT(userID uint, email, role string, expTime time.Time) (string, er
 		},
 	}
 
+	return signJWT(claims)
+}
+
+// GenerateImpersonationJWT generates a token that lets an admin act as the
+// user. It is not bound to a session and cannot be refreshed.
+func GenerateImpersonationJWT(userID uint, email, role string, impersonatorID uint, banner string, expTime time.Time) (string, error) {
+	now := time.Now()
+	claims := JWTClaims{
+		UserID:              userID,
+		Email:               email,
+		Role:                role,
+		ImpersonatorID:      impersonatorID,
+		ImpersonationBanner: banner,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	return signJWT(claims)
+}
+
+// Purposes of tokens issued during two-factor login
+const (
+	TokenPurposeTwoFactor      = "2fa"       // password checked, code still needed
+	TokenPurposeTwoFactorSetup = "2fa_setup" // password checked, authenticator must be set up first
+)
+
+// GenerateTwoFactorJWT generates a token for the second step of a login. It
+// is not an access token. challengeID identifies this login attempt, so the
+// wrong codes tried against it can be counted.
+func GenerateTwoFactorJWT(userID uint, email, role, purpose, challengeID string, expTime time.Time) (string, error) {
+	now := time.Now()
+	claims := JWTClaims{
+		UserID:  userID,
+		Email:   email,
+		Role:    role,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challengeID,
+			ExpiresAt: jwt.NewNumericDate(expTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	return signJWT(claims)
+}
+
+// signJWT signs claims with the app's JWT secret
+func signJWT(claims JWTClaims) (string, error) {
 	// Create token with claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -67,26 +129,7 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
-// GenerateResetToken generates a random token for password reset
-func GenerateResetToken() string {
-	// Generate a random string for password reset
-	bytes := make([]byte, 32)
-	for i := 0; i < 32; i++ {
-		bytes[i] = byte(time.Now().Nanosecond() % 256)
-		time.Sleep(1 * time.Nanosecond) // Add tiny sleep to ensure nanosecond changes
-	}
-
-	// Convert to hex string
-	token := ""
-	for _, b := range bytes {
-		token += string(b)
-	}
-
-	return token
-}
-
 // GetAdminToken returns the admin token from config
 func GetAdminToken() string {
-	// Use environment variable or a default value
-	return os.Getenv("ADMIN_TOKEN")
+	return config.AppConfig.AdminToken
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"strings"
+
+	"aquahome/config"
+)
+
+// SendEmail sends a plain-text email through the configured SMTP server.
+// Without SMTP_HOST the message is logged instead, which is handy in development.
+func SendEmail(to, subject, body string) error {
+	cfg := config.AppConfig
+	if cfg.SMTPHost == "" {
+		log.Printf("📧 [email disabled] to=%s subject=%q\n%s", to, subject, body)
+		return nil
+	}
+
+	from, err := mail.ParseAddress(cfg.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + to,
+		"Subject: " + mimeHeader(subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+
+	var auth smtp.Auth
+	if cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	addr := fmt.Sprintf("%s:%d", cfg.SMTPHost, cfg.SMTPPort)
+	return smtp.SendMail(addr, auth, from.Address, []string{to}, []byte(message))
+}
+
+// mimeHeader encodes a header value so that non-ASCII subjects survive transport
+func mimeHeader(value string) string {
+	return mime.QEncoding.Encode("utf-8", value)
+}
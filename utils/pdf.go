@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4 page geometry of TextDocument, in points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+	pdfMargin     = 56.0
+)
+
+// TextDocument builds a plain A4 PDF of titles, headings and wrapped
+// paragraphs in the standard Helvetica fonts. It covers generated documents
+// such as agreements without a PDF library; text outside Latin-1 is
+// replaced.
+type TextDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// NewTextDocument starts a document with one empty page
+func NewTextDocument() *TextDocument {
+	doc := &TextDocument{}
+	doc.newPage()
+	return doc
+}
+
+func (d *TextDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// Title adds a large bold line
+func (d *TextDocument) Title(text string) { d.write("F2", 16, text) }
+
+// Heading adds a bold section heading with space above it
+func (d *TextDocument) Heading(text string) {
+	d.Space()
+	d.write("F2", 12, text)
+}
+
+// Paragraph adds regular text, wrapped to the page width
+func (d *TextDocument) Paragraph(text string) { d.write("F1", 10.5, text) }
+
+// Space adds a blank half line
+func (d *TextDocument) Space() { d.y -= 7 }
+
+// write wraps text into lines of the given font and size, starting new
+// pages as they fill up
+func (d *TextDocument) write(font string, size float64, text string) {
+	leading := size * 1.35
+	// Helvetica averages about half an em per character; bold runs wider
+	charWidth := size * 0.5
+	if font == "F2" {
+		charWidth = size * 0.56
+	}
+	perLine := int((pdfPageWidth - 2*pdfMargin) / charWidth)
+
+	for _, line := range wrapText(text, perLine) {
+		if d.y-leading < pdfMargin {
+			d.newPage()
+		}
+		d.y -= leading
+		fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, pdfMargin, d.y, pdfString(line))
+	}
+}
+
+// wrapText splits text into lines of at most width characters, breaking
+// between words and keeping explicit line breaks
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfString encodes text as a WinAnsi PDF string body
+func pdfString(text string) string {
+	text = strings.ReplaceAll(text, "₹", "Rs. ")
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '‘' || r == '’':
+			b.WriteByte('\'')
+		case r == '“' || r == '”':
+			b.WriteByte('"')
+		case r == '–' || r == '—':
+			b.WriteByte('-')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// Bytes renders the document as a PDF file
+func (d *TextDocument) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page then takes
+	// a page object followed by its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"aquahome/config"
+)
+
+var pushClient = &http.Client{Timeout: 10 * time.Second}
+
+// SendPush posts a push notification for the given device tokens to the
+// configured push gateway as JSON {"tokens", "title", "body", "data"} with
+// the API key as a bearer token. Without PUSH_API_URL it is logged instead.
+func SendPush(tokens []string, title, body string, data map[string]string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	cfg := config.AppConfig
+	if cfg.PushAPIURL == "" {
+		log.Printf("🔔 [push disabled] to=%d devices title=%q: %s", len(tokens), title, body)
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"tokens": tokens,
+		"title":  title,
+		"body":   body,
+		"data":   data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.PushAPIURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.PushAPIKey)
+
+	resp, err := pushClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("push gateway returned %s", resp.Status)
+	}
+	return nil
+}
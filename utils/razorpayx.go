@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"aquahome/config"
+)
+
+var razorpayXClient = &http.Client{Timeout: 20 * time.Second}
+
+// ErrPayoutsDisabled is returned when no RazorpayX account number is configured
+var ErrPayoutsDisabled = errors.New("RazorpayX payouts are not configured")
+
+// RazorpayXError is an error response from the RazorpayX API
+type RazorpayXError struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *RazorpayXError) Error() string {
+	return fmt.Sprintf("razorpayx: %s (%d %s)", e.Description, e.Status, e.Code)
+}
+
+// PayoutsEnabled reports whether RazorpayX payouts are configured
+func PayoutsEnabled() bool {
+	return config.AppConfig.RazorpayXAccountNumber != ""
+}
+
+// RazorpayX calls a RazorpayX API endpoint (e.g. "POST", "/payouts") with the
+// Razorpay key and secret. A non-empty idempotencyKey is sent as
+// X-Payout-Idempotency so a retried request cannot pay twice.
+func RazorpayX(method, path string, body interface{}, idempotencyKey string) (map[string]interface{}, error) {
+	cfg := config.AppConfig
+	if !PayoutsEnabled() {
+		return nil, ErrPayoutsDisabled
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, cfg.RazorpayXURL+path, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(cfg.RazorpayKey, cfg.RazorpaySecret)
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("X-Payout-Idempotency", idempotencyKey)
+	}
+
+	resp, err := razorpayXClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && resp.StatusCode < 300 {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &RazorpayXError{Status: resp.StatusCode, Description: resp.Status}
+		if details, ok := result["error"].(map[string]interface{}); ok {
+			apiErr.Code, _ = details["code"].(string)
+			if description, _ := details["description"].(string); description != "" {
+				apiErr.Description = description
+			}
+		}
+		return nil, apiErr
+	}
+	return result, nil
+}
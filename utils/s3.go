@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aquahome/config"
+)
+
+var s3Client = &http.Client{Timeout: 10 * time.Second}
+
+// ErrS3ObjectNotFound is returned when an object isn't in the bucket
+var ErrS3ObjectNotFound = errors.New("object not found")
+
+// S3Enabled reports whether a bucket is configured for direct uploads
+func S3Enabled() bool {
+	return config.AppConfig.S3Bucket != ""
+}
+
+// s3Location returns the host and path an object is addressed by: the
+// bucket's own host on AWS, or the bucket as the first path segment on a
+// custom endpoint
+func s3Location(key string) (scheme, host, objectPath string) {
+	cfg := config.AppConfig
+	if cfg.S3Endpoint != "" {
+		endpoint, _ := url.Parse(cfg.S3Endpoint)
+		return endpoint.Scheme, endpoint.Host, "/" + cfg.S3Bucket + "/" + key
+	}
+	return "https", fmt.Sprintf("%s.s3.%s.amazonaws.com", cfg.S3Bucket, cfg.S3Region), "/" + key
+}
+
+// S3ObjectURL returns the URL an uploaded object is served from
+func S3ObjectURL(key string) string {
+	if base := config.AppConfig.S3PublicURL; base != "" {
+		return strings.TrimRight(base, "/") + "/" + awsURIEncode(key, false)
+	}
+	scheme, host, objectPath := s3Location(key)
+	return scheme + "://" + host + awsURIEncode(objectPath, false)
+}
+
+// S3KeyFromURL returns the key of the object S3ObjectURL serves at objectURL,
+// and false for URLs outside the bucket
+func S3KeyFromURL(objectURL string) (string, bool) {
+	if !S3Enabled() {
+		return "", false
+	}
+	rest, found := strings.CutPrefix(objectURL, S3ObjectURL(""))
+	if !found || rest == "" {
+		return "", false
+	}
+	key, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// PresignS3 returns a URL that lets its holder make one kind of request for
+// an object until ttl passes, signed with AWS Signature Version 4. The
+// headers are part of the signature, so the request must send them with the
+// same values; S3 refuses it otherwise.
+func PresignS3(method, key string, headers map[string]string, ttl time.Duration) (string, error) {
+	cfg := config.AppConfig
+	if !S3Enabled() {
+		return "", errors.New("S3 is not configured")
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + cfg.S3Region + "/s3/aws4_request"
+	scheme, host, objectPath := s3Location(key)
+
+	signed := map[string]string{"host": host}
+	for name, value := range headers {
+		signed[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", cfg.S3AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	canonicalQuery := awsCanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		awsURIEncode(objectPath, false),
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key4 := hmacSHA256([]byte("AWS4"+cfg.S3SecretAccessKey), date)
+	key4 = hmacSHA256(key4, cfg.S3Region)
+	key4 = hmacSHA256(key4, "s3")
+	key4 = hmacSHA256(key4, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key4, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s",
+		scheme, host, awsURIEncode(objectPath, false), canonicalQuery, signature), nil
+}
+
+// HeadS3Object returns the size and content type of an object in the bucket
+func HeadS3Object(key string) (int64, string, error) {
+	resp, err := doS3(http.MethodHead, key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, "", ErrS3ObjectNotFound
+	case resp.StatusCode >= 300:
+		return 0, "", fmt.Errorf("s3 returned %s", resp.Status)
+	}
+	return resp.ContentLength, resp.Header.Get("Content-Type"), nil
+}
+
+// GetS3Object downloads an object of at most limit bytes from the bucket
+func GetS3Object(key string, limit int64) ([]byte, error) {
+	resp, err := doS3(http.MethodGet, key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrS3ObjectNotFound
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("s3 returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("object is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// PutS3Object stores data in the bucket under key, replacing any object there
+func PutS3Object(key, contentType string, data []byte) error {
+	headers := map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.Itoa(len(data)),
+	}
+	signedURL, err := PresignS3(http.MethodPut, key, headers, time.Minute)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, signedURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("s3 returned %s", resp.Status)
+	}
+	return nil
+}
+
+// DeleteS3Object removes an object from the bucket; a missing one is not an error
+func DeleteS3Object(key string) error {
+	resp, err := doS3(http.MethodDelete, key)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 returned %s", resp.Status)
+	}
+	return nil
+}
+
+// doS3 makes a request for an object through a presigned URL
+func doS3(method, key string) (*http.Response, error) {
+	signedURL, err := PresignS3(method, key, nil, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, signedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s3Client.Do(req)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsCanonicalQuery encodes query parameters sorted by name, the way
+// Signature Version 4 expects
+func awsCanonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, awsURIEncode(name, true)+"="+awsURIEncode(query.Get(name), true))
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters, and
+// slashes too when encodeSlash is set
+func awsURIEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
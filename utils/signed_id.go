@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"aquahome/config"
+)
+
+// SignID returns a token naming id for one purpose, such as the links in
+// appointment reminders, so a link needs no stored secret. Tokens can't be
+// forged, or used for another purpose, without JWT_SECRET.
+func SignID(purpose string, id uint) string {
+	encoded := strconv.FormatUint(uint64(id), 36)
+	return encoded + "." + idSignature(purpose, encoded)
+}
+
+// VerifySignedID returns the ID a token from SignID names, if it was signed
+// for purpose
+func VerifySignedID(purpose, token string) (uint, bool) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(idSignature(purpose, encoded))) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(encoded, 36, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func idSignature(purpose, encoded string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWTSecret))
+	mac.Write([]byte(purpose + ":" + encoded))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
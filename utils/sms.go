@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"aquahome/config"
+)
+
+var smsClient = &http.Client{Timeout: 10 * time.Second}
+
+// SendSMS posts a text message to the configured SMS gateway as JSON
+// {"to", "sender", "message"} with the API key as a bearer token.
+// Without SMS_API_URL the message is logged instead.
+func SendSMS(phone, message string) error {
+	cfg := config.AppConfig
+	if cfg.SMSAPIURL == "" {
+		log.Printf("📱 [sms disabled] to=%s: %s", phone, message)
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"to":      phone,
+		"sender":  cfg.SMSSenderID,
+		"message": message,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.SMSAPIURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.SMSAPIKey)
+
+	resp, err := smsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// NormalizePhone strips formatting from an Indian mobile number and returns its
+// 10 digits, or "" when the number isn't valid
+func NormalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case len(number) == 12 && strings.HasPrefix(number, "91"):
+		number = number[2:]
+	case len(number) == 11 && strings.HasPrefix(number, "0"):
+		number = number[1:]
+	}
+
+	if len(number) != 10 || number[0] < '6' {
+		return ""
+	}
+	return number
+}
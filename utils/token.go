@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// GenerateSecureToken returns a random hex token built from n random bytes
+func GenerateSecureToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// HashToken returns the SHA-256 hex digest of a token so it can be stored safely
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumericOTP returns a random numeric code with the given number of
+// digits. Random bytes of 250 and above are discarded so every digit is
+// equally likely.
+func GenerateNumericOTP(digits int) (string, error) {
+	code := make([]byte, 0, digits)
+	bytes := make([]byte, digits)
+	for len(code) < digits {
+		if _, err := rand.Read(bytes); err != nil {
+			return "", err
+		}
+		for _, b := range bytes {
+			if b < 250 && len(code) < digits {
+				code = append(code, '0'+b%10)
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// TokensEqual compares two secrets in constant time
+func TokensEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" with the
+// endpoint's secret. Receivers recompute it to check a delivery came from us
+// and reject old timestamps to stop replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,493 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// Lossless WebP (VP8L) encoding. Pixels have the green channel subtracted
+// from red and blue and are then predicted from their neighbours, picking
+// the best predictor per 16x16 block; the residuals are written as
+// Huffman-coded literals. That's enough for small renditions such as
+// thumbnails without a cgo dependency on libwebp.
+
+const (
+	webpMaxSide       = 1 << 14
+	webpBlockBits     = 4 // predictor blocks are 16x16 pixels
+	webpMaxCodeLength = 15
+	webpMaxCLLength   = 7 // longest code in the code length code
+)
+
+// Predictor modes tried for each block, as numbered in the VP8L spec
+const (
+	webpPredictLeft   = 1
+	webpPredictTop    = 2
+	webpPredictSelect = 11
+	webpPredictClamp  = 12 // ClampAddSubtractFull
+)
+
+var webpPredictors = []uint32{webpPredictLeft, webpPredictTop, webpPredictSelect, webpPredictClamp}
+
+// webpCodeLengthOrder is the order code length code lengths are written in
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img as a lossless WebP image
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > webpMaxSide || height > webpMaxSide {
+		return errors.New("webp: image must be between 1 and 16384 pixels a side")
+	}
+
+	pixels := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+			// Subtract green: red and blue are stored relative to green
+			pixels[y*width+x] = uint32(c.A)<<24 | uint32(c.R-c.G)<<16 | uint32(c.G)<<8 | uint32(c.B-c.G)
+		}
+	}
+	modes, residuals := webpPredict(pixels, width, height)
+
+	bw := &webpBitWriter{}
+	bw.write(0x2f, 8) // VP8L signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	// Transforms, undone by the decoder in reverse order
+	bw.write(1, 1)
+	bw.write(2, 2) // subtract green
+	bw.write(1, 1)
+	bw.write(0, 2) // predictor
+	bw.write(webpBlockBits-2, 3)
+	bw.write(0, 1) // no color cache
+	webpWritePixels(bw, modes)
+	bw.write(0, 1) // no more transforms
+
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // one set of prefix codes for the whole image
+	webpWritePixels(bw, residuals)
+	data := bw.bytes()
+
+	size := len(data) + len(data)%2
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+size))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// webpPredict picks a predictor for each block and returns the block modes,
+// as the predictor transform image, and the residual of every pixel
+func webpPredict(pixels []uint32, width, height int) ([]uint32, []uint32) {
+	blocksWide := (width + 1<<webpBlockBits - 1) >> webpBlockBits
+	blocksHigh := (height + 1<<webpBlockBits - 1) >> webpBlockBits
+	modes := make([]uint32, blocksWide*blocksHigh)
+	residuals := make([]uint32, len(pixels))
+
+	for by := 0; by < blocksHigh; by++ {
+		for bx := 0; bx < blocksWide; bx++ {
+			x0, y0 := bx<<webpBlockBits, by<<webpBlockBits
+			x1, y1 := min(x0+1<<webpBlockBits, width), min(y0+1<<webpBlockBits, height)
+
+			best, bestCost := webpPredictors[0], -1
+			for _, mode := range webpPredictors {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						cost += webpResidualCost(webpSub(pixels[y*width+x], webpPrediction(pixels, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[by*blocksWide+bx] = best << 8 // the mode is read from green
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					residuals[y*width+x] = webpSub(pixels[y*width+x], webpPrediction(pixels, width, x, y, best))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// webpPrediction predicts the pixel at x, y from the pixels already decoded.
+// The first row and column always use the pixel before them.
+func webpPrediction(pixels []uint32, width, x, y int, mode uint32) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pixels[i-1]
+	case x == 0:
+		return pixels[i-width]
+	}
+
+	left, top, topLeft := pixels[i-1], pixels[i-width], pixels[i-width-1]
+	switch mode {
+	case webpPredictTop:
+		return top
+	case webpPredictSelect:
+		// Whichever of left and top is closer to left+top-topLeft
+		fromLeft, fromTop := 0, 0
+		for shift := 0; shift < 32; shift += 8 {
+			fromLeft += webpAbs(webpChannel(top, shift) - webpChannel(topLeft, shift))
+			fromTop += webpAbs(webpChannel(left, shift) - webpChannel(topLeft, shift))
+		}
+		if fromLeft < fromTop {
+			return left
+		}
+		return top
+	case webpPredictClamp:
+		var predicted uint32
+		for shift := 0; shift < 32; shift += 8 {
+			v := webpChannel(left, shift) + webpChannel(top, shift) - webpChannel(topLeft, shift)
+			predicted |= uint32(min(max(v, 0), 255)) << shift
+		}
+		return predicted
+	}
+	return left
+}
+
+func webpChannel(pixel uint32, shift int) int {
+	return int(pixel >> shift & 0xff)
+}
+
+func webpAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// webpSub subtracts b from a channel by channel, modulo 256
+func webpSub(a, b uint32) uint32 {
+	var diff uint32
+	for shift := 0; shift < 32; shift += 8 {
+		diff |= (a>>shift - b>>shift) & 0xff << shift
+	}
+	return diff
+}
+
+// webpResidualCost estimates how many bits a residual takes: small values,
+// either side of zero, are cheap
+func webpResidualCost(residual uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += webpAbs(int(int8(residual >> shift)))
+	}
+	return cost
+}
+
+// webpWritePixels writes the prefix codes for pixels and then the pixels
+// themselves as literals
+func webpWritePixels(bw *webpBitWriter, pixels []uint32) {
+	// Green (with the unused backward reference lengths), red, blue, alpha
+	// and the unused distance code
+	histograms := [5][]int{make([]int, 256+24), make([]int, 256), make([]int, 256), make([]int, 256), make([]int, 40)}
+	for _, p := range pixels {
+		histograms[0][p>>8&0xff]++
+		histograms[1][p>>16&0xff]++
+		histograms[2][p&0xff]++
+		histograms[3][p>>24]++
+	}
+
+	var codes [5]webpHuffmanCode
+	for i, histogram := range histograms {
+		codes[i] = webpWriteHuffmanCode(bw, histogram)
+	}
+	for _, p := range pixels {
+		codes[0].write(bw, int(p>>8&0xff))
+		codes[1].write(bw, int(p>>16&0xff))
+		codes[2].write(bw, int(p&0xff))
+		codes[3].write(bw, int(p>>24))
+	}
+}
+
+// webpHuffmanCode holds the bit-reversed canonical code of every symbol
+type webpHuffmanCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (h webpHuffmanCode) write(bw *webpBitWriter, symbol int) {
+	bw.write(h.codes[symbol], uint(h.lengths[symbol]))
+}
+
+// webpWriteHuffmanCode writes the prefix code for a histogram and returns it.
+// One or two small symbols are written as a "simple" code; a single symbol
+// then takes no bits at all.
+func webpWriteHuffmanCode(bw *webpBitWriter, histogram []int) webpHuffmanCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		lengths := make([]int, len(histogram))
+		bw.write(1, 1) // simple code
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return webpCanonicalCode(lengths)
+	}
+
+	lengths := webpCodeLengths(histogram, webpMaxCodeLength)
+	tokens := webpCodeLengthTokens(lengths)
+	clHistogram := make([]int, 19)
+	for _, token := range tokens {
+		clHistogram[token.symbol]++
+	}
+	clLengths := webpCodeLengths(clHistogram, webpMaxCLLength)
+	// A lone code length symbol still needs a complete code
+	var clUsed []int
+	for symbol, length := range clLengths {
+		if length > 0 {
+			clUsed = append(clUsed, symbol)
+		}
+	}
+	if len(clUsed) == 1 {
+		clLengths[clUsed[0]] = 1
+		clLengths[(clUsed[0]+1)%19] = 1
+	}
+	clCode := webpCanonicalCode(clLengths)
+
+	count := 4
+	for i, symbol := range webpCodeLengthOrder {
+		if clLengths[symbol] > 0 {
+			count = max(count, i+1)
+		}
+	}
+	bw.write(0, 1) // normal code
+	bw.write(uint32(count-4), 4)
+	for _, symbol := range webpCodeLengthOrder[:count] {
+		bw.write(uint32(clLengths[symbol]), 3)
+	}
+	bw.write(0, 1) // lengths for the whole alphabet follow
+	for _, token := range tokens {
+		clCode.write(bw, token.symbol)
+		bw.write(token.extra, token.extraBits)
+	}
+	return webpCanonicalCode(lengths)
+}
+
+// webpCodeLengthToken is one symbol of the code length code: a length, or a
+// run of zeros or of the previous length with extra bits for its size
+type webpCodeLengthToken struct {
+	symbol    int
+	extra     uint32
+	extraBits uint
+}
+
+// webpCodeLengthTokens run-length encodes code lengths
+func webpCodeLengthTokens(lengths []int) []webpCodeLengthToken {
+	var tokens []webpCodeLengthToken
+	previous := 8
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+
+		switch {
+		case length == 0 && run >= 3:
+			for run >= 11 {
+				n := min(run, 138)
+				tokens = append(tokens, webpCodeLengthToken{18, uint32(n - 11), 7})
+				run -= n
+				i += n
+			}
+			if run >= 3 {
+				tokens = append(tokens, webpCodeLengthToken{17, uint32(run - 3), 3})
+				i += run
+				run = 0
+			}
+			for ; run > 0; run-- {
+				tokens = append(tokens, webpCodeLengthToken{0, 0, 0})
+				i++
+			}
+		case length != 0 && length == previous && run >= 3:
+			for run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, webpCodeLengthToken{16, uint32(n - 3), 2})
+				run -= n
+				i += n
+			}
+			for ; run > 0; run-- {
+				tokens = append(tokens, webpCodeLengthToken{length, 0, 0})
+				i++
+			}
+		default:
+			tokens = append(tokens, webpCodeLengthToken{length, 0, 0})
+			if length != 0 {
+				previous = length
+			}
+			i++
+		}
+	}
+	return tokens
+}
+
+// webpCodeLengths builds Huffman code lengths for a histogram, no longer
+// than maxLength; counts are flattened until the code fits
+func webpCodeLengths(histogram []int, maxLength int) []int {
+	counts := append([]int(nil), histogram...)
+	for {
+		lengths := webpHuffmanLengths(counts)
+		longest := 0
+		for _, length := range lengths {
+			longest = max(longest, length)
+		}
+		if longest <= maxLength {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = count/2 + 1
+			}
+		}
+	}
+}
+
+// webpHuffmanLengths builds an unlimited Huffman code and returns each
+// symbol's length; a single used symbol gets length 1
+func webpHuffmanLengths(counts []int) []int {
+	type node struct {
+		count       int
+		symbol      int // -1 for internal nodes
+		left, right int
+	}
+	var nodes []node
+	var queue []int
+	for symbol, count := range counts {
+		if count > 0 {
+			nodes = append(nodes, node{count: count, symbol: symbol, left: -1, right: -1})
+			queue = append(queue, len(nodes)-1)
+		}
+	}
+	lengths := make([]int, len(counts))
+	if len(queue) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths
+	}
+
+	for len(queue) > 1 {
+		sort.SliceStable(queue, func(i, j int) bool { return nodes[queue[i]].count < nodes[queue[j]].count })
+		a, b := queue[0], queue[1]
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, symbol: -1, left: a, right: b})
+		queue = append(queue[2:], len(nodes)-1)
+	}
+
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if nodes[i].symbol >= 0 {
+			lengths[nodes[i].symbol] = depth
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	if len(queue) == 1 {
+		walk(queue[0], 0)
+	}
+	return lengths
+}
+
+// webpCanonicalCode assigns canonical codes to code lengths, bit-reversed
+// because the bit stream is read least significant bit first
+func webpCanonicalCode(lengths []int) webpHuffmanCode {
+	var lengthCounts [webpMaxCodeLength + 1]int
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCounts[length]++
+		}
+	}
+	var next [webpMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for length := 1; length <= webpMaxCodeLength; length++ {
+		code = (code + uint32(lengthCounts[length-1])) << 1
+		next[length] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		c := next[length]
+		next[length]++
+		var reversed uint32
+		for i := 0; i < length; i++ {
+			reversed = reversed<<1 | c&1
+			c >>= 1
+		}
+		codes[symbol] = reversed
+	}
+	return webpHuffmanCode{lengths: lengths, codes: codes}
+}
+
+// webpBitWriter packs bits least significant first
+type webpBitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *webpBitWriter) write(value uint32, nbits uint) {
+	w.acc |= uint64(value) << w.nbits
+	w.nbits += nbits
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *webpBitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}